@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// resolveBotUsername returns the username of the bot the token belongs to, asked with getMe,
+// and a warning when TELEGRAM_BOT_USERNAME (configured) names another bot or getMe fails, in
+// which case configured is kept
+func resolveBotUsername(configured string, getMe func() (telegram.User, error)) (string, string) {
+	me, err := getMe()
+	if err != nil {
+		return configured, fmt.Sprintf("could not look up the bot username with getMe, deep links may point to the wrong bot: %v", err)
+	}
+	if configured != "" && !strings.EqualFold(configured, me.Username) {
+		return me.Username, fmt.Sprintf("TELEGRAM_BOT_USERNAME is @%s but the bot token belongs to @%s; using @%s", configured, me.Username, me.Username)
+	}
+	return me.Username, ""
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+func TestResolveBotUsername(t *testing.T) {
+	fork := func() (telegram.User, error) { return telegram.User{ID: 1, Username: "fork_bot"}, nil }
+	down := func() (telegram.User, error) { return telegram.User{}, errors.New("connection refused") }
+
+	if name, warning := resolveBotUsername("", fork); name != "fork_bot" || warning != "" {
+		t.Errorf("expected the bot from getMe, got %q (%q)", name, warning)
+	}
+	if name, warning := resolveBotUsername("Fork_Bot", fork); name != "fork_bot" || warning != "" {
+		t.Errorf("expected a matching name accepted, got %q (%q)", name, warning)
+	}
+	name, warning := resolveBotUsername("montblanc_booking_bot", fork)
+	if name != "fork_bot" || !strings.Contains(warning, "@montblanc_booking_bot but the bot token belongs to @fork_bot") {
+		t.Errorf("expected getMe to win with a warning, got %q (%q)", name, warning)
+	}
+	if name, warning := resolveBotUsername("fork_bot", down); name != "fork_bot" || !strings.Contains(warning, "connection refused") {
+		t.Errorf("expected the configured name kept with a warning, got %q (%q)", name, warning)
+	}
+}
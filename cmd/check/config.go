@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/config"
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+	"github.com/AlexYaroshenko/montblanc/internal/web"
+)
+
+// applyConfig hands the startup configuration to the packages; the FFCAM session credentials
+// are passed to parser.NewSession once the store is open
+func applyConfig(cfg config.Config) {
+	slog.SetDefault(newLogger(os.Stderr, cfg.Log))
+	parser.Retry.MaxAttempts = cfg.Parser.RetryAttempts
+	parser.Retry.BaseDelay = cfg.Parser.RetryBaseDelay
+	parser.FFCAMBreaker.Threshold = cfg.Parser.BreakerThreshold
+	parser.FFCAMBreaker.Cooldown = cfg.Parser.BreakerCooldown
+	parser.FFCAMLimiter = parser.NewRateLimiter(cfg.Parser.RateLimit, 1, time.Now)
+	parser.MaxBodySize = int64(cfg.Parser.MaxBodySize)
+	parser.DefaultPax = cfg.Parser.Pax
+	config.SetFiles(cfg.Checker)
+	store.TablePrefix = cfg.Store.TablePrefix
+	store.PlanQueryLimits = map[string]int{store.PlanFree: cfg.Store.FreeQueryLimit, store.PlanPro: cfg.Store.ProQueryLimit}
+
+	telegram.Configure(telegram.Settings{
+		BotToken:     cfg.Telegram.BotToken,
+		APIURL:       cfg.Telegram.APIURL,
+		AdminChatIDs: cfg.Notify.AdminChatIDs,
+	})
+	web.Configure(web.Settings{
+		Port:              cfg.Web.Port,
+		BaseURL:           cfg.Web.BaseURL,
+		BotUsername:       cfg.Telegram.BotUsername,
+		GAMeasurementID:   cfg.Web.GAMeasurementID,
+		AdminToken:        cfg.Web.AdminToken,
+		DeepLinkSecret:    cfg.Web.DeepLinkSecret,
+		UnsubscribeSecret: cfg.Web.UnsubscribeSecret,
+		WebhookSecret:     cfg.Telegram.WebhookSecret,
+		AdminChatIDs:      cfg.Notify.AdminChatIDs,
+		PublicChannel:     cfg.Notify.PublicChannel,
+		KeepAliveURL:      cfg.Web.KeepAliveURL,
+		KeepAliveInterval: cfg.Web.KeepAliveInterval,
+		HistoryRetention:  cfg.Checker.SnapshotRetention,
+		CheckInterval:     cfg.Checker.Interval,
+		DigestHour:        cfg.Notify.DigestHour,
+		StateFromStore:    cfg.Web.StateSource == "store",
+		ConfigReport:      cfg.Report(),
+		Notifier:          notify.TelegramNotifier{},
+	})
+}
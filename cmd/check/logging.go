@@ -0,0 +1,18 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/AlexYaroshenko/montblanc/internal/config"
+)
+
+// newLogger builds the process logger: readable text by default, JSON (LOG_FORMAT=json) for a
+// log aggregator
+func newLogger(w io.Writer, c config.LogConfig) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: c.Level}
+	if c.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
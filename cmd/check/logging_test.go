@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/config"
+)
+
+func TestNewLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, config.LogConfig{Format: "json", Level: slog.LevelInfo})
+	logger.Debug("fetched refuge", "refuge", "Tête Rousse")
+	logger.Info("fetched refuge", "refuge", "Tête Rousse", "dates", 31)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected only the info record, got %q", buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", lines[0], err)
+	}
+	if rec["msg"] != "fetched refuge" || rec["refuge"] != "Tête Rousse" || rec["dates"] != float64(31) || rec["level"] != "INFO" {
+		t.Errorf("unexpected record %v", rec)
+	}
+}
+
+func TestNewLoggerTextByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	newLogger(&buf, config.LogConfig{Format: "text", Level: slog.LevelDebug}).Debug("fetched refuge", "chat_id", "42")
+	if got := buf.String(); !strings.Contains(got, `level=DEBUG msg="fetched refuge" chat_id=42`) {
+		t.Errorf("unexpected text record %q", got)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// shutdownTimeout is how long shutdown waits for the in-flight check to finish
+	shutdownTimeout = 20 * time.Second
+	// shutdownGrace is how long a cancelled check gets to persist its unsent messages
+	shutdownGrace = 5 * time.Second
+)
+
+// waitForCheck waits up to timeout for done; after that it cancels the check and waits up to
+// grace for it to persist its queue. It reports whether the check finished within timeout.
+func waitForCheck(done <-chan struct{}, cancel context.CancelFunc, timeout time.Duration, grace time.Duration) bool {
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+	}
+	slog.Warn("check still running, cancelling", "after", timeout)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(grace):
+		slog.Error("check did not stop in time", "grace", grace)
+	}
+	return false
+}
+
+// shutdownSummary renders the admin message sent on shutdown
+func shutdownSummary(clean bool, flushed int, deferred int) string {
+	state := "🛑 Monitoring stopped cleanly"
+	if !clean {
+		state = "🛑 Monitoring stopped before the running check finished"
+	}
+	return fmt.Sprintf("%s, %s delivered, %s deferred to outbox", state, plural(flushed, "message"), plural(deferred, "message"))
+}
+
+// plural formats n with the word, adding an "s" unless n is 1
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
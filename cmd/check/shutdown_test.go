@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShutdownDuringActiveTick(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the check only stops once it's cancelled
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+	}()
+
+	if waitForCheck(done, cancel, 50*time.Millisecond, time.Second) {
+		t.Error("expected shutdown to report an unfinished check")
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("expected the check to stop within the grace period")
+	}
+	if got := shutdownSummary(false, 1, 2); got != "🛑 Monitoring stopped before the running check finished, 1 message delivered, 2 messages deferred to outbox" {
+		t.Errorf("unexpected summary %q", got)
+	}
+}
+
+func TestShutdownWaitsForCheckToDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(10 * time.Millisecond)
+	}()
+
+	if !waitForCheck(done, cancel, time.Second, time.Second) {
+		t.Fatal("expected the check to finish before the deadline")
+	}
+	if ctx.Err() != nil {
+		t.Error("a check finishing in time must not be cancelled")
+	}
+	if got := shutdownSummary(true, 2, 0); got != "🛑 Monitoring stopped cleanly, 2 messages delivered, 0 messages deferred to outbox" {
+		t.Errorf("unexpected summary %q", got)
+	}
+}
@@ -0,0 +1,58 @@
+// Package config loads the file-based configuration (refuge registry and translation overrides)
+// and reloads it at runtime without a restart.
+package config
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+// mu serializes reloads so two of them can't interleave their swaps and guards the file paths
+var mu sync.Mutex
+
+// refugesFile and overridesFile are the files Reload reads (REFUGES_FILE, I18N_OVERRIDES_FILE)
+var refugesFile, overridesFile string
+
+// SetFiles sets the files Reload reads; empty paths mean the built-in refuges and no overrides
+func SetFiles(c CheckerConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+	refugesFile, overridesFile = c.RefugesFile, c.I18nOverridesFile
+}
+
+// Reload reads the refuge registry and translation overrides files, validates both and only
+// then swaps them in. On error nothing is applied and the current configuration stays live. Notification texts are i18n keys (notif_*), so they
+// are overridden through the translation file.
+func Reload() (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	refuges := parser.DefaultRefuges
+	if path := refugesFile; path != "" {
+		rs, err := parser.LoadRegistry(path)
+		if err != nil {
+			return "", err
+		}
+		refuges = rs
+	}
+	var overrides i18n.Overrides
+	if path := overridesFile; path != "" {
+		o, err := i18n.LoadOverrides(path)
+		if err != nil {
+			return "", err
+		}
+		overrides = o
+	}
+
+	parser.SetRefuges(refuges)
+	i18n.SetOverrides(overrides)
+
+	texts := 0
+	for _, m := range overrides {
+		texts += len(m)
+	}
+	return fmt.Sprintf("%d refuges, %d translation overrides", len(refuges), texts), nil
+}
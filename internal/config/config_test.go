@@ -0,0 +1,125 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+// writeConfig writes registry and overrides files and points Reload at them
+func writeConfig(t *testing.T, registry string, overrides string) {
+	t.Helper()
+	dir := t.TempDir()
+	rp, op := filepath.Join(dir, "refuges.json"), filepath.Join(dir, "i18n.json")
+	if err := os.WriteFile(rp, []byte(registry), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(op, []byte(overrides), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	SetFiles(CheckerConfig{RefugesFile: rp, I18nOverridesFile: op})
+}
+
+// resetConfig restores the built-in configuration after the test
+func resetConfig(t *testing.T) {
+	t.Cleanup(func() {
+		SetFiles(CheckerConfig{})
+		parser.SetRefuges(nil)
+		i18n.SetOverrides(nil)
+	})
+}
+
+const cosmiquesRegistry = `[
+  {"name": "Tête Rousse", "structure_id": "BK_STRUCTURE:29"},
+  {"name": "du Goûter", "structure_id": "BK_STRUCTURE:30"},
+  {"name": "Cosmiques", "structure_id": "BK_STRUCTURE:31"}
+]`
+
+func TestReloadAppliesValidConfig(t *testing.T) {
+	resetConfig(t)
+	writeConfig(t, cosmiquesRegistry, `{"en": {"notif_new": "New spots!"}}`)
+
+	summary, err := Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if summary != "3 refuges, 1 translation overrides" {
+		t.Errorf("unexpected summary %q", summary)
+	}
+	if rs := parser.Refuges(); len(rs) != 3 || rs[2].Name != "Cosmiques" {
+		t.Errorf("expected Cosmiques in the registry, got %+v", rs)
+	}
+	if got := i18n.T("en", "notif_new"); got != "New spots!" {
+		t.Errorf("expected overridden text, got %q", got)
+	}
+	// languages without an override fall back to their built-in text
+	if got := i18n.T("de", "notif_new"); got == "New spots!" {
+		t.Errorf("German should keep its built-in text, got %q", got)
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	resetConfig(t)
+	writeConfig(t, cosmiquesRegistry, `{"en": {"notif_new": "New spots!"}}`)
+	if _, err := Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	cases := map[string][2]string{
+		"bad json":           {`[{"name": `, `{}`},
+		"empty registry":     {`[]`, `{}`},
+		"bad structure id":   {`[{"name": "X", "structure_id": "31"}]`, `{}`},
+		"duplicate refuge":   {`[{"name": "X", "structure_id": "BK_STRUCTURE:1"}, {"name": "X", "structure_id": "BK_STRUCTURE:2"}]`, `{}`},
+		"unknown language":   {cosmiquesRegistry, `{"xx": {"notif_new": "?"}}`},
+		"unknown key":        {cosmiquesRegistry, `{"en": {"no_such_key": "?"}}`},
+		"valid refuges only": {`[{"name": "Y", "structure_id": "BK_STRUCTURE:9"}]`, `{"en": {"notif_new": ""}}`},
+	}
+	for name, c := range cases {
+		writeConfig(t, c[0], c[1])
+		if _, err := Reload(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if rs := parser.Refuges(); len(rs) != 3 {
+			t.Errorf("%s: old registry should stay live, got %+v", name, rs)
+		}
+		if got := i18n.T("en", "notif_new"); got != "New spots!" {
+			t.Errorf("%s: old overrides should stay live, got %q", name, got)
+		}
+	}
+}
+
+func TestReloadIsRaceFree(t *testing.T) {
+	resetConfig(t)
+	writeConfig(t, cosmiquesRegistry, `{"en": {"notif_new": "New spots!"}}`)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, r := range parser.Refuges() {
+					_ = r.Name
+				}
+				_ = i18n.T("en", "notif_new")
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := Reload(); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,470 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is every environment knob of the service, read once at startup by Load and handed to
+// the packages that use it
+type Config struct {
+	Parser   ParserConfig
+	Store    StoreConfig
+	Telegram TelegramConfig
+	Web      WebConfig
+	Checker  CheckerConfig
+	Notify   NotifyConfig
+	Log      LogConfig
+}
+
+// ParserConfig is the FFCAM session, retry, circuit breaker and rate limit tuning
+type ParserConfig struct {
+	SessionID        string // initial PHPSESSID; empty obtains one automatically
+	Email            string
+	Password         string
+	RetryAttempts    int
+	RetryBaseDelay   time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	RateLimit        float64 // requests per second
+	MaxBodySize      int     // bytes read from an availability response before giving up
+	Pax              int     // group size availability is requested for when a query sets none
+}
+
+// StoreConfig is the Postgres connection and the query limits of the plans
+type StoreConfig struct {
+	DatabaseURL    string
+	TablePrefix    string
+	FreeQueryLimit int // active queries per chat on the free plan, 0 = unlimited
+	ProQueryLimit  int // active queries per chat on the pro plan, 0 = unlimited
+}
+
+// TelegramConfig is the bot identity and how it receives updates
+type TelegramConfig struct {
+	BotToken      string
+	BotUsername   string
+	APIURL        string
+	Mode          string // "webhook" or "polling"
+	WebhookSecret string
+}
+
+// WebConfig is the web server, its public address and the secrets signing its links
+type WebConfig struct {
+	Port              string
+	BaseURL           string
+	GAMeasurementID   string
+	AdminToken        string
+	DeepLinkSecret    string
+	UnsubscribeSecret string
+	KeepAliveURL      string
+	KeepAliveInterval time.Duration
+	StateSource       string // "checker" (in process) or "store", where the site reads availability from
+}
+
+// CheckerConfig is the check loop and its file-based configuration (see Reload)
+type CheckerConfig struct {
+	Interval          time.Duration // between two checks
+	WindowMonths      int           // months checked, starting with the current one
+	FetchConcurrency  int
+	SnapshotRetention time.Duration // date snapshots older than this are pruned, 0 keeps them
+	RefugesFile       string
+	I18nOverridesFile string
+}
+
+// NotifyConfig is who receives admin notifications, and the SMTP server emailing subscribers
+type NotifyConfig struct {
+	AdminChatIDs  []string
+	PublicChannel string // chat ID or @channel the season reports are published to
+	SMTPHost      string // host[:port]; empty disables email alerts
+	SMTPUser      string // also the sender address
+	SMTPPass      string
+	DigestHour    int // hour of the day, in each subscriber's time zone, daily digests are sent at
+}
+
+// LogConfig is how log records are written
+type LogConfig struct {
+	Format string // text or json
+	Level  slog.Level
+}
+
+// maxWindowMonths bounds WINDOW_MONTHS: FFCAM rarely opens bookings further ahead
+const maxWindowMonths = 12
+
+// maxPax bounds FFCAM_PAX, like the minimum places of a subscription
+const maxPax = 20
+
+// envPrefix marks variables meant for this service; unknown ones are reported as likely typos
+const envPrefix = "MONTBLANC_"
+
+var (
+	chatIDPattern      = regexp.MustCompile(`^(-?\d+|@\w+)$`)
+	tablePrefixPattern = regexp.MustCompile(`^[a-z0-9_]*$`)
+)
+
+// setting describes one environment variable: its default, how it is parsed into Config and
+// how it is shown in the startup report
+type setting struct {
+	name    string
+	section string
+	def     string
+	secret  bool
+	set     func(c *Config, v string) error
+	get     func(c *Config) string
+}
+
+// settings lists every knob in report order
+var settings = []setting{
+	{name: "PHPSESSID", section: "parser", secret: true,
+		set: func(c *Config, v string) error { c.Parser.SessionID = v; return nil },
+		get: func(c *Config) string { return c.Parser.SessionID }},
+	{name: "FFCAM_EMAIL", section: "parser",
+		set: func(c *Config, v string) error { c.Parser.Email = v; return nil },
+		get: func(c *Config) string { return c.Parser.Email }},
+	{name: "FFCAM_PASSWORD", section: "parser", secret: true,
+		set: func(c *Config, v string) error { c.Parser.Password = v; return nil },
+		get: func(c *Config) string { return c.Parser.Password }},
+	{name: "FFCAM_RETRY_ATTEMPTS", section: "parser", def: "3",
+		set: func(c *Config, v string) error { return positiveInt(v, &c.Parser.RetryAttempts) },
+		get: func(c *Config) string { return strconv.Itoa(c.Parser.RetryAttempts) }},
+	{name: "FFCAM_RETRY_BASE_DELAY", section: "parser", def: "2s",
+		set: func(c *Config, v string) error { return duration(v, false, &c.Parser.RetryBaseDelay) },
+		get: func(c *Config) string { return c.Parser.RetryBaseDelay.String() }},
+	{name: "FFCAM_BREAKER_THRESHOLD", section: "parser", def: "5",
+		set: func(c *Config, v string) error { return positiveInt(v, &c.Parser.BreakerThreshold) },
+		get: func(c *Config) string { return strconv.Itoa(c.Parser.BreakerThreshold) }},
+	{name: "FFCAM_BREAKER_COOLDOWN", section: "parser", def: "10m",
+		set: func(c *Config, v string) error { return duration(v, true, &c.Parser.BreakerCooldown) },
+		get: func(c *Config) string { return c.Parser.BreakerCooldown.String() }},
+	{name: "FFCAM_RATE_LIMIT", section: "parser", def: "1",
+		set: func(c *Config, v string) error {
+			r, err := strconv.ParseFloat(v, 64)
+			if err != nil || r <= 0 {
+				return errors.New("must be a positive number of requests per second")
+			}
+			c.Parser.RateLimit = r
+			return nil
+		},
+		get: func(c *Config) string { return strconv.FormatFloat(c.Parser.RateLimit, 'g', -1, 64) }},
+	{name: "FFCAM_MAX_BODY_SIZE", section: "parser", def: "5242880",
+		set: func(c *Config, v string) error { return positiveInt(v, &c.Parser.MaxBodySize) },
+		get: func(c *Config) string { return strconv.Itoa(c.Parser.MaxBodySize) }},
+	{name: "FFCAM_PAX", section: "parser", def: "1",
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxPax {
+				return fmt.Errorf("must be a group size between 1 and %d", maxPax)
+			}
+			c.Parser.Pax = n
+			return nil
+		},
+		get: func(c *Config) string { return strconv.Itoa(c.Parser.Pax) }},
+
+	{name: "DATABASE_URL", section: "store", def: "montblanc.db",
+		set: func(c *Config, v string) error {
+			if _, err := url.Parse(v); err != nil {
+				return errors.New("must be a postgres://, sqlite:// or memory:// URL, or a file path")
+			}
+			c.Store.DatabaseURL = v
+			return nil
+		},
+		get: func(c *Config) string { return redactURL(c.Store.DatabaseURL) }},
+	{name: "DB_TABLE_PREFIX", section: "store",
+		set: func(c *Config, v string) error {
+			if !tablePrefixPattern.MatchString(v) {
+				return errors.New("may only contain lowercase letters, digits and underscores")
+			}
+			c.Store.TablePrefix = v
+			return nil
+		},
+		get: func(c *Config) string { return c.Store.TablePrefix }},
+	{name: "FREE_QUERY_LIMIT", section: "store", def: "2",
+		set: func(c *Config, v string) error { return queryLimit(v, &c.Store.FreeQueryLimit) },
+		get: func(c *Config) string { return strconv.Itoa(c.Store.FreeQueryLimit) }},
+	{name: "PRO_QUERY_LIMIT", section: "store", def: "0",
+		set: func(c *Config, v string) error { return queryLimit(v, &c.Store.ProQueryLimit) },
+		get: func(c *Config) string { return strconv.Itoa(c.Store.ProQueryLimit) }},
+
+	{name: "TELEGRAM_BOT_TOKEN", section: "telegram", secret: true,
+		set: func(c *Config, v string) error { c.Telegram.BotToken = v; return nil },
+		get: func(c *Config) string { return c.Telegram.BotToken }},
+	{name: "TELEGRAM_BOT_USERNAME", section: "telegram",
+		set: func(c *Config, v string) error { c.Telegram.BotUsername = strings.TrimPrefix(v, "@"); return nil },
+		get: func(c *Config) string { return c.Telegram.BotUsername }},
+	{name: "TELEGRAM_API_URL", section: "telegram", def: "https://api.telegram.org",
+		set: func(c *Config, v string) error { return absoluteURL(v, &c.Telegram.APIURL) },
+		get: func(c *Config) string { return c.Telegram.APIURL }},
+	{name: "TELEGRAM_MODE", section: "telegram", def: "webhook",
+		set: func(c *Config, v string) error {
+			if v != "webhook" && v != "polling" {
+				return errors.New(`must be "webhook" or "polling"`)
+			}
+			c.Telegram.Mode = v
+			return nil
+		},
+		get: func(c *Config) string { return c.Telegram.Mode }},
+	{name: "TELEGRAM_WEBHOOK_SECRET", section: "telegram", secret: true,
+		set: func(c *Config, v string) error { c.Telegram.WebhookSecret = v; return nil },
+		get: func(c *Config) string { return c.Telegram.WebhookSecret }},
+
+	{name: "PORT", section: "web", def: "8080",
+		set: func(c *Config, v string) error {
+			if n, err := strconv.Atoi(v); err != nil || n <= 0 || n > 65535 {
+				return errors.New("must be a TCP port number")
+			}
+			c.Web.Port = v
+			return nil
+		},
+		get: func(c *Config) string { return c.Web.Port }},
+	{name: "BASE_URL", section: "web", def: "https://montblanc.onrender.com",
+		set: func(c *Config, v string) error { return absoluteURL(v, &c.Web.BaseURL) },
+		get: func(c *Config) string { return c.Web.BaseURL }},
+	{name: "GA_MEASUREMENT_ID", section: "web",
+		set: func(c *Config, v string) error {
+			if v == "" {
+				return errors.New("is required")
+			}
+			c.Web.GAMeasurementID = v
+			return nil
+		},
+		get: func(c *Config) string { return c.Web.GAMeasurementID }},
+	{name: "ADMIN_TOKEN", section: "web", secret: true,
+		set: func(c *Config, v string) error { c.Web.AdminToken = v; return nil },
+		get: func(c *Config) string { return c.Web.AdminToken }},
+	{name: "DEEP_LINK_SECRET", section: "web", def: "dev", secret: true,
+		set: func(c *Config, v string) error { c.Web.DeepLinkSecret = v; return nil },
+		get: func(c *Config) string { return c.Web.DeepLinkSecret }},
+	{name: "UNSUBSCRIBE_SECRET", section: "web", secret: true,
+		set: func(c *Config, v string) error { c.Web.UnsubscribeSecret = v; return nil },
+		get: func(c *Config) string { return c.Web.UnsubscribeSecret }},
+	{name: "KEEPALIVE_URL", section: "web",
+		set: func(c *Config, v string) error {
+			if v == "" {
+				return nil
+			}
+			return absoluteURL(v, &c.Web.KeepAliveURL)
+		},
+		get: func(c *Config) string { return c.Web.KeepAliveURL }},
+	{name: "KEEPALIVE_INTERVAL", section: "web", def: "14m",
+		set: func(c *Config, v string) error { return duration(v, true, &c.Web.KeepAliveInterval) },
+		get: func(c *Config) string { return c.Web.KeepAliveInterval.String() }},
+	{name: "WEB_STATE_SOURCE", section: "web", def: "checker",
+		set: func(c *Config, v string) error {
+			if v != "checker" && v != "store" {
+				return errors.New(`must be "checker" or "store"`)
+			}
+			c.Web.StateSource = v
+			return nil
+		},
+		get: func(c *Config) string { return c.Web.StateSource }},
+
+	{name: "CHECK_INTERVAL", section: "checker", def: "1m0s",
+		set: func(c *Config, v string) error { return duration(v, true, &c.Checker.Interval) },
+		get: func(c *Config) string { return c.Checker.Interval.String() }},
+	{name: "WINDOW_MONTHS", section: "checker", def: "3",
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxWindowMonths {
+				return fmt.Errorf("must be a number of months between 1 and %d", maxWindowMonths)
+			}
+			c.Checker.WindowMonths = n
+			return nil
+		},
+		get: func(c *Config) string { return strconv.Itoa(c.Checker.WindowMonths) }},
+	{name: "FFCAM_FETCH_CONCURRENCY", section: "checker", def: "3",
+		set: func(c *Config, v string) error { return positiveInt(v, &c.Checker.FetchConcurrency) },
+		get: func(c *Config) string { return strconv.Itoa(c.Checker.FetchConcurrency) }},
+	{name: "SNAPSHOT_RETENTION_DAYS", section: "checker", def: "365",
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return errors.New("must be a number of days, 0 to keep every snapshot")
+			}
+			c.Checker.SnapshotRetention = time.Duration(n) * 24 * time.Hour
+			return nil
+		},
+		get: func(c *Config) string { return strconv.Itoa(int(c.Checker.SnapshotRetention / (24 * time.Hour))) }},
+	{name: "REFUGES_FILE", section: "checker",
+		set: func(c *Config, v string) error { c.Checker.RefugesFile = v; return nil },
+		get: func(c *Config) string { return c.Checker.RefugesFile }},
+	{name: "I18N_OVERRIDES_FILE", section: "checker",
+		set: func(c *Config, v string) error { c.Checker.I18nOverridesFile = v; return nil },
+		get: func(c *Config) string { return c.Checker.I18nOverridesFile }},
+
+	{name: "TELEGRAM_CHAT_IDS", section: "notifications",
+		set: func(c *Config, v string) error {
+			c.Notify.AdminChatIDs = nil
+			for _, id := range strings.Split(v, ",") {
+				if id = strings.TrimSpace(id); id == "" {
+					continue
+				}
+				if !chatIDPattern.MatchString(id) {
+					return fmt.Errorf("%q is not a chat ID or @channel", id)
+				}
+				c.Notify.AdminChatIDs = append(c.Notify.AdminChatIDs, id)
+			}
+			return nil
+		},
+		get: func(c *Config) string { return strings.Join(c.Notify.AdminChatIDs, ",") }},
+	{name: "PUBLIC_CHANNEL_ID", section: "notifications",
+		set: func(c *Config, v string) error {
+			if v != "" && !chatIDPattern.MatchString(v) {
+				return fmt.Errorf("%q is not a chat ID or @channel", v)
+			}
+			c.Notify.PublicChannel = v
+			return nil
+		},
+		get: func(c *Config) string { return c.Notify.PublicChannel }},
+	{name: "SMTP_HOST", section: "notifications",
+		set: func(c *Config, v string) error { c.Notify.SMTPHost = v; return nil },
+		get: func(c *Config) string { return c.Notify.SMTPHost }},
+	{name: "SMTP_USER", section: "notifications",
+		set: func(c *Config, v string) error { c.Notify.SMTPUser = v; return nil },
+		get: func(c *Config) string { return c.Notify.SMTPUser }},
+	{name: "SMTP_PASS", section: "notifications", secret: true,
+		set: func(c *Config, v string) error { c.Notify.SMTPPass = v; return nil },
+		get: func(c *Config) string { return c.Notify.SMTPPass }},
+	{name: "DIGEST_HOUR", section: "notifications", def: "8",
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > 23 {
+				return errors.New("must be an hour between 0 and 23")
+			}
+			c.Notify.DigestHour = n
+			return nil
+		},
+		get: func(c *Config) string { return strconv.Itoa(c.Notify.DigestHour) }},
+
+	{name: "LOG_FORMAT", section: "logging", def: "text",
+		set: func(c *Config, v string) error {
+			if v != "text" && v != "json" {
+				return errors.New(`must be "text" or "json"`)
+			}
+			c.Log.Format = v
+			return nil
+		},
+		get: func(c *Config) string { return c.Log.Format }},
+	{name: "LOG_LEVEL", section: "logging", def: "info",
+		set: func(c *Config, v string) error {
+			if err := c.Log.Level.UnmarshalText([]byte(v)); err != nil {
+				return errors.New("must be debug, info, warn or error")
+			}
+			return nil
+		},
+		get: func(c *Config) string { return strings.ToLower(c.Log.Level.String()) }},
+}
+
+// Load builds the configuration from environ (os.Environ format). Unset or empty variables take
+// their defaults; every invalid value is reported in the returned error. warnings lists
+// MONTBLANC_-prefixed variables that match no setting.
+func Load(environ []string) (Config, []string, error) {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	var c Config
+	var errs []error
+	known := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		known[s.name] = true
+		v := strings.TrimSpace(env[s.name])
+		if v == "" {
+			v = s.def
+		}
+		if err := s.set(&c, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+
+	var warnings []string
+	for k := range env {
+		if !strings.HasPrefix(k, envPrefix) {
+			continue
+		}
+		msg := fmt.Sprintf("unknown setting %s is ignored", k)
+		if name := strings.TrimPrefix(k, envPrefix); known[name] {
+			msg += fmt.Sprintf(" (did you mean %s?)", name)
+		}
+		warnings = append(warnings, msg)
+	}
+	sort.Strings(warnings)
+	return c, warnings, errors.Join(errs...)
+}
+
+// Report is the effective configuration, one "section NAME=value" line per setting. Secrets
+// only show whether they are set and database URLs hide their password.
+func (c Config) Report() string {
+	var b strings.Builder
+	for _, s := range settings {
+		v := s.get(&c)
+		switch {
+		case s.secret && v != "":
+			v = "<redacted>"
+		case v == "":
+			v = "<unset>"
+		}
+		if s.def != "" && v == s.def {
+			v += " (default)"
+		}
+		fmt.Fprintf(&b, "%-13s %s=%s\n", s.section, s.name, v)
+	}
+	return b.String()
+}
+
+// positiveInt parses v into n
+func positiveInt(v string, n *int) error {
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 {
+		return errors.New("must be a positive integer")
+	}
+	*n = i
+	return nil
+}
+
+// queryLimit parses a plan's query limit v into n; 0 is unlimited
+func queryLimit(v string, n *int) error {
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return errors.New("must be a number of queries, 0 for unlimited")
+	}
+	*n = i
+	return nil
+}
+
+// duration parses v into d; zero is only allowed when positive is false
+func duration(v string, positive bool, d *time.Duration) error {
+	p, err := time.ParseDuration(v)
+	if err != nil || p < 0 || (positive && p == 0) {
+		return errors.New("must be a positive duration like 30s or 10m")
+	}
+	*d = p
+	return nil
+}
+
+// absoluteURL checks v is an http(s) URL and stores it without a trailing slash
+func absoluteURL(v string, dst *string) error {
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http(s) URL")
+	}
+	*dst = strings.TrimRight(v, "/")
+	return nil
+}
+
+// redactURL hides the password of a connection URL
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || u.User == nil {
+		return v
+	}
+	return u.Redacted()
+}
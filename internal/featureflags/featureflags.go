@@ -0,0 +1,145 @@
+package featureflags
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Known flags
+const (
+	// FairnessStagger shuffles the fan-out order so the same subscribers aren't always notified first
+	FairnessStagger = "fairness_stagger"
+	// AggressiveRetries re-fetches refuges that failed in a check cycle once more right away
+	AggressiveRetries = "aggressive_retries"
+)
+
+// Prefix is the settings key prefix for all flags.
+// Keys look like "flag:<name>" (global: on, off or a percentage like 10%)
+// and "flag:<name>:chat:<chatID>" (per-chat override: on or off).
+const Prefix = "flag:"
+
+// Settings is the subset of the store used to read and write flags
+type Settings interface {
+	SetSetting(ctx context.Context, key string, value string) error
+	ListSettings(ctx context.Context, prefix string) (map[string]string, error)
+}
+
+// Set is a snapshot of all flag settings (settings key -> raw value)
+type Set map[string]string
+
+// Load reads all flags from the settings store
+func Load(ctx context.Context, st Settings) (Set, error) {
+	m, err := st.ListSettings(ctx, Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return Set(m), nil
+}
+
+// Key returns the settings key of a flag's global value
+func Key(name string) string { return Prefix + name }
+
+// ChatKey returns the settings key of a flag's per-chat override
+func ChatKey(name string, chatID string) string { return Prefix + name + ":chat:" + chatID }
+
+// Bucket deterministically maps (flag, chatID) to a bucket in [0, 100).
+// The flag name is part of the hash so different rollouts pick different chats.
+func Bucket(name string, chatID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(chatID))
+	return int(h.Sum32() % 100)
+}
+
+// ParseValue parses a flag value: "on"/"off" (also true/false, 1/0) or a percentage "0%".."100%".
+// The result is the rollout percentage: 100 for on, 0 for off.
+func ParseValue(v string) (int, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch v {
+	case "on", "true", "1":
+		return 100, nil
+	case "off", "false", "0":
+		return 0, nil
+	}
+	if strings.HasSuffix(v, "%") {
+		p, err := strconv.Atoi(strings.TrimSuffix(v, "%"))
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("invalid percentage %q", v)
+		}
+		return p, nil
+	}
+	return 0, fmt.Errorf("invalid flag value %q (use on, off or N%%)", v)
+}
+
+// Enabled reports whether flag name is on for chatID.
+// Precedence: per-chat override, then the global value (percentage rollout by bucket), then def.
+// Unparseable values are ignored. An empty chatID (global call sites) is only on at 100%.
+func (s Set) Enabled(name string, chatID string, def bool) bool {
+	if chatID != "" {
+		if v, ok := s[ChatKey(name, chatID)]; ok {
+			if p, err := ParseValue(v); err == nil && (p == 0 || p == 100) {
+				return p == 100
+			}
+		}
+	}
+	v, ok := s[Key(name)]
+	if !ok {
+		return def
+	}
+	p, err := ParseValue(v)
+	if err != nil {
+		return def
+	}
+	switch {
+	case p >= 100:
+		return true
+	case p <= 0:
+		return false
+	case chatID == "":
+		return false
+	}
+	return Bucket(name, chatID) < p
+}
+
+// SetValue validates and stores a flag value; chatID selects a per-chat override
+func SetValue(ctx context.Context, st Settings, name string, chatID string, value string) error {
+	if name == "" || strings.Contains(name, ":") {
+		return fmt.Errorf("invalid flag name %q", name)
+	}
+	p, err := ParseValue(value)
+	if err != nil {
+		return err
+	}
+	key := Key(name)
+	if chatID != "" {
+		if p != 0 && p != 100 {
+			return fmt.Errorf("per-chat overrides must be on or off")
+		}
+		key = ChatKey(name, chatID)
+	}
+	return st.SetSetting(ctx, key, strings.ToLower(strings.TrimSpace(value)))
+}
+
+// Describe renders the settings of one flag (or all flags when name is empty), sorted by key
+func (s Set) Describe(name string) string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		if name == "" || k == Key(name) || strings.HasPrefix(k, Key(name)+":") {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return "No flags set"
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(strings.TrimPrefix(k, Prefix) + " = " + s[k] + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package featureflags
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type memSettings map[string]string
+
+func (m memSettings) SetSetting(_ context.Context, key string, value string) error {
+	m[key] = value
+	return nil
+}
+
+func (m memSettings) ListSettings(_ context.Context, prefix string) (map[string]string, error) {
+	res := map[string]string{}
+	for k, v := range m {
+		if strings.HasPrefix(k, prefix) {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+func TestBucketDeterministic(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		chatID := fmt.Sprintf("%d", 1000+i)
+		a := Bucket("snapshot_diff", chatID)
+		b := Bucket("snapshot_diff", chatID)
+		if a != b {
+			t.Fatalf("bucket for %s not stable: %d vs %d", chatID, a, b)
+		}
+		if a < 0 || a >= 100 {
+			t.Fatalf("bucket out of range: %d", a)
+		}
+	}
+}
+
+func TestBucketDistribution(t *testing.T) {
+	const n = 10000
+	in := 0
+	for i := 0; i < n; i++ {
+		if Bucket("snapshot_diff", fmt.Sprintf("%d", 100000+i)) < 10 {
+			in++
+		}
+	}
+	// 10% rollout should land close to 1000 chats
+	if in < 850 || in > 1150 {
+		t.Errorf("expected ~10%% of chats in rollout, got %d/%d", in, n)
+	}
+}
+
+func TestBucketDependsOnFlagName(t *testing.T) {
+	same := 0
+	for i := 0; i < 1000; i++ {
+		chatID := fmt.Sprintf("%d", i)
+		if Bucket("a", chatID) == Bucket("b", chatID) {
+			same++
+		}
+	}
+	if same > 50 {
+		t.Errorf("buckets of different flags are too correlated: %d/1000 equal", same)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "on", want: 100},
+		{in: "ON", want: 100},
+		{in: "true", want: 100},
+		{in: "off", want: 0},
+		{in: "false", want: 0},
+		{in: "10%", want: 10},
+		{in: " 0% ", want: 0},
+		{in: "100%", want: 100},
+		{in: "101%", wantErr: true},
+		{in: "-1%", wantErr: true},
+		{in: "ten%", wantErr: true},
+		{in: "maybe", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseValue(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseValue(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseValue(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEnabledPrecedence(t *testing.T) {
+	// find one chat inside and one outside a 50% rollout
+	var inChat, outChat string
+	for i := 0; inChat == "" || outChat == ""; i++ {
+		id := fmt.Sprintf("%d", i)
+		if Bucket("f", id) < 50 {
+			inChat = id
+		} else {
+			outChat = id
+		}
+	}
+
+	tests := []struct {
+		name   string
+		set    Set
+		chatID string
+		def    bool
+		want   bool
+	}{
+		{name: "unset uses default false", set: Set{}, chatID: inChat, def: false, want: false},
+		{name: "unset uses default true", set: Set{}, chatID: inChat, def: true, want: true},
+		{name: "global on", set: Set{"flag:f": "on"}, chatID: outChat, want: true},
+		{name: "global off beats default", set: Set{"flag:f": "off"}, chatID: inChat, def: true, want: false},
+		{name: "percentage inside bucket", set: Set{"flag:f": "50%"}, chatID: inChat, want: true},
+		{name: "percentage outside bucket", set: Set{"flag:f": "50%"}, chatID: outChat, want: false},
+		{name: "chat override on beats global off", set: Set{"flag:f": "off", "flag:f:chat:" + inChat: "on"}, chatID: inChat, want: true},
+		{name: "chat override off beats global on", set: Set{"flag:f": "on", "flag:f:chat:" + inChat: "off"}, chatID: inChat, def: true, want: false},
+		{name: "chat override on beats percentage miss", set: Set{"flag:f": "50%", "flag:f:chat:" + outChat: "on"}, chatID: outChat, want: true},
+		{name: "override of other chat ignored", set: Set{"flag:f": "off", "flag:f:chat:" + inChat: "on"}, chatID: outChat, want: false},
+		{name: "invalid global falls back to default", set: Set{"flag:f": "garbage"}, chatID: inChat, def: true, want: true},
+		{name: "invalid override falls through to global", set: Set{"flag:f": "on", "flag:f:chat:" + inChat: "50%"}, chatID: inChat, want: true},
+		{name: "global call site with percentage stays off", set: Set{"flag:f": "99%"}, chatID: "", want: false},
+		{name: "global call site with 100%", set: Set{"flag:f": "100%"}, chatID: "", want: true},
+		{name: "other flag does not leak", set: Set{"flag:g": "on"}, chatID: inChat, want: false},
+		{name: "nil set uses default", set: nil, chatID: inChat, def: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.set.Enabled("f", tt.chatID, tt.def); got != tt.want {
+				t.Errorf("Enabled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetValueAndLoad(t *testing.T) {
+	st := memSettings{}
+	if err := SetValue(t.Context(), st, "snapshot_diff", "", "10%"); err != nil {
+		t.Fatalf("SetValue: %v", err)
+	}
+	if err := SetValue(t.Context(), st, "snapshot_diff", "12345", "on"); err != nil {
+		t.Fatalf("SetValue chat: %v", err)
+	}
+	if err := SetValue(t.Context(), st, "snapshot_diff", "12345", "10%"); err == nil {
+		t.Error("expected error for percentage chat override")
+	}
+	if err := SetValue(t.Context(), st, "snapshot_diff", "", "sometimes"); err == nil {
+		t.Error("expected error for invalid value")
+	}
+	if err := SetValue(t.Context(), st, "bad:name", "", "on"); err == nil {
+		t.Error("expected error for invalid name")
+	}
+	st["other"] = "x"
+
+	flags, err := Load(t.Context(), st)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(flags) != 2 {
+		t.Errorf("expected 2 flag settings, got %v", flags)
+	}
+	if flags["flag:snapshot_diff"] != "10%" || flags["flag:snapshot_diff:chat:12345"] != "on" {
+		t.Errorf("unexpected flags: %v", flags)
+	}
+	if !flags.Enabled("snapshot_diff", "12345", false) {
+		t.Error("expected chat override to enable flag")
+	}
+	desc := flags.Describe("snapshot_diff")
+	if !strings.Contains(desc, "snapshot_diff = 10%") || !strings.Contains(desc, "snapshot_diff:chat:12345 = on") {
+		t.Errorf("unexpected description: %q", desc)
+	}
+}
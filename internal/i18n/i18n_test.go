@@ -0,0 +1,82 @@
+package i18n
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAllLanguagesHaveEnglishKeys(t *testing.T) {
+	for lang, m := range supported {
+		for key := range supported["en"] {
+			if _, ok := m[key]; !ok {
+				t.Errorf("%s is missing key %q", lang, key)
+			}
+		}
+	}
+}
+
+func TestTFallsBackToEnglish(t *testing.T) {
+	if got := T("xx", "notif_places"); got != "places" {
+		t.Errorf("expected English fallback for unknown language, got %q", got)
+	}
+	if got := T("de", "notif_places"); got != "Plätze" {
+		t.Errorf("expected German translation, got %q", got)
+	}
+	if got := T("de", "no_such_key"); got != "no_such_key" {
+		t.Errorf("expected key for missing translation, got %q", got)
+	}
+}
+
+func TestLoadLocalesRejectsDifferentKeys(t *testing.T) {
+	_, err := loadLocales(fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"title": "Title", "places": "places"}`)},
+		"locales/de.json": {Data: []byte(`{"title": "Titel", "plätze": "Plätze"}`)},
+	})
+	if err == nil || !strings.Contains(err.Error(), `de is missing "places"`) || !strings.Contains(err.Error(), `de has "plätze"`) {
+		t.Errorf("expected the missing and extra keys reported, got %v", err)
+	}
+	m, err := loadLocales(fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"title": "Title"}`)},
+		"locales/de.json": {Data: []byte(`{"title": "Titel"}`)},
+	})
+	if err != nil || m["de"]["title"] != "Titel" {
+		t.Errorf("expected matching locales loaded, got %v, %v", m, err)
+	}
+}
+
+func TestDetectLangWeighsAcceptLanguage(t *testing.T) {
+	for header, want := range map[string]string{
+		"de;q=0.2, en;q=0.9":        "en",
+		"fr-CH, fr;q=0.9, de;q=0.8": "fr",
+		"xx, de;q=0.5, it;q=0.7":    "it",
+		"pl;q=0.5, cs;q=0.5":        "pl", // equal weights: header order
+		"de;q=0, es":                "es",
+		"ja, *;q=0.5":               "en",
+		"fr;q=0.3, *;q=0.5":         "en",
+		"*;q=0.1, de":               "de",
+		"ja, zh":                    "en",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", header)
+		if got := DetectLang(r); got != want {
+			t.Errorf("%q: expected %s, got %s", header, want, got)
+		}
+	}
+
+	// the query parameter and the cookie still come first
+	r := httptest.NewRequest(http.MethodGet, "/?lang=it", nil)
+	r.Header.Set("Accept-Language", "de")
+	r.AddCookie(&http.Cookie{Name: "lang", Value: "fr"})
+	if got := DetectLang(r); got != "it" {
+		t.Errorf("expected the query parameter to win, got %s", got)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "de")
+	r.AddCookie(&http.Cookie{Name: "lang", Value: "fr"})
+	if got := DetectLang(r); got != "fr" {
+		t.Errorf("expected the cookie to win over the header, got %s", got)
+	}
+}
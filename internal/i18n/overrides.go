@@ -0,0 +1,67 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Overrides replaces built-in translations: language -> key -> text
+type Overrides map[string]map[string]string
+
+// overrides holds the live overrides; it is swapped as a whole on reload
+var overrides atomic.Pointer[Overrides]
+
+// SetOverrides replaces the live overrides; nil removes them
+func SetOverrides(o Overrides) {
+	if o == nil {
+		overrides.Store(nil)
+		return
+	}
+	overrides.Store(&o)
+}
+
+// override returns the overridden text for lang/key, if any
+func override(lang, key string) (string, bool) {
+	o := overrides.Load()
+	if o == nil {
+		return "", false
+	}
+	v, ok := (*o)[lang][key]
+	return v, ok
+}
+
+// LoadOverrides reads and validates a JSON overrides file, e.g. {"en": {"notif_new": "..."}}
+func LoadOverrides(path string) (Overrides, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read translation overrides: %w", err)
+	}
+	var o Overrides
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("invalid translation overrides %s: %w", path, err)
+	}
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid translation overrides %s: %w", path, err)
+	}
+	return o, nil
+}
+
+// Validate checks that only supported languages and known keys are overridden, with non-empty texts
+func (o Overrides) Validate() error {
+	for lang, m := range o {
+		if _, ok := supported[lang]; !ok {
+			return fmt.Errorf("unsupported language %q", lang)
+		}
+		for key, v := range m {
+			if _, ok := supported["en"][key]; !ok {
+				return fmt.Errorf("unknown key %q for %s", key, lang)
+			}
+			if v == "" {
+				return fmt.Errorf("empty text for %s.%s", lang, key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Package metrics holds the Prometheus metrics of the monitor, served on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// ChecksTotal counts check cycles by result: ok, partial (some refuges failed), failed or
+	// skipped (circuit breaker open or backing off)
+	ChecksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "montblanc_checks_total",
+		Help: "Availability check cycles by result.",
+	}, []string{"result"})
+
+	// ParseErrors counts failed refuge months by refuge and error class (parser.ErrorClass)
+	ParseErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "montblanc_parse_errors_total",
+		Help: "Refuge months that could not be fetched or parsed, by refuge and error class.",
+	}, []string{"refuge", "class"})
+
+	// DatesFound is the number of calendar dates parsed per refuge in the last check; 0 when the
+	// refuge failed, so a scraper that silently stops finding dates shows up as a flat zero
+	DatesFound = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "montblanc_dates_found",
+		Help: "Calendar dates parsed per refuge in the last check.",
+	}, []string{"refuge"})
+
+	// NotificationsSent counts messages delivered to subscribers by outbox kind
+	NotificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "montblanc_notifications_sent_total",
+		Help: "Messages delivered to subscribers, by kind.",
+	}, []string{"kind"})
+
+	// RetentionPurged counts the rows deleted by the nightly retention purge, by table
+	RetentionPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "montblanc_retention_purged_total",
+		Help: "Rows of personal data deleted once past their retention period, by table.",
+	}, []string{"table"})
+
+	// FetchDuration is how long one refuge month took to fetch from FFCAM, retries included
+	FetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "montblanc_fetch_duration_seconds",
+		Help:    "Time to fetch one refuge month from FFCAM, retries included.",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 8), // 0.25s to 32s
+	}, []string{"refuge"})
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler { return promhttp.Handler() }
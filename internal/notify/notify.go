@@ -0,0 +1,34 @@
+// Package notify is the channel-neutral way of sending a message to someone, so channels other
+// than Telegram can be plugged in without touching the check loop or the bot handlers
+package notify
+
+import (
+	"context"
+
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// Notifier sends message to recipient, addressed the way its channel expects (a Telegram chat
+// ID, an email address, ...)
+type Notifier interface {
+	Notify(ctx context.Context, recipient string, message string) error
+}
+
+// Func adapts a plain function to a Notifier, e.g. a recorder in tests
+type Func func(ctx context.Context, recipient string, message string) error
+
+// Notify calls f
+func (f Func) Notify(ctx context.Context, recipient string, message string) error {
+	return f(ctx, recipient, message)
+}
+
+// TelegramNotifier sends through the configured bot; recipients are chat IDs
+type TelegramNotifier struct{}
+
+// Notify sends message to the chat recipient, unless ctx is already done
+func (TelegramNotifier) Notify(ctx context.Context, recipient string, message string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return telegram.SendMessageTo(recipient, message)
+}
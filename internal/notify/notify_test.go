@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestFuncNotifies(t *testing.T) {
+	var got []string
+	var n Notifier = Func(func(_ context.Context, recipient string, message string) error {
+		got = append(got, recipient+": "+message)
+		return nil
+	})
+	if err := n.Notify(context.Background(), "42", "hello"); err != nil || len(got) != 1 || got[0] != "42: hello" {
+		t.Errorf("Notify = %v, recorded %q", err, got)
+	}
+}
+
+func TestTelegramNotifierStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (TelegramNotifier{}).Notify(ctx, "42", "hello"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSMTPNotifierSendsTextEmail(t *testing.T) {
+	var addr, from string
+	var to []string
+	var msg []byte
+	n := SMTPNotifier{Addr: "smtp.example.org", Username: "alerts@example.org", Password: "secret",
+		SendMail: func(a string, _ smtp.Auth, f string, rcpt []string, m []byte) error {
+			addr, from, to, msg = a, f, rcpt, m
+			return nil
+		}}
+	if err := n.Notify(context.Background(), "me@example.org", "🎉 New availability\n\nTête Rousse\n  • 2025-07-10: 3 places\n"); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if addr != "smtp.example.org:587" || from != "alerts@example.org" || len(to) != 1 || to[0] != "me@example.org" {
+		t.Errorf("unexpected envelope %s %s %v", addr, from, to)
+	}
+	for _, want := range []string{"To: me@example.org\r\n", "Subject: =?utf-8?q?", "Content-Type: text/plain; charset=utf-8\r\n", "\r\n\r\nTête Rousse\r\n  • 2025-07-10: 3 places\r\n"} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("expected %q in %q", want, msg)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier emails messages as plain text; recipients are email addresses. The first line of
+// a message is its subject, the rest its body.
+type SMTPNotifier struct {
+	Addr     string // host:port of the server (SMTP_HOST), port 587 when left out
+	Username string // also the sender address
+	Password string
+
+	// SendMail sends the raw message; nil uses smtp.SendMail
+	SendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// Notify emails message to recipient, unless ctx is already done
+func (n SMTPNotifier) Notify(ctx context.Context, recipient string, message string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	addr := n.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "587")
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+	send := n.SendMail
+	if send == nil {
+		send = smtp.SendMail
+	}
+	if err := send(addr, auth, n.Username, []string{recipient}, emailMessage(n.Username, recipient, message, time.Now())); err != nil {
+		return fmt.Errorf("smtp send to %s: %w", recipient, err)
+	}
+	return nil
+}
+
+// emailMessage builds the RFC 5322 text email of message
+func emailMessage(from string, to string, message string, now time.Time) []byte {
+	subject, body, _ := strings.Cut(message, "\n")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.TrimLeft(body, "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is the availability state of one day at a refuge
+type Status int
+
+const (
+	StatusUnknown Status = iota
+	StatusAvailable
+	StatusFull
+	StatusClosed
+)
+
+// Raw values stored in Refuge.Dates besides a number of places
+const (
+	rawFull   = "Full"
+	rawClosed = "Closed"
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusAvailable:
+		return "Available"
+	case StatusFull:
+		return "Full"
+	case StatusClosed:
+		return "Closed"
+	}
+	return "Unknown"
+}
+
+// DayAvailability is the typed form of one Refuge.Dates entry
+type DayAvailability struct {
+	Date   time.Time
+	Places int // free places, 0 unless Status is StatusAvailable
+	Status Status
+}
+
+// ParseDay converts a Refuge.Dates entry (YYYY-MM-DD -> free places or "Full") to the typed model
+func ParseDay(date string, raw string) (DayAvailability, error) {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return DayAvailability{}, fmt.Errorf("invalid date %q: %w", date, err)
+	}
+	day := DayAvailability{Date: d}
+	raw = strings.TrimSpace(raw)
+	switch raw {
+	case rawFull:
+		day.Status = StatusFull
+	case rawClosed:
+		day.Status = StatusClosed
+	default:
+		n, err := strconv.Atoi(raw)
+		switch {
+		case err != nil:
+			day.Status = StatusUnknown
+		case n > 0:
+			day.Status, day.Places = StatusAvailable, n
+		default:
+			day.Status = StatusFull
+		}
+	}
+	return day, nil
+}
+
+// Key returns the date as YYYY-MM-DD, the key used in Refuge.Dates
+func (d DayAvailability) Key() string { return d.Date.Format("2006-01-02") }
+
+// Available reports whether the day has free places
+func (d DayAvailability) Available() bool { return d.Status == StatusAvailable }
+
+// Raw returns the Refuge.Dates representation of the day
+func (d DayAvailability) Raw() string {
+	switch d.Status {
+	case StatusAvailable:
+		return strconv.Itoa(d.Places)
+	case StatusFull:
+		return rawFull
+	case StatusClosed:
+		return rawClosed
+	}
+	return ""
+}
+
+// Day returns the typed availability of date (YYYY-MM-DD), if the refuge has it
+func (r Refuge) Day(date string) (DayAvailability, bool) {
+	raw, ok := r.Dates[date]
+	if !ok {
+		return DayAvailability{}, false
+	}
+	day, err := ParseDay(date, raw)
+	return day, err == nil
+}
+
+// Days returns the typed availability of every date, sorted by date. Unparsable dates are skipped.
+func (r Refuge) Days() []DayAvailability {
+	days := make([]DayAvailability, 0, len(r.Dates))
+	for date, raw := range r.Dates {
+		if day, err := ParseDay(date, raw); err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date.Before(days[j].Date) })
+	return days
+}
+
+// DateStatus is one Refuge.Dates entry, in the ordered form returned by SortedDates
+type DateStatus struct {
+	Date   string `json:"date"`   // YYYY-MM-DD
+	Status string `json:"status"` // Available, Full, Closed or Unknown
+	Places int    `json:"places"` // free places, 0 unless Available
+}
+
+// SortedDates returns every date with its status, sorted by date, for output that must not
+// depend on map iteration order. Unparsable entries are kept with the Unknown status.
+func (r Refuge) SortedDates() []DateStatus {
+	dates := make([]string, 0, len(r.Dates))
+	for date := range r.Dates {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	out := make([]DateStatus, 0, len(dates))
+	for _, date := range dates {
+		day, err := ParseDay(date, r.Dates[date])
+		if err != nil {
+			out = append(out, DateStatus{Date: date, Status: StatusUnknown.String()})
+			continue
+		}
+		out = append(out, DateStatus{Date: date, Status: day.Status.String(), Places: day.Places})
+	}
+	return out
+}
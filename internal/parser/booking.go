@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ReservationURL is the generic FFCAM reservation page, used when no direct booking link can be built
+const ReservationURL = "https://montblanc.ffcam.fr/GB_reservation-tout-public.html"
+
+// bookingURL is the FFCAM booking form that accepts a structure and date
+const bookingURL = "https://centrale.ffcam.fr/index.php"
+
+// BookingLink returns a booking URL with the refuge (structureID), date (YYYY-MM-DD) and DefaultPax pre-filled,
+// or ReservationURL when either is missing or invalid
+func BookingLink(structureID string, date string) string {
+	if !structureIDPattern.MatchString(structureID) {
+		return ReservationURL
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return ReservationURL
+	}
+	q := url.Values{}
+	q.Set("_lang", "GB")
+	q.Set("mode", "FORM_PREBOOK")
+	q.Set("structure", structureID)
+	q.Set("date", date)
+	q.Set("pax", strconv.Itoa(DefaultPax))
+	return bookingURL + "?" + q.Encode()
+}
+
+// BookingLinkFor returns the booking link of a refuge in the live registry
+func BookingLinkFor(refuge string, date string) string {
+	id, _ := structureIDFor(refuge)
+	return BookingLink(id, date)
+}
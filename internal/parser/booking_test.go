@@ -0,0 +1,22 @@
+package parser
+
+import "testing"
+
+func TestBookingLink(t *testing.T) {
+	tests := map[string]struct {
+		refuge, date, want string
+	}{
+		"Tête Rousse": {"Tête Rousse", "2025-08-03", "https://centrale.ffcam.fr/index.php?_lang=GB&date=2025-08-03&mode=FORM_PREBOOK&pax=1&structure=BK_STRUCTURE%3A29"},
+		"du Goûter":   {"du Goûter", "2025-08-22", "https://centrale.ffcam.fr/index.php?_lang=GB&date=2025-08-22&mode=FORM_PREBOOK&pax=1&structure=BK_STRUCTURE%3A30"},
+		"unknown":     {"Cosmiques", "2025-08-03", ReservationURL},
+		"bad date":    {"du Goûter", "08/22", ReservationURL},
+	}
+	for name, tt := range tests {
+		if got := BookingLinkFor(tt.refuge, tt.date); got != tt.want {
+			t.Errorf("%s: BookingLinkFor = %q, want %q", name, got, tt.want)
+		}
+	}
+	if got := BookingLink("", "2025-08-03"); got != ReservationURL {
+		t.Errorf("expected the reservation page without a structure, got %q", got)
+	}
+}
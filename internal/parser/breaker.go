@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting FFCAM while the circuit breaker is open
+var ErrCircuitOpen = errors.New("FFCAM circuit breaker open, request skipped")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // requests go out normally
+	BreakerOpen                         // requests are skipped until the cooldown has passed
+	BreakerHalfOpen                     // a single probe request is in flight
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker stops requests to FFCAM after Threshold consecutive failures; after Cooldown
+// one probe is let through, which closes the breaker on success or reopens it on failure
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	now      func() time.Time
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// NewBreaker returns a closed breaker; now is the clock (time.Now outside tests)
+func NewBreaker(threshold int, cooldown time.Duration, now func() time.Time) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, now: now}
+}
+
+// FFCAMBreaker guards availability requests
+var FFCAMBreaker = NewBreaker(5, 10*time.Minute, time.Now)
+
+// Allow reports whether a request may be made; once the cooldown has passed, the first
+// caller gets the half-open probe and everyone else waits for its outcome
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		slog.Info("FFCAM breaker half-open, probing")
+		return true
+	case BreakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// Paused reports whether the breaker is open and still cooling down
+func (b *Breaker) Paused() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == BreakerOpen && b.now().Sub(b.openedAt) < b.Cooldown
+}
+
+// Success records a request that reached FFCAM
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerClosed {
+		slog.Info("FFCAM breaker closed")
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+}
+
+// Failure records a request that failed because FFCAM was unreachable or erroring
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.Threshold) {
+		if b.state == BreakerClosed {
+			slog.Warn("FFCAM breaker open", "failures", b.failures)
+		}
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// State returns the current state
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// record feeds the outcome of a request into the breaker: only exhausted retries of
+// transient failures count, any other answer shows the site is up
+func (b *Breaker) record(err error) {
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		b.Failure()
+		return
+	}
+	b.Success()
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for breaker tests
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)}
+	b := NewBreaker(3, 10*time.Minute, clock.now)
+
+	b.Failure()
+	b.Failure()
+	b.Success() // a success resets the consecutive count
+	b.Failure()
+	b.Failure()
+	if b.State() != BreakerClosed || !b.Allow() {
+		t.Fatalf("expected closed before %d consecutive failures, got %v", b.Threshold, b.State())
+	}
+	b.Failure()
+	if b.State() != BreakerOpen || b.Allow() || !b.Paused() {
+		t.Fatalf("expected open after %d consecutive failures, got %v", b.Threshold, b.State())
+	}
+	clock.t = clock.t.Add(9 * time.Minute)
+	if b.Allow() {
+		t.Error("expected requests to be skipped during the cooldown")
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)}
+	b := NewBreaker(1, 10*time.Minute, clock.now)
+	b.Failure()
+
+	// after the cooldown a single probe goes out
+	clock.t = clock.t.Add(10 * time.Minute)
+	if b.Paused() || !b.Allow() {
+		t.Fatal("expected a probe after the cooldown")
+	}
+	if b.State() != BreakerHalfOpen || b.Allow() {
+		t.Fatalf("expected a single probe while half-open, got %v", b.State())
+	}
+
+	// a failed probe reopens for another full cooldown
+	b.Failure()
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected open after a failed probe, got %v", b.State())
+	}
+	clock.t = clock.t.Add(5 * time.Minute)
+	if b.Allow() {
+		t.Error("expected the cooldown to restart after a failed probe")
+	}
+
+	// a successful probe closes
+	clock.t = clock.t.Add(5 * time.Minute)
+	if !b.Allow() {
+		t.Fatal("expected a second probe")
+	}
+	b.Success()
+	if b.State() != BreakerClosed || !b.Allow() {
+		t.Fatalf("expected closed after a successful probe, got %v", b.State())
+	}
+}
+
+func TestBreakerRecord(t *testing.T) {
+	b := NewBreaker(1, time.Minute, time.Now)
+	b.record(&StatusError{Refuge: "X", Code: 404})
+	if b.State() != BreakerClosed {
+		t.Error("a 4xx answer shows the site is up")
+	}
+	b.record(&RetryError{Attempts: 3, Err: errors.New("502")})
+	if b.State() != BreakerOpen {
+		t.Error("exhausted retries should count as a failure")
+	}
+}
+
+func TestParseRefugeAvailabilitySkippedWhileOpen(t *testing.T) {
+	calls := 0
+	withFakeFFCAM(t, func(w http.ResponseWriter, r *http.Request) { calls++ })
+	prev := FFCAMBreaker
+	FFCAMBreaker = NewBreaker(1, time.Hour, time.Now)
+	t.Cleanup(func() { FFCAMBreaker = prev })
+	FFCAMBreaker.Failure()
+
+	res, err := ParseRefugeAvailability("", time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 1)
+	if err == nil || calls != 0 {
+		t.Fatalf("expected no requests while open, got %d calls, err %v", calls, err)
+	}
+	for name, ferr := range res.Errors {
+		if !errors.Is(ferr, ErrCircuitOpen) {
+			t.Errorf("expected ErrCircuitOpen for %s, got %v", name, ferr)
+		}
+	}
+}
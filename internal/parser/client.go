@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+)
+
+// dialFunc opens connections for the FFCAM client (overridable in tests)
+type dialFunc func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+// newFFCAMClient returns a client that keeps connections to FFCAM alive between requests and
+// remembers the cookies it sets (e.g. the waiting room's) in a jar
+func newFFCAMClient(dial dialFunc) *http.Client {
+	jar, _ := cookiejar.New(nil) // never fails without options
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Jar:     jar,
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dial,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          10,
+			MaxIdleConnsPerHost:   4,
+			MaxConnsPerHost:       4,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+// ffcamClient is shared by all availability requests
+var ffcamClient = newFFCAMClient((&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext)
+
+// seedSession stores the session ID in the client's jar for rawURL, replacing any PHPSESSID
+// FFCAM set itself so the managed session always wins
+func seedSession(client *http.Client, rawURL string, id string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	client.Jar.SetCookies(u, []*http.Cookie{{Name: "PHPSESSID", Value: id, Path: "/"}})
+	return nil
+}
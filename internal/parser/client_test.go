@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAvailabilityRequestsShareCookiesAndConnections(t *testing.T) {
+	var requests []string
+	page := normalMonth(t)
+	withFakeFFCAM(t, func(w http.ResponseWriter, r *http.Request) {
+		if len(requests) == 0 {
+			http.SetCookie(w, &http.Cookie{Name: "queue_it", Value: "token-1", Path: "/"})
+		}
+		sid, _ := r.Cookie("PHPSESSID")
+		queue, _ := r.Cookie("queue_it")
+		got := "PHPSESSID=<none>"
+		if sid != nil {
+			got = sid.String()
+		}
+		if queue != nil {
+			got += " " + queue.String()
+		}
+		requests = append(requests, got)
+		w.Write(page)
+	})
+	var dials atomic.Int32
+	prev := ffcamClient
+	var d net.Dialer
+	ffcamClient = newFFCAMClient(func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		dials.Add(1)
+		return d.DialContext(ctx, network, addr)
+	})
+	t.Cleanup(func() { ffcamClient.CloseIdleConnections(); ffcamClient = prev })
+
+	date := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if _, err := makeAvailabilityRequest("Tête Rousse", "1", date, 1); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	// the second request carries the cookie set by the first response, alongside the session
+	want := []string{"PHPSESSID=test", "PHPSESSID=test queue_it=token-1", "PHPSESSID=test queue_it=token-1"}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("request %d sent %q, want %q", i+1, requests[i], want[i])
+		}
+	}
+	if n := dials.Load(); n != 1 {
+		t.Errorf("expected one connection reused for every request, got %d dials", n)
+	}
+}
+
+func TestSeedSessionReplacesServerSession(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "server-picked", Path: "/"})
+	}))
+	defer srv.Close()
+	client := newFFCAMClient((&net.Dialer{}).DialContext)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if err := seedSession(client, srv.URL, "managed"); err != nil {
+		t.Fatal(err)
+	}
+	if id := sessionCookie(client.Jar, srv.URL); id != "managed" {
+		t.Errorf("expected the managed session in the jar, got %q", id)
+	}
+}
+
+func TestAvailabilityRequestSendsPax(t *testing.T) {
+	var got []string
+	page := normalMonth(t)
+	withFakeFFCAM(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = append(got, r.PostForm.Get("pax"))
+		w.Write(page)
+	})
+	if _, err := ParseRefugeAvailability("", time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 3); err != nil {
+		t.Fatalf("ParseRefugeAvailability: %v", err)
+	}
+	if len(got) == 0 {
+		t.Fatal("expected availability requests")
+	}
+	for _, pax := range got {
+		if pax != "3" {
+			t.Errorf("requested pax %q, want 3", pax)
+		}
+	}
+}
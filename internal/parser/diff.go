@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DateChange is one date of one refuge that differs between two checks; Old and New are the
+// Refuge.Dates values, "" when the date wasn't there
+type DateChange struct {
+	Refuge string
+	Date   string // YYYY-MM-DD
+	Old    string
+	New    string
+}
+
+func (c DateChange) String() string {
+	old, cur := c.Old, c.New
+	if old == "" {
+		old = "—"
+	}
+	if cur == "" {
+		cur = "—"
+	}
+	return fmt.Sprintf("%s %s: %s → %s", c.Refuge, c.Date, old, cur)
+}
+
+// available reports whether raw is a day with free places
+func available(date string, raw string) bool {
+	day, err := ParseDay(date, raw)
+	return err == nil && day.Available()
+}
+
+// RefugeDiff is what changed between two checks, each list sorted by refuge then date
+type RefugeDiff struct {
+	Added   []DateChange // dates that weren't listed before
+	Removed []DateChange // dates no longer listed
+	Changed []DateChange // dates whose places or status changed
+}
+
+// Empty reports whether nothing changed
+func (d RefugeDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Vanished returns the dates that had free places before and have none now, whether they
+// became full or closed or dropped out of the calendar
+func (d RefugeDiff) Vanished() []DateChange {
+	var res []DateChange
+	for _, c := range d.Removed {
+		if available(c.Date, c.Old) {
+			res = append(res, c)
+		}
+	}
+	for _, c := range d.Changed {
+		if available(c.Date, c.Old) && !available(c.Date, c.New) {
+			res = append(res, c)
+		}
+	}
+	sortChanges(res)
+	return res
+}
+
+// Appeared returns the dates that have free places now and had none before, whether they were
+// full or closed or not listed at all
+func (d RefugeDiff) Appeared() []DateChange {
+	var res []DateChange
+	for _, c := range d.Added {
+		if available(c.Date, c.New) {
+			res = append(res, c)
+		}
+	}
+	for _, c := range d.Changed {
+		if !available(c.Date, c.Old) && available(c.Date, c.New) {
+			res = append(res, c)
+		}
+	}
+	sortChanges(res)
+	return res
+}
+
+// DiffRefuges compares two checks. A refuge missing from one side counts as every one of its
+// dates added or removed.
+func DiffRefuges(old []Refuge, cur []Refuge) RefugeDiff {
+	before := make(map[string]map[string]string, len(old))
+	for _, rf := range old {
+		before[rf.Name] = rf.Dates
+	}
+	var d RefugeDiff
+	seen := make(map[string]bool, len(cur))
+	for _, rf := range cur {
+		seen[rf.Name] = true
+		prev := before[rf.Name]
+		for date, raw := range rf.Dates {
+			was, ok := prev[date]
+			switch {
+			case !ok:
+				d.Added = append(d.Added, DateChange{Refuge: rf.Name, Date: date, New: raw})
+			case was != raw:
+				d.Changed = append(d.Changed, DateChange{Refuge: rf.Name, Date: date, Old: was, New: raw})
+			}
+		}
+		for date, was := range prev {
+			if _, ok := rf.Dates[date]; !ok {
+				d.Removed = append(d.Removed, DateChange{Refuge: rf.Name, Date: date, Old: was})
+			}
+		}
+	}
+	for _, rf := range old {
+		if seen[rf.Name] {
+			continue
+		}
+		for date, was := range rf.Dates {
+			d.Removed = append(d.Removed, DateChange{Refuge: rf.Name, Date: date, Old: was})
+		}
+	}
+	sortChanges(d.Added)
+	sortChanges(d.Removed)
+	sortChanges(d.Changed)
+	return d
+}
+
+func sortChanges(cs []DateChange) {
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].Refuge != cs[j].Refuge {
+			return cs[i].Refuge < cs[j].Refuge
+		}
+		return cs[i].Date < cs[j].Date
+	})
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRefuges(t *testing.T) {
+	old := []Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-08-01": "2", "2025-08-02": "Full", "2025-08-03": "4", "2025-08-04": "1"}},
+		{Name: "du Goûter", Dates: map[string]string{"2025-08-10": "3"}},
+	}
+	cur := []Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-08-01": "2", "2025-08-02": "1", "2025-08-03": "Full", "2025-08-05": "6"}},
+		{Name: "Cosmiques", Dates: map[string]string{"2025-08-20": "Closed"}},
+	}
+	d := DiffRefuges(old, cur)
+
+	wantAdded := []DateChange{
+		{Refuge: "Cosmiques", Date: "2025-08-20", New: "Closed"},
+		{Refuge: "Tête Rousse", Date: "2025-08-05", New: "6"},
+	}
+	wantRemoved := []DateChange{
+		{Refuge: "Tête Rousse", Date: "2025-08-04", Old: "1"},
+		{Refuge: "du Goûter", Date: "2025-08-10", Old: "3"}, // refuge gone entirely
+	}
+	wantChanged := []DateChange{
+		{Refuge: "Tête Rousse", Date: "2025-08-02", Old: "Full", New: "1"},
+		{Refuge: "Tête Rousse", Date: "2025-08-03", Old: "4", New: "Full"},
+	}
+	if !reflect.DeepEqual(d.Added, wantAdded) {
+		t.Errorf("Added = %v, want %v", d.Added, wantAdded)
+	}
+	if !reflect.DeepEqual(d.Removed, wantRemoved) {
+		t.Errorf("Removed = %v, want %v", d.Removed, wantRemoved)
+	}
+	if !reflect.DeepEqual(d.Changed, wantChanged) {
+		t.Errorf("Changed = %v, want %v", d.Changed, wantChanged)
+	}
+
+	// booked out or dropped from the calendar; a full date opening up is not a vanished spot
+	wantVanished := []DateChange{
+		{Refuge: "Tête Rousse", Date: "2025-08-03", Old: "4", New: "Full"},
+		{Refuge: "Tête Rousse", Date: "2025-08-04", Old: "1"},
+		{Refuge: "du Goûter", Date: "2025-08-10", Old: "3"},
+	}
+	if got := d.Vanished(); !reflect.DeepEqual(got, wantVanished) {
+		t.Errorf("Vanished = %v, want %v", got, wantVanished)
+	}
+
+	// opened up or newly listed with places; a closed date isn't
+	wantAppeared := []DateChange{
+		{Refuge: "Tête Rousse", Date: "2025-08-02", Old: "Full", New: "1"},
+		{Refuge: "Tête Rousse", Date: "2025-08-05", New: "6"},
+	}
+	if got := d.Appeared(); !reflect.DeepEqual(got, wantAppeared) {
+		t.Errorf("Appeared = %v, want %v", got, wantAppeared)
+	}
+}
+
+func TestDiffRefugesPlacesChange(t *testing.T) {
+	d := DiffRefuges(
+		[]Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-08-01": "5"}}},
+		[]Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-08-01": "2"}}},
+	)
+	if len(d.Changed) != 1 || d.Changed[0].String() != "Tête Rousse 2025-08-01: 5 → 2" || len(d.Vanished()) != 0 {
+		t.Errorf("expected one change with places left, got %+v", d)
+	}
+}
+
+func TestDiffRefugesUnchanged(t *testing.T) {
+	rs := []Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-08-01": "5", "2025-08-02": "Full"}}}
+	if d := DiffRefuges(rs, rs); !d.Empty() {
+		t.Errorf("expected no changes, got %+v", d)
+	}
+	if d := DiffRefuges(nil, nil); !d.Empty() {
+		t.Errorf("expected no changes between empty checks, got %+v", d)
+	}
+	if d := DiffRefuges(nil, rs); len(d.Added) != 2 || d.Added[0].String() != "Tête Rousse 2025-08-01: — → 5" {
+		t.Errorf("expected a new refuge's dates added, got %+v", d)
+	}
+}
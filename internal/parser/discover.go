@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DiscoverStructures fetches the public reservation page and returns the structures it offers,
+// display name -> structure ID (e.g. "Refuge de Tête Rousse" -> "BK_STRUCTURE:29")
+func DiscoverStructures(baseURL string) (map[string]string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reservation page: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Refuge: "reservation page", Code: resp.StatusCode}
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reservation page: %v", err)
+	}
+	structures := scrapeStructures(doc)
+	if len(structures) == 0 {
+		return nil, fmt.Errorf("no structures found on reservation page")
+	}
+	return structures, nil
+}
+
+// scrapeStructures collects the structure <select> options and booking links with a structure parameter
+func scrapeStructures(doc *goquery.Document) map[string]string {
+	structures := make(map[string]string)
+	add := func(name, id string) {
+		name = strings.Join(strings.Fields(name), " ")
+		if name != "" && structureIDPattern.MatchString(id) {
+			structures[name] = id
+		}
+	}
+	doc.Find("select option").Each(func(i int, s *goquery.Selection) {
+		id, _ := s.Attr("value")
+		add(s.Text(), strings.TrimSpace(id))
+	})
+	doc.Find("a[href*='BK_STRUCTURE']").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		u, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+		add(s.Text(), u.Query().Get("structure"))
+	})
+	return structures
+}
+
+// ResolveStructures updates the structure IDs of rs from a discovered name -> ID map. A refuge matches
+// the shortest display name containing its name (case-insensitive); unmatched refuges keep their ID.
+func ResolveStructures(rs []RefugeConfig, discovered map[string]string) []RefugeConfig {
+	out := make([]RefugeConfig, len(rs))
+	for i, r := range rs {
+		out[i] = r
+		best := ""
+		for name := range discovered {
+			if !strings.Contains(strings.ToLower(name), strings.ToLower(r.Name)) {
+				continue
+			}
+			if best == "" || len(name) < len(best) || (len(name) == len(best) && name < best) {
+				best = name
+			}
+		}
+		if best != "" {
+			out[i].StructureID = discovered[best]
+		}
+	}
+	return out
+}
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverStructures(t *testing.T) {
+	page, err := os.ReadFile("testdata/reservation_page.html")
+	if err != nil {
+		t.Fatalf("failed to read testdata/reservation_page.html: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+	}))
+	defer srv.Close()
+
+	got, err := DiscoverStructures(srv.URL)
+	if err != nil {
+		t.Fatalf("DiscoverStructures: %v", err)
+	}
+	want := map[string]string{
+		"Refuge de Tête Rousse": "BK_STRUCTURE:29",
+		"Refuge du Goûter":      "BK_STRUCTURE:30",
+		"Refuge des Cosmiques":  "BK_STRUCTURE:31",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected structures %v, want %v", got, want)
+	}
+}
+
+func TestDiscoverStructuresFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("<html><body><p>No huts here</p></body></html>"))
+	}))
+	defer srv.Close()
+
+	if _, err := DiscoverStructures(srv.URL + "/down"); err == nil {
+		t.Error("expected error for a 503 response")
+	}
+	if _, err := DiscoverStructures(srv.URL); err == nil {
+		t.Error("expected error for a page without structures")
+	}
+}
+
+func TestResolveStructures(t *testing.T) {
+	discovered := map[string]string{
+		"Refuge de Tête Rousse":      "BK_STRUCTURE:41",
+		"Refuge du Goûter":           "BK_STRUCTURE:42",
+		"Refuge du Goûter (bivouac)": "BK_STRUCTURE:43",
+	}
+	got := ResolveStructures(DefaultRefuges, discovered)
+	want := []RefugeConfig{
+		{Name: "Tête Rousse", StructureID: "BK_STRUCTURE:41"},
+		{Name: "du Goûter", StructureID: "BK_STRUCTURE:42"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected registry %v, want %v", got, want)
+	}
+	// unmatched refuges keep the built-in ID and the defaults are untouched
+	if got := ResolveStructures(DefaultRefuges, map[string]string{"Refuge des Cosmiques": "BK_STRUCTURE:31"}); !reflect.DeepEqual(got, DefaultRefuges) {
+		t.Errorf("expected defaults for unmatched refuges, got %v", got)
+	}
+	if DefaultRefuges[0].StructureID != "BK_STRUCTURE:29" {
+		t.Errorf("DefaultRefuges modified: %v", DefaultRefuges)
+	}
+}
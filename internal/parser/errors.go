@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failure classes; the errors in Result.Errors wrap one of them (or ErrCircuitOpen) with the
+// refuge name and month, so callers can branch with errors.Is
+
+// ErrReauthNeeded is returned when FFCAM serves the login page instead of availability,
+// meaning the PHPSESSID session has expired
+var ErrReauthNeeded = errors.New("FFCAM session expired (login page returned), PHPSESSID must be refreshed")
+
+// ErrMaintenance is returned when FFCAM serves its maintenance page instead of a calendar
+var ErrMaintenance = errors.New("FFCAM booking is down for maintenance")
+
+// ErrWaitingRoom matches a WaitingRoomError: FFCAM queued us in its waiting room
+var ErrWaitingRoom = errors.New("FFCAM waiting room")
+
+// ErrRateLimited matches a StatusError for HTTP 429: FFCAM wants fewer requests
+var ErrRateLimited = errors.New("FFCAM rate limit hit (HTTP 429)")
+
+// ErrEmptyCalendar is returned when a calendar parsed without error but held no dates at all
+var ErrEmptyCalendar = errors.New("no dates found in the FFCAM calendar")
+
+// ErrEmptyBody is returned when FFCAM answers 200 with a body too short to be any page,
+// so it isn't parsed and mistaken for a calendar without dates
+var ErrEmptyBody = errors.New("FFCAM returned an empty response")
+
+// ErrBodyTooLarge matches a BodyTooLargeError
+var ErrBodyTooLarge = errors.New("FFCAM response too large")
+
+// BodyTooLargeError is returned when a response is longer than MaxBodySize; reading stops at the limit
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("FFCAM response larger than %d bytes", e.Limit)
+}
+
+// Is makes a BodyTooLargeError match ErrBodyTooLarge
+func (e *BodyTooLargeError) Is(target error) bool { return target == ErrBodyTooLarge }
+
+// waitingRoomMarker identifies FFCAM's waiting room page
+const waitingRoomMarker = "Your Rank in the waiting room"
+
+// WaitingRoomError is returned when FFCAM serves its waiting room instead of a calendar
+type WaitingRoomError struct {
+	Rank int           // our position in the queue, 0 if the page didn't show it
+	ETA  time.Duration // estimated wait, 0 if the page didn't show it
+}
+
+func (e *WaitingRoomError) Error() string {
+	msg := "FFCAM waiting room"
+	if e.Rank > 0 {
+		msg += fmt.Sprintf(", rank %d", e.Rank)
+	}
+	if e.ETA > 0 {
+		msg += fmt.Sprintf(", estimated wait %v", e.ETA)
+	}
+	return msg
+}
+
+// Is makes a WaitingRoomError match ErrWaitingRoom
+func (e *WaitingRoomError) Is(target error) bool { return target == ErrWaitingRoom }
+
+var (
+	waitingRankRe = regexp.MustCompile(`Your Rank in the waiting room\s*:?\s*(\d+(?:[,.\s]\d{3})*)`)
+	waitingETARe  = regexp.MustCompile(`(?i)estimated\s+(?:waiting\s+time|wait)\s*:?\s*(?:about\s+)?(\d+)\s*(seconds?|secs?|s|minutes?|mins?|m|hours?|h)\b`)
+)
+
+// parseWaitingRoom reads our rank and, when shown, the estimated wait from a waiting room page
+func parseWaitingRoom(content string) *WaitingRoomError {
+	wr := &WaitingRoomError{}
+	if m := waitingRankRe.FindStringSubmatch(content); m != nil {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, m[1])
+		wr.Rank, _ = strconv.Atoi(digits)
+	}
+	if m := waitingETARe.FindStringSubmatch(content); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := time.Minute
+		switch strings.ToLower(m[2])[0] {
+		case 's':
+			unit = time.Second
+		case 'h':
+			unit = time.Hour
+		}
+		wr.ETA = time.Duration(n) * unit
+	}
+	return wr
+}
+
+// ErrorClass names the failure class of err for logs and /status: "session_expired",
+// "maintenance", "waiting_room", "rate_limited", "empty_calendar", "empty_body",
+// "body_too_large", "circuit_open", "retries_exhausted" or "other" ("" for nil)
+func ErrorClass(err error) string {
+	var retryErr *RetryError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrReauthNeeded):
+		return "session_expired"
+	case errors.Is(err, ErrMaintenance):
+		return "maintenance"
+	case errors.Is(err, ErrWaitingRoom):
+		return "waiting_room"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrEmptyCalendar):
+		return "empty_calendar"
+	case errors.Is(err, ErrEmptyBody):
+		return "empty_body"
+	case errors.Is(err, ErrBodyTooLarge):
+		return "body_too_large"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.As(err, &retryErr):
+		return "retries_exhausted"
+	}
+	return "other"
+}
+
+// joinErrors joins per-refuge errors in refuge order so errors.Is sees every one of them
+func joinErrors(errs map[string]error) error {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	joined := make([]error, 0, len(names))
+	for _, name := range names {
+		joined = append(joined, errs[name])
+	}
+	return errors.Join(joined...)
+}
@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorClassesThroughWrapping(t *testing.T) {
+	fixture := func(name string) []byte {
+		b, err := os.ReadFile("testdata/" + name + ".html")
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		return b
+	}
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    error
+		class   string
+	}{
+		{"login page", func(w http.ResponseWriter, r *http.Request) { w.Write(fixture("login_page")) }, ErrReauthNeeded, "session_expired"},
+		{"maintenance", func(w http.ResponseWriter, r *http.Request) { w.Write(fixture("maintenance")) }, ErrMaintenance, "maintenance"},
+		{"waiting room", func(w http.ResponseWriter, r *http.Request) { w.Write(fixture("waiting_room")) }, ErrWaitingRoom, "waiting_room"},
+		{"429", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTooManyRequests) }, ErrRateLimited, "rate_limited"},
+		{"empty month", func(w http.ResponseWriter, r *http.Request) { w.Write(fixture("empty_month")) }, ErrEmptyCalendar, "empty_calendar"},
+		{"empty body", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("<html></html>")) }, ErrEmptyBody, "empty_body"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			withFakeFFCAM(t, tc.handler)
+			prev := FFCAMBreaker
+			FFCAMBreaker = NewBreaker(100, time.Hour, time.Now)
+			t.Cleanup(func() { FFCAMBreaker = prev })
+
+			res, err := ParseRefugeAvailability("", time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 1)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("expected the overall error to wrap %v, got %v", tc.want, err)
+			}
+			if len(res.Errors) != len(Refuges()) {
+				t.Fatalf("expected every refuge to fail, got %v", res.Errors)
+			}
+			for name, ferr := range res.Errors {
+				if !errors.Is(ferr, tc.want) {
+					t.Errorf("expected %v for %s, got %v", tc.want, name, ferr)
+				}
+				if !strings.HasPrefix(ferr.Error(), name+" 2025-08: ") {
+					t.Errorf("expected refuge and month context, got %q", ferr.Error())
+				}
+				if got := ErrorClass(ferr); got != tc.class {
+					t.Errorf("expected class %q for %s, got %q", tc.class, name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestOversizedBody(t *testing.T) {
+	page := normalMonth(t)
+	withFakeFFCAM(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+		w.Write([]byte(strings.Repeat("<!-- padding -->", 1000)))
+	})
+	prev := MaxBodySize
+	MaxBodySize = int64(len(page))
+	t.Cleanup(func() { MaxBodySize = prev })
+
+	_, err := makeAvailabilityRequest("Tête Rousse", "BK_STRUCTURE:29", time.Now(), 1)
+	var tooLarge *BodyTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != int64(len(page)) {
+		t.Fatalf("expected a BodyTooLargeError, got %v", err)
+	}
+	if got := ErrorClass(err); got != "body_too_large" {
+		t.Errorf("expected body_too_large, got %q", got)
+	}
+
+	// a page of exactly the limit is still read
+	MaxBodySize = int64(len(page)) + 1000*int64(len("<!-- padding -->"))
+	if content, err := makeAvailabilityRequest("Tête Rousse", "BK_STRUCTURE:29", time.Now(), 1); err != nil || int64(len(content)) != MaxBodySize {
+		t.Errorf("expected the whole page at the limit, got %d bytes, %v", len(content), err)
+	}
+}
+
+func TestEmptyBodyIsNotAnEmptyCalendar(t *testing.T) {
+	withFakeFFCAM(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	_, err := makeAvailabilityRequest("Tête Rousse", "BK_STRUCTURE:29", time.Now(), 1)
+	if !errors.Is(err, ErrEmptyBody) || errors.Is(err, ErrEmptyCalendar) {
+		t.Errorf("expected ErrEmptyBody, got %v", err)
+	}
+}
+
+func TestErrorClassOther(t *testing.T) {
+	if got := ErrorClass(nil); got != "" {
+		t.Errorf("expected no class for nil, got %q", got)
+	}
+	if got := ErrorClass(&RetryError{Attempts: 3, Err: &StatusError{Code: 502}}); got != "retries_exhausted" {
+		t.Errorf("expected retries_exhausted, got %q", got)
+	}
+	if errors.Is(&StatusError{Code: 503}, ErrRateLimited) {
+		t.Error("only 429 should match ErrRateLimited")
+	}
+	if got := ErrorClass(errors.New("boom")); got != "other" {
+		t.Errorf("expected other, got %q", got)
+	}
+}
+
+func TestParseWaitingRoom(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		rank    int
+		eta     time.Duration
+	}{
+		{"rank", "<p>Your Rank in the waiting room: 57</p>", 57, 0},
+		{"thousands separator", "<p>Your Rank in the waiting room: 1,482</p>", 1482, 0},
+		{"rank and eta", "<p>Your Rank in the waiting room : 2315</p><p>Estimated waiting time: 12 minutes</p>", 2315, 12 * time.Minute},
+		{"eta in seconds", "Your Rank in the waiting room: 3. Estimated wait: about 40 s", 3, 40 * time.Second},
+		{"missing number", `<p>Your Rank in the waiting room: <span id="rank"></span></p>`, 0, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var wr *WaitingRoomError
+			if err := parseRefugeContent(tc.content, &Refuge{Name: "Tête Rousse", Dates: map[string]string{}}, time.Now()); !errors.As(err, &wr) {
+				t.Fatalf("expected a WaitingRoomError, got %v", err)
+			}
+			if wr.Rank != tc.rank || wr.ETA != tc.eta {
+				t.Errorf("expected rank %d and eta %v, got %d and %v", tc.rank, tc.eta, wr.Rank, wr.ETA)
+			}
+			if !errors.Is(wr, ErrWaitingRoom) {
+				t.Error("expected the error to match ErrWaitingRoom")
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// update rewrites the .golden.json files from the current parser output:
+// go test ./internal/parser -run TestGoldenFixtures -update
+var update = flag.Bool("update", false, "rewrite testdata/*.golden.json")
+
+// goldenResult is what a fixture is expected to parse into
+type goldenResult struct {
+	Dates map[string]string `json:"dates"`
+	Error string            `json:"error,omitempty"`
+}
+
+func TestGoldenFixtures(t *testing.T) {
+	fixtures := []string{
+		"normal_month",
+		"waiting_room",
+		"waiting_room_eta",
+		"waiting_room_no_rank",
+		"login_page",
+		"maintenance",
+		"closed_days",
+		"empty_month",
+	}
+	for _, name := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", name+".html"))
+			if err != nil {
+				t.Fatalf("failed to read fixture: %v", err)
+			}
+			refuge := &Refuge{Name: "Tête Rousse", Dates: make(map[string]string)}
+			got := goldenResult{Dates: refuge.Dates}
+			if err := parseRefugeContent(string(content), refuge, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+				got.Error = err.Error()
+			}
+			gotJSON, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatalf("failed to marshal result: %v", err)
+			}
+			gotJSON = append(gotJSON, '\n')
+
+			golden := filepath.Join("testdata", name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, gotJSON, 0o644); err != nil {
+					t.Fatalf("failed to write golden file: %v", err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+			}
+			if !bytes.Equal(want, gotJSON) {
+				t.Errorf("%s parsed differently from %s\ngot:\n%s\nwant:\n%s", name, golden, gotJSON, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket spacing out requests to FFCAM: it holds up to burst tokens
+// and refills one every 1/rate seconds
+type RateLimiter struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	interval time.Duration // time to refill one token, 0 = unlimited
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewRateLimiter returns a full bucket allowing rate requests per second (0 or less disables limiting);
+// now is the clock (time.Now outside tests)
+func NewRateLimiter(rate float64, burst int, now func() time.Time) *RateLimiter {
+	l := &RateLimiter{now: now, burst: float64(max(burst, 1))}
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+	l.tokens = l.burst
+	return l
+}
+
+// FFCAMLimiter spaces out availability requests (FFCAM_RATE_LIMIT, default 1 per second)
+var FFCAMLimiter = NewRateLimiter(1, 1, time.Now)
+
+// reserve takes a token and returns how long to wait before using it; a token not yet
+// refilled is borrowed, so concurrent callers queue up one interval apart
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.interval == 0 {
+		return 0
+	}
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens * float64(l.interval))
+}
+
+// cancel returns a reserved token that won't be used
+func (l *RateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(l.burst, l.tokens+1)
+}
+
+// Wait blocks until a request may be made or ctx is done, in which case it returns ctx.Err()
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d := l.reserve()
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// requestCtx is the context availability requests run under
+var requestCtx = context.Background()
+
+// UseContext makes availability requests, and waits for the rate limiter, stop once ctx is cancelled
+func UseContext(ctx context.Context) { requestCtx = ctx }
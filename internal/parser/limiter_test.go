@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// other tests make many requests; the limiter tests install their own
+	FFCAMLimiter = NewRateLimiter(0, 1, time.Now)
+	os.Exit(m.Run())
+}
+
+func TestRateLimiterSpacing(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewRateLimiter(2, 1, clock.now)
+
+	if d := l.reserve(); d != 0 {
+		t.Errorf("expected first request immediately, got %v", d)
+	}
+	// a burst queues up at 500ms intervals
+	if d := l.reserve(); d != 500*time.Millisecond {
+		t.Errorf("expected 500ms wait, got %v", d)
+	}
+	if d := l.reserve(); d != time.Second {
+		t.Errorf("expected 1s wait, got %v", d)
+	}
+	// after the queue drained and a quiet second, the next request goes out at once
+	clock.t = clock.t.Add(2 * time.Second)
+	if d := l.reserve(); d != 0 {
+		t.Errorf("expected immediate request after idling, got %v", d)
+	}
+	// idle time never banks more than burst tokens
+	clock.t = clock.t.Add(time.Minute)
+	l.reserve()
+	if d := l.reserve(); d != 500*time.Millisecond {
+		t.Errorf("expected 500ms wait with burst 1, got %v", d)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := NewRateLimiter(0, 1, time.Now)
+	for i := 0; i < 100; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Fatalf("expected no wait without a rate, got %v", d)
+		}
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	l := NewRateLimiter(0.01, 1, time.Now) // one request per 100s
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if err := l.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("Wait blocked for %v after cancel", waited)
+	}
+}
+
+func TestAvailabilityRequestsAreSpaced(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	page := normalMonth(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		w.Write(page)
+	}))
+	defer srv.Close()
+
+	prevURL, prevLimiter := availabilityURL, FFCAMLimiter
+	availabilityURL = srv.URL
+	FFCAMLimiter = NewRateLimiter(20, 1, time.Now) // 50ms apart
+	defer func() { availabilityURL, FFCAMLimiter = prevURL, prevLimiter }()
+	useSessionID(t, "test")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := makeAvailabilityRequest("Tête Rousse", "BK_STRUCTURE:29", time.Now(), 1); err != nil {
+				t.Errorf("request failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(times) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(times))
+	}
+	if spread := times[3].Sub(times[0]); spread < 140*time.Millisecond {
+		t.Errorf("expected 4 requests spread over at least 150ms, took %v", spread)
+	}
+}
+
+func TestUseContextStopsWaiting(t *testing.T) {
+	prevLimiter, prevCtx := FFCAMLimiter, requestCtx
+	FFCAMLimiter = NewRateLimiter(0.01, 1, time.Now)
+	FFCAMLimiter.reserve() // bucket empty: the next request would wait 100s
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	UseContext(ctx)
+	defer func() { FFCAMLimiter, requestCtx = prevLimiter, prevCtx }()
+	useSessionID(t, "test")
+
+	if _, err := fetchWithRetry("Tête Rousse", "BK_STRUCTURE:29", time.Now(), 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled without retries, got %v", err)
+	}
+}
@@ -1,16 +1,17 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/AlexYaroshenko/montblanc/internal/metrics"
 	"github.com/PuerkitoBio/goquery"
 )
 
@@ -19,32 +20,51 @@ type Refuge struct {
 	Dates map[string]string // date -> status
 }
 
-// makeAvailabilityRequest makes an API call to check refuge availability
-func makeAvailabilityRequest(refugeName string, structureID string, targetDate time.Time) (string, error) {
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+// Result holds the refuges that were fetched and parsed successfully along with
+// the per-refuge failures, so one failing refuge doesn't discard the others
+type Result struct {
+	Refuges []Refuge
+	Errors  map[string]error // refuge name -> error
+}
+
+// availabilityURL is the FFCAM booking endpoint (overridable in tests)
+var availabilityURL = "https://centrale.ffcam.fr/index.php?_lang=GB"
+
+// SetAvailabilityURL points the parser at another booking endpoint, e.g. a fixture server
+func SetAvailabilityURL(u string) {
+	availabilityURL = u
+}
+
+// MaxBodySize caps how much of an availability response is read; FFCAM month views are a few KB
+var MaxBodySize int64 = 5 << 20
+
+// DefaultPax is the group size availability is requested for when a query sets none (FFCAM_PAX).
+// FFCAM answers for a given group size, so a date may be available for 1 and not for 3.
+var DefaultPax = 1
 
-	// Get session ID from environment
-	sessionID := os.Getenv("PHPSESSID")
-	if sessionID == "" {
-		return "", fmt.Errorf("PHPSESSID environment variable is not set")
+// minBodySize is the shortest response treated as a page; even the maintenance page is longer
+const minBodySize = 200
+
+// makeAvailabilityRequest makes an API call to check refuge availability for a group of pax
+func makeAvailabilityRequest(refugeName string, structureID string, targetDate time.Time, pax int) (string, error) {
+	// Get session ID
+	sessionID, err := sessionID()
+	if err != nil {
+		return "", err
 	}
 
 	// Create form data for the booking system
 	formData := url.Values{}
 	formData.Set("action", "availability")
-	formData.Set("parent_url", "https://montblanc.ffcam.fr/GB_reservation-tout-public.html")
+	formData.Set("parent_url", ReservationURL)
 	formData.Set("mode", "FORM_PREBOOK")
 	formData.Set("productCategory", "nomatter")
-	formData.Set("pax", "1")
+	formData.Set("pax", strconv.Itoa(pax))
 	formData.Set("date", targetDate.Format("2006-01-02"))
 	formData.Set("structure", structureID)
 
 	// Create request for availability
-	apiURL := "https://centrale.ffcam.fr/index.php?_lang=GB"
-
-	req, err := http.NewRequest("POST", apiURL, strings.NewReader(formData.Encode()))
+	req, err := http.NewRequestWithContext(requestCtx, "POST", availabilityURL, strings.NewReader(formData.Encode()))
 	if err != nil {
 		return "", fmt.Errorf("error creating availability request: %v", err)
 	}
@@ -52,95 +72,128 @@ func makeAvailabilityRequest(refugeName string, structureID string, targetDate t
 	// Set essential headers
 	req.Header.Set("content-type", "application/x-www-form-urlencoded")
 
-	// Add session cookie
-	req.AddCookie(&http.Cookie{
-		Name:  "PHPSESSID",
-		Value: sessionID,
-	})
+	// Add session cookie; the shared jar also sends back the other cookies FFCAM set
+	if err := seedSession(ffcamClient, availabilityURL, sessionID); err != nil {
+		return "", fmt.Errorf("error setting session cookie: %v", err)
+	}
 
-	// Send request
-	resp, err := client.Do(req)
+	// Send request, spaced out from the previous ones
+	if err := FFCAMLimiter.Wait(requestCtx); err != nil {
+		return "", err
+	}
+	resp, err := ffcamClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch %s page: %v", refugeName, err)
+		return "", fmt.Errorf("failed to fetch %s page: %w", refugeName, err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, refugeName)
+		io.Copy(io.Discard, resp.Body) // drain so the connection can be reused
+		return "", &StatusError{Refuge: refugeName, Code: resp.StatusCode}
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	// read one byte past the limit to tell a page of exactly MaxBodySize from a longer one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodySize+1))
 	if err != nil {
 		return "", fmt.Errorf("failed to read %s response body: %v", refugeName, err)
 	}
+	if int64(len(body)) > MaxBodySize {
+		return "", &BodyTooLargeError{Limit: MaxBodySize}
+	}
+	if len(body) < minBodySize {
+		return "", fmt.Errorf("%w (%d bytes)", ErrEmptyBody, len(body))
+	}
 
 	return string(body), nil
 }
 
-func ParseRefugeAvailability(baseURL string, targetDate time.Time) ([]Refuge, error) {
-	log.Printf("Fetching refuge availability from %s for date %s", baseURL, targetDate.Format("2006-01-02"))
-
-	refuges := make([]Refuge, 0)
-	totalDates := 0
+// ParseRefugeAvailability fetches and parses availability for a group of pax at every known
+// refuge. Refuges that fail are reported in Result.Errors; an error is returned only when
+// no refuge produced any dates.
+func ParseRefugeAvailability(baseURL string, targetDate time.Time, pax int) (Result, error) {
+	slog.Debug("fetching refuge availability", "url", baseURL, "date", targetDate.Format("2006-01-02"), "pax", pax)
 
-	// Process both refuges
-	refugeIDs := map[string]string{
-		"Tête Rousse": "BK_STRUCTURE:29",
-		"du Goûter":   "BK_STRUCTURE:30",
+	res := Result{
+		Refuges: make([]Refuge, 0),
+		Errors:  make(map[string]error),
 	}
+	totalDates := 0
 
-	for refugeName, refugeID := range refugeIDs {
-		// Make API call
-		content, err := makeAvailabilityRequest(refugeName, refugeID, targetDate)
-		if err != nil {
-			return nil, err
-		}
-
-		log.Printf("Received %s response of length %d bytes at %v", refugeName, len(content), time.Now().Format("2006-01-02 15:04:05"))
-
-		// Create refuge
-		refuge := Refuge{
-			Name:  refugeName,
-			Dates: make(map[string]string),
+	// Process every refuge of the registry (snapshot: a reload applies from the next call)
+	for _, rc := range Refuges() {
+		refugeName, refugeID := rc.Name, rc.StructureID
+		refuge, err := fetchRefuge(refugeName, refugeID, targetDate, pax)
+		if errors.Is(err, ErrReauthNeeded) && activeSession != nil {
+			// session expired: get a fresh one and try once more
+			slog.Info("session expired, refreshing", "refuge", refugeName)
+			if _, rerr := activeSession.Refresh(refuge.session); rerr != nil {
+				slog.Warn("failed to refresh FFCAM session", "error", rerr)
+			} else {
+				refuge, err = fetchRefuge(refugeName, refugeID, targetDate, pax)
+			}
 		}
-
-		// Parse HTML content with targetDate as month/year anchor
-		if err := parseRefugeContent(content, &refuge, targetDate); err != nil {
-			log.Printf("Warning: Failed to parse HTML for %s: %v", refugeName, err)
-			continue
+		if err == nil && len(refuge.Dates) == 0 {
+			err = ErrEmptyCalendar
 		}
-
-		// Check if we got any dates for this refuge
-		if len(refuge.Dates) == 0 {
-			log.Printf("Warning: No dates found for %s", refugeName)
+		if err != nil {
+			err = fmt.Errorf("%s %s: %w", refugeName, targetDate.Format("2006-01"), err)
+			metrics.ParseErrors.WithLabelValues(refugeName, ErrorClass(err)).Inc()
+			slog.Warn("failed to fetch refuge", "refuge", refugeName, "error", err)
+			res.Errors[refugeName] = err
 			continue
 		}
 
-		// Log available dates summary
-		availableDates := make([]string, 0)
-		for date, status := range refuge.Dates {
-			if status != "Full" {
-				availableDates = append(availableDates, fmt.Sprintf("%s (%s places)", date, status))
+		// counts only: the scheduler logs what changed since the previous check
+		open := 0
+		for _, day := range refuge.Days() {
+			if day.Available() {
+				open++
 			}
 		}
-		if len(availableDates) > 0 {
-			log.Printf("📅 %s available dates at %v: %s", refugeName, time.Now().Format("2006-01-02 15:04:05"), strings.Join(availableDates, ", "))
-		} else {
-			log.Printf("❌ %s has no available dates at %v", refugeName, time.Now().Format("2006-01-02 15:04:05"))
-		}
+		slog.Info("parsed refuge month", "refuge", refugeName, "month", targetDate.Format("2006-01"), "dates", len(refuge.Dates), "open", open)
 
 		totalDates += len(refuge.Dates)
-		refuges = append(refuges, refuge)
+		res.Refuges = append(res.Refuges, refuge.Refuge)
 	}
 
 	// Check if we got any dates at all
 	if totalDates == 0 {
-		return nil, fmt.Errorf("no dates found for any refuge")
+		return res, fmt.Errorf("no dates found for any refuge: %w", joinErrors(res.Errors))
+	}
+
+	slog.Info("parsed refuges", "refuges", len(res.Refuges), "dates", totalDates, "failed", len(res.Errors))
+	return res, nil
+}
+
+// fetchedRefuge is a parsed refuge along with the session ID used to fetch it
+type fetchedRefuge struct {
+	Refuge
+	session string
+}
+
+// fetchRefuge fetches (retrying transient failures) and parses one refuge for targetDate's month
+// and a group of pax
+func fetchRefuge(refugeName string, refugeID string, targetDate time.Time, pax int) (fetchedRefuge, error) {
+	used, _ := sessionID()
+	refuge := fetchedRefuge{Refuge: Refuge{Name: refugeName, Dates: make(map[string]string)}, session: used}
+
+	// Make API call (retrying transient failures) unless FFCAM appears to be down
+	if !FFCAMBreaker.Allow() {
+		return refuge, ErrCircuitOpen
+	}
+	start := time.Now()
+	content, err := fetchWithRetry(refugeName, refugeID, targetDate, pax)
+	metrics.FetchDuration.WithLabelValues(refugeName).Observe(time.Since(start).Seconds())
+	FFCAMBreaker.record(err)
+	if err != nil {
+		return refuge, err
 	}
 
-	log.Printf("Successfully parsed %d refuges with %d total dates", len(refuges), totalDates)
-	return refuges, nil
+	slog.Debug("received response", "refuge", refugeName, "bytes", len(content))
+
+	// Parse HTML content with targetDate as month/year anchor
+	return refuge, parseRefugeContent(content, &refuge.Refuge, targetDate)
 }
 
 // parseRefugeContent parses HTML content and extracts available and full dates
@@ -152,27 +205,20 @@ func parseRefugeContent(content string, refuge *Refuge, anchor time.Time) error
 		return fmt.Errorf("failed to parse HTML: %v", err)
 	}
 
-	// if content contains "Your Rank in the waiting room"
-	// try again in 1 minute with a new API call
-	if strings.Contains(content, "Your Rank in the waiting room") {
-		log.Printf("⏳ Your Rank in the waiting room, retrying in 1 minute...")
-		time.Sleep(1 * time.Minute)
-		log.Printf("🔄 Retrying after waiting room...")
-
-		// Make a new API call
-		var structureID string
-		if refuge.Name == "Tête Rousse" {
-			structureID = "BK_STRUCTURE:29"
-		} else {
-			structureID = "BK_STRUCTURE:30"
-		}
-		newContent, err := makeAvailabilityRequest(refuge.Name, structureID, time.Now())
-		if err != nil {
-			return err
-		}
+	// the login form means our session cookie is no longer valid
+	if strings.Contains(content, "My email") {
+		return ErrReauthNeeded
+	}
+	// maintenance page: no calendar at all, rather than a month without free days
+	if doc.Find(".day").Length() == 0 && strings.Contains(strings.ToLower(content), "maintenance") {
+		return ErrMaintenance
+	}
 
-		// Parse the new HTML content
-		return parseRefugeContent(newContent, refuge, anchor)
+	// queued in the waiting room: report the rank so the caller can schedule the retry
+	if strings.Contains(content, waitingRoomMarker) {
+		wr := parseWaitingRoom(content)
+		slog.Info("waiting room", "refuge", refuge.Name, "rank", wr.Rank, "eta", wr.ETA)
+		return wr
 	}
 
 	// Find all available dates
@@ -191,7 +237,6 @@ func parseRefugeContent(content string, refuge *Refuge, anchor time.Time) error
 					day := parts[1]
 					formattedDate := fmt.Sprintf("%04d-%02s-%02s", anchor.Year(), month, day)
 					refuge.Dates[formattedDate] = places
-					log.Printf("🎉 %s - Date %s: %s places available", refuge.Name, formattedDate, places)
 				}
 			}
 		}
@@ -207,31 +252,38 @@ func parseRefugeContent(content string, refuge *Refuge, anchor time.Time) error
 				month := parts[0]
 				day := parts[1]
 				formattedDate := fmt.Sprintf("%04d-%02s-%02s", anchor.Year(), month, day)
-				refuge.Dates[formattedDate] = "Full"
+				refuge.Dates[formattedDate] = rawFull
 			}
 		}
 	})
 
+	// Find all closed dates (hut not open for booking that day)
+	doc.Find(".day.ferme").Each(func(i int, s *goquery.Selection) {
+		date := strings.TrimSpace(s.Text())
+		parts := strings.Split(date, "/")
+		if len(parts) == 2 {
+			formattedDate := fmt.Sprintf("%04d-%02s-%02s", anchor.Year(), parts[0], parts[1])
+			refuge.Dates[formattedDate] = rawClosed
+		}
+	})
+
 	return nil
 }
 
 func CheckAvailability(refuges []Refuge, targetDate time.Time) (bool, string) {
-	log.Printf("Checking availability across all dates")
+	slog.Debug("checking availability across all dates")
 
 	var availableDates []string
 	totalPlaces := 0
 
 	for _, refuge := range refuges {
-		for date, status := range refuge.Dates {
-			if status != "Full" {
-				// Convert places string to integer
-				places, err := strconv.Atoi(status)
-				if err != nil {
-					log.Printf("Warning: Failed to parse places for %s on %s: %v", refuge.Name, date, err)
-					continue
-				}
-				totalPlaces += places
-				availableDates = append(availableDates, fmt.Sprintf("%s on %s has %d places", refuge.Name, date, places))
+		for _, day := range refuge.Days() {
+			switch day.Status {
+			case StatusAvailable:
+				totalPlaces += day.Places
+				availableDates = append(availableDates, fmt.Sprintf("%s on %s has %d places", refuge.Name, day.Key(), day.Places))
+			case StatusUnknown:
+				slog.Warn("failed to parse places", "refuge", refuge.Name, "date", day.Key(), "value", refuge.Dates[day.Key()])
 			}
 		}
 	}
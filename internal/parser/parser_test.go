@@ -1,15 +1,18 @@
 package parser
 
 import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
     "os"
     "testing"
     "time"
 )
 
 func TestParseRefugeContentFromFile(t *testing.T) {
-	content, err := os.ReadFile("response.html")
+	content, err := os.ReadFile("testdata/normal_month.html")
 	if err != nil {
-		t.Fatalf("failed to read response.html: %v", err)
+		t.Fatalf("failed to read testdata/normal_month.html: %v", err)
 	}
 
 	refuge := Refuge{
@@ -31,6 +34,25 @@ func TestParseRefugeContentFromFile(t *testing.T) {
 	if refuge.Dates["2025-08-25"] != "1" {
 		t.Errorf("expected 1 places for 2025-08-08, got %s", refuge.Dates["2025-08-25"])
 	}
+
+	// typed view of the same data
+	days := refuge.Days()
+	if len(days) != 62 {
+		t.Fatalf("expected 62 days, got %d", len(days))
+	}
+	for i := 1; i < len(days); i++ {
+		if !days[i-1].Date.Before(days[i].Date) {
+			t.Fatalf("days not sorted: %s before %s", days[i-1].Key(), days[i].Key())
+		}
+	}
+	if day, ok := refuge.Day("2025-08-03"); !ok || day.Status != StatusAvailable || day.Places != 2 {
+		t.Errorf("expected 2025-08-03 available with 2 places, got %+v", day)
+	}
+	for _, day := range days {
+		if day.Status == StatusUnknown {
+			t.Errorf("unexpected unknown status for %s", day.Key())
+		}
+	}
 }
 
 func TestParseRefugeContent(t *testing.T) {
@@ -181,3 +203,159 @@ func TestParseRefugeContent(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRefugeAvailabilityPartialFailure(t *testing.T) {
+	content, err := os.ReadFile("testdata/normal_month.html")
+	if err != nil {
+		t.Fatalf("failed to read testdata/normal_month.html: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the handler runs on the server's goroutine, where t.Fatal mustn't be called
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// Tête Rousse succeeds, du Goûter fails
+		if r.FormValue("structure") == "BK_STRUCTURE:30" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	prevURL, prevSleep := availabilityURL, sleep
+	availabilityURL = srv.URL
+	sleep = func(time.Duration) {}
+	defer func() { availabilityURL, sleep = prevURL, prevSleep }()
+	useSessionID(t, "test")
+
+	res, err := ParseRefugeAvailability(srv.URL, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 1)
+	if err != nil {
+		t.Fatalf("expected partial result without error, got %v", err)
+	}
+	if len(res.Refuges) != 1 || res.Refuges[0].Name != "Tête Rousse" {
+		t.Fatalf("expected only Tête Rousse in result, got %+v", res.Refuges)
+	}
+	if len(res.Refuges[0].Dates) != 62 {
+		t.Errorf("expected 62 dates for Tête Rousse, got %d", len(res.Refuges[0].Dates))
+	}
+	if len(res.Errors) != 1 || res.Errors["du Goûter"] == nil {
+		t.Errorf("expected a single error for du Goûter, got %v", res.Errors)
+	}
+}
+
+func TestParseRefugeAvailabilityAllFailed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	prevURL, prevSleep := availabilityURL, sleep
+	availabilityURL = srv.URL
+	sleep = func(time.Duration) {}
+	defer func() { availabilityURL, sleep = prevURL, prevSleep }()
+	useSessionID(t, "test")
+
+	res, err := ParseRefugeAvailability(srv.URL, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 1)
+	if err == nil {
+		t.Fatal("expected error when every refuge fails")
+	}
+	if len(res.Refuges) != 0 {
+		t.Errorf("expected no refuges, got %d", len(res.Refuges))
+	}
+	if len(res.Errors) != 2 {
+		t.Errorf("expected 2 errors, got %d", len(res.Errors))
+	}
+}
+
+func TestParseRefugeAvailabilityLoginPage(t *testing.T) {
+	login, err := os.ReadFile("testdata/login_page.html")
+	if err != nil {
+		t.Fatalf("failed to read testdata/login_page.html: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(login)
+	}))
+	defer srv.Close()
+
+	prevURL := availabilityURL
+	availabilityURL = srv.URL
+	defer func() { availabilityURL = prevURL }()
+	useSessionID(t, "expired")
+
+	res, err := ParseRefugeAvailability(srv.URL, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 1)
+	if err == nil {
+		t.Fatal("expected error for login page")
+	}
+	if len(res.Errors) != 2 {
+		t.Fatalf("expected both refuges to fail, got %v", res.Errors)
+	}
+	for name, ferr := range res.Errors {
+		if !errors.Is(ferr, ErrReauthNeeded) {
+			t.Errorf("expected ErrReauthNeeded for %s, got %v", name, ferr)
+		}
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	cases := []struct {
+		raw    string
+		status Status
+		places int
+	}{
+		{"3", StatusAvailable, 3},
+		{" 12 ", StatusAvailable, 12},
+		{"Full", StatusFull, 0},
+		{"0", StatusFull, 0},
+		{"Closed", StatusClosed, 0},
+		{"?", StatusUnknown, 0},
+	}
+	for _, c := range cases {
+		day, err := ParseDay("2025-07-10", c.raw)
+		if err != nil {
+			t.Fatalf("ParseDay(%q): %v", c.raw, err)
+		}
+		if day.Status != c.status || day.Places != c.places {
+			t.Errorf("ParseDay(%q) = %v/%d, want %v/%d", c.raw, day.Status, day.Places, c.status, c.places)
+		}
+		if day.Key() != "2025-07-10" {
+			t.Errorf("unexpected key %s", day.Key())
+		}
+	}
+	if _, err := ParseDay("10/07", "3"); err == nil {
+		t.Error("expected error for invalid date")
+	}
+	if raw := (DayAvailability{Status: StatusAvailable, Places: 4}).Raw(); raw != "4" {
+		t.Errorf("Raw() = %q, want 4", raw)
+	}
+}
+
+func TestSortedDates(t *testing.T) {
+	r := Refuge{Name: "Tête Rousse", Dates: map[string]string{
+		"2025-07-12": "Closed",
+		"2025-07-10": "3",
+		"2025-07-11": "Full",
+		"2025-07-09": "?",
+		"bad":        "2",
+	}}
+	want := []DateStatus{
+		{Date: "2025-07-09", Status: "Unknown"},
+		{Date: "2025-07-10", Status: "Available", Places: 3},
+		{Date: "2025-07-11", Status: "Full"},
+		{Date: "2025-07-12", Status: "Closed"},
+		{Date: "bad", Status: "Unknown"},
+	}
+	for i := 0; i < 3; i++ {
+		got := r.SortedDates()
+		if len(got) != len(want) {
+			t.Fatalf("expected %d dates, got %+v", len(want), got)
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Errorf("date %d = %+v, want %+v", j, got[j], want[j])
+			}
+		}
+	}
+}
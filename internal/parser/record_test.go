@@ -0,0 +1,47 @@
+//go:build record
+
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRecordFixture saves a live FFCAM response as a parser fixture:
+//
+//	PHPSESSID=... FFCAM_RECORD_NAME=busy_month FFCAM_RECORD_DATE=2025-08-01 \
+//	  go test -tags record ./internal/parser -run TestRecordFixture
+//
+// FFCAM_RECORD_STRUCTURE picks the refuge (defaults to Tête Rousse). Run the
+// golden suite with -update afterwards and add the new name to its table.
+func TestRecordFixture(t *testing.T) {
+	name := os.Getenv("FFCAM_RECORD_NAME")
+	if name == "" {
+		t.Fatal("FFCAM_RECORD_NAME not set")
+	}
+	structureID := os.Getenv("FFCAM_RECORD_STRUCTURE")
+	if structureID == "" {
+		structureID = "BK_STRUCTURE:29"
+	}
+	date := time.Now()
+	if v := os.Getenv("FFCAM_RECORD_DATE"); v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			t.Fatalf("invalid FFCAM_RECORD_DATE %q: %v", v, err)
+		}
+		date = d
+	}
+
+	UseSession(NewSession("", nil, Credentials{SessionID: os.Getenv("PHPSESSID")}))
+	content, err := makeAvailabilityRequest(name, structureID, date, 1)
+	if err != nil {
+		t.Fatalf("failed to fetch availability: %v", err)
+	}
+	path := filepath.Join("testdata", name+".html")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	t.Logf("recorded %s (%d bytes)", path, len(content))
+}
@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RefugeConfig is a monitored refuge and its FFCAM structure ID
+type RefugeConfig struct {
+	Name        string  `json:"name"`
+	StructureID string  `json:"structure_id"`          // e.g. BK_STRUCTURE:29
+	NightPrice  float64 `json:"night_price,omitempty"` // € per person and night (e.g. half board), 0 when unknown
+	Channel     string  `json:"channel,omitempty"`     // public channel availability changes are posted to
+}
+
+// DefaultRefuges is the built-in registry used when no registry file is configured
+var DefaultRefuges = []RefugeConfig{
+	{Name: "Tête Rousse", StructureID: "BK_STRUCTURE:29"},
+	{Name: "du Goûter", StructureID: "BK_STRUCTURE:30"},
+}
+
+// registry holds the live refuge list; it is swapped as a whole on reload
+var registry atomic.Pointer[[]RefugeConfig]
+
+// configured is the file or built-in registry (nil for DefaultRefuges) and added the structures
+// admins added at runtime; registryMu serializes rebuilding registry from the two
+var (
+	registryMu sync.Mutex
+	configured []RefugeConfig
+	added      []RefugeConfig
+)
+
+var structureIDPattern = regexp.MustCompile(`^BK_STRUCTURE:\d+$`)
+
+// channelPattern matches a public channel username (@name) or a numeric chat ID
+var channelPattern = regexp.MustCompile(`^(@[A-Za-z][A-Za-z0-9_]{3,}|-?[0-9]+)$`)
+
+// Refuges returns the live refuge registry. Callers must not modify the slice.
+func Refuges() []RefugeConfig {
+	if rs := registry.Load(); rs != nil {
+		return *rs
+	}
+	return DefaultRefuges
+}
+
+// SetRefuges replaces the configured registry; a nil slice restores the defaults. Structures
+// added at runtime stay monitored. Checks already running keep the list they started with.
+func SetRefuges(rs []RefugeConfig) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	configured = rs
+	publishRegistry()
+}
+
+// SetAddedRefuges replaces the structures added at runtime; they are monitored after the
+// configured refuges, and one whose name or structure ID is already configured is skipped
+func SetAddedRefuges(rs []RefugeConfig) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	added = rs
+	publishRegistry()
+}
+
+// publishRegistry swaps in the configured refuges followed by the added ones
+func publishRegistry() {
+	if configured == nil && len(added) == 0 {
+		registry.Store(nil)
+		return
+	}
+	base := configured
+	if base == nil {
+		base = DefaultRefuges
+	}
+	rs := append([]RefugeConfig(nil), base...)
+	for _, a := range added {
+		if _, clash := findRefuge(rs, a); clash {
+			slog.Warn("added structure is already configured, skipping it", "refuge", a.Name, "structure_id", a.StructureID)
+			continue
+		}
+		rs = append(rs, a)
+	}
+	registry.Store(&rs)
+}
+
+// findRefuge returns the refuge of rs with the name or structure ID of r
+func findRefuge(rs []RefugeConfig, r RefugeConfig) (RefugeConfig, bool) {
+	for _, c := range rs {
+		if c.Name == r.Name || c.StructureID == r.StructureID {
+			return c, true
+		}
+	}
+	return RefugeConfig{}, false
+}
+
+// FindRefuge returns the live refuge with the name or structure ID of r, if any
+func FindRefuge(r RefugeConfig) (RefugeConfig, bool) { return findRefuge(Refuges(), r) }
+
+// ValidStructureID reports whether id looks like an FFCAM structure ID (BK_STRUCTURE:<number>)
+func ValidStructureID(id string) bool { return structureIDPattern.MatchString(id) }
+
+// ValidChannel reports whether channel can be posted to: a @username or a chat ID
+func ValidChannel(channel string) bool { return channelPattern.MatchString(channel) }
+
+// ProbeStructure fetches and parses one month of a structure that need not be in the registry,
+// to check it is a bookable hut before monitoring it. A calendar without dates is an error.
+func ProbeStructure(r RefugeConfig, targetDate time.Time) (Refuge, error) {
+	if !ValidStructureID(r.StructureID) {
+		return Refuge{}, fmt.Errorf("invalid structure ID %q", r.StructureID)
+	}
+	refuge, err := fetchRefuge(r.Name, r.StructureID, targetDate, DefaultPax)
+	if err == nil && len(refuge.Dates) == 0 {
+		err = ErrEmptyCalendar
+	}
+	return refuge.Refuge, err
+}
+
+// LoadRegistry reads and validates a JSON registry file (a list of {"name", "structure_id"})
+func LoadRegistry(path string) ([]RefugeConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refuge registry: %w", err)
+	}
+	var rs []RefugeConfig
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("invalid refuge registry %s: %w", path, err)
+	}
+	if err := ValidateRegistry(rs); err != nil {
+		return nil, fmt.Errorf("invalid refuge registry %s: %w", path, err)
+	}
+	return rs, nil
+}
+
+// ValidateRegistry checks that the registry is non-empty with unique names and structure IDs
+func ValidateRegistry(rs []RefugeConfig) error {
+	if len(rs) == 0 {
+		return fmt.Errorf("no refuges configured")
+	}
+	names := map[string]bool{}
+	ids := map[string]bool{}
+	for i, r := range rs {
+		if r.Name == "" {
+			return fmt.Errorf("refuge %d has no name", i+1)
+		}
+		if !structureIDPattern.MatchString(r.StructureID) {
+			return fmt.Errorf("refuge %s has invalid structure_id %q", r.Name, r.StructureID)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate refuge %s", r.Name)
+		}
+		if ids[r.StructureID] {
+			return fmt.Errorf("duplicate structure_id %s", r.StructureID)
+		}
+		if r.NightPrice < 0 {
+			return fmt.Errorf("refuge %s has negative night_price %g", r.Name, r.NightPrice)
+		}
+		if r.Channel != "" && !ValidChannel(r.Channel) {
+			return fmt.Errorf("refuge %s has invalid channel %q", r.Name, r.Channel)
+		}
+		names[r.Name], ids[r.StructureID] = true, true
+	}
+	return nil
+}
+
+// structureIDFor returns the structure ID of a refuge in the live registry
+func structureIDFor(name string) (string, bool) {
+	for _, r := range Refuges() {
+		if r.Name == name {
+			return r.StructureID, true
+		}
+	}
+	return "", false
+}
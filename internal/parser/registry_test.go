@@ -0,0 +1,55 @@
+package parser
+
+import "testing"
+
+func TestValidateRegistry(t *testing.T) {
+	if err := ValidateRegistry(DefaultRefuges); err != nil {
+		t.Errorf("default registry should be valid: %v", err)
+	}
+	bad := map[string][]RefugeConfig{
+		"empty":          nil,
+		"no name":        {{StructureID: "BK_STRUCTURE:1"}},
+		"bad id":         {{Name: "X", StructureID: "STRUCTURE:1"}},
+		"duplicate id":   {{Name: "X", StructureID: "BK_STRUCTURE:1"}, {Name: "Y", StructureID: "BK_STRUCTURE:1"}},
+		"negative price": {{Name: "X", StructureID: "BK_STRUCTURE:1", NightPrice: -1}},
+	}
+	for name, rs := range bad {
+		if err := ValidateRegistry(rs); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRefugesDefaultsAndSwap(t *testing.T) {
+	t.Cleanup(func() { SetRefuges(nil) })
+	if len(Refuges()) != len(DefaultRefuges) {
+		t.Fatalf("expected defaults, got %+v", Refuges())
+	}
+	SetRefuges([]RefugeConfig{{Name: "Cosmiques", StructureID: "BK_STRUCTURE:31"}})
+	if id, ok := structureIDFor("Cosmiques"); !ok || id != "BK_STRUCTURE:31" {
+		t.Errorf("expected Cosmiques after swap, got %q %v", id, ok)
+	}
+	if _, ok := structureIDFor("Tête Rousse"); ok {
+		t.Error("Tête Rousse should be gone after swap")
+	}
+}
+
+func TestAddedRefugesSurviveSwap(t *testing.T) {
+	t.Cleanup(func() { SetRefuges(nil); SetAddedRefuges(nil) })
+	SetAddedRefuges([]RefugeConfig{
+		{Name: "Cosmiques", StructureID: "BK_STRUCTURE:31"},
+		{Name: "Goûter bis", StructureID: "BK_STRUCTURE:30"}, // clashes with a default
+	})
+	if got := Refuges(); len(got) != 3 || got[2].Name != "Cosmiques" {
+		t.Fatalf("expected the defaults then Cosmiques, got %+v", got)
+	}
+	SetRefuges([]RefugeConfig{{Name: "Albert 1er", StructureID: "BK_STRUCTURE:40"}})
+	got := Refuges()
+	if len(got) != 3 || got[0].Name != "Albert 1er" || got[1].Name != "Cosmiques" || got[2].Name != "Goûter bis" {
+		t.Errorf("expected the added structures kept after a reload, got %+v", got)
+	}
+	SetAddedRefuges(nil)
+	if got := Refuges(); len(got) != 1 {
+		t.Errorf("expected only the configured refuge, got %+v", got)
+	}
+}
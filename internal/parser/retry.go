@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy controls how transient FFCAM failures are retried
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first one
+	BaseDelay   time.Duration // delay before the 2nd attempt; doubled for each further attempt
+}
+
+// Retry is the policy used for availability requests
+var Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: 2 * time.Second}
+
+// sleep is time.Sleep (overridable in tests)
+var sleep = time.Sleep
+
+// StatusError is returned when FFCAM answers with a non-200 status
+type StatusError struct {
+	Refuge string
+	Code   int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d for %s", e.Code, e.Refuge)
+}
+
+// Is makes a 429 response match ErrRateLimited
+func (e *StatusError) Is(target error) bool {
+	return target == ErrRateLimited && e.Code == http.StatusTooManyRequests
+}
+
+// RetryError is returned when every attempt failed with a retryable error,
+// so callers can tell an exhausted retry from a hard failure
+type RetryError struct {
+	Attempts int
+	Err      error // last error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("giving up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error { return e.Err }
+
+// isRetryable reports whether err is transient: network errors and 5xx responses.
+// Requests cancelled through UseContext are not retried.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= 500
+	}
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// backoff returns the delay before the given retry (1-based) with up to 50% jitter
+func backoff(base time.Duration, retry int) time.Duration {
+	d := base << (retry - 1)
+	if d <= 0 {
+		return 0
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// fetchWithRetry calls makeAvailabilityRequest, retrying transient failures with exponential backoff
+func fetchWithRetry(refugeName string, structureID string, targetDate time.Time, pax int) (string, error) {
+	attempts := Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var content string
+		content, err = makeAvailabilityRequest(refugeName, structureID, targetDate, pax)
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("request succeeded after retrying", "refuge", refugeName, "attempt", attempt, "attempts", attempts)
+			}
+			return content, nil
+		}
+		if !isRetryable(err) {
+			return "", err
+		}
+		if attempt < attempts {
+			delay := backoff(Retry.BaseDelay, attempt)
+			slog.Warn("request failed, retrying", "refuge", refugeName, "attempt", attempt, "attempts", attempts, "delay", delay, "error", err)
+			sleep(delay)
+		}
+	}
+	return "", &RetryError{Attempts: attempts, Err: err}
+}
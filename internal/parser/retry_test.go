@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// withFakeFFCAM points the parser at handler and disables real sleeping
+func withFakeFFCAM(t *testing.T, handler http.HandlerFunc) *[]time.Duration {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	prevURL, prevSleep, prevRetry := availabilityURL, sleep, Retry
+	var slept []time.Duration
+	availabilityURL = srv.URL
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: 2 * time.Second}
+	t.Cleanup(func() { availabilityURL, sleep, Retry = prevURL, prevSleep, prevRetry })
+	useSessionID(t, "test")
+	return &slept
+}
+
+// normalMonth returns the testdata/normal_month.html calendar, for tests that need any valid page
+func normalMonth(t *testing.T) []byte {
+	t.Helper()
+	content, err := os.ReadFile("testdata/normal_month.html")
+	if err != nil {
+		t.Fatalf("failed to read testdata/normal_month.html: %v", err)
+	}
+	return content
+}
+
+// useSessionID makes availability requests use a fixed session ID for the duration of the test
+func useSessionID(t *testing.T, id string) {
+	t.Helper()
+	prev := activeSession
+	UseSession(NewSession("", nil, Credentials{SessionID: id}))
+	t.Cleanup(func() { activeSession = prev })
+}
+
+func TestFetchWithRetryFailsTwiceThenSucceeds(t *testing.T) {
+	calls := 0
+	page := normalMonth(t)
+	slept := withFakeFFCAM(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write(page)
+	})
+
+	content, err := fetchWithRetry("Test Refuge", "BK_STRUCTURE:29", time.Now(), 1)
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if content == "" {
+		t.Error("expected content")
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+	if len(*slept) != 2 {
+		t.Fatalf("expected 2 backoff sleeps, got %v", *slept)
+	}
+	// exponential: ~2s then ~4s, each with at most 50% jitter
+	if d := (*slept)[0]; d < 2*time.Second || d > 3*time.Second {
+		t.Errorf("first backoff out of range: %v", d)
+	}
+	if d := (*slept)[1]; d < 4*time.Second || d > 6*time.Second {
+		t.Errorf("second backoff out of range: %v", d)
+	}
+}
+
+func TestFetchWithRetryExhausted(t *testing.T) {
+	calls := 0
+	withFakeFFCAM(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	_, err := fetchWithRetry("Test Refuge", "BK_STRUCTURE:29", time.Now(), 1)
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("expected RetryError, got %v", err)
+	}
+	if retryErr.Attempts != 3 || calls != 3 {
+		t.Errorf("expected 3 attempts, got %d (calls %d)", retryErr.Attempts, calls)
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected wrapped 503 StatusError, got %v", err)
+	}
+}
+
+func TestFetchWithRetryDoesNotRetry4xx(t *testing.T) {
+	calls := 0
+	slept := withFakeFFCAM(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	_, err := fetchWithRetry("Test Refuge", "BK_STRUCTURE:29", time.Now(), 1)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		t.Errorf("4xx must be a hard failure, got %v", err)
+	}
+	if calls != 1 || len(*slept) != 0 {
+		t.Errorf("expected a single attempt without sleeping, got %d calls, %v", calls, *slept)
+	}
+}
+
+func TestFetchWithRetryNetworkError(t *testing.T) {
+	slept := withFakeFFCAM(t, func(w http.ResponseWriter, r *http.Request) {})
+	availabilityURL = "http://127.0.0.1:1/unreachable"
+
+	_, err := fetchWithRetry("Test Refuge", "BK_STRUCTURE:29", time.Now(), 1)
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("expected network errors to be retried, got %v", err)
+	}
+	if len(*slept) != 2 {
+		t.Errorf("expected 2 backoff sleeps, got %v", *slept)
+	}
+}
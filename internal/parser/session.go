@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionSettingKey is the settings key the current PHPSESSID is persisted under
+const sessionSettingKey = "ffcam_phpsessid"
+
+// SessionStore persists the session between restarts (the store's settings table)
+type SessionStore interface {
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key string, value string) error
+}
+
+// Session owns the FFCAM PHPSESSID: it reuses the persisted value, obtains a new one from the
+// reservation page when needed (logging in when FFCAM_EMAIL is set) and refreshes it on ErrReauthNeeded
+type Session struct {
+	mu       sync.Mutex
+	id       string
+	pageURL  string
+	email    string
+	password string
+	st       SessionStore
+	client   *http.Client
+}
+
+// activeSession is used by availability requests
+var activeSession *Session
+
+// Credentials are the optional FFCAM login (FFCAM_EMAIL, FFCAM_PASSWORD) and initial session (PHPSESSID)
+type Credentials struct {
+	SessionID string
+	Email     string
+	Password  string
+}
+
+// NewSession creates a session that is obtained from pageURL and persisted in st (may be nil).
+// creds.SessionID takes precedence over the persisted value as the initial session.
+func NewSession(pageURL string, st SessionStore, creds Credentials) *Session {
+	s := &Session{
+		id:       creds.SessionID,
+		pageURL:  pageURL,
+		email:    creds.Email,
+		password: creds.Password,
+		st:       st,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if s.id == "" && st != nil {
+		if v, err := st.GetSetting(requestCtx, sessionSettingKey); err == nil {
+			s.id = v
+		}
+	}
+	return s
+}
+
+// UseSession makes availability requests use s for their session cookie
+func UseSession(s *Session) { activeSession = s }
+
+// ID returns the current session ID, acquiring one if there is none yet
+func (s *Session) ID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.id != "" {
+		return s.id, nil
+	}
+	return s.acquire()
+}
+
+// Refresh replaces stale with a fresh session. If another caller already refreshed it,
+// the current ID is returned without contacting FFCAM again.
+func (s *Session) Refresh(stale string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.id != "" && s.id != stale {
+		return s.id, nil
+	}
+	return s.acquire()
+}
+
+// acquire obtains a new PHPSESSID from the reservation page; callers hold mu
+func (s *Session) acquire() (string, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return "", err
+	}
+	client := *s.client
+	client.Jar = jar
+
+	resp, err := client.Get(s.pageURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to open reservation page: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{Refuge: "reservation page", Code: resp.StatusCode}
+	}
+	id := sessionCookie(jar, s.pageURL)
+	if id == "" {
+		return "", fmt.Errorf("reservation page did not set a PHPSESSID cookie")
+	}
+
+	if s.email != "" {
+		if err := s.login(id); err != nil {
+			return "", err
+		}
+	}
+
+	s.id = id
+	slog.Info("obtained new FFCAM session")
+	if s.st != nil {
+		if err := s.st.SetSetting(requestCtx, sessionSettingKey, id); err != nil {
+			slog.Warn("failed to persist FFCAM session", "error", err)
+		}
+	}
+	return id, nil
+}
+
+// login submits the email/password form for session id
+func (s *Session) login(id string) error {
+	form := url.Values{}
+	form.Set("action", "login")
+	form.Set("email", s.email)
+	form.Set("password", s.password)
+	req, err := http.NewRequest("POST", availabilityURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating login request: %v", err)
+	}
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "PHPSESSID", Value: id})
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Refuge: "login", Code: resp.StatusCode}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read login response: %v", err)
+	}
+	if strings.Contains(string(body), "My email") {
+		return fmt.Errorf("FFCAM login rejected for %s", s.email)
+	}
+	return nil
+}
+
+// sessionCookie returns the PHPSESSID stored in jar for rawURL
+func sessionCookie(jar http.CookieJar, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	for _, c := range jar.Cookies(u) {
+		if c.Name == "PHPSESSID" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// sessionID returns the session ID for availability requests
+func sessionID() (string, error) {
+	if activeSession == nil {
+		return "", fmt.Errorf("no FFCAM session in use")
+	}
+	return activeSession.ID()
+}
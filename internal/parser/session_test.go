@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// memSettings is an in-memory SessionStore
+type memSettings map[string]string
+
+func (m memSettings) GetSetting(_ context.Context, key string) (string, error) {
+	v, ok := m[key]
+	if !ok {
+		return "", fmt.Errorf("not found")
+	}
+	return v, nil
+}
+
+func (m memSettings) SetSetting(_ context.Context, key string, value string) error {
+	m[key] = value
+	return nil
+}
+
+// fakeFFCAMSite hands out sequential PHPSESSIDs on GET /page and serves availability on POST.
+// Sessions listed in expired get the login page.
+type fakeFFCAMSite struct {
+	issued  int
+	logins  []string
+	expired map[string]bool
+	content []byte
+	login   []byte
+}
+
+func (f *fakeFFCAMSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		f.issued++
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: fmt.Sprintf("sess-%d", f.issued), Path: "/"})
+		w.Write([]byte("<html></html>"))
+		return
+	}
+	r.ParseForm()
+	c, _ := r.Cookie("PHPSESSID")
+	if r.FormValue("action") == "login" {
+		f.logins = append(f.logins, c.Value+":"+r.FormValue("email"))
+		return
+	}
+	if c == nil || f.expired[c.Value] {
+		w.Write(f.login)
+		return
+	}
+	w.Write(f.content)
+}
+
+// withFakeSite points the parser and a new active session at a fake FFCAM site
+func withFakeSite(t *testing.T, st SessionStore, creds Credentials) (*fakeFFCAMSite, *Session) {
+	t.Helper()
+	content, err := os.ReadFile("testdata/normal_month.html")
+	if err != nil {
+		t.Fatalf("failed to read testdata/normal_month.html: %v", err)
+	}
+	login, err := os.ReadFile("testdata/login_page.html")
+	if err != nil {
+		t.Fatalf("failed to read testdata/login_page.html: %v", err)
+	}
+	site := &fakeFFCAMSite{expired: map[string]bool{}, content: content, login: login}
+	srv := httptest.NewServer(site)
+	t.Cleanup(srv.Close)
+
+	prevURL, prevSleep, prevSession := availabilityURL, sleep, activeSession
+	availabilityURL = srv.URL
+	sleep = func(time.Duration) {}
+	t.Cleanup(func() { availabilityURL, sleep, activeSession = prevURL, prevSleep, prevSession })
+
+	s := NewSession(srv.URL+"/page", st, creds)
+	UseSession(s)
+	return site, s
+}
+
+func TestSessionAcquiredAndPersisted(t *testing.T) {
+	st := memSettings{}
+	site, s := withFakeSite(t, st, Credentials{})
+
+	res, err := ParseRefugeAvailability("", time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Refuges) != 2 {
+		t.Fatalf("expected 2 refuges, got %d", len(res.Refuges))
+	}
+	if site.issued != 1 {
+		t.Errorf("expected a single session to be obtained, got %d", site.issued)
+	}
+	if id, _ := s.ID(); id != "sess-1" || st[sessionSettingKey] != "sess-1" {
+		t.Errorf("expected sess-1 in use and persisted, got %q / %q", id, st[sessionSettingKey])
+	}
+	if len(site.logins) != 0 {
+		t.Errorf("expected no login without FFCAM_EMAIL, got %v", site.logins)
+	}
+}
+
+func TestSessionReusesPersistedValue(t *testing.T) {
+	st := memSettings{sessionSettingKey: "stored"}
+	site, s := withFakeSite(t, st, Credentials{})
+
+	if id, err := s.ID(); err != nil || id != "stored" {
+		t.Fatalf("expected persisted session, got %q, %v", id, err)
+	}
+	if site.issued != 0 {
+		t.Errorf("expected no new session, got %d", site.issued)
+	}
+}
+
+func TestSessionRefreshedOnReauth(t *testing.T) {
+	st := memSettings{sessionSettingKey: "stale"}
+	site, _ := withFakeSite(t, st, Credentials{})
+	site.expired["stale"] = true
+
+	res, err := ParseRefugeAvailability("", time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 1)
+	if err != nil {
+		t.Fatalf("expected recovery after refresh, got %v", err)
+	}
+	if len(res.Errors) != 0 || len(res.Refuges) != 2 {
+		t.Fatalf("expected both refuges after refresh, got %d refuges, errors %v", len(res.Refuges), res.Errors)
+	}
+	// the second refuge must reuse the refreshed session rather than obtaining another one
+	if site.issued != 1 {
+		t.Errorf("expected exactly one refresh, got %d", site.issued)
+	}
+	if st[sessionSettingKey] != "sess-1" {
+		t.Errorf("expected refreshed session persisted, got %q", st[sessionSettingKey])
+	}
+}
+
+func TestSessionLogsInWithCredentials(t *testing.T) {
+	site, s := withFakeSite(t, memSettings{}, Credentials{Email: "me@example.com", Password: "secret"})
+
+	if _, err := s.ID(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(site.logins) != 1 || site.logins[0] != "sess-1:me@example.com" {
+		t.Errorf("expected login with sess-1, got %v", site.logins)
+	}
+}
+
+func TestSessionRefreshStillExpired(t *testing.T) {
+	site, _ := withFakeSite(t, memSettings{}, Credentials{})
+	for i := 1; i <= 4; i++ {
+		site.expired[fmt.Sprintf("sess-%d", i)] = true
+	}
+
+	res, err := ParseRefugeAvailability("", time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), 1)
+	if err == nil {
+		t.Fatal("expected error when the refreshed session is rejected too")
+	}
+	for name, ferr := range res.Errors {
+		if !errors.Is(ferr, ErrReauthNeeded) {
+			t.Errorf("expected ErrReauthNeeded for %s, got %v", name, ferr)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// breakerMonitor alerts admins once when the FFCAM circuit breaker opens and once more when it closes
+type breakerMonitor struct {
+	notify func(message string) error // sends to admins
+	down   bool
+}
+
+// observe inspects the breaker state after a check cycle; half-open counts as still down
+func (m *breakerMonitor) observe(state parser.BreakerState, now time.Time) {
+	switch {
+	case state == parser.BreakerOpen && !m.down:
+		msg := fmt.Sprintf("⛔ FFCAM appears down at %s UTC, pausing checks. The site is probed again periodically; you'll be told when checks resume.", now.UTC().Format("2006-01-02 15:04:05"))
+		if telegram.SendFailed("FFCAM down alert", m.notify(msg)) {
+			return
+		}
+		m.down = true
+	case state == parser.BreakerClosed && m.down:
+		if telegram.SendFailed("FFCAM resumed message", m.notify(fmt.Sprintf("✅ FFCAM is reachable again at %s UTC, checks resumed.", now.UTC().Format("2006-01-02 15:04:05")))) {
+			return
+		}
+		m.down = false
+	}
+}
@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+func TestBreakerMonitorAlertsOnTransitions(t *testing.T) {
+	var sent []string
+	m := &breakerMonitor{notify: func(msg string) error {
+		sent = append(sent, msg)
+		return nil
+	}}
+	now := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+
+	m.observe(parser.BreakerClosed, now)
+	if len(sent) != 0 {
+		t.Fatalf("expected no message while closed, got %v", sent)
+	}
+	// open, failed probes and renewed cooldowns are a single outage
+	for _, s := range []parser.BreakerState{parser.BreakerOpen, parser.BreakerHalfOpen, parser.BreakerOpen, parser.BreakerOpen} {
+		m.observe(s, now)
+	}
+	if len(sent) != 1 || !strings.Contains(sent[0], "pausing checks") || !strings.Contains(sent[0], "2025-07-01 08:00:00") {
+		t.Fatalf("expected one down alert, got %v", sent)
+	}
+	m.observe(parser.BreakerClosed, now.Add(time.Hour))
+	m.observe(parser.BreakerClosed, now.Add(time.Hour+time.Minute))
+	if len(sent) != 2 || !strings.Contains(sent[1], "resumed") {
+		t.Fatalf("expected one resumed message, got %v", sent)
+	}
+}
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+	"github.com/AlexYaroshenko/montblanc/internal/web"
+)
+
+// channelEditWindow is how long after posting about a date its message is edited rather than a
+// new one posted, so a date flapping between free and full doesn't flood the channel
+const channelEditWindow = 5 * time.Minute
+
+// channelPostLimit bounds the posts and edits sent to the refuge channels per minute
+const channelPostLimit = 20
+
+// channelKey identifies the message about a date at a refuge in a channel
+type channelKey struct {
+	channel string
+	refuge  string
+	date    string
+}
+
+// channelPost is the last message posted about a date
+type channelPost struct {
+	id   int
+	text string
+	at   time.Time
+}
+
+// channelLog remembers the recent messages posted to the refuge channels and when, for the edit
+// window and the rate limit
+type channelLog struct {
+	posts map[channelKey]channelPost
+	sent  []time.Time // posts and edits of the last minute
+}
+
+func newChannelLog() *channelLog {
+	return &channelLog{posts: make(map[channelKey]channelPost)}
+}
+
+// channelEvents returns the dates that became free or were booked out. Dates new
+// to the diff are left out unless the previous check had dates of that month at the refuge, so
+// the first check, a new refuge or a month entering the window don't post their whole calendar.
+func channelEvents(diff parser.RefugeDiff, prev []parser.Refuge) []parser.DateChange {
+	months := make(map[string]bool)
+	for _, rf := range prev {
+		for d := range rf.Dates {
+			if len(d) >= 7 {
+				months[rf.Name+"|"+d[:7]] = true
+			}
+		}
+	}
+	var events []parser.DateChange
+	for _, c := range diff.Appeared() {
+		if c.Old == "" && (len(c.Date) < 7 || !months[c.Refuge+"|"+c.Date[:7]]) {
+			continue
+		}
+		events = append(events, c)
+	}
+	return append(events, diff.Vanished()...)
+}
+
+// postToChannels posts what changed since the previous check to the refuge channels
+func (s *Scheduler) postToChannels(ctx context.Context, diff parser.RefugeDiff) {
+	if s.notify.Post == nil {
+		return
+	}
+	events := channelEvents(diff, s.previous)
+	if len(events) == 0 {
+		return
+	}
+	channels, err := web.RefugeChannels(ctx, s.store)
+	if err != nil {
+		slog.Error("failed to load refuge channels", "error", err)
+	}
+	if n := s.channels.publish(channels, events, s.now(), s.notify); n > 0 {
+		slog.Info("availability changes posted to refuge channels", "messages", n)
+	}
+}
+
+// channelLine is the one-line post about a changed date
+func channelLine(c parser.DateChange) string {
+	if day, err := parser.ParseDay(c.Date, c.New); err == nil && day.Available() {
+		return fmt.Sprintf("🟢 %s · %s: %d places", telegram.EscapeHTML(c.Refuge), c.Date, day.Places)
+	}
+	status := c.New
+	if status == "" {
+		status = "gone"
+	}
+	return fmt.Sprintf("🔴 %s · %s: %s", telegram.EscapeHTML(c.Refuge), c.Date, telegram.EscapeHTML(status))
+}
+
+// publish posts events to the channels of their refuges. A date posted about within
+// channelEditWindow has its message edited instead, and sends over channelPostLimit a minute are
+// dropped. It returns how many messages were posted or edited.
+func (l *channelLog) publish(channels map[string]string, events []parser.DateChange, now time.Time, n Notifier) int {
+	if n.Post == nil {
+		return 0
+	}
+	for k, p := range l.posts {
+		if now.Sub(p.at) >= channelEditWindow {
+			delete(l.posts, k)
+		}
+	}
+	recent := l.sent[:0]
+	for _, at := range l.sent {
+		if now.Sub(at) < time.Minute {
+			recent = append(recent, at)
+		}
+	}
+	l.sent = recent
+
+	sent := 0
+	for _, c := range events {
+		channel := channels[c.Refuge]
+		if channel == "" {
+			continue
+		}
+		key := channelKey{channel: channel, refuge: c.Refuge, date: c.Date}
+		text := channelLine(c)
+		last, ok := l.posts[key]
+		if ok && last.text == text {
+			continue
+		}
+		if len(l.sent) >= channelPostLimit {
+			slog.Warn("refuge channel rate limit hit, dropping update", "channel", channel, "refuge", c.Refuge, "date", c.Date)
+			continue
+		}
+		if ok && n.Edit != nil {
+			err := n.Edit(channel, last.id, text)
+			if err == nil {
+				// the edit window counts from the post, so a flapping date gets a new message now and then
+				l.posts[key] = channelPost{id: last.id, text: text, at: last.at}
+				l.sent = append(l.sent, now)
+				sent++
+				continue
+			}
+			slog.Warn("failed to edit refuge channel post, posting anew", "channel", channel, "message_id", last.id, "error", err)
+		}
+		id, err := n.Post(channel, text)
+		if err != nil {
+			slog.Error("failed to post to refuge channel", "channel", channel, "refuge", c.Refuge, "date", c.Date, "error", err)
+			continue
+		}
+		l.posts[key] = channelPost{id: id, text: text, at: now}
+		l.sent = append(l.sent, now)
+		sent++
+	}
+	return sent
+}
@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+// channelRecorder is a Notifier recording what is posted to and edited in channels
+type channelRecorder struct {
+	posts []string // channel: text
+	edits []string // channel #id: text
+}
+
+func (r *channelRecorder) notifier() Notifier {
+	return Notifier{
+		Post: func(chatID string, message string) (int, error) {
+			r.posts = append(r.posts, chatID+": "+message)
+			return len(r.posts), nil
+		},
+		Edit: func(chatID string, messageID int, message string) error {
+			r.edits = append(r.edits, fmt.Sprintf("%s #%d: %s", chatID, messageID, message))
+			return nil
+		},
+	}
+}
+
+func TestChannelEventsSkipNewMonths(t *testing.T) {
+	prev := []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-08-01": "Full", "2025-08-02": "2"}}}
+	diff := parser.RefugeDiff{
+		Added: []parser.DateChange{
+			{Refuge: "Tête Rousse", Date: "2025-08-03", New: "4"},
+			{Refuge: "Tête Rousse", Date: "2025-09-01", New: "5"},
+			{Refuge: "du Goûter", Date: "2025-08-03", New: "6"},
+		},
+		Changed: []parser.DateChange{
+			{Refuge: "Tête Rousse", Date: "2025-08-01", Old: "Full", New: "1"},
+			{Refuge: "Tête Rousse", Date: "2025-08-02", Old: "2", New: "Full"},
+		},
+	}
+	want := []parser.DateChange{
+		{Refuge: "Tête Rousse", Date: "2025-08-01", Old: "Full", New: "1"},
+		{Refuge: "Tête Rousse", Date: "2025-08-03", New: "4"},
+		{Refuge: "Tête Rousse", Date: "2025-08-02", Old: "2", New: "Full"},
+	}
+	if got := channelEvents(diff, prev); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected only the changes of months already seen, got %+v", got)
+	}
+}
+
+func TestChannelPublishRoutesByRefuge(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	var r channelRecorder
+	channels := map[string]string{"Tête Rousse": "@tete_rousse", "du Goûter": "@gouter"}
+	events := []parser.DateChange{
+		{Refuge: "Tête Rousse", Date: "2025-08-01", Old: "Full", New: "3"},
+		{Refuge: "du Goûter", Date: "2025-08-02", Old: "2", New: "Full"},
+		{Refuge: "Cosmiques", Date: "2025-08-02", Old: "Full", New: "1"},
+	}
+	if n := newChannelLog().publish(channels, events, now, r.notifier()); n != 2 {
+		t.Errorf("expected 2 posts, got %d", n)
+	}
+	want := []string{"@tete_rousse: 🟢 Tête Rousse · 2025-08-01: 3 places", "@gouter: 🔴 du Goûter · 2025-08-02: Full"}
+	if !reflect.DeepEqual(r.posts, want) {
+		t.Errorf("unexpected posts %q", r.posts)
+	}
+}
+
+func TestChannelPublishEditsWithinWindow(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	var r channelRecorder
+	l := newChannelLog()
+	channels := map[string]string{"Tête Rousse": "@tete_rousse"}
+	appeared := []parser.DateChange{{Refuge: "Tête Rousse", Date: "2025-08-01", Old: "Full", New: "3"}}
+	vanished := []parser.DateChange{{Refuge: "Tête Rousse", Date: "2025-08-01", Old: "3", New: "Full"}}
+
+	// the date flaps within the window: one message, edited each time it changes
+	l.publish(channels, appeared, now, r.notifier())
+	l.publish(channels, vanished, now.Add(time.Minute), r.notifier())
+	l.publish(channels, vanished, now.Add(2*time.Minute), r.notifier())
+	l.publish(channels, appeared, now.Add(3*time.Minute), r.notifier())
+	if len(r.posts) != 1 {
+		t.Errorf("expected one post, got %q", r.posts)
+	}
+	wantEdits := []string{"@tete_rousse #1: 🔴 Tête Rousse · 2025-08-01: Full", "@tete_rousse #1: 🟢 Tête Rousse · 2025-08-01: 3 places"}
+	if !reflect.DeepEqual(r.edits, wantEdits) {
+		t.Errorf("unexpected edits %q", r.edits)
+	}
+
+	// past the window from the post, the change is posted anew
+	l.publish(channels, vanished, now.Add(channelEditWindow), r.notifier())
+	if len(r.posts) != 2 || len(r.edits) != 2 {
+		t.Errorf("expected a new post after the edit window, got posts %q edits %q", r.posts, r.edits)
+	}
+}
+
+func TestChannelPublishRateLimit(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	var r channelRecorder
+	l := newChannelLog()
+	var events []parser.DateChange
+	for i := range channelPostLimit + 5 {
+		events = append(events, parser.DateChange{Refuge: "Tête Rousse", Date: fmt.Sprintf("2025-08-%02d", i+1), Old: "Full", New: "1"})
+	}
+	channels := map[string]string{"Tête Rousse": "@tete_rousse"}
+	if n := l.publish(channels, events, now, r.notifier()); n != channelPostLimit {
+		t.Errorf("expected %d posts within the limit, got %d", channelPostLimit, n)
+	}
+	if n := l.publish(channels, events[channelPostLimit:], now.Add(time.Minute), r.notifier()); n != 5 {
+		t.Errorf("expected the dropped updates posted a minute later, got %d", n)
+	}
+}
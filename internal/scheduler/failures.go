@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// failureAction is how the check loop reacts to a failed fetch
+type failureAction int
+
+const (
+	retrySoon   failureAction = iota // transient: the next tick tries again
+	backOff                          // FFCAM wants fewer requests: skip checks for a while
+	alertAdmins                      // needs a human look: admins are told once
+)
+
+// How long checks pause after FFCAM rate limits us or is down for maintenance
+var (
+	rateLimitBackoff   = 5 * time.Minute
+	maintenanceBackoff = 15 * time.Minute
+)
+
+// The waiting room is retried after its estimated wait or, without one, after waitingRoomPerRank
+// per queued visitor ahead of us, between one check interval and waitingRoomMaxDelay
+const (
+	waitingRoomPerRank  = 500 * time.Millisecond
+	waitingRoomMaxDelay = 30 * time.Minute
+)
+
+// waitingRoomDelay is how long to wait before trying the waiting room again
+func waitingRoomDelay(wr *parser.WaitingRoomError) time.Duration {
+	d := wr.ETA
+	if d == 0 {
+		d = time.Duration(wr.Rank) * waitingRoomPerRank
+	}
+	return min(max(d, DefaultInterval), waitingRoomMaxDelay)
+}
+
+// failurePolicy maps a fetch error to the reaction and, for backOff, how long to pause.
+// An expired session is handled by sessionMonitor, which sends its own instructions.
+func failurePolicy(err error) (failureAction, time.Duration) {
+	var wr *parser.WaitingRoomError
+	switch {
+	case errors.As(err, &wr):
+		return backOff, waitingRoomDelay(wr)
+	case errors.Is(err, parser.ErrRateLimited):
+		return backOff, rateLimitBackoff
+	case errors.Is(err, parser.ErrMaintenance):
+		return backOff, maintenanceBackoff
+	case errors.Is(err, parser.ErrEmptyCalendar):
+		return alertAdmins, 0
+	}
+	return retrySoon, 0
+}
+
+// failureMonitor applies failurePolicy to each check: it pauses checks while backing off and
+// alerts admins once when calendars come back empty (likely a changed page layout)
+type failureMonitor struct {
+	notify      func(message string) error // sends to admins
+	pausedUntil time.Time
+	alerted     bool
+}
+
+// paused reports whether checks are backing off at now
+func (m *failureMonitor) paused(now time.Time) bool {
+	return now.Before(m.pausedUntil)
+}
+
+// observe inspects the failures of a check cycle
+func (m *failureMonitor) observe(res parser.Result, now time.Time) {
+	var empty []string
+	for name, err := range res.Errors {
+		switch action, d := failurePolicy(err); action {
+		case backOff:
+			if until := now.Add(d); until.After(m.pausedUntil) {
+				slog.Warn("backing off FFCAM", "for", d, "error", err)
+				m.pausedUntil = until
+			}
+		case alertAdmins:
+			empty = append(empty, name)
+		}
+	}
+	if len(empty) > 0 {
+		if m.alerted {
+			return
+		}
+		sort.Strings(empty)
+		msg := fmt.Sprintf("⚠️ FFCAM returned calendars without any dates for %s at %s UTC. The page layout may have changed; the parser needs a look.",
+			strings.Join(empty, ", "), now.UTC().Format("2006-01-02 15:04:05"))
+		if telegram.SendFailed("empty calendar alert", m.notify(msg)) {
+			return
+		}
+		m.alerted = true
+		return
+	}
+	if m.alerted && len(res.Refuges) > 0 {
+		if telegram.SendFailed("calendars restored message", m.notify(fmt.Sprintf("✅ FFCAM calendars parse again at %s UTC.", now.UTC().Format("2006-01-02 15:04:05")))) {
+			return
+		}
+		m.alerted = false
+	}
+}
+
+// lastErrorClass is the failure class reported on /status: the class of the first failed
+// refuge in name order, or "" when every refuge was fetched
+func lastErrorClass(errs map[string]error) string {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return parser.ErrorClass(errs[names[0]])
+}
+
+// joinErrors joins the per-refuge errors in refuge name order
+func joinErrors(errs map[string]error) error {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	joined := make([]error, 0, len(names))
+	for _, name := range names {
+		joined = append(joined, errs[name])
+	}
+	return errors.Join(joined...)
+}
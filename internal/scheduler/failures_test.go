@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+func TestFailureMonitorBacksOff(t *testing.T) {
+	m := &failureMonitor{notify: func(string) error { t.Fatal("no alert expected"); return nil }}
+	now := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+
+	m.observe(parser.Result{Errors: map[string]error{
+		"Tête Rousse": fmt.Errorf("Tête Rousse 2025-07: %w", &parser.StatusError{Refuge: "Tête Rousse", Code: 429}),
+	}}, now)
+	if !m.paused(now.Add(rateLimitBackoff-time.Second)) || m.paused(now.Add(rateLimitBackoff)) {
+		t.Fatalf("expected a %v back-off after 429, paused until %v", rateLimitBackoff, m.pausedUntil)
+	}
+
+	// maintenance extends the pause; a shorter back-off never shortens it
+	m.observe(parser.Result{Errors: map[string]error{
+		"du Goûter":   fmt.Errorf("du Goûter 2025-07: %w", parser.ErrMaintenance),
+		"Tête Rousse": fmt.Errorf("Tête Rousse 2025-07: %w", &parser.StatusError{Code: 429}),
+	}}, now)
+	if !m.paused(now.Add(maintenanceBackoff - time.Second)) {
+		t.Fatalf("expected a %v back-off for maintenance, paused until %v", maintenanceBackoff, m.pausedUntil)
+	}
+
+	// transient failures retry on the next tick
+	m = &failureMonitor{notify: m.notify}
+	m.observe(parser.Result{Errors: map[string]error{"du Goûter": fmt.Errorf("du Goûter 2025-07: %w", &parser.RetryError{Attempts: 3, Err: &parser.StatusError{Code: 502}})}}, now)
+	if m.paused(now) {
+		t.Fatal("expected no back-off for exhausted retries")
+	}
+}
+
+func TestWaitingRoomDelay(t *testing.T) {
+	cases := []struct {
+		wr   parser.WaitingRoomError
+		want time.Duration
+	}{
+		{parser.WaitingRoomError{}, DefaultInterval},                                 // no rank: next tick
+		{parser.WaitingRoomError{Rank: 57}, DefaultInterval},                         // short queue
+		{parser.WaitingRoomError{Rank: 1482}, 741 * time.Second},                     // proportional to rank
+		{parser.WaitingRoomError{Rank: 100000}, waitingRoomMaxDelay},                 // capped
+		{parser.WaitingRoomError{Rank: 1482, ETA: 4 * time.Minute}, 4 * time.Minute}, // the page's estimate wins
+	}
+	for _, tc := range cases {
+		if got := waitingRoomDelay(&tc.wr); got != tc.want {
+			t.Errorf("waitingRoomDelay(%+v) = %v, want %v", tc.wr, got, tc.want)
+		}
+	}
+
+	m := &failureMonitor{notify: func(string) error { return nil }}
+	now := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	m.observe(parser.Result{Errors: map[string]error{"du Goûter": fmt.Errorf("du Goûter 2025-07: %w", &parser.WaitingRoomError{Rank: 1482})}}, now)
+	if !m.paused(now.Add(12*time.Minute)) || m.paused(now.Add(741*time.Second)) {
+		t.Fatalf("expected checks paused for the waiting room, paused until %v", m.pausedUntil)
+	}
+}
+
+func TestFailureMonitorAlertsOnEmptyCalendars(t *testing.T) {
+	var sent []string
+	m := &failureMonitor{notify: func(msg string) error {
+		sent = append(sent, msg)
+		return nil
+	}}
+	now := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	empty := parser.Result{Errors: map[string]error{
+		"Tête Rousse": fmt.Errorf("Tête Rousse 2025-07: %w", parser.ErrEmptyCalendar),
+		"du Goûter":   fmt.Errorf("du Goûter 2025-07: %w", parser.ErrEmptyCalendar),
+	}}
+
+	m.observe(empty, now)
+	m.observe(empty, now.Add(time.Minute))
+	if len(sent) != 1 || !strings.Contains(sent[0], "Tête Rousse, du Goûter") {
+		t.Fatalf("expected one alert naming both refuges, got %v", sent)
+	}
+	m.observe(parser.Result{Refuges: []parser.Refuge{{Name: "Tête Rousse"}}}, now.Add(2*time.Minute))
+	if len(sent) != 2 || !strings.Contains(sent[1], "parse again") {
+		t.Fatalf("expected a recovery message, got %v", sent)
+	}
+}
+
+func TestLastErrorClass(t *testing.T) {
+	if got := lastErrorClass(nil); got != "" {
+		t.Errorf("expected no class without errors, got %q", got)
+	}
+	errs := map[string]error{
+		"du Goûter":   fmt.Errorf("du Goûter 2025-07: %w", parser.ErrWaitingRoom),
+		"Tête Rousse": fmt.Errorf("Tête Rousse 2025-07: %w", parser.ErrMaintenance),
+	}
+	if got := lastErrorClass(errs); got != "maintenance" {
+		t.Errorf("expected the first refuge's class, got %q", got)
+	}
+}
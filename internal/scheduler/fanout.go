@@ -0,0 +1,459 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+	"github.com/AlexYaroshenko/montblanc/internal/web"
+)
+
+// availability is an available date found by a check, as seen by one subscriber
+type availability struct {
+	refuge string
+	day    parser.DayAvailability
+	before int // places when the date was last announced to the subscriber, 0 for a new date
+	pax    int // group size the date was checked for, 0 for parser.DefaultPax
+}
+
+// dateKey identifies a date at a refuge
+type dateKey struct {
+	refuge string
+	date   string
+}
+
+// unannounced returns the avails sub wasn't alerted about yet, or whose places went up since,
+// with before set from the dates already notified to the subscriber
+func unannounced(avails []availability, notified []store.Notification) []availability {
+	seen := make(map[dateKey]int, len(notified))
+	for _, d := range notified {
+		seen[dateKey{refuge: d.Refuge, date: d.Date}] = d.Places
+	}
+	var mine []availability
+	for _, avail := range avails {
+		before, known := seen[dateKey{refuge: avail.refuge, date: avail.day.Key()}]
+		if known && avail.day.Places <= before {
+			continue
+		}
+		avail.before = before
+		mine = append(mine, avail)
+	}
+	return mine
+}
+
+// anyMatches reports whether a query in qs matches an avail, regardless of what was announced
+func anyMatches(qs []store.Query, avails []availability) bool {
+	for _, avail := range avails {
+		for _, q := range qs {
+			if avail.matches(q) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches reports whether avail was checked for q's group size and is a date of q with enough places
+func (avail availability) matches(q store.Query) bool {
+	return avail.miss(q) == ""
+}
+
+// missRefuge is the miss of a query watching another refuge, which isn't a near miss
+const missRefuge = "refuge"
+
+// miss returns the first condition of q avail fails (missRefuge or a store.Miss* reason), ""
+// when it matches
+func (avail availability) miss(q store.Query) string {
+	pax := avail.pax
+	if pax == 0 {
+		pax = parser.DefaultPax
+	}
+	switch date := avail.day.Key(); {
+	case !q.MatchesRefuge(avail.refuge):
+		return missRefuge
+	case q.GroupSize(parser.DefaultPax) != pax:
+		return store.MissGroupSize
+	case !q.InWindow(date):
+		return store.MissWindow
+	case !q.OnWeekday(date):
+		return store.MissWeekday
+	case !q.HasPlaces(avail.day.Places):
+		return store.MissMinPlaces
+	}
+	return ""
+}
+
+// missOrder ranks the reasons of a near miss, the last ones coming closest to an alert
+var missOrder = []string{store.MissGroupSize, store.MissWindow, store.MissWeekday, store.MissMinPlaces, store.MissAlreadyNotified}
+
+// nearMisses returns why chatID isn't alerted about the avails left out of the alert about dates
+// although qs watch their refuge: the condition failed by the query coming closest to matching,
+// or store.MissAlreadyNotified when one matches. A date is listed once, whatever its group sizes.
+func nearMisses(chatID string, qs []store.Query, avails []availability, dates []alertedDate) []store.MatchDecision {
+	alerted := make(map[dateKey]bool, len(dates))
+	for _, d := range dates {
+		alerted[dateKey{refuge: d.refuge, date: d.date}] = true
+	}
+	var res []store.MatchDecision
+	closest := make(map[dateKey]int) // index in res
+	for _, avail := range avails {
+		key := dateKey{refuge: avail.refuge, date: avail.day.Key()}
+		if alerted[key] {
+			continue
+		}
+		for _, q := range qs {
+			reason := avail.miss(q)
+			if reason == missRefuge {
+				continue
+			}
+			if reason == "" {
+				reason = store.MissAlreadyNotified
+			}
+			d := store.MatchDecision{ChatID: chatID, Refuge: avail.refuge, Date: key.date, QueryID: q.ID, Reason: reason, Places: avail.day.Places}
+			i, seen := closest[key]
+			if !seen {
+				closest[key] = len(res)
+				res = append(res, d)
+			} else if slices.Index(missOrder, reason) > slices.Index(missOrder, res[i].Reason) {
+				res[i] = d
+			}
+		}
+	}
+	return res
+}
+
+// newlyMatches reports whether q wants to hear about avail: a new date with enough places, or
+// a known one whose places only now reach q's minimum
+func (avail availability) newlyMatches(q store.Query) bool {
+	return avail.matches(q) && (avail.before == 0 || !q.HasPlaces(avail.before))
+}
+
+// fanOutStore is the part of the store the availability fan-out reads
+type fanOutStore interface {
+	ListSubscribers(ctx context.Context) ([]store.Subscriber, error)
+	ListAllQueries(ctx context.Context) ([]store.Query, error)
+	ListQueriesByChat(ctx context.Context, chatID string) ([]store.Query, error)
+	ListNotifiedDates(ctx context.Context, chatID string) ([]store.Notification, error)
+}
+
+// alertedDate is a date included in an alert
+type alertedDate struct {
+	refuge string
+	date   string
+	places int
+	pax    int  // group size the places were checked for, 0 for parser.DefaultPax
+	track  bool // matched by a query with NotifyOnGone: follow up when it's booked out again
+}
+
+// deliverFunc sends (or holds, for snoozed subscribers) an alert body about dates to sub; the
+// one-shot queries in done fired with it
+type deliverFunc func(sub store.Subscriber, body string, dates []alertedDate, done []store.Query) error
+
+// activeQueries returns qs without the completed one-shot queries, which match nothing until
+// re-armed
+func activeQueries(qs []store.Query) []store.Query {
+	active := qs[:0:0]
+	for _, q := range qs {
+		if !q.Completed() {
+			active = append(active, q)
+		}
+	}
+	return active
+}
+
+// firedOneShots returns the one-shot queries of qs an alert about avails fires
+func firedOneShots(qs []store.Query, avails []availability) []store.Query {
+	var fired []store.Query
+	for _, q := range qs {
+		if !q.OneShot {
+			continue
+		}
+		for _, avail := range avails {
+			if avail.newlyMatches(q) {
+				fired = append(fired, q)
+				break
+			}
+		}
+	}
+	return fired
+}
+
+// alertFor builds the alert for the availabilities matching qs, grouped by refuge and sorted
+// by date ("" when nothing matches), along with the alerted dates in date order. A date checked
+// for several group sizes is listed once, with the places of the first one matching.
+func alertFor(qs []store.Query, avails []availability, lang string) (string, []alertedDate) {
+	type line struct {
+		refuge string
+		date   string
+		places int
+		before int
+		pax    int
+		track  bool
+	}
+	var lines []line
+	seen := make(map[dateKey]bool)
+	for _, avail := range avails {
+		if seen[dateKey{refuge: avail.refuge, date: avail.day.Key()}] {
+			continue
+		}
+		matched, track := false, false
+		for _, q := range qs {
+			if !avail.newlyMatches(q) {
+				continue
+			}
+			matched = true
+			if q.NotifyOnGone {
+				track = true
+				break
+			}
+		}
+		if matched {
+			seen[dateKey{refuge: avail.refuge, date: avail.day.Key()}] = true
+			lines = append(lines, line{refuge: avail.refuge, date: avail.day.Key(), places: avail.day.Places, before: avail.before, pax: avail.pax, track: track})
+		}
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	// Sort by date and group by refuge
+	sort.Slice(lines, func(i, j int) bool { return lines[i].date < lines[j].date })
+	dates := make([]alertedDate, 0, len(lines))
+	for _, l := range lines {
+		dates = append(dates, alertedDate{refuge: l.refuge, date: l.date, places: l.places, pax: l.pax, track: l.track})
+	}
+	groups := map[string][]string{}
+	for _, l := range lines {
+		places := fmt.Sprintf("%d %s", l.places, i18n.T(lang, "notif_places"))
+		if l.before > 0 {
+			places += " (" + fmt.Sprintf(i18n.T(lang, "notif_up"), l.before) + ")"
+		}
+		// each alerted date is one night
+		if cost := web.CostEstimate(l.refuge, l.pax, 1, lang); cost != "" {
+			places += " · " + cost
+		}
+		groups[l.refuge] = append(groups[l.refuge], fmt.Sprintf("%s: %s · %s", web.DateLink(l.refuge, l.date, lang), places, web.BookNowLink(l.refuge, l.date, lang)))
+	}
+
+	var b strings.Builder
+	// registry order first
+	listed := map[string]bool{}
+	for _, rc := range parser.Refuges() {
+		r := rc.Name
+		listed[r] = true
+		if dates, ok := groups[r]; ok {
+			b.WriteString(fmt.Sprintf("🏔️ %s:\n", telegram.EscapeHTML(r)))
+			for _, d := range dates {
+				b.WriteString("  • " + d + "\n")
+			}
+			b.WriteString("\n")
+		}
+	}
+	// any other refuges (e.g. removed by a reload during this check)
+	for r, dates := range groups {
+		if listed[r] {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("🏔️ %s:\n", telegram.EscapeHTML(r)))
+		for _, d := range dates {
+			b.WriteString("  • " + d + "\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), dates
+}
+
+// alertSent is what sendAlert did with an alert
+type alertSent struct {
+	held    string // store.MissSnoozed, store.MissDigest or store.MissQuietHours when Telegram holds the alert
+	emailed bool
+	chat    bool // sent to Telegram, or held for it
+}
+
+// sendAlert delivers an alert to sub. While a snooze, the daily digest or quiet hours hold it,
+// nothing is emailed and the Telegram message waits. Otherwise it is emailed as emailText when
+// sub has an address, and header+body go to Telegram with send. An email-only subscriber whose
+// email went out gets no Telegram message.
+func (s *Scheduler) sendAlert(ctx context.Context, sub store.Subscriber, header string, body string, emailText string, send func(chatID string, text string) error) (alertSent, error) {
+	var sent alertSent
+	switch {
+	case sub.IsSnoozed(s.now()):
+		sent.held = store.MissSnoozed
+	// the daily and quiet hours digests are Telegram messages: email-only subscribers are
+	// emailed right away
+	case sub.NotifyMode == store.NotifyDigest && !sub.EmailOnly:
+		sent.held = store.MissDigest
+	case !sub.QuietUntil(s.now()).IsZero() && !sub.EmailOnly:
+		sent.held = store.MissQuietHours
+	}
+	// email goes out right away; held alerts catch up in Telegram
+	if sub.Email != "" && s.notify.Email != nil && sent.held == "" {
+		if err := s.notify.Email.Notify(ctx, sub.Email, emailText); err != nil {
+			slog.Error("failed to email alert", "chat_id", sub.ChatID, "error", err)
+		} else {
+			sent.emailed = true
+		}
+	}
+	// email-only subscribers still get Telegram when the email failed
+	if sent.emailed && sub.EmailOnly {
+		return sent, nil
+	}
+	sent.chat = true
+	return sent, web.DeliverOrHold(ctx, s.store, sub, header, body, s.now(), send)
+}
+
+// emailAlert is the plain text email of an alert about dates: the subject line, then one date
+// per line with a link to its refuge page
+func emailAlert(dates []alertedDate, lang string) string {
+	var b strings.Builder
+	b.WriteString(i18n.T(lang, "notif_new") + "\n\n")
+	for _, d := range dates {
+		fmt.Fprintf(&b, "%s · %s: %d %s\n", d.date, d.refuge, d.places, i18n.T(lang, "notif_places"))
+		if cost := web.CostEstimate(d.refuge, d.pax, 1, lang); cost != "" {
+			b.WriteString("  " + cost + "\n")
+		}
+		b.WriteString("  " + web.RefugePageURL(lang, d.refuge, d.date, store.ChannelEmail) + "\n")
+	}
+	return b.String()
+}
+
+// maxRemindButtons caps the "remind me in 30 min" buttons under an alert, one per date
+const maxRemindButtons = 5
+
+// remindButtons is the inline keyboard of an alert about dates
+func remindButtons(dates []alertedDate, lang string) [][]telegram.InlineButton {
+	rows := make([][]telegram.InlineButton, 0, min(len(dates), maxRemindButtons))
+	for _, d := range dates[:min(len(dates), maxRemindButtons)] {
+		rows = append(rows, []telegram.InlineButton{web.RemindButton(d.refuge, d.date, lang, len(dates) > 1)})
+	}
+	return rows
+}
+
+// skippedAlerts tracks the subscribers whose alerts failed because of store errors. Nothing
+// needs carrying over: what a subscriber was alerted about is only marked on delivery, so the
+// next check alerts them again.
+type skippedAlerts struct {
+	notify   func(message string) error // sends to admins
+	pending  []string                   // chat IDs skipped by the latest check
+	reported int                        // skipped count last reported to admins
+}
+
+// fanOut alerts every subscriber with matching queries (completed one-shot queries left out)
+// about the avails of this check they weren't alerted about yet, according to their notified
+// dates, and returns how many were alerted; the dates left out are noted in misses. Subscribers
+// failing with a store error are retried once with freshly loaded queries and notified dates;
+// those still failing are reported to admins.
+func (s *skippedAlerts) fanOut(ctx context.Context, st fanOutStore, avails []availability, shuffle bool, deliver deliverFunc, misses *missLog) int {
+	if len(avails) == 0 {
+		s.pending = nil
+		s.report(0)
+		return 0
+	}
+	subs, err := st.ListSubscribers(ctx)
+	if err != nil {
+		subs, err = st.ListSubscribers(ctx)
+	}
+	var allQueries []store.Query
+	if err == nil {
+		if allQueries, err = st.ListAllQueries(ctx); err != nil {
+			allQueries, err = st.ListAllQueries(ctx)
+		}
+	}
+	if err != nil {
+		slog.Error("failed to list subscribers and queries, alerts deferred to the next check", "error", err)
+		s.report(-1)
+		return 0
+	}
+
+	// group queries by chat once instead of one query per subscriber
+	queriesByChat := make(map[string][]store.Query)
+	for _, q := range allQueries {
+		queriesByChat[q.ChatID] = append(queriesByChat[q.ChatID], q)
+	}
+	if shuffle {
+		rand.Shuffle(len(subs), func(i, j int) { subs[i], subs[j] = subs[j], subs[i] })
+	}
+	alerted := 0
+	// alert builds and delivers the alert of sub, loading its notified dates only when a
+	// query matches at all
+	alert := func(sub store.Subscriber, qs []store.Query) (bool, error) {
+		qs = activeQueries(qs)
+		if !anyMatches(qs, avails) {
+			misses.note(nearMisses(sub.ChatID, qs, avails, nil)...)
+			return false, nil
+		}
+		notified, err := st.ListNotifiedDates(ctx, sub.ChatID)
+		if err != nil {
+			return false, err
+		}
+		mine := unannounced(avails, notified)
+		body, dates := alertFor(qs, mine, i18n.Supported(sub.Language))
+		misses.note(nearMisses(sub.ChatID, qs, avails, dates)...)
+		if body == "" {
+			return false, nil
+		}
+		return true, deliver(sub, body, dates, firedOneShots(qs, mine))
+	}
+	var failed []store.Subscriber
+	for _, sub := range subs {
+		sent, err := alert(sub, queriesByChat[sub.ChatID])
+		if err != nil {
+			slog.Error("failed to notify subscriber", "chat_id", sub.ChatID, "error", err)
+			failed = append(failed, sub)
+			continue
+		}
+		if sent {
+			alerted++
+		}
+	}
+
+	// retry the failed subscribers once, reloading their queries
+	s.pending = nil
+	for _, sub := range failed {
+		qs, err := st.ListQueriesByChat(ctx, sub.ChatID)
+		if err == nil {
+			var sent bool
+			if sent, err = alert(sub, qs); err == nil {
+				if sent {
+					slog.Info("notified subscriber on retry", "chat_id", sub.ChatID)
+					alerted++
+				}
+				continue
+			}
+		}
+		slog.Error("failed to notify subscriber on retry", "chat_id", sub.ChatID, "error", err)
+		s.pending = append(s.pending, sub.ChatID)
+	}
+	s.report(len(s.pending))
+	return alerted
+}
+
+// report logs the subscribers skipped and tells admins (n -1: everyone) when the count changed,
+// so a lasting store outage isn't reported every minute
+func (s *skippedAlerts) report(n int) {
+	if n > 0 {
+		chats := append([]string(nil), s.pending...)
+		sort.Strings(chats)
+		slog.Warn("subscribers skipped due to store errors, retried on the next check", "chat_ids", chats)
+	}
+	if n == s.reported {
+		return
+	}
+	s.reported = n
+	msg := fmt.Sprintf("⚠️ %d subscribers skipped due to store errors; their alerts are retried on the next check", n)
+	switch {
+	case n == 0:
+		return
+	case n < 0:
+		msg = "⚠️ All subscribers skipped due to store errors; their alerts are retried on the next check"
+	}
+	telegram.SendFailed("skipped subscribers report", s.notify(msg))
+}
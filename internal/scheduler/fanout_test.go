@@ -0,0 +1,296 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// flakyFanOutStore fails the store calls touching the chats in failing
+type flakyFanOutStore struct {
+	subs     []store.Subscriber
+	queries  []store.Query
+	failing  map[string]bool
+	down     bool // listing fails for everyone
+	notified []store.Notification
+}
+
+var errStoreDown = errors.New("store unavailable")
+
+func (s *flakyFanOutStore) ListSubscribers(_ context.Context) ([]store.Subscriber, error) {
+	if s.down {
+		return nil, errStoreDown
+	}
+	return append([]store.Subscriber(nil), s.subs...), nil
+}
+
+func (s *flakyFanOutStore) ListAllQueries(_ context.Context) ([]store.Query, error) {
+	if s.down {
+		return nil, errStoreDown
+	}
+	return s.queries, nil
+}
+
+func (s *flakyFanOutStore) ListQueriesByChat(_ context.Context, chatID string) ([]store.Query, error) {
+	if s.failing[chatID] {
+		return nil, errStoreDown
+	}
+	var qs []store.Query
+	for _, q := range s.queries {
+		if q.ChatID == chatID {
+			qs = append(qs, q)
+		}
+	}
+	return qs, nil
+}
+
+func (s *flakyFanOutStore) ListNotifiedDates(_ context.Context, chatID string) ([]store.Notification, error) {
+	var ds []store.Notification
+	for _, d := range s.notified {
+		if d.ChatID == chatID {
+			ds = append(ds, d)
+		}
+	}
+	return ds, nil
+}
+
+// deliver records alerts by chat and marks their dates notified, like RunOnce; held alerts of
+// failing chats can't be stored
+func (s *flakyFanOutStore) deliver(got map[string][]string) deliverFunc {
+	return func(sub store.Subscriber, body string, dates []alertedDate, _ []store.Query) error {
+		if s.failing[sub.ChatID] {
+			return errStoreDown
+		}
+		got[sub.ChatID] = append(got[sub.ChatID], body)
+		for _, d := range dates {
+			s.notified = append(s.notified, store.Notification{ChatID: sub.ChatID, Refuge: d.refuge, Date: d.date, Places: d.places})
+		}
+		return nil
+	}
+}
+
+func newFlakyFanOutStore() *flakyFanOutStore {
+	day := "2025-07-10"
+	return &flakyFanOutStore{
+		subs: []store.Subscriber{{ChatID: "1", IsActive: true}, {ChatID: "2", IsActive: true}, {ChatID: "3", IsActive: true}},
+		queries: []store.Query{
+			{ChatID: "1", Refuge: "Tête Rousse", DateFrom: day, DateTo: day},
+			{ChatID: "2", Refuge: "Tête Rousse", DateFrom: day, DateTo: day},
+			{ChatID: "3", Refuge: "du Goûter", DateFrom: day, DateTo: day},
+		},
+		failing: map[string]bool{},
+	}
+}
+
+func julyTenth() []availability {
+	return []availability{{refuge: "Tête Rousse", day: parser.DayAvailability{Date: time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC), Status: parser.StatusAvailable, Places: 2}}}
+}
+
+func TestFanOutRedeliversSkippedSubscribers(t *testing.T) {
+	st := newFlakyFanOutStore()
+	st.failing["2"] = true
+	var admin []string
+	s := &skippedAlerts{notify: func(msg string) error {
+		admin = append(admin, msg)
+		return nil
+	}}
+	got := map[string][]string{}
+
+	s.fanOut(t.Context(), st, julyTenth(), false, st.deliver(got), nil)
+	if len(got["1"]) != 1 || len(got["2"]) != 0 || len(got["3"]) != 0 {
+		t.Fatalf("expected only chat 1 alerted, got %v", got)
+	}
+	if len(admin) != 1 || !strings.Contains(admin[0], "1 subscribers skipped due to store errors") {
+		t.Fatalf("expected admins told about the skipped subscriber, got %v", admin)
+	}
+
+	// still failing on the next check: skipped again, and admins aren't told again
+	s.fanOut(t.Context(), st, julyTenth(), false, st.deliver(got), nil)
+	if len(got["2"]) != 0 || len(admin) != 1 {
+		t.Fatalf("expected no delivery and no repeated report, got %v / %v", got, admin)
+	}
+
+	// the store recovers: chat 2 gets the alert it missed, exactly once
+	delete(st.failing, "2")
+	s.fanOut(t.Context(), st, julyTenth(), false, st.deliver(got), nil)
+	s.fanOut(t.Context(), st, julyTenth(), false, st.deliver(got), nil)
+	if len(got["2"]) != 1 || !strings.Contains(got["2"][0], "Tête Rousse") || len(got["1"]) != 1 {
+		t.Fatalf("expected the missed alert delivered late once, got %v", got)
+	}
+}
+
+func TestFanOutRetriesWithinTheCheck(t *testing.T) {
+	st := newFlakyFanOutStore()
+	st.failing["2"] = true
+	got := map[string][]string{}
+	s := &skippedAlerts{notify: func(string) error { t.Fatal("no report expected"); return nil }}
+
+	// the store recovers before the end-of-check retry
+	deliver := st.deliver(got)
+	s.fanOut(t.Context(), st, julyTenth(), false, func(sub store.Subscriber, body string, dates []alertedDate, _ []store.Query) error {
+		err := deliver(sub, body, dates, nil)
+		delete(st.failing, sub.ChatID)
+		return err
+	}, nil)
+	if len(got["2"]) != 1 || len(s.pending) != 0 {
+		t.Fatalf("expected chat 2 alerted on retry, got %v, pending %v", got, s.pending)
+	}
+}
+
+func TestFanOutStoreDown(t *testing.T) {
+	st := newFlakyFanOutStore()
+	st.down = true
+	var admin []string
+	s := &skippedAlerts{notify: func(msg string) error {
+		admin = append(admin, msg)
+		return nil
+	}}
+	got := map[string][]string{}
+
+	s.fanOut(t.Context(), st, julyTenth(), false, st.deliver(got), nil)
+	if len(got) != 0 || len(admin) != 1 || !strings.Contains(admin[0], "All subscribers skipped") {
+		t.Fatalf("expected nobody alerted and admins told, got %v / %v", got, admin)
+	}
+
+	st.down = false
+	s.fanOut(t.Context(), st, julyTenth(), false, st.deliver(got), nil)
+	if len(got["1"]) != 1 || len(got["2"]) != 1 || len(got["3"]) != 0 {
+		t.Fatalf("expected matching subscribers alerted late, got %v", got)
+	}
+}
+
+func TestFanOutAlertsLateSubscribers(t *testing.T) {
+	st := newFlakyFanOutStore()
+	s := &skippedAlerts{notify: func(string) error { return nil }}
+	got := map[string][]string{}
+
+	s.fanOut(t.Context(), st, julyTenth(), false, st.deliver(got), nil)
+	// chat 4 subscribes after the date was announced to the others
+	st.subs = append(st.subs, store.Subscriber{ChatID: "4", IsActive: true})
+	st.queries = append(st.queries, store.Query{ChatID: "4", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	s.fanOut(t.Context(), st, julyTenth(), false, st.deliver(got), nil)
+	if len(got["4"]) != 1 || !strings.Contains(got["4"][0], "2025-07-10") {
+		t.Fatalf("expected the late subscriber alerted, got %v", got)
+	}
+	if len(got["1"]) != 1 || len(got["2"]) != 1 {
+		t.Errorf("expected the early subscribers alerted once, got %v", got)
+	}
+}
+
+func TestFanOutKeepsRefugesApartOnTheSameDate(t *testing.T) {
+	st := newFlakyFanOutStore()
+	s := &skippedAlerts{notify: func(string) error { return nil }}
+	got := map[string][]string{}
+
+	// chat 1 follows Tête Rousse, chat 3 du Goûter: the same date opens at one, then the other
+	s.fanOut(t.Context(), st, julyTenth(), false, st.deliver(got), nil)
+	both := append(julyTenth(), availability{refuge: "du Goûter", day: julyTenth()[0].day})
+	s.fanOut(t.Context(), st, both, false, st.deliver(got), nil)
+	if len(got["3"]) != 1 || !strings.Contains(got["3"][0], "du Goûter") {
+		t.Fatalf("expected chat 3 alerted about du Goûter, got %v", got)
+	}
+	if len(got["1"]) != 1 {
+		t.Errorf("expected chat 1 alerted once, got %v", got)
+	}
+}
+
+func TestAlertForEstimatesCostWithANightPrice(t *testing.T) {
+	parser.SetRefuges([]parser.RefugeConfig{
+		{Name: "Tête Rousse", StructureID: "BK_STRUCTURE:29", NightPrice: 62.5},
+		{Name: "du Goûter", StructureID: "BK_STRUCTURE:30"},
+	})
+	t.Cleanup(func() { parser.SetRefuges(nil) })
+
+	qs := []store.Query{{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31", Pax: 2}}
+	avails := []availability{
+		{refuge: "Tête Rousse", day: parser.DayAvailability{Date: time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC), Status: parser.StatusAvailable, Places: 3}, pax: 2},
+		{refuge: "du Goûter", day: parser.DayAvailability{Date: time.Date(2025, 7, 11, 0, 0, 0, 0, time.UTC), Status: parser.StatusAvailable, Places: 3}, pax: 2},
+	}
+	body, _ := alertFor(qs, avails, "en")
+	if !strings.Contains(body, "3 places · 1 night(s) ≈ €125 for 2 people (estimate)") {
+		t.Errorf("expected the Tête Rousse estimate in %q", body)
+	}
+	// no price, no estimate
+	if strings.Count(body, "(estimate)") != 1 {
+		t.Errorf("expected a single estimate in %q", body)
+	}
+}
+
+func TestAlertForEscapesRefugeNames(t *testing.T) {
+	parser.SetRefuges([]parser.RefugeConfig{{Name: "Refuge A&B <Aiguilles>", StructureID: "BK_STRUCTURE:99"}})
+	t.Cleanup(func() { parser.SetRefuges(nil) })
+
+	qs := []store.Query{{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"}}
+	avails := []availability{{refuge: "Refuge A&B <Aiguilles>", day: parser.DayAvailability{Date: time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC), Status: parser.StatusAvailable, Places: 3}}}
+	body, _ := alertFor(qs, avails, "en")
+	if !strings.Contains(body, "🏔️ Refuge A&amp;B &lt;Aiguilles&gt;:") {
+		t.Errorf("expected the refuge name escaped in %q", body)
+	}
+	// Telegram rejects a message whose "&" doesn't start an entity, or whose "<" isn't a tag it knows
+	text := regexp.MustCompile(`&(amp|lt|gt|quot|#[0-9]+);|<a href="[^"<>]*">|</a>`).ReplaceAllString(body, "")
+	if strings.ContainsAny(text, "&<>") {
+		t.Errorf("malformed HTML in %q", body)
+	}
+}
+
+// TestFanOutEndToEnd runs checks against the in-memory store: each alert reaches the matching
+// subscribers once, across checks and for those subscribing late, and is remembered per chat
+func TestFanOutEndToEnd(t *testing.T) {
+	st := store.NewMemory()
+	for _, sub := range []store.Subscriber{
+		{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true},
+		{ChatID: "2", Language: "en", IsActive: true, WeeklyOptOut: true},
+		{ChatID: "3", Language: "en", IsActive: false, WeeklyOptOut: true},
+	} {
+		st.UpsertSubscriber(t.Context(), sub)
+	}
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	st.AddQuery(t.Context(), store.Query{ChatID: "2", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31", MinPlaces: 3})
+	st.AddQuery(t.Context(), store.Query{ChatID: "3", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "2"}}}}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, ffcam.fetch, sent)
+	run := func() {
+		t.Helper()
+		if err := s.RunOnce(context.Background()); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+	}
+
+	// too few places for chat 2, and chat 3 unsubscribed
+	run()
+	if len(sent["1"]) != 1 || len(sent["2"]) != 0 || len(sent["3"]) != 0 {
+		t.Fatalf("expected only chat 1 alerted, got %v", sent)
+	}
+	// another refuge opens: only the new date goes out
+	ffcam.july = append(ffcam.july, parser.Refuge{Name: "du Goûter", Dates: map[string]string{"2025-07-12": "5"}})
+	run()
+	if len(sent["1"]) != 1 || len(sent["2"]) != 1 || !strings.Contains(sent["2"][0], "du Goûter") || strings.Contains(sent["2"][0], "Tête Rousse") {
+		t.Fatalf("expected chat 2 alerted about du Goûter only, got %v", sent)
+	}
+	// chat 4 subscribes once both dates were announced
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "4", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "4", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	run()
+	run()
+	if len(sent["4"]) != 1 || !strings.Contains(sent["4"][0], "2025-07-10") || len(sent["1"]) != 1 || len(sent["2"]) != 1 {
+		t.Fatalf("expected the late subscriber alerted once and nobody else again, got %v", sent)
+	}
+
+	for chatID, want := range map[string]string{"1": "Tête Rousse 2025-07-10", "2": "du Goûter 2025-07-12", "3": "", "4": "Tête Rousse 2025-07-10"} {
+		ds, _ := st.ListNotifiedDates(t.Context(), chatID)
+		var got []string
+		for _, d := range ds {
+			got = append(got, d.Refuge+" "+d.Date)
+		}
+		if strings.Join(got, ",") != want {
+			t.Errorf("chat %s: expected %q remembered, got %q", chatID, want, got)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+// fetchRefugesWindow fetches availability for a group of pax for multiple month anchors and merges
+// the results. Per-refuge failures are collected in Result.Errors; refuges that succeeded for any
+// anchor are kept.
+func (s *Scheduler) fetchRefugesWindow(monthAnchors []time.Time, pax int) parser.Result {
+	// fetch the months concurrently, at most s.Concurrency at a time (the parser's rate
+	// limiter still spaces out the requests themselves)
+	results := make([]parser.Result, len(monthAnchors))
+	sem := make(chan struct{}, max(s.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, anchor := range monthAnchors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			res, err := s.fetch(s.url, anchor, pax)
+			if err != nil {
+				slog.Warn("availability fetch failed", "month", anchor.Format("2006-01"), "error", err)
+			}
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+
+	// merge in anchor order, so later anchors overwrite earlier date entries as before
+	merged := make(map[string]parser.Refuge)
+	failures := make(map[string]error)
+	for _, res := range results {
+		// the parser's errors already name the refuge and month
+		for name, ferr := range res.Errors {
+			failures[name] = ferr
+		}
+		for _, rf := range res.Refuges {
+			if existing, ok := merged[rf.Name]; ok {
+				// merge dates
+				for d, s := range rf.Dates {
+					existing.Dates[d] = s
+				}
+				merged[rf.Name] = existing
+			} else {
+				// copy to avoid aliasing
+				copyDates := make(map[string]string, len(rf.Dates))
+				for d, s := range rf.Dates {
+					copyDates[d] = s
+				}
+				merged[rf.Name] = parser.Refuge{Name: rf.Name, Dates: copyDates}
+			}
+		}
+	}
+	// flatten
+	out := make([]parser.Refuge, 0, len(merged))
+	for _, rf := range merged {
+		out = append(out, rf)
+	}
+	return parser.Result{Refuges: out, Errors: failures}
+}
+
+// groupAvailabilities checks the window again for every group size other than parser.DefaultPax
+// that a query asks for, FFCAM answering per group size, and returns the available dates. Each
+// size costs a full window of requests; failures are only logged, the default check being the
+// one the monitors and the web state follow.
+func (s *Scheduler) groupAvailabilities(ctx context.Context, monthAnchors []time.Time) []availability {
+	queries, err := s.store.ListAllQueries(ctx)
+	if err != nil {
+		slog.Error("failed to list queries for group sizes", "error", err)
+		return nil
+	}
+	sizes := make(map[int]bool)
+	for _, q := range queries {
+		if pax := q.GroupSize(parser.DefaultPax); pax != parser.DefaultPax {
+			sizes[pax] = true
+		}
+	}
+	paxes := make([]int, 0, len(sizes))
+	for pax := range sizes {
+		paxes = append(paxes, pax)
+	}
+	sort.Ints(paxes)
+
+	var avails []availability
+	for _, pax := range paxes {
+		res := s.fetchRefugesWindow(monthAnchors, pax)
+		for name, ferr := range res.Errors {
+			slog.Warn("failed to check availability for group size", "refuge", name, "pax", pax, "error", ferr)
+		}
+		for _, refuge := range res.Refuges {
+			for _, day := range refuge.Days() {
+				if day.Available() {
+					avails = append(avails, availability{refuge: refuge.Name, day: day, pax: pax})
+				}
+			}
+		}
+	}
+	return avails
+}
@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestFetchRefugesWindowConcurrent(t *testing.T) {
+	anchors := []time.Time{
+		time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	var inFlight, peak atomic.Int32
+	fetch := func(_ string, anchor time.Time, _ int) (parser.Result, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		// finish in reverse order so the merge can't rely on completion order
+		time.Sleep(time.Duration(12-anchor.Month()) * 5 * time.Millisecond)
+		switch anchor.Month() {
+		case time.August:
+			return parser.Result{Errors: map[string]error{"Refuge du Goûter": errors.New("boom")}}, errors.New("partial")
+		case time.October:
+			return parser.Result{Refuges: []parser.Refuge{{Name: "Refuge du Goûter", Dates: map[string]string{"2025-09-30": "3"}}}}, nil
+		}
+		return parser.Result{Refuges: []parser.Refuge{{Name: "Refuge du Goûter", Dates: map[string]string{
+			"2025-09-30":                "1",
+			anchor.Format("2006-01-02"): "5",
+		}}}}, nil
+	}
+
+	s := New("http://ffcam.test", nil, fetch, Notifier{})
+	s.Concurrency = 2
+	res := s.fetchRefugesWindow(anchors, 1)
+
+	if p := peak.Load(); p > 2 {
+		t.Fatalf("expected at most 2 concurrent fetches, got %d", p)
+	}
+	if len(res.Refuges) != 1 {
+		t.Fatalf("expected one merged refuge, got %+v", res.Refuges)
+	}
+	dates := res.Refuges[0].Dates
+	if dates["2025-07-01"] != "5" || dates["2025-09-01"] != "5" {
+		t.Fatalf("expected dates from every successful anchor, got %v", dates)
+	}
+	// the October anchor comes last, so it wins even though it finished first
+	if dates["2025-09-30"] != "3" {
+		t.Fatalf("expected later anchor to overwrite, got %q", dates["2025-09-30"])
+	}
+	if err := res.Errors["Refuge du Goûter"]; err == nil || err.Error() != "boom" {
+		t.Fatalf("expected August failure to be reported, got %v", err)
+	}
+}
+
+func TestRunOnceChecksQueryGroupSizes(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "2", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	st.AddQuery(t.Context(), store.Query{ChatID: "2", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", Pax: 3})
+
+	// 2025-07-10 fits one climber but not a group of 3
+	var mu sync.Mutex
+	paxes := map[int]int{}
+	fetch := func(_ string, anchor time.Time, pax int) (parser.Result, error) {
+		mu.Lock()
+		paxes[pax]++
+		mu.Unlock()
+		if anchor.Month() != time.July {
+			return parser.Result{Errors: map[string]error{}}, nil
+		}
+		dates := map[string]string{"2025-07-10": "1", "2025-07-12": "4"}
+		if pax == 3 {
+			dates["2025-07-10"] = "Full"
+		}
+		return parser.Result{Refuges: []parser.Refuge{{Name: "Tête Rousse", Dates: dates}}, Errors: map[string]error{}}, nil
+	}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, fetch, sent)
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if paxes[1] != 3 || paxes[3] != 3 {
+		t.Errorf("expected the window checked for 1 and 3, got %v", paxes)
+	}
+	if len(sent["1"]) != 1 || !strings.Contains(sent["1"][0], "2025-07-10") {
+		t.Errorf("expected chat 1 alerted about 2025-07-10, got %q", sent["1"])
+	}
+	if len(sent["2"]) != 1 || strings.Contains(sent["2"][0], "2025-07-10") || !strings.Contains(sent["2"][0], "2025-07-12") {
+		t.Errorf("expected chat 2 alerted about 2025-07-12 only, got %q", sent["2"])
+	}
+}
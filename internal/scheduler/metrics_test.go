@@ -0,0 +1,30 @@
+package scheduler
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/metrics"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+func TestRecordCheckMetrics(t *testing.T) {
+	recordCheckMetrics(parser.Result{
+		Refuges: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-08-01": "3", "2025-08-02": "Full"}}},
+		Errors:  map[string]error{"du Goûter": errors.New("boom")},
+	})
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`montblanc_checks_total{result="partial"} 1`,
+		`montblanc_dates_found{refuge="Tête Rousse"} 2`,
+		`montblanc_dates_found{refuge="du Goûter"} 0`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("expected %q in /metrics output", line)
+		}
+	}
+}
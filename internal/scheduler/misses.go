@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// missKey identifies the near miss of a date at a refuge for a chat
+type missKey struct {
+	chatID string
+	refuge string
+	date   string
+}
+
+// missLog collects the near misses of a check: the dates at a refuge a subscriber's queries
+// watch that they weren't alerted about, with why. Only the reasons new since the previous check
+// are stored, so a date missed for the same reason check after check is recorded once.
+type missLog struct {
+	last  map[missKey]string // reasons of the previous check
+	check map[missKey]store.MatchDecision
+}
+
+func newMissLog() *missLog {
+	return &missLog{last: make(map[missKey]string), check: make(map[missKey]store.MatchDecision)}
+}
+
+// note adds decisions of the current check; a nil log drops them
+func (l *missLog) note(ds ...store.MatchDecision) {
+	if l == nil {
+		return
+	}
+	for _, d := range ds {
+		l.check[missKey{chatID: d.ChatID, refuge: d.Refuge, date: d.Date}] = d
+	}
+}
+
+// flush stores the decisions of the current check whose reason is new, as checked at now, and
+// starts the next check. Decisions failing to be stored are tried again by the next check.
+func (l *missLog) flush(ctx context.Context, st store.Store, now time.Time) {
+	if l == nil {
+		return
+	}
+	reasons := make(map[missKey]string, len(l.check))
+	var changed []store.MatchDecision
+	for k, d := range l.check {
+		// the dates of a held alert count as notified from the next check on
+		if last := l.last[k]; d.Reason == store.MissAlreadyNotified && (last == store.MissSnoozed || last == store.MissDigest || last == store.MissQuietHours) {
+			d.Reason = last
+		}
+		reasons[k] = d.Reason
+		if l.last[k] != d.Reason {
+			d.CheckedAt = now
+			changed = append(changed, d)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		a, b := changed[i], changed[j]
+		if a.ChatID != b.ChatID {
+			return a.ChatID < b.ChatID
+		}
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return a.Refuge < b.Refuge
+	})
+	if err := st.RecordMatchDecisions(ctx, changed); err != nil {
+		slog.Error("failed to record near misses", "decisions", len(changed), "error", err)
+		for _, d := range changed {
+			delete(reasons, missKey{chatID: d.ChatID, refuge: d.Refuge, date: d.Date})
+		}
+	}
+	l.last, l.check = reasons, make(map[missKey]store.MatchDecision)
+}
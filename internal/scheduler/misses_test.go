@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestRunOnceRecordsEachNearMissOnce(t *testing.T) {
+	st := store.NewMemory()
+	snoozed := time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC)
+	for chatID, q := range map[string]store.Query{
+		"window":   {Refuge: "Tête Rousse", DateFrom: "2025-08-01", DateTo: "2025-08-31"},
+		"weekday":  {Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", Weekdays: store.WeekdaysOf(time.Monday)},
+		"places":   {Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", MinPlaces: 5},
+		"snoozed":  {Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"},
+		"quiet":    {Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"},
+		"notified": {Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"},
+		"other":    {Refuge: "du Goûter", DateFrom: "2025-07-01", DateTo: "2025-07-31"},
+	} {
+		sub := store.Subscriber{ChatID: chatID, Language: "en", IsActive: true, WeeklyOptOut: true}
+		switch chatID {
+		case "snoozed":
+			sub.SnoozedUntil = snoozed
+		case "quiet":
+			sub.QuietFrom, sub.QuietTo = "06:00", "09:00"
+		}
+		st.UpsertSubscriber(t.Context(), sub)
+		q.ChatID = chatID
+		st.AddQuery(t.Context(), q)
+	}
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}}}}
+	s := newTestScheduler(st, ffcam.fetch, map[string][]string{})
+	for range 3 {
+		if err := s.RunOnce(context.Background()); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+	}
+
+	got := map[string][]string{}
+	subs, _ := st.PageSubscribers(t.Context(), "", 10)
+	for _, sub := range subs {
+		ds, _ := st.ListMatchDecisions(t.Context(), sub.ChatID, "2025-07-10")
+		for _, d := range ds {
+			if d.Refuge != "Tête Rousse" || d.Date != "2025-07-10" || d.Places != 3 {
+				t.Errorf("unexpected decision %+v", d)
+			}
+			got[d.ChatID] = append(got[d.ChatID], d.Reason)
+		}
+	}
+	want := "map[notified:[already_notified] places:[min_places] quiet:[quiet_hours] snoozed:[snoozed] weekday:[weekday] window:[date_window]]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("decisions %v, want %v", got, want)
+	}
+}
+
+func TestRunOnceRecordsChangedNearMissReasons(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", MinPlaces: 2})
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "1"}}}}
+	s := newTestScheduler(st, ffcam.fetch, map[string][]string{})
+	for _, places := range []string{"1", "1", "2", "2", "1"} {
+		ffcam.july[0].Dates["2025-07-10"] = places
+		if err := s.RunOnce(context.Background()); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+	}
+	// too few places, alerted at 2 places, then known with too few places again
+	var reasons []string
+	ds, _ := st.ListMatchDecisions(t.Context(), "1", "2025-07-10")
+	for _, d := range ds {
+		reasons = append(reasons, fmt.Sprintf("%s@%d", d.Reason, d.Places))
+	}
+	if fmt.Sprint(reasons) != "[min_places@1 already_notified@2 min_places@1]" {
+		t.Errorf("unexpected decisions %v", reasons)
+	}
+}
+
+func TestNearMissesPicksTheClosestQuery(t *testing.T) {
+	day := func(places int) parser.DayAvailability {
+		return parser.DayAvailability{Date: time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC), Places: places}
+	}
+	qs := []store.Query{
+		{ID: "aug", Refuge: "Tête Rousse", DateFrom: "2025-08-01", DateTo: "2025-08-31"},
+		{ID: "five", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", MinPlaces: 5},
+		{ID: "goûter", Refuge: "du Goûter"},
+	}
+	// the date was checked for two group sizes: listed once, with its closest miss
+	avails := []availability{{refuge: "Tête Rousse", day: day(3), pax: 4}, {refuge: "Tête Rousse", day: day(3)}}
+	got := nearMisses("1", qs, avails, nil)
+	if len(got) != 1 || got[0].Reason != store.MissMinPlaces || got[0].QueryID != "five" || got[0].ChatID != "1" {
+		t.Errorf("unexpected near misses %+v", got)
+	}
+
+	// a query for another group size
+	got = nearMisses("1", []store.Query{{ID: "four", Refuge: "*", Pax: 4}}, avails[1:], nil)
+	if len(got) != 1 || got[0].Reason != store.MissGroupSize {
+		t.Errorf("expected a group size miss, got %+v", got)
+	}
+	// alerted dates and other refuges aren't near misses
+	if got := nearMisses("1", qs[2:], avails, nil); len(got) != 0 {
+		t.Errorf("expected no near miss at another refuge, got %+v", got)
+	}
+	if got := nearMisses("1", qs, avails, []alertedDate{{refuge: "Tête Rousse", date: "2025-07-10"}}); len(got) != 0 {
+		t.Errorf("expected no near miss of an alerted date, got %+v", got)
+	}
+}
@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+func TestRunOnceCompletesOneShotQueries(t *testing.T) {
+	st := store.NewMemory()
+	for _, chatID := range []string{"once", "always"} {
+		st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: chatID, Language: "en", IsActive: true, WeeklyOptOut: true})
+	}
+	id, _ := st.AddQuery(t.Context(), store.Query{ChatID: "once", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", OneShot: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "always", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{}}}}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, ffcam.fetch, sent)
+	var callbacks []string
+	s.notify.Buttons = func(chatID string, message string, rows [][]telegram.InlineButton) error {
+		sent[chatID] = append(sent[chatID], message)
+		for _, row := range rows {
+			for _, b := range row {
+				callbacks = append(callbacks, b.CallbackData)
+			}
+		}
+		return nil
+	}
+	check := func(dates map[string]string) (once []string, always []string) {
+		t.Helper()
+		clear(sent)
+		ffcam.july[0].Dates = dates
+		if err := s.RunOnce(context.Background()); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+		return sent["once"], sent["always"]
+	}
+	status := func() string {
+		q, _ := st.GetQuery(t.Context(), id)
+		return q.Status
+	}
+
+	// the first alert completes the query and offers to re-arm it
+	once, always := check(map[string]string{"2025-07-10": "3"})
+	if len(once) != 2 || !strings.Contains(once[0], "2025-07-10") || !strings.Contains(once[1], "one-time alert has done its job") || len(always) != 1 {
+		t.Fatalf("expected the alert and the completion notice, got %q and %q", once, always)
+	}
+	if status() != store.QueryCompleted || !strings.Contains(strings.Join(callbacks, " "), "rearm:"+id) {
+		t.Fatalf("expected the query completed with a re-arm button, got %q and %v", status(), callbacks)
+	}
+	// completed queries match nothing
+	once, always = check(map[string]string{"2025-07-10": "3", "2025-07-11": "2"})
+	if len(once) != 0 || len(always) != 1 {
+		t.Fatalf("expected only the ongoing query alerted, got %q and %q", once, always)
+	}
+
+	// re-armed, the date it was alerted about stays quiet; the next new date fires it again
+	st.SetQueryStatus(t.Context(), id, store.QueryActive)
+	once, _ = check(map[string]string{"2025-07-10": "5"})
+	if len(once) != 0 || status() != store.QueryActive {
+		t.Fatalf("expected no alert about an already alerted date, got %q (%s)", once, status())
+	}
+	once, _ = check(map[string]string{"2025-07-10": "5", "2025-07-12": "1"})
+	if len(once) != 2 || !strings.Contains(once[0], "2025-07-12") || strings.Contains(once[0], "2025-07-10") || status() != store.QueryCompleted {
+		t.Errorf("expected the re-armed query fired about the new date and completed again, got %q (%s)", once, status())
+	}
+}
+
+func TestFiredOneShots(t *testing.T) {
+	avail := availability{refuge: "Tête Rousse", day: parser.DayAvailability{Date: time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC), Status: parser.StatusAvailable, Places: 3}}
+	qs := []store.Query{
+		{ID: "match", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31", OneShot: true},
+		{ID: "ongoing", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"},
+		{ID: "too few", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31", MinPlaces: 4, OneShot: true},
+	}
+	fired := firedOneShots(qs, []availability{avail})
+	if len(fired) != 1 || fired[0].ID != "match" {
+		t.Errorf("expected the matching one-shot query alone, got %+v", fired)
+	}
+	completed := append(qs, store.Query{ID: "done", Status: store.QueryCompleted})
+	if active := activeQueries(completed); len(active) != 3 {
+		t.Errorf("expected the completed query left out, got %+v", active)
+	}
+}
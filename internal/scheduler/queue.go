@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/metrics"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// outbox is the part of the store used to persist messages that couldn't be sent and to record
+// the alerts delivered
+type outbox interface {
+	EnqueueMessage(ctx context.Context, m store.OutboxMessage) error
+	RecordNotification(ctx context.Context, n store.Notification) error
+}
+
+// deliveryQueue collects the messages of one check cycle so shutdown can either
+// drain them or persist the rest to the outbox
+type deliveryQueue struct {
+	mu       sync.Mutex
+	pending  []queuedMessage
+	flushed  int
+	deferred int
+}
+
+// queuedMessage is a message waiting in the queue with its inline keyboard, if any, and the
+// notifications recorded once it is delivered; the keyboard is dropped when the message is
+// deferred to the outbox
+type queuedMessage struct {
+	store.OutboxMessage
+	buttons [][]telegram.InlineButton
+	records []store.Notification
+}
+
+// add queues an availability alert; it sends like Notifier.sendTo
+func (q *deliveryQueue) add(chatID string, text string) error {
+	return q.withButtons(nil)(chatID, text)
+}
+
+// withButtons returns an add that queues the alert with the inline keyboard rows
+func (q *deliveryQueue) withButtons(rows [][]telegram.InlineButton) func(chatID string, text string) error {
+	return q.recording(rows, nil)
+}
+
+// recording returns an add that queues the alert with the inline keyboard rows and the
+// notifications to record once it is sent or deferred to the outbox
+func (q *deliveryQueue) recording(rows [][]telegram.InlineButton, records []store.Notification) func(chatID string, text string) error {
+	return func(chatID string, text string) error {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.pending = append(q.pending, queuedMessage{
+			OutboxMessage: store.OutboxMessage{ChatID: chatID, Text: text, Kind: store.KindAlert, CreatedAt: time.Now()},
+			buttons:       rows,
+			records:       records,
+		})
+		return nil
+	}
+}
+
+// flush sends queued messages with n until ctx is cancelled; the remaining ones (and the one
+// interrupted by cancellation) are persisted to the outbox for delivery after restart
+func (q *deliveryQueue) flush(ctx context.Context, ob outbox, n Notifier) {
+	// persisting is what cancellation leaves to do, so it isn't cancelled along
+	persist := context.WithoutCancel(ctx)
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	for i, qm := range pending {
+		m := qm.OutboxMessage
+		if ctx.Err() == nil {
+			var err error
+			if len(qm.buttons) > 0 && n.Buttons != nil {
+				err = n.Buttons(m.ChatID, m.Text, qm.buttons)
+			} else {
+				err = n.Chat.Notify(ctx, m.ChatID, m.Text)
+			}
+			if err == nil {
+				metrics.NotificationsSent.WithLabelValues(m.Kind).Inc()
+				record(persist, ob, qm.records)
+				q.mu.Lock()
+				q.flushed++
+				q.mu.Unlock()
+				continue
+			}
+			if ctx.Err() == nil {
+				slog.Error("failed to notify subscriber", "chat_id", m.ChatID, "error", err)
+				continue
+			}
+		}
+		m.ID = fmt.Sprintf("deferred-%s-%d-%d", m.ChatID, time.Now().UnixNano(), i)
+		m.DeliverAfter = time.Now()
+		// expiry counts from when the alert was produced, not from when it was deferred
+		m.ExpiresAt = store.ExpiryFor(m.Kind, m.CreatedAt)
+		if err := ob.EnqueueMessage(persist, m); err != nil {
+			slog.Error("failed to defer message to the outbox", "chat_id", m.ChatID, "error", err)
+			continue
+		}
+		// delivered from the outbox after restart: recorded now so it isn't alerted again
+		record(persist, ob, qm.records)
+		q.mu.Lock()
+		q.deferred++
+		q.mu.Unlock()
+	}
+}
+
+// record writes the notifications of a delivered alert, stamped with the time it was sent
+func record(ctx context.Context, ob outbox, records []store.Notification) {
+	now := time.Now()
+	for _, n := range records {
+		n.SentAt = now
+		if err := ob.RecordNotification(ctx, n); err != nil {
+			slog.Error("failed to record notification", "chat_id", n.ChatID, "refuge", n.Refuge, "date", n.Date, "error", err)
+		}
+	}
+}
+
+// stats returns how many messages were sent and how many were deferred to the outbox
+func (q *deliveryQueue) stats() (flushed int, deferred int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.flushed, q.deferred
+}
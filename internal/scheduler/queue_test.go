@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+type memOutbox struct {
+	mu   sync.Mutex
+	msgs []store.OutboxMessage
+	sent []store.Notification
+}
+
+// like a real store, memOutbox fails calls under a cancelled context
+func (o *memOutbox) EnqueueMessage(ctx context.Context, m store.OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.msgs = append(o.msgs, m)
+	return nil
+}
+
+func (o *memOutbox) RecordNotification(ctx context.Context, n store.Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, n)
+	return nil
+}
+
+func TestFlushDefersOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := &deliveryQueue{}
+	for _, id := range []string{"1", "2", "3"} {
+		q.add(id, "availability for "+id)
+	}
+	ob := &memOutbox{}
+
+	// the first send succeeds, the second is interrupted by the cancellation
+	var sent []string
+	send := func(_ context.Context, chatID string, text string) error {
+		if len(sent) == 0 {
+			sent = append(sent, chatID)
+			return nil
+		}
+		cancel()
+		return errors.New("cancelled")
+	}
+	q.flush(ctx, ob, Notifier{Chat: notify.Func(send)})
+
+	flushed, deferred := q.stats()
+	if flushed != 1 || deferred != 2 {
+		t.Errorf("expected 1 flushed and 2 deferred, got %d and %d", flushed, deferred)
+	}
+	if len(ob.msgs) != 2 || ob.msgs[0].ChatID != "2" || ob.msgs[1].ChatID != "3" {
+		t.Fatalf("expected messages for chats 2 and 3 in outbox, got %+v", ob.msgs)
+	}
+	if ob.msgs[0].ID == ob.msgs[1].ID || ob.msgs[0].DeliverAfter.IsZero() {
+		t.Errorf("deferred messages need unique IDs and a delivery time: %+v", ob.msgs)
+	}
+	for _, m := range ob.msgs {
+		if m.Kind != store.KindAlert || !m.ExpiresAt.Equal(m.CreatedAt.Add(store.AlertTTL)) {
+			t.Errorf("deferred alerts must expire %v after they were produced: %+v", store.AlertTTL, m)
+		}
+	}
+}
+
+func TestFlushDropsFailedSendsWhileRunning(t *testing.T) {
+	q := &deliveryQueue{}
+	q.add("1", "a")
+	ob := &memOutbox{}
+	q.flush(context.Background(), ob, Notifier{Chat: notify.Func(func(context.Context, string, string) error { return errors.New("blocked by user") })})
+	flushed, deferred := q.stats()
+	if flushed != 0 || deferred != 0 || len(ob.msgs) != 0 {
+		t.Errorf("failed sends outside shutdown must not be deferred, got %d/%d %v", flushed, deferred, ob.msgs)
+	}
+}
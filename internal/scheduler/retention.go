@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/metrics"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// retentionBatch is how many rows one purge statement deletes at most, so no table is locked
+// for long
+const retentionBatch = 500
+
+// purgeExpired deletes the rows of each store.RetentionPolicies table older than its retention,
+// retentionBatch at a time, and returns how many rows went per table
+func purgeExpired(ctx context.Context, st store.Store, now time.Time) map[string]int {
+	purged := make(map[string]int)
+	for _, p := range store.RetentionPolicies {
+		for {
+			n, err := st.PurgeExpired(ctx, p, now.Add(-p.Keep()), retentionBatch)
+			purged[p.Table] += n
+			if err != nil {
+				slog.Error("failed to purge expired data", "table", p.Table, "error", err)
+				break
+			}
+			if n < retentionBatch {
+				break
+			}
+		}
+		if n := purged[p.Table]; n > 0 {
+			metrics.RetentionPurged.WithLabelValues(p.Table).Add(float64(n))
+			slog.Info("purged expired data", "table", p.Table, "rows", n, "retention_days", p.Days)
+		}
+	}
+	return purged
+}
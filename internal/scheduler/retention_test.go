@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/metrics"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestPurgeExpiredInBatches(t *testing.T) {
+	now := time.Date(2025, 7, 1, 3, 0, 0, 0, time.UTC)
+	st := store.NewMemory()
+	var ds []store.MatchDecision
+	for i := range retentionBatch + 1 {
+		ds = append(ds, store.MatchDecision{ChatID: "1", Refuge: "du Goûter", Date: "2025-06-01", Reason: store.MissMinPlaces, CheckedAt: now.Add(-15*24*time.Hour - time.Duration(i)*time.Minute)})
+	}
+	ds = append(ds, store.MatchDecision{ChatID: "1", Refuge: "du Goûter", Date: "2025-06-01", Reason: store.MissSnoozed, CheckedAt: now.Add(-time.Hour)})
+	st.RecordMatchDecisions(t.Context(), ds)
+
+	// more than one batch goes, the decision of the last check stays
+	if purged := purgeExpired(t.Context(), st, now); purged["match_decisions"] != retentionBatch+1 {
+		t.Errorf("expected %d decisions purged, got %v", retentionBatch+1, purged)
+	}
+	if left, _ := st.ListMatchDecisions(t.Context(), "1", "2025-06-01"); len(left) != 1 || left[0].Reason != store.MissSnoozed {
+		t.Errorf("expected the fresh decision kept, got %+v", left)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `montblanc_retention_purged_total{table="match_decisions"} 501`+"\n") {
+		t.Error("expected the purged decisions counted in /metrics")
+	}
+}
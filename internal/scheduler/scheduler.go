@@ -0,0 +1,412 @@
+// Package scheduler runs the availability check cycle: fetch the refuges, compare them with the
+// previous check and notify the subscribers whose queries match
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/featureflags"
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/metrics"
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+	"github.com/AlexYaroshenko/montblanc/internal/web"
+)
+
+// Defaults of the check loop (CHECK_INTERVAL, WINDOW_MONTHS)
+const (
+	DefaultInterval     = 1 * time.Minute
+	DefaultWindowMonths = 3
+)
+
+// FetchFunc fetches the availability of every refuge for the month of anchor and a group of
+// pax, like parser.ParseRefugeAvailability
+type FetchFunc func(refugeURL string, anchor time.Time, pax int) (parser.Result, error)
+
+// Notifier sends the messages of a check cycle
+type Notifier struct {
+	Admins func(message string) error // to the admin chats (TELEGRAM_CHAT_IDS)
+	Chat   notify.Notifier            // to one chat
+	// Buttons sends to one chat with an inline keyboard; when nil, Chat sends without it
+	Buttons func(chatID string, message string, rows [][]telegram.InlineButton) error
+	// Email sends alerts to subscribers with an email address; nil when SMTP isn't configured
+	Email notify.Notifier
+	// Post sends to a refuge channel and returns the message ID, Edit replaces a message sent
+	// with it; availability changes aren't posted to channels when Post is nil
+	Post func(chatID string, message string) (int, error)
+	Edit func(chatID string, messageID int, message string) error
+}
+
+// sendTo adapts Chat to the plain send functions of the per-chat helpers
+func (n Notifier) sendTo(ctx context.Context) func(chatID string, message string) error {
+	return func(chatID string, message string) error {
+		return n.Chat.Notify(ctx, chatID, message)
+	}
+}
+
+// Scheduler carries the state kept across check cycles: the admin monitors and what the previous
+// check saw. The dates each subscriber was alerted about are kept in the store.
+type Scheduler struct {
+	// Concurrency bounds how many month anchors are fetched at once (FFCAM_FETCH_CONCURRENCY)
+	Concurrency int
+	// WindowMonths is how many months are checked, starting with the current one (WINDOW_MONTHS)
+	WindowMonths int
+	// SnapshotRetention is how long date snapshots are kept (SNAPSHOT_RETENTION_DAYS), 0 forever
+	SnapshotRetention time.Duration
+
+	url    string
+	store  store.Store
+	fetch  FetchFunc
+	notify Notifier
+	now    func() time.Time
+
+	session  *sessionMonitor
+	breaker  *breakerMonitor
+	failures *failureMonitor
+	skipped  *skippedAlerts
+	misses   *missLog
+	week     *weekLog
+	channels *channelLog
+	previous []parser.Refuge // what the last check saw, for windowDiff
+	pruned   string          // day the notification history and date snapshots were last pruned
+
+	mu    sync.Mutex
+	queue *deliveryQueue // messages of the latest cycle
+}
+
+// New returns a scheduler checking refugeURL with fetch; alerts go to the subscribers in st
+func New(refugeURL string, st store.Store, fetch FetchFunc, n Notifier) *Scheduler {
+	return &Scheduler{
+		Concurrency:  3,
+		WindowMonths: DefaultWindowMonths,
+		url:          refugeURL,
+		store:        st,
+		fetch:        fetch,
+		notify:       n,
+		now:          time.Now,
+		session:      &sessionMonitor{notify: n.Admins},
+		breaker:      &breakerMonitor{notify: n.Admins},
+		failures:     &failureMonitor{notify: n.Admins},
+		skipped:      &skippedAlerts{notify: n.Admins},
+		misses:       newMissLog(),
+		week:         newWeekLog(),
+		channels:     newChannelLog(),
+	}
+}
+
+// anchors returns the rolling window checked: the current month and the following ones,
+// WindowMonths in all
+func (s *Scheduler) anchors() []time.Time {
+	now := s.now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	anchors := make([]time.Time, 0, s.WindowMonths)
+	for i := 0; i < s.WindowMonths; i++ {
+		anchors = append(anchors, monthStart.AddDate(0, i, 0))
+	}
+	return anchors
+}
+
+// Baseline runs the startup check: the monitors and the next diff see its result, but nobody
+// is alerted
+func (s *Scheduler) Baseline() parser.Result {
+	res := s.fetchRefugesWindow(s.anchors(), parser.DefaultPax)
+	for name, ferr := range res.Errors {
+		slog.Warn("initial availability check failed", "refuge", name, "error", ferr)
+	}
+	s.session.observe(res, s.now())
+	s.breaker.observe(parser.FFCAMBreaker.State(), s.now())
+	s.failures.observe(res, s.now())
+	web.SetLastError(lastErrorClass(res.Errors))
+	s.previous = carryOver(nil, res)
+	return res
+}
+
+// Broadcast sends message to every subscriber who isn't snoozed, or to the admins when there
+// are no subscribers. A *telegram.SendError tells how many chats it didn't reach.
+func (s *Scheduler) Broadcast(ctx context.Context, message string) error {
+	return sendToSubscribersOrEnv(ctx, s.store, message, s.notify, s.now())
+}
+
+// Delivered returns how many messages the latest cycle sent and how many it deferred to the
+// outbox
+func (s *Scheduler) Delivered() (flushed int, deferred int) {
+	s.mu.Lock()
+	q := s.queue
+	s.mu.Unlock()
+	if q == nil {
+		return 0, 0
+	}
+	return q.stats()
+}
+
+// RunOnce performs one check cycle: fetch, update the web state and notify matching subscribers.
+// A check skipped while FFCAM is paused is not an error; one that parsed no dates at all is.
+// ctx is cancelled when shutdown can't wait any longer: the messages not sent by then are
+// persisted to the outbox.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	queue := &deliveryQueue{}
+	s.mu.Lock()
+	s.queue = queue
+	s.mu.Unlock()
+
+	// deliver delayed messages (e.g. snooze catch-ups) that are due
+	web.FlushOutbox(ctx, s.store, s.now())
+	// FFCAM is down: don't hammer it until the breaker's cooldown is over
+	if parser.FFCAMBreaker.Paused() {
+		slog.Warn("FFCAM circuit breaker open, skipping this check")
+		metrics.ChecksTotal.WithLabelValues("skipped").Inc()
+		return nil
+	}
+	// FFCAM rate limited us or is in maintenance: wait out the back-off
+	if s.failures.paused(s.now()) {
+		slog.Warn("backing off FFCAM, skipping this check", "until", s.failures.pausedUntil.Format("15:04:05"))
+		metrics.ChecksTotal.WithLabelValues("skipped").Inc()
+		return nil
+	}
+	// refresh month anchors on each tick to keep rolling window
+	monthAnchors := s.anchors()
+
+	// feature flags are read once per cycle; on error every flag keeps its safe default
+	flags, err := featureflags.Load(ctx, s.store)
+	if err != nil {
+		slog.Error("failed to load feature flags", "error", err)
+	}
+
+	result := s.fetchRefugesWindow(monthAnchors, parser.DefaultPax)
+	if len(result.Errors) > 0 && flags.Enabled(featureflags.AggressiveRetries, "", false) {
+		slog.Info("retrying failed refuges right away", "refuges", len(result.Errors))
+		if retry := s.fetchRefugesWindow(monthAnchors, parser.DefaultPax); len(retry.Errors) < len(result.Errors) {
+			result = retry
+		}
+	}
+	for name, ferr := range result.Errors {
+		var retryErr *parser.RetryError
+		if errors.As(ferr, &retryErr) {
+			slog.Error("failed to check availability", "refuge", name, "attempts", retryErr.Attempts, "error", ferr)
+		} else {
+			slog.Error("failed to check availability", "refuge", name, "error", ferr)
+		}
+	}
+	recordCheckMetrics(result)
+	s.session.observe(result, s.now())
+	s.breaker.observe(parser.FFCAMBreaker.State(), s.now())
+	s.failures.observe(result, s.now())
+	web.SetLastError(lastErrorClass(result.Errors))
+	refuges := result.Refuges
+	diff := windowDiff(s.previous, result, monthAnchors)
+	logDiff(diff)
+	s.postToChannels(ctx, diff)
+	s.previous = carryOver(s.previous, result)
+
+	// Update web interface with whatever refuges succeeded (partial data beats stale data)
+	if len(refuges) > 0 {
+		web.UpdateState(refuges, s.now())
+		if err := web.SaveState(ctx, s.store, refuges, s.now()); err != nil {
+			slog.Error("failed to store the latest check for the web", "error", err)
+		}
+		slog.Info("web interface updated", "refuges", len(refuges))
+		s.week.recordCheck(refuges, s.now())
+		recordSnapshots(ctx, s.store, refuges, s.now())
+		recordDateSnapshots(ctx, s.store, refuges, s.now())
+	}
+
+	// One-off pings for subscribers waiting for booking to open, independent of their queries
+	for _, o := range detectSeasonOpenings(ctx, s.store, refuges) {
+		slog.Info("booking opened", "refuge", o.Refuge, "season", o.Year)
+		n := notifySeasonOpen(ctx, s.store, o, s.notify.sendTo(ctx))
+		telegram.SendFailed("season opening report", s.notify.Admins(fmt.Sprintf("🎉 Booking opened at %s for the %d season, %d subscribers notified", telegram.EscapeHTML(o.Refuge), o.Year, n)))
+	}
+
+	// Available dates; the fan-out leaves out the ones each subscriber was already alerted about
+	var availabilities []availability
+
+	// Check if we got any dates at all
+	totalDates := 0
+	for _, refuge := range refuges {
+		totalDates += len(refuge.Dates)
+		for _, day := range refuge.Days() {
+			if day.Available() {
+				availabilities = append(availabilities, availability{refuge: refuge.Name, day: day})
+			}
+		}
+	}
+
+	// Notify only if every refuge failed and no dates were parsed
+	if totalDates == 0 {
+		err := errors.New("no dates were parsed")
+		if len(result.Errors) > 0 {
+			err = fmt.Errorf("no dates were parsed: %w", joinErrors(result.Errors))
+		}
+		// an expired session or an outage was already reported to admins by the monitors
+		if s.session.expired || s.breaker.down {
+			return err
+		}
+		// admins only: subscribers can't act on it, and it would ignore their quiet hours
+		notification := "⚠️ Warning: No dates were parsed from the response. This might indicate an issue with the website or session."
+		if !telegram.SendFailed("warning notification", s.notify.Admins(notification)) {
+			slog.Info("warning notification sent")
+		}
+		return err
+	}
+
+	// queries for other group sizes get the dates of their own checks
+	availabilities = append(availabilities, s.groupAvailabilities(ctx, monthAnchors)...)
+
+	// Per-subscriber filtered notifications based on saved queries, for the dates each
+	// subscriber wasn't alerted about yet
+	s.pruneHistory(ctx)
+	deliver := func(sub store.Subscriber, body string, dates []alertedDate, done []store.Query) error {
+		// Localize with the subscriber's stored language (i18n.T falls back to English)
+		lang := i18n.Supported(sub.Language)
+		// the alert history is written once the alert is sent, or when it is held for a
+		// snoozed subscriber, for the daily digest or until their quiet hours end
+		records := func(channel string) []store.Notification {
+			ns := make([]store.Notification, 0, len(dates))
+			for _, d := range dates {
+				ns = append(ns, store.Notification{ChatID: sub.ChatID, Refuge: d.refuge, Date: d.date, Places: d.places, Channel: channel})
+			}
+			return ns
+		}
+		sent, err := s.sendAlert(ctx, sub, i18n.T(lang, "notif_new")+"\n\n", body, emailAlert(dates, lang), queue.recording(remindButtons(dates, lang), records(store.ChannelTelegram)))
+		if sent.emailed {
+			record(ctx, s.store, records(store.ChannelEmail))
+		}
+		if err != nil {
+			return err
+		}
+		if sent.chat && sent.held != "" {
+			record(ctx, s.store, records(store.ChannelTelegram))
+			for _, d := range dates {
+				s.misses.note(store.MatchDecision{ChatID: sub.ChatID, Refuge: d.refuge, Date: d.date, Reason: sent.held, Places: d.places})
+			}
+		}
+		// one-shot queries are done once they alerted; the notice with the re-arm button goes
+		// to Telegram, where the button works, even for email-only subscribers
+		for _, q := range done {
+			if err := s.store.SetQueryStatus(ctx, q.ID, store.QueryCompleted); err != nil {
+				slog.Error("failed to complete one-shot query", "chat_id", sub.ChatID, "query_id", q.ID, "error", err)
+				continue
+			}
+			text, rows := web.OneShotDone(q, lang)
+			if err := web.DeliverOrHold(ctx, s.store, sub, "", text+"\n", s.now(), queue.withButtons(rows)); err != nil {
+				slog.Error("failed to tell one-shot query completed", "chat_id", sub.ChatID, "query_id", q.ID, "error", err)
+			}
+		}
+		s.week.recordAlert(sub.ChatID, s.now())
+		// the notification log tells notifyVanished whom to follow up with
+		for _, d := range dates {
+			if !d.track {
+				continue
+			}
+			e := store.NotificationLogEntry{ChatID: sub.ChatID, Kind: store.KindAlert, Status: store.StatusAlerted, Refuge: d.refuge, Date: d.date, At: s.now()}
+			if err := s.store.LogNotification(ctx, e); err != nil {
+				slog.Error("failed to log alerted date", "chat_id", sub.ChatID, "refuge", d.refuge, "date", d.date, "error", err)
+			}
+		}
+		return nil
+	}
+	alerted := s.skipped.fanOut(ctx, s.store, availabilities, flags.Enabled(featureflags.FairnessStagger, "", false), deliver, s.misses)
+	s.misses.flush(ctx, s.store, s.now())
+	if alerted == 0 {
+		slog.Info("no new availability found", "dates", totalDates)
+	}
+	// tell the subscribers alerted about a date who opted in that it has been booked out
+	if n := notifyVanished(ctx, s.store, diff.Vanished(), s.now(), queue.add); n > 0 {
+		slog.Info("subscribers told about vanished dates", "subscribers", n)
+	}
+
+	// weekly "your alerts are active" summaries for subscribers whose slot is now
+	sendWeeklySummaries(ctx, s.store, s.week, refuges, s.now(), queue.add)
+
+	// send everything queued by the fan-out; on shutdown the rest is persisted to the outbox
+	queue.flush(ctx, s.store, s.notify)
+	slog.Info("check completed", "dates", totalDates, "available", len(availabilities), "alerted", alerted)
+	return nil
+}
+
+// historyRetention is how long the notifications of past dates are kept as the alert history
+const historyRetention = 90 * 24 * time.Hour
+
+// pruneHistory drops, once a day, the notifications of dates past for longer than
+// historyRetention, the personal data past its store.RetentionPolicies and the date snapshots
+// older than SnapshotRetention
+func (s *Scheduler) pruneHistory(ctx context.Context) {
+	today := s.now().UTC().Format("2006-01-02")
+	if s.pruned == today {
+		return
+	}
+	n, err := s.store.DeleteNotificationsBefore(ctx, s.now().UTC().Add(-historyRetention).Format("2006-01-02"))
+	if err != nil {
+		slog.Error("failed to prune notification history", "error", err)
+		return
+	}
+	if n > 0 {
+		slog.Info("pruned notification history", "notifications", n)
+	}
+	purgeExpired(ctx, s.store, s.now())
+	if s.SnapshotRetention > 0 {
+		n, err := s.store.DeleteDateSnapshotsBefore(ctx, s.now().Add(-s.SnapshotRetention))
+		if err != nil {
+			slog.Error("failed to prune date snapshots", "error", err)
+			return
+		}
+		if n > 0 {
+			slog.Info("pruned date snapshots", "snapshots", n)
+		}
+	}
+	s.pruned = today
+}
+
+// sendToSubscribersOrEnv sends to the store's subscribers if available; otherwise falls back
+// to the admin chats (TELEGRAM_CHAT_IDS). Failed sends are returned as a *telegram.SendError.
+func sendToSubscribersOrEnv(ctx context.Context, st store.Store, msg string, n Notifier, now time.Time) error {
+	if st != nil {
+		subs, err := st.ListSubscribers(ctx)
+		if err == nil && len(subs) > 0 {
+			se := &telegram.SendError{}
+			for _, s := range subs {
+				if s.IsSnoozed(now) {
+					continue
+				}
+				se.Total++
+				if err := n.Chat.Notify(ctx, s.ChatID, msg); err != nil {
+					if se.Failed == 0 {
+						se.Err = fmt.Errorf("chat %s: %w", s.ChatID, err)
+					}
+					se.Failed++
+				}
+			}
+			if se.Failed > 0 {
+				return se
+			}
+			return nil
+		}
+	}
+	return n.Admins(msg)
+}
+
+// recordCheckMetrics exports the outcome of a check cycle: its result and the dates parsed
+// per refuge (0 for refuges that failed)
+func recordCheckMetrics(res parser.Result) {
+	switch {
+	case len(res.Errors) == 0:
+		metrics.ChecksTotal.WithLabelValues("ok").Inc()
+	case len(res.Refuges) == 0:
+		metrics.ChecksTotal.WithLabelValues("failed").Inc()
+	default:
+		metrics.ChecksTotal.WithLabelValues("partial").Inc()
+	}
+	for _, rf := range res.Refuges {
+		metrics.DatesFound.WithLabelValues(rf.Name).Set(float64(len(rf.Dates)))
+	}
+	for name := range res.Errors {
+		metrics.DatesFound.WithLabelValues(name).Set(0)
+	}
+}
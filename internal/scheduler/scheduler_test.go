@@ -0,0 +1,540 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// fakeFFCAM serves the refuges set for the July anchor; the other months have no dates
+type fakeFFCAM struct {
+	july []parser.Refuge
+}
+
+func (f *fakeFFCAM) fetch(_ string, anchor time.Time, _ int) (parser.Result, error) {
+	if anchor.Month() != time.July {
+		return parser.Result{Errors: map[string]error{}}, nil
+	}
+	return parser.Result{Refuges: f.july, Errors: map[string]error{}}, nil
+}
+
+// recordingNotifier records the messages sent per chat, "admins" for the admin chats
+func recordingNotifier(sent map[string][]string) Notifier {
+	return Notifier{
+		Admins: func(message string) error {
+			sent["admins"] = append(sent["admins"], message)
+			return nil
+		},
+		Chat: notify.Func(func(_ context.Context, chatID string, message string) error {
+			sent[chatID] = append(sent[chatID], message)
+			return nil
+		}),
+	}
+}
+
+func newTestScheduler(st store.Store, fetch FetchFunc, sent map[string][]string) *Scheduler {
+	s := New("http://ffcam.test", st, fetch, recordingNotifier(sent))
+	s.now = func() time.Time { return time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC) }
+	return s
+}
+
+func TestRunOnceNotifiesMatchingSubscribers(t *testing.T) {
+	st := store.NewMemory()
+	// weekly summaries are opted out: only the alerts are under test
+	for _, sub := range []store.Subscriber{
+		{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true},
+		{ChatID: "2", Language: "en", IsActive: true, WeeklyOptOut: true},
+		{ChatID: "3", Language: "en", IsActive: true, WeeklyOptOut: true},
+		{ChatID: "4", Language: "en", IsActive: true, WeeklyOptOut: true, SnoozedUntil: time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC)},
+	} {
+		st.UpsertSubscriber(t.Context(), sub)
+	}
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	st.AddQuery(t.Context(), store.Query{ChatID: "2", Refuge: "du Goûter", DateFrom: "2025-07-01", DateTo: "2025-07-31", MinPlaces: 4})
+	st.AddQuery(t.Context(), store.Query{ChatID: "3", Refuge: "*", DateFrom: "2025-08-01", DateTo: "2025-08-31"})
+	st.AddQuery(t.Context(), store.Query{ChatID: "4", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+
+	ffcam := &fakeFFCAM{july: []parser.Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3", "2025-07-11": "Full"}},
+		{Name: "du Goûter", Dates: map[string]string{"2025-07-12": "2"}},
+	}}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, ffcam.fetch, sent)
+
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sent["1"]) != 1 || !strings.Contains(sent["1"][0], "Tête Rousse") || !strings.Contains(sent["1"][0], "2025-07-10") {
+		t.Fatalf("expected chat 1 alerted about 2025-07-10, got %q", sent["1"])
+	}
+	if strings.Contains(sent["1"][0], "2025-07-11") {
+		t.Errorf("full dates must not be alerted: %q", sent["1"][0])
+	}
+	// too few places for chat 2, another month for chat 3, chat 4 is snoozed
+	for _, chatID := range []string{"2", "3", "4", "admins"} {
+		if len(sent[chatID]) != 0 {
+			t.Errorf("expected nothing sent to %s, got %q", chatID, sent[chatID])
+		}
+	}
+	held, _ := st.ListDueMessages(t.Context(), time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(held) != 1 {
+		t.Fatalf("expected the snoozed subscriber's alert held in the outbox, got %+v", held)
+	}
+	for _, m := range held {
+		if m.ChatID != "4" || !strings.Contains(m.Text, "2025-07-10") {
+			t.Errorf("unexpected held alert %+v", m)
+		}
+	}
+	if flushed, deferred := s.Delivered(); flushed != 1 || deferred != 0 {
+		t.Errorf("expected 1 message delivered, got %d delivered and %d deferred", flushed, deferred)
+	}
+
+	// the same dates again: nobody is alerted twice
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sent["1"]) != 1 {
+		t.Fatalf("expected no repeated alert, got %q", sent["1"])
+	}
+
+	// a new date opens: only it is sent
+	ffcam.july[0].Dates["2025-07-20"] = "5"
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sent["1"]) != 2 || !strings.Contains(sent["1"][1], "2025-07-20") || strings.Contains(sent["1"][1], "2025-07-10") {
+		t.Fatalf("expected only the new date alerted, got %q", sent["1"])
+	}
+}
+
+func TestRunOnceFailsWithoutDates(t *testing.T) {
+	boom := errors.New("boom")
+	fetch := func(_ string, anchor time.Time, _ int) (parser.Result, error) {
+		return parser.Result{Errors: map[string]error{"Tête Rousse": boom}}, boom
+	}
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true})
+	sent := map[string][]string{}
+	s := newTestScheduler(st, fetch, sent)
+
+	err := s.RunOnce(context.Background())
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected the fetch error, got %v", err)
+	}
+	// the warning goes to the admins only
+	if len(sent["admins"]) != 1 || !strings.Contains(sent["admins"][0], "No dates were parsed") {
+		t.Errorf("expected the admins warned, got %q", sent["admins"])
+	}
+	if len(sent["1"]) != 0 {
+		t.Errorf("subscriber warned: %q", sent["1"])
+	}
+}
+
+func TestBroadcastReportsFailedSubscribers(t *testing.T) {
+	st := store.NewMemory()
+	for _, id := range []string{"1", "2", "3"} {
+		st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: id, IsActive: true})
+	}
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "4", IsActive: true, SnoozedUntil: time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC)})
+	blocked := errors.New("blocked by user")
+	failing := map[string]bool{"2": true}
+	sent := map[string][]string{}
+	n := recordingNotifier(sent)
+	chat := n.Chat
+	n.Chat = notify.Func(func(ctx context.Context, chatID string, message string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if failing[chatID] {
+			return blocked
+		}
+		return chat.Notify(ctx, chatID, message)
+	})
+	s := New("http://ffcam.test", st, nil, n)
+	s.now = func() time.Time { return time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC) }
+
+	// partial: the snoozed subscriber isn't counted
+	var se *telegram.SendError
+	if err := s.Broadcast(t.Context(), "hello"); !errors.As(err, &se) || se.Failed != 1 || se.Total != 3 || se.All() || !errors.Is(err, blocked) {
+		t.Fatalf("expected 1 of 3 chats failed, got %v", err)
+	}
+	if len(sent["1"]) != 1 || len(sent["3"]) != 1 || len(sent["4"]) != 0 {
+		t.Errorf("expected the other active subscribers sent to, got %v", sent)
+	}
+
+	failing["1"], failing["3"] = true, true
+	if err := s.Broadcast(t.Context(), "hello"); !errors.As(err, &se) || !se.All() {
+		t.Fatalf("expected every chat failed, got %v", err)
+	}
+
+	// sends run under the caller's context, so shutdown stops them
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := s.Broadcast(ctx, "hello"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected sends stopped by the canceled context, got %v", err)
+	}
+}
+
+func TestRunOnceHoldsAlertsDuringQuietHours(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true, QuietFrom: "23:00", QuietTo: "09:00"})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}}}}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, ffcam.fetch, sent)
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	ffcam.july[0].Dates["2025-07-11"] = "2"
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sent["1"]) != 0 {
+		t.Fatalf("alerted during quiet hours: %q", sent["1"])
+	}
+	// both checks' matches wait for 09:00 in one message
+	msgs, _ := st.ListDueMessages(t.Context(), time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC))
+	if len(msgs) != 1 || msgs[0].Kind != store.KindDigest || !strings.Contains(msgs[0].Text, "2025-07-10") || !strings.Contains(msgs[0].Text, "2025-07-11") {
+		t.Fatalf("expected one digest of both dates, got %+v", msgs)
+	}
+	if early, _ := st.ListDueMessages(t.Context(), time.Date(2025, 7, 1, 8, 59, 0, 0, time.UTC)); len(early) != 0 {
+		t.Errorf("digest due before the quiet hours end: %+v", early)
+	}
+}
+
+func TestRunOnceCollectsAlertsForTheDailyDigest(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true, NotifyMode: store.NotifyDigest, Email: "alice@example.org"})
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "2", Language: "en", IsActive: true, WeeklyOptOut: true})
+	for _, chatID := range []string{"1", "2"} {
+		st.AddQuery(t.Context(), store.Query{ChatID: chatID, Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	}
+
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}}}}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, ffcam.fetch, sent)
+	s.notify.Email = notify.Func(func(_ context.Context, to string, message string) error {
+		sent[to] = append(sent[to], message)
+		return nil
+	})
+	for range 2 {
+		if err := s.RunOnce(context.Background()); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+		ffcam.july[0].Dates["2025-07-11"] = "2"
+	}
+	// instant subscribers are alerted check by check
+	if len(sent["2"]) != 2 {
+		t.Errorf("expected two instant alerts, got %q", sent["2"])
+	}
+	if len(sent["1"]) != 0 || len(sent["alice@example.org"]) != 0 {
+		t.Fatalf("digest subscriber alerted right away: %q", sent)
+	}
+	// both checks' matches wait for 08:00 the next day in one message, alerted once
+	msgs, _ := st.ListDueMessages(t.Context(), time.Date(2025, 7, 2, 8, 0, 0, 0, time.UTC))
+	if len(msgs) != 1 || msgs[0].Kind != store.KindDaily || strings.Count(msgs[0].Text, ">2025-07-10<") != 1 || !strings.Contains(msgs[0].Text, "2025-07-11") {
+		t.Fatalf("expected one daily digest of both dates, got %+v", msgs)
+	}
+	if early, _ := st.ListDueMessages(t.Context(), time.Date(2025, 7, 2, 7, 59, 0, 0, time.UTC)); len(early) != 0 {
+		t.Errorf("digest due before the digest hour: %+v", early)
+	}
+}
+
+func TestRunOnceEmailsEmailOnlySubscribersRightAway(t *testing.T) {
+	st := store.NewMemory()
+	// digest mode and quiet hours saved before the subscriber went email-only
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true, NotifyMode: store.NotifyDigest,
+		QuietFrom: "06:00", QuietTo: "09:00", Email: "alice@example.org", EmailOnly: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}}}}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, ffcam.fetch, sent)
+	s.notify.Email = notify.Func(func(_ context.Context, to string, message string) error {
+		sent[to] = append(sent[to], message)
+		return nil
+	})
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sent["alice@example.org"]) != 1 || len(sent["1"]) != 0 {
+		t.Errorf("expected the alert emailed alone, got %q", sent)
+	}
+	if msgs, _ := st.ListDueMessages(t.Context(), time.Date(2025, 7, 3, 0, 0, 0, 0, time.UTC)); len(msgs) != 0 {
+		t.Errorf("alert held for a Telegram digest: %+v", msgs)
+	}
+}
+
+func TestRunOnceFollowsUpOnGoneDates(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "2", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", NotifyOnGone: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "2", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}}}}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, ffcam.fetch, sent)
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sent["1"]) != 1 || len(sent["2"]) != 1 {
+		t.Fatalf("expected both chats alerted, got %v", sent)
+	}
+
+	ffcam.july[0].Dates["2025-07-10"] = "Full"
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sent["1"]) != 2 || sent["1"][1] != "❌ 2025-07-10 at Tête Rousse is no longer available" {
+		t.Errorf("expected the opted-in chat followed up, got %q", sent["1"])
+	}
+	if len(sent["2"]) != 1 {
+		t.Errorf("expected no follow-up without the opt-in, got %q", sent["2"])
+	}
+}
+
+func TestAnchorsFollowWindowMonths(t *testing.T) {
+	s := New("http://ffcam.test", store.NewMemory(), nil, recordingNotifier(map[string][]string{}))
+	s.now = func() time.Time { return time.Date(2025, 10, 15, 8, 0, 0, 0, time.UTC) }
+	if got := s.anchors(); len(got) != DefaultWindowMonths || !got[0].Equal(time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the default window from October, got %v", got)
+	}
+	s.WindowMonths = 6
+	got := s.anchors()
+	if len(got) != 6 || !got[5].Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected six months up to March, got %v", got)
+	}
+}
+
+func TestRunOnceNotifiesWhenPlacesGoUp(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "2", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	st.AddQuery(t.Context(), store.Query{ChatID: "2", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", MinPlaces: 2})
+
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "1"}}}}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, ffcam.fetch, sent)
+	run := func(places string) {
+		t.Helper()
+		ffcam.july[0].Dates["2025-07-10"] = places
+		if err := s.RunOnce(context.Background()); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+	}
+
+	run("1")
+	if len(sent["1"]) != 1 || len(sent["2"]) != 0 {
+		t.Fatalf("expected only chat 1 alerted about 1 place, got %v", sent)
+	}
+	// 1 → 2: now enough for chat 2, which never heard of the date; chat 1 already knows it
+	run("2")
+	if len(sent["2"]) != 1 || !strings.Contains(sent["2"][0], "2 places") || strings.Contains(sent["2"][0], "up from") {
+		t.Fatalf("expected chat 2 alerted about a new date with 2 places, got %q", sent["2"])
+	}
+	if len(sent["1"]) != 1 {
+		t.Errorf("expected no repeated alert for chat 1, got %q", sent["1"])
+	}
+	// chat 1 now needs 3 places: 2 → 3 reaches it, against the 1 place it was told about
+	qs, _ := st.ListQueriesByChat(t.Context(), "1")
+	st.DeleteQuery(t.Context(), qs[0].ID)
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", MinPlaces: 3})
+	run("3")
+	if len(sent["1"]) != 2 || !strings.Contains(sent["1"][1], "3 places (up from 1)") {
+		t.Fatalf("expected chat 1 alerted about 3 places, got %q", sent["1"])
+	}
+	if len(sent["2"]) != 1 {
+		t.Errorf("expected no repeated alert for chat 2, got %q", sent["2"])
+	}
+	// 3 → 1 → 3: fewer places never alert, nor does getting back to what was announced
+	run("1")
+	run("3")
+	if len(sent["1"]) != 2 || len(sent["2"]) != 1 {
+		t.Errorf("expected no alert when places go down or back up, got %v", sent)
+	}
+}
+
+func TestRunOnceRemembersAlertsAcrossRestarts(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	ffcam := &fakeFFCAM{july: []parser.Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}},
+		{Name: "du Goûter", Dates: map[string]string{"2025-06-30": "2"}},
+	}}
+	sent := map[string][]string{}
+	sentAt := time.Date(2025, 6, 20, 8, 0, 0, 0, time.UTC)
+	st.RecordNotification(t.Context(), store.Notification{ChatID: "1", Refuge: "du Goûter", Date: "2025-06-30", Places: 2, SentAt: sentAt, Channel: store.ChannelTelegram})
+	st.RecordNotification(t.Context(), store.Notification{ChatID: "1", Refuge: "du Goûter", Date: "2025-03-15", Places: 1, SentAt: sentAt, Channel: store.ChannelTelegram})
+
+	if err := newTestScheduler(st, ffcam.fetch, sent).RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	// a new scheduler, as after a restart, reads what was alerted from the store
+	if err := newTestScheduler(st, ffcam.fetch, sent).RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sent["1"]) != 1 || !strings.Contains(sent["1"][0], "2025-07-10") {
+		t.Fatalf("expected one alert about 2025-07-10, got %q", sent["1"])
+	}
+	// the history keeps recent past dates, and prunes those past the retention
+	ds, _ := st.ListNotifiedDates(t.Context(), "1")
+	if len(ds) != 2 || ds[0].Date != "2025-06-30" || ds[1].Date != "2025-07-10" || ds[1].Places != 3 {
+		t.Errorf("expected 2025-06-30 and 2025-07-10 kept with 3 places, got %+v", ds)
+	}
+}
+
+func TestRunOnceAttachesRemindButtons(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	ffcam := &fakeFFCAM{july: []parser.Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}},
+		{Name: "du Goûter", Dates: map[string]string{"2025-07-09": "2"}},
+	}}
+	s := newTestScheduler(st, ffcam.fetch, map[string][]string{})
+	var buttons [][]telegram.InlineButton
+	s.notify.Buttons = func(chatID string, message string, rows [][]telegram.InlineButton) error {
+		buttons = rows
+		return nil
+	}
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	// one button per date, in date order
+	if len(buttons) != 2 || !strings.Contains(buttons[0][0].Text, "2025-07-09 du Goûter") || buttons[1][0].CallbackData != "remind:tr:20250710" {
+		t.Errorf("unexpected buttons %+v", buttons)
+	}
+}
+
+// recordingStore keeps the notifications recorded, each channel's on its own
+type recordingStore struct {
+	*store.MemoryStore
+	notified []store.Notification
+}
+
+func (s *recordingStore) RecordNotification(ctx context.Context, n store.Notification) error {
+	s.notified = append(s.notified, n)
+	return s.MemoryStore.RecordNotification(ctx, n)
+}
+
+func TestRunOnceEmailsSubscribersWithAnAddress(t *testing.T) {
+	st := &recordingStore{MemoryStore: store.NewMemory()}
+	for _, sub := range []store.Subscriber{
+		{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true, Email: "one@example.org"},
+		{ChatID: "2", Language: "en", IsActive: true, WeeklyOptOut: true, Email: "two@example.org", EmailOnly: true},
+		{ChatID: "3", Language: "en", IsActive: true, WeeklyOptOut: true, Email: "down@example.org", EmailOnly: true},
+	} {
+		st.UpsertSubscriber(t.Context(), sub)
+		st.AddQuery(t.Context(), store.Query{ChatID: sub.ChatID, Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	}
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}}}}
+	sent := map[string][]string{}
+	s := newTestScheduler(st, ffcam.fetch, sent)
+	emails := map[string]string{}
+	s.notify.Email = notify.Func(func(_ context.Context, to string, message string) error {
+		if to == "down@example.org" {
+			return errors.New("smtp down")
+		}
+		emails[to] = message
+		return nil
+	})
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(emails) != 2 || !strings.Contains(emails["one@example.org"], "2025-07-10 · Tête Rousse: 3 places") || strings.Contains(emails["two@example.org"], "<a ") {
+		t.Errorf("unexpected emails %q", emails)
+	}
+	// Telegram too, unless email only; a failed email falls back to Telegram
+	if len(sent["1"]) != 1 || len(sent["2"]) != 0 || len(sent["3"]) != 1 {
+		t.Errorf("unexpected Telegram alerts %v", sent)
+	}
+	channels := map[string][]string{}
+	for _, n := range st.notified {
+		channels[n.ChatID] = append(channels[n.ChatID], n.Channel)
+	}
+	if strings.Join(channels["1"], ",") != "email,telegram" || strings.Join(channels["2"], ",") != "email" || strings.Join(channels["3"], ",") != "telegram" {
+		t.Errorf("unexpected recorded channels %v", channels)
+	}
+}
+
+func TestRunOnceRecordsChangedDateSnapshots(t *testing.T) {
+	st := store.NewMemory()
+	ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "du Goûter", Dates: map[string]string{"2025-07-10": "0", "2025-07-11": "2"}}}}
+	s := newTestScheduler(st, ffcam.fetch, map[string][]string{})
+	s.SnapshotRetention = 24 * time.Hour
+	st.SaveDateSnapshots(t.Context(), []store.DateSnapshot{{Refuge: "du Goûter", Date: "2025-07-09", Places: 1, CheckedAt: s.now().Add(-48 * time.Hour)}})
+
+	for _, places := range []string{"2", "2", "4"} {
+		ffcam.july[0].Dates["2025-07-11"] = places
+		if err := s.RunOnce(context.Background()); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+	}
+	// the unchanged check stores nothing, and the snapshot past the retention is pruned
+	sns, _ := st.ListDateSnapshots(t.Context(), "du Goûter", time.Time{}, s.now().Add(time.Hour))
+	var got []string
+	for _, sn := range sns {
+		got = append(got, fmt.Sprintf("%s=%d", sn.Date, sn.Places))
+	}
+	if strings.Join(got, " ") != "2025-07-10=0 2025-07-11=2 2025-07-11=4" {
+		t.Errorf("unexpected snapshots %q", got)
+	}
+}
+
+// countingStore counts the query and subscriber listings, the round trips of a check's fan-out
+type countingStore struct {
+	*store.MemoryStore
+	calls map[string]int
+}
+
+func (s *countingStore) ListSubscribers(ctx context.Context) ([]store.Subscriber, error) {
+	s.calls["ListSubscribers"]++
+	return s.MemoryStore.ListSubscribers(ctx)
+}
+
+func (s *countingStore) ListAllQueries(ctx context.Context) ([]store.Query, error) {
+	s.calls["ListAllQueries"]++
+	return s.MemoryStore.ListAllQueries(ctx)
+}
+
+func (s *countingStore) ListQueriesByChat(ctx context.Context, chatID string) ([]store.Query, error) {
+	s.calls["ListQueriesByChat"]++
+	return s.MemoryStore.ListQueriesByChat(ctx, chatID)
+}
+
+func TestRunOnceListsQueriesOncePerCheck(t *testing.T) {
+	// checks with 1 and 50 subscribers make the same listings
+	listings := func(subscribers int) map[string]int {
+		st := &countingStore{MemoryStore: store.NewMemory(), calls: map[string]int{}}
+		for i := range subscribers {
+			chatID := fmt.Sprint(i + 1)
+			st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: chatID, Language: "en", IsActive: true})
+			st.AddQuery(t.Context(), store.Query{ChatID: chatID, Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+		}
+		ffcam := &fakeFFCAM{july: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}}}}
+		sent := map[string][]string{}
+		if err := newTestScheduler(st, ffcam.fetch, sent).RunOnce(context.Background()); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+		if len(sent) < subscribers {
+			t.Fatalf("expected all %d subscribers alerted, got %v", subscribers, sent)
+		}
+		return st.calls
+	}
+	one, many := listings(1), listings(50)
+	if fmt.Sprint(one) != fmt.Sprint(many) || many["ListQueriesByChat"] != 0 {
+		t.Errorf("expected the same listings for 1 and 50 subscribers and none per chat, got %v and %v", one, many)
+	}
+}
@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/web"
+)
+
+// seasonStore is the part of the store the season-opening detector needs
+type seasonStore interface {
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key string, value string) error
+	ListSubscribers(ctx context.Context) ([]store.Subscriber, error)
+	UpsertSubscriber(ctx context.Context, sub store.Subscriber) error
+}
+
+// seasonOpening is a refuge whose booking opened for a season
+type seasonOpening struct {
+	Refuge string
+	Year   int
+}
+
+// seasonStateKey is the setting holding a refuge's last observed season state: "open:<year>"
+// or "closed:<year>", where year is the last season seen open (0 if none yet)
+func seasonStateKey(refuge string) string {
+	return "season_state:" + refuge
+}
+
+// seasonYear returns the season a refuge's dates belong to when booking is open, i.e. when any
+// date in the window can be booked or is already full
+func seasonYear(rf parser.Refuge) (int, bool) {
+	year := 0
+	for _, day := range rf.Days() {
+		if day.Status != parser.StatusAvailable && day.Status != parser.StatusFull {
+			continue
+		}
+		if year == 0 || day.Date.Year() < year {
+			year = day.Date.Year()
+		}
+	}
+	return year, year != 0
+}
+
+// parseSeasonState splits a stored season state into open and the last open year
+func parseSeasonState(state string) (open bool, year int, ok bool) {
+	kind, y, found := strings.Cut(state, ":")
+	n, err := strconv.Atoi(y)
+	if !found || err != nil || (kind != "open" && kind != "closed") {
+		return false, 0, false
+	}
+	return kind == "open", n, true
+}
+
+// detectSeasonOpenings compares the refuges fetched by a check with their stored season state and
+// returns the refuges whose booking opened for a new season. Each refuge fires at most once per
+// season year. The first observation of a refuge only records its state: it may have opened long ago.
+func detectSeasonOpenings(ctx context.Context, st seasonStore, refuges []parser.Refuge) []seasonOpening {
+	var openings []seasonOpening
+	for _, rf := range refuges {
+		prev, err := st.GetSetting(ctx, seasonStateKey(rf.Name))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			slog.Error("failed to load season state", "refuge", rf.Name, "error", err)
+			continue
+		}
+		_, lastYear, known := parseSeasonState(prev)
+		next := fmt.Sprintf("closed:%d", lastYear)
+		if year, open := seasonYear(rf); open {
+			if known && year > lastYear {
+				openings = append(openings, seasonOpening{Refuge: rf.Name, Year: year})
+			}
+			next = fmt.Sprintf("open:%d", max(year, lastYear))
+		}
+		if next != prev {
+			if err := st.SetSetting(ctx, seasonStateKey(rf.Name), next); err != nil {
+				slog.Error("failed to save season state", "refuge", rf.Name, "error", err)
+			}
+		}
+	}
+	return openings
+}
+
+// notifySeasonOpen pings every active subscriber who asked to hear when booking opens and wasn't
+// told about this refuge and season yet; the season is recorded per subscriber so the preference
+// applies again next year. It returns the number of messages sent.
+func notifySeasonOpen(ctx context.Context, st seasonStore, o seasonOpening, send func(chatID string, message string) error) int {
+	subs, err := st.ListSubscribers(ctx)
+	if err != nil {
+		slog.Error("failed to list subscribers for season opening", "refuge", o.Refuge, "error", err)
+		return 0
+	}
+	sent := 0
+	for _, sub := range subs {
+		if !sub.IsActive || !sub.NotifyOnSeasonOpen || sub.SeasonNotified[o.Refuge] >= o.Year {
+			continue
+		}
+		if err := send(sub.ChatID, web.SeasonOpenMessage(o.Refuge, o.Year, i18n.Supported(sub.Language))); err != nil {
+			slog.Error("failed to send season opening", "chat_id", sub.ChatID, "error", err)
+			continue
+		}
+		if sub.SeasonNotified == nil {
+			sub.SeasonNotified = map[string]int{}
+		}
+		sub.SeasonNotified[o.Refuge] = o.Year
+		if err := st.UpsertSubscriber(ctx, sub); err != nil {
+			slog.Error("failed to record season opening", "chat_id", sub.ChatID, "error", err)
+		}
+		sent++
+	}
+	return sent
+}
+
+// recordSnapshots stores the dates open at each refuge for the end-of-season archive
+func recordSnapshots(ctx context.Context, st store.Store, refuges []parser.Refuge, now time.Time) {
+	for _, rf := range refuges {
+		open := map[string]int{}
+		for _, day := range rf.Days() {
+			if day.Available() {
+				open[day.Key()] = day.Places
+			}
+		}
+		if err := st.RecordSnapshot(ctx, store.Snapshot{Refuge: rf.Name, ObservedAt: now, Open: open}); err != nil {
+			slog.Error("failed to record availability snapshot", "refuge", rf.Name, "error", err)
+		}
+	}
+}
+
+// recordDateSnapshots stores the places of every date seen at refuges, 0 when full or closed,
+// for the availability history; the store keeps only the ones that changed
+func recordDateSnapshots(ctx context.Context, st store.Store, refuges []parser.Refuge, now time.Time) {
+	var sns []store.DateSnapshot
+	for _, rf := range refuges {
+		for _, day := range rf.Days() {
+			if day.Status == parser.StatusUnknown {
+				continue
+			}
+			sns = append(sns, store.DateSnapshot{Refuge: rf.Name, Date: day.Key(), Places: day.Places, CheckedAt: now})
+		}
+	}
+	n, err := st.SaveDateSnapshots(ctx, sns)
+	if err != nil {
+		slog.Error("failed to record date snapshots", "error", err)
+		return
+	}
+	slog.Debug("recorded date snapshots", "changed", n, "dates", len(sns))
+}
@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// memSeasonStore keeps settings and subscribers in memory
+type memSeasonStore struct {
+	settings map[string]string
+	subs     map[string]store.Subscriber
+}
+
+func newMemSeasonStore(subs ...store.Subscriber) *memSeasonStore {
+	s := &memSeasonStore{settings: map[string]string{}, subs: map[string]store.Subscriber{}}
+	for _, sub := range subs {
+		s.subs[sub.ChatID] = sub
+	}
+	return s
+}
+
+func (s *memSeasonStore) GetSetting(_ context.Context, key string) (string, error) {
+	v, ok := s.settings[key]
+	if !ok {
+		return "", store.ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *memSeasonStore) SetSetting(_ context.Context, key string, value string) error {
+	s.settings[key] = value
+	return nil
+}
+
+func (s *memSeasonStore) ListSubscribers(_ context.Context) ([]store.Subscriber, error) {
+	var res []store.Subscriber
+	for _, sub := range s.subs {
+		res = append(res, sub)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ChatID < res[j].ChatID })
+	return res, nil
+}
+
+func (s *memSeasonStore) UpsertSubscriber(_ context.Context, sub store.Subscriber) error {
+	s.subs[sub.ChatID] = sub
+	return nil
+}
+
+func TestSeasonYear(t *testing.T) {
+	closed := parser.Refuge{Name: "Tête Rousse", Dates: map[string]string{"2025-05-01": "Closed", "2025-05-02": "Closed"}}
+	if _, open := seasonYear(closed); open {
+		t.Error("expected a refuge with only closed days to be closed")
+	}
+	open := parser.Refuge{Name: "Tête Rousse", Dates: map[string]string{"2025-05-31": "Closed", "2025-06-01": "Full", "2025-06-02": "3"}}
+	if year, ok := seasonYear(open); !ok || year != 2025 {
+		t.Errorf("expected season 2025, got %d %v", year, ok)
+	}
+}
+
+func TestSeasonOpeningOncePerSeason(t *testing.T) {
+	st := newMemSeasonStore(
+		store.Subscriber{ChatID: "1", Language: "fr", IsActive: true, NotifyOnSeasonOpen: true},
+		store.Subscriber{ChatID: "2", Language: "en", IsActive: true}, // date queries only
+		store.Subscriber{ChatID: "3", Language: "en", IsActive: false, NotifyOnSeasonOpen: true},
+	)
+	var sent []string
+	send := func(chatID string, message string) error {
+		sent = append(sent, chatID)
+		return nil
+	}
+	check := func(dates map[string]string) []seasonOpening {
+		openings := detectSeasonOpenings(t.Context(), st, []parser.Refuge{{Name: "Tête Rousse", Dates: dates}})
+		for _, o := range openings {
+			notifySeasonOpen(t.Context(), st, o, send)
+		}
+		return openings
+	}
+	closed := func(year string) map[string]string {
+		return map[string]string{year + "-05-30": "Closed", year + "-05-31": "Closed"}
+	}
+	open := func(year string, places string) map[string]string {
+		return map[string]string{year + "-06-01": places, year + "-06-02": "Full"}
+	}
+
+	// season 1: closed before the season, then booking opens and stays open for several checks
+	if o := check(closed("2025")); len(o) != 0 {
+		t.Errorf("unexpected opening while closed: %v", o)
+	}
+	if o := check(open("2025", "10")); len(o) != 1 || o[0] != (seasonOpening{Refuge: "Tête Rousse", Year: 2025}) {
+		t.Fatalf("expected the 2025 opening, got %v", o)
+	}
+	check(open("2025", "4"))
+	// a glitch showing the refuge closed mid-season doesn't fire again
+	check(closed("2025"))
+	check(open("2025", "2"))
+	if len(sent) != 1 || sent[0] != "1" {
+		t.Fatalf("expected a single ping to chat 1 in 2025, got %v", sent)
+	}
+	if sub := st.subs["1"]; !sub.NotifyOnSeasonOpen || sub.SeasonNotified["Tête Rousse"] != 2025 {
+		t.Errorf("expected season 2025 recorded and the preference kept, got %+v", sub)
+	}
+
+	// season 2: the preference applies again without the subscriber doing anything
+	check(closed("2026"))
+	if o := check(open("2026", "12")); len(o) != 1 || o[0].Year != 2026 {
+		t.Fatalf("expected the 2026 opening, got %v", o)
+	}
+	check(open("2026", "8"))
+	if len(sent) != 2 || sent[1] != "1" {
+		t.Errorf("expected one more ping for 2026, got %v", sent)
+	}
+}
+
+func TestSeasonOpeningFirstObservation(t *testing.T) {
+	st := newMemSeasonStore(store.Subscriber{ChatID: "1", IsActive: true, NotifyOnSeasonOpen: true})
+	// a deploy in the middle of the season must not announce an opening
+	refuges := []parser.Refuge{{Name: "du Goûter", Dates: map[string]string{"2025-07-01": "5"}}}
+	if o := detectSeasonOpenings(t.Context(), st, refuges); len(o) != 0 {
+		t.Errorf("expected no opening on first observation, got %v", o)
+	}
+	if got := st.settings[seasonStateKey("du Goûter")]; got != "open:2025" {
+		t.Errorf("expected state open:2025, got %q", got)
+	}
+}
+
+func TestNotifySeasonOpenPerRefuge(t *testing.T) {
+	st := newMemSeasonStore(store.Subscriber{ChatID: "1", IsActive: true, NotifyOnSeasonOpen: true, SeasonNotified: map[string]int{"Tête Rousse": 2025}})
+	send := func(string, string) error { return nil }
+	if n := notifySeasonOpen(t.Context(), st, seasonOpening{Refuge: "Tête Rousse", Year: 2025}, send); n != 0 {
+		t.Errorf("expected no repeat for an announced refuge, sent %d", n)
+	}
+	if n := notifySeasonOpen(t.Context(), st, seasonOpening{Refuge: "du Goûter", Year: 2025}, send); n != 1 {
+		t.Errorf("expected the other refuge to be announced, sent %d", n)
+	}
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// sessionReminder is how often the expiry alert is repeated while the session stays expired
+const sessionReminder = 6 * time.Hour
+
+// sessionMonitor alerts admins when the FFCAM session expires (repeated every sessionReminder
+// until it's renewed) and once more when it's restored
+type sessionMonitor struct {
+	notify   func(message string) error // sends to admins
+	expired  bool
+	lastSent time.Time // when the last expiry alert went out
+}
+
+// observe inspects the result of a check cycle
+func (m *sessionMonitor) observe(res parser.Result, now time.Time) {
+	var refuges []string
+	for name, err := range res.Errors {
+		if errors.Is(err, parser.ErrReauthNeeded) {
+			refuges = append(refuges, name)
+		}
+	}
+	if len(refuges) > 0 {
+		if m.expired && now.Sub(m.lastSent) < sessionReminder {
+			return
+		}
+		sort.Strings(refuges)
+		msg := fmt.Sprintf("🔑 Session expired, please refresh PHPSESSID (FFCAM returned the login page for %s at %s UTC).\nAvailability checks are failing until the session is renewed:\n1. Log in at https://montblanc.ffcam.fr\n2. Copy the PHPSESSID cookie from the browser\n3. Update PHPSESSID in the service environment and restart",
+			strings.Join(refuges, ", "), now.UTC().Format("2006-01-02 15:04:05"))
+		if telegram.SendFailed("session expiry alert", m.notify(msg)) {
+			return
+		}
+		m.expired, m.lastSent = true, now
+		return
+	}
+	if m.expired && len(res.Refuges) > 0 {
+		if telegram.SendFailed("session restored message", m.notify(fmt.Sprintf("✅ FFCAM session restored at %s UTC, availability checks are working again.", now.UTC().Format("2006-01-02 15:04:05")))) {
+			return
+		}
+		m.expired = false
+	}
+}
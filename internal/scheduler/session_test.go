@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+func TestSessionMonitorAlertsOnceAndRecovers(t *testing.T) {
+	var sent []string
+	m := &sessionMonitor{notify: func(msg string) error {
+		sent = append(sent, msg)
+		return nil
+	}}
+	now := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	expired := parser.Result{Errors: map[string]error{
+		"Tête Rousse": fmt.Errorf("2025-07: %w", parser.ErrReauthNeeded),
+		"du Goûter":   fmt.Errorf("2025-07: %w", parser.ErrReauthNeeded),
+	}}
+
+	// repeated failing ticks alert exactly once
+	for i := 0; i < 5; i++ {
+		m.observe(expired, now.Add(time.Duration(i)*time.Minute))
+	}
+	if len(sent) != 1 {
+		t.Fatalf("expected exactly one expiry alert, got %d: %v", len(sent), sent)
+	}
+	if !strings.Contains(sent[0], "Tête Rousse, du Goûter") || !strings.Contains(sent[0], "2025-07-01 08:00:00") || !strings.Contains(sent[0], "PHPSESSID") {
+		t.Errorf("alert misses refuge, timestamp or instructions: %q", sent[0])
+	}
+
+	// a successful check sends one restore message
+	ok := parser.Result{Refuges: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-02": "Full"}}}, Errors: map[string]error{}}
+	m.observe(ok, now.Add(10*time.Minute))
+	m.observe(ok, now.Add(11*time.Minute))
+	if len(sent) != 2 || !strings.Contains(sent[1], "restored") {
+		t.Fatalf("expected one restore message, got %v", sent)
+	}
+
+	// a new expiry alerts again
+	m.observe(expired, now.Add(20*time.Minute))
+	if len(sent) != 3 {
+		t.Errorf("expected a new alert after recovery, got %d", len(sent))
+	}
+}
+
+func TestSessionMonitorIgnoresOtherFailures(t *testing.T) {
+	var sent []string
+	m := &sessionMonitor{notify: func(msg string) error {
+		sent = append(sent, msg)
+		return nil
+	}}
+	m.observe(parser.Result{Errors: map[string]error{"du Goûter": fmt.Errorf("unexpected status code 500")}}, time.Now())
+	m.observe(parser.Result{Refuges: []parser.Refuge{{Name: "Tête Rousse"}}}, time.Now())
+	if len(sent) != 0 {
+		t.Errorf("expected no admin messages, got %v", sent)
+	}
+}
+
+func TestSessionMonitorRemindsWhileExpired(t *testing.T) {
+	var sent []string
+	m := &sessionMonitor{notify: func(msg string) error {
+		sent = append(sent, msg)
+		return nil
+	}}
+	now := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	expired := parser.Result{Errors: map[string]error{"Tête Rousse": fmt.Errorf("Tête Rousse 2025-07: %w", parser.ErrReauthNeeded)}}
+
+	// checks every minute for a day still expired: one alert plus a reminder per sessionReminder
+	for i := 0; i < 24*60; i++ {
+		m.observe(expired, now.Add(time.Duration(i)*time.Minute))
+	}
+	if want := int(24 * time.Hour / sessionReminder); len(sent) != want {
+		t.Fatalf("expected %d alerts in a day, got %d", want, len(sent))
+	}
+	if !strings.HasPrefix(sent[0], "🔑 Session expired, please refresh PHPSESSID") {
+		t.Errorf("unexpected alert %q", sent[0])
+	}
+}
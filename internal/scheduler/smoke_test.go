@@ -0,0 +1,195 @@
+//go:build smoke
+
+// Smoke test of the whole check path: fake FFCAM serving the fixtures in testdata/smoke,
+// fake Telegram API, in-memory store and the web server. Run with: go test -tags smoke ./internal/scheduler
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+	"github.com/AlexYaroshenko/montblanc/internal/web"
+)
+
+// fixtureFFCAM serves testdata/smoke/<run>/<structure>-m<offset>.html for the month <offset>
+// months after month0, filling in the requested month; months without a fixture have no dates
+type fixtureFFCAM struct {
+	mu     sync.Mutex
+	run    string
+	month0 time.Time
+}
+
+func (f *fixtureFFCAM) setRun(run string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.run = run
+}
+
+func (f *fixtureFFCAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	date, err := time.Parse("2006-01-02", r.FormValue("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset := (date.Year()-f.month0.Year())*12 + int(date.Month()) - int(f.month0.Month())
+	structure := strings.TrimPrefix(r.FormValue("structure"), "BK_STRUCTURE:")
+	f.mu.Lock()
+	name := filepath.Join("testdata", "smoke", f.run, fmt.Sprintf("%s-m%d.html", structure, offset))
+	f.mu.Unlock()
+	content, err := os.ReadFile(name)
+	if err != nil {
+		w.Write([]byte("<html><body></body></html>"))
+		return
+	}
+	page := strings.NewReplacer("{{YYYY}}", date.Format("2006"), "{{MM}}", date.Format("01")).Replace(string(content))
+	w.Write([]byte(page))
+}
+
+// fakeTelegram records sendMessage calls as "chat_id: text"
+type fakeTelegram struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+		f.mu.Lock()
+		f.sent = append(f.sent, r.FormValue("chat_id")+": "+r.FormValue("text"))
+		f.mu.Unlock()
+	}
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// take returns the recorded messages, sorted, and forgets them
+func (f *fakeTelegram) take() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sent := f.sent
+	f.sent = nil
+	sort.Strings(sent)
+	return sent
+}
+
+func TestSmokeCheckCycle(t *testing.T) {
+	now := time.Now().UTC()
+	month0 := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	// day d of the month offset months after month0
+	day := func(offset int, d int) string {
+		return month0.AddDate(0, offset, d-1).Format("2006-01-02")
+	}
+	// the inline booking link of a date
+	book := func(refuge string, date string, lang string) string {
+		return " · " + web.BookNowLink(refuge, date, lang)
+	}
+
+	ffcam := &fixtureFFCAM{run: "run1", month0: month0}
+	ffcamSrv := httptest.NewServer(ffcam)
+	defer ffcamSrv.Close()
+	parser.SetAvailabilityURL(ffcamSrv.URL)
+	// the fixture server needs no protection from request bursts
+	parser.FFCAMLimiter = parser.NewRateLimiter(0, 1, time.Now)
+	tg := &fakeTelegram{}
+	tgSrv := httptest.NewServer(tg)
+	defer tgSrv.Close()
+
+	parser.UseSession(parser.NewSession("", nil, parser.Credentials{SessionID: "smoke"}))
+	telegram.Configure(telegram.Settings{BotToken: "smoke", APIURL: tgSrv.URL})
+
+	st := store.NewMemory()
+	site := httptest.NewServer(web.NewServer(st).Handler())
+	defer site.Close()
+
+	// weekly summaries are opted out: their slot depends on the time the test runs
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true, WeeklyOptOut: true})
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "2", Language: "de", IsActive: true, WeeklyOptOut: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*", DateFrom: day(0, 1), DateTo: day(2, 28)})
+	st.AddQuery(t.Context(), store.Query{ChatID: "2", Refuge: "du Goûter", DateFrom: day(0, 1), DateTo: day(2, 28), MinPlaces: 4})
+
+	cs := New("", st, parser.ParseRefugeAvailability, Notifier{Admins: func(string) error { return nil }, Chat: notify.TelegramNotifier{}})
+
+	// first run: one date at Tête Rousse, two at du Goûter across two months
+	cs.RunOnce(context.Background())
+	want := []string{
+		"1: 🎉 New availability found for your subscription!\n\n" +
+			"🏔️ Tête Rousse:\n  • " + web.DateLink("Tête Rousse", day(0, 3), "en") + ": 5 places" + book("Tête Rousse", day(0, 3), "en") + "\n\n" +
+			"🏔️ du Goûter:\n  • " + web.DateLink("du Goûter", day(0, 5), "en") + ": 2 places" + book("du Goûter", day(0, 5), "en") + "\n  • " + web.DateLink("du Goûter", day(1, 12), "en") + ": 8 places" + book("du Goûter", day(1, 12), "en") + "\n\n",
+		"2: 🎉 Neue Verfügbarkeit für dein Abonnement gefunden!\n\n" +
+			"🏔️ du Goûter:\n  • " + web.DateLink("du Goûter", day(1, 12), "de") + ": 8 Plätze" + book("du Goûter", day(1, 12), "de") + "\n\n",
+	}
+	if got := tg.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("first run sent\n%q\nwant\n%q", got, want)
+	}
+
+	// second run: a new Tête Rousse date, the du Goûter one filled up; only the new date is sent
+	ffcam.setRun("run2")
+	cs.RunOnce(context.Background())
+	want = []string{
+		"1: 🎉 New availability found for your subscription!\n\n" +
+			"🏔️ Tête Rousse:\n  • " + web.DateLink("Tête Rousse", day(0, 20), "en") + ": 3 places" + book("Tête Rousse", day(0, 20), "en") + "\n\n",
+	}
+	if got := tg.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("second run sent\n%q\nwant\n%q", got, want)
+	}
+
+	// the JSON API serves the merged snapshot of the second run
+	resp, err := http.Get(site.URL + "/api/v1/availability")
+	if err != nil {
+		t.Fatalf("GET /api/v1/availability: %v", err)
+	}
+	defer resp.Body.Close()
+	var api struct {
+		Refuges []struct {
+			Name  string            `json:"name"`
+			Dates map[string]string `json:"dates"`
+		} `json:"refuges"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&api); err != nil {
+		t.Fatalf("decode availability: %v", err)
+	}
+	gotDates := map[string]map[string]string{}
+	for _, rf := range api.Refuges {
+		gotDates[rf.Name] = rf.Dates
+	}
+	wantDates := map[string]map[string]string{
+		"Tête Rousse": {day(0, 3): "5", day(0, 10): "Full", day(0, 20): "3"},
+		"du Goûter":   {day(0, 5): "Full", day(1, 12): "8"},
+	}
+	if !reflect.DeepEqual(gotDates, wantDates) {
+		t.Errorf("API dates = %v, want %v", gotDates, wantDates)
+	}
+
+	// history: every alerted date is remembered per subscriber, and the alerts are logged
+	var notified []string
+	for _, chatID := range []string{"1", "2"} {
+		ds, _ := st.ListNotifiedDates(t.Context(), chatID)
+		for _, d := range ds {
+			notified = append(notified, d.ChatID+" "+d.Date+" "+d.Refuge)
+		}
+	}
+	sort.Strings(notified)
+	if want := []string{"1 " + day(0, 3) + " Tête Rousse", "1 " + day(0, 5) + " du Goûter", "1 " + day(0, 20) + " Tête Rousse", "1 " + day(1, 12) + " du Goûter", "2 " + day(1, 12) + " du Goûter"}; !reflect.DeepEqual(notified, want) {
+		t.Errorf("notified dates = %v, want %v", notified, want)
+	}
+	for chatID, n := range map[string]int{"1": 2, "2": 1} {
+		if got := cs.week.week(chatID).Alerts; got != n {
+			t.Errorf("alerts logged for %s = %d, want %d", chatID, got, n)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// SendTestAlert sends chatID an alert about a made-up date matching its first active query, or
+// any refuge when it has none, rendered and delivered like a real alert (language, email,
+// snooze, daily digest, quiet hours) and labeled as a test. It ignores the alert history and records
+// nothing. It returns where the alert went, to show the user.
+func (s *Scheduler) SendTestAlert(ctx context.Context, chatID string) (string, error) {
+	sub, err := s.store.GetSubscriber(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+	qs, err := s.store.ListQueriesByChat(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+	lang := i18n.Supported(sub.Language)
+	avail := testAvailability(activeQueries(qs), s.now())
+	body, dates := alertFor([]store.Query{{Refuge: "*", Pax: avail.pax}}, []availability{avail}, lang)
+	label := i18n.T(lang, "notif_test") + "\n\n"
+
+	// a queue of its own, flushed right away; no remind buttons, which would be about a made-up date
+	queue := &deliveryQueue{}
+	sent, err := s.sendAlert(ctx, sub, i18n.T(lang, "notif_new")+"\n\n", label+body, label+emailAlert(dates, lang), queue.add)
+	if err != nil {
+		return "", err
+	}
+	queue.flush(ctx, s.store, s.notify)
+	flushed, _ := queue.stats()
+
+	var report []string
+	if sent.emailed {
+		report = append(report, "emailed to "+sub.Email)
+	} else if sub.Email != "" && s.notify.Email != nil && sent.held == "" {
+		report = append(report, "email to "+sub.Email+" failed")
+	}
+	switch {
+	case !sent.chat:
+	case sent.held == store.MissSnoozed:
+		report = append(report, fmt.Sprintf("held for Telegram until your snooze ends (%s UTC)", sub.SnoozedUntil.UTC().Format("2006-01-02 15:04")))
+	case sent.held == store.MissDigest:
+		report = append(report, "held for your daily digest")
+	case sent.held == store.MissQuietHours:
+		report = append(report, "held for Telegram until your quiet hours end ("+sub.QuietUntil(s.now()).Format("2006-01-02 15:04 MST")+")")
+	case flushed == 1:
+		report = append(report, "sent to Telegram")
+	default:
+		report = append(report, "Telegram delivery failed")
+	}
+	return fmt.Sprintf("🧪 Test alert about %s on %s: %s.", avail.refuge, avail.day.Key(), strings.Join(report, ", ")), nil
+}
+
+// testAvailability makes up an available date for a test alert: at the refuge of the first of qs,
+// on the first day from tomorrow it matches, for its group size and with its minimum places
+func testAvailability(qs []store.Query, now time.Time) availability {
+	q := store.Query{Refuge: "*"}
+	if len(qs) > 0 {
+		q = qs[0]
+	}
+	refuge := q.Refuge
+	if refuge == "*" {
+		refuge = parser.Refuges()[0].Name
+	}
+	y, m, d := now.UTC().Date()
+	day := time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+	if from, err := time.Parse("2006-01-02", q.DateFrom); err == nil && from.After(day) {
+		day = from
+	}
+	// a window in the past or without its weekdays keeps the first candidate
+	for candidate, i := day, 0; i < 366; candidate, i = candidate.AddDate(0, 0, 1), i+1 {
+		if key := candidate.Format("2006-01-02"); q.InWindow(key) && q.OnWeekday(key) {
+			day = candidate
+			break
+		}
+	}
+	return availability{
+		refuge: refuge,
+		day:    parser.DayAvailability{Date: day, Places: max(q.MinPlaces, 2), Status: parser.StatusAvailable},
+		pax:    q.Pax,
+	}
+}
@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestSendTestAlertBypassesTheAlertHistory(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "de", IsActive: true})
+	// the first Saturday of the window, alerted already
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-07-04", DateTo: "2025-07-31", Weekdays: store.WeekdaysOf(time.Saturday), MinPlaces: 3})
+	st.RecordNotification(t.Context(), store.Notification{ChatID: "1", Refuge: "Tête Rousse", Date: "2025-07-05", Places: 4, Channel: store.ChannelTelegram})
+	sent := map[string][]string{}
+	s := newTestScheduler(st, nil, sent)
+
+	report, err := s.SendTestAlert(t.Context(), "1")
+	if err != nil {
+		t.Fatalf("SendTestAlert: %v", err)
+	}
+	if want := "🧪 Test alert about Tête Rousse on 2025-07-05: sent to Telegram."; report != want {
+		t.Errorf("report %q, want %q", report, want)
+	}
+	// rendered like the real alert, in the subscriber's language
+	avail := availability{refuge: "Tête Rousse", day: parser.DayAvailability{Date: time.Date(2025, 7, 5, 0, 0, 0, 0, time.UTC), Places: 3, Status: parser.StatusAvailable}}
+	body, _ := alertFor([]store.Query{{Refuge: "Tête Rousse"}}, []availability{avail}, "de")
+	want := i18n.T("de", "notif_new") + "\n\n" + i18n.T("de", "notif_test") + "\n\n" + body
+	if len(sent["1"]) != 1 || sent["1"][0] != want {
+		t.Errorf("sent %q, want %q", sent["1"], want)
+	}
+	// nothing recorded: the next check still alerts about real dates
+	if ns, _ := st.ListNotifiedDates(t.Context(), "1"); len(ns) != 1 || ns[0].Places != 4 {
+		t.Errorf("alert history changed by the test alert: %+v", ns)
+	}
+}
+
+func TestSendTestAlertIsLabeledInEveryLanguage(t *testing.T) {
+	for _, lang := range i18n.Languages() {
+		st := store.NewMemory()
+		st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: lang, IsActive: true})
+		sent := map[string][]string{}
+		if _, err := newTestScheduler(st, nil, sent).SendTestAlert(t.Context(), "1"); err != nil {
+			t.Fatalf("SendTestAlert in %s: %v", lang, err)
+		}
+		label := i18n.T(lang, "notif_test")
+		if !strings.Contains(label, "TEST") || (lang != "en" && label == i18n.T("en", "notif_test")) {
+			t.Errorf("%s label %q", lang, label)
+		}
+		if len(sent["1"]) != 1 || !strings.Contains(sent["1"][0], label) {
+			t.Errorf("%s test alert %q isn't labeled", lang, sent["1"])
+		}
+	}
+}
+
+func TestSendTestAlertFollowsTheSubscriberSettings(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "mail", Language: "en", IsActive: true, Email: "alice@example.org", EmailOnly: true})
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "night", Language: "en", IsActive: true, QuietFrom: "06:00", QuietTo: "09:00"})
+	sent := map[string][]string{}
+	s := newTestScheduler(st, nil, sent)
+	s.notify.Email = notify.Func(func(_ context.Context, to string, message string) error {
+		sent[to] = append(sent[to], message)
+		return nil
+	})
+
+	report, err := s.SendTestAlert(t.Context(), "mail")
+	if err != nil || report != "🧪 Test alert about Tête Rousse on 2025-07-02: emailed to alice@example.org." {
+		t.Errorf("email-only report %q, %v", report, err)
+	}
+	if len(sent["alice@example.org"]) != 1 || !strings.HasPrefix(sent["alice@example.org"][0], i18n.T("en", "notif_test")) || len(sent["mail"]) != 0 {
+		t.Errorf("expected the labeled alert emailed alone, got %q", sent)
+	}
+
+	report, err = s.SendTestAlert(t.Context(), "night")
+	if err != nil || !strings.Contains(report, "held for Telegram until your quiet hours end (2025-07-01 09:00 UTC)") {
+		t.Errorf("quiet hours report %q, %v", report, err)
+	}
+	if len(sent["night"]) != 0 {
+		t.Errorf("test alert sent during quiet hours: %q", sent["night"])
+	}
+	if msgs, _ := st.ListDueMessages(t.Context(), time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC)); len(msgs) != 1 || !strings.Contains(msgs[0].Text, "TEST") {
+		t.Errorf("expected the labeled test alert in the digest, got %+v", msgs)
+	}
+
+	if _, err := s.SendTestAlert(t.Context(), "unknown"); err != store.ErrNotFound {
+		t.Errorf("unknown chat: %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// windowDiff compares the previous check with res over the anchored months. Dates of other
+// months (rolled out of the window) and refuges that failed this check are left out, so an
+// incomplete fetch doesn't look like dates vanishing.
+func windowDiff(prev []parser.Refuge, res parser.Result, anchors []time.Time) parser.RefugeDiff {
+	months := make(map[string]bool, len(anchors))
+	for _, a := range anchors {
+		months[a.Format("2006-01")] = true
+	}
+	inWindow := func(rs []parser.Refuge) []parser.Refuge {
+		out := make([]parser.Refuge, 0, len(rs))
+		for _, rf := range rs {
+			if _, failed := res.Errors[rf.Name]; failed {
+				continue
+			}
+			dates := make(map[string]string, len(rf.Dates))
+			for d, raw := range rf.Dates {
+				if len(d) >= 7 && months[d[:7]] {
+					dates[d] = raw
+				}
+			}
+			out = append(out, parser.Refuge{Name: rf.Name, Dates: dates})
+		}
+		return out
+	}
+	return parser.DiffRefuges(inWindow(prev), inWindow(res.Refuges))
+}
+
+// carryOver returns what the next check is compared with: the refuges of res, plus the
+// previous data of refuges that failed this check
+func carryOver(prev []parser.Refuge, res parser.Result) []parser.Refuge {
+	next := append([]parser.Refuge{}, res.Refuges...)
+	fetched := make(map[string]bool, len(res.Refuges))
+	for _, rf := range res.Refuges {
+		fetched[rf.Name] = true
+	}
+	for _, rf := range prev {
+		if _, failed := res.Errors[rf.Name]; failed && !fetched[rf.Name] {
+			next = append(next, rf)
+		}
+	}
+	return next
+}
+
+// logDiff logs what changed since the previous check, one line per date
+func logDiff(d parser.RefugeDiff) {
+	if d.Empty() {
+		slog.Info("no availability changes since the last check")
+		return
+	}
+	for _, c := range d.Added {
+		slog.Info("date added", "refuge", c.Refuge, "date", c.Date, "new", c.New)
+	}
+	for _, c := range d.Changed {
+		slog.Info("date changed", "refuge", c.Refuge, "date", c.Date, "old", c.Old, "new", c.New)
+	}
+	for _, c := range d.Removed {
+		slog.Info("date removed", "refuge", c.Refuge, "date", c.Date, "old", c.Old)
+	}
+}
+
+// goneStore is the part of the store notifyVanished uses
+type goneStore interface {
+	fanOutStore
+	ListAlertedChats(ctx context.Context, refuge string, date string) ([]string, error)
+	LogNotification(ctx context.Context, e store.NotificationLogEntry) error
+}
+
+// notifyVanished tells the subscribers alerted about a date that is now vanished that its places
+// are gone, one message per subscriber, when a query of theirs matching it has NotifyOnGone.
+// Whom was alerted comes from the notification log, where the follow-up is logged in turn.
+// Snoozed subscribers are skipped: the news would be stale by the time they read it. It returns
+// how many subscribers were notified.
+func notifyVanished(ctx context.Context, st goneStore, vanished []parser.DateChange, now time.Time, send func(chatID string, text string) error) int {
+	alerted := make(map[string][]parser.DateChange) // chat ID -> vanished dates it was alerted about
+	for _, c := range vanished {
+		chats, err := st.ListAlertedChats(ctx, c.Refuge, c.Date)
+		if err != nil {
+			slog.Error("failed to list alerted chats", "refuge", c.Refuge, "date", c.Date, "error", err)
+			continue
+		}
+		for _, chatID := range chats {
+			alerted[chatID] = append(alerted[chatID], c)
+		}
+	}
+	if len(alerted) == 0 {
+		return 0
+	}
+	subs, err := st.ListSubscribers(ctx)
+	if err != nil {
+		slog.Error("failed to list subscribers for vanished dates", "error", err)
+		return 0
+	}
+	queries, err := st.ListAllQueries(ctx)
+	if err != nil {
+		slog.Error("failed to list queries for vanished dates", "error", err)
+		return 0
+	}
+	queriesByChat := make(map[string][]store.Query)
+	for _, q := range queries {
+		queriesByChat[q.ChatID] = append(queriesByChat[q.ChatID], q)
+	}
+	notified := 0
+	for _, sub := range subs {
+		if len(alerted[sub.ChatID]) == 0 || sub.IsSnoozed(now) {
+			continue
+		}
+		lang := i18n.Supported(sub.Language)
+		var lines []string
+		var gone []parser.DateChange
+		for _, c := range alerted[sub.ChatID] {
+			for _, q := range queriesByChat[sub.ChatID] {
+				if q.NotifyOnGone && q.Matches(c.Refuge, c.Date) {
+					lines = append(lines, fmt.Sprintf(i18n.T(lang, "notif_gone"), telegram.EscapeHTML(c.Date), telegram.EscapeHTML(c.Refuge)))
+					gone = append(gone, c)
+					break
+				}
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		if err := send(sub.ChatID, strings.Join(lines, "\n")); err != nil {
+			slog.Error("failed to send vanished dates", "chat_id", sub.ChatID, "error", err)
+			continue
+		}
+		for _, c := range gone {
+			e := store.NotificationLogEntry{ChatID: sub.ChatID, Kind: store.KindAlert, Status: store.StatusGone, Refuge: c.Refuge, Date: c.Date, At: now}
+			if err := st.LogNotification(ctx, e); err != nil {
+				slog.Error("failed to log vanished date", "chat_id", sub.ChatID, "refuge", c.Refuge, "date", c.Date, "error", err)
+			}
+		}
+		notified++
+	}
+	return notified
+}
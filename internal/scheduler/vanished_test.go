@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestWindowDiffIgnoresFailedRefugesAndOldMonths(t *testing.T) {
+	anchors := []time.Time{time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)}
+	prev := []parser.Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-07-31": "2", "2025-08-03": "2", "2025-09-01": "Full"}},
+		{Name: "du Goûter", Dates: map[string]string{"2025-08-10": "3"}},
+	}
+	res := parser.Result{
+		Refuges: []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-08-03": "Full", "2025-09-01": "Full"}}},
+		Errors:  map[string]error{"du Goûter": errors.New("du Goûter 2025-08: boom")},
+	}
+
+	// July rolled out of the window and du Goûter failed: only the booked-out date is a change
+	d := windowDiff(prev, res, anchors)
+	want := []parser.DateChange{{Refuge: "Tête Rousse", Date: "2025-08-03", Old: "2", New: "Full"}}
+	if !reflect.DeepEqual(d.Vanished(), want) || len(d.Removed) != 0 || len(d.Added) != 0 {
+		t.Errorf("unexpected diff %+v", d)
+	}
+
+	// du Goûter's last known dates are kept to compare the next check with
+	next := carryOver(prev, res)
+	if len(next) != 2 || next[1].Name != "du Goûter" || next[1].Dates["2025-08-10"] != "3" {
+		t.Errorf("expected the failed refuge carried over, got %+v", next)
+	}
+}
+
+func TestNotifyVanished(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	st := store.NewMemory()
+	for _, sub := range []store.Subscriber{
+		{ChatID: "1", Language: "en", IsActive: true},
+		{ChatID: "2", Language: "fr", IsActive: true},
+		{ChatID: "3", Language: "en", IsActive: true, SnoozedUntil: now.Add(time.Hour)},
+		{ChatID: "4", Language: "en", IsActive: true},
+		{ChatID: "5", Language: "en", IsActive: true},
+	} {
+		st.UpsertSubscriber(t.Context(), sub)
+	}
+	for _, q := range []store.Query{
+		{ChatID: "1", Refuge: "Tête Rousse", NotifyOnGone: true},
+		{ChatID: "2", Refuge: "*", DateFrom: "2025-08-03", DateTo: "2025-08-03", NotifyOnGone: true},
+		{ChatID: "3", Refuge: "*", NotifyOnGone: true},
+		{ChatID: "4", Refuge: "Tête Rousse"}, // alerted, but didn't opt in
+		{ChatID: "5", Refuge: "Tête Rousse", NotifyOnGone: true},
+	} {
+		st.AddQuery(t.Context(), q)
+	}
+	alerted := func(chatID string, status string) {
+		st.LogNotification(t.Context(), store.NotificationLogEntry{ChatID: chatID, Kind: store.KindAlert, Status: status, Refuge: "Tête Rousse", Date: "2025-08-03", At: now.Add(-time.Hour)})
+	}
+	for _, chatID := range []string{"1", "2", "3", "4"} {
+		alerted(chatID, store.StatusAlerted)
+	}
+	// chat 5 was alerted and already told it's gone
+	alerted("5", store.StatusAlerted)
+	alerted("5", store.StatusGone)
+
+	vanished := []parser.DateChange{
+		{Refuge: "Tête Rousse", Date: "2025-08-03", Old: "2", New: "Full"},
+		{Refuge: "Tête Rousse", Date: "2025-08-04", Old: "1"}, // nobody was alerted about it
+	}
+	sent := map[string]string{}
+	send := func(chatID string, text string) error {
+		sent[chatID] = text
+		return nil
+	}
+	n := notifyVanished(t.Context(), st, vanished, now, send)
+	want := map[string]string{
+		"1": "❌ 2025-08-03 at Tête Rousse is no longer available",
+		"2": "❌ 2025-08-03 à Tête Rousse n'est plus disponible",
+	}
+	if n != 2 || !reflect.DeepEqual(sent, want) {
+		t.Errorf("expected %v, got %d notified: %v", want, n, sent)
+	}
+
+	// the follow-up is logged: nobody is told twice
+	sent = map[string]string{}
+	if n := notifyVanished(t.Context(), st, vanished, now, send); n != 0 || len(sent) != 0 {
+		t.Errorf("expected no repeated follow-up, got %d notified: %v", n, sent)
+	}
+}
@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/summary"
+)
+
+// weekLog keeps a rolling seven-day record of checks, openings and alerts for weekly summaries
+type weekLog struct {
+	mu       sync.Mutex
+	checks   []time.Time
+	openings map[string]summary.Opening // refuge|date -> latest opening
+	alerts   map[string][]time.Time     // chatID -> alert times
+}
+
+func newWeekLog() *weekLog {
+	return &weekLog{openings: map[string]summary.Opening{}, alerts: map[string][]time.Time{}}
+}
+
+// recordCheck records a completed check and the dates that had free places
+func (w *weekLog) recordCheck(refuges []parser.Refuge, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.checks = append(w.checks, now)
+	for _, rf := range refuges {
+		for _, day := range rf.Days() {
+			if !day.Available() {
+				continue
+			}
+			w.openings[rf.Name+"|"+day.Key()] = summary.Opening{Refuge: rf.Name, Date: day.Key(), Places: day.Places, SeenAt: now}
+		}
+	}
+	w.prune(now)
+}
+
+// recordAlert records an availability alert sent to chatID
+func (w *weekLog) recordAlert(chatID string, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.alerts[chatID] = append(w.alerts[chatID], now)
+}
+
+// prune drops entries older than a week; callers hold mu
+func (w *weekLog) prune(now time.Time) {
+	cutoff := now.Add(-7 * 24 * time.Hour)
+	i := 0
+	for i < len(w.checks) && w.checks[i].Before(cutoff) {
+		i++
+	}
+	w.checks = w.checks[i:]
+	for k, o := range w.openings {
+		if o.SeenAt.Before(cutoff) {
+			delete(w.openings, k)
+		}
+	}
+	for chatID, ts := range w.alerts {
+		j := 0
+		for j < len(ts) && ts[j].Before(cutoff) {
+			j++
+		}
+		if j == len(ts) {
+			delete(w.alerts, chatID)
+		} else {
+			w.alerts[chatID] = ts[j:]
+		}
+	}
+}
+
+// week returns the summary input for chatID
+func (w *weekLog) week(chatID string) summary.Week {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wk := summary.Week{Checks: len(w.checks), Alerts: len(w.alerts[chatID])}
+	for _, o := range w.openings {
+		wk.Openings = append(wk.Openings, o)
+	}
+	return wk
+}
+
+// sendWeeklySummaries sends the weekly summary to every subscriber whose slot is now
+func sendWeeklySummaries(ctx context.Context, st store.Store, wl *weekLog, current []parser.Refuge, now time.Time, send func(chatID string, text string) error) {
+	subs, err := st.ListSubscribers(ctx)
+	if err != nil {
+		slog.Error("failed to list subscribers for weekly summaries", "error", err)
+		return
+	}
+	// the queries of every subscriber, loaded in one round trip once a summary is due
+	var queriesByChat map[string][]store.Query
+	for _, sub := range subs {
+		if sub.WeeklyOptOut || sub.IsSnoozed(now) || !summary.Due(sub.ChatID, now, sub.WeeklySentAt) {
+			continue
+		}
+		if queriesByChat == nil {
+			queries, err := st.ListAllQueries(ctx)
+			if err != nil {
+				slog.Error("failed to list queries for weekly summaries", "error", err)
+				return
+			}
+			queriesByChat = make(map[string][]store.Query)
+			for _, q := range queries {
+				queriesByChat[q.ChatID] = append(queriesByChat[q.ChatID], q)
+			}
+		}
+		qs := queriesByChat[sub.ChatID]
+		if len(qs) == 0 {
+			continue
+		}
+		if err := send(sub.ChatID, summary.Build(qs, wl.week(sub.ChatID), current)); err != nil {
+			slog.Error("failed to send weekly summary", "chat_id", sub.ChatID, "error", err)
+			continue
+		}
+		sub.WeeklySentAt = now
+		if err := st.UpsertSubscriber(ctx, sub); err != nil {
+			slog.Error("failed to record weekly summary", "chat_id", sub.ChatID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// DropTables removes the tables of s, for tests running against a real database
+func DropTables(s *PgStore) error {
+	for _, table := range []string{s.tableSubscriptions, s.tableSubscribers, s.tableOutbox, s.tableNotifLog, s.tableSettings,
+		s.tableSnapshots, s.tableSeasons, s.tableStructures, s.tableNotifications, s.tableDateSnapshots, s.tableDecisions, s.tableMigrations} {
+		if _, err := s.pool.Exec(context.Background(), `drop table if exists `+table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrate runs the migrations of s again
+func Migrate(s *PgStore) error {
+	return s.migrate(context.Background())
+}
+
+// PgMigrations is the number of Postgres migrations
+var PgMigrations = len(pgMigrations)
+
+// ForgetMigrations empties the version table of s, like a database created before it
+func ForgetMigrations(s *PgStore) error {
+	_, err := s.pool.Exec(context.Background(), `drop table `+s.tableMigrations)
+	return err
+}
+
+// SchemaVersion returns the number of migrations applied to s
+func SchemaVersion(s *PgStore) (int, error) {
+	var version int
+	err := s.pool.QueryRow(context.Background(), fmt.Sprintf(`select coalesce(max(version), 0) from %s`, s.tableMigrations)).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,614 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryURL is the DATABASE_URL of a MemoryStore
+const MemoryURL = "memory://"
+
+// MemoryStore is the Store in maps guarded by a mutex, for tests and local hacking. Nothing
+// survives a restart.
+type MemoryStore struct {
+	mu         sync.Mutex
+	subs       map[string]Subscriber
+	queries    []Query // in the order they were added
+	lastQuery  int
+	outbox     map[string]OutboxMessage
+	notifLog   []NotificationLogEntry
+	settings   map[string]string
+	settingsAt map[string]time.Time // when each setting was last written, for PurgeExpired
+	snaps      []Snapshot
+	seasons    map[int][]SeasonSummary
+	structs    []Structure
+	notified   []Notification
+	dateSnaps  []DateSnapshot
+	lastSnap   int64 // ID of the latest of dateSnaps
+	decisions  []MatchDecision
+}
+
+// NewMemory returns an empty MemoryStore
+func NewMemory() *MemoryStore {
+	return &MemoryStore{
+		subs:       map[string]Subscriber{},
+		outbox:     map[string]OutboxMessage{},
+		settings:   map[string]string{},
+		settingsAt: map[string]time.Time{},
+		seasons:    map[int][]SeasonSummary{},
+	}
+}
+
+func (s *MemoryStore) Close() error { return nil }
+
+func (s *MemoryStore) UpsertSubscriber(_ context.Context, sub Subscriber) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[sub.ChatID] = sub
+	return nil
+}
+
+func (s *MemoryStore) GetSubscriber(_ context.Context, chatID string) (Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[chatID]
+	if !ok {
+		return Subscriber{}, ErrNotFound
+	}
+	return sub, nil
+}
+
+func (s *MemoryStore) ListSubscribers(_ context.Context) ([]Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Subscriber
+	for _, sub := range s.subs {
+		if sub.IsActive {
+			res = append(res, sub)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) PageSubscribers(_ context.Context, after string, limit int) ([]Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Subscriber
+	for _, sub := range s.subs {
+		if sub.ChatID > after {
+			res = append(res, sub)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ChatID < res[j].ChatID })
+	return res[:min(len(res), limit)], nil
+}
+
+func (s *MemoryStore) CountSubscribers(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, sub := range s.subs {
+		if sub.IsActive {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) ListSubscribersByLanguage(_ context.Context, lang string) ([]Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Subscriber
+	for _, sub := range s.subs {
+		if sub.IsActive && sub.Language == lang {
+			res = append(res, sub)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) DeactivateSubscriber(_ context.Context, chatID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[chatID]
+	if !ok {
+		return nil
+	}
+	sub.IsActive, sub.LastUpdatedAt = false, time.Now()
+	s.subs[chatID] = sub
+	return nil
+}
+
+func (s *MemoryStore) AddQuery(_ context.Context, q Query) (string, error) {
+	if err := q.Validate(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// checked under the same lock as the append, so concurrent adds can't both take the last slot
+	if q.status() == QueryActive {
+		if err := queryLimitError(s.subs[q.ChatID].Plan, s.countActive(q.ChatID)); err != nil {
+			return "", err
+		}
+	}
+	if q.ID == "" {
+		s.lastQuery++
+		q.ID = fmt.Sprintf("%s-%d", q.ChatID, s.lastQuery)
+	}
+	q.Status = q.status()
+	s.queries = append(s.queries, q)
+	return q.ID, nil
+}
+
+func (s *MemoryStore) ListQueriesByChat(_ context.Context, chatID string) ([]Query, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Query
+	for _, q := range s.queries {
+		if q.ChatID == chatID {
+			res = append(res, q)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) CountQueriesByChat(_ context.Context, chatID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.countActive(chatID), nil
+}
+
+// countActive counts the active queries of chatID; the caller holds s.mu
+func (s *MemoryStore) countActive(chatID string) int {
+	n := 0
+	for _, q := range s.queries {
+		if q.ChatID == chatID && q.status() == QueryActive {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *MemoryStore) ListAllQueries(_ context.Context) ([]Query, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Query
+	for _, q := range s.queries {
+		if s.subs[q.ChatID].IsActive {
+			res = append(res, q)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ChatID < res[j].ChatID })
+	return res, nil
+}
+
+// query returns the index of the query with id, -1 when there is none; s.mu is held
+func (s *MemoryStore) query(id string) int {
+	return slices.IndexFunc(s.queries, func(q Query) bool { return q.ID == id })
+}
+
+func (s *MemoryStore) GetQuery(_ context.Context, id string) (Query, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.query(id)
+	if i < 0 {
+		return Query{}, ErrNotFound
+	}
+	return s.queries[i], nil
+}
+
+func (s *MemoryStore) DeleteQuery(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.query(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.queries = slices.Delete(s.queries, i, i+1)
+	return nil
+}
+
+func (s *MemoryStore) UpdateQuery(_ context.Context, q Query) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.query(q.ID)
+	if i < 0 || s.queries[i].ChatID != q.ChatID {
+		return ErrNotFound
+	}
+	q.CreatedAt, q.Status = s.queries[i].CreatedAt, s.queries[i].Status
+	s.queries[i] = q
+	return nil
+}
+
+func (s *MemoryStore) SetQueryNotifyOnGone(_ context.Context, id string, on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.query(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.queries[i].NotifyOnGone = on
+	return nil
+}
+
+func (s *MemoryStore) SetQueryStatus(_ context.Context, id string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.query(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.queries[i].Status = status
+	return nil
+}
+
+func (s *MemoryStore) EnqueueMessage(_ context.Context, m OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.DeliverAfter.IsZero() {
+		m.DeliverAfter = time.Now()
+	}
+	if existing, ok := s.outbox[m.ID]; ok {
+		existing.Text += m.Text
+		existing.DeliverAfter, existing.ExpiresAt = m.DeliverAfter, m.ExpiresAt
+		s.outbox[m.ID] = existing
+		return nil
+	}
+	m.CreatedAt = time.Now()
+	s.outbox[m.ID] = m
+	return nil
+}
+
+func (s *MemoryStore) ListDueMessages(_ context.Context, now time.Time) ([]OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []OutboxMessage
+	for _, m := range s.outbox {
+		if !m.DeliverAfter.After(now) {
+			res = append(res, m)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].DeliverAfter.Before(res[j].DeliverAfter) })
+	return res, nil
+}
+
+func (s *MemoryStore) DeleteMessage(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.outbox, id)
+	return nil
+}
+
+func (s *MemoryStore) LogNotification(_ context.Context, e NotificationLogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifLog = append(s.notifLog, e)
+	return nil
+}
+
+func (s *MemoryStore) CountNotifications(_ context.Context, status string, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, e := range s.notifLog {
+		if e.Status == status && !e.At.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) ListAlertedChats(_ context.Context, refuge string, date string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest := map[string]string{} // chat ID -> status of its latest entry for the date
+	var chats []string
+	for _, e := range s.notifLog {
+		if e.Refuge != refuge || e.Date != date || (e.Status != StatusAlerted && e.Status != StatusGone) {
+			continue
+		}
+		if _, ok := latest[e.ChatID]; !ok {
+			chats = append(chats, e.ChatID)
+		}
+		latest[e.ChatID] = e.Status
+	}
+	var res []string
+	for _, chatID := range chats {
+		if latest[chatID] == StatusAlerted {
+			res = append(res, chatID)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) RecordNotification(_ context.Context, n Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notified = append(s.notified, n)
+	return nil
+}
+
+func (s *MemoryStore) WasNotified(_ context.Context, chatID string, refuge string, date string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.ContainsFunc(s.notified, func(n Notification) bool {
+		return n.ChatID == chatID && n.Refuge == refuge && n.Date == date
+	}), nil
+}
+
+func (s *MemoryStore) ListNotifiedDates(_ context.Context, chatID string) ([]Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest := map[string]int{} // refuge|date -> index in res
+	var res []Notification
+	for _, n := range s.notified {
+		if n.ChatID != chatID {
+			continue
+		}
+		if i, ok := latest[n.Refuge+"|"+n.Date]; ok {
+			if !n.SentAt.Before(res[i].SentAt) {
+				res[i] = n
+			}
+			continue
+		}
+		latest[n.Refuge+"|"+n.Date] = len(res)
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) CountRecordedNotifications(_ context.Context, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, e := range s.notified {
+		if !e.SentAt.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) DeleteNotificationsBefore(_ context.Context, date string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.notified)
+	s.notified = slices.DeleteFunc(s.notified, func(e Notification) bool { return e.Date < date })
+	return n - len(s.notified), nil
+}
+
+func (s *MemoryStore) RecordMatchDecisions(_ context.Context, ds []MatchDecision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decisions = append(s.decisions, ds...)
+	return nil
+}
+
+func (s *MemoryStore) ListMatchDecisions(_ context.Context, chatID string, date string) ([]MatchDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []MatchDecision
+	for _, d := range s.decisions {
+		if d.ChatID == chatID && d.Date == date {
+			res = append(res, d)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].CheckedAt.Before(res[j].CheckedAt) })
+	return res, nil
+}
+
+func (s *MemoryStore) DeleteMatchDecisionsBefore(_ context.Context, t time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.decisions)
+	s.decisions = slices.DeleteFunc(s.decisions, func(d MatchDecision) bool { return d.CheckedAt.Before(t) })
+	return n - len(s.decisions), nil
+}
+
+func (s *MemoryStore) PurgeExpired(_ context.Context, p RetentionPolicy, before time.Time, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	expired := func(at time.Time) bool {
+		if n < limit && at.Before(before) {
+			n++
+			return true
+		}
+		return false
+	}
+	switch p.Table {
+	case "subscribers":
+		for chatID, sub := range s.subs {
+			if !sub.IsActive && expired(sub.LastUpdatedAt) {
+				delete(s.subs, chatID)
+				s.queries = slices.DeleteFunc(s.queries, func(q Query) bool { return q.ChatID == chatID })
+			}
+		}
+	case "notification_log":
+		s.notifLog = slices.DeleteFunc(s.notifLog, func(e NotificationLogEntry) bool { return expired(e.At) })
+	case "notifications":
+		s.notified = slices.DeleteFunc(s.notified, func(e Notification) bool { return expired(e.SentAt) })
+	case "match_decisions":
+		s.decisions = slices.DeleteFunc(s.decisions, func(d MatchDecision) bool { return expired(d.CheckedAt) })
+	case "outbox":
+		for id, m := range s.outbox {
+			if expired(m.CreatedAt) {
+				delete(s.outbox, id)
+			}
+		}
+	case "settings":
+		for key := range s.settings {
+			matches := slices.ContainsFunc(p.KeyPrefixes, func(prefix string) bool { return strings.HasPrefix(key, prefix) })
+			if matches && expired(s.settingsAt[key]) {
+				delete(s.settings, key)
+				delete(s.settingsAt, key)
+			}
+		}
+	default:
+		return 0, fmt.Errorf("no retention for table %q", p.Table)
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) GetSetting(_ context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.settings[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *MemoryStore) SetSetting(_ context.Context, key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[key] = value
+	s.settingsAt[key] = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) ListSettings(_ context.Context, prefix string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := map[string]string{}
+	for k, v := range s.settings {
+		if strings.HasPrefix(k, prefix) {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) RecordSnapshot(_ context.Context, sn Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snaps = append(s.snaps, sn)
+	return nil
+}
+
+func (s *MemoryStore) ListSnapshots(_ context.Context, from time.Time, to time.Time) ([]Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Snapshot
+	for _, sn := range s.snaps {
+		if !sn.ObservedAt.Before(from) && sn.ObservedAt.Before(to) {
+			res = append(res, sn)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ObservedAt.Before(res[j].ObservedAt) })
+	return res, nil
+}
+
+func (s *MemoryStore) DeleteSnapshots(_ context.Context, from time.Time, to time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.snaps)
+	s.snaps = slices.DeleteFunc(s.snaps, func(sn Snapshot) bool { return !sn.ObservedAt.Before(from) && sn.ObservedAt.Before(to) })
+	return n - len(s.snaps), nil
+}
+
+func (s *MemoryStore) SaveDateSnapshots(_ context.Context, sns []DateSnapshot) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := 0
+	for _, sn := range sns {
+		latest, known := 0, false
+		for _, prev := range s.dateSnaps {
+			if prev.Refuge == sn.Refuge && prev.Date == sn.Date {
+				latest, known = prev.Places, true
+			}
+		}
+		if known && latest == sn.Places {
+			continue
+		}
+		s.lastSnap++
+		sn.ID, sn.Previous, sn.First = s.lastSnap, latest, !known
+		s.dateSnaps = append(s.dateSnaps, sn)
+		saved++
+	}
+	return saved, nil
+}
+
+func (s *MemoryStore) ListDateSnapshots(_ context.Context, refuge string, from time.Time, to time.Time) ([]DateSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []DateSnapshot
+	for _, sn := range s.dateSnaps {
+		if sn.Refuge == refuge && !sn.CheckedAt.Before(from) && sn.CheckedAt.Before(to) {
+			res = append(res, sn)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) PageDateSnapshots(_ context.Context, p DateSnapshotPage) ([]DateSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []DateSnapshot
+	for _, sn := range s.dateSnaps {
+		if p.Includes(sn) {
+			res = append(res, sn)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CheckedAt.Equal(res[j].CheckedAt) {
+			return res[i].CheckedAt.Before(res[j].CheckedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res[:min(len(res), p.Limit)], nil
+}
+
+func (s *MemoryStore) DeleteDateSnapshotsBefore(_ context.Context, t time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.dateSnaps)
+	s.dateSnaps = slices.DeleteFunc(s.dateSnaps, func(sn DateSnapshot) bool { return sn.CheckedAt.Before(t) })
+	return n - len(s.dateSnaps), nil
+}
+
+func (s *MemoryStore) SaveSeasonSummaries(_ context.Context, season int, sums []SeasonSummary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seasons[season] = slices.Clone(sums)
+	return nil
+}
+
+func (s *MemoryStore) ListSeasonSummaries(_ context.Context, season int) ([]SeasonSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.seasons[season]), nil
+}
+
+func (s *MemoryStore) AddStructure(_ context.Context, st Structure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.structs = append(s.structs, st)
+	return nil
+}
+
+func (s *MemoryStore) ListStructures(_ context.Context) ([]Structure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.structs), nil
+}
+
+func (s *MemoryStore) DeleteStructure(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.structs, func(st Structure) bool { return st.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.structs = slices.Delete(s.structs, i, i+1)
+	return nil
+}
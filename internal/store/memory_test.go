@@ -0,0 +1,55 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/store/storetest"
+)
+
+func TestMemoryNotifications(t *testing.T) {
+	storetest.Notifications(t, store.NewMemory())
+}
+
+func TestMemoryDateSnapshots(t *testing.T) {
+	storetest.DateSnapshots(t, store.NewMemory())
+}
+
+func TestMemoryDateSnapshotPages(t *testing.T) {
+	storetest.DateSnapshotPages(t, store.NewMemory())
+}
+
+func TestMemoryQueries(t *testing.T) {
+	storetest.Queries(t, store.NewMemory())
+}
+
+func TestMemoryQueryLimits(t *testing.T) {
+	storetest.QueryLimits(t, store.NewMemory())
+}
+
+func TestMemorySubscribers(t *testing.T) {
+	storetest.Subscribers(t, store.NewMemory())
+}
+
+func TestMemorySettings(t *testing.T) {
+	storetest.Settings(t, store.NewMemory())
+}
+
+func TestMemoryMatchDecisions(t *testing.T) {
+	storetest.MatchDecisions(t, store.NewMemory())
+}
+
+func TestMemoryRetention(t *testing.T) {
+	storetest.Retention(t, store.NewMemory())
+}
+
+func TestOpenMemory(t *testing.T) {
+	st, err := store.Open(context.Background(), "memory://")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, ok := st.(*store.MemoryStore); !ok {
+		t.Errorf("expected a MemoryStore for memory://, got %T", st)
+	}
+}
@@ -2,10 +2,12 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -13,60 +15,53 @@ type PgStore struct {
 	pool               *pgxpool.Pool
 	tableSubscribers   string
 	tableSubscriptions string
+	tableOutbox        string
+	tableNotifLog      string
+	tableSettings      string
+	tableSnapshots     string
+	tableSeasons       string
+	tableStructures    string
+	tableNotifications string
+	tableDateSnapshots string
+	tableDecisions     string
+	tableMigrations    string
 }
 
+// TablePrefix is prepended to every table name (DB_TABLE_PREFIX), e.g. to share a database
+// between deployments; set it before OpenPostgres
+var TablePrefix string
+
 func OpenPostgres(ctx context.Context, url string) (*PgStore, error) {
 	pool, err := pgxpool.New(ctx, url)
 	if err != nil {
 		return nil, err
 	}
-	prefix := os.Getenv("DB_TABLE_PREFIX")
+	prefix := TablePrefix
 	s := &PgStore{
 		pool:               pool,
 		tableSubscribers:   prefix + "subscribers",
 		tableSubscriptions: prefix + "subscriptions",
+		tableOutbox:        prefix + "outbox",
+		tableNotifLog:      prefix + "notification_log",
+		tableSettings:      prefix + "settings",
+		tableSnapshots:     prefix + "availability_snapshots",
+		tableSeasons:       prefix + "season_summaries",
+		tableStructures:    prefix + "structures",
+		tableNotifications: prefix + "notifications",
+		tableDateSnapshots: prefix + "date_snapshots",
+		tableDecisions:     prefix + "match_decisions",
+		tableMigrations:    prefix + "schema_migrations",
 	}
-	if err := s.init(ctx); err != nil {
+	if err := s.migrate(ctx); err != nil {
 		pool.Close()
 		return nil, err
 	}
 	return s, nil
 }
 
-func (s *PgStore) init(ctx context.Context) error {
-	stmts := []string{
-		fmt.Sprintf(`create table if not exists %s (
-            chat_id text primary key,
-            username text,
-            first_name text,
-            last_name text,
-            language text not null default 'en',
-            plan text not null default 'free',
-            is_active boolean not null default true,
-            created_at timestamptz not null default now(),
-            updated_at timestamptz not null default now()
-        )`, s.tableSubscribers),
-		fmt.Sprintf(`create table if not exists %s (
-            id text primary key,
-            chat_id text not null references %s(chat_id) on delete cascade,
-            refuge text not null,
-            date_from text,
-            date_to text,
-            created_at timestamptz not null default now(),
-            updated_at timestamptz not null default now()
-        )`, s.tableSubscriptions, s.tableSubscribers),
-	}
-	for _, q := range stmts {
-		if _, err := s.pool.Exec(ctx, q); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func (s *PgStore) Close() error { s.pool.Close(); return nil }
 
-func (s *PgStore) UpsertSubscriber(sub Subscriber) error {
+func (s *PgStore) UpsertSubscriber(ctx context.Context, sub Subscriber) error {
 	now := time.Now()
 	if sub.CreatedAt.IsZero() {
 		sub.CreatedAt = now
@@ -75,37 +70,111 @@ func (s *PgStore) UpsertSubscriber(sub Subscriber) error {
 	if sub.Plan == "" {
 		sub.Plan = "free"
 	}
-	_, err := s.pool.Exec(context.Background(),
-		fmt.Sprintf(`insert into %s (chat_id, username, first_name, last_name, language, plan, is_active, created_at, updated_at)
-         values ($1,$2,$3,$4,$5,$6,$7,$8,$9)
-         on conflict (chat_id) do update set username=excluded.username, first_name=excluded.first_name, last_name=excluded.last_name, language=excluded.language, plan=excluded.plan, is_active=excluded.is_active, updated_at=excluded.updated_at`, s.tableSubscribers),
-		sub.ChatID, sub.Username, sub.FirstName, sub.LastName, sub.Language, sub.Plan, sub.IsActive, sub.CreatedAt, sub.LastUpdatedAt,
+	seasonNotified, err := json.Marshal(sub.SeasonNotified)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx,
+		fmt.Sprintf(`insert into %s (chat_id, username, first_name, last_name, language, plan, is_active, created_at, updated_at, snoozed_until, weekly_opt_out, weekly_sent_at, consent_at, consent_source, consent_version, consent_ip, notify_season_open, season_notified, email, email_only, language_locked, quiet_from, quiet_to, timezone, notify_mode)
+         values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25)
+         on conflict (chat_id) do update set username=excluded.username, first_name=excluded.first_name, last_name=excluded.last_name, language=excluded.language, plan=excluded.plan, is_active=excluded.is_active, updated_at=excluded.updated_at, snoozed_until=excluded.snoozed_until, weekly_opt_out=excluded.weekly_opt_out, weekly_sent_at=excluded.weekly_sent_at, consent_at=excluded.consent_at, consent_source=excluded.consent_source, consent_version=excluded.consent_version, consent_ip=excluded.consent_ip, notify_season_open=excluded.notify_season_open, season_notified=excluded.season_notified, email=excluded.email, email_only=excluded.email_only, language_locked=excluded.language_locked, quiet_from=excluded.quiet_from, quiet_to=excluded.quiet_to, timezone=excluded.timezone, notify_mode=excluded.notify_mode`, s.tableSubscribers),
+		sub.ChatID, sub.Username, sub.FirstName, sub.LastName, sub.Language, sub.Plan, sub.IsActive, sub.CreatedAt, sub.LastUpdatedAt, nullTime(sub.SnoozedUntil), sub.WeeklyOptOut, nullTime(sub.WeeklySentAt), nullTime(sub.ConsentAt), sub.ConsentSource, sub.ConsentVersion, sub.ConsentIP, sub.NotifyOnSeasonOpen, string(seasonNotified), nullString(sub.Email), sub.EmailOnly, sub.LanguageLocked, nullString(sub.QuietFrom), nullString(sub.QuietTo), nullString(sub.Timezone), nullString(sub.NotifyMode),
 	)
 	return err
 }
 
-func (s *PgStore) GetSubscriber(chatID string) (Subscriber, error) {
+const subscriberColumns = `chat_id, username, first_name, last_name, language, plan, is_active, created_at, updated_at, snoozed_until, weekly_opt_out, weekly_sent_at, consent_at, coalesce(consent_source, ''), coalesce(consent_version, ''), coalesce(consent_ip, ''), notify_season_open, coalesce(season_notified::text, '{}'), coalesce(email, ''), email_only, language_locked, coalesce(quiet_from, ''), coalesce(quiet_to, ''), coalesce(timezone, ''), coalesce(notify_mode, '')`
+
+// scanSubscriber scans a row selected with subscriberColumns
+func scanSubscriber(row pgx.Row) (Subscriber, error) {
 	var sub Subscriber
-	err := s.pool.QueryRow(context.Background(),
-		fmt.Sprintf(`select chat_id, username, first_name, last_name, language, plan, is_active, created_at, updated_at from %s where chat_id=$1`, s.tableSubscribers), chatID,
-	).Scan(&sub.ChatID, &sub.Username, &sub.FirstName, &sub.LastName, &sub.Language, &sub.Plan, &sub.IsActive, &sub.CreatedAt, &sub.LastUpdatedAt)
+	var snoozed, weeklySent, consent *time.Time
+	var seasonNotified string
+	if err := row.Scan(&sub.ChatID, &sub.Username, &sub.FirstName, &sub.LastName, &sub.Language, &sub.Plan, &sub.IsActive, &sub.CreatedAt, &sub.LastUpdatedAt, &snoozed, &sub.WeeklyOptOut, &weeklySent, &consent, &sub.ConsentSource, &sub.ConsentVersion, &sub.ConsentIP, &sub.NotifyOnSeasonOpen, &seasonNotified, &sub.Email, &sub.EmailOnly, &sub.LanguageLocked, &sub.QuietFrom, &sub.QuietTo, &sub.Timezone, &sub.NotifyMode); err != nil {
+		return Subscriber{}, err
+	}
+	if err := json.Unmarshal([]byte(seasonNotified), &sub.SeasonNotified); err != nil {
+		return Subscriber{}, fmt.Errorf("invalid season_notified for %s: %w", sub.ChatID, err)
+	}
+	if consent != nil {
+		sub.ConsentAt = *consent
+	}
+	if snoozed != nil {
+		sub.SnoozedUntil = *snoozed
+	}
+	if weeklySent != nil {
+		sub.WeeklySentAt = *weeklySent
+	}
+	return sub, nil
+}
+
+// nullTime maps the zero time to SQL NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// nullString maps "" to NULL
+func nullString(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+// nullInt maps 0 to NULL
+func nullInt(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+func (s *PgStore) GetSubscriber(ctx context.Context, chatID string) (Subscriber, error) {
+	sub, err := scanSubscriber(s.pool.QueryRow(ctx,
+		fmt.Sprintf(`select %s from %s where chat_id=$1`, subscriberColumns, s.tableSubscribers), chatID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Subscriber{}, ErrNotFound
+	}
 	if err != nil {
 		return Subscriber{}, err
 	}
 	return sub, nil
 }
 
-func (s *PgStore) ListSubscribers() ([]Subscriber, error) {
-	rows, err := s.pool.Query(context.Background(),
-		fmt.Sprintf(`select chat_id, username, first_name, last_name, language, plan, is_active, created_at, updated_at from %s where is_active=true`, s.tableSubscribers))
+func (s *PgStore) ListSubscribers(ctx context.Context) ([]Subscriber, error) {
+	return s.listSubscribers(ctx, `where is_active=true`)
+}
+
+func (s *PgStore) PageSubscribers(ctx context.Context, after string, limit int) ([]Subscriber, error) {
+	return s.listSubscribers(ctx, `where chat_id > $1 order by chat_id limit $2`, after, limit)
+}
+
+func (s *PgStore) CountSubscribers(ctx context.Context) (int, error) {
+	var n int
+	err := s.pool.QueryRow(ctx, fmt.Sprintf(`select count(*) from %s where is_active=true`, s.tableSubscribers)).Scan(&n)
+	return n, err
+}
+
+func (s *PgStore) ListSubscribersByLanguage(ctx context.Context, lang string) ([]Subscriber, error) {
+	return s.listSubscribers(ctx, `where is_active=true and language=$1`, lang)
+}
+
+// listSubscribers returns the subscribers selected by the where clause (and order)
+func (s *PgStore) listSubscribers(ctx context.Context, where string, args ...any) ([]Subscriber, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select %s from %s %s`, subscriberColumns, s.tableSubscribers, where), args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var subs []Subscriber
 	for rows.Next() {
-		var sub Subscriber
-		if err := rows.Scan(&sub.ChatID, &sub.Username, &sub.FirstName, &sub.LastName, &sub.Language, &sub.Plan, &sub.IsActive, &sub.CreatedAt, &sub.LastUpdatedAt); err != nil {
+		sub, err := scanSubscriber(rows)
+		if err != nil {
 			return nil, err
 		}
 		subs = append(subs, sub)
@@ -113,40 +182,585 @@ func (s *PgStore) ListSubscribers() ([]Subscriber, error) {
 	return subs, rows.Err()
 }
 
-func (s *PgStore) DeactivateSubscriber(chatID string) error {
-	_, err := s.pool.Exec(context.Background(), fmt.Sprintf(`update %s set is_active=false, updated_at=now() where chat_id=$1`, s.tableSubscribers), chatID)
+func (s *PgStore) DeactivateSubscriber(ctx context.Context, chatID string) error {
+	_, err := s.pool.Exec(ctx, fmt.Sprintf(`update %s set is_active=false, updated_at=now() where chat_id=$1`, s.tableSubscribers), chatID)
 	return err
 }
 
-func (s *PgStore) AddQuery(q Query) (string, error) {
+func (s *PgStore) AddQuery(ctx context.Context, q Query) (string, error) {
+	if err := q.Validate(); err != nil {
+		return "", err
+	}
 	if q.ID == "" {
 		q.ID = q.ChatID + "-" + time.Now().Format("20060102150405.000000000")
 	}
-	_, err := s.pool.Exec(context.Background(),
-		fmt.Sprintf(`insert into %s (id, chat_id, refuge, date_from, date_to, created_at, updated_at)
-         values ($1,$2,$3,$4,$5, now(), now())`, s.tableSubscriptions),
-		q.ID, q.ChatID, q.Refuge, q.DateFrom, q.DateTo,
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+	if q.status() == QueryActive {
+		// concurrent adds for the chat wait for this one to commit before counting, even when the
+		// chat has no subscriber row to lock
+		if _, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtext($1))`, s.tableSubscriptions+":"+q.ChatID); err != nil {
+			return "", err
+		}
+		var plan string
+		var n int
+		if err := tx.QueryRow(ctx, fmt.Sprintf(`select coalesce((select plan from %s where chat_id=$1), ''), (select count(*) from %s where chat_id=$1 and status='active')`, s.tableSubscribers, s.tableSubscriptions), q.ChatID).Scan(&plan, &n); err != nil {
+			return "", err
+		}
+		if err := queryLimitError(plan, n); err != nil {
+			return "", err
+		}
+	}
+	_, err = tx.Exec(ctx,
+		fmt.Sprintf(`insert into %s (id, chat_id, refuge, date_from, date_to, min_places, weekdays, label, notify_on_gone, pax, one_shot, status, created_at, updated_at)
+         values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12, now(), now())`, s.tableSubscriptions),
+		q.ID, q.ChatID, q.Refuge, nullString(q.DateFrom), nullString(q.DateTo), nullInt(q.MinPlaces), nullInt(int(q.Weekdays)), q.Label, q.NotifyOnGone, nullInt(q.Pax), q.OneShot, q.status(),
 	)
 	if err != nil {
 		return "", err
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
 	return q.ID, nil
 }
 
-func (s *PgStore) ListQueriesByChat(chatID string) ([]Query, error) {
-	rows, err := s.pool.Query(context.Background(),
-		fmt.Sprintf(`select id, chat_id, refuge, date_from, date_to, created_at, updated_at from %s where chat_id=$1`, s.tableSubscriptions), chatID)
+// queryColumns renders the date columns as YYYY-MM-DD text, so no time zone gets in the way
+const queryColumns = `id, chat_id, refuge, coalesce(to_char(date_from, 'YYYY-MM-DD'), ''), coalesce(to_char(date_to, 'YYYY-MM-DD'), ''), coalesce(min_places, 0), coalesce(weekdays, 0), coalesce(label, ''), notify_on_gone, coalesce(pax, 0), one_shot, status, created_at, updated_at`
+
+// scanQuery scans a row selected with queryColumns
+func scanQuery(row pgx.Row) (Query, error) {
+	var q Query
+	var weekdays int
+	err := row.Scan(&q.ID, &q.ChatID, &q.Refuge, &q.DateFrom, &q.DateTo, &q.MinPlaces, &weekdays, &q.Label, &q.NotifyOnGone, &q.Pax, &q.OneShot, &q.Status, &q.CreatedAt, &q.LastUpdatedAt)
+	q.Weekdays = Weekdays(weekdays)
+	return q, err
+}
+
+func (s *PgStore) listQueries(ctx context.Context, where string, args ...any) ([]Query, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select %s from %s %s`, queryColumns, s.tableSubscriptions, where), args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var res []Query
 	for rows.Next() {
-		var q Query
-		if err := rows.Scan(&q.ID, &q.ChatID, &q.Refuge, &q.DateFrom, &q.DateTo, &q.CreatedAt, &q.LastUpdatedAt); err != nil {
+		q, err := scanQuery(rows)
+		if err != nil {
 			return nil, err
 		}
 		res = append(res, q)
 	}
 	return res, rows.Err()
 }
+
+func (s *PgStore) ListQueriesByChat(ctx context.Context, chatID string) ([]Query, error) {
+	return s.listQueries(ctx, `where chat_id=$1`, chatID)
+}
+
+func (s *PgStore) CountQueriesByChat(ctx context.Context, chatID string) (int, error) {
+	var n int
+	err := s.pool.QueryRow(ctx, fmt.Sprintf(`select count(*) from %s where chat_id=$1 and status=$2`, s.tableSubscriptions), chatID, QueryActive).Scan(&n)
+	return n, err
+}
+
+// ListAllQueries returns the queries of all active subscribers in one round trip
+func (s *PgStore) ListAllQueries(ctx context.Context) ([]Query, error) {
+	return s.listQueries(ctx, fmt.Sprintf(`where chat_id in (select chat_id from %s where is_active=true) order by chat_id`, s.tableSubscribers))
+}
+
+func (s *PgStore) GetQuery(ctx context.Context, id string) (Query, error) {
+	q, err := scanQuery(s.pool.QueryRow(ctx,
+		fmt.Sprintf(`select %s from %s where id=$1`, queryColumns, s.tableSubscriptions), id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Query{}, ErrNotFound
+	}
+	if err != nil {
+		return Query{}, err
+	}
+	return q, nil
+}
+
+func (s *PgStore) DeleteQuery(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, fmt.Sprintf(`delete from %s where id=$1`, s.tableSubscriptions), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PgStore) UpdateQuery(ctx context.Context, q Query) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	tag, err := s.pool.Exec(ctx,
+		fmt.Sprintf(`update %s set refuge=$3, date_from=$4, date_to=$5, min_places=$6, weekdays=$7, label=$8, notify_on_gone=$9, pax=$10, one_shot=$11, updated_at=now()
+         where id=$1 and chat_id=$2`, s.tableSubscriptions),
+		q.ID, q.ChatID, q.Refuge, nullString(q.DateFrom), nullString(q.DateTo), nullInt(q.MinPlaces), nullInt(int(q.Weekdays)), q.Label, q.NotifyOnGone, nullInt(q.Pax), q.OneShot,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PgStore) SetQueryNotifyOnGone(ctx context.Context, id string, on bool) error {
+	tag, err := s.pool.Exec(ctx, fmt.Sprintf(`update %s set notify_on_gone=$2, updated_at=now() where id=$1`, s.tableSubscriptions), id, on)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PgStore) SetQueryStatus(ctx context.Context, id string, status string) error {
+	tag, err := s.pool.Exec(ctx, fmt.Sprintf(`update %s set status=$2, updated_at=now() where id=$1`, s.tableSubscriptions), id, status)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PgStore) EnqueueMessage(ctx context.Context, m OutboxMessage) error {
+	if m.DeliverAfter.IsZero() {
+		m.DeliverAfter = time.Now()
+	}
+	_, err := s.pool.Exec(ctx,
+		fmt.Sprintf(`insert into %s (id, chat_id, text, kind, deliver_after, expires_at, refuge, date, created_at)
+         values ($1,$2,$3,$4,$5,$6,$7,$8, now())
+         on conflict (id) do update set text=%s.text || excluded.text, deliver_after=excluded.deliver_after, expires_at=excluded.expires_at`, s.tableOutbox, s.tableOutbox),
+		m.ID, m.ChatID, m.Text, m.Kind, m.DeliverAfter, nullTime(m.ExpiresAt), nullString(m.Refuge), nullString(m.Date),
+	)
+	return err
+}
+
+func (s *PgStore) ListDueMessages(ctx context.Context, now time.Time) ([]OutboxMessage, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select id, chat_id, text, kind, deliver_after, expires_at, coalesce(refuge, ''), coalesce(date, ''), created_at from %s where deliver_after <= $1 order by deliver_after`, s.tableOutbox), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		var expires *time.Time
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.Text, &m.Kind, &m.DeliverAfter, &expires, &m.Refuge, &m.Date, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expires != nil {
+			m.ExpiresAt = *expires
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
+
+func (s *PgStore) DeleteMessage(ctx context.Context, id string) error {
+	_, err := s.pool.Exec(ctx, fmt.Sprintf(`delete from %s where id=$1`, s.tableOutbox), id)
+	return err
+}
+
+func (s *PgStore) LogNotification(ctx context.Context, e NotificationLogEntry) error {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	_, err := s.pool.Exec(ctx,
+		fmt.Sprintf(`insert into %s (chat_id, message_id, kind, status, refuge, date, at) values ($1,$2,$3,$4,$5,$6,$7)`, s.tableNotifLog),
+		e.ChatID, e.MessageID, e.Kind, e.Status, nullString(e.Refuge), nullString(e.Date), e.At,
+	)
+	return err
+}
+
+func (s *PgStore) CountNotifications(ctx context.Context, status string, since time.Time) (int, error) {
+	var n int
+	err := s.pool.QueryRow(ctx,
+		fmt.Sprintf(`select count(*) from %s where status=$1 and at >= $2`, s.tableNotifLog), status, since).Scan(&n)
+	return n, err
+}
+
+func (s *PgStore) ListAlertedChats(ctx context.Context, refuge string, date string) ([]string, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select chat_id from (
+            select distinct on (chat_id) chat_id, status from %s
+            where refuge=$1 and date=$2 and status in ($3, $4)
+            order by chat_id, at desc, id desc
+        ) latest where status=$3`, s.tableNotifLog), refuge, date, StatusAlerted, StatusGone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []string
+	for rows.Next() {
+		var chatID string
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		res = append(res, chatID)
+	}
+	return res, rows.Err()
+}
+
+func (s *PgStore) GetSetting(ctx context.Context, key string) (string, error) {
+	var v string
+	err := s.pool.QueryRow(ctx, fmt.Sprintf(`select value from %s where key=$1`, s.tableSettings), key).Scan(&v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return v, err
+}
+
+func (s *PgStore) PurgeExpired(ctx context.Context, p RetentionPolicy, before time.Time, limit int) (int, error) {
+	column, err := retentionColumn(p)
+	if err != nil {
+		return 0, err
+	}
+	table := map[string]string{
+		"subscribers":      s.tableSubscribers,
+		"notification_log": s.tableNotifLog,
+		"notifications":    s.tableNotifications,
+		"match_decisions":  s.tableDecisions,
+		"outbox":           s.tableOutbox,
+		"settings":         s.tableSettings,
+	}[p.Table]
+	where := column + ` < $1`
+	args := []any{before, limit}
+	if p.Table == "subscribers" {
+		// their queries go along, by the foreign key
+		where += ` and not is_active`
+	}
+	if len(p.KeyPrefixes) > 0 {
+		where += ` and exists (select 1 from unnest($3::text[]) prefix where starts_with(key, prefix))`
+		args = append(args, p.KeyPrefixes)
+	}
+	tag, err := s.pool.Exec(ctx,
+		fmt.Sprintf(`delete from %s where ctid in (select ctid from %s where %s limit $2)`, table, table, where), args...)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PgStore) SetSetting(ctx context.Context, key string, value string) error {
+	_, err := s.pool.Exec(ctx,
+		fmt.Sprintf(`insert into %s (key, value, updated_at) values ($1,$2, now())
+         on conflict (key) do update set value=excluded.value, updated_at=excluded.updated_at`, s.tableSettings),
+		key, value,
+	)
+	return err
+}
+
+func (s *PgStore) ListSettings(ctx context.Context, prefix string) (map[string]string, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select key, value from %s where starts_with(key, $1)`, s.tableSettings), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		res[k] = v
+	}
+	return res, rows.Err()
+}
+
+func (s *PgStore) RecordNotification(ctx context.Context, n Notification) error {
+	_, err := s.pool.Exec(ctx,
+		fmt.Sprintf(`insert into %s (chat_id, refuge, date, places, sent_at, channel) values ($1,$2,$3,$4,$5,$6)`, s.tableNotifications),
+		n.ChatID, n.Refuge, n.Date, n.Places, n.SentAt, n.Channel)
+	return err
+}
+
+func (s *PgStore) WasNotified(ctx context.Context, chatID string, refuge string, date string) (bool, error) {
+	var found bool
+	err := s.pool.QueryRow(ctx,
+		fmt.Sprintf(`select exists (select 1 from %s where chat_id=$1 and refuge=$2 and date=$3)`, s.tableNotifications),
+		chatID, refuge, date).Scan(&found)
+	return found, err
+}
+
+func (s *PgStore) ListNotifiedDates(ctx context.Context, chatID string) ([]Notification, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select distinct on (refuge, date) chat_id, refuge, date, places, sent_at, channel from %s
+         where chat_id=$1 order by refuge, date, sent_at desc, id desc`, s.tableNotifications), chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ChatID, &n.Refuge, &n.Date, &n.Places, &n.SentAt, &n.Channel); err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, rows.Err()
+}
+
+func (s *PgStore) CountRecordedNotifications(ctx context.Context, since time.Time) (int, error) {
+	var n int
+	err := s.pool.QueryRow(ctx,
+		fmt.Sprintf(`select count(*) from %s where sent_at >= $1`, s.tableNotifications), since).Scan(&n)
+	return n, err
+}
+
+func (s *PgStore) DeleteNotificationsBefore(ctx context.Context, date string) (int, error) {
+	tag, err := s.pool.Exec(ctx, fmt.Sprintf(`delete from %s where date < $1`, s.tableNotifications), date)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PgStore) RecordMatchDecisions(ctx context.Context, ds []MatchDecision) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, d := range ds {
+		batch.Queue(fmt.Sprintf(`insert into %s (chat_id, refuge, date, query_id, reason, places, checked_at) values ($1,$2,$3,$4,$5,$6,$7)`, s.tableDecisions),
+			d.ChatID, d.Refuge, d.Date, nullString(d.QueryID), d.Reason, d.Places, d.CheckedAt)
+	}
+	return s.pool.SendBatch(ctx, batch).Close()
+}
+
+func (s *PgStore) ListMatchDecisions(ctx context.Context, chatID string, date string) ([]MatchDecision, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select chat_id, refuge, date, coalesce(query_id, ''), reason, places, checked_at from %s where chat_id=$1 and date=$2 order by checked_at, id`, s.tableDecisions),
+		chatID, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []MatchDecision
+	for rows.Next() {
+		var d MatchDecision
+		if err := rows.Scan(&d.ChatID, &d.Refuge, &d.Date, &d.QueryID, &d.Reason, &d.Places, &d.CheckedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+func (s *PgStore) DeleteMatchDecisionsBefore(ctx context.Context, t time.Time) (int, error) {
+	tag, err := s.pool.Exec(ctx, fmt.Sprintf(`delete from %s where checked_at < $1`, s.tableDecisions), t)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PgStore) RecordSnapshot(ctx context.Context, sn Snapshot) error {
+	open, err := json.Marshal(sn.Open)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx,
+		fmt.Sprintf(`insert into %s (refuge, observed_at, open) values ($1,$2,$3)`, s.tableSnapshots),
+		sn.Refuge, sn.ObservedAt, open,
+	)
+	return err
+}
+
+func (s *PgStore) ListSnapshots(ctx context.Context, from time.Time, to time.Time) ([]Snapshot, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select refuge, observed_at, open from %s where observed_at >= $1 and observed_at < $2 order by observed_at, id`, s.tableSnapshots), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Snapshot
+	for rows.Next() {
+		var sn Snapshot
+		var open []byte
+		if err := rows.Scan(&sn.Refuge, &sn.ObservedAt, &open); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(open, &sn.Open); err != nil {
+			return nil, err
+		}
+		res = append(res, sn)
+	}
+	return res, rows.Err()
+}
+
+func (s *PgStore) DeleteSnapshots(ctx context.Context, from time.Time, to time.Time) (int, error) {
+	tag, err := s.pool.Exec(ctx,
+		fmt.Sprintf(`delete from %s where observed_at >= $1 and observed_at < $2`, s.tableSnapshots), from, to)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PgStore) SaveDateSnapshots(ctx context.Context, sns []DateSnapshot) (int, error) {
+	if len(sns) == 0 {
+		return 0, nil
+	}
+	refuges := make([]string, len(sns))
+	dates := make([]string, len(sns))
+	places := make([]int32, len(sns))
+	checked := make([]time.Time, len(sns))
+	for i, sn := range sns {
+		refuges[i], dates[i], places[i], checked[i] = sn.Refuge, sn.Date, int32(sn.Places), sn.CheckedAt
+	}
+	// only the dates whose places changed since their latest snapshot, to keep the volume down
+	tag, err := s.pool.Exec(ctx,
+		fmt.Sprintf(`insert into %[1]s (refuge, date, places, previous, checked_at)
+         select v.refuge, v.date, v.places, p.places, v.checked_at
+         from unnest($1::text[], $2::text[], $3::int[], $4::timestamptz[]) as v(refuge, date, places, checked_at)
+         left join lateral (
+             select t.places from %[1]s t where t.refuge = v.refuge and t.date = v.date order by t.checked_at desc, t.id desc limit 1) p on true
+         where v.places is distinct from p.places`, s.tableDateSnapshots),
+		refuges, dates, places, checked)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PgStore) ListDateSnapshots(ctx context.Context, refuge string, from time.Time, to time.Time) ([]DateSnapshot, error) {
+	return s.listDateSnapshots(ctx, `where refuge = $1 and checked_at >= $2 and checked_at < $3 order by checked_at, id`, refuge, from, to)
+}
+
+func (s *PgStore) PageDateSnapshots(ctx context.Context, p DateSnapshotPage) ([]DateSnapshot, error) {
+	// (checked_at, id) > cursor walks the checked_at_id index, so pages stay cheap however deep
+	where := `where (checked_at, id) > ($1, $2) and ($3 = '' or refuge = $3) and ($4 = '' or date = $4)`
+	if p.Transitions {
+		where += ` and (previous is null or (previous = 0) <> (places = 0))`
+	}
+	return s.listDateSnapshots(ctx, where+` order by checked_at, id limit $5`, p.After, p.AfterID, p.Refuge, p.Date, p.Limit)
+}
+
+// listDateSnapshots returns the date snapshots selected by the where clause (and order)
+func (s *PgStore) listDateSnapshots(ctx context.Context, where string, args ...any) ([]DateSnapshot, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select id, refuge, date, places, previous, checked_at from %s %s`, s.tableDateSnapshots, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []DateSnapshot
+	for rows.Next() {
+		var sn DateSnapshot
+		var previous *int
+		if err := rows.Scan(&sn.ID, &sn.Refuge, &sn.Date, &sn.Places, &previous, &sn.CheckedAt); err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			sn.Previous = *previous
+		} else {
+			sn.First = true
+		}
+		res = append(res, sn)
+	}
+	return res, rows.Err()
+}
+
+func (s *PgStore) DeleteDateSnapshotsBefore(ctx context.Context, t time.Time) (int, error) {
+	tag, err := s.pool.Exec(ctx, fmt.Sprintf(`delete from %s where checked_at < $1`, s.tableDateSnapshots), t)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PgStore) SaveSeasonSummaries(ctx context.Context, season int, sums []SeasonSummary) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`delete from %s where season=$1`, s.tableSeasons), season); err != nil {
+		return err
+	}
+	for _, sum := range sums {
+		if _, err := tx.Exec(ctx,
+			fmt.Sprintf(`insert into %s (season, refuge, days_monitored, windows, median_window_seconds, cancellations, busiest_weekday)
+         values ($1,$2,$3,$4,$5,$6,$7)`, s.tableSeasons),
+			season, sum.Refuge, sum.DaysMonitored, sum.Windows, int64(sum.MedianWindow/time.Second), sum.Cancellations, int(sum.BusiestWeekday),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *PgStore) ListSeasonSummaries(ctx context.Context, season int) ([]SeasonSummary, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select refuge, days_monitored, windows, median_window_seconds, cancellations, busiest_weekday from %s where season=$1 order by refuge`, s.tableSeasons), season)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []SeasonSummary
+	for rows.Next() {
+		sum := SeasonSummary{Season: season}
+		var median int64
+		var weekday int
+		if err := rows.Scan(&sum.Refuge, &sum.DaysMonitored, &sum.Windows, &median, &sum.Cancellations, &weekday); err != nil {
+			return nil, err
+		}
+		sum.MedianWindow, sum.BusiestWeekday = time.Duration(median)*time.Second, time.Weekday(weekday)
+		res = append(res, sum)
+	}
+	return res, rows.Err()
+}
+
+func (s *PgStore) AddStructure(ctx context.Context, st Structure) error {
+	_, err := s.pool.Exec(ctx,
+		fmt.Sprintf(`insert into %s (id, name, added_by, added_at) values ($1,$2,$3,$4)`, s.tableStructures),
+		st.ID, st.Name, st.AddedBy, st.AddedAt,
+	)
+	return err
+}
+
+func (s *PgStore) ListStructures(ctx context.Context) ([]Structure, error) {
+	rows, err := s.pool.Query(ctx,
+		fmt.Sprintf(`select id, name, added_by, added_at from %s order by added_at, id`, s.tableStructures))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Structure
+	for rows.Next() {
+		var st Structure
+		if err := rows.Scan(&st.ID, &st.Name, &st.AddedBy, &st.AddedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, st)
+	}
+	return res, rows.Err()
+}
+
+func (s *PgStore) DeleteStructure(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, fmt.Sprintf(`delete from %s where id=$1`, s.tableStructures), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/store/storetest"
+)
+
+// openTestPostgres opens TEST_DATABASE_URL with tables of its own, dropped afterwards; without
+// it the test is skipped
+func openTestPostgres(t *testing.T) *store.PgStore {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	prev := store.TablePrefix
+	store.TablePrefix = fmt.Sprintf("test%d_", time.Now().UnixNano())
+	t.Cleanup(func() { store.TablePrefix = prev })
+	st, err := store.OpenPostgres(context.Background(), url)
+	if err != nil {
+		t.Fatalf("OpenPostgres: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := store.DropTables(st); err != nil {
+			t.Errorf("DropTables: %v", err)
+		}
+		st.Close()
+	})
+	return st
+}
+
+func TestPgNotifications(t *testing.T) {
+	storetest.Notifications(t, openTestPostgres(t))
+}
+
+func TestPgDateSnapshots(t *testing.T) {
+	storetest.DateSnapshots(t, openTestPostgres(t))
+}
+
+func TestPgDateSnapshotPages(t *testing.T) {
+	storetest.DateSnapshotPages(t, openTestPostgres(t))
+}
+
+func TestPgQueries(t *testing.T) {
+	storetest.Queries(t, openTestPostgres(t))
+}
+
+func TestPgQueryLimits(t *testing.T) {
+	storetest.QueryLimits(t, openTestPostgres(t))
+}
+
+func TestPgSubscribers(t *testing.T) {
+	storetest.Subscribers(t, openTestPostgres(t))
+}
+
+func TestPgSettings(t *testing.T) {
+	storetest.Settings(t, openTestPostgres(t))
+}
+
+func TestPgMatchDecisions(t *testing.T) {
+	storetest.MatchDecisions(t, openTestPostgres(t))
+}
+
+func TestPgRetention(t *testing.T) {
+	storetest.Retention(t, openTestPostgres(t))
+}
+
+func TestPgMigrationsRunTwice(t *testing.T) {
+	st := openTestPostgres(t)
+	version := func() int {
+		t.Helper()
+		v, err := store.SchemaVersion(st)
+		if err != nil {
+			t.Fatalf("SchemaVersion: %v", err)
+		}
+		return v
+	}
+	if got := version(); got != store.PgMigrations {
+		t.Fatalf("schema version %d after opening, want %d", got, store.PgMigrations)
+	}
+	if err := store.Migrate(st); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if got := version(); got != store.PgMigrations {
+		t.Errorf("schema version %d after the second run, want %d", got, store.PgMigrations)
+	}
+
+	// a database from before the version table goes through the whole chain again, keeping its rows
+	if err := st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true}); err != nil {
+		t.Fatalf("UpsertSubscriber: %v", err)
+	}
+	if err := store.ForgetMigrations(st); err != nil {
+		t.Fatalf("ForgetMigrations: %v", err)
+	}
+	if err := store.Migrate(st); err != nil {
+		t.Fatalf("run on an unversioned database: %v", err)
+	}
+	if got := version(); got != store.PgMigrations {
+		t.Errorf("schema version %d, want %d", got, store.PgMigrations)
+	}
+	if _, err := st.GetSubscriber(t.Context(), "1"); err != nil {
+		t.Errorf("subscriber lost: %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// pgMigration is one step of the Postgres schema; stmts returns its SQL for the store's tables
+type pgMigration struct {
+	name  string
+	stmts func(s *PgStore) []string
+}
+
+// pgMigrations is the Postgres schema, oldest first; migration i+1 is pgMigrations[i]. Append
+// new steps, never edit applied ones. The steps up to "match decisions" predate the version table
+// and only use "if not exists", so databases created before it go through them unchanged.
+var pgMigrations = []pgMigration{
+	{"initial tables", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`create table if not exists %s (
+            chat_id text primary key,
+            username text,
+            first_name text,
+            last_name text,
+            language text not null default 'en',
+            plan text not null default 'free',
+            is_active boolean not null default true,
+            created_at timestamptz not null default now(),
+            updated_at timestamptz not null default now()
+        )`, s.tableSubscribers),
+			fmt.Sprintf(`create table if not exists %s (
+            id text primary key,
+            chat_id text not null references %s(chat_id) on delete cascade,
+            refuge text not null,
+            date_from text,
+            date_to text,
+            created_at timestamptz not null default now(),
+            updated_at timestamptz not null default now()
+        )`, s.tableSubscriptions, s.tableSubscribers),
+			fmt.Sprintf(`create table if not exists %s (
+            id text primary key,
+            chat_id text not null,
+            text text not null,
+            deliver_after timestamptz not null,
+            created_at timestamptz not null default now()
+        )`, s.tableOutbox),
+			fmt.Sprintf(`create table if not exists %s (
+            id bigserial primary key,
+            chat_id text not null,
+            message_id text not null,
+            kind text not null,
+            status text not null,
+            at timestamptz not null default now()
+        )`, s.tableNotifLog),
+			fmt.Sprintf(`create table if not exists %s (
+            key text primary key,
+            value text not null,
+            updated_at timestamptz not null default now()
+        )`, s.tableSettings),
+		}
+	}},
+	{"query filters", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`alter table %s add column if not exists min_places integer`, s.tableSubscriptions),
+			fmt.Sprintf(`alter table %s add column if not exists weekdays smallint`, s.tableSubscriptions),
+			fmt.Sprintf(`alter table %s add column if not exists label text`, s.tableSubscriptions),
+			fmt.Sprintf(`alter table %s add column if not exists notify_on_gone boolean not null default false`, s.tableSubscriptions),
+			fmt.Sprintf(`alter table %s add column if not exists pax int`, s.tableSubscriptions),
+			fmt.Sprintf(`alter table %s add column if not exists one_shot boolean not null default false`, s.tableSubscriptions),
+			fmt.Sprintf(`alter table %s add column if not exists status text not null default 'active'`, s.tableSubscriptions),
+		}
+	}},
+	{"subscriber preferences and consent", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`alter table %s add column if not exists snoozed_until timestamptz`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists weekly_opt_out boolean not null default false`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists weekly_sent_at timestamptz`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists consent_at timestamptz`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists consent_source text`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists consent_version text`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists consent_ip text`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists notify_season_open boolean not null default false`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists season_notified jsonb`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists email text`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists email_only boolean not null default false`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column if not exists language_locked boolean not null default false`, s.tableSubscribers),
+			// rows from before consent tracking
+			fmt.Sprintf(`update %s set consent_source='legacy' where consent_source is null`, s.tableSubscribers),
+		}
+	}},
+	{"outbox and message log details", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`alter table %s add column if not exists kind text not null default ''`, s.tableOutbox),
+			fmt.Sprintf(`alter table %s add column if not exists expires_at timestamptz`, s.tableOutbox),
+			fmt.Sprintf(`alter table %s add column if not exists refuge text`, s.tableOutbox),
+			fmt.Sprintf(`alter table %s add column if not exists date text`, s.tableOutbox),
+			fmt.Sprintf(`alter table %s add column if not exists refuge text`, s.tableNotifLog),
+			fmt.Sprintf(`alter table %s add column if not exists date text`, s.tableNotifLog),
+			fmt.Sprintf(`create index if not exists %s_refuge_date on %s (refuge, date)`, s.tableNotifLog, s.tableNotifLog),
+		}
+	}},
+	{"availability snapshots and season summaries", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`create table if not exists %s (
+            id bigserial primary key,
+            refuge text not null,
+            observed_at timestamptz not null,
+            open jsonb not null
+        )`, s.tableSnapshots),
+			fmt.Sprintf(`create index if not exists %s_observed_at on %s (observed_at)`, s.tableSnapshots, s.tableSnapshots),
+			fmt.Sprintf(`create table if not exists %s (
+            season integer not null,
+            refuge text not null,
+            days_monitored integer not null,
+            windows integer not null,
+            median_window_seconds bigint not null,
+            cancellations integer not null,
+            busiest_weekday smallint not null,
+            created_at timestamptz not null default now(),
+            primary key (season, refuge)
+        )`, s.tableSeasons),
+		}
+	}},
+	{"added structures", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`create table if not exists %s (
+            id text primary key,
+            name text not null unique,
+            added_by text not null,
+            added_at timestamptz not null default now()
+        )`, s.tableStructures),
+		}
+	}},
+	{"alert history", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`create table if not exists %s (
+            id bigserial primary key,
+            chat_id text not null,
+            refuge text not null,
+            date text not null,
+            places integer not null,
+            sent_at timestamptz not null default now(),
+            channel text not null
+        )`, s.tableNotifications),
+			fmt.Sprintf(`create index if not exists %s_chat_date on %s (chat_id, refuge, date, sent_at)`, s.tableNotifications, s.tableNotifications),
+			fmt.Sprintf(`create index if not exists %s_sent_at on %s (sent_at)`, s.tableNotifications, s.tableNotifications),
+		}
+	}},
+	{"date snapshots", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`create table if not exists %s (
+            id bigserial primary key,
+            refuge text not null,
+            date text not null,
+            places integer not null,
+            checked_at timestamptz not null
+        )`, s.tableDateSnapshots),
+			fmt.Sprintf(`create index if not exists %s_refuge_date on %s (refuge, date, checked_at)`, s.tableDateSnapshots, s.tableDateSnapshots),
+			fmt.Sprintf(`create index if not exists %s_checked_at on %s (checked_at)`, s.tableDateSnapshots, s.tableDateSnapshots),
+			fmt.Sprintf(`alter table %s add column if not exists previous integer`, s.tableDateSnapshots),
+			// keyset pagination of the history API
+			fmt.Sprintf(`create index if not exists %s_checked_at_id on %s (checked_at, id)`, s.tableDateSnapshots, s.tableDateSnapshots),
+		}
+	}},
+	{"match decisions", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`create table if not exists %s (
+            id bigserial primary key,
+            chat_id text not null,
+            refuge text not null,
+            date text not null,
+            query_id text,
+            reason text not null,
+            places integer not null,
+            checked_at timestamptz not null
+        )`, s.tableDecisions),
+			fmt.Sprintf(`create index if not exists %s_chat_date on %s (chat_id, date)`, s.tableDecisions, s.tableDecisions),
+			fmt.Sprintf(`create index if not exists %s_checked_at on %s (checked_at)`, s.tableDecisions, s.tableDecisions),
+		}
+	}},
+	{"quiet hours", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`alter table %s add column quiet_from text`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column quiet_to text`, s.tableSubscribers),
+			fmt.Sprintf(`alter table %s add column timezone text`, s.tableSubscribers),
+		}
+	}},
+	{"query date columns", func(s *PgStore) []string {
+		// dates that don't parse were ignored by the matching and become open ends
+		toDate := s.tableSubscriptions + "_to_date"
+		return []string{
+			fmt.Sprintf(`create or replace function %s(t text) returns date language plpgsql as $$
+            begin
+                if t !~ '^\d{4}-\d{2}-\d{2}$' then
+                    return null;
+                end if;
+                return t::date;
+            exception when others then
+                return null;
+            end $$`, toDate),
+			fmt.Sprintf(`alter table %s alter column date_from type date using %s(date_from)`, s.tableSubscriptions, toDate),
+			fmt.Sprintf(`alter table %s alter column date_to type date using %s(date_to)`, s.tableSubscriptions, toDate),
+			fmt.Sprintf(`drop function %s(text)`, toDate),
+		}
+	}},
+	{"notify mode", func(s *PgStore) []string {
+		return []string{
+			fmt.Sprintf(`alter table %s add column notify_mode text`, s.tableSubscribers),
+		}
+	}},
+}
+
+// migrate applies the migrations the database hasn't had yet, each in a transaction with its
+// version row, so a failed run leaves the schema at the last complete step
+func (s *PgStore) migrate(ctx context.Context) error {
+	if _, err := s.pool.Exec(ctx, fmt.Sprintf(`create table if not exists %s (
+            version integer primary key,
+            name text not null,
+            applied_at timestamptz not null default now()
+        )`, s.tableMigrations)); err != nil {
+		return err
+	}
+	for i, m := range pgMigrations {
+		version := i + 1
+		err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			// instances starting together wait for each other instead of applying a step twice
+			if _, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtext($1))`, s.tableMigrations); err != nil {
+				return err
+			}
+			var applied bool
+			if err := tx.QueryRow(ctx, fmt.Sprintf(`select exists(select 1 from %s where version=$1)`, s.tableMigrations), version).Scan(&applied); err != nil {
+				return err
+			}
+			if applied {
+				return nil
+			}
+			for _, q := range m.stmts(s) {
+				if _, err := tx.Exec(ctx, q); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec(ctx, fmt.Sprintf(`insert into %s (version, name) values ($1, $2)`, s.tableMigrations), version, m.name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", version, m.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Settings holding the personal data of a web form signup until its deep link is opened
+const (
+	ConsentIPPrefix   = "consent_ip:"
+	SignupEmailPrefix = "signup_email:"
+)
+
+// TestAlertPrefix keys the setting holding when a chat last sent itself a test alert
+const TestAlertPrefix = "test_alert:"
+
+// RetentionPolicy is how long one table of personal data keeps its rows
+type RetentionPolicy struct {
+	Table string `json:"table"` // without TablePrefix
+	Data  string `json:"data"`  // what the rows hold
+	Days  int    `json:"days"`  // counted from the row's last write
+	// KeyPrefixes limits a policy of the settings table to the keys starting with one of them
+	KeyPrefixes []string `json:"key_prefixes,omitempty"`
+}
+
+// Keep is how long a row is kept
+func (p RetentionPolicy) Keep() time.Duration {
+	return time.Duration(p.Days) * 24 * time.Hour
+}
+
+// RetentionPolicies are the limits the scheduler purges the store to every night. Active
+// subscribers, their queries and the availability history (SNAPSHOT_RETENTION_DAYS) hold no
+// expiring personal data and aren't listed.
+var RetentionPolicies = []RetentionPolicy{
+	{Table: "subscribers", Data: "unsubscribed chats, with their queries", Days: 365},
+	{Table: "notification_log", Data: "messages sent to each chat and whether they were delivered", Days: 365},
+	{Table: "notifications", Data: "dates each chat was alerted about", Days: 365},
+	{Table: "match_decisions", Data: "why a chat wasn't alerted about a date (admin /as <chat> why <date>)", Days: 14},
+	{Table: "outbox", Data: "messages waiting to be delivered", Days: 30},
+	{Table: "settings", Data: "IP and email address of web form signups until Telegram is opened", Days: 7,
+		KeyPrefixes: []string{ConsentIPPrefix, SignupEmailPrefix}},
+	{Table: "settings", Data: "when each chat last sent itself a test alert", Days: 1,
+		KeyPrefixes: []string{TestAlertPrefix}},
+}
+
+// retentionColumns are the timestamp columns the rows of each policy's table age by
+var retentionColumns = map[string]string{
+	"subscribers":      "updated_at",
+	"notification_log": "at",
+	"notifications":    "sent_at",
+	"match_decisions":  "checked_at",
+	"outbox":           "created_at",
+	"settings":         "updated_at",
+}
+
+// retentionColumn returns the timestamp column of p's table
+func retentionColumn(p RetentionPolicy) (string, error) {
+	column, ok := retentionColumns[p.Table]
+	if !ok {
+		return "", fmt.Errorf("no retention for table %q", p.Table)
+	}
+	return column, nil
+}
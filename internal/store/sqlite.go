@@ -0,0 +1,902 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // database/sql driver "sqlite", pure Go
+)
+
+// SQLiteStore is the Store in a single SQLite file, for deployments without Postgres. It keeps
+// the tables and semantics of PgStore.
+type SQLiteStore struct {
+	db                 *sql.DB
+	tableSubscribers   string
+	tableSubscriptions string
+	tableOutbox        string
+	tableNotifLog      string
+	tableSettings      string
+	tableSnapshots     string
+	tableSeasons       string
+	tableStructures    string
+	tableNotifications string
+	tableDateSnapshots string
+	tableDecisions     string
+}
+
+// sqliteTimeLayout is how times are stored: UTC with a fixed width, so they compare as text
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000000"
+
+// sqliteTime formats t for a timestamp column
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// sqliteNullTime maps the zero time to NULL
+func sqliteNullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return sqliteTime(t)
+}
+
+// Open opens the store of url: in memory for memory://, SQLite for a sqlite:// URL or a plain
+// file path, Postgres otherwise
+func Open(ctx context.Context, url string) (Store, error) {
+	if url == MemoryURL {
+		return NewMemory(), nil
+	}
+	if path, ok := SQLitePath(url); ok {
+		return OpenSQLite(ctx, path)
+	}
+	return OpenPostgres(ctx, url)
+}
+
+// Backend names the store Open picks for url: "memory", "sqlite" or "postgres"
+func Backend(url string) string {
+	if url == MemoryURL {
+		return "memory"
+	}
+	if _, ok := SQLitePath(url); ok {
+		return "sqlite"
+	}
+	return "postgres"
+}
+
+// SQLitePath returns the file of a sqlite:// URL (sqlite:///var/lib/montblanc.db) or of a plain
+// path, false for anything else, e.g. a postgres:// URL or a key=value connection string
+func SQLitePath(url string) (string, bool) {
+	if path, ok := strings.CutPrefix(url, "sqlite://"); ok {
+		return path, path != ""
+	}
+	return url, url != "" && !strings.Contains(url, "://") && !strings.Contains(url, "=")
+}
+
+// OpenSQLite opens (creating it if needed) the SQLite database at path
+func OpenSQLite(ctx context.Context, path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer; one connection saves juggling SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	prefix := TablePrefix
+	s := &SQLiteStore{
+		db:                 db,
+		tableSubscribers:   prefix + "subscribers",
+		tableSubscriptions: prefix + "subscriptions",
+		tableOutbox:        prefix + "outbox",
+		tableNotifLog:      prefix + "notification_log",
+		tableSettings:      prefix + "settings",
+		tableSnapshots:     prefix + "availability_snapshots",
+		tableSeasons:       prefix + "season_summaries",
+		tableStructures:    prefix + "structures",
+		tableNotifications: prefix + "notifications",
+		tableDateSnapshots: prefix + "date_snapshots",
+		tableDecisions:     prefix + "match_decisions",
+	}
+	if err := s.init(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// init creates the tables of PgStore at their latest version. Times are timestamp columns,
+// which the driver scans back into time.Time.
+func (s *SQLiteStore) init(ctx context.Context) error {
+	stmts := []string{
+		fmt.Sprintf(`create table if not exists %s (
+            chat_id text primary key,
+            username text,
+            first_name text,
+            last_name text,
+            language text not null default 'en',
+            plan text not null default 'free',
+            is_active boolean not null default true,
+            created_at timestamp not null,
+            updated_at timestamp not null,
+            snoozed_until timestamp,
+            weekly_opt_out boolean not null default false,
+            weekly_sent_at timestamp,
+            consent_at timestamp,
+            consent_source text,
+            consent_version text,
+            consent_ip text,
+            notify_season_open boolean not null default false,
+            season_notified text,
+            email text,
+            email_only boolean not null default false,
+            language_locked boolean not null default false,
+            quiet_from text,
+            quiet_to text,
+            timezone text,
+            notify_mode text
+        )`, s.tableSubscribers),
+		fmt.Sprintf(`create table if not exists %s (
+            id text primary key,
+            chat_id text not null references %s(chat_id) on delete cascade,
+            refuge text not null,
+            date_from text,
+            date_to text,
+            min_places integer,
+            weekdays integer,
+            label text,
+            notify_on_gone boolean not null default false,
+            pax integer,
+            created_at timestamp not null,
+            updated_at timestamp not null
+        )`, s.tableSubscriptions, s.tableSubscribers),
+		fmt.Sprintf(`create table if not exists %s (
+            id text primary key,
+            chat_id text not null,
+            text text not null,
+            kind text not null default '',
+            deliver_after timestamp not null,
+            expires_at timestamp,
+            refuge text,
+            date text,
+            created_at timestamp not null
+        )`, s.tableOutbox),
+		fmt.Sprintf(`create table if not exists %s (
+            id integer primary key autoincrement,
+            chat_id text not null,
+            message_id text not null,
+            kind text not null,
+            status text not null,
+            refuge text,
+            date text,
+            at timestamp not null
+        )`, s.tableNotifLog),
+		fmt.Sprintf(`create index if not exists %s_refuge_date on %s (refuge, date)`, s.tableNotifLog, s.tableNotifLog),
+		fmt.Sprintf(`create table if not exists %s (
+            key text primary key,
+            value text not null,
+            updated_at timestamp not null
+        )`, s.tableSettings),
+		fmt.Sprintf(`create table if not exists %s (
+            id integer primary key autoincrement,
+            refuge text not null,
+            observed_at timestamp not null,
+            open text not null
+        )`, s.tableSnapshots),
+		fmt.Sprintf(`create index if not exists %s_observed_at on %s (observed_at)`, s.tableSnapshots, s.tableSnapshots),
+		fmt.Sprintf(`create table if not exists %s (
+            season integer not null,
+            refuge text not null,
+            days_monitored integer not null,
+            windows integer not null,
+            median_window_seconds integer not null,
+            cancellations integer not null,
+            busiest_weekday integer not null,
+            created_at timestamp not null default current_timestamp,
+            primary key (season, refuge)
+        )`, s.tableSeasons),
+		fmt.Sprintf(`create table if not exists %s (
+            id text primary key,
+            name text not null unique,
+            added_by text not null,
+            added_at timestamp not null
+        )`, s.tableStructures),
+		fmt.Sprintf(`create table if not exists %s (
+            id integer primary key autoincrement,
+            chat_id text not null,
+            refuge text not null,
+            date text not null,
+            places integer not null,
+            sent_at timestamp not null,
+            channel text not null
+        )`, s.tableNotifications),
+		fmt.Sprintf(`create index if not exists %s_chat_date on %s (chat_id, refuge, date, sent_at)`, s.tableNotifications, s.tableNotifications),
+		fmt.Sprintf(`create index if not exists %s_sent_at on %s (sent_at)`, s.tableNotifications, s.tableNotifications),
+		fmt.Sprintf(`create table if not exists %s (
+            id integer primary key autoincrement,
+            refuge text not null,
+            date text not null,
+            places integer not null,
+            previous integer,
+            checked_at timestamp not null
+        )`, s.tableDateSnapshots),
+		fmt.Sprintf(`create index if not exists %s_refuge_date on %s (refuge, date, checked_at)`, s.tableDateSnapshots, s.tableDateSnapshots),
+		fmt.Sprintf(`create index if not exists %s_checked_at_id on %s (checked_at, id)`, s.tableDateSnapshots, s.tableDateSnapshots),
+		fmt.Sprintf(`create table if not exists %s (
+            id integer primary key autoincrement,
+            chat_id text not null,
+            refuge text not null,
+            date text not null,
+            query_id text,
+            reason text not null,
+            places integer not null,
+            checked_at timestamp not null
+        )`, s.tableDecisions),
+		fmt.Sprintf(`create index if not exists %s_chat_date on %s (chat_id, date)`, s.tableDecisions, s.tableDecisions),
+		fmt.Sprintf(`create index if not exists %s_checked_at on %s (checked_at)`, s.tableDecisions, s.tableDecisions),
+	}
+	for _, q := range stmts {
+		if _, err := s.db.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	// columns added since, which SQLite can't add "if not exists"
+	for _, c := range []struct{ table, column, def string }{
+		{s.tableSubscriptions, "one_shot", "boolean not null default false"},
+		{s.tableSubscriptions, "status", "text not null default 'active'"},
+		{s.tableSubscribers, "quiet_from", "text"},
+		{s.tableSubscribers, "quiet_to", "text"},
+		{s.tableSubscribers, "timezone", "text"},
+		{s.tableSubscribers, "notify_mode", "text"},
+	} {
+		if err := s.addColumn(ctx, c.table, c.column, c.def); err != nil {
+			return err
+		}
+	}
+	// query dates stored before they were validated that aren't YYYY-MM-DD become open ends
+	for _, column := range []string{"date_from", "date_to"} {
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`update %s set %s=null where %s is not null and date(%s) is not %s`, s.tableSubscriptions, column, column, column, column)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn adds column to table unless it is there already
+func (s *SQLiteStore) addColumn(ctx context.Context, table string, column string, def string) error {
+	var n int
+	if err := s.db.QueryRowContext(ctx, `select count(*) from pragma_table_info(?1) where name=?2`, table, column).Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`alter table %s add column %s %s`, table, column, def))
+	return err
+}
+
+func (s *SQLiteStore) Close() error { return s.db.Close() }
+
+// exec runs a statement and returns the rows it affected
+func (s *SQLiteStore) exec(ctx context.Context, q string, args ...any) (int, error) {
+	res, err := s.db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// execFound runs a statement changing one row, ErrNotFound when there is none
+func (s *SQLiteStore) execFound(ctx context.Context, q string, args ...any) error {
+	n, err := s.exec(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) UpsertSubscriber(ctx context.Context, sub Subscriber) error {
+	now := time.Now()
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = now
+	}
+	sub.LastUpdatedAt = now
+	if sub.Plan == "" {
+		sub.Plan = "free"
+	}
+	seasonNotified, err := json.Marshal(sub.SeasonNotified)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		fmt.Sprintf(`insert into %s (chat_id, username, first_name, last_name, language, plan, is_active, created_at, updated_at, snoozed_until, weekly_opt_out, weekly_sent_at, consent_at, consent_source, consent_version, consent_ip, notify_season_open, season_notified, email, email_only, language_locked, quiet_from, quiet_to, timezone, notify_mode)
+         values (?1,?2,?3,?4,?5,?6,?7,?8,?9,?10,?11,?12,?13,?14,?15,?16,?17,?18,?19,?20,?21,?22,?23,?24,?25)
+         on conflict (chat_id) do update set username=excluded.username, first_name=excluded.first_name, last_name=excluded.last_name, language=excluded.language, plan=excluded.plan, is_active=excluded.is_active, updated_at=excluded.updated_at, snoozed_until=excluded.snoozed_until, weekly_opt_out=excluded.weekly_opt_out, weekly_sent_at=excluded.weekly_sent_at, consent_at=excluded.consent_at, consent_source=excluded.consent_source, consent_version=excluded.consent_version, consent_ip=excluded.consent_ip, notify_season_open=excluded.notify_season_open, season_notified=excluded.season_notified, email=excluded.email, email_only=excluded.email_only, language_locked=excluded.language_locked, quiet_from=excluded.quiet_from, quiet_to=excluded.quiet_to, timezone=excluded.timezone, notify_mode=excluded.notify_mode`, s.tableSubscribers),
+		sub.ChatID, sub.Username, sub.FirstName, sub.LastName, sub.Language, sub.Plan, sub.IsActive, sqliteTime(sub.CreatedAt), sqliteTime(sub.LastUpdatedAt), sqliteNullTime(sub.SnoozedUntil), sub.WeeklyOptOut, sqliteNullTime(sub.WeeklySentAt), sqliteNullTime(sub.ConsentAt), sub.ConsentSource, sub.ConsentVersion, sub.ConsentIP, sub.NotifyOnSeasonOpen, string(seasonNotified), nullString(sub.Email), sub.EmailOnly, sub.LanguageLocked, nullString(sub.QuietFrom), nullString(sub.QuietTo), nullString(sub.Timezone), nullString(sub.NotifyMode),
+	)
+	return err
+}
+
+// sqliteSubscriberColumns is subscriberColumns without Postgres casts
+var sqliteSubscriberColumns = strings.Replace(subscriberColumns, "season_notified::text", "season_notified", 1)
+
+func (s *SQLiteStore) GetSubscriber(ctx context.Context, chatID string) (Subscriber, error) {
+	sub, err := scanSubscriber(s.db.QueryRowContext(ctx,
+		fmt.Sprintf(`select %s from %s where chat_id=?1`, sqliteSubscriberColumns, s.tableSubscribers), chatID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Subscriber{}, ErrNotFound
+	}
+	if err != nil {
+		return Subscriber{}, err
+	}
+	return sub, nil
+}
+
+func (s *SQLiteStore) ListSubscribers(ctx context.Context) ([]Subscriber, error) {
+	return s.listSubscribers(ctx, `where is_active`)
+}
+
+func (s *SQLiteStore) PageSubscribers(ctx context.Context, after string, limit int) ([]Subscriber, error) {
+	return s.listSubscribers(ctx, `where chat_id > ?1 order by chat_id limit ?2`, after, limit)
+}
+
+func (s *SQLiteStore) CountSubscribers(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`select count(*) from %s where is_active`, s.tableSubscribers)).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) ListSubscribersByLanguage(ctx context.Context, lang string) ([]Subscriber, error) {
+	return s.listSubscribers(ctx, `where is_active and language = ?1`, lang)
+}
+
+// listSubscribers returns the subscribers selected by the where clause (and order)
+func (s *SQLiteStore) listSubscribers(ctx context.Context, where string, args ...any) ([]Subscriber, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`select %s from %s %s`, sqliteSubscriberColumns, s.tableSubscribers, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var subs []Subscriber
+	for rows.Next() {
+		sub, err := scanSubscriber(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (s *SQLiteStore) DeactivateSubscriber(ctx context.Context, chatID string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`update %s set is_active=false, updated_at=?2 where chat_id=?1`, s.tableSubscribers), chatID, sqliteTime(time.Now()))
+	return err
+}
+
+func (s *SQLiteStore) AddQuery(ctx context.Context, q Query) (string, error) {
+	if err := q.Validate(); err != nil {
+		return "", err
+	}
+	if q.ID == "" {
+		q.ID = q.ChatID + "-" + time.Now().Format("20060102150405.000000000")
+	}
+	// the transaction holds the only connection, so no other add counts before this one commits
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if q.status() == QueryActive {
+		var plan string
+		var n int
+		if err := tx.QueryRowContext(ctx, fmt.Sprintf(`select coalesce((select plan from %s where chat_id=?1), ''), (select count(*) from %s where chat_id=?1 and status='active')`, s.tableSubscribers, s.tableSubscriptions), q.ChatID).Scan(&plan, &n); err != nil {
+			return "", err
+		}
+		if err := queryLimitError(plan, n); err != nil {
+			return "", err
+		}
+	}
+	now := sqliteTime(time.Now())
+	_, err = tx.ExecContext(ctx,
+		fmt.Sprintf(`insert into %s (id, chat_id, refuge, date_from, date_to, min_places, weekdays, label, notify_on_gone, pax, one_shot, status, created_at, updated_at)
+         values (?1,?2,?3,?4,?5,?6,?7,?8,?9,?10,?11,?12,?13,?13)`, s.tableSubscriptions),
+		q.ID, q.ChatID, q.Refuge, nullString(q.DateFrom), nullString(q.DateTo), nullInt(q.MinPlaces), nullInt(int(q.Weekdays)), q.Label, q.NotifyOnGone, nullInt(q.Pax), q.OneShot, q.status(), now,
+	)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return q.ID, nil
+}
+
+// sqliteQueryColumns is queryColumns for the text date columns of SQLite
+var sqliteQueryColumns = strings.NewReplacer("to_char(date_from, 'YYYY-MM-DD')", "date_from", "to_char(date_to, 'YYYY-MM-DD')", "date_to").Replace(queryColumns)
+
+func (s *SQLiteStore) listQueries(ctx context.Context, where string, args ...any) ([]Query, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`select %s from %s %s`, sqliteQueryColumns, s.tableSubscriptions, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Query
+	for rows.Next() {
+		q, err := scanQuery(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, q)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) ListQueriesByChat(ctx context.Context, chatID string) ([]Query, error) {
+	return s.listQueries(ctx, `where chat_id=?1`, chatID)
+}
+
+func (s *SQLiteStore) CountQueriesByChat(ctx context.Context, chatID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`select count(*) from %s where chat_id=?1 and status=?2`, s.tableSubscriptions), chatID, QueryActive).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) ListAllQueries(ctx context.Context) ([]Query, error) {
+	return s.listQueries(ctx, fmt.Sprintf(`where chat_id in (select chat_id from %s where is_active) order by chat_id`, s.tableSubscribers))
+}
+
+func (s *SQLiteStore) GetQuery(ctx context.Context, id string) (Query, error) {
+	q, err := scanQuery(s.db.QueryRowContext(ctx, fmt.Sprintf(`select %s from %s where id=?1`, sqliteQueryColumns, s.tableSubscriptions), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Query{}, ErrNotFound
+	}
+	if err != nil {
+		return Query{}, err
+	}
+	return q, nil
+}
+
+func (s *SQLiteStore) DeleteQuery(ctx context.Context, id string) error {
+	return s.execFound(ctx, fmt.Sprintf(`delete from %s where id=?1`, s.tableSubscriptions), id)
+}
+
+func (s *SQLiteStore) UpdateQuery(ctx context.Context, q Query) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	return s.execFound(ctx,
+		fmt.Sprintf(`update %s set refuge=?3, date_from=?4, date_to=?5, min_places=?6, weekdays=?7, label=?8, notify_on_gone=?9, pax=?10, one_shot=?11, updated_at=?12
+         where id=?1 and chat_id=?2`, s.tableSubscriptions),
+		q.ID, q.ChatID, q.Refuge, nullString(q.DateFrom), nullString(q.DateTo), nullInt(q.MinPlaces), nullInt(int(q.Weekdays)), q.Label, q.NotifyOnGone, nullInt(q.Pax), q.OneShot, sqliteTime(time.Now()),
+	)
+}
+
+func (s *SQLiteStore) SetQueryNotifyOnGone(ctx context.Context, id string, on bool) error {
+	return s.execFound(ctx, fmt.Sprintf(`update %s set notify_on_gone=?2, updated_at=?3 where id=?1`, s.tableSubscriptions), id, on, sqliteTime(time.Now()))
+}
+
+func (s *SQLiteStore) SetQueryStatus(ctx context.Context, id string, status string) error {
+	return s.execFound(ctx, fmt.Sprintf(`update %s set status=?2, updated_at=?3 where id=?1`, s.tableSubscriptions), id, status, sqliteTime(time.Now()))
+}
+
+func (s *SQLiteStore) EnqueueMessage(ctx context.Context, m OutboxMessage) error {
+	if m.DeliverAfter.IsZero() {
+		m.DeliverAfter = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`insert into %s (id, chat_id, text, kind, deliver_after, expires_at, refuge, date, created_at)
+         values (?1,?2,?3,?4,?5,?6,?7,?8,?9)
+         on conflict (id) do update set text=%s.text || excluded.text, deliver_after=excluded.deliver_after, expires_at=excluded.expires_at`, s.tableOutbox, s.tableOutbox),
+		m.ID, m.ChatID, m.Text, m.Kind, sqliteTime(m.DeliverAfter), sqliteNullTime(m.ExpiresAt), nullString(m.Refuge), nullString(m.Date), sqliteTime(time.Now()),
+	)
+	return err
+}
+
+func (s *SQLiteStore) ListDueMessages(ctx context.Context, now time.Time) ([]OutboxMessage, error) {
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`select id, chat_id, text, kind, deliver_after, expires_at, coalesce(refuge, ''), coalesce(date, ''), created_at from %s where deliver_after <= ?1 order by deliver_after`, s.tableOutbox), sqliteTime(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		var expires *time.Time
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.Text, &m.Kind, &m.DeliverAfter, &expires, &m.Refuge, &m.Date, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expires != nil {
+			m.ExpiresAt = *expires
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteMessage(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`delete from %s where id=?1`, s.tableOutbox), id)
+	return err
+}
+
+func (s *SQLiteStore) LogNotification(ctx context.Context, e NotificationLogEntry) error {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`insert into %s (chat_id, message_id, kind, status, refuge, date, at) values (?1,?2,?3,?4,?5,?6,?7)`, s.tableNotifLog),
+		e.ChatID, e.MessageID, e.Kind, e.Status, nullString(e.Refuge), nullString(e.Date), sqliteTime(e.At),
+	)
+	return err
+}
+
+func (s *SQLiteStore) CountNotifications(ctx context.Context, status string, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		fmt.Sprintf(`select count(*) from %s where status=?1 and at >= ?2`, s.tableNotifLog), status, sqliteTime(since)).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) ListAlertedChats(ctx context.Context, refuge string, date string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`select chat_id from (
+            select chat_id, status, row_number() over (partition by chat_id order by at desc, id desc) as n from %s
+            where refuge=?1 and date=?2 and status in (?3, ?4)
+        ) latest where n=1 and status=?3 order by chat_id`, s.tableNotifLog), refuge, date, StatusAlerted, StatusGone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []string
+	for rows.Next() {
+		var chatID string
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		res = append(res, chatID)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) GetSetting(ctx context.Context, key string) (string, error) {
+	var v string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`select value from %s where key=?1`, s.tableSettings), key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return v, err
+}
+
+func (s *SQLiteStore) PurgeExpired(ctx context.Context, p RetentionPolicy, before time.Time, limit int) (int, error) {
+	column, err := retentionColumn(p)
+	if err != nil {
+		return 0, err
+	}
+	table := map[string]string{
+		"subscribers":      s.tableSubscribers,
+		"notification_log": s.tableNotifLog,
+		"notifications":    s.tableNotifications,
+		"match_decisions":  s.tableDecisions,
+		"outbox":           s.tableOutbox,
+		"settings":         s.tableSettings,
+	}[p.Table]
+	where := column + ` < ?1`
+	args := []any{sqliteTime(before), limit}
+	if p.Table == "subscribers" {
+		// their queries go along, by the foreign key
+		where += ` and not is_active`
+	}
+	if len(p.KeyPrefixes) > 0 {
+		matches := make([]string, 0, len(p.KeyPrefixes))
+		for _, prefix := range p.KeyPrefixes {
+			args = append(args, prefix)
+			matches = append(matches, fmt.Sprintf(`substr(key, 1, length(?%d)) = ?%d`, len(args), len(args)))
+		}
+		where += ` and (` + strings.Join(matches, ` or `) + `)`
+	}
+	return s.exec(ctx, fmt.Sprintf(`delete from %s where rowid in (select rowid from %s where %s limit ?2)`, table, table, where), args...)
+}
+
+func (s *SQLiteStore) SetSetting(ctx context.Context, key string, value string) error {
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`insert into %s (key, value, updated_at) values (?1,?2,?3)
+         on conflict (key) do update set value=excluded.value, updated_at=excluded.updated_at`, s.tableSettings),
+		key, value, sqliteTime(time.Now()),
+	)
+	return err
+}
+
+func (s *SQLiteStore) ListSettings(ctx context.Context, prefix string) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`select key, value from %s where substr(key, 1, length(?1)) = ?1`, s.tableSettings), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		res[k] = v
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) RecordNotification(ctx context.Context, n Notification) error {
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`insert into %s (chat_id, refuge, date, places, sent_at, channel) values (?1,?2,?3,?4,?5,?6)`, s.tableNotifications),
+		n.ChatID, n.Refuge, n.Date, n.Places, sqliteTime(n.SentAt), n.Channel)
+	return err
+}
+
+func (s *SQLiteStore) WasNotified(ctx context.Context, chatID string, refuge string, date string) (bool, error) {
+	var found bool
+	err := s.db.QueryRowContext(ctx,
+		fmt.Sprintf(`select exists (select 1 from %s where chat_id=?1 and refuge=?2 and date=?3)`, s.tableNotifications),
+		chatID, refuge, date).Scan(&found)
+	return found, err
+}
+
+func (s *SQLiteStore) ListNotifiedDates(ctx context.Context, chatID string) ([]Notification, error) {
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`select chat_id, refuge, date, places, sent_at, channel from (
+            select *, row_number() over (partition by refuge, date order by sent_at desc, id desc) as n from %s where chat_id=?1
+        ) latest where n=1 order by refuge, date`, s.tableNotifications), chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ChatID, &n.Refuge, &n.Date, &n.Places, &n.SentAt, &n.Channel); err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) CountRecordedNotifications(ctx context.Context, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`select count(*) from %s where sent_at >= ?1`, s.tableNotifications), sqliteTime(since)).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) DeleteNotificationsBefore(ctx context.Context, date string) (int, error) {
+	return s.exec(ctx, fmt.Sprintf(`delete from %s where date < ?1`, s.tableNotifications), date)
+}
+
+func (s *SQLiteStore) RecordMatchDecisions(ctx context.Context, ds []MatchDecision) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, d := range ds {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`insert into %s (chat_id, refuge, date, query_id, reason, places, checked_at) values (?1,?2,?3,?4,?5,?6,?7)`, s.tableDecisions),
+			d.ChatID, d.Refuge, d.Date, nullString(d.QueryID), d.Reason, d.Places, sqliteTime(d.CheckedAt)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ListMatchDecisions(ctx context.Context, chatID string, date string) ([]MatchDecision, error) {
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`select chat_id, refuge, date, coalesce(query_id, ''), reason, places, checked_at from %s where chat_id=?1 and date=?2 order by checked_at, id`, s.tableDecisions),
+		chatID, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []MatchDecision
+	for rows.Next() {
+		var d MatchDecision
+		if err := rows.Scan(&d.ChatID, &d.Refuge, &d.Date, &d.QueryID, &d.Reason, &d.Places, &d.CheckedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteMatchDecisionsBefore(ctx context.Context, t time.Time) (int, error) {
+	return s.exec(ctx, fmt.Sprintf(`delete from %s where checked_at < ?1`, s.tableDecisions), sqliteTime(t))
+}
+
+func (s *SQLiteStore) RecordSnapshot(ctx context.Context, sn Snapshot) error {
+	open, err := json.Marshal(sn.Open)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		fmt.Sprintf(`insert into %s (refuge, observed_at, open) values (?1,?2,?3)`, s.tableSnapshots),
+		sn.Refuge, sqliteTime(sn.ObservedAt), string(open),
+	)
+	return err
+}
+
+func (s *SQLiteStore) ListSnapshots(ctx context.Context, from time.Time, to time.Time) ([]Snapshot, error) {
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`select refuge, observed_at, open from %s where observed_at >= ?1 and observed_at < ?2 order by observed_at, id`, s.tableSnapshots), sqliteTime(from), sqliteTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Snapshot
+	for rows.Next() {
+		var sn Snapshot
+		var open []byte
+		if err := rows.Scan(&sn.Refuge, &sn.ObservedAt, &open); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(open, &sn.Open); err != nil {
+			return nil, err
+		}
+		res = append(res, sn)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteSnapshots(ctx context.Context, from time.Time, to time.Time) (int, error) {
+	return s.exec(ctx, fmt.Sprintf(`delete from %s where observed_at >= ?1 and observed_at < ?2`, s.tableSnapshots), sqliteTime(from), sqliteTime(to))
+}
+
+func (s *SQLiteStore) SaveDateSnapshots(ctx context.Context, sns []DateSnapshot) (int, error) {
+	if len(sns) == 0 {
+		return 0, nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	// only the dates whose places changed since their latest snapshot, to keep the volume down;
+	// the previous places are read before any row of the check is inserted, as in PgStore
+	latest := fmt.Sprintf(`select places from %s where refuge=?1 and date=?2 order by checked_at desc, id desc limit 1`, s.tableDateSnapshots)
+	previous := make([]*int, len(sns))
+	for i, sn := range sns {
+		var p int
+		err := tx.QueryRowContext(ctx, latest, sn.Refuge, sn.Date).Scan(&p)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		previous[i] = &p
+	}
+	insert := fmt.Sprintf(`insert into %s (refuge, date, places, previous, checked_at) values (?1,?2,?3,?4,?5)`, s.tableDateSnapshots)
+	n := 0
+	for i, sn := range sns {
+		if previous[i] != nil && *previous[i] == sn.Places {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, insert, sn.Refuge, sn.Date, sn.Places, previous[i], sqliteTime(sn.CheckedAt)); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
+
+func (s *SQLiteStore) ListDateSnapshots(ctx context.Context, refuge string, from time.Time, to time.Time) ([]DateSnapshot, error) {
+	return s.listDateSnapshots(ctx, `where refuge = ?1 and checked_at >= ?2 and checked_at < ?3 order by checked_at, id`, refuge, sqliteTime(from), sqliteTime(to))
+}
+
+func (s *SQLiteStore) PageDateSnapshots(ctx context.Context, p DateSnapshotPage) ([]DateSnapshot, error) {
+	where := `where (checked_at, id) > (?1, ?2) and (?3 = '' or refuge = ?3) and (?4 = '' or date = ?4)`
+	if p.Transitions {
+		where += ` and (previous is null or (previous = 0) <> (places = 0))`
+	}
+	return s.listDateSnapshots(ctx, where+` order by checked_at, id limit ?5`, sqliteTime(p.After), p.AfterID, p.Refuge, p.Date, p.Limit)
+}
+
+// listDateSnapshots returns the date snapshots selected by the where clause (and order)
+func (s *SQLiteStore) listDateSnapshots(ctx context.Context, where string, args ...any) ([]DateSnapshot, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`select id, refuge, date, places, previous, checked_at from %s %s`, s.tableDateSnapshots, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []DateSnapshot
+	for rows.Next() {
+		var sn DateSnapshot
+		var previous *int
+		if err := rows.Scan(&sn.ID, &sn.Refuge, &sn.Date, &sn.Places, &previous, &sn.CheckedAt); err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			sn.Previous = *previous
+		} else {
+			sn.First = true
+		}
+		res = append(res, sn)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteDateSnapshotsBefore(ctx context.Context, t time.Time) (int, error) {
+	return s.exec(ctx, fmt.Sprintf(`delete from %s where checked_at < ?1`, s.tableDateSnapshots), sqliteTime(t))
+}
+
+func (s *SQLiteStore) SaveSeasonSummaries(ctx context.Context, season int, sums []SeasonSummary) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`delete from %s where season=?1`, s.tableSeasons), season); err != nil {
+		return err
+	}
+	for _, sum := range sums {
+		if _, err := tx.ExecContext(ctx,
+			fmt.Sprintf(`insert into %s (season, refuge, days_monitored, windows, median_window_seconds, cancellations, busiest_weekday)
+         values (?1,?2,?3,?4,?5,?6,?7)`, s.tableSeasons),
+			season, sum.Refuge, sum.DaysMonitored, sum.Windows, int64(sum.MedianWindow/time.Second), sum.Cancellations, int(sum.BusiestWeekday),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ListSeasonSummaries(ctx context.Context, season int) ([]SeasonSummary, error) {
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(`select refuge, days_monitored, windows, median_window_seconds, cancellations, busiest_weekday from %s where season=?1 order by refuge`, s.tableSeasons), season)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []SeasonSummary
+	for rows.Next() {
+		sum := SeasonSummary{Season: season}
+		var median int64
+		var weekday int
+		if err := rows.Scan(&sum.Refuge, &sum.DaysMonitored, &sum.Windows, &median, &sum.Cancellations, &weekday); err != nil {
+			return nil, err
+		}
+		sum.MedianWindow, sum.BusiestWeekday = time.Duration(median)*time.Second, time.Weekday(weekday)
+		res = append(res, sum)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) AddStructure(ctx context.Context, st Structure) error {
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`insert into %s (id, name, added_by, added_at) values (?1,?2,?3,?4)`, s.tableStructures),
+		st.ID, st.Name, st.AddedBy, sqliteTime(st.AddedAt),
+	)
+	return err
+}
+
+func (s *SQLiteStore) ListStructures(ctx context.Context) ([]Structure, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`select id, name, added_by, added_at from %s order by added_at, id`, s.tableStructures))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Structure
+	for rows.Next() {
+		var st Structure
+		if err := rows.Scan(&st.ID, &st.Name, &st.AddedBy, &st.AddedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, st)
+	}
+	return res, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteStructure(ctx context.Context, id string) error {
+	return s.execFound(ctx, fmt.Sprintf(`delete from %s where id=?1`, s.tableStructures), id)
+}
@@ -0,0 +1,142 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/store/storetest"
+)
+
+// openTestSQLite opens a database in a temporary file, removed afterwards
+func openTestSQLite(t *testing.T) *store.SQLiteStore {
+	t.Helper()
+	return openSQLiteAt(t, filepath.Join(t.TempDir(), "montblanc.db"))
+}
+
+// openSQLiteAt opens the database at path, closed afterwards
+func openSQLiteAt(t *testing.T, path string) *store.SQLiteStore {
+	t.Helper()
+	st, err := store.OpenSQLite(context.Background(), path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestSQLiteNotifications(t *testing.T) {
+	storetest.Notifications(t, openTestSQLite(t))
+}
+
+func TestSQLiteDateSnapshots(t *testing.T) {
+	storetest.DateSnapshots(t, openTestSQLite(t))
+}
+
+func TestSQLiteDateSnapshotPages(t *testing.T) {
+	storetest.DateSnapshotPages(t, openTestSQLite(t))
+}
+
+func TestSQLiteQueries(t *testing.T) {
+	storetest.Queries(t, openTestSQLite(t))
+}
+
+func TestSQLiteQueryLimits(t *testing.T) {
+	storetest.QueryLimits(t, openTestSQLite(t))
+}
+
+func TestSQLiteSubscribers(t *testing.T) {
+	storetest.Subscribers(t, openTestSQLite(t))
+}
+
+func TestSQLiteSettings(t *testing.T) {
+	storetest.Settings(t, openTestSQLite(t))
+}
+
+func TestSQLiteMatchDecisions(t *testing.T) {
+	storetest.MatchDecisions(t, openTestSQLite(t))
+}
+
+func TestSQLiteRetention(t *testing.T) {
+	storetest.Retention(t, openTestSQLite(t))
+}
+
+func TestSQLitePath(t *testing.T) {
+	for url, want := range map[string]string{
+		"sqlite:///var/lib/montblanc.db": "/var/lib/montblanc.db",
+		"sqlite://montblanc.db":          "montblanc.db",
+		"/var/lib/montblanc.db":          "/var/lib/montblanc.db",
+		"montblanc.db":                   "montblanc.db",
+		"postgres://bot@db/montblanc":    "",
+		"host=db user=bot":               "",
+		"sqlite://":                      "",
+	} {
+		if path, ok := store.SQLitePath(url); ok != (want != "") || ok && path != want {
+			t.Errorf("SQLitePath(%q) = %q, %t; want %q", url, path, ok, want)
+		}
+	}
+}
+
+func TestBackend(t *testing.T) {
+	for url, want := range map[string]string{
+		"montblanc.db":                   "sqlite",
+		"sqlite:///var/lib/montblanc.db": "sqlite",
+		"postgres://bot@db/montblanc":    "postgres",
+		"host=db user=bot":               "postgres",
+		store.MemoryURL:                  "memory",
+	} {
+		if got := store.Backend(url); got != want {
+			t.Errorf("Backend(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestSQLiteAddsColumnsToOlderDatabases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "montblanc.db")
+	st, err := store.OpenSQLite(context.Background(), path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	st.Close()
+	// back to the subscriptions table as first released
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range []string{"status", "one_shot"} {
+		if _, err := db.Exec(`alter table subscriptions drop column ` + column); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	st = openSQLiteAt(t, path)
+	storetest.Queries(t, st)
+}
+
+func TestSQLiteClearsMalformedQueryDates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "montblanc.db")
+	st := openSQLiteAt(t, path)
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true})
+	id, err := st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	if err != nil {
+		t.Fatalf("AddQuery: %v", err)
+	}
+	st.Close()
+	// stored before the dates were validated
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`update subscriptions set date_to='2025-ab-01'`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	st = openSQLiteAt(t, path)
+	if q, err := st.GetQuery(t.Context(), id); err != nil || q.DateFrom != "2025-07-01" || q.DateTo != "" {
+		t.Errorf("GetQuery = %+v, %v; want the malformed date_to cleared", q, err)
+	}
+}
@@ -1,7 +1,9 @@
 package store
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -12,36 +14,620 @@ type Subscriber struct {
 	FirstName     string    `json:"first_name"`
 	LastName      string    `json:"last_name"`
 	Language      string    `json:"language"`
-	Plan          string    `json:"plan"` // free, pro (future use)
+	Plan          string    `json:"plan"` // PlanFree or PlanPro, "" = PlanFree
 	CreatedAt     time.Time `json:"created_at"`
 	LastUpdatedAt time.Time `json:"last_updated_at"`
 	IsActive      bool      `json:"is_active"`
+	SnoozedUntil  time.Time `json:"snoozed_until"` // zero when not snoozed
+	WeeklyOptOut  bool      `json:"weekly_opt_out"`
+	WeeklySentAt  time.Time `json:"weekly_sent_at"` // last weekly summary, zero if never sent
+
+	// Consent to notifications, recorded at first contact and never overwritten
+	ConsentAt      time.Time `json:"consent_at"`                // zero for legacy rows
+	ConsentSource  string    `json:"consent_source"`            // one of the Consent* sources
+	ConsentVersion string    `json:"consent_version,omitempty"` // hash of the greeting shown
+	ConsentIP      string    `json:"consent_ip,omitempty"`      // web form signups only
+
+	// One message when booking opens for the season, independent of queries
+	NotifyOnSeasonOpen bool           `json:"notify_on_season_open"`
+	SeasonNotified     map[string]int `json:"season_notified,omitempty"` // refuge -> season year already announced
+
+	// Availability alerts are also emailed when Email is set; EmailOnly skips Telegram for them
+	Email     string `json:"email,omitempty"`
+	EmailOnly bool   `json:"email_only,omitempty"`
+
+	// Language was chosen by the user (/language, the web form): auto-detected ones don't replace it
+	LanguageLocked bool `json:"language_locked,omitempty"`
+
+	// Quiet hours: alerts found between QuietFrom and QuietTo ("HH:MM", possibly across midnight)
+	// in Timezone (an IANA name, UTC when empty) are held for one digest when the window ends
+	QuietFrom string `json:"quiet_from,omitempty"`
+	QuietTo   string `json:"quiet_to,omitempty"`
+	Timezone  string `json:"timezone,omitempty"`
+
+	// NotifyMode is how availability alerts are delivered: NotifyInstant or NotifyDigest
+	NotifyMode string `json:"notify_mode,omitempty"` // "" = NotifyInstant
+}
+
+// Notification modes
+const (
+	NotifyInstant = "instant" // an alert as soon as a check finds new dates
+	NotifyDigest  = "digest"  // the day's alerts in one message, at the digest hour
+)
+
+// Consent sources
+const (
+	ConsentTelegram = "telegram_start" // plain /start in the bot
+	ConsentWebForm  = "web_form"       // website form, confirmed through the deep link
+	ConsentAPI      = "api"
+	ConsentImport   = "admin_import" // added by an admin through the bulk query import
+	ConsentLegacy   = "legacy"       // subscribed before consent was recorded
+)
+
+// HasConsent reports whether consent was recorded for the subscriber
+func (s Subscriber) HasConsent() bool {
+	return s.ConsentSource != "" && s.ConsentSource != ConsentLegacy
+}
+
+// SetLanguage applies lang, chosen by the user when explicit (locking it) or auto-detected from
+// Telegram or the browser otherwise, which only applies while the language isn't locked
+func (s *Subscriber) SetLanguage(lang string, explicit bool) {
+	switch {
+	case explicit:
+		s.Language, s.LanguageLocked = lang, true
+	case !s.LanguageLocked:
+		s.Language = lang
+	}
+}
+
+// IsSnoozed reports whether notifications for the subscriber are suppressed at now
+func (s Subscriber) IsSnoozed(now time.Time) bool {
+	return !s.SnoozedUntil.IsZero() && now.Before(s.SnoozedUntil)
+}
+
+// QuietUntil returns the end of the subscriber's quiet hours when now falls within them, zero
+// otherwise or when no quiet hours are set
+func (s Subscriber) QuietUntil(now time.Time) time.Time {
+	from, okFrom := clockMinutes(s.QuietFrom)
+	to, okTo := clockMinutes(s.QuietTo)
+	if !okFrom || !okTo || from == to {
+		return time.Time{}
+	}
+	loc := s.location()
+	local := now.In(loc)
+	y, m, d := local.Date()
+	at := local.Hour()*60 + local.Minute()
+	switch {
+	case from < to && at >= from && at < to:
+	case from > to && at >= from:
+		// the window crosses midnight and ends tomorrow
+		d++
+	case from > to && at < to:
+	default:
+		return time.Time{}
+	}
+	return time.Date(y, m, d, to/60, to%60, 0, 0, loc)
+}
+
+// NextDigest returns when the subscriber's next daily digest is due after now: the next time it
+// is hour o'clock in their time zone
+func (s Subscriber) NextDigest(now time.Time, hour int) time.Time {
+	local := now.In(s.location())
+	y, m, d := local.Date()
+	next := time.Date(y, m, d, hour, 0, 0, 0, local.Location())
+	if !next.After(now) {
+		next = time.Date(y, m, d+1, hour, 0, 0, 0, local.Location())
+	}
+	return next
+}
+
+// location is the subscriber's time zone, UTC when unset or unknown
+func (s Subscriber) location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// clockMinutes parses an "HH:MM" time of day into minutes since midnight
+func clockMinutes(hhmm string) (int, bool) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
 }
 
 // Query represents a user's monitoring request/filters
 type Query struct {
 	ID            string    `json:"id"`
 	ChatID        string    `json:"chat_id"`
-	Refuge        string    `json:"refuge"`    // "Tête Rousse" | "du Goûter" | "*"
-	DateFrom      string    `json:"date_from"` // YYYY-MM-DD
-	DateTo        string    `json:"date_to"`   // YYYY-MM-DD
+	Refuge        string    `json:"refuge"`          // "Tête Rousse" | "du Goûter" | "*"
+	DateFrom      string    `json:"date_from"`       // YYYY-MM-DD
+	DateTo        string    `json:"date_to"`         // YYYY-MM-DD
+	MinPlaces     int       `json:"min_places"`      // minimum free places, 0 = any
+	Weekdays      Weekdays  `json:"weekdays"`        // allowed days of the week, empty = every day
+	Label         string    `json:"label,omitempty"` // free-text tag, e.g. a client name from a bulk import
+	NotifyOnGone  bool      `json:"notify_on_gone"`  // follow up when an alerted date is booked out again
+	Pax           int       `json:"pax,omitempty"`   // group size availability is checked for, 0 = the default
+	OneShot       bool      `json:"one_shot"`        // completed by its first alert, until re-armed
+	Status        string    `json:"status"`          // QueryActive or QueryCompleted, "" = QueryActive
 	CreatedAt     time.Time `json:"created_at"`
 	LastUpdatedAt time.Time `json:"last_updated_at"`
 }
 
+// Query statuses
+const (
+	QueryActive    = "active"    // matched against every check
+	QueryCompleted = "completed" // a one-shot query that has alerted: skipped until re-armed
+)
+
+// Completed reports whether q is a one-shot query done alerting
+func (q Query) Completed() bool {
+	return q.Status == QueryCompleted
+}
+
+// status is the Status stored for q
+func (q Query) status() string {
+	if q.Status == "" {
+		return QueryActive
+	}
+	return q.Status
+}
+
+// Matches checks if an availability line (refuge, YYYY-MM-DD date) matches the query
+func (q Query) Matches(refuge string, date string) bool {
+	return q.MatchesRefuge(refuge) && q.InWindow(date) && q.OnWeekday(date)
+}
+
+// OnWeekday checks the weekday filter for date (YYYY-MM-DD); an empty filter matches every day
+func (q Query) OnWeekday(date string) bool {
+	if q.Weekdays == 0 {
+		return true
+	}
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return false
+	}
+	return q.Weekdays.Has(d.Weekday())
+}
+
+// Weekdays is a set of days of the week as a bitmask (bit i is time.Weekday(i)); 0 means every day
+type Weekdays uint8
+
+// AllWeekdays has every day set
+const AllWeekdays Weekdays = 1<<7 - 1
+
+// WeekdaysOf builds a set from days
+func WeekdaysOf(days ...time.Weekday) Weekdays {
+	var w Weekdays
+	for _, d := range days {
+		w |= 1 << d
+	}
+	return w
+}
+
+// Has reports whether d is in the set; the empty set has every day
+func (w Weekdays) Has(d time.Weekday) bool {
+	return w == 0 || w&(1<<d) != 0
+}
+
+// Days returns the days in the set, Monday first
+func (w Weekdays) Days() []time.Weekday {
+	var days []time.Weekday
+	for i := 1; i <= 7; i++ {
+		d := time.Weekday(i % 7)
+		if w != 0 && w.Has(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// HasPlaces checks the number of free places of an available day against MinPlaces
+func (q Query) HasPlaces(places int) bool {
+	return q.MinPlaces <= 0 || places >= q.MinPlaces
+}
+
+// GroupSize is the group size availability is checked for: Pax, or def when unset
+func (q Query) GroupSize(def int) int {
+	if q.Pax > 0 {
+		return q.Pax
+	}
+	return def
+}
+
+// MatchesRefuge checks the refuge filter ("*" matches any refuge)
+func (q Query) MatchesRefuge(refuge string) bool {
+	return q.Refuge == "*" || q.Refuge == refuge
+}
+
+// InWindow checks if date (YYYY-MM-DD) is inside the query's date window; open ends match anything.
+// The bounds were validated when the query was stored, so the dates compare as strings.
+func (q Query) InWindow(date string) bool {
+	if q.DateFrom == "" && q.DateTo == "" {
+		return true
+	}
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		return false
+	}
+	return (q.DateFrom == "" || date >= q.DateFrom) && (q.DateTo == "" || date <= q.DateTo)
+}
+
+// dateLayout is the format of the dates of a query
+const dateLayout = "2006-01-02"
+
+// ErrInvalidQuery is returned, wrapped with the faulty field, when storing a malformed query
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Validate checks the date window of q: each bound empty or a YYYY-MM-DD date, and from not
+// after to. The stores refuse queries failing it with ErrInvalidQuery.
+func (q Query) Validate() error {
+	for _, d := range []struct{ field, value string }{{"date_from", q.DateFrom}, {"date_to", q.DateTo}} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, d.value); err != nil {
+			return fmt.Errorf("%w: %s %q is not a YYYY-MM-DD date", ErrInvalidQuery, d.field, d.value)
+		}
+	}
+	if q.DateFrom != "" && q.DateTo != "" && q.DateFrom > q.DateTo {
+		return fmt.Errorf("%w: date_from %s is after date_to %s", ErrInvalidQuery, q.DateFrom, q.DateTo)
+	}
+	return nil
+}
+
+// Subscriber plans
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+)
+
+// PlanQueryLimits caps the active queries of a chat per plan (FREE_QUERY_LIMIT, PRO_QUERY_LIMIT);
+// 0 is unlimited and unknown plans get the free plan's limit. Set it before adding queries.
+var PlanQueryLimits = map[string]int{PlanFree: 2, PlanPro: 0}
+
+// QueryLimit returns how many active queries plan allows, 0 for unlimited
+func QueryLimit(plan string) int {
+	if n, ok := PlanQueryLimits[plan]; ok {
+		return n
+	}
+	return PlanQueryLimits[PlanFree]
+}
+
+// ErrPlanLimit matches a PlanLimitError
+var ErrPlanLimit = errors.New("plan query limit reached")
+
+// PlanLimitError is returned by AddQuery when the chat already has as many active queries as its
+// plan allows
+type PlanLimitError struct {
+	Plan  string
+	Limit int
+}
+
+func (e *PlanLimitError) Error() string {
+	return fmt.Sprintf("the %s plan allows %d active queries", e.Plan, e.Limit)
+}
+
+// Is makes a PlanLimitError match ErrPlanLimit
+func (e *PlanLimitError) Is(target error) bool { return target == ErrPlanLimit }
+
+// CheckQueryLimit returns a PlanLimitError when storing q, if active, would take its chat past the
+// limit of its plan. Chats without a subscriber are on the free plan. AddQuery checks the limit
+// itself, atomically with the insert.
+func CheckQueryLimit(ctx context.Context, st Store, q Query) error {
+	if q.status() != QueryActive {
+		return nil
+	}
+	plan := PlanFree
+	sub, err := st.GetSubscriber(ctx, q.ChatID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err == nil {
+		plan = sub.Plan
+	}
+	n, err := st.CountQueriesByChat(ctx, q.ChatID)
+	if err != nil {
+		return err
+	}
+	return queryLimitError(plan, n)
+}
+
+// queryLimitError is the PlanLimitError of one more active query for a chat on plan that already
+// has active ones, or nil when the plan has room. An empty plan is the free plan.
+func queryLimitError(plan string, active int) error {
+	if plan == "" {
+		plan = PlanFree
+	}
+	if limit := QueryLimit(plan); limit > 0 && active >= limit {
+		return &PlanLimitError{Plan: plan, Limit: limit}
+	}
+	return nil
+}
+
+// Outbox message kinds; the kind decides how long a queued message stays worth delivering
+const (
+	KindAlert   = "alert"   // availability alert, stale after AlertTTL
+	KindCatchUp = "catchup" // snooze catch-up, never expires
+	KindDigest  = "digest"  // alerts held during quiet hours, never expires
+	KindDaily   = "daily"   // daily digest of a NotifyDigest subscriber, never expires
+	KindAdmin   = "admin"   // administrative message, never expires
+	// KindReminder is a "remind me later" about Refuge and Date; its text is built at delivery
+	// from the latest availability, so it never expires
+	KindReminder = "reminder"
+)
+
+// AlertTTL is how long an availability alert is worth delivering; after that the spots are likely gone
+const AlertTTL = 30 * time.Minute
+
+// ExpiryFor returns when a message of kind created at created expires (zero: never)
+func ExpiryFor(kind string, created time.Time) time.Time {
+	if kind == KindAlert {
+		return created.Add(AlertTTL)
+	}
+	return time.Time{}
+}
+
+// OutboxMessage is a message queued for delayed delivery to a chat
+type OutboxMessage struct {
+	ID           string    `json:"id"`
+	ChatID       string    `json:"chat_id"`
+	Text         string    `json:"text"`
+	Kind         string    `json:"kind"`
+	DeliverAfter time.Time `json:"deliver_after"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"` // zero: never
+	Refuge       string    `json:"refuge,omitempty"`     // reminders only
+	Date         string    `json:"date,omitempty"`       // reminders only, YYYY-MM-DD
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Expired reports whether the message is too old to be delivered at now
+func (m OutboxMessage) Expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !now.Before(m.ExpiresAt)
+}
+
+// Notification is an alert about a date at a refuge delivered to a chat, with its free places
+// then. The notifications are the alert history, read back so nobody hears twice of a date.
+type Notification struct {
+	ChatID  string    `json:"chat_id"`
+	Refuge  string    `json:"refuge"`
+	Date    string    `json:"date"` // YYYY-MM-DD
+	Places  int       `json:"places"`
+	SentAt  time.Time `json:"sent_at"`
+	Channel string    `json:"channel"`
+}
+
+// Notification channels
+const (
+	ChannelTelegram = "telegram" // sent by the bot
+	ChannelEmail    = "email"    // sent by SMTP to the subscriber's Email
+)
+
+// Notification statuses recorded in the notification log
+const (
+	StatusSent    = "sent"
+	StatusExpired = "expired"
+	StatusAlerted = "alerted" // a date included in an alert, see ListAlertedChats
+	StatusGone    = "gone"    // the follow-up telling that an alerted date is booked out
+)
+
+// NotificationLogEntry records what happened to a queued message, or to one date of an alert
+// (Refuge and Date set)
+type NotificationLogEntry struct {
+	ChatID    string    `json:"chat_id"`
+	MessageID string    `json:"message_id"`
+	Kind      string    `json:"kind"`
+	Status    string    `json:"status"`
+	Refuge    string    `json:"refuge,omitempty"`
+	Date      string    `json:"date,omitempty"` // YYYY-MM-DD
+	At        time.Time `json:"at"`
+}
+
+// MatchDecision is why a chat wasn't alerted about a date available at a refuge its queries
+// watch, as decided by the check at CheckedAt
+type MatchDecision struct {
+	ChatID    string    `json:"chat_id"`
+	Refuge    string    `json:"refuge"`
+	Date      string    `json:"date"`               // YYYY-MM-DD
+	QueryID   string    `json:"query_id,omitempty"` // the query coming closest to matching
+	Reason    string    `json:"reason"`             // one of the Miss* reasons
+	Places    int       `json:"places"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Match decision reasons, in the order the conditions are checked
+const (
+	MissGroupSize       = "group_size"       // checked for another group size than the query's
+	MissWindow          = "date_window"      // outside the query's dates
+	MissWeekday         = "weekday"          // not on the query's weekdays
+	MissMinPlaces       = "min_places"       // fewer places than the query's minimum
+	MissAlreadyNotified = "already_notified" // alerted before and the places didn't go up
+	MissSnoozed         = "snoozed"          // alert held until the snooze ends
+	MissQuietHours      = "quiet_hours"      // alert held until the quiet hours end
+	MissDigest          = "daily_digest"     // alert held for the daily digest
+)
+
+// Snapshot is what one check saw at a refuge: the dates with free places at ObservedAt
+type Snapshot struct {
+	Refuge     string         `json:"refuge"`
+	ObservedAt time.Time      `json:"observed_at"`
+	Open       map[string]int `json:"open"` // YYYY-MM-DD -> free places
+}
+
+// DateSnapshot is the free places of a date at a refuge as seen by the check at CheckedAt
+type DateSnapshot struct {
+	ID        int64     `json:"id"` // set by the store, increasing
+	Refuge    string    `json:"refuge"`
+	Date      string    `json:"date"` // YYYY-MM-DD
+	Places    int       `json:"places"`
+	Previous  int       `json:"previous"` // places of the date's previous snapshot, set by the store
+	First     bool      `json:"first"`    // no previous snapshot of the date
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Transition reports whether the date opened or filled up with sn; a date's first snapshot counts
+func (sn DateSnapshot) Transition() bool {
+	return sn.First || (sn.Previous == 0) != (sn.Places == 0)
+}
+
+// DateSnapshotPage selects a page of date snapshots, in CheckedAt then ID order
+type DateSnapshotPage struct {
+	Refuge      string    // "" for every refuge
+	Date        string    // YYYY-MM-DD, "" for every date
+	Transitions bool      // only the snapshots where a date opened or filled up
+	After       time.Time // with AfterID, the last snapshot of the previous page; zero for the first page
+	AfterID     int64
+	Limit       int
+}
+
+// Includes reports whether sn is selected by p, regardless of the limit
+func (p DateSnapshotPage) Includes(sn DateSnapshot) bool {
+	if sn.CheckedAt.Before(p.After) || sn.CheckedAt.Equal(p.After) && sn.ID <= p.AfterID {
+		return false
+	}
+	return (p.Refuge == "" || sn.Refuge == p.Refuge) && (p.Date == "" || sn.Date == p.Date) && (!p.Transitions || sn.Transition())
+}
+
+// SeasonSummary is the archived history of one refuge for a season
+type SeasonSummary struct {
+	Season         int           `json:"season"`
+	Refuge         string        `json:"refuge"`
+	DaysMonitored  int           `json:"days_monitored"`  // days with at least one check
+	Windows        int           `json:"windows"`         // periods a date stayed bookable
+	MedianWindow   time.Duration `json:"median_window"`   // median length of those periods
+	Cancellations  int           `json:"cancellations"`   // windows opening after the first check, i.e. freed places
+	BusiestWeekday time.Weekday  `json:"busiest_weekday"` // weekday with most cancellations, if any
+}
+
+// Structure is an FFCAM structure an admin added at runtime, monitored alongside the configured refuges
+type Structure struct {
+	ID      string    `json:"id"` // e.g. BK_STRUCTURE:31
+	Name    string    `json:"name"`
+	AddedBy string    `json:"added_by"` // admin chat ID
+	AddedAt time.Time `json:"added_at"`
+}
+
 // Store abstracts persistent storage operations
 type Store interface {
 	Close() error
 
 	// Subscribers
-	UpsertSubscriber(sub Subscriber) error
-	GetSubscriber(chatID string) (Subscriber, error)
-	ListSubscribers() ([]Subscriber, error)
-	DeactivateSubscriber(chatID string) error
+	// UpsertSubscriber saves sub as given, IsActive included: saving a deactivated subscriber
+	// doesn't reactivate it
+	UpsertSubscriber(ctx context.Context, sub Subscriber) error
+	GetSubscriber(ctx context.Context, chatID string) (Subscriber, error)
+	// ListSubscribers returns the active subscribers
+	ListSubscribers(ctx context.Context) ([]Subscriber, error)
+	// PageSubscribers returns at most limit subscribers, active or not, with a chat ID after
+	// after ("" for the first page), in chat ID order
+	PageSubscribers(ctx context.Context, after string, limit int) ([]Subscriber, error)
+	// CountSubscribers returns how many subscribers are active
+	CountSubscribers(ctx context.Context) (int, error)
+	// ListSubscribersByLanguage returns the active subscribers whose language is lang
+	ListSubscribersByLanguage(ctx context.Context, lang string) ([]Subscriber, error)
+	DeactivateSubscriber(ctx context.Context, chatID string) error
 
 	// Queries
-	AddQuery(q Query) (string, error)
-	ListQueriesByChat(chatID string) ([]Query, error)
+	// AddQuery stores q; an active query past the limit of the chat's plan is refused with a
+	// PlanLimitError
+	AddQuery(ctx context.Context, q Query) (string, error)
+	ListQueriesByChat(ctx context.Context, chatID string) ([]Query, error)
+	// CountQueriesByChat returns how many active queries chatID has; completed one-shot
+	// queries don't count
+	CountQueriesByChat(ctx context.Context, chatID string) (int, error)
+	ListAllQueries(ctx context.Context) ([]Query, error)
+	// GetQuery returns the query with id, ErrNotFound when there is none
+	GetQuery(ctx context.Context, id string) (Query, error)
+	DeleteQuery(ctx context.Context, id string) error
+	// UpdateQuery replaces the filters of the query with q's ID, which must belong to q.ChatID
+	// (ErrNotFound otherwise)
+	UpdateQuery(ctx context.Context, q Query) error
+	SetQueryNotifyOnGone(ctx context.Context, id string, on bool) error
+	// SetQueryStatus marks the query with id QueryActive or QueryCompleted
+	SetQueryStatus(ctx context.Context, id string, status string) error
+
+	// Outbox
+	// EnqueueMessage inserts a message; if a pending message with the same ID exists,
+	// the text is appended to it and DeliverAfter is replaced.
+	EnqueueMessage(ctx context.Context, m OutboxMessage) error
+	ListDueMessages(ctx context.Context, now time.Time) ([]OutboxMessage, error)
+	DeleteMessage(ctx context.Context, id string) error
+
+	// Notification log
+	LogNotification(ctx context.Context, e NotificationLogEntry) error
+	CountNotifications(ctx context.Context, status string, since time.Time) (int, error)
+	// ListAlertedChats returns the chats alerted about date at refuge (StatusAlerted) and not
+	// told since that it is gone (StatusGone)
+	ListAlertedChats(ctx context.Context, refuge string, date string) ([]string, error)
+
+	// Alert history
+	RecordNotification(ctx context.Context, n Notification) error
+	// WasNotified reports whether chatID was alerted about date at refuge
+	WasNotified(ctx context.Context, chatID string, refuge string, date string) (bool, error)
+	// ListNotifiedDates returns the latest notification of each date chatID was alerted about
+	ListNotifiedDates(ctx context.Context, chatID string) ([]Notification, error)
+	// CountRecordedNotifications counts the notifications sent since
+	CountRecordedNotifications(ctx context.Context, since time.Time) (int, error)
+	// DeleteNotificationsBefore removes the notifications of dates before date (YYYY-MM-DD)
+	// and returns how many
+	DeleteNotificationsBefore(ctx context.Context, date string) (int, error)
+
+	// Near misses
+	RecordMatchDecisions(ctx context.Context, ds []MatchDecision) error
+	// ListMatchDecisions returns the decisions about date (YYYY-MM-DD) for chatID, oldest first
+	ListMatchDecisions(ctx context.Context, chatID string, date string) ([]MatchDecision, error)
+	// DeleteMatchDecisionsBefore removes the decisions of checks before t and returns how many
+	DeleteMatchDecisionsBefore(ctx context.Context, t time.Time) (int, error)
+
+	// Season history
+	RecordSnapshot(ctx context.Context, sn Snapshot) error
+	// ListSnapshots returns the snapshots observed in [from, to), oldest first
+	ListSnapshots(ctx context.Context, from time.Time, to time.Time) ([]Snapshot, error)
+	// DeleteSnapshots removes the snapshots observed in [from, to) and returns how many
+	DeleteSnapshots(ctx context.Context, from time.Time, to time.Time) (int, error)
+	// SaveDateSnapshots stores the snapshots whose places differ from the latest one stored for
+	// their refuge and date, and returns how many were stored
+	SaveDateSnapshots(ctx context.Context, sns []DateSnapshot) (int, error)
+	// ListDateSnapshots returns the snapshots of refuge checked in [from, to), oldest first
+	ListDateSnapshots(ctx context.Context, refuge string, from time.Time, to time.Time) ([]DateSnapshot, error)
+	// PageDateSnapshots returns the snapshots of p, at most p.Limit
+	PageDateSnapshots(ctx context.Context, p DateSnapshotPage) ([]DateSnapshot, error)
+	// DeleteDateSnapshotsBefore removes the snapshots checked before t and returns how many
+	DeleteDateSnapshotsBefore(ctx context.Context, t time.Time) (int, error)
+	// SaveSeasonSummaries replaces the summaries of season
+	SaveSeasonSummaries(ctx context.Context, season int, sums []SeasonSummary) error
+	ListSeasonSummaries(ctx context.Context, season int) ([]SeasonSummary, error)
+
+	// Structures added at runtime
+	AddStructure(ctx context.Context, s Structure) error
+	// ListStructures returns the added structures, oldest first
+	ListStructures(ctx context.Context) ([]Structure, error)
+	DeleteStructure(ctx context.Context, id string) error
+
+	// Retention
+	// PurgeExpired deletes at most limit rows of p last written before t and returns how many;
+	// it is called again while it returns limit, so no statement holds its locks for long
+	PurgeExpired(ctx context.Context, p RetentionPolicy, before time.Time, limit int) (int, error)
+
+	// Settings (key/value, e.g. feature flags)
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key string, value string) error
+	ListSettings(ctx context.Context, prefix string) (map[string]string, error)
 }
 
 var ErrNotFound = errors.New("not found")
+
+// GetChatQuery returns the query with id when it belongs to chatID. Someone else's query is
+// ErrNotFound too, so a chat can't tell it exists.
+func GetChatQuery(ctx context.Context, st Store, chatID string, id string) (Query, error) {
+	q, err := st.GetQuery(ctx, id)
+	if err != nil {
+		return Query{}, err
+	}
+	if q.ChatID != chatID {
+		return Query{}, ErrNotFound
+	}
+	return q, nil
+}
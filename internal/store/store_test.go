@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestQuietUntil(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	night := store.Subscriber{QuietFrom: "22:00", QuietTo: "07:00", Timezone: "Europe/Paris"}
+	lunch := store.Subscriber{QuietFrom: "12:00", QuietTo: "13:30"}
+	for _, tt := range []struct {
+		name string
+		sub  store.Subscriber
+		now  time.Time
+		want time.Time
+	}{
+		{"no quiet hours", store.Subscriber{}, time.Date(2025, 7, 1, 3, 0, 0, 0, paris), time.Time{}},
+		{"before midnight", night, time.Date(2025, 7, 1, 23, 15, 0, 0, paris), time.Date(2025, 7, 2, 7, 0, 0, 0, paris)},
+		{"after midnight", night, time.Date(2025, 7, 2, 3, 0, 0, 0, paris), time.Date(2025, 7, 2, 7, 0, 0, 0, paris)},
+		{"window start", night, time.Date(2025, 7, 1, 22, 0, 0, 0, paris), time.Date(2025, 7, 2, 7, 0, 0, 0, paris)},
+		{"window end", night, time.Date(2025, 7, 2, 7, 0, 0, 0, paris), time.Time{}},
+		{"daytime", night, time.Date(2025, 7, 2, 15, 0, 0, 0, paris), time.Time{}},
+		{"in the subscriber's time zone", night, time.Date(2025, 7, 1, 20, 30, 0, 0, time.UTC), time.Date(2025, 7, 2, 7, 0, 0, 0, paris)},
+		{"across the month end", night, time.Date(2025, 7, 31, 23, 0, 0, 0, paris), time.Date(2025, 8, 1, 7, 0, 0, 0, paris)},
+		{"UTC by default", lunch, time.Date(2025, 7, 1, 12, 45, 0, 0, time.UTC), time.Date(2025, 7, 1, 13, 30, 0, 0, time.UTC)},
+		{"after a same-day window", lunch, time.Date(2025, 7, 1, 13, 30, 0, 0, time.UTC), time.Time{}},
+		{"empty window", store.Subscriber{QuietFrom: "07:00", QuietTo: "07:00"}, time.Date(2025, 7, 1, 7, 0, 0, 0, time.UTC), time.Time{}},
+	} {
+		if got := tt.sub.QuietUntil(tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s: QuietUntil(%v) = %v, want %v", tt.name, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	for _, tt := range []struct {
+		from, to string
+		valid    bool
+	}{
+		{"", "", true},
+		{"2025-07-01", "", true},
+		{"", "2025-07-31", true},
+		{"2025-07-01", "2025-07-01", true},
+		{"2025-07-01", "2025-07-31", true},
+		{"2025-07-32", "", false},
+		{"2025-7-1", "", false},
+		{"20250701", "", false},
+		{"", "2025-07-31T00:00:00Z", false},
+		{"2025-07-31", "2025-07-01", false},
+	} {
+		err := store.Query{DateFrom: tt.from, DateTo: tt.to}.Validate()
+		if tt.valid && err != nil || !tt.valid && !errors.Is(err, store.ErrInvalidQuery) {
+			t.Errorf("Validate(%q, %q) = %v, want valid %t", tt.from, tt.to, err, tt.valid)
+		}
+	}
+}
+
+func TestInWindowComparesCalendarDates(t *testing.T) {
+	q := store.Query{DateFrom: "2025-07-01", DateTo: "2025-07-31"}
+	for date, want := range map[string]bool{
+		"2025-06-30": false,
+		"2025-07-01": true,
+		"2025-07-31": true,
+		"2025-08-01": false,
+		"2025-07":    false,
+		"":           false,
+	} {
+		if got := q.InWindow(date); got != want {
+			t.Errorf("InWindow(%q) = %t, want %t", date, got, want)
+		}
+	}
+	// bounds are whole days, whatever the local time zone
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("UTC-10", -10*60*60)
+	if !(store.Query{DateTo: "2025-07-31"}).InWindow("2025-07-31") || (store.Query{DateFrom: "2025-07-02"}).InWindow("2025-07-01") {
+		t.Error("open windows don't compare calendar dates")
+	}
+}
+
+func TestNextDigest(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	sub := store.Subscriber{Timezone: "Europe/Paris"}
+	for _, tt := range []struct {
+		name string
+		sub  store.Subscriber
+		now  time.Time
+		want time.Time
+	}{
+		{"later today", sub, time.Date(2025, 7, 1, 6, 30, 0, 0, paris), time.Date(2025, 7, 1, 8, 0, 0, 0, paris)},
+		{"at the hour", sub, time.Date(2025, 7, 1, 8, 0, 0, 0, paris), time.Date(2025, 7, 2, 8, 0, 0, 0, paris)},
+		{"tomorrow", sub, time.Date(2025, 7, 1, 21, 0, 0, 0, paris), time.Date(2025, 7, 2, 8, 0, 0, 0, paris)},
+		{"in the subscriber's time zone", sub, time.Date(2025, 7, 1, 5, 30, 0, 0, time.UTC), time.Date(2025, 7, 1, 8, 0, 0, 0, paris)},
+		{"across the month end", sub, time.Date(2025, 7, 31, 9, 0, 0, 0, paris), time.Date(2025, 8, 1, 8, 0, 0, 0, paris)},
+		{"UTC by default", store.Subscriber{}, time.Date(2025, 7, 1, 7, 0, 0, 0, time.UTC), time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)},
+	} {
+		if got := tt.sub.NextDigest(tt.now, 8); !got.Equal(tt.want) {
+			t.Errorf("%s: NextDigest(%v) = %v, want %v", tt.name, tt.now, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,588 @@
+// Package storetest holds behaviour every store.Store implementation must share, run against
+// Postgres, SQLite and store.MemoryStore alike
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// Notifications checks the alert history of st, which must hold no notifications yet
+func Notifications(t *testing.T, st store.Store) {
+	t.Helper()
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	for _, n := range []store.Notification{
+		{ChatID: "1", Refuge: "Tête Rousse", Date: "2025-07-10", Places: 1, SentAt: at, Channel: store.ChannelTelegram},
+		{ChatID: "1", Refuge: "Tête Rousse", Date: "2025-07-10", Places: 4, SentAt: at.Add(time.Hour), Channel: store.ChannelTelegram},
+		{ChatID: "1", Refuge: "du Goûter", Date: "2025-07-10", Places: 2, SentAt: at, Channel: store.ChannelTelegram},
+		{ChatID: "2", Refuge: "du Goûter", Date: "2025-06-30", Places: 3, SentAt: at.Add(-48 * time.Hour), Channel: store.ChannelTelegram},
+	} {
+		if err := st.RecordNotification(t.Context(), n); err != nil {
+			t.Fatalf("RecordNotification: %v", err)
+		}
+	}
+
+	for _, c := range []struct {
+		chatID, refuge, date string
+		want                 bool
+	}{
+		{"1", "Tête Rousse", "2025-07-10", true},
+		{"1", "du Goûter", "2025-07-10", true},
+		{"1", "Tête Rousse", "2025-07-11", false},
+		{"2", "Tête Rousse", "2025-07-10", false}, // another chat
+	} {
+		if got, err := st.WasNotified(t.Context(), c.chatID, c.refuge, c.date); err != nil || got != c.want {
+			t.Errorf("WasNotified(%s, %s, %s) = %v, %v; want %v", c.chatID, c.refuge, c.date, got, err, c.want)
+		}
+	}
+
+	// the latest notification of each date, refuges apart
+	ns, err := st.ListNotifiedDates(t.Context(), "1")
+	if err != nil {
+		t.Fatalf("ListNotifiedDates: %v", err)
+	}
+	places := map[string]int{}
+	for _, n := range ns {
+		places[n.Refuge+" "+n.Date] = n.Places
+	}
+	if len(ns) != 2 || places["Tête Rousse 2025-07-10"] != 4 || places["du Goûter 2025-07-10"] != 2 {
+		t.Errorf("unexpected notified dates %+v", ns)
+	}
+
+	if n, err := st.CountRecordedNotifications(t.Context(), at.Add(-24*time.Hour)); err != nil || n != 3 {
+		t.Errorf("CountRecordedNotifications = %d, %v; want 3", n, err)
+	}
+
+	if n, err := st.DeleteNotificationsBefore(t.Context(), "2025-07-01"); err != nil || n != 1 {
+		t.Errorf("DeleteNotificationsBefore = %d, %v; want 1", n, err)
+	}
+	if got, _ := st.WasNotified(t.Context(), "2", "du Goûter", "2025-06-30"); got {
+		t.Error("expected the past date deleted")
+	}
+}
+
+// DateSnapshots checks the availability history of st, which must hold no date snapshots yet
+func DateSnapshots(t *testing.T, st store.Store) {
+	t.Helper()
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	checks := [][]store.DateSnapshot{
+		{{Refuge: "du Goûter", Date: "2025-07-10", Places: 0, CheckedAt: at}, {Refuge: "Tête Rousse", Date: "2025-07-10", Places: 2, CheckedAt: at}},
+		{{Refuge: "du Goûter", Date: "2025-07-10", Places: 0, CheckedAt: at.Add(time.Minute)}, {Refuge: "Tête Rousse", Date: "2025-07-10", Places: 2, CheckedAt: at.Add(time.Minute)}},
+		{{Refuge: "du Goûter", Date: "2025-07-10", Places: 3, CheckedAt: at.Add(2 * time.Minute)}, {Refuge: "Tête Rousse", Date: "2025-07-10", Places: 2, CheckedAt: at.Add(2 * time.Minute)}},
+		{{Refuge: "du Goûter", Date: "2025-07-10", Places: 0, CheckedAt: at.Add(48 * time.Hour)}},
+	}
+	// only changed places are stored
+	for i, want := range []int{2, 0, 1, 1} {
+		if n, err := st.SaveDateSnapshots(t.Context(), checks[i]); err != nil || n != want {
+			t.Errorf("SaveDateSnapshots of check %d = %d, %v; want %d", i, n, err, want)
+		}
+	}
+
+	sns, err := st.ListDateSnapshots(t.Context(), "du Goûter", at, at.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("ListDateSnapshots: %v", err)
+	}
+	if len(sns) != 2 || sns[0].Places != 0 || sns[1].Places != 3 || !sns[1].CheckedAt.Equal(at.Add(2*time.Minute)) {
+		t.Errorf("unexpected du Goûter snapshots %+v", sns)
+	}
+
+	if n, err := st.DeleteDateSnapshotsBefore(t.Context(), at.Add(time.Hour)); err != nil || n != 3 {
+		t.Errorf("DeleteDateSnapshotsBefore = %d, %v; want 3", n, err)
+	}
+	if sns, _ := st.ListDateSnapshots(t.Context(), "du Goûter", at, at.Add(72*time.Hour)); len(sns) != 1 || sns[0].Places != 0 {
+		t.Errorf("expected only the latest du Goûter snapshot kept, got %+v", sns)
+	}
+}
+
+// DateSnapshotPages checks paging through the availability history of st, which must hold no
+// date snapshots yet: filters, the previous places set by the store, and resuming after the last
+// snapshot of a page while more are saved
+func DateSnapshotPages(t *testing.T, st store.Store) {
+	t.Helper()
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	save := func(min int, places ...int) {
+		t.Helper()
+		var sns []store.DateSnapshot
+		for i, n := range places {
+			sns = append(sns, store.DateSnapshot{Refuge: "du Goûter", Date: fmt.Sprintf("2025-07-%02d", 10+i), Places: n, CheckedAt: at.Add(time.Duration(min) * time.Minute)})
+		}
+		if _, err := st.SaveDateSnapshots(t.Context(), sns); err != nil {
+			t.Fatalf("SaveDateSnapshots: %v", err)
+		}
+	}
+	save(0, 0, 2, 5)
+	save(1, 3, 2, 4) // 07-10 opens, 07-12 goes down
+
+	all, err := st.PageDateSnapshots(t.Context(), store.DateSnapshotPage{Limit: 10})
+	if err != nil || len(all) != 5 {
+		t.Fatalf("PageDateSnapshots = %+v, %v; want 5 snapshots", all, err)
+	}
+	if last := all[4]; last.Date != "2025-07-12" || last.Places != 4 || last.Previous != 5 || last.First || last.Transition() {
+		t.Errorf("unexpected last snapshot %+v", last)
+	}
+	if !all[0].First || all[0].ID >= all[3].ID {
+		t.Errorf("unexpected first snapshot %+v", all[0])
+	}
+	trans, _ := st.PageDateSnapshots(t.Context(), store.DateSnapshotPage{Transitions: true, Date: "2025-07-10", Limit: 10})
+	if len(trans) != 2 || trans[1].Places != 3 || trans[1].Previous != 0 {
+		t.Errorf("unexpected 2025-07-10 transitions %+v", trans)
+	}
+	if other, _ := st.PageDateSnapshots(t.Context(), store.DateSnapshotPage{Refuge: "Tête Rousse", Limit: 10}); len(other) != 0 {
+		t.Errorf("expected no Tête Rousse snapshots, got %+v", other)
+	}
+
+	// pages of 2, saving a check after each page
+	var seen []store.DateSnapshot
+	p := store.DateSnapshotPage{Limit: 2}
+	for page := 0; page < 10; page++ {
+		sns, err := st.PageDateSnapshots(t.Context(), p)
+		if err != nil {
+			t.Fatalf("PageDateSnapshots: %v", err)
+		}
+		if len(sns) > p.Limit {
+			t.Fatalf("page %d has %d snapshots, limit %d", page, len(sns), p.Limit)
+		}
+		if len(sns) == 0 {
+			break
+		}
+		seen = append(seen, sns...)
+		p.After, p.AfterID = sns[len(sns)-1].CheckedAt, sns[len(sns)-1].ID
+		if page < 3 {
+			save(2+page, page, 2, 6+page)
+		}
+	}
+	ids := make(map[int64]bool, len(seen))
+	for _, sn := range seen {
+		if ids[sn.ID] {
+			t.Errorf("snapshot %+v seen twice", sn)
+		}
+		ids[sn.ID] = true
+	}
+	// the first 5, then 07-10 going 0, 1, 2 and 07-12 going 6, 7, 8
+	if len(seen) != 11 {
+		t.Errorf("paged through %d snapshots, want 11: %+v", len(seen), seen)
+	}
+}
+
+// Queries checks adding, updating and deleting the queries of st, which must hold none yet
+func Queries(t *testing.T, st store.Store) {
+	t.Helper()
+	if err := st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true}); err != nil {
+		t.Fatalf("UpsertSubscriber: %v", err)
+	}
+	id, err := st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	if err != nil {
+		t.Fatalf("AddQuery: %v", err)
+	}
+
+	want := store.Query{ID: id, ChatID: "1", Refuge: "du Goûter", DateFrom: "2025-08-01", DateTo: "2025-08-15", MinPlaces: 2,
+		Weekdays: store.Weekdays(1 << time.Saturday), Label: "club", NotifyOnGone: true, Pax: 3, OneShot: true, Status: store.QueryActive}
+	if err := st.UpdateQuery(t.Context(), want); err != nil {
+		t.Fatalf("UpdateQuery: %v", err)
+	}
+	got, err := st.GetQuery(t.Context(), id)
+	if err != nil {
+		t.Fatalf("GetQuery: %v", err)
+	}
+	got.CreatedAt, got.LastUpdatedAt = time.Time{}, time.Time{}
+	if got != want {
+		t.Errorf("GetQuery after UpdateQuery = %+v, want %+v", got, want)
+	}
+
+	// queries of other chats and unknown queries are not found
+	other := want
+	other.ChatID = "2"
+	if err := st.UpdateQuery(t.Context(), other); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateQuery of another chat = %v, want ErrNotFound", err)
+	}
+	other = want
+	other.ID = "missing"
+	if err := st.UpdateQuery(t.Context(), other); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateQuery of an unknown query = %v, want ErrNotFound", err)
+	}
+	if _, err := st.GetQuery(t.Context(), "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetQuery of an unknown query = %v, want ErrNotFound", err)
+	}
+	if q, err := store.GetChatQuery(t.Context(), st, "1", id); err != nil || q.ID != id {
+		t.Errorf("GetChatQuery of the owner = %+v, %v", q, err)
+	}
+	if _, err := store.GetChatQuery(t.Context(), st, "2", id); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetChatQuery of another chat = %v, want ErrNotFound", err)
+	}
+
+	// a completed query stays completed through edits until re-armed
+	if err := st.SetQueryStatus(t.Context(), id, store.QueryCompleted); err != nil {
+		t.Fatalf("SetQueryStatus: %v", err)
+	}
+	if err := st.UpdateQuery(t.Context(), want); err != nil {
+		t.Fatalf("UpdateQuery: %v", err)
+	}
+	if got, err := st.GetQuery(t.Context(), id); err != nil || !got.Completed() || !got.OneShot {
+		t.Errorf("GetQuery after SetQueryStatus = %+v, %v, want a completed one-shot query", got, err)
+	}
+	if err := st.SetQueryStatus(t.Context(), "missing", store.QueryActive); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("SetQueryStatus of an unknown query = %v, want ErrNotFound", err)
+	}
+
+	if err := st.DeleteQuery(t.Context(), id); err != nil {
+		t.Fatalf("DeleteQuery: %v", err)
+	}
+	if _, err := st.GetQuery(t.Context(), id); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetQuery after DeleteQuery = %v, want ErrNotFound", err)
+	}
+	if err := st.DeleteQuery(t.Context(), id); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("DeleteQuery twice = %v, want ErrNotFound", err)
+	}
+
+	// open ends are kept and dates come back as stored, whatever the time zones; malformed
+	// dates are refused
+	open, err := st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01"})
+	if err != nil {
+		t.Fatalf("AddQuery of an open window: %v", err)
+	}
+	if got, err := st.GetQuery(t.Context(), open); err != nil || got.DateFrom != "2025-07-01" || got.DateTo != "" {
+		t.Errorf("GetQuery of an open window = %+v, %v", got, err)
+	}
+	for _, q := range []store.Query{
+		{ChatID: "1", Refuge: "*", DateFrom: "2025-7-01", DateTo: "2025-07-31"},
+		{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-02-30"},
+		{ChatID: "1", Refuge: "*", DateFrom: "tomorrow"},
+		{ChatID: "1", Refuge: "*", DateFrom: "2025-08-01", DateTo: "2025-07-31"},
+	} {
+		if _, err := st.AddQuery(t.Context(), q); !errors.Is(err, store.ErrInvalidQuery) {
+			t.Errorf("AddQuery(%s → %s) = %v, want ErrInvalidQuery", q.DateFrom, q.DateTo, err)
+		}
+		q.ID = open
+		if err := st.UpdateQuery(t.Context(), q); !errors.Is(err, store.ErrInvalidQuery) {
+			t.Errorf("UpdateQuery(%s → %s) = %v, want ErrInvalidQuery", q.DateFrom, q.DateTo, err)
+		}
+	}
+	if qs, err := st.ListQueriesByChat(t.Context(), "1"); err != nil || len(qs) != 1 || qs[0].DateFrom != "2025-07-01" || qs[0].DateTo != "" {
+		t.Errorf("ListQueriesByChat after invalid queries = %+v, %v; want the open window alone", qs, err)
+	}
+}
+
+// QueryLimits checks AddQuery against the plan limits (2 active queries on the free plan by default)
+func QueryLimits(t *testing.T, st store.Store) {
+	t.Helper()
+	for _, sub := range []store.Subscriber{{ChatID: "free", IsActive: true}, {ChatID: "pro", Plan: store.PlanPro, IsActive: true}} {
+		if err := st.UpsertSubscriber(t.Context(), sub); err != nil {
+			t.Fatalf("UpsertSubscriber: %v", err)
+		}
+	}
+	var ids []string
+	for i := range 2 {
+		id, err := st.AddQuery(t.Context(), store.Query{ChatID: "free", Refuge: "*", DateFrom: fmt.Sprintf("2025-07-%02d", i+1)})
+		if err != nil {
+			t.Fatalf("AddQuery %d: %v", i, err)
+		}
+		ids = append(ids, id)
+	}
+	if n, err := st.CountQueriesByChat(t.Context(), "free"); err != nil || n != 2 {
+		t.Errorf("CountQueriesByChat = %d, %v, want 2", n, err)
+	}
+
+	// hitting the limit
+	_, err := st.AddQuery(t.Context(), store.Query{ChatID: "free", Refuge: "*"})
+	var le *store.PlanLimitError
+	if !errors.Is(err, store.ErrPlanLimit) || !errors.As(err, &le) || le.Plan != store.PlanFree || le.Limit != 2 {
+		t.Fatalf("AddQuery past the limit = %v, want a PlanLimitError of the free plan", err)
+	}
+	if qs, _ := st.ListQueriesByChat(t.Context(), "free"); len(qs) != 2 {
+		t.Errorf("refused query stored: %+v", qs)
+	}
+
+	// completed one-shot queries don't count, and neither does a deleted query
+	if err := st.SetQueryStatus(t.Context(), ids[0], store.QueryCompleted); err != nil {
+		t.Fatalf("SetQueryStatus: %v", err)
+	}
+	if n, _ := st.CountQueriesByChat(t.Context(), "free"); n != 1 {
+		t.Errorf("CountQueriesByChat with a completed query = %d, want 1", n)
+	}
+	if _, err := st.AddQuery(t.Context(), store.Query{ChatID: "free", Refuge: "*"}); err != nil {
+		t.Errorf("AddQuery after a query completed: %v", err)
+	}
+	if err := st.DeleteQuery(t.Context(), ids[1]); err != nil {
+		t.Fatalf("DeleteQuery: %v", err)
+	}
+	if _, err := st.AddQuery(t.Context(), store.Query{ChatID: "free", Refuge: "*"}); err != nil {
+		t.Errorf("AddQuery after a query was deleted: %v", err)
+	}
+	if _, err := st.AddQuery(t.Context(), store.Query{ChatID: "free", Refuge: "*"}); !errors.Is(err, store.ErrPlanLimit) {
+		t.Errorf("AddQuery past the limit again = %v, want ErrPlanLimit", err)
+	}
+
+	// concurrent adds can't both take the last slot
+	if err := st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "race", IsActive: true}); err != nil {
+		t.Fatalf("UpsertSubscriber: %v", err)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = st.AddQuery(t.Context(), store.Query{ID: fmt.Sprintf("race-%d", i), ChatID: "race", Refuge: "*"})
+		}()
+	}
+	wg.Wait()
+	added := 0
+	for _, err := range errs {
+		if err == nil {
+			added++
+		} else if !errors.Is(err, store.ErrPlanLimit) {
+			t.Errorf("concurrent AddQuery: %v", err)
+		}
+	}
+	if n, _ := st.CountQueriesByChat(t.Context(), "race"); added != 2 || n != 2 {
+		t.Errorf("concurrent AddQuery added %d queries, %d stored; want 2", added, n)
+	}
+
+	// the pro plan is unlimited
+	for i := range 5 {
+		if _, err := st.AddQuery(t.Context(), store.Query{ChatID: "pro", Refuge: "*"}); err != nil {
+			t.Fatalf("AddQuery %d on the pro plan: %v", i, err)
+		}
+	}
+	if n, _ := st.CountQueriesByChat(t.Context(), "pro"); n != 5 {
+		t.Errorf("CountQueriesByChat on the pro plan = %d, want 5", n)
+	}
+}
+
+// Subscribers checks storing and deactivating the subscribers of st, which must hold none yet
+func Subscribers(t *testing.T, st store.Store) {
+	t.Helper()
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	want := store.Subscriber{ChatID: "1", Username: "alice", Language: "de", Plan: "free", IsActive: true, SnoozedUntil: at,
+		ConsentAt: at, ConsentSource: store.ConsentWebForm, ConsentIP: "192.0.2.1", NotifyOnSeasonOpen: true,
+		SeasonNotified: map[string]int{"du Goûter": 2025}, Email: "alice@example.org", LanguageLocked: true,
+		QuietFrom: "22:30", QuietTo: "07:00", Timezone: "Europe/Paris", NotifyMode: store.NotifyDigest}
+	for _, sub := range []store.Subscriber{want, {ChatID: "2", Language: "en", IsActive: true}} {
+		if err := st.UpsertSubscriber(t.Context(), sub); err != nil {
+			t.Fatalf("UpsertSubscriber: %v", err)
+		}
+	}
+	got, err := st.GetSubscriber(t.Context(), "1")
+	if err != nil {
+		t.Fatalf("GetSubscriber: %v", err)
+	}
+	if !got.SnoozedUntil.Equal(at) || !got.ConsentAt.Equal(at) || !got.WeeklySentAt.IsZero() {
+		t.Errorf("unexpected times %+v", got)
+	}
+	got.CreatedAt, got.LastUpdatedAt, got.SnoozedUntil, got.ConsentAt = time.Time{}, time.Time{}, want.SnoozedUntil, want.ConsentAt
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("GetSubscriber = %+v, want %+v", got, want)
+	}
+	if _, err := st.GetSubscriber(t.Context(), "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetSubscriber of an unknown chat = %v, want ErrNotFound", err)
+	}
+
+	if err := st.DeactivateSubscriber(t.Context(), "2"); err != nil {
+		t.Fatalf("DeactivateSubscriber: %v", err)
+	}
+	if subs, err := st.ListSubscribers(t.Context()); err != nil || len(subs) != 1 || subs[0].ChatID != "1" {
+		t.Errorf("ListSubscribers = %+v, %v; want chat 1 alone", subs, err)
+	}
+	if sub, err := st.GetSubscriber(t.Context(), "2"); err != nil || sub.IsActive {
+		t.Errorf("expected chat 2 kept inactive, got %+v, %v", sub, err)
+	}
+	// saving a deactivated subscriber keeps it deactivated until it is explicitly reactivated
+	sub, _ := st.GetSubscriber(t.Context(), "2")
+	sub.Language = "fr"
+	if err := st.UpsertSubscriber(t.Context(), sub); err != nil {
+		t.Fatalf("UpsertSubscriber: %v", err)
+	}
+	if sub, err := st.GetSubscriber(t.Context(), "2"); err != nil || sub.IsActive || sub.Language != "fr" {
+		t.Errorf("expected chat 2 updated and still inactive, got %+v, %v", sub, err)
+	}
+	if subs, err := st.ListSubscribers(t.Context()); err != nil || len(subs) != 1 {
+		t.Errorf("ListSubscribers after updating an inactive subscriber = %+v, %v; want chat 1 alone", subs, err)
+	}
+	if n, err := st.CountSubscribers(t.Context()); err != nil || n != 1 {
+		t.Errorf("CountSubscribers = %d, %v; want 1", n, err)
+	}
+	if subs, err := st.ListSubscribersByLanguage(t.Context(), "de"); err != nil || len(subs) != 1 || subs[0].ChatID != "1" {
+		t.Errorf("ListSubscribersByLanguage(de) = %+v, %v; want chat 1 alone", subs, err)
+	}
+	if subs, err := st.ListSubscribersByLanguage(t.Context(), "fr"); err != nil || len(subs) != 0 {
+		t.Errorf("ListSubscribersByLanguage(fr) = %+v, %v; want none, chat 2 is inactive", subs, err)
+	}
+	sub.IsActive = true
+	if err := st.UpsertSubscriber(t.Context(), sub); err != nil {
+		t.Fatalf("UpsertSubscriber: %v", err)
+	}
+	if subs, err := st.ListSubscribers(t.Context()); err != nil || len(subs) != 2 {
+		t.Errorf("ListSubscribers after reactivating = %+v, %v; want both chats", subs, err)
+	}
+	if err := st.DeactivateSubscriber(t.Context(), "2"); err != nil {
+		t.Fatalf("DeactivateSubscriber: %v", err)
+	}
+
+	// pages hold inactive subscribers too
+	if err := st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "3", IsActive: true}); err != nil {
+		t.Fatalf("UpsertSubscriber: %v", err)
+	}
+	var paged []string
+	for after := ""; ; {
+		page, err := st.PageSubscribers(t.Context(), after, 2)
+		if err != nil {
+			t.Fatalf("PageSubscribers: %v", err)
+		}
+		for _, sub := range page {
+			paged = append(paged, sub.ChatID)
+		}
+		if len(page) < 2 {
+			break
+		}
+		after = page[len(page)-1].ChatID
+	}
+	if fmt.Sprint(paged) != "[1 2 3]" {
+		t.Errorf("paged through %v, want [1 2 3]", paged)
+	}
+}
+
+// Settings checks the key/value settings of st, which must hold none yet
+func Settings(t *testing.T, st store.Store) {
+	t.Helper()
+	for k, v := range map[string]string{"flag:a": "1", "flag:b": "0", "session": "s"} {
+		if err := st.SetSetting(t.Context(), k, v); err != nil {
+			t.Fatalf("SetSetting: %v", err)
+		}
+	}
+	if err := st.SetSetting(t.Context(), "flag:b", "1"); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	if v, err := st.GetSetting(t.Context(), "flag:b"); err != nil || v != "1" {
+		t.Errorf("GetSetting after an update = %q, %v; want 1", v, err)
+	}
+	if _, err := st.GetSetting(t.Context(), "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetSetting of an unknown key = %v, want ErrNotFound", err)
+	}
+	if flags, err := st.ListSettings(t.Context(), "flag:"); err != nil || fmt.Sprint(flags) != "map[flag:a:1 flag:b:1]" {
+		t.Errorf("ListSettings = %v, %v", flags, err)
+	}
+}
+
+// MatchDecisions checks the near misses of st, which must hold none yet
+func MatchDecisions(t *testing.T, st store.Store) {
+	t.Helper()
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	ds := []store.MatchDecision{
+		{ChatID: "1", Refuge: "du Goûter", Date: "2025-08-12", QueryID: "q1", Reason: store.MissMinPlaces, Places: 1, CheckedAt: at},
+		{ChatID: "1", Refuge: "du Goûter", Date: "2025-08-12", Reason: store.MissSnoozed, Places: 3, CheckedAt: at.Add(time.Hour)},
+		{ChatID: "1", Refuge: "du Goûter", Date: "2025-08-13", QueryID: "q1", Reason: store.MissWindow, Places: 2, CheckedAt: at},
+		{ChatID: "2", Refuge: "du Goûter", Date: "2025-08-12", QueryID: "q2", Reason: store.MissWeekday, Places: 1, CheckedAt: at},
+	}
+	if err := st.RecordMatchDecisions(t.Context(), ds); err != nil {
+		t.Fatalf("RecordMatchDecisions: %v", err)
+	}
+	if err := st.RecordMatchDecisions(t.Context(), nil); err != nil {
+		t.Errorf("RecordMatchDecisions of none = %v", err)
+	}
+	got, err := st.ListMatchDecisions(t.Context(), "1", "2025-08-12")
+	if err != nil {
+		t.Fatalf("ListMatchDecisions: %v", err)
+	}
+	if len(got) != 2 || got[0].Reason != store.MissMinPlaces || got[0].QueryID != "q1" || got[1].Reason != store.MissSnoozed ||
+		got[1].QueryID != "" || got[1].Places != 3 || !got[1].CheckedAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("unexpected decisions %+v", got)
+	}
+	if n, err := st.DeleteMatchDecisionsBefore(t.Context(), at.Add(time.Minute)); err != nil || n != 3 {
+		t.Errorf("DeleteMatchDecisionsBefore = %d, %v; want 3", n, err)
+	}
+	if got, _ := st.ListMatchDecisions(t.Context(), "1", "2025-08-12"); len(got) != 1 || got[0].Reason != store.MissSnoozed {
+		t.Errorf("expected the later decision kept, got %+v", got)
+	}
+}
+
+// Retention checks that purging st to its retention policies deletes the old rows of each table
+// and keeps the fresh ones; st must hold nothing yet
+func Retention(t *testing.T, st store.Store) {
+	t.Helper()
+	ctx := t.Context()
+	now := time.Now()
+	old, fresh := now.Add(-400*24*time.Hour), now.Add(time.Hour)
+	for _, sub := range []store.Subscriber{{ChatID: "1", Language: "en", IsActive: true}, {ChatID: "2", Language: "en", IsActive: true}} {
+		if err := st.UpsertSubscriber(ctx, sub); err != nil {
+			t.Fatalf("UpsertSubscriber: %v", err)
+		}
+	}
+	if _, err := st.AddQuery(ctx, store.Query{ChatID: "2", Refuge: "*"}); err != nil {
+		t.Fatalf("AddQuery: %v", err)
+	}
+	if err := st.DeactivateSubscriber(ctx, "2"); err != nil {
+		t.Fatalf("DeactivateSubscriber: %v", err)
+	}
+	for _, at := range []time.Time{old, old, fresh} {
+		if err := st.LogNotification(ctx, store.NotificationLogEntry{ChatID: "1", MessageID: "m", Kind: store.KindAlert, Status: store.StatusAlerted, At: at}); err != nil {
+			t.Fatalf("LogNotification: %v", err)
+		}
+		if err := st.RecordNotification(ctx, store.Notification{ChatID: "1", Refuge: "du Goûter", Date: "2025-08-12", Places: 1, SentAt: at, Channel: store.ChannelTelegram}); err != nil {
+			t.Fatalf("RecordNotification: %v", err)
+		}
+	}
+	if err := st.RecordMatchDecisions(ctx, []store.MatchDecision{
+		{ChatID: "1", Refuge: "du Goûter", Date: "2025-08-12", Reason: store.MissMinPlaces, Places: 1, CheckedAt: old},
+		{ChatID: "1", Refuge: "du Goûter", Date: "2025-08-12", Reason: store.MissSnoozed, Places: 1, CheckedAt: fresh},
+	}); err != nil {
+		t.Fatalf("RecordMatchDecisions: %v", err)
+	}
+	if err := st.EnqueueMessage(ctx, store.OutboxMessage{ID: "o1", ChatID: "1", Text: "hi", Kind: store.KindAlert, DeliverAfter: now}); err != nil {
+		t.Fatalf("EnqueueMessage: %v", err)
+	}
+	for _, key := range []string{store.ConsentIPPrefix + "sig", store.SignupEmailPrefix + "sig", "flag:a"} {
+		if err := st.SetSetting(ctx, key, "x"); err != nil {
+			t.Fatalf("SetSetting: %v", err)
+		}
+	}
+
+	purge := func(at time.Time) map[string]int {
+		t.Helper()
+		purged := map[string]int{}
+		for _, p := range store.RetentionPolicies {
+			for {
+				n, err := st.PurgeExpired(ctx, p, at.Add(-p.Keep()), 1)
+				if err != nil {
+					t.Fatalf("PurgeExpired(%s): %v", p.Table, err)
+				}
+				if n > 1 {
+					t.Errorf("PurgeExpired(%s) deleted %d rows, over the limit of 1", p.Table, n)
+				}
+				if n == 0 {
+					break
+				}
+				purged[p.Table] += n
+			}
+		}
+		return purged
+	}
+
+	// rows written just now are all within their policy; only the old ones go
+	if got, want := purge(now), map[string]int{"notification_log": 2, "notifications": 2, "match_decisions": 1}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("purged %v, want %v", got, want)
+	}
+	// a year on, everything but the active subscriber and the other settings has expired
+	later := now.Add(366 * 24 * time.Hour)
+	want := map[string]int{"match_decisions": 1, "notification_log": 1, "notifications": 1, "outbox": 1, "settings": 2, "subscribers": 1}
+	if got := purge(later); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("purged %v a year on, want %v", got, want)
+	}
+
+	if _, err := st.GetSubscriber(ctx, "1"); err != nil {
+		t.Errorf("expected the active subscriber kept, got %v", err)
+	}
+	if _, err := st.GetSubscriber(ctx, "2"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected the unsubscribed chat purged, got %v", err)
+	}
+	if qs, _ := st.ListQueriesByChat(ctx, "2"); len(qs) != 0 {
+		t.Errorf("expected the queries of the purged chat gone, got %+v", qs)
+	}
+	if settings, _ := st.ListSettings(ctx, ""); fmt.Sprint(settings) != "map[flag:a:x]" {
+		t.Errorf("expected only the flag setting kept, got %v", settings)
+	}
+}
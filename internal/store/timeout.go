@@ -0,0 +1,292 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// WithTimeout bounds every call to st at d, on top of any deadline of the caller's context
+func WithTimeout(st Store, d time.Duration) Store {
+	return timeoutStore{Store: st, d: d}
+}
+
+type timeoutStore struct {
+	Store
+	d time.Duration
+}
+
+func (ts timeoutStore) UpsertSubscriber(ctx context.Context, sub Subscriber) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.UpsertSubscriber(ctx, sub)
+}
+
+func (ts timeoutStore) GetSubscriber(ctx context.Context, chatID string) (Subscriber, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.GetSubscriber(ctx, chatID)
+}
+
+func (ts timeoutStore) ListSubscribers(ctx context.Context) ([]Subscriber, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListSubscribers(ctx)
+}
+
+func (ts timeoutStore) PageSubscribers(ctx context.Context, after string, limit int) ([]Subscriber, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.PageSubscribers(ctx, after, limit)
+}
+
+func (ts timeoutStore) CountSubscribers(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.CountSubscribers(ctx)
+}
+
+func (ts timeoutStore) ListSubscribersByLanguage(ctx context.Context, lang string) ([]Subscriber, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListSubscribersByLanguage(ctx, lang)
+}
+
+func (ts timeoutStore) DeactivateSubscriber(ctx context.Context, chatID string) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.DeactivateSubscriber(ctx, chatID)
+}
+
+func (ts timeoutStore) AddQuery(ctx context.Context, q Query) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.AddQuery(ctx, q)
+}
+
+func (ts timeoutStore) ListQueriesByChat(ctx context.Context, chatID string) ([]Query, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListQueriesByChat(ctx, chatID)
+}
+
+func (ts timeoutStore) CountQueriesByChat(ctx context.Context, chatID string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.CountQueriesByChat(ctx, chatID)
+}
+
+func (ts timeoutStore) ListAllQueries(ctx context.Context) ([]Query, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListAllQueries(ctx)
+}
+
+func (ts timeoutStore) GetQuery(ctx context.Context, id string) (Query, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.GetQuery(ctx, id)
+}
+
+func (ts timeoutStore) DeleteQuery(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.DeleteQuery(ctx, id)
+}
+
+func (ts timeoutStore) UpdateQuery(ctx context.Context, q Query) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.UpdateQuery(ctx, q)
+}
+
+func (ts timeoutStore) SetQueryNotifyOnGone(ctx context.Context, id string, on bool) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.SetQueryNotifyOnGone(ctx, id, on)
+}
+
+func (ts timeoutStore) SetQueryStatus(ctx context.Context, id string, status string) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.SetQueryStatus(ctx, id, status)
+}
+
+func (ts timeoutStore) EnqueueMessage(ctx context.Context, m OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.EnqueueMessage(ctx, m)
+}
+
+func (ts timeoutStore) ListDueMessages(ctx context.Context, now time.Time) ([]OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListDueMessages(ctx, now)
+}
+
+func (ts timeoutStore) DeleteMessage(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.DeleteMessage(ctx, id)
+}
+
+func (ts timeoutStore) LogNotification(ctx context.Context, e NotificationLogEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.LogNotification(ctx, e)
+}
+
+func (ts timeoutStore) CountNotifications(ctx context.Context, status string, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.CountNotifications(ctx, status, since)
+}
+
+func (ts timeoutStore) ListAlertedChats(ctx context.Context, refuge string, date string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListAlertedChats(ctx, refuge, date)
+}
+
+func (ts timeoutStore) RecordNotification(ctx context.Context, n Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.RecordNotification(ctx, n)
+}
+
+func (ts timeoutStore) WasNotified(ctx context.Context, chatID string, refuge string, date string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.WasNotified(ctx, chatID, refuge, date)
+}
+
+func (ts timeoutStore) ListNotifiedDates(ctx context.Context, chatID string) ([]Notification, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListNotifiedDates(ctx, chatID)
+}
+
+func (ts timeoutStore) CountRecordedNotifications(ctx context.Context, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.CountRecordedNotifications(ctx, since)
+}
+
+func (ts timeoutStore) DeleteNotificationsBefore(ctx context.Context, date string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.DeleteNotificationsBefore(ctx, date)
+}
+
+func (ts timeoutStore) RecordMatchDecisions(ctx context.Context, ds []MatchDecision) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.RecordMatchDecisions(ctx, ds)
+}
+
+func (ts timeoutStore) ListMatchDecisions(ctx context.Context, chatID string, date string) ([]MatchDecision, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListMatchDecisions(ctx, chatID, date)
+}
+
+func (ts timeoutStore) DeleteMatchDecisionsBefore(ctx context.Context, t time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.DeleteMatchDecisionsBefore(ctx, t)
+}
+
+func (ts timeoutStore) RecordSnapshot(ctx context.Context, sn Snapshot) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.RecordSnapshot(ctx, sn)
+}
+
+func (ts timeoutStore) ListSnapshots(ctx context.Context, from time.Time, to time.Time) ([]Snapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListSnapshots(ctx, from, to)
+}
+
+func (ts timeoutStore) DeleteSnapshots(ctx context.Context, from time.Time, to time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.DeleteSnapshots(ctx, from, to)
+}
+
+func (ts timeoutStore) SaveDateSnapshots(ctx context.Context, sns []DateSnapshot) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.SaveDateSnapshots(ctx, sns)
+}
+
+func (ts timeoutStore) ListDateSnapshots(ctx context.Context, refuge string, from time.Time, to time.Time) ([]DateSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListDateSnapshots(ctx, refuge, from, to)
+}
+
+func (ts timeoutStore) PageDateSnapshots(ctx context.Context, p DateSnapshotPage) ([]DateSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.PageDateSnapshots(ctx, p)
+}
+
+func (ts timeoutStore) DeleteDateSnapshotsBefore(ctx context.Context, t time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.DeleteDateSnapshotsBefore(ctx, t)
+}
+
+func (ts timeoutStore) SaveSeasonSummaries(ctx context.Context, season int, sums []SeasonSummary) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.SaveSeasonSummaries(ctx, season, sums)
+}
+
+func (ts timeoutStore) ListSeasonSummaries(ctx context.Context, season int) ([]SeasonSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListSeasonSummaries(ctx, season)
+}
+
+func (ts timeoutStore) AddStructure(ctx context.Context, s Structure) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.AddStructure(ctx, s)
+}
+
+func (ts timeoutStore) ListStructures(ctx context.Context) ([]Structure, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListStructures(ctx)
+}
+
+func (ts timeoutStore) DeleteStructure(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.DeleteStructure(ctx, id)
+}
+
+func (ts timeoutStore) GetSetting(ctx context.Context, key string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.GetSetting(ctx, key)
+}
+
+func (ts timeoutStore) PurgeExpired(ctx context.Context, p RetentionPolicy, before time.Time, limit int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.PurgeExpired(ctx, p, before, limit)
+}
+
+func (ts timeoutStore) SetSetting(ctx context.Context, key string, value string) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.SetSetting(ctx, key, value)
+}
+
+func (ts timeoutStore) ListSettings(ctx context.Context, prefix string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ts.d)
+	defer cancel()
+	return ts.Store.ListSettings(ctx, prefix)
+}
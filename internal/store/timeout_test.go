@@ -0,0 +1,43 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestWithTimeoutBoundsEveryMethod(t *testing.T) {
+	st := store.WithTimeout(openTestSQLite(t), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	v := reflect.ValueOf(st)
+	storeType := reflect.TypeFor[store.Store]()
+	for i := range storeType.NumMethod() {
+		m := storeType.Method(i)
+		if m.Name == "Close" {
+			continue
+		}
+		args := []reflect.Value{reflect.ValueOf(t.Context())}
+		for j := 1; j < m.Type.NumIn(); j++ {
+			arg := reflect.New(m.Type.In(j)).Elem()
+			switch {
+			case arg.Kind() == reflect.Slice:
+				// one element, so that nothing returns early on an empty batch
+				arg = reflect.MakeSlice(arg.Type(), 1, 1)
+			case arg.Type() == reflect.TypeFor[store.RetentionPolicy]():
+				// a table the store knows, so that the call gets to the database
+				arg = reflect.ValueOf(store.RetentionPolicies[0])
+			}
+			args = append(args, arg)
+		}
+		out := v.MethodByName(m.Name).Call(args)
+		err, _ := out[len(out)-1].Interface().(error)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected the call to time out, got %v", m.Name, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package summary
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// maxSnapshotGap is the longest pause between two checks of a refuge that still counts as
+// continuous monitoring; across a longer pause open dates are assumed to have closed
+const maxSnapshotGap = 30 * time.Minute
+
+// SeasonBounds returns the observation period of season: from October 1 of the previous year
+// to October 1 of the season year (UTC), so a season is over once the huts close in September
+func SeasonBounds(season int) (from time.Time, to time.Time) {
+	return time.Date(season-1, time.October, 1, 0, 0, 0, 0, time.UTC), time.Date(season, time.October, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// window is a period a date stayed bookable at a refuge
+type window struct {
+	start, last time.Time
+}
+
+// SeasonSummaries aggregates the snapshots of a season per refuge, sorted by refuge name.
+// A window ends at the first check without the date; a window starting after monitoring began
+// (rather than open at the first check) counts as a cancellation.
+func SeasonSummaries(season int, snaps []store.Snapshot) []store.SeasonSummary {
+	byRefuge := map[string][]store.Snapshot{}
+	for _, sn := range snaps {
+		byRefuge[sn.Refuge] = append(byRefuge[sn.Refuge], sn)
+	}
+	res := make([]store.SeasonSummary, 0, len(byRefuge))
+	for refuge, rs := range byRefuge {
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].ObservedAt.Before(rs[j].ObservedAt) })
+		sum := store.SeasonSummary{Season: season, Refuge: refuge}
+		days := map[string]bool{}
+		open := map[string]*window{}
+		var durations []time.Duration
+		var weekdays [7]int
+		closeWindow := func(date string, end time.Time) {
+			durations = append(durations, end.Sub(open[date].start))
+			delete(open, date)
+		}
+		baseline := true // dates open at the first check (or after a gap) aren't cancellations
+		for i, sn := range rs {
+			days[sn.ObservedAt.UTC().Format("2006-01-02")] = true
+			if i > 0 && sn.ObservedAt.Sub(rs[i-1].ObservedAt) > maxSnapshotGap {
+				for date, w := range open {
+					closeWindow(date, w.last)
+				}
+				baseline = true
+			}
+			for date := range open {
+				if _, ok := sn.Open[date]; !ok {
+					closeWindow(date, sn.ObservedAt)
+				}
+			}
+			for date := range sn.Open {
+				if open[date] == nil {
+					open[date] = &window{start: sn.ObservedAt}
+					if !baseline {
+						sum.Cancellations++
+						weekdays[sn.ObservedAt.UTC().Weekday()]++
+					}
+				}
+				open[date].last = sn.ObservedAt
+			}
+			baseline = false
+		}
+		for date, w := range open {
+			closeWindow(date, w.last)
+		}
+
+		sum.DaysMonitored, sum.Windows = len(days), len(durations)
+		sum.MedianWindow = median(durations)
+		// Monday first, so ties go to the earlier weekday
+		best := -1
+		for i := 1; i <= 7; i++ {
+			if d := time.Weekday(i % 7); weekdays[d] > best {
+				best, sum.BusiestWeekday = weekdays[d], d
+			}
+		}
+		res = append(res, sum)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Refuge < res[j].Refuge })
+	return res
+}
+
+// median returns the median of ds (0 when empty)
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	mid := len(ds) / 2
+	if len(ds)%2 == 1 {
+		return ds[mid]
+	}
+	return (ds[mid-1] + ds[mid]) / 2
+}
+
+// FormatSeason renders the end-of-season report sent to admins and the public channel
+func FormatSeason(season int, sums []store.SeasonSummary) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📦 Season %d report\n", season))
+	if len(sums) == 0 {
+		b.WriteString("\nNo monitoring data for this season.\n")
+		return b.String()
+	}
+	for _, s := range sums {
+		b.WriteString(fmt.Sprintf("\n🏔️ %s\n", telegram.EscapeHTML(s.Refuge)))
+		b.WriteString(fmt.Sprintf("  • %d days monitored\n", s.DaysMonitored))
+		if s.Windows == 0 {
+			b.WriteString("  • no availability seen\n")
+			continue
+		}
+		b.WriteString(fmt.Sprintf("  • %d availability windows, median %s\n", s.Windows, formatWindow(s.MedianWindow)))
+		if s.Cancellations == 0 {
+			b.WriteString("  • no cancellations seen\n")
+		} else {
+			b.WriteString(fmt.Sprintf("  • %d cancellations, most often on %ss\n", s.Cancellations, s.BusiestWeekday))
+		}
+	}
+	return b.String()
+}
+
+// formatWindow renders a window length in minutes, hours or days
+func formatWindow(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "under a minute"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return fmt.Sprintf("%dd%dh", int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour))
+}
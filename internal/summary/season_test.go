@@ -0,0 +1,99 @@
+package summary
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// checks builds one snapshot every 10 minutes in [from, to) with the dates open returns
+func checks(refuge string, from time.Time, to time.Time, open func(at time.Time) map[string]int) []store.Snapshot {
+	var res []store.Snapshot
+	for at := from; at.Before(to); at = at.Add(10 * time.Minute) {
+		res = append(res, store.Snapshot{Refuge: refuge, ObservedAt: at, Open: open(at)})
+	}
+	return res
+}
+
+// between reports whether at is in [from, from+d)
+func between(at time.Time, from time.Time, d time.Duration) bool {
+	return !at.Before(from) && at.Before(from.Add(d))
+}
+
+func TestSeasonSummaries(t *testing.T) {
+	tue := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	wed := tue.AddDate(0, 0, 1)
+	snaps := checks("Tête Rousse", tue, tue.AddDate(0, 0, 3), func(at time.Time) map[string]int {
+		open := map[string]int{}
+		if between(at, tue, time.Hour) {
+			open["2025-08-10"] = 4 // open when monitoring starts: not a cancellation
+		}
+		if between(at, tue.Add(12*time.Hour), 20*time.Minute) {
+			open["2025-08-11"] = 1
+		}
+		if between(at, wed.Add(8*time.Hour), 30*time.Minute) {
+			open["2025-08-12"] = 2
+		}
+		if between(at, wed.Add(15*time.Hour), 10*time.Minute) {
+			open["2025-08-13"] = 1
+		}
+		return open
+	})
+	// du Goûter: a two-hour monitoring gap splits what looks like one open date into two windows
+	always := func(time.Time) map[string]int { return map[string]int{"2025-08-20": 3} }
+	snaps = append(snaps, checks("du Goûter", tue, tue.Add(20*time.Minute), always)...)
+	snaps = append(snaps, checks("du Goûter", tue.Add(2*time.Hour), tue.Add(2*time.Hour+20*time.Minute), always)...)
+
+	sums := SeasonSummaries(2025, snaps)
+	if len(sums) != 2 || sums[0].Refuge != "Tête Rousse" || sums[1].Refuge != "du Goûter" {
+		t.Fatalf("expected one summary per refuge sorted by name, got %+v", sums)
+	}
+	tr := sums[0]
+	if tr.Season != 2025 || tr.DaysMonitored != 3 || tr.Windows != 4 || tr.Cancellations != 3 {
+		t.Errorf("unexpected Tête Rousse summary %+v", tr)
+	}
+	// windows of 60, 20, 30 and 10 minutes
+	if tr.MedianWindow != 25*time.Minute {
+		t.Errorf("expected a 25m median window, got %v", tr.MedianWindow)
+	}
+	if tr.BusiestWeekday != time.Wednesday {
+		t.Errorf("expected Wednesday as the busiest cancellation day, got %v", tr.BusiestWeekday)
+	}
+	dg := sums[1]
+	if dg.DaysMonitored != 1 || dg.Windows != 2 || dg.Cancellations != 0 || dg.MedianWindow != 10*time.Minute {
+		t.Errorf("unexpected du Goûter summary %+v", dg)
+	}
+}
+
+func TestSeasonSummariesWithoutAvailability(t *testing.T) {
+	day := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	sums := SeasonSummaries(2025, checks("Tête Rousse", day, day.Add(time.Hour), func(time.Time) map[string]int { return nil }))
+	if len(sums) != 1 || sums[0].Windows != 0 || sums[0].MedianWindow != 0 || sums[0].DaysMonitored != 1 {
+		t.Errorf("unexpected summary %+v", sums)
+	}
+	if report := FormatSeason(2025, sums); !strings.Contains(report, "no availability seen") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+func TestSeasonBounds(t *testing.T) {
+	from, to := SeasonBounds(2025)
+	if !from.Equal(time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected bounds %v – %v", from, to)
+	}
+}
+
+func TestFormatSeason(t *testing.T) {
+	got := FormatSeason(2025, []store.SeasonSummary{
+		{Refuge: "Tête Rousse", DaysMonitored: 112, Windows: 57, MedianWindow: 18 * time.Minute, Cancellations: 41, BusiestWeekday: time.Tuesday},
+		{Refuge: "du Goûter", DaysMonitored: 112, Windows: 3, MedianWindow: 26 * time.Hour},
+	})
+	want := "📦 Season 2025 report\n\n" +
+		"🏔️ Tête Rousse\n  • 112 days monitored\n  • 57 availability windows, median 18m\n  • 41 cancellations, most often on Tuesdays\n\n" +
+		"🏔️ du Goûter\n  • 112 days monitored\n  • 3 availability windows, median 1d2h\n  • no cancellations seen\n"
+	if got != want {
+		t.Errorf("FormatSeason =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,176 @@
+package summary
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// hoursPerWeek is the number of weekly delivery slots
+const hoursPerWeek = 7 * 24
+
+// nearMissDays is how far outside a query's window an opening still counts as a near miss
+const nearMissDays = 3
+
+// maxNearMisses caps how many near misses are listed
+const maxNearMisses = 5
+
+// Opening is a date seen with free places during the week
+type Opening struct {
+	Refuge string
+	Date   string // YYYY-MM-DD
+	Places int
+	SeenAt time.Time
+}
+
+// Week is what the checker observed over the last seven days
+type Week struct {
+	Checks   int
+	Openings []Opening
+	Alerts   int // alerts sent to the subscriber
+}
+
+// NearMiss is an opening that didn't fit the subscriber's filters
+type NearMiss struct {
+	Opening
+	Reason string
+	days   int // distance to the closest window, 0 when inside it
+}
+
+// Slot returns the subscriber's weekly delivery slot in hours since Monday 00:00 UTC.
+// Slots are spread across the week by chat ID hash to avoid sending everything at once.
+func Slot(chatID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(chatID))
+	return int(h.Sum32() % hoursPerWeek)
+}
+
+// hourOfWeek returns hours since Monday 00:00 UTC
+func hourOfWeek(t time.Time) int {
+	t = t.UTC()
+	day := (int(t.Weekday()) + 6) % 7 // Monday = 0
+	return day*24 + t.Hour()
+}
+
+// Due reports whether the weekly summary for chatID should be sent at now
+func Due(chatID string, now time.Time, lastSent time.Time) bool {
+	if hourOfWeek(now) != Slot(chatID) {
+		return false
+	}
+	return lastSent.IsZero() || now.Sub(lastSent) > 6*24*time.Hour
+}
+
+// NearMisses returns openings that don't match any query but came close:
+// the right dates at another refuge, or the right refuge a few days outside the window.
+// Closest misses come first.
+func NearMisses(queries []store.Query, openings []Opening) []NearMiss {
+	var res []NearMiss
+	for _, o := range openings {
+		matched := false
+		best := NearMiss{days: -1}
+		for _, q := range queries {
+			if q.Matches(o.Refuge, o.Date) {
+				matched = true
+				break
+			}
+			if q.InWindow(o.Date) && q.OnWeekday(o.Date) {
+				best = NearMiss{Opening: o, Reason: "other refuge", days: 0}
+				continue
+			}
+			if !q.MatchesRefuge(o.Refuge) {
+				continue
+			}
+			if d := daysOutside(q, o.Date); d > 0 && d <= nearMissDays && (best.days < 0 || d < best.days) {
+				reason := fmt.Sprintf("%d days outside your dates", d)
+				if d == 1 {
+					reason = "1 day outside your dates"
+				}
+				best = NearMiss{Opening: o, Reason: reason, days: d}
+			}
+		}
+		if !matched && best.days >= 0 {
+			res = append(res, best)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].days != res[j].days {
+			return res[i].days < res[j].days
+		}
+		return res[i].Date < res[j].Date
+	})
+	return res
+}
+
+// daysOutside returns how many days date lies before or after the query window (0 if inside or unparsable)
+func daysOutside(q store.Query, date string) int {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0
+	}
+	if from, err := time.Parse("2006-01-02", q.DateFrom); err == nil && d.Before(from) {
+		return int(from.Sub(d).Hours() / 24)
+	}
+	if to, err := time.Parse("2006-01-02", q.DateTo); err == nil && d.After(to) {
+		return int(d.Sub(to).Hours() / 24)
+	}
+	return 0
+}
+
+// Build renders the weekly summary message for a subscriber
+func Build(queries []store.Query, week Week, current []parser.Refuge) string {
+	var b strings.Builder
+	b.WriteString("📬 Your weekly Mont Blanc alerts summary\n\n")
+	b.WriteString(fmt.Sprintf("✅ Your alerts are active: %d checks this week, %d alerts sent to you.\n", week.Checks, week.Alerts))
+
+	misses := NearMisses(queries, week.Openings)
+	if len(misses) == 0 {
+		if len(week.Openings) == 0 {
+			b.WriteString("No spots opened this week.\n")
+		} else {
+			b.WriteString("No near misses this week.\n")
+		}
+	} else {
+		b.WriteString("\nNear misses (opened but outside your filters):\n")
+		for i, m := range misses {
+			if i == maxNearMisses {
+				b.WriteString(fmt.Sprintf("  … and %d more\n", len(misses)-maxNearMisses))
+				break
+			}
+			b.WriteString(fmt.Sprintf("  • %s %s: %d places (%s)\n", telegram.EscapeHTML(m.Refuge), m.Date, m.Places, m.Reason))
+		}
+	}
+
+	if len(queries) > 0 {
+		b.WriteString("\nYour dates right now:\n")
+		for _, q := range queries {
+			full, total := 0, 0
+			for _, rf := range current {
+				if !q.MatchesRefuge(rf.Name) {
+					continue
+				}
+				for _, day := range rf.Days() {
+					if !q.InWindow(day.Key()) {
+						continue
+					}
+					total++
+					if day.Status == parser.StatusFull {
+						full++
+					}
+				}
+			}
+			refuge := q.Refuge
+			if refuge == "*" {
+				refuge = "any refuge"
+			}
+			b.WriteString(fmt.Sprintf("  • %s, %s → %s: %d of %d dates fully booked\n", telegram.EscapeHTML(refuge), q.DateFrom, q.DateTo, full, total))
+		}
+	}
+	b.WriteString("\nSend /weekly off to stop these summaries.")
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package summary
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestNearMisses(t *testing.T) {
+	queries := []store.Query{
+		{Refuge: "Tête Rousse", DateFrom: "2025-07-10", DateTo: "2025-07-15"},
+	}
+	openings := []Opening{
+		{Refuge: "Tête Rousse", Date: "2025-07-12", Places: 2}, // match, not a miss
+		{Refuge: "du Goûter", Date: "2025-07-11", Places: 1},   // wrong refuge
+		{Refuge: "Tête Rousse", Date: "2025-07-17", Places: 3}, // 2 days after
+		{Refuge: "Tête Rousse", Date: "2025-07-09", Places: 1}, // 1 day before
+		{Refuge: "Tête Rousse", Date: "2025-07-30", Places: 4}, // too far
+		{Refuge: "du Goûter", Date: "2025-07-17", Places: 4},   // wrong refuge and dates
+	}
+	misses := NearMisses(queries, openings)
+	if len(misses) != 3 {
+		t.Fatalf("expected 3 near misses, got %d: %+v", len(misses), misses)
+	}
+	want := []struct{ refuge, date, reason string }{
+		{"du Goûter", "2025-07-11", "other refuge"},
+		{"Tête Rousse", "2025-07-09", "1 day outside your dates"},
+		{"Tête Rousse", "2025-07-17", "2 days outside your dates"},
+	}
+	for i, w := range want {
+		if misses[i].Refuge != w.refuge || misses[i].Date != w.date || misses[i].Reason != w.reason {
+			t.Errorf("miss %d = %s %s (%s), want %s %s (%s)", i, misses[i].Refuge, misses[i].Date, misses[i].Reason, w.refuge, w.date, w.reason)
+		}
+	}
+}
+
+func TestNearMissesAnyRefugeHasNoRefugeMisses(t *testing.T) {
+	queries := []store.Query{{Refuge: "*", DateFrom: "2025-07-10", DateTo: "2025-07-15"}}
+	openings := []Opening{{Refuge: "du Goûter", Date: "2025-07-11", Places: 1}}
+	if misses := NearMisses(queries, openings); len(misses) != 0 {
+		t.Errorf("expected no near misses for a matching opening, got %+v", misses)
+	}
+}
+
+func TestBuildEmptyWeek(t *testing.T) {
+	queries := []store.Query{{Refuge: "*", DateFrom: "2025-07-10", DateTo: "2025-07-12"}}
+	current := []parser.Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "Full", "2025-07-11": "Full", "2025-07-20": "2"}},
+		{Name: "du Goûter", Dates: map[string]string{"2025-07-10": "Full", "2025-07-11": "1"}},
+	}
+	msg := Build(queries, Week{Checks: 10080}, current)
+	for _, want := range []string{"10080 checks", "0 alerts", "No spots opened this week", "any refuge, 2025-07-10 → 2025-07-12: 3 of 4 dates fully booked", "/weekly off"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("summary misses %q:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "Near misses") {
+		t.Errorf("empty week must not list near misses:\n%s", msg)
+	}
+}
+
+func TestBuildListsNearMisses(t *testing.T) {
+	queries := []store.Query{{Refuge: "Tête Rousse", DateFrom: "2025-07-10", DateTo: "2025-07-12"}}
+	week := Week{Checks: 5, Alerts: 1, Openings: []Opening{{Refuge: "du Goûter", Date: "2025-07-11", Places: 2}}}
+	msg := Build(queries, week, nil)
+	if !strings.Contains(msg, "du Goûter 2025-07-11: 2 places (other refuge)") {
+		t.Errorf("summary misses near miss:\n%s", msg)
+	}
+}
+
+func TestSlotAndDue(t *testing.T) {
+	chatID := "123456"
+	slot := Slot(chatID)
+	if slot < 0 || slot >= hoursPerWeek || Slot(chatID) != slot {
+		t.Fatalf("slot must be stable and in range, got %d", slot)
+	}
+	monday := time.Date(2025, 7, 7, 0, 0, 0, 0, time.UTC)
+	at := monday.Add(time.Duration(slot) * time.Hour).Add(30 * time.Minute)
+	if !Due(chatID, at, time.Time{}) {
+		t.Error("expected summary due in its slot")
+	}
+	if Due(chatID, at.Add(time.Hour), time.Time{}) {
+		t.Error("expected summary not due outside its slot")
+	}
+	if Due(chatID, at.Add(time.Minute), at) {
+		t.Error("expected summary not due twice in one slot")
+	}
+	if !Due(chatID, at.Add(7*24*time.Hour), at) {
+		t.Error("expected summary due again next week")
+	}
+}
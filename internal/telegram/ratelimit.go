@@ -0,0 +1,100 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// maxSendRetries is how many times a message rate limited by Telegram (HTTP 429) is sent again
+const maxSendRetries = 3
+
+// retryBaseDelay is the delay before resending a 429 without retry_after; doubled for each further retry
+const retryBaseDelay = time.Second
+
+// sleep is time.Sleep (overridable in tests)
+var sleep = time.Sleep
+
+// limiter spaces out calls to wait by at least interval, across goroutines
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time // earliest time of the next call
+}
+
+// sendLimit keeps sends under Telegram's ~30 messages a second to different chats
+var sendLimit = &limiter{interval: time.Second / 30}
+
+// wait blocks until the caller may send
+func (l *limiter) wait() {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	if d := at.Sub(now); d > 0 {
+		sleep(d)
+	}
+}
+
+// pause holds every sender until t, when Telegram asked to slow down
+func (l *limiter) pause(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t.After(l.next) {
+		l.next = t
+	}
+}
+
+// retryAfter returns the delay a 429 body asks for in parameters.retry_after, 0 when missing
+func retryAfter(body []byte) time.Duration {
+	var r struct {
+		Parameters struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	if json.Unmarshal(body, &r) != nil {
+		return 0
+	}
+	return time.Duration(r.Parameters.RetryAfter) * time.Second
+}
+
+// sendForm posts a sendMessage form to apiURL through sendLimit. A 429 is sent again after the
+// retry_after Telegram gives (or an exponential backoff), up to maxSendRetries times.
+func sendForm(apiURL string, form url.Values) error {
+	_, err := postForm(apiURL, form)
+	return err
+}
+
+// postForm is sendForm returning the body of Telegram's answer
+func postForm(apiURL string, form url.Values) ([]byte, error) {
+	for retry := 0; ; retry++ {
+		sendLimit.wait()
+		resp, err := http.PostForm(apiURL, form)
+		if err != nil {
+			return nil, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return body, nil
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || retry == maxSendRetries {
+			return nil, fmt.Errorf("telegram send failed %d: %s", resp.StatusCode, string(body))
+		}
+		delay := retryAfter(body)
+		if delay <= 0 {
+			delay = retryBaseDelay << retry
+		}
+		slog.Warn("telegram rate limit hit, retrying", "chat_id", form.Get("chat_id"), "retry", retry+1, "retries", maxSendRetries, "delay", delay)
+		sendLimit.pause(time.Now().Add(delay))
+	}
+}
@@ -1,13 +1,16 @@
 package telegram
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type User struct {
@@ -28,73 +31,201 @@ type Message struct {
 	ParseMode string `json:"parse_mode"`
 }
 
+// BotCommand is an entry of the bot's command menu
+type BotCommand struct {
+	Command     string `json:"command"` // without the leading slash
+	Description string `json:"description"`
+}
+
+// Settings is the bot the package talks as and who SendMessage reaches
+type Settings struct {
+	BotToken     string
+	APIURL       string   // Bot API root, e.g. a fake API in smoke tests (default https://api.telegram.org)
+	AdminChatIDs []string // TELEGRAM_CHAT_IDS
+}
+
+var settings Settings
+
+// Configure sets the bot token, API root and admin chats; call it once before sending
+func Configure(s Settings) { settings = s }
+
+// apiBase is the Bot API root
+func apiBase() string {
+	if base := settings.APIURL; base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return "https://api.telegram.org"
+}
+
+// htmlEscaper escapes the characters Telegram's HTML parse mode reserves
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// EscapeHTML makes s safe as text in a message: messages are sent in HTML parse mode, where a
+// stray "<" or "&" gets the whole message rejected. The i18n strings and the links built by the
+// web package are trusted HTML; refuge names, dates, query labels and anything else that comes
+// from FFCAM, admins or users must go through EscapeHTML.
+func EscapeHTML(s string) string { return htmlEscaper.Replace(s) }
+
 // SendMessageTo sends a message to a specific chat id
 func SendMessageTo(chatID string, message string) error {
-    botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-    if botToken == "" { return fmt.Errorf("TELEGRAM_BOT_TOKEN not set") }
-    apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botToken)
-    resp, err := http.PostForm(apiURL, url.Values{
-        "chat_id":    {chatID},
-        "text":       {message},
-        "parse_mode": {"HTML"},
-    })
-    if err != nil { return err }
-    defer resp.Body.Close()
-    if resp.StatusCode != http.StatusOK {
-        body, _ := io.ReadAll(resp.Body)
-        return fmt.Errorf("telegram send failed %d: %s", resp.StatusCode, string(body))
-    }
-    return nil
+	botToken := settings.BotToken
+	if botToken == "" {
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
+	}
+	return sendForm(fmt.Sprintf("%s/bot%s/sendMessage", apiBase(), botToken), url.Values{
+		"chat_id":    {chatID},
+		"text":       {message},
+		"parse_mode": {"HTML"},
+	})
 }
 
-func SendMessage(message string) error {
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+// PostMessage sends a message to a chat, e.g. a channel, and returns its ID for EditMessage
+func PostMessage(chatID string, message string) (int, error) {
+	botToken := settings.BotToken
+	if botToken == "" {
+		return 0, fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
+	}
+	body, err := postForm(fmt.Sprintf("%s/bot%s/sendMessage", apiBase(), botToken), url.Values{
+		"chat_id":    {chatID},
+		"text":       {message},
+		"parse_mode": {"HTML"},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var r struct {
+		Result struct {
+			MessageID int `json:"message_id"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return 0, fmt.Errorf("failed to decode sent message: %v", err)
+	}
+	return r.Result.MessageID, nil
+}
+
+// EditMessage replaces the text of a message sent earlier
+func EditMessage(chatID string, messageID int, message string) error {
+	botToken := settings.BotToken
+	if botToken == "" {
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
+	}
+	return sendForm(fmt.Sprintf("%s/bot%s/editMessageText", apiBase(), botToken), url.Values{
+		"chat_id":    {chatID},
+		"message_id": {strconv.Itoa(messageID)},
+		"text":       {message},
+		"parse_mode": {"HTML"},
+	})
+}
+
+// SendMessageWithButtons sends a message with an inline keyboard (one slice per row) to a specific chat id
+func SendMessageWithButtons(chatID string, message string, rows [][]InlineButton) error {
+	botToken := settings.BotToken
+	if botToken == "" {
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
+	}
+	markup, err := json.Marshal(map[string][][]InlineButton{"inline_keyboard": rows})
+	if err != nil {
+		return err
+	}
+	return sendForm(fmt.Sprintf("%s/bot%s/sendMessage", apiBase(), botToken), url.Values{
+		"chat_id":      {chatID},
+		"text":         {message},
+		"parse_mode":   {"HTML"},
+		"reply_markup": {string(markup)},
+	})
+}
+
+// AnswerCallbackQuery acknowledges an inline button press, showing text as a short notification
+func AnswerCallbackQuery(id string, text string) error {
+	botToken := settings.BotToken
 	if botToken == "" {
 		return fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
 	}
+	resp, err := http.PostForm(fmt.Sprintf("%s/bot%s/answerCallbackQuery", apiBase(), botToken), url.Values{
+		"callback_query_id": {id},
+		"text":              {text},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("telegram answerCallbackQuery failed %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// SendError reports the chats a message sent to several chats didn't reach
+type SendError struct {
+	Failed int   // chats the message didn't reach
+	Total  int   // chats it was sent to
+	Err    error // the first failure
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("failed to send to %d of %d chats: %v", e.Failed, e.Total, e.Err)
+}
+
+func (e *SendError) Unwrap() error { return e.Err }
+
+// All reports whether the message reached none of the chats
+func (e *SendError) All() bool { return e.Failed >= e.Total }
+
+// SendFailed logs err, the outcome of sending what, and reports whether the message reached
+// nobody. A SendError from a message that still reached some chats is logged as a warning and
+// counts as sent.
+func SendFailed(what string, err error) bool {
+	if err == nil {
+		return false
+	}
+	var se *SendError
+	if errors.As(err, &se) && !se.All() {
+		slog.Warn("failed to send "+what+" to some chats", "failed", se.Failed, "total", se.Total, "error", se.Err)
+		return false
+	}
+	slog.Error("failed to send "+what, "error", err)
+	return true
+}
+
+// SendMessage sends a message to every admin chat (TELEGRAM_CHAT_IDS). When some chats fail it
+// returns a *SendError with the failure count and the first error.
+func SendMessage(message string) error {
+	if settings.BotToken == "" {
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
+	}
 
-	chatIDs := os.Getenv("TELEGRAM_CHAT_IDS")
-	if chatIDs == "" {
+	ids := settings.AdminChatIDs
+	if len(ids) == 0 {
 		return fmt.Errorf("TELEGRAM_CHAT_IDS not set")
 	}
 
-	log.Printf("Sending Telegram message to %d recipients", len(ParseChatIDs(chatIDs)))
-	log.Printf("Message content: %s", message)
+	slog.Debug("sending Telegram message", "recipients", len(ids), "message", message)
 
-	ids := ParseChatIDs(chatIDs)
+	se := &SendError{Total: len(ids)}
 	for _, chatID := range ids {
-		apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botToken)
-		log.Printf("Sending to chat ID: %s", chatID)
-
-		resp, err := http.PostForm(apiURL, url.Values{
-			"chat_id":    {chatID},
-			"text":       {message},
-			"parse_mode": {"HTML"},
-		})
-		if err != nil {
-			log.Printf("Error sending message to %s: %v", chatID, err)
-			continue
+		if err := SendMessageTo(chatID, message); err != nil {
+			slog.Debug("failed to send message", "chat_id", chatID, "error", err)
+			if se.Failed == 0 {
+				se.Err = fmt.Errorf("chat %s: %w", chatID, err)
+			}
+			se.Failed++
 		}
-
-		// Read and log response
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("Error reading response for %s: %v", chatID, err)
-		} else {
-			log.Printf("Telegram API response for %s: %s", chatID, string(body))
-		}
-		resp.Body.Close()
+	}
+	if se.Failed > 0 {
+		return se
 	}
 	return nil
 }
 
 func GetUserInfo(chatID string) (string, error) {
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+	botToken := settings.BotToken
 	if botToken == "" {
 		return chatID, fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
 	}
 
-	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/getChat", botToken)
+	apiURL := fmt.Sprintf("%s/bot%s/getChat", apiBase(), botToken)
 	resp, err := http.PostForm(apiURL, url.Values{
 		"chat_id": {chatID},
 	})
@@ -107,8 +238,44 @@ func GetUserInfo(chatID string) (string, error) {
 		return chatID, fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
 	}
 
-	// For now, just return the chat ID as we don't need to parse the full response
-	return chatID, nil
+	// getChat returns a Chat; for private chats it carries the same name fields as User
+	var r Response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return chatID, fmt.Errorf("failed to decode user info: %v", err)
+	}
+	if !r.OK {
+		return chatID, fmt.Errorf("failed to get user info: not ok")
+	}
+	name := FormatUserName(&r.Result)
+	if name == "Unknown" {
+		return chatID, nil
+	}
+	return name, nil
+}
+
+// GetMe returns the bot the token belongs to
+func GetMe() (User, error) {
+	botToken := settings.BotToken
+	if botToken == "" {
+		return User{}, fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
+	}
+	resp, err := http.Get(fmt.Sprintf("%s/bot%s/getMe", apiBase(), botToken))
+	if err != nil {
+		return User{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return User{}, fmt.Errorf("telegram getMe failed %d: %s", resp.StatusCode, string(body))
+	}
+	var r Response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return User{}, fmt.Errorf("failed to decode getMe: %v", err)
+	}
+	if !r.OK || r.Result.Username == "" {
+		return User{}, fmt.Errorf("telegram getMe failed: not ok")
+	}
+	return r.Result, nil
 }
 
 func FormatUserName(user *User) string {
@@ -127,6 +294,75 @@ func FormatUserName(user *User) string {
 	return "Unknown"
 }
 
+// SetMyCommands registers the bot's default command menu
+func SetMyCommands(cmds []BotCommand) error {
+	return SetMyCommandsLang("", cmds)
+}
+
+// SetMyCommandsLang registers the command menu shown to users whose Telegram language is lang
+// (an ISO 639-1 code); an empty lang sets the default menu
+func SetMyCommandsLang(lang string, cmds []BotCommand) error {
+	botToken := settings.BotToken
+	if botToken == "" {
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
+	}
+	payload, err := json.Marshal(cmds)
+	if err != nil {
+		return err
+	}
+	form := url.Values{"commands": {string(payload)}}
+	if lang != "" {
+		form.Set("language_code", lang)
+	}
+	resp, err := http.PostForm(fmt.Sprintf("%s/bot%s/setMyCommands", apiBase(), botToken), form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("telegram setMyCommands failed %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// pollTimeout is how long a getUpdates call waits for new updates before returning empty
+const pollTimeout = 30 * time.Second
+
+// GetUpdates long-polls the Bot API for updates with an id of at least offset
+// (the last processed update_id + 1, which also confirms the earlier ones)
+func GetUpdates(offset int) ([]Update, error) {
+	botToken := settings.BotToken
+	if botToken == "" {
+		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
+	}
+	client := &http.Client{Timeout: pollTimeout + 10*time.Second}
+	resp, err := client.PostForm(fmt.Sprintf("%s/bot%s/getUpdates", apiBase(), botToken), url.Values{
+		"offset":          {strconv.Itoa(offset)},
+		"timeout":         {strconv.Itoa(int(pollTimeout.Seconds()))},
+		"allowed_updates": {`["message","callback_query"]`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("telegram getUpdates failed %d: %s", resp.StatusCode, string(body))
+	}
+	var r struct {
+		OK     bool     `json:"ok"`
+		Result []Update `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode updates: %v", err)
+	}
+	if !r.OK {
+		return nil, fmt.Errorf("telegram getUpdates failed: not ok")
+	}
+	return r.Result, nil
+}
+
 // ParseChatIDs splits a comma-separated string of chat IDs into a slice
 func ParseChatIDs(chatIDs string) []string {
 	ids := strings.Split(chatIDs, ",")
@@ -0,0 +1,241 @@
+package telegram
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAPI answers sendMessage with 403 for the chats in failing and records the others
+func fakeAPI(t *testing.T, failing map[string]bool) *[]string {
+	t.Helper()
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		chatID := r.FormValue("chat_id")
+		if failing[chatID] {
+			http.Error(w, `{"ok":false,"description":"Forbidden: bot was blocked by the user"}`, http.StatusForbidden)
+			return
+		}
+		sent = append(sent, chatID)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	orig := settings
+	t.Cleanup(func() { settings = orig })
+	Configure(Settings{BotToken: "test", APIURL: srv.URL, AdminChatIDs: []string{"1", "2", "3"}})
+	return &sent
+}
+
+func TestSendMessageReportsPartialFailure(t *testing.T) {
+	sent := fakeAPI(t, map[string]bool{"2": true})
+
+	err := SendMessage("hello")
+	var se *SendError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected a SendError, got %v", err)
+	}
+	if se.Failed != 1 || se.Total != 3 || se.All() || !strings.Contains(se.Err.Error(), "chat 2") {
+		t.Errorf("unexpected error %+v", se)
+	}
+	if strings.Join(*sent, ",") != "1,3" {
+		t.Errorf("expected the other chats still sent to, got %v", *sent)
+	}
+	if SendFailed("test message", err) {
+		t.Error("a message that reached some chats counts as sent")
+	}
+}
+
+func TestSendMessageReportsTotalFailure(t *testing.T) {
+	fakeAPI(t, map[string]bool{"1": true, "2": true, "3": true})
+
+	err := SendMessage("hello")
+	var se *SendError
+	if !errors.As(err, &se) || se.Failed != 3 || !se.All() {
+		t.Fatalf("expected every chat failed, got %v", err)
+	}
+	if !SendFailed("test message", err) {
+		t.Error("a message that reached nobody must count as failed")
+	}
+}
+
+func TestSendMessageSucceeds(t *testing.T) {
+	sent := fakeAPI(t, nil)
+	if err := SendMessage("hello"); err != nil || len(*sent) != 3 {
+		t.Fatalf("expected every chat sent to, got %v (%v)", *sent, err)
+	}
+}
+
+func TestGetMe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottest/getMe" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"id":42,"is_bot":true,"first_name":"Refuges","username":"fork_bot"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	orig := settings
+	t.Cleanup(func() { settings = orig })
+	Configure(Settings{BotToken: "test", APIURL: srv.URL})
+
+	me, err := GetMe()
+	if err != nil || me.Username != "fork_bot" || me.ID != 42 {
+		t.Errorf("expected @fork_bot, got %+v (%v)", me, err)
+	}
+	Configure(Settings{BotToken: "other", APIURL: srv.URL})
+	if _, err := GetMe(); err == nil {
+		t.Error("expected a failed getMe reported")
+	}
+}
+
+func TestGetUserInfo(t *testing.T) {
+	// the fake Bot API answers getChat according to the chat ID
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottest/getChat" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.FormValue("chat_id") {
+		case "1":
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"first_name":"Alice","username":"alice"}}`))
+		case "2":
+			w.Write([]byte(`{"ok":true,"result":{"id":2,"first_name":"Alice","last_name":"Martin"}}`))
+		case "3":
+			w.Write([]byte(`{"ok":true,"result":{"id":3}}`))
+		case "4":
+			http.Error(w, `{"ok":false,"error_code":500}`, http.StatusInternalServerError)
+		case "5":
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	orig := settings
+	t.Cleanup(func() { settings = orig })
+	Configure(Settings{BotToken: "test", APIURL: srv.URL})
+
+	for _, tt := range []struct {
+		chatID, want string
+		fails        bool
+	}{
+		{"1", "@alice", false},
+		{"2", "Alice Martin", false},
+		{"3", "3", false},
+		{"4", "4", true},
+		{"5", "5", true},
+	} {
+		got, err := GetUserInfo(tt.chatID)
+		if got != tt.want || (err != nil) != tt.fails {
+			t.Errorf("GetUserInfo(%s) = %q, %v, want %q (error %t)", tt.chatID, got, err, tt.want, tt.fails)
+		}
+	}
+}
+
+func TestPostAndEditMessage(t *testing.T) {
+	var edited string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/bottest/sendMessage":
+			w.Write([]byte(`{"ok":true,"result":{"message_id":7,"chat":{"id":-100}}}`))
+		case "/bottest/editMessageText":
+			edited = r.FormValue("message_id") + " " + r.FormValue("text")
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	orig := settings
+	t.Cleanup(func() { settings = orig })
+	Configure(Settings{BotToken: "test", APIURL: srv.URL})
+
+	id, err := PostMessage("@tete_rousse", "free")
+	if err != nil || id != 7 {
+		t.Fatalf("expected message 7, got %d (%v)", id, err)
+	}
+	if err := EditMessage("@tete_rousse", id, "full"); err != nil || edited != "7 full" {
+		t.Errorf("expected message 7 edited to full, got %q (%v)", edited, err)
+	}
+}
+
+// recordSleeps replaces sleep with one recording the delays and gives the test its own send limiter
+func recordSleeps(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var slept []time.Duration
+	origSleep, origLimit := sleep, sendLimit
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	sendLimit = &limiter{interval: origLimit.interval}
+	t.Cleanup(func() { sleep, sendLimit = origSleep, origLimit })
+	return &slept
+}
+
+func TestSendMessageToRetriesRateLimit(t *testing.T) {
+	slept := recordSleeps(t)
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 5","parameters":{"retry_after":5}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	orig := settings
+	t.Cleanup(func() { settings = orig })
+	Configure(Settings{BotToken: "test", APIURL: srv.URL})
+
+	if err := SendMessageTo("1", "hello"); err != nil || calls != 2 {
+		t.Fatalf("expected the message resent once, got %d calls (%v)", calls, err)
+	}
+	// waited for retry_after before resending
+	if len(*slept) != 1 || (*slept)[0] < 4*time.Second || (*slept)[0] > 5*time.Second {
+		t.Errorf("expected a ~5s wait, slept %v", *slept)
+	}
+}
+
+func TestSendMessageToGivesUpOnRateLimit(t *testing.T) {
+	slept := recordSleeps(t)
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"ok":false,"error_code":429}`))
+	}))
+	t.Cleanup(srv.Close)
+	orig := settings
+	t.Cleanup(func() { settings = orig })
+	Configure(Settings{BotToken: "test", APIURL: srv.URL})
+
+	err := SendMessageTo("1", "hello")
+	if err == nil || !strings.Contains(err.Error(), "429") || calls != maxSendRetries+1 {
+		t.Fatalf("expected a 429 error after %d calls, got %d calls (%v)", maxSendRetries+1, calls, err)
+	}
+	// no retry_after: backing off 1s, 2s, 4s
+	if len(*slept) != maxSendRetries || (*slept)[2] < 3*time.Second {
+		t.Errorf("expected exponential backoff, slept %v", *slept)
+	}
+}
+
+func TestLimiterSpacesSends(t *testing.T) {
+	slept := recordSleeps(t)
+	l := &limiter{interval: 100 * time.Millisecond}
+	for range 3 {
+		l.wait()
+	}
+	// sleep is stubbed, so the 2nd and 3rd waits are ~1 and ~2 intervals ahead
+	if len(*slept) != 2 || (*slept)[0] < 90*time.Millisecond || (*slept)[1] < 190*time.Millisecond {
+		t.Errorf("expected waits of ~100ms and ~200ms, slept %v", *slept)
+	}
+}
+
+func TestEscapeHTML(t *testing.T) {
+	if got := EscapeHTML(`Refuge A&B <b>"x"</b>`); got != `Refuge A&amp;B &lt;b&gt;"x"&lt;/b&gt;` {
+		t.Errorf("EscapeHTML = %q", got)
+	}
+}
@@ -3,8 +3,17 @@ package telegram
 // Minimal Telegram Update types needed for webhook handling
 
 type Update struct {
-    UpdateID int     `json:"update_id"`
-    Message  *MessageIn `json:"message"`
+    UpdateID      int            `json:"update_id"`
+    Message       *MessageIn     `json:"message"`
+    CallbackQuery *CallbackQuery `json:"callback_query"`
+}
+
+// CallbackQuery is sent when a user presses an inline keyboard button
+type CallbackQuery struct {
+    ID      string     `json:"id"`
+    From    *UserIn    `json:"from"`
+    Message *MessageIn `json:"message"` // the message carrying the button
+    Data    string     `json:"data"`
 }
 
 type MessageIn struct {
@@ -29,4 +38,8 @@ type Chat struct {
     Type string `json:"type"`
 }
 
-
+// InlineButton is an inline keyboard button that sends CallbackData back when pressed
+type InlineButton struct {
+    Text         string `json:"text"`
+    CallbackData string `json:"callback_data"`
+}
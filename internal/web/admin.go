@@ -0,0 +1,112 @@
+package web
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// adminWriteTimeout is how long an admin page may take to write, past the server's WriteTimeout:
+// the tables stream thousands of rows and imports create queries row by row
+const adminWriteTimeout = 2 * time.Minute
+
+const (
+	// defaultAdminLimit is the rows of an admin table page without ?limit=
+	defaultAdminLimit = 100
+	// maxAdminLimit caps ?limit=
+	maxAdminLimit = 5000
+	// adminChunk is how many rows are read from the store, rendered and flushed at a time, which
+	// bounds the memory of a page whatever its limit
+	adminChunk = 200
+)
+
+// withWriteTimeout gives h's responses d to be written
+func withWriteTimeout(d time.Duration, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// writers without deadlines (e.g. in tests) keep the server's
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d))
+		h(w, r)
+	}
+}
+
+// adminRoute protects an admin page with ADMIN_TOKEN and the longer adminWriteTimeout
+func adminRoute(h http.HandlerFunc) http.HandlerFunc {
+	return withWriteTimeout(adminWriteTimeout, requireAdminToken(h))
+}
+
+var adminSubscribersTmpl = template.Must(template.New("subscribers").Parse(`
+{{define "head"}}<!doctype html>
+<html><head><meta charset="utf-8"><title>Subscribers</title></head>
+<body style="font-family:sans-serif; max-width:960px; margin:24px auto;">
+<h1>Subscribers</h1>
+<table border="1" cellpadding="4" style="border-collapse:collapse;">
+<tr><th>Chat ID</th><th>Username</th><th>Language</th><th>Active</th><th>Snoozed until</th><th>Consent</th><th>Created</th></tr>
+{{end}}
+{{define "row"}}<tr><td>{{.ChatID}}</td><td>{{.Username}}</td><td>{{.Language}}</td><td>{{.IsActive}}</td><td>{{if not .SnoozedUntil.IsZero}}{{.SnoozedUntil.UTC.Format "2006-01-02 15:04"}}{{end}}</td><td>{{.ConsentSource}}</td><td>{{.CreatedAt.UTC.Format "2006-01-02"}}</td></tr>
+{{end}}
+{{define "error"}}<tr><td colspan="7">Listing stopped by a store error, reload to try again</td></tr>
+{{end}}
+{{define "foot"}}</table>
+<p>{{.Shown}} subscribers{{if .Next}} · <a href="{{.Next}}">Next page</a>{{end}}</p>
+</body></html>
+{{end}}`))
+
+// handleAdminSubscribers serves a page of every subscriber, in chat ID order: ?limit= rows
+// after the chat ID ?after=. Rows are streamed as they are read from the store, adminChunk at a
+// time, so a large page holds neither the store rows nor the HTML in memory.
+func (s *Server) handleAdminSubscribers(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAdminLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxAdminLimit)
+	}
+	if !s.storeAvailable(w) {
+		return
+	}
+	st := s.store
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	render := func(name string, data any) {
+		if err := adminSubscribersTmpl.ExecuteTemplate(w, name, data); err != nil {
+			slog.Error("admin subscribers template error", "template", name, "error", err)
+		}
+	}
+	render("head", nil)
+	rc := http.NewResponseController(w)
+	last, shown := r.URL.Query().Get("after"), 0
+	for shown < limit {
+		want := min(adminChunk, limit-shown)
+		subs, err := st.PageSubscribers(r.Context(), last, want)
+		if err != nil {
+			slog.Error("admin subscribers: failed to list", "after", last, "error", err)
+			render("error", nil)
+			break
+		}
+		for _, sub := range subs {
+			render("row", sub)
+		}
+		shown += len(subs)
+		if len(subs) > 0 {
+			last = subs[len(subs)-1].ChatID
+		}
+		_ = rc.Flush()
+		if len(subs) < want {
+			break
+		}
+	}
+	foot := struct {
+		Shown int
+		Next  string
+	}{Shown: shown}
+	if shown == limit {
+		foot.Next = "?" + url.Values{"after": {last}, "limit": {strconv.Itoa(limit)}}.Encode()
+	}
+	render("foot", foot)
+}
@@ -0,0 +1,145 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// chunkedStore checks that the subscribers are read a chunk at a time, each chunk written out
+// before the next is read
+type chunkedStore struct {
+	*store.MemoryStore
+	t       *testing.T
+	written func() string // the response so far
+	calls   int
+}
+
+func (s *chunkedStore) PageSubscribers(_ context.Context, after string, limit int) ([]store.Subscriber, error) {
+	s.t.Helper()
+	if limit > adminChunk {
+		s.t.Errorf("read %d subscribers at once, want at most %d", limit, adminChunk)
+	}
+	// the first read of a page starts after the request's ?after=, the next ones after the
+	// last row written
+	if written := s.written(); strings.Contains(written, "<tr><td>") && !strings.Contains(written, "<td>"+after+"</td>") {
+		s.t.Errorf("read the subscribers after %s before writing it out", after)
+	}
+	s.calls++
+	return s.MemoryStore.PageSubscribers(s.t.Context(), after, limit)
+}
+
+func (s *chunkedStore) ListSubscribers(_ context.Context) ([]store.Subscriber, error) {
+	s.t.Error("the admin table must not list every subscriber at once")
+	return s.MemoryStore.ListSubscribers(s.t.Context())
+}
+
+func TestAdminSubscribersStreamsPages(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.AdminToken = "t0ken" })
+	fake := store.NewMemory()
+	for i := range 3000 {
+		fake.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: fmt.Sprintf("%05d", i), Language: "en", IsActive: i%3 != 0, CreatedAt: time.Now()})
+	}
+	st := &chunkedStore{MemoryStore: fake, t: t}
+
+	row := regexp.MustCompile(`<tr><td>(\d+)</td>`)
+	next := regexp.MustCompile(`<a href="\?([^"]+)">Next page</a>`)
+	var chats []string
+	for page, query := 0, "limit=1000"; ; page++ {
+		rec := httptest.NewRecorder()
+		st.written = rec.Body.String
+		req := httptest.NewRequest(http.MethodGet, "/admin/subscribers?"+query, nil)
+		req.SetBasicAuth("admin", "t0ken")
+		NewServer(st).Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !rec.Flushed {
+			t.Fatalf("page %d: unexpected response %d (flushed %t)", page, rec.Code, rec.Flushed)
+		}
+		for _, m := range row.FindAllStringSubmatch(rec.Body.String(), -1) {
+			chats = append(chats, m[1])
+		}
+		m := next.FindStringSubmatch(rec.Body.String())
+		if m == nil {
+			break
+		}
+		query = strings.ReplaceAll(m[1], "&amp;", "&")
+		if page > 3 {
+			t.Fatal("too many pages")
+		}
+	}
+	if len(chats) != 3000 || chats[0] != "00000" || chats[2999] != "02999" {
+		t.Fatalf("paged through %d subscribers (%v...), want 3000 in order", len(chats), chats[:min(len(chats), 3)])
+	}
+	for i := 1; i < len(chats); i++ {
+		if chats[i] <= chats[i-1] {
+			t.Fatalf("subscribers out of order or repeated: %s after %s", chats[i], chats[i-1])
+		}
+	}
+	// 3 full pages of 5 chunks, then an empty one after the last subscriber
+	if st.calls != 16 {
+		t.Errorf("expected 16 store reads, got %d", st.calls)
+	}
+}
+
+func TestAdminSubscribersDefaultsAndAuth(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.AdminToken = "t0ken" })
+	st := store.NewMemory()
+	for i := range 150 {
+		st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: fmt.Sprintf("%03d", i), Username: "<b>", IsActive: true})
+	}
+	get := func(target string, auth bool) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if auth {
+			req.SetBasicAuth("admin", "t0ken")
+		}
+		NewServer(st).Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("/admin/subscribers", false); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the token, got %d", rec.Code)
+	}
+	rec := get("/admin/subscribers", true)
+	body := rec.Body.String()
+	if n := strings.Count(body, "<tr><td>"); n != defaultAdminLimit || !strings.Contains(body, "after=099") || strings.Contains(body, "<td><b></td>") {
+		t.Errorf("expected the first %d escaped subscribers and a next page, got %d rows", defaultAdminLimit, n)
+	}
+	if rec := get("/admin/subscribers?after=099", true); strings.Count(rec.Body.String(), "<tr><td>") != 50 || strings.Contains(rec.Body.String(), "Next page") {
+		t.Errorf("expected the last 50 subscribers without a next page")
+	}
+	if rec := get("/admin/subscribers?limit=0", true); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for limit=0, got %d", rec.Code)
+	}
+}
+
+func TestWithWriteTimeoutOutlivesTheServerTimeout(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done")
+	}
+	for _, c := range []struct {
+		handler http.HandlerFunc
+		ok      bool
+	}{{slow, false}, {withWriteTimeout(5*time.Second, slow), true}} {
+		srv := httptest.NewUnstartedServer(c.handler)
+		srv.Config.WriteTimeout = 50 * time.Millisecond
+		srv.Start()
+		resp, err := http.Get(srv.URL)
+		var body []byte
+		if err == nil {
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		if ok := err == nil && string(body) == "done"; ok != c.ok {
+			t.Errorf("response %q, %v; want it written: %t", body, err, c.ok)
+		}
+		srv.Close()
+	}
+}
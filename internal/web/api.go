@@ -0,0 +1,152 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// apiRefuge is a refuge in the JSON API
+type apiRefuge struct {
+	Name  string            `json:"name"`
+	Dates map[string]string `json:"dates"` // YYYY-MM-DD -> free places or "Full"
+}
+
+// availabilityResponse is the /api/v1/availability payload
+type availabilityResponse struct {
+	LastCheck time.Time   `json:"last_check"`
+	Refuges   []apiRefuge `json:"refuges"`
+}
+
+// apiRefugeV2 is a refuge in the v2 JSON API: its dates as an array ordered by date
+type apiRefugeV2 struct {
+	Name  string              `json:"name"`
+	Dates []parser.DateStatus `json:"dates"`
+}
+
+// availabilityResponseV2 is the /api/v2/availability payload
+type availabilityResponseV2 struct {
+	LastCheck time.Time     `json:"last_check"`
+	Refuges   []apiRefugeV2 `json:"refuges"`
+}
+
+// handleAvailabilityAPI serves the current snapshot as JSON, answering conditional requests with 304
+func handleAvailabilityAPI(w http.ResponseWriter, r *http.Request) {
+	if !allowRead(w, r) {
+		return
+	}
+	state := currentSnapshot()
+	resp := availabilityResponse{LastCheck: state.LastCheck, Refuges: make([]apiRefuge, 0, len(state.Refuges))}
+	for _, rf := range state.Refuges {
+		resp.Refuges = append(resp.Refuges, apiRefuge{Name: rf.Name, Dates: rf.Dates})
+	}
+	writeJSON(w, r, resp.LastCheck, resp)
+}
+
+// handleAvailabilityAPIV2 is handleAvailabilityAPI with the dates of each refuge as an ordered
+// array of {date, status, places}, so identical state always gives identical bytes
+func handleAvailabilityAPIV2(w http.ResponseWriter, r *http.Request) {
+	if !allowRead(w, r) {
+		return
+	}
+	state := currentSnapshot()
+	resp := availabilityResponseV2{LastCheck: state.LastCheck, Refuges: make([]apiRefugeV2, 0, len(state.Refuges))}
+	for _, rf := range state.Refuges {
+		resp.Refuges = append(resp.Refuges, apiRefugeV2{Name: rf.Name, Dates: rf.SortedDates()})
+	}
+	writeJSON(w, r, resp.LastCheck, resp)
+}
+
+// retentionResponse is the /api/v1/retention payload
+type retentionResponse struct {
+	Policies []store.RetentionPolicy `json:"policies"`
+}
+
+// handleRetentionAPI serves how long each table of personal data is kept
+func handleRetentionAPI(w http.ResponseWriter, r *http.Request) {
+	if !allowRead(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(retentionResponse{Policies: store.RetentionPolicies})
+}
+
+// allowRead answers 405 to anything but GET and HEAD
+func allowRead(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// writeJSON writes resp as a conditional JSON response
+func writeJSON(w http.ResponseWriter, r *http.Request, lastCheck time.Time, resp any) {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeConditional(w, r, "application/json", lastCheck, body)
+}
+
+// snapshotETag returns a strong ETag for a snapshot taken at lastCheck with the given content
+func snapshotETag(lastCheck time.Time, body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`"%x-%s"`, lastCheck.UnixNano(), hex.EncodeToString(sum[:8]))
+}
+
+// writeConditional writes body with ETag and Last-Modified headers, or 304 without a body
+// when the client's If-None-Match / If-Modified-Since show it already has this version.
+// If-None-Match takes precedence over If-Modified-Since (RFC 9110).
+func writeConditional(w http.ResponseWriter, r *http.Request, contentType string, lastModified time.Time, body []byte) {
+	etag := snapshotETag(lastModified, body)
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// notModified evaluates the request's conditional headers against the current version
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		// If-None-Match uses weak comparison
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	// Last-Modified has second precision
+	return !lastModified.Truncate(time.Second).After(t)
+}
@@ -0,0 +1,132 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// withSnapshot restores the shared web state after the test
+func withSnapshot(t *testing.T) {
+	t.Helper()
+	prev := current.Load()
+	t.Cleanup(func() { current.Store(prev) })
+}
+
+func getAvailability(t *testing.T, header string, value string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/availability", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	rec := httptest.NewRecorder()
+	handleAvailabilityAPI(rec, req)
+	return rec
+}
+
+func TestAvailabilityAPIConditional(t *testing.T) {
+	withSnapshot(t)
+	first := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	UpdateState([]parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "Full"}}}, first)
+
+	rec := getAvailability(t, "", "")
+	if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Fatalf("expected 200 with body, got %d", rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") != first.Format(http.TimeFormat) {
+		t.Fatalf("expected ETag and Last-Modified, got %v", rec.Header())
+	}
+
+	rec = getAvailability(t, "If-None-Match", etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("expected 304 without body for matching ETag, got %d (%d bytes)", rec.Code, rec.Body.Len())
+	}
+	rec = getAvailability(t, "If-Modified-Since", first.Format(http.TimeFormat))
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for If-Modified-Since, got %d", rec.Code)
+	}
+
+	// the next check found a free place
+	UpdateState([]parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "2"}}}, first.Add(time.Minute))
+	rec = getAvailability(t, "If-None-Match", etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("expected 200 with a new ETag after the change, got %d %s", rec.Code, rec.Header().Get("ETag"))
+	}
+	rec = getAvailability(t, "If-Modified-Since", first.Format(http.TimeFormat))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for an older If-Modified-Since, got %d", rec.Code)
+	}
+}
+
+func TestAvailabilityAPIETagDependsOnContent(t *testing.T) {
+	at := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	if snapshotETag(at, []byte("a")) == snapshotETag(at, []byte("b")) {
+		t.Error("expected different ETags for different content at the same check time")
+	}
+	if snapshotETag(at, []byte("a")) == snapshotETag(at.Add(time.Second), []byte("a")) {
+		t.Error("expected different ETags for different check times")
+	}
+}
+
+func TestStatusReportsLastErrorClass(t *testing.T) {
+	withSnapshot(t)
+	prev := lastError.Load()
+	t.Cleanup(func() { lastError.Store(prev) })
+
+	for _, class := range []string{"rate_limited", ""} {
+		SetLastError(class)
+		rec := httptest.NewRecorder()
+		NewServer(nil).handleStatus(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		var got struct {
+			LastError string `json:"last_error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("invalid status JSON %q: %v", rec.Body.String(), err)
+		}
+		if got.LastError != class {
+			t.Errorf("expected last_error %q, got %q", class, got.LastError)
+		}
+	}
+}
+
+func TestStatusCountsActiveSubscribers(t *testing.T) {
+	st := store.NewMemory()
+	for _, sub := range []store.Subscriber{{ChatID: "1", IsActive: true}, {ChatID: "2", IsActive: true}, {ChatID: "3"}} {
+		st.UpsertSubscriber(t.Context(), sub)
+	}
+	for want, srv := range map[string]*Server{"2": NewServer(st), "null": NewServer(nil)} {
+		rec := httptest.NewRecorder()
+		srv.handleStatus(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		var got struct {
+			Subscribers json.RawMessage `json:"subscribers"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("invalid status JSON %q: %v", rec.Body.String(), err)
+		}
+		if string(got.Subscribers) != want {
+			t.Errorf("expected subscribers %s, got %s", want, got.Subscribers)
+		}
+	}
+}
+
+func TestRetentionAPIListsPolicies(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(nil).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/retention", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 without a store, got %d", rec.Code)
+	}
+	var got retentionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid retention JSON %q: %v", rec.Body.String(), err)
+	}
+	if !reflect.DeepEqual(got.Policies, store.RetentionPolicies) {
+		t.Errorf("expected the retention policies, got %+v", got.Policies)
+	}
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/summary"
+)
+
+const archiveUsage = "Usage: /archive_season <year> [publish]"
+
+// archiveSeason aggregates the availability snapshots of an ended season into season summaries,
+// prunes those snapshots and returns the report. Once pruned, it returns the stored report.
+func archiveSeason(ctx context.Context, st store.Store, season int, now time.Time) (report string, pruned int, err error) {
+	from, to := summary.SeasonBounds(season)
+	if now.Before(to) {
+		return "", 0, fmt.Errorf("the %d season runs until %s", season, to.Format("2006-01-02"))
+	}
+	snaps, err := st.ListSnapshots(ctx, from, to)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(snaps) == 0 {
+		sums, err := st.ListSeasonSummaries(ctx, season)
+		return summary.FormatSeason(season, sums), 0, err
+	}
+	sums := summary.SeasonSummaries(season, snaps)
+	if err := st.SaveSeasonSummaries(ctx, season, sums); err != nil {
+		return "", 0, err
+	}
+	if pruned, err = st.DeleteSnapshots(ctx, from, to); err != nil {
+		return "", 0, err
+	}
+	return summary.FormatSeason(season, sums), pruned, nil
+}
+
+// handleArchiveCommand runs the admin "/archive_season <year> [publish]" command: the report goes
+// to every admin and, with publish, to the public channel. It returns the reply to the caller.
+func handleArchiveCommand(ctx context.Context, st store.Store, args []string, now time.Time) string {
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[1] != "publish") {
+		return archiveUsage
+	}
+	season, err := strconv.Atoi(args[0])
+	if err != nil || season < 2000 {
+		return archiveUsage
+	}
+	report, pruned, err := archiveSeason(ctx, st, season, now)
+	if err != nil {
+		slog.Error("archiving season failed", "season", season, "error", err)
+		return fmt.Sprintf("❌ Could not archive the %d season: %v", season, err)
+	}
+	slog.Info("season archived", "season", season, "pruned", pruned)
+	notifyAdmins(ctx, report)
+	reply := fmt.Sprintf("✅ Season %d archived, %d snapshots pruned", season, pruned)
+	if len(args) == 2 {
+		switch {
+		case settings.PublicChannel == "":
+			reply += "; not published, PUBLIC_CHANNEL_ID is not set"
+		case sendMessageTo(settings.PublicChannel, report) != nil:
+			reply += "; publishing to " + settings.PublicChannel + " failed"
+		default:
+			reply += "; published to " + settings.PublicChannel
+		}
+	}
+	return reply
+}
+
+// replyArchiveCommand sends the result of an admin /archive_season command
+func replyArchiveCommand(ctx context.Context, st store.Store, chatID string, txt string) {
+	_ = sendTo(ctx, chatID, handleArchiveCommand(ctx, st, strings.Fields(txt)[1:], time.Now()))
+}
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestArchiveSeasonPrunesOnlyThatSeason(t *testing.T) {
+	st := store.NewMemory()
+	at := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 8, 0, 0, 0, time.UTC) }
+	for _, sn := range []store.Snapshot{
+		{Refuge: "Tête Rousse", ObservedAt: at(2024, time.September, 20)}, // 2024 season
+		{Refuge: "Tête Rousse", ObservedAt: at(2025, time.July, 1), Open: map[string]int{"2025-08-10": 2}},
+		{Refuge: "Tête Rousse", ObservedAt: at(2025, time.July, 1).Add(10 * time.Minute)},
+		{Refuge: "Tête Rousse", ObservedAt: at(2025, time.October, 2)}, // current (2026) season
+	} {
+		st.RecordSnapshot(t.Context(), sn)
+	}
+
+	now := at(2025, time.October, 3)
+	if _, _, err := archiveSeason(t.Context(), st, 2026, now); err == nil {
+		t.Fatal("expected the running season to be refused")
+	}
+	report, pruned, err := archiveSeason(t.Context(), st, 2025, now)
+	if err != nil {
+		t.Fatalf("archiveSeason: %v", err)
+	}
+	if pruned != 2 || !strings.Contains(report, "📦 Season 2025 report") || !strings.Contains(report, "1 availability windows, median 10m") {
+		t.Errorf("unexpected archive (%d pruned):\n%s", pruned, report)
+	}
+	if sums, _ := st.ListSeasonSummaries(t.Context(), 2025); len(sums) != 1 || sums[0].Refuge != "Tête Rousse" || sums[0].Windows != 1 {
+		t.Errorf("expected the summary to be stored, got %+v", sums)
+	}
+	if snaps, _ := st.ListSnapshots(t.Context(), time.Time{}, now); len(snaps) != 2 || snaps[0].ObservedAt.Year() != 2024 || snaps[1].ObservedAt.Month() != time.October {
+		t.Errorf("expected the other seasons' snapshots kept, got %+v", snaps)
+	}
+
+	// running it again keeps the summaries and resends the same report
+	again, pruned, err := archiveSeason(t.Context(), st, 2025, now)
+	if err != nil || pruned != 0 || again != report {
+		t.Errorf("expected the stored report again, got %d pruned, %v:\n%s", pruned, err, again)
+	}
+}
+
+func TestArchiveCommandPublishes(t *testing.T) {
+	sent := captureSends(t)
+	st := store.NewMemory()
+	st.RecordSnapshot(t.Context(), store.Snapshot{Refuge: "du Goûter", ObservedAt: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)})
+	now := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := handleArchiveCommand(t.Context(), st, []string{"2025", "now"}, now); got != archiveUsage {
+		t.Errorf("expected usage for an unknown option, got %q", got)
+	}
+	if got := handleArchiveCommand(t.Context(), st, []string{"2025", "publish"}, now); !strings.HasSuffix(got, "not published, PUBLIC_CHANNEL_ID is not set") {
+		t.Errorf("unexpected reply without a channel %q", got)
+	}
+	useSettings(t, func(s *Settings) { s.PublicChannel = "@montblanc_huts" })
+	if got := handleArchiveCommand(t.Context(), st, []string{"2025", "publish"}, now); !strings.HasSuffix(got, "published to @montblanc_huts") {
+		t.Errorf("unexpected reply %q", got)
+	}
+	if len(*sent) != 1 || !strings.HasPrefix((*sent)[0], "@montblanc_huts: 📦 Season 2025 report") {
+		t.Errorf("expected the report posted to the channel, got %q", *sent)
+	}
+}
@@ -0,0 +1,24 @@
+package web
+
+import (
+	"fmt"
+	"html"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+// BookNowLink renders an inline "Book now" link to the refuge's booking page for date,
+// for Telegram messages sent with parse_mode HTML
+func BookNowLink(refuge string, date string, lang string) string {
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(parser.BookingLinkFor(refuge, date)), html.EscapeString(i18n.T(lang, "notif_book")))
+}
+
+// tableCell is a day in the weekly table; available days link to their booking page
+// and show how their places changed over the last hour
+type tableCell struct {
+	Text       string
+	URL        string
+	Trend      string // arrow, empty without enough history
+	TrendTitle string // localized tooltip
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// broadcastUsage answers /broadcast without a message
+const broadcastUsage = "Usage: /broadcast <message>\nSends the message, as plain text, to every active subscriber."
+
+// handleBroadcastCommand runs the admin "/broadcast <text>" command: text goes to every active
+// subscriber through sendMessageTo, which keeps to Telegram's rate limit. It returns the reply
+// to the admin.
+func handleBroadcastCommand(ctx context.Context, st store.Store, text string) string {
+	if text == "" {
+		return broadcastUsage
+	}
+	subs, err := st.ListSubscribers(ctx)
+	if err != nil {
+		slog.Error("/broadcast failed to list subscribers", "error", err)
+		return "❌ Could not load the subscribers, nothing was sent"
+	}
+	failed := 0
+	for _, sub := range subs {
+		if err := sendMessageTo(sub.ChatID, telegram.EscapeHTML(text)); err != nil {
+			slog.Error("broadcast message not delivered", "chat_id", sub.ChatID, "error", err)
+			failed++
+		}
+	}
+	slog.Info("broadcast sent", "subscribers", len(subs), "failed", failed)
+	return fmt.Sprintf("📣 Broadcast delivered to %d of %d subscribers, %d failed", len(subs)-failed, len(subs), failed)
+}
+
+// replyBroadcastCommand runs an admin /broadcast in the background and sends its summary: at
+// Telegram's rate limit a long subscriber list outlasts the webhook request, which Telegram
+// would then retry, broadcasting twice
+func replyBroadcastCommand(ctx context.Context, st store.Store, chatID string, text string) {
+	if text == "" {
+		_ = sendTo(ctx, chatID, broadcastUsage)
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		_ = sendTo(ctx, chatID, handleBroadcastCommand(ctx, st, text))
+	}()
+}
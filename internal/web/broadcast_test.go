@@ -0,0 +1,93 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+func TestBroadcastCommandSendsToActiveSubscribers(t *testing.T) {
+	st := store.NewMemory()
+	for _, sub := range []store.Subscriber{
+		{ChatID: "1", Language: "en", IsActive: true},
+		{ChatID: "2", Language: "fr", IsActive: true},
+		{ChatID: "3", Language: "en", IsActive: false},
+		{ChatID: "4", Language: "de", IsActive: true},
+	} {
+		st.UpsertSubscriber(t.Context(), sub)
+	}
+	var sent []string
+	prev := sendMessageTo
+	sendMessageTo = func(chatID string, message string) error {
+		if chatID == "2" {
+			return errors.New("bot was blocked by the user")
+		}
+		sent = append(sent, chatID+": "+message)
+		return nil
+	}
+	t.Cleanup(func() { sendMessageTo = prev })
+
+	got := handleBroadcastCommand(t.Context(), st, "Maintenance tonight, alerts < 1h late")
+	if want := "📣 Broadcast delivered to 2 of 3 subscribers, 1 failed"; got != want {
+		t.Errorf("reply %q, want %q", got, want)
+	}
+	sort.Strings(sent)
+	if want := []string{"1: Maintenance tonight, alerts &lt; 1h late", "4: Maintenance tonight, alerts &lt; 1h late"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+}
+
+func TestBroadcastCommandRefusesEmptyMessages(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true})
+	sent := captureSends(t)
+	if got := handleBroadcastCommand(t.Context(), st, ""); got != broadcastUsage {
+		t.Errorf("reply %q, want the usage", got)
+	}
+	if len(*sent) != 0 {
+		t.Errorf("empty broadcast sent %q", *sent)
+	}
+}
+
+func TestBroadcastIsAdminOnly(t *testing.T) {
+	replies := make(chan string, 4)
+	useSettings(t, func(s *Settings) {
+		s.AdminChatIDs = []string{"9"}
+		s.Notifier = notify.Func(func(_ context.Context, chatID string, message string) error {
+			replies <- chatID + ": " + message
+			return nil
+		})
+	})
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true})
+	sent := captureSends(t)
+	send := func(chatID int64, text string) {
+		ProcessUpdate(t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: chatID}, Text: text}}, st)
+	}
+
+	// anyone else gets the usual pointer to the website
+	send(1, "/broadcast hello")
+	if got := <-replies; !strings.HasPrefix(got, "1: Please subscribe on the website") {
+		t.Errorf("non-admin reply %q", got)
+	}
+	send(9, "/broadcast hello")
+	select {
+	case got := <-replies:
+		if got != "9: 📣 Broadcast delivered to 1 of 1 subscribers, 0 failed" {
+			t.Errorf("admin reply %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no broadcast summary")
+	}
+	if want := []string{"1: hello"}; !reflect.DeepEqual(*sent, want) {
+		t.Errorf("sent %q, want %q", *sent, want)
+	}
+}
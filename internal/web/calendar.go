@@ -0,0 +1,144 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// calendarToken identifies chatID in its calendar feed URL: the chat ID and its signature with
+// UNSUBSCRIBE_SECRET; ok is false when the secret isn't set, which disables the feeds
+func calendarToken(chatID string) (token string, ok bool) {
+	secret := settings.UnsubscribeSecret
+	if secret == "" {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("calendar:" + chatID))
+	return chatID + "." + hex.EncodeToString(mac.Sum(nil)[:16]), true
+}
+
+// calendarChat returns the chat ID a calendar token was issued for
+func calendarChat(token string) (string, bool) {
+	chatID, _, _ := strings.Cut(token, ".")
+	expected, ok := calendarToken(chatID)
+	return chatID, ok && chatIDPattern.MatchString(chatID) && hmac.Equal([]byte(token), []byte(expected))
+}
+
+// CalendarURL returns the iCalendar feed of chatID ("" when disabled)
+func CalendarURL(chatID string) string {
+	token, ok := calendarToken(chatID)
+	if !ok {
+		return ""
+	}
+	return baseURL() + "/calendar/" + url.PathEscape(token) + ".ics"
+}
+
+// handleCalendarCommand renders the "/calendar" reply: the link to the chat's feed
+func handleCalendarCommand(ctx context.Context, st store.Store, chatID string) string {
+	lang := "en"
+	if sub, err := st.GetSubscriber(ctx, chatID); err == nil {
+		lang = i18n.Supported(sub.Language)
+	}
+	link := CalendarURL(chatID)
+	if link == "" {
+		return i18n.T(lang, "calendar_off")
+	}
+	return fmt.Sprintf(i18n.T(lang, "calendar_link"), html.EscapeString(link))
+}
+
+// handleCalendar serves /calendar/{token}.ics: the available dates matching the subscriber's
+// queries, one all-day event each
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	token, isICS := strings.CutSuffix(r.PathValue("file"), ".ics")
+	chatID, valid := calendarChat(token)
+	if !isICS || !valid {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.storeAvailable(w) {
+		return
+	}
+	st := s.store
+	qs, err := st.ListQueriesByChat(r.Context(), chatID)
+	if err != nil {
+		slog.Error("calendar: failed to list queries", "chat_id", chatID, "error", err)
+		http.Error(w, "store unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	state := currentSnapshot()
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(calendarFeed(qs, state.Refuges, state.LastCheck)))
+}
+
+// calendarFeed renders the iCalendar feed of the available dates of refuges matching a query in
+// qs. The refuges were checked for parser.DefaultPax, so queries for other group sizes are left out.
+func calendarFeed(qs []store.Query, refuges []parser.Refuge, checked time.Time) string {
+	var b strings.Builder
+	line := func(s string) { b.WriteString(foldICS(s) + "\r\n") }
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//montblanc//refuge availability//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:Mont Blanc refuges")
+	stamp := checked.UTC().Format("20060102T150405Z")
+	host := strings.TrimPrefix(strings.TrimPrefix(baseURL(), "https://"), "http://")
+	for _, rf := range refuges {
+		for _, day := range rf.Days() {
+			if !day.Available() || !anyQueryMatches(qs, rf.Name, day) {
+				continue
+			}
+			line("BEGIN:VEVENT")
+			line("UID:" + RefugeSlug(rf.Name) + "-" + day.Date.Format("20060102") + "@" + host)
+			line("DTSTAMP:" + stamp)
+			line("DTSTART;VALUE=DATE:" + day.Date.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + day.Date.AddDate(0, 0, 1).Format("20060102"))
+			line("SUMMARY:" + escapeICS(fmt.Sprintf("%s: %d places", rf.Name, day.Places)))
+			line("URL:" + parser.BookingLinkFor(rf.Name, day.Key()))
+			line("END:VEVENT")
+		}
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// anyQueryMatches reports whether a query in qs for the default group size wants day at refuge
+func anyQueryMatches(qs []store.Query, refuge string, day parser.DayAvailability) bool {
+	for _, q := range qs {
+		if q.GroupSize(parser.DefaultPax) == parser.DefaultPax && q.Matches(refuge, day.Key()) && q.HasPlaces(day.Places) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeICS escapes an iCalendar TEXT value
+var escapeICS = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace
+
+// foldICS folds a content line longer than 75 octets, without splitting UTF-8 characters
+func foldICS(s string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestCalendarToken(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.UnsubscribeSecret = "" })
+	if CalendarURL("42") != "" {
+		t.Error("expected no feed without a secret")
+	}
+	settings.UnsubscribeSecret = "s3cret"
+	token, _ := calendarToken("-42")
+	if chatID, ok := calendarChat(token); !ok || chatID != "-42" {
+		t.Errorf("expected the token of -42 to be valid, got %q %v", chatID, ok)
+	}
+	// a token can't be moved to another chat
+	if _, ok := calendarChat("43" + strings.TrimPrefix(token, "-42")); ok {
+		t.Error("expected a forged token to be rejected")
+	}
+}
+
+func TestCalendarFeedHonoursQueries(t *testing.T) {
+	withSnapshot(t)
+	useSettings(t, func(s *Settings) {
+		s.UnsubscribeSecret, s.BaseURL = "s3cret", "https://example.org"
+	})
+	st := store.NewMemory()
+	st.AddQuery(t.Context(), store.Query{ChatID: "42", Refuge: "Tête Rousse", DateFrom: "2025-07-01", DateTo: "2025-07-31", MinPlaces: 2})
+	st.AddQuery(t.Context(), store.Query{ChatID: "42", Refuge: "du Goûter", DateFrom: "2025-07-01", DateTo: "2025-07-31", Pax: 4})
+	UpdateState([]parser.Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3", "2025-07-11": "1", "2025-08-01": "5"}},
+		{Name: "du Goûter", Dates: map[string]string{"2025-07-10": "6"}},
+	}, time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		NewServer(st).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	rec := get(strings.TrimPrefix(CalendarURL("42"), "https://example.org"))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/calendar; charset=utf-8" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	// only 2025-07-10 at Tête Rousse has enough places in the window; du Goûter is checked for
+	// another group size
+	if strings.Count(body, "BEGIN:VEVENT") != 1 || !strings.Contains(body, "DTSTART;VALUE=DATE:20250710\r\n") || !strings.Contains(body, "SUMMARY:Tête Rousse: 3 places\r\n") {
+		t.Errorf("unexpected feed %q", body)
+	}
+	if !strings.HasPrefix(body, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(body, "END:VCALENDAR\r\n") {
+		t.Errorf("expected a complete calendar, got %q", body)
+	}
+
+	if rec := get("/calendar/42.deadbeef.ics"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a bad token, got %d", rec.Code)
+	}
+}
+
+func TestFoldICS(t *testing.T) {
+	long := "SUMMARY:" + strings.Repeat("é", 60)
+	for _, l := range strings.Split(foldICS(long), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line of %d octets: %q", len(l), l)
+		}
+	}
+	if got := strings.ReplaceAll(foldICS(long), "\r\n ", ""); got != long {
+		t.Errorf("unfolding gave %q", got)
+	}
+}
@@ -0,0 +1,153 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// maxChangeEvents caps the events of one /api/v1/changes response
+const maxChangeEvents = 500
+
+// Change event kinds
+const (
+	changeAppeared     = "appeared"      // the date got free places
+	changeDisappeared  = "disappeared"   // the date has no free places left
+	changeCountChanged = "count_changed" // the free places went up or down
+)
+
+// changeEvent is a change of a date's availability in the /api/v1/changes payload
+type changeEvent struct {
+	Kind      string    `json:"kind"`
+	Refuge    string    `json:"refuge"`
+	Date      string    `json:"date"` // YYYY-MM-DD
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	OldPlaces int       `json:"old_places"`
+	NewPlaces int       `json:"new_places"`
+	At        time.Time `json:"at"` // check that saw the change
+}
+
+// changesResponse is the /api/v1/changes payload
+type changesResponse struct {
+	Since  time.Time     `json:"since"`
+	Events []changeEvent `json:"events"`
+	// Truncated is set when more events follow; poll again with since=next_since
+	Truncated bool `json:"truncated"`
+	// NextSince is the time of the last event, or since without events
+	NextSince time.Time `json:"next_since"`
+}
+
+// placesStatus is the status of a date with places free; the history doesn't tell full from closed
+func placesStatus(places int) string {
+	if places > 0 {
+		return "Available"
+	}
+	return "Full"
+}
+
+// changeOf returns the event of a date snapshot, false when its first snapshot found it
+// unavailable, which changes nothing for a poller
+func changeOf(sn store.DateSnapshot) (changeEvent, bool) {
+	e := changeEvent{Refuge: sn.Refuge, Date: sn.Date, OldPlaces: sn.Previous, NewPlaces: sn.Places, At: sn.CheckedAt}
+	switch {
+	case sn.Places > 0 && (sn.First || sn.Previous == 0):
+		e.Kind = changeAppeared
+	case sn.Places == 0 && !sn.First && sn.Previous > 0:
+		e.Kind = changeDisappeared
+	case sn.Places > 0:
+		e.Kind = changeCountChanged
+	default:
+		return changeEvent{}, false
+	}
+	e.OldStatus, e.NewStatus = placesStatus(e.OldPlaces), placesStatus(e.NewPlaces)
+	if sn.First {
+		e.OldStatus = "Unknown"
+	}
+	return e, true
+}
+
+// changesSince returns the change events of the checks after since, oldest first, at most
+// maxChangeEvents. When truncated, the events of the check cut short are left out entirely so
+// polling again from the last event's time misses none, unless that check alone has more
+// events than fit (/api/v1/history pages through those).
+func changesSince(ctx context.Context, st store.Store, since time.Time) ([]changeEvent, bool, error) {
+	// checks at since itself were seen by the previous poll
+	p := store.DateSnapshotPage{After: since, AfterID: math.MaxInt64, Limit: maxChangeEvents}
+	var events []changeEvent
+	for {
+		sns, err := st.PageDateSnapshots(ctx, p)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, sn := range sns {
+			e, ok := changeOf(sn)
+			if !ok {
+				continue
+			}
+			if len(events) == maxChangeEvents {
+				cut := len(events)
+				for cut > 0 && events[cut-1].At.Equal(e.At) {
+					cut--
+				}
+				if cut > 0 {
+					events = events[:cut]
+				}
+				return events, true, nil
+			}
+			events = append(events, e)
+		}
+		if len(sns) < p.Limit {
+			return events, false, nil
+		}
+		last := sns[len(sns)-1]
+		p.After, p.AfterID = last.CheckedAt, last.ID
+	}
+}
+
+// handleChangesAPI serves the availability changes after ?since= (RFC 3339), from the history of
+// checks the alerts are sent from. A since before the retained history is answered 416: the
+// poller should reload /api/v2/availability and poll from its last_check.
+func (s *Server) handleChangesAPI(w http.ResponseWriter, r *http.Request) {
+	if !allowRead(w, r) {
+		return
+	}
+	since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, "since must be an RFC 3339 time, e.g. 2025-07-01T08:00:00Z", http.StatusBadRequest)
+		return
+	}
+	if retention := settings.HistoryRetention; retention > 0 && since.Before(time.Now().Add(-retention)) {
+		http.Error(w, fmt.Sprintf("since is older than the %d days of history kept; reload /api/v2/availability and poll from its last_check", int(retention.Hours()/24)),
+			http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if !s.storeAvailable(w) {
+		return
+	}
+	st := s.store
+	events, truncated, err := changesSince(r.Context(), st, since)
+	if err != nil {
+		slog.Error("changes: failed to list snapshots", "error", err)
+		http.Error(w, "store unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	resp := changesResponse{Since: since, Events: events, Truncated: truncated, NextSince: since}
+	if resp.Events == nil {
+		resp.Events = []changeEvent{}
+	}
+	if len(events) > 0 {
+		resp.NextSince = events[len(events)-1].At
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
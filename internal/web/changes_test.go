@@ -0,0 +1,107 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// getChanges requests /api/v1/changes?since=since and decodes a 200 response
+func getChanges(t *testing.T, st store.Store, since string) (*httptest.ResponseRecorder, changesResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	NewServer(st).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/changes?since="+url.QueryEscape(since), nil))
+	var resp changesResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec, resp
+}
+
+func TestChangesAPIReportsChangesAfterSince(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.HistoryRetention = 0 })
+	st := store.NewMemory()
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	check := func(min int, places ...int) {
+		var sns []store.DateSnapshot
+		for i, n := range places {
+			sns = append(sns, store.DateSnapshot{Refuge: "du Goûter", Date: fmt.Sprintf("2025-07-%02d", 10+i), Places: n, CheckedAt: at.Add(time.Duration(min) * time.Minute)})
+		}
+		st.SaveDateSnapshots(t.Context(), sns)
+	}
+	check(0, 0, 2, 5)
+	check(1, 3, 0, 4)
+
+	// the first check is at since, so only the second one's changes are new
+	rec, resp := getChanges(t, st, at.Format(time.RFC3339))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Body.String())
+	}
+	var kinds []string
+	for _, e := range resp.Events {
+		kinds = append(kinds, fmt.Sprintf("%s %s %s->%s", e.Kind, e.Date, e.OldStatus, e.NewStatus))
+	}
+	want := "[appeared 2025-07-10 Full->Available disappeared 2025-07-11 Available->Full count_changed 2025-07-12 Available->Available]"
+	if fmt.Sprint(kinds) != want || resp.Truncated || !resp.NextSince.Equal(at.Add(time.Minute)) {
+		t.Errorf("unexpected changes %v (truncated %t, next %v)", kinds, resp.Truncated, resp.NextSince)
+	}
+
+	// dates first seen full aren't changes
+	_, resp = getChanges(t, st, at.Add(-time.Second).Format(time.RFC3339))
+	if len(resp.Events) != 5 || resp.Events[0].OldStatus != "Unknown" || resp.Events[0].Date != "2025-07-11" {
+		t.Errorf("unexpected changes since before the first check %+v", resp.Events)
+	}
+
+	// nothing new since the last check
+	_, resp = getChanges(t, st, resp.NextSince.Format(time.RFC3339Nano))
+	if resp.Events == nil || len(resp.Events) != 0 || resp.Truncated || !resp.NextSince.Equal(at.Add(time.Minute)) {
+		t.Errorf("expected an empty delta keeping since, got %+v", resp)
+	}
+}
+
+func TestChangesAPITruncatesBetweenChecks(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.HistoryRetention = 0 })
+	st := store.NewMemory()
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	// two checks of 300 dates opening at different refuges
+	for i := range 2 {
+		var sns []store.DateSnapshot
+		for d := range 300 {
+			sns = append(sns, store.DateSnapshot{Refuge: fmt.Sprintf("refuge %d", i), Date: fmt.Sprintf("d%03d", d), Places: 1, CheckedAt: at.Add(time.Duration(i+1) * time.Minute)})
+		}
+		st.SaveDateSnapshots(t.Context(), sns)
+	}
+
+	_, resp := getChanges(t, st, at.Format(time.RFC3339))
+	if len(resp.Events) != 300 || !resp.Truncated || !resp.NextSince.Equal(at.Add(time.Minute)) {
+		t.Fatalf("expected the first check alone, truncated; got %d events (truncated %t, next %v)", len(resp.Events), resp.Truncated, resp.NextSince)
+	}
+	_, resp = getChanges(t, st, resp.NextSince.Format(time.RFC3339Nano))
+	if len(resp.Events) != 300 || resp.Truncated || resp.Events[0].Refuge != "refuge 1" {
+		t.Errorf("expected the second check in full, got %d events (truncated %t)", len(resp.Events), resp.Truncated)
+	}
+}
+
+func TestChangesAPIRejectsBadSince(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.HistoryRetention = 30 * 24 * time.Hour })
+	st := store.NewMemory()
+	for since, code := range map[string]int{
+		"":           http.StatusBadRequest,
+		"yesterday":  http.StatusBadRequest,
+		"2025-07-01": http.StatusBadRequest,
+		time.Now().Add(-31 * 24 * time.Hour).Format(time.RFC3339): http.StatusRequestedRangeNotSatisfiable,
+		time.Now().Add(-29 * 24 * time.Hour).Format(time.RFC3339): http.StatusOK,
+	} {
+		if rec, _ := getChanges(t, st, since); rec.Code != code {
+			t.Errorf("since=%q: %d, want %d", since, rec.Code, code)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// channelSettingPrefix keys the channel set with /channel for a refuge, by refuge name; an empty
+// value unsets the channel of REFUGES_FILE
+const channelSettingPrefix = "refuge_channel:"
+
+const channelUsage = "Usage:\n/channel list\n/channel set <refuge> <@channel|chat_id>\n/channel unset <refuge>"
+
+// RefugeChannels returns the Telegram channel availability changes of each refuge are posted to:
+// the "channel" of REFUGES_FILE, overridden by /channel
+func RefugeChannels(ctx context.Context, st store.Store) (map[string]string, error) {
+	channels := map[string]string{}
+	for _, rc := range parser.Refuges() {
+		if rc.Channel != "" {
+			channels[rc.Name] = rc.Channel
+		}
+	}
+	set, err := st.ListSettings(ctx, channelSettingPrefix)
+	if err != nil {
+		return channels, err
+	}
+	for key, channel := range set {
+		name := strings.TrimPrefix(key, channelSettingPrefix)
+		if channel == "" {
+			delete(channels, name)
+			continue
+		}
+		channels[name] = channel
+	}
+	return channels, nil
+}
+
+// channelRefuge finds a monitored refuge by its slug or name
+func channelRefuge(arg string) (string, bool) {
+	for _, rc := range parser.Refuges() {
+		if RefugeSlug(rc.Name) == RefugeSlug(arg) {
+			return rc.Name, true
+		}
+	}
+	return "", false
+}
+
+// handleChannelCommand processes the admin "/channel list|set|unset" command and returns the reply
+func handleChannelCommand(ctx context.Context, st store.Store, args []string) string {
+	if len(args) == 0 {
+		return channelUsage
+	}
+	switch args[0] {
+	case "list":
+		channels, err := RefugeChannels(ctx, st)
+		if err != nil {
+			return "Error loading channels"
+		}
+		if len(channels) == 0 {
+			return "No refuge channels"
+		}
+		lines := make([]string, 0, len(channels))
+		for name, channel := range channels {
+			lines = append(lines, fmt.Sprintf("%s → %s", name, channel))
+		}
+		sort.Strings(lines)
+		return strings.Join(lines, "\n")
+	case "set":
+		if len(args) != 3 {
+			return channelUsage
+		}
+		name, ok := channelRefuge(args[1])
+		if !ok {
+			return "Unknown refuge: " + args[1]
+		}
+		if !parser.ValidChannel(args[2]) {
+			return "Invalid channel: " + args[2]
+		}
+		if err := st.SetSetting(ctx, channelSettingPrefix+name, args[2]); err != nil {
+			return "❌ " + err.Error()
+		}
+		return fmt.Sprintf("✅ %s changes are posted to %s", name, args[2])
+	case "unset":
+		if len(args) != 2 {
+			return channelUsage
+		}
+		name, ok := channelRefuge(args[1])
+		if !ok {
+			return "Unknown refuge: " + args[1]
+		}
+		if err := st.SetSetting(ctx, channelSettingPrefix+name, ""); err != nil {
+			return "❌ " + err.Error()
+		}
+		return fmt.Sprintf("✅ %s changes are no longer posted", name)
+	}
+	return channelUsage
+}
+
+// replyChannelCommand sends the result of an admin /channel command
+func replyChannelCommand(ctx context.Context, st store.Store, chatID string, txt string) {
+	_ = sendTo(ctx, chatID, handleChannelCommand(ctx, st, strings.Fields(txt)[1:]))
+}
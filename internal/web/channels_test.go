@@ -0,0 +1,42 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestChannelCommandOverridesRegistry(t *testing.T) {
+	parser.SetRefuges([]parser.RefugeConfig{
+		{Name: "Tête Rousse", StructureID: "BK_STRUCTURE:29", Channel: "@tete_rousse"},
+		{Name: "du Goûter", StructureID: "BK_STRUCTURE:30"},
+	})
+	t.Cleanup(func() { parser.SetRefuges(nil) })
+	st := store.NewMemory()
+	ctx := t.Context()
+
+	if got := handleChannelCommand(ctx, st, []string{"set", "du-gouter", "@gouter"}); got != "✅ du Goûter changes are posted to @gouter" {
+		t.Errorf("unexpected reply to set: %q", got)
+	}
+	if got := handleChannelCommand(ctx, st, []string{"set", "du-gouter", "gouter"}); got != "Invalid channel: gouter" {
+		t.Errorf("expected an invalid channel refused, got %q", got)
+	}
+	if got := handleChannelCommand(ctx, st, []string{"unset", "cosmiques"}); got != "Unknown refuge: cosmiques" {
+		t.Errorf("expected an unknown refuge refused, got %q", got)
+	}
+	if got := handleChannelCommand(ctx, st, []string{"unset", "tete-rousse"}); got != "✅ Tête Rousse changes are no longer posted" {
+		t.Errorf("unexpected reply to unset: %q", got)
+	}
+
+	channels, err := RefugeChannels(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 1 || channels["du Goûter"] != "@gouter" {
+		t.Errorf("expected only du Goûter posted to @gouter, got %v", channels)
+	}
+	if got := handleChannelCommand(ctx, st, []string{"list"}); got != "du Goûter → @gouter" {
+		t.Errorf("unexpected list %q", got)
+	}
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// menuCommands are the user commands listed in the bot's command menu, in menu order;
+// each has a "cmd_<name>" description in i18n. Admin commands are left out.
+var menuCommands = []string{"start", "list", "status", "snooze", "quiet", "digest", "test", "weekly", "gone", "calendar", "language", "export", "stop", "id"}
+
+// botCommands returns the command menu with descriptions in lang
+func botCommands(lang string) []telegram.BotCommand {
+	cmds := make([]telegram.BotCommand, 0, len(menuCommands))
+	for _, name := range menuCommands {
+		cmds = append(cmds, telegram.BotCommand{Command: name, Description: i18n.T(lang, "cmd_"+name)})
+	}
+	return cmds
+}
+
+// addressedCommand strips the bot's @username from a command sent in a group, e.g.
+// "/list@montblanc_booking_bot"; false for a command addressed to another bot
+func addressedCommand(txt string) (string, bool) {
+	if !strings.HasPrefix(txt, "/") {
+		return txt, true
+	}
+	first, rest, spaced := strings.Cut(txt, " ")
+	command, bot, addressed := strings.Cut(first, "@")
+	if !addressed {
+		return txt, true
+	}
+	if !strings.EqualFold(bot, settings.BotUsername) {
+		return "", false
+	}
+	if spaced {
+		return command + " " + rest, true
+	}
+	return command, true
+}
+
+// RegisterCommands registers the command menu with Telegram: English as the default and one
+// localized menu per language. Failures are logged and returned but must not stop startup.
+func RegisterCommands(set func(lang string, cmds []telegram.BotCommand) error) error {
+	var failed []string
+	for _, lang := range append([]string{""}, i18n.Languages()...) {
+		menuLang := lang
+		if menuLang == "" {
+			menuLang = "en"
+		}
+		if err := set(lang, botCommands(menuLang)); err != nil {
+			slog.Error("failed to register the command menu", "lang", lang, "error", err)
+			failed = append(failed, menuLang)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("command menu not registered for %v", failed)
+	}
+	return nil
+}
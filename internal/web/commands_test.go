@@ -0,0 +1,80 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+func TestRegisterCommands(t *testing.T) {
+	menus := map[string][]telegram.BotCommand{}
+	err := RegisterCommands(func(lang string, cmds []telegram.BotCommand) error {
+		menus[lang] = cmds
+		if lang == "it" {
+			return errors.New("telegram down")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Error("expected the failed language to be reported")
+	}
+	// a failing language doesn't stop the others
+	if len(menus) != len(i18n.Languages())+1 {
+		t.Fatalf("expected a default and one menu per language, got %d", len(menus))
+	}
+	for lang, cmds := range menus {
+		if len(cmds) != len(menuCommands) {
+			t.Errorf("%q menu has %d commands", lang, len(cmds))
+		}
+		for _, c := range cmds {
+			if c.Description == "" || c.Description == "cmd_"+c.Command {
+				t.Errorf("%q menu: /%s has no description", lang, c.Command)
+			}
+		}
+	}
+	if menus[""][0].Description != i18n.T("en", "cmd_start") || menus["de"][0].Description != i18n.T("de", "cmd_start") {
+		t.Errorf("unexpected descriptions: %q / %q", menus[""][0].Description, menus["de"][0].Description)
+	}
+}
+
+func TestAddressedCommand(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.BotUsername = "fork_bot" })
+	for _, c := range []struct {
+		text string
+		want string
+		ours bool
+	}{
+		{"/list", "/list", true},
+		{"/list@fork_bot", "/list", true},
+		{"/list@Fork_Bot", "/list", true},
+		{"/language@fork_bot de", "/language de", true},
+		{"/list@montblanc_booking_bot", "", false},
+		{"hello @fork_bot", "hello @fork_bot", true},
+	} {
+		if got, ours := addressedCommand(c.text); got != c.want || ours != c.ours {
+			t.Errorf("%q: expected %q (%t), got %q (%t)", c.text, c.want, c.ours, got, ours)
+		}
+	}
+}
+
+func TestGroupCommandsForAnotherBotAreIgnored(t *testing.T) {
+	var sent []string
+	useSettings(t, func(s *Settings) {
+		s.BotUsername = "fork_bot"
+		s.Notifier = notify.Func(func(_ context.Context, chatID string, message string) error {
+			sent = append(sent, message)
+			return nil
+		})
+	})
+	for _, text := range []string{"/id@fork_bot", "/id@montblanc_booking_bot", "/id"} {
+		ProcessUpdate(t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: -100, Type: "group"}, Text: text}}, store.NewMemory())
+	}
+	if len(sent) != 2 || sent[0] != "Your Chat ID: -100" {
+		t.Errorf("expected replies to the commands for this bot only, got %q", sent)
+	}
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// Greetings sent when a subscription is confirmed; their hash is recorded as the consent version
+const (
+	startGreeting    = "✅ Subscribed for next 30 days (both refuges): %s → %s\nSend /stop to unsubscribe."
+	deepLinkGreeting = "✅ Subscription saved. We'll notify you when matching dates appear."
+)
+
+// Replies to a /start that adds no default subscription
+const (
+	startWelcomeBack = "✅ Welcome back, your subscriptions are still active. Send /list to see them, /stop to unsubscribe."
+	startSaveFailed  = "❌ Could not save your subscription, please try again later."
+)
+
+// greetingVersion identifies the exact greeting template a user agreed to
+func greetingVersion(greeting string) string {
+	sum := sha256.Sum256([]byte(greeting))
+	return hex.EncodeToString(sum[:6])
+}
+
+// consentIPKey is the setting holding the IP of a web form signup until its deep link is opened
+func consentIPKey(sig string) string {
+	return store.ConsentIPPrefix + sig
+}
+
+// signupEmailKey is the setting holding the email address of a web form signup until its deep
+// link is opened
+func signupEmailKey(sig string) string {
+	return store.SignupEmailPrefix + sig
+}
+
+// clientIP returns the address a request came from, honouring the proxy's X-Forwarded-For
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// signup activates sub and records its consent; the first recorded consent is kept on later signups,
+// as are an earlier request for the season-opening ping and the plan. sub.Language is an explicit
+// choice when sub.LanguageLocked, otherwise it's auto-detected and doesn't replace a language
+// chosen before.
+func signup(ctx context.Context, st store.Store, sub store.Subscriber, source string, greeting string, ip string, now time.Time) error {
+	prev, err := st.GetSubscriber(ctx, sub.ChatID)
+	if err == nil {
+		sub.NotifyOnSeasonOpen = sub.NotifyOnSeasonOpen || prev.NotifyOnSeasonOpen
+		sub.SeasonNotified = prev.SeasonNotified
+		// the plan is set by admins, not by signing up again
+		sub.Plan = prev.Plan
+		if sub.Email == "" {
+			sub.Email, sub.EmailOnly = prev.Email, prev.EmailOnly
+		}
+		lang, explicit := sub.Language, sub.LanguageLocked
+		if prev.LanguageLocked && !explicit && lang != prev.Language {
+			notifyAdmins(ctx, fmt.Sprintf("🌐 chat_id=%s signed up again via %s in %s; keeping the chosen %s", sub.ChatID, source, telegram.EscapeHTML(lang), telegram.EscapeHTML(prev.Language)))
+		}
+		sub.Language, sub.LanguageLocked = prev.Language, prev.LanguageLocked
+		sub.SetLanguage(lang, explicit)
+	}
+	if err == nil && prev.HasConsent() {
+		sub.ConsentAt, sub.ConsentSource, sub.ConsentVersion, sub.ConsentIP = prev.ConsentAt, prev.ConsentSource, prev.ConsentVersion, prev.ConsentIP
+	} else {
+		sub.ConsentAt = now.UTC()
+		sub.ConsentSource = source
+		sub.ConsentVersion = greetingVersion(greeting)
+		sub.ConsentIP = ip
+	}
+	sub.IsActive = true
+	return st.UpsertSubscriber(ctx, sub)
+}
+
+// subscriberExport is the "/export" dump of everything stored about a chat
+type subscriberExport struct {
+	Subscriber store.Subscriber        `json:"subscriber"`
+	Queries    []store.Query           `json:"queries"`
+	Retention  []store.RetentionPolicy `json:"retention"` // how long the data about the chat is kept
+}
+
+// exportSubscriber renders the "/export" reply as indented JSON
+func exportSubscriber(ctx context.Context, st store.Store, chatID string) (string, error) {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+	qs, err := st.ListQueriesByChat(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+	if qs == nil {
+		qs = []store.Query{}
+	}
+	b, err := json.MarshalIndent(subscriberExport{Subscriber: sub, Queries: qs, Retention: store.RetentionPolicies}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// formatSubscriberDetail renders the admin "/subscriber <chat_id>" reply
+func formatSubscriberDetail(sub store.Subscriber, qs []store.Query) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("👤 %s", sub.ChatID))
+	if sub.Username != "" {
+		b.WriteString(" @" + sub.Username)
+	}
+	lang := sub.Language
+	if sub.LanguageLocked {
+		lang += " (chosen)"
+	}
+	b.WriteString(fmt.Sprintf("\nlang=%s, plan=%s, active=%t\n", lang, sub.Plan, sub.IsActive))
+	b.WriteString(fmt.Sprintf("Created: %s\n", sub.CreatedAt.UTC().Format(time.RFC3339)))
+	if sub.HasConsent() {
+		b.WriteString(fmt.Sprintf("Consent: %s via %s (greeting %s)\n", sub.ConsentAt.UTC().Format(time.RFC3339), sub.ConsentSource, sub.ConsentVersion))
+		if sub.ConsentIP != "" {
+			b.WriteString("Consent IP: " + sub.ConsentIP + "\n")
+		}
+	} else {
+		b.WriteString("Consent: not recorded (legacy)\n")
+	}
+	b.WriteString(fmt.Sprintf("Subscriptions: %d\n", len(qs)))
+	return b.String()
+}
@@ -0,0 +1,157 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// useSettings applies change to the web settings for the duration of the test
+func useSettings(t *testing.T, change func(s *Settings)) {
+	t.Helper()
+	prev := settings
+	change(&settings)
+	t.Cleanup(func() { settings = prev })
+}
+
+func TestSignupRecordsConsentSource(t *testing.T) {
+	st := store.NewMemory()
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := signup(t.Context(), st, store.Subscriber{ChatID: "1", Language: "en"}, store.ConsentTelegram, startGreeting, "", now); err != nil {
+		t.Fatalf("signup: %v", err)
+	}
+	sub, _ := st.GetSubscriber(t.Context(), "1")
+	if !sub.IsActive || sub.ConsentSource != store.ConsentTelegram || !sub.ConsentAt.Equal(now) || sub.ConsentVersion != greetingVersion(startGreeting) || sub.ConsentIP != "" {
+		t.Errorf("unexpected consent for /start: %+v", sub)
+	}
+
+	// a later signup through another path keeps the first consent
+	if err := signup(t.Context(), st, store.Subscriber{ChatID: "1", Language: "en"}, store.ConsentWebForm, deepLinkGreeting, "203.0.113.7", now.Add(time.Hour)); err != nil {
+		t.Fatalf("signup: %v", err)
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "1"); sub.ConsentSource != store.ConsentTelegram || !sub.ConsentAt.Equal(now) {
+		t.Errorf("expected the first consent to be kept, got %+v", sub)
+	}
+
+	// legacy subscribers get their consent recorded on the next signup
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "2", ConsentSource: store.ConsentLegacy})
+	signup(t.Context(), st, store.Subscriber{ChatID: "2"}, store.ConsentWebForm, deepLinkGreeting, "203.0.113.7", now)
+	if sub, _ := st.GetSubscriber(t.Context(), "2"); sub.ConsentSource != store.ConsentWebForm || sub.ConsentIP != "203.0.113.7" || sub.ConsentVersion != greetingVersion(deepLinkGreeting) {
+		t.Errorf("unexpected consent for web form: %+v", sub)
+	}
+}
+
+func TestSubscribeFormRecordsIP(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.DeepLinkSecret = "test" })
+	st := store.NewMemory()
+
+	form := url.Values{"refuge": {"*"}, "date_from": {"2025-07-01"}, "date_to": {"2025-07-31"}}
+	req := httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	rec := httptest.NewRecorder()
+	NewServer(st).handleSubscribe(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	settings, _ := st.ListSettings(t.Context(), "")
+	if len(settings) != 1 {
+		t.Fatalf("expected one stored signup IP, got %v", settings)
+	}
+	for key, ip := range settings {
+		sig := strings.TrimPrefix(key, consentIPKey(""))
+		if ip != "203.0.113.7" || !strings.Contains(rec.Body.String(), "."+sig) {
+			t.Errorf("expected the client IP under the link signature, got %s=%s", key, ip)
+		}
+	}
+}
+
+func TestExportContainsConsent(t *testing.T) {
+	st := store.NewMemory()
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	signup(t.Context(), st, store.Subscriber{ChatID: "1", Language: "fr"}, store.ConsentWebForm, deepLinkGreeting, "203.0.113.7", now)
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+
+	dump, err := exportSubscriber(t.Context(), st, "1")
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var got struct {
+		Subscriber map[string]any          `json:"subscriber"`
+		Queries    []map[string]any        `json:"queries"`
+		Retention  []store.RetentionPolicy `json:"retention"`
+	}
+	if err := json.Unmarshal([]byte(dump), &got); err != nil {
+		t.Fatalf("export is not JSON: %v", err)
+	}
+	want := map[string]any{
+		"consent_at":      "2025-07-01T12:00:00Z",
+		"consent_source":  store.ConsentWebForm,
+		"consent_version": greetingVersion(deepLinkGreeting),
+		"consent_ip":      "203.0.113.7",
+	}
+	for k, v := range want {
+		if got.Subscriber[k] != v {
+			t.Errorf("export %s = %v, want %v", k, got.Subscriber[k], v)
+		}
+	}
+	if len(got.Queries) != 1 {
+		t.Errorf("expected 1 query in export, got %d", len(got.Queries))
+	}
+	if len(got.Retention) != len(store.RetentionPolicies) {
+		t.Errorf("expected the retention policies in export, got %+v", got.Retention)
+	}
+	if _, err := exportSubscriber(t.Context(), st, "2"); err == nil {
+		t.Error("expected an error for an unknown chat")
+	}
+
+	detail := formatSubscriberDetail(store.Subscriber{ChatID: "2", ConsentSource: store.ConsentLegacy}, nil)
+	if !strings.Contains(detail, "legacy") {
+		t.Errorf("expected legacy marker in detail view, got %q", detail)
+	}
+}
+
+func TestSubscribeFormEmailReachesSubscriber(t *testing.T) {
+	useSettings(t, func(s *Settings) {
+		s.DeepLinkSecret = "test"
+		s.Notifier = notify.Func(func(context.Context, string, string) error { return nil })
+	})
+	st := store.NewMemory()
+
+	form := url.Values{"refuge": {"*"}, "date_from": {"2025-07-01"}, "date_to": {"2025-07-31"}, "email": {"Me <me@example.org>"}, "email_only": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	NewServer(st).handleSubscribe(rec, req)
+	command := regexp.MustCompile(`/start ps_[^"]+`).FindString(rec.Body.String())
+	if rec.Code != http.StatusOK || command == "" {
+		t.Fatalf("expected a deep link, got %d", rec.Code)
+	}
+
+	ProcessUpdate(t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 7}, Text: command}}, st)
+	sub, err := st.GetSubscriber(t.Context(), "7")
+	if err != nil || sub.Email != "me@example.org" || !sub.EmailOnly {
+		t.Errorf("expected the email-only address saved, got %+v (%v)", sub, err)
+	}
+
+	// an invalid address is rejected
+	form.Set("email", "not an address")
+	req = httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	NewServer(st).handleSubscribe(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid email, got %d", rec.Code)
+	}
+}
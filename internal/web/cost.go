@@ -0,0 +1,28 @@
+package web
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+// estimateCost is what nights cost pax people at nightPrice per person and night, rounded to
+// the euro
+func estimateCost(nightPrice float64, pax int, nights int) int {
+	return int(math.Round(nightPrice * float64(pax*nights)))
+}
+
+// CostEstimate renders the estimated cost of nights at refuge for pax people (0: parser.DefaultPax)
+// in lang, e.g. "2 night(s) ≈ €180 for 2 people (estimate)"; "" when the refuge has no night_price
+func CostEstimate(refuge string, pax int, nights int, lang string) string {
+	rc, ok := parser.FindRefuge(parser.RefugeConfig{Name: refuge})
+	if !ok || rc.NightPrice <= 0 {
+		return ""
+	}
+	if pax < 1 {
+		pax = parser.DefaultPax
+	}
+	return fmt.Sprintf(i18n.T(lang, "cost_estimate"), nights, estimateCost(rc.NightPrice, pax, nights), pax)
+}
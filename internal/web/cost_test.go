@@ -0,0 +1,39 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+func TestEstimateCost(t *testing.T) {
+	for _, c := range []struct {
+		price       float64
+		pax, nights int
+		want        int
+	}{
+		{45, 2, 2, 180},
+		{62.5, 1, 1, 63},
+		{62.5, 3, 1, 188},
+		{0, 4, 1, 0},
+	} {
+		if got := estimateCost(c.price, c.pax, c.nights); got != c.want {
+			t.Errorf("estimateCost(%g, %d, %d) = %d, want %d", c.price, c.pax, c.nights, got, c.want)
+		}
+	}
+}
+
+func TestCostEstimateNeedsAPrice(t *testing.T) {
+	parser.SetRefuges([]parser.RefugeConfig{
+		{Name: "Tête Rousse", StructureID: "BK_STRUCTURE:29", NightPrice: 90},
+		{Name: "du Goûter", StructureID: "BK_STRUCTURE:30"},
+	})
+	t.Cleanup(func() { parser.SetRefuges(nil) })
+
+	if got := CostEstimate("Tête Rousse", 2, 1, "en"); got != "1 night(s) ≈ €180 for 2 people (estimate)" {
+		t.Errorf("unexpected estimate %q", got)
+	}
+	if got := CostEstimate("du Goûter", 2, 1, "en"); got != "" {
+		t.Errorf("expected no estimate without a price, got %q", got)
+	}
+}
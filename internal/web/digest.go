@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// digestUsage answers /digest without a valid mode
+const digestUsage = "Usage: /digest on [time zone, e.g. Europe/Paris] or /digest off\nIn digest mode the day's alerts are sent in one message instead of right away."
+
+// emailOnlyNoDigest refuses the Telegram digests to subscribers whose alerts are only emailed
+const emailOnlyNoDigest = "Your alerts are only sent by email, and digests are Telegram messages. Subscribe again on the website without \"Send alerts only by email\" to use them."
+
+// dailyDigestHeader starts the daily digest; the alerts of the day follow it
+const dailyDigestHeader = "📬 Your daily digest of new availability:\n\n"
+
+// dailyDigestID is the outbox ID of the per-chat daily digest
+func dailyDigestID(chatID string) string { return "daily-" + chatID }
+
+// digestTime is when the daily digest of sub collecting an alert found at now goes out: the next
+// digest hour in its time zone, or the end of its quiet hours when they cover it
+func digestTime(sub store.Subscriber, now time.Time) time.Time {
+	at := sub.NextDigest(now, settings.DigestHour)
+	if until := sub.QuietUntil(at); !until.IsZero() {
+		return until
+	}
+	return at
+}
+
+// holdForDigest appends body to the daily digest of sub due after now
+func holdForDigest(ctx context.Context, st store.Store, sub store.Subscriber, body string, now time.Time) error {
+	return st.EnqueueMessage(ctx, store.OutboxMessage{ID: dailyDigestID(sub.ChatID), ChatID: sub.ChatID, Text: body, Kind: store.KindDaily, DeliverAfter: digestTime(sub, now)})
+}
+
+// formatDigestHour renders the digest hour of sub, e.g. "08:00 Europe/Paris"
+func formatDigestHour(sub store.Subscriber) string {
+	zone := sub.Timezone
+	if zone == "" {
+		zone = "UTC"
+	}
+	return fmt.Sprintf("%02d:00 %s", settings.DigestHour, zone)
+}
+
+// handleDigestCommand processes "/digest on [zone]" and "/digest off", returning the reply
+func handleDigestCommand(ctx context.Context, st store.Store, chatID string, arg string) string {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "You have no subscription yet. Send /start to subscribe."
+	}
+	if err != nil {
+		slog.Error("digest mode failed to load subscriber", "chat_id", chatID, "error", err)
+		return "Could not update your notification mode, please try again later."
+	}
+	fields := strings.Fields(arg)
+	switch {
+	case len(fields) == 0:
+		if sub.NotifyMode != store.NotifyDigest {
+			return "Alerts are sent right away.\n" + digestUsage
+		}
+		return "📬 Daily digest at " + formatDigestHour(sub) + "\n" + digestUsage
+	case strings.EqualFold(fields[0], "off") && len(fields) == 1:
+		if sub.NotifyMode != store.NotifyDigest {
+			return "Alerts are already sent right away."
+		}
+		// alerts already collected still arrive with today's digest
+		sub.NotifyMode = store.NotifyInstant
+	case strings.EqualFold(fields[0], "on") && len(fields) <= 2:
+		if sub.EmailOnly {
+			return emailOnlyNoDigest
+		}
+		if len(fields) == 2 {
+			// "Local" is the server's zone, not the subscriber's
+			if _, err := time.LoadLocation(fields[1]); err != nil || fields[1] == "Local" {
+				return fmt.Sprintf("Unknown time zone %q.\n", fields[1]) + digestUsage
+			}
+			sub.Timezone = fields[1]
+		}
+		sub.NotifyMode = store.NotifyDigest
+	default:
+		return digestUsage
+	}
+	if err := st.UpsertSubscriber(ctx, sub); err != nil {
+		slog.Error("notification mode not saved", "chat_id", chatID, "error", err)
+		return "Could not update your notification mode, please try again later."
+	}
+	if sub.NotifyMode != store.NotifyDigest {
+		return "🔔 Daily digest off, alerts are sent right away again."
+	}
+	return "📬 Daily digest on: alerts are collected and sent in one message at " + formatDigestHour(sub) + "."
+}
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestDigestCommand(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true})
+
+	for _, tt := range []struct {
+		arg, reply string
+		mode, zone string
+	}{
+		{"", "Alerts are sent right away.", "", ""},
+		{"on Mars/Olympus", "Unknown time zone \"Mars/Olympus\"", "", ""},
+		{"on Europe/Paris", "📬 Daily digest on: alerts are collected and sent in one message at 08:00 Europe/Paris.", store.NotifyDigest, "Europe/Paris"},
+		{"", "📬 Daily digest at 08:00 Europe/Paris", store.NotifyDigest, "Europe/Paris"},
+		{"weekly", "Usage: /digest", store.NotifyDigest, "Europe/Paris"},
+		{"off", "🔔 Daily digest off", store.NotifyInstant, "Europe/Paris"},
+		{"off", "Alerts are already sent right away.", store.NotifyInstant, "Europe/Paris"},
+		{"on", "📬 Daily digest on: alerts are collected and sent in one message at 08:00 Europe/Paris.", store.NotifyDigest, "Europe/Paris"},
+	} {
+		if got := handleDigestCommand(t.Context(), st, "1", tt.arg); !strings.HasPrefix(got, tt.reply) {
+			t.Errorf("/digest %s replied %q, want %q...", tt.arg, got, tt.reply)
+		}
+		sub, _ := st.GetSubscriber(t.Context(), "1")
+		if sub.NotifyMode != tt.mode || sub.Timezone != tt.zone {
+			t.Errorf("after /digest %s: mode %q zone %q, want %q %q", tt.arg, sub.NotifyMode, sub.Timezone, tt.mode, tt.zone)
+		}
+	}
+	// turning quiet hours off keeps the digest's time zone
+	handleQuietCommand(t.Context(), st, "1", "22:00-07:00 Europe/Paris")
+	handleQuietCommand(t.Context(), st, "1", "off")
+	if sub, _ := st.GetSubscriber(t.Context(), "1"); sub.Timezone != "Europe/Paris" {
+		t.Errorf("/quiet off cleared the digest's time zone: %q", sub.Timezone)
+	}
+	if got := handleDigestCommand(t.Context(), st, "404", "on"); !strings.Contains(got, "/start") {
+		t.Errorf("unknown chat got %q", got)
+	}
+}
+
+func TestDigestModeCollectsTheDaysAlerts(t *testing.T) {
+	sent := captureSends(t)
+	st := store.NewMemory()
+	sub := store.Subscriber{ChatID: "1", IsActive: true, NotifyMode: store.NotifyDigest}
+	st.UpsertSubscriber(t.Context(), sub)
+	morning := time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC)
+
+	DeliverOrHold(t.Context(), st, sub, "header\n", "Tête Rousse 2025-07-10\n", morning, sendMessageTo)
+	DeliverOrHold(t.Context(), st, sub, "header\n", "du Goûter 2025-07-11\n", morning.Add(12*time.Hour), sendMessageTo)
+	FlushOutbox(t.Context(), st, morning.Add(22*time.Hour+59*time.Minute))
+	if len(*sent) != 0 {
+		t.Fatalf("alerts sent before the digest hour: %q", *sent)
+	}
+
+	// one message at 08:00 the next day
+	FlushOutbox(t.Context(), st, morning.Add(23*time.Hour))
+	if want := "1: " + dailyDigestHeader + "Tête Rousse 2025-07-10\ndu Goûter 2025-07-11\n"; len(*sent) != 1 || (*sent)[0] != want {
+		t.Fatalf("digest %q, want %q", *sent, want)
+	}
+}
+
+func TestDailyDigestWaitsForTheQuietHoursEnd(t *testing.T) {
+	captureSends(t)
+	st := store.NewMemory()
+	sub := store.Subscriber{ChatID: "1", IsActive: true, NotifyMode: store.NotifyDigest, QuietFrom: "22:00", QuietTo: "09:30"}
+	st.UpsertSubscriber(t.Context(), sub)
+
+	DeliverOrHold(t.Context(), st, sub, "header\n", "held\n", time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC), sendMessageTo)
+	if q := queued(t, st); len(q) != 1 || q[0].ID != dailyDigestID("1") || !q[0].DeliverAfter.Equal(time.Date(2025, 7, 2, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("expected the digest at the quiet hours end, got %+v", q)
+	}
+}
+
+func TestDigestsAreRefusedToEmailOnlySubscribers(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true, Email: "alice@example.org", EmailOnly: true})
+
+	if got := handleDigestCommand(t.Context(), st, "1", "on"); got != emailOnlyNoDigest {
+		t.Errorf("/digest on replied %q", got)
+	}
+	if got := handleQuietCommand(t.Context(), st, "1", "22:00-07:00"); got != emailOnlyNoDigest {
+		t.Errorf("/quiet replied %q", got)
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "1"); sub.NotifyMode != "" || sub.QuietFrom != "" {
+		t.Errorf("digest settings saved for an email-only subscriber: %+v", sub)
+	}
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/AlexYaroshenko/montblanc/internal/featureflags"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+const flagUsage = "Usage:\n/flag set <name> <on|off|N%> [chat_id]\n/flag get <name>\n/flag list"
+
+// handleFlagCommand processes the admin "/flag set|get|list" command and returns the reply
+func handleFlagCommand(ctx context.Context, st store.Store, args []string) string {
+	if len(args) == 0 {
+		return flagUsage
+	}
+	switch args[0] {
+	case "set":
+		if len(args) != 3 && len(args) != 4 {
+			return flagUsage
+		}
+		chatID := ""
+		if len(args) == 4 {
+			if !digitsOnly(strings.TrimPrefix(args[3], "-")) {
+				return "Invalid chat_id: " + args[3]
+			}
+			chatID = args[3]
+		}
+		if err := featureflags.SetValue(ctx, st, args[1], chatID, args[2]); err != nil {
+			return "❌ " + err.Error()
+		}
+		if chatID != "" {
+			return fmt.Sprintf("✅ %s = %s for chat %s", args[1], args[2], chatID)
+		}
+		return fmt.Sprintf("✅ %s = %s", args[1], args[2])
+	case "get":
+		if len(args) != 2 {
+			return flagUsage
+		}
+		flags, err := featureflags.Load(ctx, st)
+		if err != nil {
+			return "Error loading flags"
+		}
+		return flags.Describe(args[1])
+	case "list":
+		flags, err := featureflags.Load(ctx, st)
+		if err != nil {
+			return "Error loading flags"
+		}
+		return flags.Describe("")
+	}
+	return flagUsage
+}
+
+// replyFlagCommand sends the result of an admin /flag command
+func replyFlagCommand(ctx context.Context, st store.Store, chatID string, txt string) {
+	_ = sendTo(ctx, chatID, handleFlagCommand(ctx, st, strings.Fields(txt)[1:]))
+}
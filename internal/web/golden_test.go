@@ -0,0 +1,57 @@
+package web
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+// update rewrites the golden files from the current output:
+// go test ./internal/web -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite testdata/*.golden.json")
+
+func TestGoldenAvailabilityV2(t *testing.T) {
+	withSnapshot(t)
+	at := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	UpdateState([]parser.Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-07-12": "Closed", "2025-07-10": "3", "2025-07-11": "Full", "2025-07-13": "1"}},
+		{Name: "du Goûter", Dates: map[string]string{"2025-07-11": "0", "2025-07-10": "12"}},
+	}, at)
+
+	var got []byte
+	// identical state, identical bytes
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handleAvailabilityAPIV2(rec, httptest.NewRequest(http.MethodGet, "/api/v2/availability", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if got != nil && !bytes.Equal(rec.Body.Bytes(), got) {
+			t.Fatalf("response changed between calls:\n%s\n%s", got, rec.Body.Bytes())
+		}
+		got = rec.Body.Bytes()
+	}
+	got = append(got, '\n')
+
+	golden := filepath.Join("testdata", "availability_v2.golden.json")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("availability mismatch\n got: %s\nwant: %s", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// handleGoneCommand processes "/gone <n> on|off", n being the subscription's number in /list,
+// and returns the reply
+func handleGoneCommand(ctx context.Context, st store.Store, chatID string, arg string) string {
+	const usage = "Usage: /gone <n> on to be told when a spot you were alerted about is booked out again, /gone <n> off to stop it (n as in /list)"
+	fields := strings.Fields(arg)
+	if len(fields) != 2 || (fields[1] != "on" && fields[1] != "off") {
+		return usage
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 1 {
+		return usage
+	}
+	qs, err := st.ListQueriesByChat(ctx, chatID)
+	if err != nil {
+		slog.Error("gone lookup failed", "chat_id", chatID, "error", err)
+		return "Could not update your settings, please try again later."
+	}
+	if n > len(qs) {
+		return fmt.Sprintf("You have no subscription number %d, see /list.", n)
+	}
+	sortQueries(qs)
+	q := qs[n-1]
+	on := fields[1] == "on"
+	if err := st.SetQueryNotifyOnGone(ctx, q.ID, on); errors.Is(err, store.ErrNotFound) {
+		return fmt.Sprintf("You have no subscription number %d, see /list.", n)
+	} else if err != nil {
+		slog.Error("gone update failed", "chat_id", chatID, "query_id", q.ID, "error", err)
+		return "Could not update your settings, please try again later."
+	}
+	if on {
+		return fmt.Sprintf("❌ Subscription %d: you'll be told when a spot you were alerted about is booked out again.", n)
+	}
+	return fmt.Sprintf("Subscription %d: no more messages when alerted spots are booked out.", n)
+}
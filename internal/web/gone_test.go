@@ -0,0 +1,40 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestHandleGoneCommand(t *testing.T) {
+	st := store.NewMemory()
+	created := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse", DateFrom: "2025-08-01", DateTo: "2025-08-31", CreatedAt: created})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "du Goûter", DateFrom: "2025-08-01", DateTo: "2025-08-31", CreatedAt: created.Add(time.Hour)})
+
+	for _, arg := range []string{"", "on", "1", "x on", "0 on", "1 maybe"} {
+		if got := handleGoneCommand(t.Context(), st, "1", arg); !strings.HasPrefix(got, "Usage:") {
+			t.Errorf("%q: expected the usage, got %q", arg, got)
+		}
+	}
+	if got := handleGoneCommand(t.Context(), st, "1", "3 on"); !strings.Contains(got, "no subscription number 3") {
+		t.Errorf("expected an unknown number rejected, got %q", got)
+	}
+
+	handleGoneCommand(t.Context(), st, "1", "2 on")
+	qs, _ := st.ListQueriesByChat(t.Context(), "1")
+	sortQueries(qs)
+	if qs[0].NotifyOnGone || !qs[1].NotifyOnGone {
+		t.Fatalf("expected only the second subscription opted in, got %+v", qs)
+	}
+	if list := formatQueryList(qs, "en"); !strings.Contains(list, "2. du Goûter: 2025-08-01 → 2025-08-31 · follow-up when gone") {
+		t.Errorf("expected the opt-in shown in /list, got %q", list)
+	}
+
+	handleGoneCommand(t.Context(), st, "1", "2 off")
+	if q, _ := st.GetQuery(t.Context(), qs[1].ID); q.NotifyOnGone {
+		t.Error("expected the follow-up turned off")
+	}
+}
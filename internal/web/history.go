@@ -0,0 +1,119 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+const (
+	// defaultHistoryLimit is the page size of /api/v1/history without ?limit=
+	defaultHistoryLimit = 100
+	// maxHistoryLimit caps ?limit=
+	maxHistoryLimit = 1000
+)
+
+// historyResponse is the /api/v1/history payload
+type historyResponse struct {
+	Snapshots []store.DateSnapshot `json:"snapshots"`
+	// NextCursor resumes after the last snapshot returned; with no snapshots it's the request's
+	// cursor, so polling with it picks up the snapshots stored since
+	NextCursor string `json:"next_cursor"`
+}
+
+// historyCursor is the opaque ?cursor= of a snapshot: its check time and ID
+func historyCursor(checkedAt time.Time, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", checkedAt.UnixNano(), id)))
+}
+
+// parseHistoryCursor reverses historyCursor; "" is the start of the history
+func parseHistoryCursor(cursor string) (time.Time, int64, error) {
+	if cursor == "" {
+		return time.Time{}, 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, errors.New("invalid cursor")
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	n, errN := strconv.ParseInt(nanos, 10, 64)
+	i, errI := strconv.ParseInt(id, 10, 64)
+	if !ok || errN != nil || errI != nil {
+		return time.Time{}, 0, errors.New("invalid cursor")
+	}
+	return time.Unix(0, n).UTC(), i, nil
+}
+
+// historyPage reads the page selected by the query of r
+func historyPage(r *http.Request) (store.DateSnapshotPage, error) {
+	q := r.URL.Query()
+	p := store.DateSnapshotPage{Refuge: q.Get("refuge"), Date: q.Get("date"), Limit: defaultHistoryLimit}
+	var err error
+	if p.After, p.AfterID, err = parseHistoryCursor(q.Get("cursor")); err != nil {
+		return p, err
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, errors.New("invalid limit")
+		}
+		p.Limit = min(n, maxHistoryLimit)
+	}
+	if p.Date != "" {
+		if _, err := time.Parse("2006-01-02", p.Date); err != nil {
+			return p, errors.New("invalid date, want YYYY-MM-DD")
+		}
+	}
+	if v := q.Get("transitions"); v != "" {
+		if p.Transitions, err = strconv.ParseBool(v); err != nil {
+			return p, errors.New("invalid transitions, want true or false")
+		}
+	}
+	return p, nil
+}
+
+// handleHistoryAPI serves a page of the availability history, oldest first. ?refuge= and ?date=
+// narrow it down, ?transitions=true keeps the snapshots where a date opened or filled up, and
+// ?cursor= (a next_cursor) resumes after the previous page; snapshots stored meanwhile are
+// picked up without repeating or skipping any.
+func (s *Server) handleHistoryAPI(w http.ResponseWriter, r *http.Request) {
+	if !allowRead(w, r) {
+		return
+	}
+	p, err := historyPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.storeAvailable(w) {
+		return
+	}
+	st := s.store
+	sns, err := st.PageDateSnapshots(r.Context(), p)
+	if err != nil {
+		slog.Error("history: failed to list snapshots", "error", err)
+		http.Error(w, "store unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	resp := historyResponse{Snapshots: sns, NextCursor: r.URL.Query().Get("cursor")}
+	if resp.Snapshots == nil {
+		resp.Snapshots = []store.DateSnapshot{}
+	}
+	if len(sns) > 0 {
+		last := sns[len(sns)-1]
+		resp.NextCursor = historyCursor(last.CheckedAt, last.ID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
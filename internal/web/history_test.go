@@ -0,0 +1,108 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestHistoryCursorRoundTrip(t *testing.T) {
+	at := time.Date(2025, 7, 1, 8, 0, 0, 123, time.UTC)
+	if got, id, err := parseHistoryCursor(historyCursor(at, 42)); err != nil || !got.Equal(at) || id != 42 {
+		t.Errorf("parseHistoryCursor = %v, %d, %v", got, id, err)
+	}
+	for _, bad := range []string{"!!", "bm9wZQ", historyCursor(at, 1)[:4]} {
+		if _, _, err := parseHistoryCursor(bad); err == nil {
+			t.Errorf("expected cursor %q rejected", bad)
+		}
+	}
+}
+
+func TestHistoryAPIResumesAcrossInserts(t *testing.T) {
+	st := store.NewMemory()
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	// saves a check of 2025-07-10 at both refuges, the same check time for both
+	check := func(min int, places int) {
+		checked := at.Add(time.Duration(min) * time.Minute)
+		st.SaveDateSnapshots(t.Context(), []store.DateSnapshot{
+			{Refuge: "du Goûter", Date: "2025-07-10", Places: places, CheckedAt: checked},
+			{Refuge: "Tête Rousse", Date: "2025-07-10", Places: places + 1, CheckedAt: checked},
+		})
+	}
+	check(0, 0)
+	check(1, 2)
+
+	get := func(query string) historyResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		NewServer(st).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/history?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", query, rec.Code, rec.Body.String())
+		}
+		var resp historyResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// pages of 3 split the snapshots of a check; a new check lands after every page
+	seen := map[int64]bool{}
+	cursor := ""
+	for page := 0; page < 10; page++ {
+		resp := get("limit=3&cursor=" + url.QueryEscape(cursor))
+		if len(resp.Snapshots) > 3 {
+			t.Fatalf("page %d has %d snapshots", page, len(resp.Snapshots))
+		}
+		for _, sn := range resp.Snapshots {
+			if seen[sn.ID] {
+				t.Errorf("snapshot %+v returned twice", sn)
+			}
+			seen[sn.ID] = true
+		}
+		if len(resp.Snapshots) == 0 {
+			if resp.NextCursor != cursor {
+				t.Errorf("expected an empty page to keep cursor %q, got %q", cursor, resp.NextCursor)
+			}
+			break
+		}
+		cursor = resp.NextCursor
+		if page < 3 {
+			check(2+page, 3+page)
+		}
+	}
+	all, _ := st.PageDateSnapshots(t.Context(), store.DateSnapshotPage{Limit: maxHistoryLimit})
+	if len(seen) != len(all) || len(seen) != 10 {
+		t.Errorf("paged through %d of %d snapshots, want 10", len(seen), len(all))
+	}
+
+	// du Goûter's date opened at the second check, then only went up
+	resp := get("refuge=" + url.QueryEscape("du Goûter") + "&transitions=true")
+	if len(resp.Snapshots) != 2 || resp.Snapshots[1].Places != 2 || resp.Snapshots[1].Previous != 0 {
+		t.Errorf("unexpected du Goûter transitions %+v", resp.Snapshots)
+	}
+	if resp := get("date=2025-07-11"); len(resp.Snapshots) != 0 || resp.NextCursor != "" {
+		t.Errorf("expected no 2025-07-11 snapshots, got %+v", resp)
+	}
+}
+
+func TestHistoryAPIRejectsBadQueries(t *testing.T) {
+	st := store.NewMemory()
+	for _, query := range []string{"cursor=nope", "limit=0", "limit=x", "date=10-07-2025", "transitions=maybe"} {
+		rec := httptest.NewRecorder()
+		NewServer(st).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/history?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET ?%s: %d, want 400", query, rec.Code)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/history?limit=5000", nil)
+	if p, err := historyPage(r); err != nil || p.Limit != maxHistoryLimit {
+		t.Errorf("historyPage = %+v, %v; want the limit capped at %d", p, err, maxHistoryLimit)
+	}
+}
@@ -0,0 +1,279 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// importColumns is the expected CSV layout of a bulk query import; a header row is optional, and
+// so are the trailing label and pax columns
+var importColumns = []string{"chat_id", "refuge", "date_from", "date_to", "min_places", "label", "pax"}
+
+// maxImportSize caps an uploaded import file
+const maxImportSize = 1 << 20
+
+// maxLabelLen caps the free-text label of an imported query
+const maxLabelLen = 100
+
+var chatIDPattern = regexp.MustCompile(`^-?\d+$`)
+
+// importRow is a validated CSV row
+type importRow struct {
+	Line  int
+	Query store.Query
+}
+
+// importReject is a CSV row that could not be imported
+type importReject struct {
+	Line   int
+	Reason string
+	Fields []string
+}
+
+// importSummary is the outcome of a bulk import
+type importSummary struct {
+	Created     int // queries added
+	Duplicates  int // rows matching an existing query, skipped
+	Subscribers int // subscribers created
+	Rejects     []importReject
+}
+
+// requireAdminToken protects admin web pages with HTTP basic auth against ADMIN_TOKEN (any user name);
+// without ADMIN_TOKEN the pages don't exist
+func requireAdminToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := settings.AdminToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		_, pass, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(pass), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// parseImportCSV reads an import file, validating every row; a malformed CSV fails as a whole
+func parseImportCSV(r io.Reader) ([]importRow, []importReject, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	allowedRefuge := map[string]bool{"*": true}
+	for _, rc := range parser.Refuges() {
+		allowedRefuge[rc.Name] = true
+	}
+
+	var (
+		rows    []importRow
+		rejects []importReject
+	)
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if first && strings.EqualFold(strings.TrimSpace(rec[0]), importColumns[0]) {
+			continue
+		}
+		q, err := importQuery(rec, allowedRefuge)
+		if err != nil {
+			rejects = append(rejects, importReject{Line: line, Reason: err.Error(), Fields: rec})
+			continue
+		}
+		rows = append(rows, importRow{Line: line, Query: q})
+	}
+	return rows, rejects, nil
+}
+
+// importQuery validates one CSV record the same way the subscribe form does
+func importQuery(rec []string, allowedRefuge map[string]bool) (store.Query, error) {
+	if len(rec) < len(importColumns)-2 || len(rec) > len(importColumns) {
+		return store.Query{}, fmt.Errorf("expected %d columns (%s), got %d", len(importColumns), strings.Join(importColumns, ", "), len(rec))
+	}
+	field := func(i int) string {
+		if i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	q := store.Query{ChatID: field(0), Refuge: field(1), DateFrom: field(2), DateTo: field(3), Label: field(5)}
+	if !chatIDPattern.MatchString(q.ChatID) {
+		return store.Query{}, fmt.Errorf("invalid chat_id %q", q.ChatID)
+	}
+	if !allowedRefuge[q.Refuge] {
+		return store.Query{}, fmt.Errorf("unsupported refuge %q", q.Refuge)
+	}
+	df, err1 := time.Parse("2006-01-02", q.DateFrom)
+	dt, err2 := time.Parse("2006-01-02", q.DateTo)
+	if err1 != nil || err2 != nil {
+		return store.Query{}, fmt.Errorf("invalid date format (expected YYYY-MM-DD)")
+	}
+	if df.After(dt) {
+		return store.Query{}, fmt.Errorf("date_from must be before or equal to date_to")
+	}
+	if v := field(4); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxMinPlaces {
+			return store.Query{}, fmt.Errorf("min_places must be a number between 0 and %d", maxMinPlaces)
+		}
+		q.MinPlaces = n
+	}
+	if v := field(6); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxMinPlaces {
+			return store.Query{}, fmt.Errorf("pax must be a group size between 0 and %d", maxMinPlaces)
+		}
+		q.Pax = n
+	}
+	if len(q.Label) > maxLabelLen {
+		return store.Query{}, fmt.Errorf("label longer than %d characters", maxLabelLen)
+	}
+	return q, nil
+}
+
+// sameQuery reports whether two queries watch the same thing (the label is ignored)
+func sameQuery(a store.Query, b store.Query) bool {
+	return a.ChatID == b.ChatID && a.Refuge == b.Refuge && a.DateFrom == b.DateFrom && a.DateTo == b.DateTo &&
+		a.MinPlaces == b.MinPlaces && a.Weekdays == b.Weekdays && a.Pax == b.Pax
+}
+
+// importQueries stores each row on its own so a failing row doesn't undo the others. Unknown chats
+// become subscribers and rows matching an existing query are skipped, so re-uploading a file is a no-op.
+func importQueries(ctx context.Context, st store.Store, rows []importRow, now time.Time) importSummary {
+	var sum importSummary
+	reject := func(row importRow, err error) {
+		q := row.Query
+		sum.Rejects = append(sum.Rejects, importReject{Line: row.Line, Reason: err.Error(),
+			Fields: []string{q.ChatID, q.Refuge, q.DateFrom, q.DateTo, strconv.Itoa(q.MinPlaces), q.Label, strconv.Itoa(q.Pax)}})
+	}
+rows:
+	for _, row := range rows {
+		q := row.Query
+		if _, err := st.GetSubscriber(ctx, q.ChatID); errors.Is(err, store.ErrNotFound) {
+			sub := store.Subscriber{ChatID: q.ChatID, Language: "en", IsActive: true, ConsentAt: now.UTC(), ConsentSource: store.ConsentImport}
+			if err := st.UpsertSubscriber(ctx, sub); err != nil {
+				reject(row, fmt.Errorf("failed to create subscriber: %v", err))
+				continue
+			}
+			sum.Subscribers++
+		} else if err != nil {
+			reject(row, fmt.Errorf("failed to load subscriber: %v", err))
+			continue
+		}
+		existing, err := st.ListQueriesByChat(ctx, q.ChatID)
+		if err != nil {
+			reject(row, fmt.Errorf("failed to load queries: %v", err))
+			continue
+		}
+		for _, e := range existing {
+			if sameQuery(e, q) {
+				sum.Duplicates++
+				continue rows
+			}
+		}
+		if _, err := st.AddQuery(ctx, q); errors.Is(err, store.ErrPlanLimit) {
+			reject(row, fmt.Errorf("plan limit reached: %v (/plan %s pro lifts it)", err, q.ChatID))
+			continue
+		} else if err != nil {
+			reject(row, fmt.Errorf("failed to add query: %v", err))
+			continue
+		}
+		sum.Created++
+	}
+	return sum
+}
+
+// rejectsCSV renders the rejected rows (line, reason, then the original fields) as CSV
+func rejectsCSV(rejects []importReject) []byte {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(append([]string{"line", "reason"}, importColumns...))
+	for _, rj := range rejects {
+		cw.Write(append([]string{strconv.Itoa(rj.Line), rj.Reason}, rj.Fields...))
+	}
+	cw.Flush()
+	return buf.Bytes()
+}
+
+var importTmpl = template.Must(template.New("import").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>Bulk query import</title></head>
+<body style="font-family:sans-serif; max-width:760px; margin:24px auto;">
+<h1>Bulk query import</h1>
+{{if .Done}}
+<p>{{.Summary.Created}} queries created, {{.Summary.Duplicates}} already existed, {{.Summary.Subscribers}} subscribers created, {{len .Summary.Rejects}} rows rejected.</p>
+{{if .Summary.Rejects}}
+<table border="1" cellpadding="4" style="border-collapse:collapse;">
+<tr><th>Line</th><th>Reason</th></tr>
+{{range .Summary.Rejects}}<tr><td>{{.Line}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+<p><a download="import-errors.csv" href="{{.ErrorsCSV}}">Download rejected rows (CSV)</a></p>
+{{end}}
+{{end}}
+<form method="post" enctype="multipart/form-data">
+<p>CSV columns: chat_id, refuge, date_from, date_to, min_places, label, pax. Refuge is a refuge name or * for any; pax is the group size availability is checked for (empty: the default).</p>
+<input type="file" name="file" accept=".csv,text/csv" required>
+<button type="submit">Import</button>
+</form>
+</body></html>
+`))
+
+// handleQueryImport serves the admin import form (GET) and imports an uploaded CSV (POST)
+func (s *Server) handleQueryImport(w http.ResponseWriter, r *http.Request) {
+	view := struct {
+		Done      bool
+		Summary   importSummary
+		ErrorsCSV template.URL
+	}{}
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "missing CSV file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		rows, rejects, err := parseImportCSV(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !s.storeAvailable(w) {
+			return
+		}
+
+		view.Done = true
+		view.Summary = importQueries(r.Context(), s.store, rows, time.Now())
+		view.Summary.Rejects = append(rejects, view.Summary.Rejects...)
+		view.ErrorsCSV = template.URL("data:text/csv;base64," + base64.StdEncoding.EncodeToString(rejectsCSV(view.Summary.Rejects)))
+		slog.Info("query import", "created", view.Summary.Created, "duplicates", view.Summary.Duplicates,
+			"subscribers", view.Summary.Subscribers, "rejected", len(view.Summary.Rejects))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := importTmpl.Execute(w, view); err != nil {
+		slog.Error("import template error", "error", err)
+	}
+}
@@ -0,0 +1,164 @@
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+const mixedImport = `chat_id,refuge,date_from,date_to,min_places,label
+101,Tête Rousse,2025-07-01,2025-07-10,2,Alice
+102,*,2025-08-01,2025-08-05,,Bob
+abc,Tête Rousse,2025-07-01,2025-07-10,2,Bad id
+103,Cosmiques,2025-07-01,2025-07-10,1,Unknown hut
+104,du Goûter,2025-07-10,2025-07-01,1,Reversed
+105,du Goûter,2025-07-01,2025-07-02,99,Too many
+106,du Goûter,2025-07-01
+101,du Goûter,2025-07-01,2025-07-03,0
+`
+
+func TestParseImportCSV(t *testing.T) {
+	rows, rejects, err := parseImportCSV(strings.NewReader(mixedImport))
+	if err != nil {
+		t.Fatalf("parseImportCSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 valid rows, got %+v", rows)
+	}
+	if q := rows[0].Query; rows[0].Line != 2 || q.ChatID != "101" || q.Refuge != "Tête Rousse" || q.MinPlaces != 2 || q.Label != "Alice" {
+		t.Errorf("unexpected first row %+v", rows[0])
+	}
+	// the label column may be left out
+	if q := rows[2].Query; rows[2].Line != 9 || q.Label != "" || q.Refuge != "du Goûter" {
+		t.Errorf("unexpected last row %+v", rows[2])
+	}
+	wantLines := []int{4, 5, 6, 7, 8}
+	wantReasons := []string{"invalid chat_id", "unsupported refuge", "date_from must be before", "min_places must be", "expected 7 columns"}
+	if len(rejects) != len(wantLines) {
+		t.Fatalf("expected %d rejects, got %+v", len(wantLines), rejects)
+	}
+	for i, rj := range rejects {
+		if rj.Line != wantLines[i] || !strings.Contains(rj.Reason, wantReasons[i]) {
+			t.Errorf("reject %d: got line %d %q, want line %d containing %q", i, rj.Line, rj.Reason, wantLines[i], wantReasons[i])
+		}
+	}
+
+	if _, _, err := parseImportCSV(strings.NewReader("101,\"Tête Rousse,2025-07-01\n")); err == nil {
+		t.Error("expected error for malformed CSV")
+	}
+}
+
+func TestParseImportCSVPax(t *testing.T) {
+	rows, rejects, err := parseImportCSV(strings.NewReader("101,Tête Rousse,2025-07-01,2025-07-10,3,Alice,3\n102,*,2025-07-01,2025-07-10,,,big\n"))
+	if err != nil {
+		t.Fatalf("parseImportCSV: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Query.Pax != 3 {
+		t.Errorf("expected a row with pax 3, got %+v", rows)
+	}
+	if len(rejects) != 1 || !strings.Contains(rejects[0].Reason, "pax must be") {
+		t.Errorf("expected the bad pax rejected, got %+v", rejects)
+	}
+}
+
+func TestImportQueriesIdempotent(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "101", Language: "de", IsActive: true, ConsentSource: store.ConsentTelegram})
+	rows, _, err := parseImportCSV(strings.NewReader(mixedImport))
+	if err != nil {
+		t.Fatalf("parseImportCSV: %v", err)
+	}
+	now := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	sum := importQueries(t.Context(), st, rows, now)
+	if sum.Created != 3 || sum.Duplicates != 0 || sum.Subscribers != 1 || len(sum.Rejects) != 0 {
+		t.Errorf("unexpected first import %+v", sum)
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "102"); !sub.IsActive || sub.ConsentSource != store.ConsentImport || !sub.ConsentAt.Equal(now) {
+		t.Errorf("unexpected imported subscriber %+v", sub)
+	}
+	// existing subscribers are left as they were
+	if sub, _ := st.GetSubscriber(t.Context(), "101"); sub.Language != "de" || sub.ConsentSource != store.ConsentTelegram {
+		t.Errorf("existing subscriber changed: %+v", sub)
+	}
+
+	sum = importQueries(t.Context(), st, rows, now)
+	if sum.Created != 0 || sum.Duplicates != 3 || sum.Subscribers != 0 {
+		t.Errorf("expected re-upload to be a no-op, got %+v", sum)
+	}
+	if all, _ := st.ListAllQueries(t.Context()); len(all) != 3 {
+		t.Errorf("expected 3 queries after re-upload, got %d", len(all))
+	}
+}
+
+func TestQueryImportHandler(t *testing.T) {
+	st := store.NewMemory()
+	useSettings(t, func(s *Settings) { s.AdminToken = "t0ken" })
+
+	upload := func(token string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "clients.csv")
+		fw.Write([]byte(mixedImport))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/admin/queries/import", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if token != "" {
+			req.SetBasicAuth("admin", token)
+		}
+		rec := httptest.NewRecorder()
+		NewServer(st).Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := upload(""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without credentials, got %d", rec.Code)
+	}
+	if rec := upload("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for wrong token, got %d", rec.Code)
+	}
+
+	rec := upload("t0ken")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	page := rec.Body.String()
+	if !strings.Contains(page, "3 queries created, 0 already existed, 2 subscribers created, 5 rows rejected.") {
+		t.Errorf("unexpected summary page:\n%s", page)
+	}
+	// the rejects are offered as a CSV download
+	const prefix = `href="data:text/csv;base64,`
+	i := strings.Index(page, prefix)
+	if i < 0 {
+		t.Fatalf("no error CSV link in page:\n%s", page)
+	}
+	encoded := page[i+len(prefix):]
+	encoded = encoded[:strings.IndexByte(encoded, '"')]
+	csvData, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("failed to decode error CSV: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(csvData)), "\n"); len(lines) != 6 || !strings.HasPrefix(lines[1], `4,"invalid chat_id`) {
+		t.Errorf("unexpected error CSV:\n%s", csvData)
+	}
+
+	if rec := upload("t0ken"); !strings.Contains(rec.Body.String(), "0 queries created, 3 already existed") {
+		t.Errorf("expected idempotent re-upload, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestQueryImportDisabledWithoutToken(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.AdminToken = "" })
+	rec := httptest.NewRecorder()
+	NewServer(nil).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/queries/import", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without ADMIN_TOKEN, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// handleLanguageCommand processes "/language [code]" and returns the reply. A chosen language is
+// locked: signing up again from Telegram or the web form doesn't switch it back.
+func handleLanguageCommand(ctx context.Context, st store.Store, chatID string, arg string) string {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "You have no subscription yet. Send /start to subscribe."
+	}
+	if err != nil {
+		slog.Error("language lookup failed", "chat_id", chatID, "error", err)
+		return "Could not update your settings, please try again later."
+	}
+	lang := strings.ToLower(arg)
+	if lang == "" || i18n.Supported(lang) != lang {
+		current := i18n.Supported(sub.Language)
+		return fmt.Sprintf(i18n.T(current, "language_usage"), strings.ToUpper(current))
+	}
+	sub.SetLanguage(lang, true)
+	if err := st.UpsertSubscriber(ctx, sub); err != nil {
+		slog.Error("language update failed", "chat_id", chatID, "error", err)
+		return "Could not update your settings, please try again later."
+	}
+	return i18n.T(lang, "language_set")
+}
+
+// languageOptions lists the languages alerts can be sent in for the subscribe form
+func languageOptions() []refugeOption {
+	var opts []refugeOption
+	for _, lang := range i18n.Languages() {
+		opts = append(opts, refugeOption{Value: lang, Label: strings.ToUpper(lang)})
+	}
+	return opts
+}
@@ -0,0 +1,129 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// languageSteps signs chat 7 up through the web form and Telegram's /start
+type languageSteps struct {
+	t      *testing.T
+	st     *store.MemoryStore
+	admins *[]string // messages to the admin chat
+}
+
+func newLanguageSteps(t *testing.T) languageSteps {
+	var admins []string
+	useSettings(t, func(s *Settings) {
+		s.DeepLinkSecret, s.AdminChatIDs = "test", []string{"admin"}
+		s.Notifier = notify.Func(func(_ context.Context, chatID string, message string) error {
+			if chatID == "admin" {
+				admins = append(admins, message)
+			}
+			return nil
+		})
+	})
+	st := store.NewMemory()
+	return languageSteps{t: t, st: st, admins: &admins}
+}
+
+// web submits the form, picking language unless it's "", from a browser in browserLang, and
+// opens the deep link
+func (l languageSteps) web(language string, browserLang string) {
+	l.t.Helper()
+	form := url.Values{"refuge": {"*"}, "date_from": {"2025-07-01"}, "date_to": {"2025-07-31"}, "language": {language}}
+	req := httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept-Language", browserLang)
+	rec := httptest.NewRecorder()
+	NewServer(l.st).handleSubscribe(rec, req)
+	command := regexp.MustCompile(`/start ps_[^"]+`).FindString(rec.Body.String())
+	if rec.Code != http.StatusOK || command == "" {
+		l.t.Fatalf("expected a deep link, got %d", rec.Code)
+	}
+	l.message(command, "en")
+}
+
+// message sends text to the bot from Telegram set to telegramLang
+func (l languageSteps) message(text string, telegramLang string) {
+	ProcessUpdate(l.t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 7}, From: &telegram.UserIn{ID: 7, LanguageCode: telegramLang}, Text: text}}, l.st)
+}
+
+// expect checks the language of chat 7
+func (l languageSteps) expect(lang string, locked bool) {
+	l.t.Helper()
+	sub, err := l.st.GetSubscriber(l.t.Context(), "7")
+	if err != nil || sub.Language != lang || sub.LanguageLocked != locked {
+		l.t.Errorf("expected language %s (locked %t), got %q (locked %t, %v)", lang, locked, sub.Language, sub.LanguageLocked, err)
+	}
+}
+
+func TestLanguageChosenOnTheWebSurvivesTelegram(t *testing.T) {
+	l := newLanguageSteps(t)
+	l.web("de", "en")
+	l.expect("de", true)
+	l.message("/start", "en")
+	l.expect("de", true)
+	// the browser's language is auto-detected too
+	l.web("", "fr")
+	l.expect("de", true)
+	if warned := strings.Join(*l.admins, "\n"); !strings.Contains(warned, "in fr; keeping the chosen de") {
+		t.Errorf("expected admins warned about the conflicting language, got %q", warned)
+	}
+}
+
+func TestLanguageDetectedByTelegramThenChosenOnTheWeb(t *testing.T) {
+	l := newLanguageSteps(t)
+	l.message("/start", "de")
+	l.expect("de", false)
+	// auto-detected languages replace each other until one is chosen
+	l.web("", "en")
+	l.expect("en", false)
+	l.web("it", "en")
+	l.expect("it", true)
+	l.message("/start", "de")
+	l.expect("it", true)
+}
+
+func TestLanguageCommand(t *testing.T) {
+	l := newLanguageSteps(t)
+	if reply := handleLanguageCommand(t.Context(), l.st, "7", "de"); !strings.Contains(reply, "/start") {
+		t.Errorf("expected unknown chats sent to /start, got %q", reply)
+	}
+	l.message("/start", "es")
+	if reply := handleLanguageCommand(t.Context(), l.st, "7", "xx"); !strings.Contains(reply, "ES") {
+		t.Errorf("expected the current language in the usage, got %q", reply)
+	}
+	l.expect("es", false)
+	l.message("/language FR", "es")
+	l.expect("fr", true)
+	l.message("/start", "es")
+	l.expect("fr", true)
+	if sub, _ := l.st.GetSubscriber(t.Context(), "7"); !sub.IsActive {
+		t.Error("expected the chat still subscribed")
+	}
+}
+
+func TestSlavicLanguages(t *testing.T) {
+	l := newLanguageSteps(t)
+	l.web("cs", "en")
+	l.expect("cs", true)
+	l.message("/language ru", "cs")
+	l.expect("ru", true)
+	l.message("/start", "pl")
+	l.expect("ru", true)
+	rec := httptest.NewRecorder()
+	NewServer(nil).handleHome(rec, httptest.NewRequest(http.MethodGet, "/?lang=pl", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `<a href="?lang=cs">CS</a>`) || !strings.Contains(body, `<option value="ru">RU</option>`) || !strings.Contains(body, "Wolne miejsca") {
+		t.Errorf("expected the Polish page linking and offering the new languages")
+	}
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// serverState is where a Server is in its life: new, then started, then stopped, once each
+type serverState int
+
+const (
+	serverNew serverState = iota
+	serverStarted
+	serverStopped
+)
+
+var (
+	// ErrServerStarted is returned by Start on a server already started
+	ErrServerStarted = errors.New("web: server already started")
+	// ErrServerNotStarted is returned by Shutdown on a server never started
+	ErrServerNotStarted = errors.New("web: server not started")
+	// ErrServerStopped is returned by Start and Shutdown on a server already shut down
+	ErrServerStopped = errors.New("web: server already stopped")
+)
+
+// Start listens on addr and serves the site in the background, pinging KEEPALIVE_URL if set,
+// until Shutdown. A server starts once; create another one to serve again.
+func (s *Server) Start(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch s.state {
+	case serverStarted:
+		return ErrServerStarted
+	case serverStopped:
+		return ErrServerStopped
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.http = &http.Server{
+		Handler:      s.mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	s.addr, s.cancel, s.state = ln.Addr().String(), cancel, serverStarted
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		slog.Info("starting web server", "addr", s.addr)
+		if err := s.http.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("server error", "error", err)
+		}
+	}()
+	if baseURL := strings.TrimRight(settings.KeepAliveURL, "/"); baseURL != "" {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			keepAlive(ctx, baseURL, settings.KeepAliveInterval)
+		}()
+	}
+	return nil
+}
+
+// Addr returns the address a started server listens on, e.g. the port picked for ":0"
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// Shutdown stops the keep-alive pings and shuts the server down gracefully, waiting for the
+// requests in flight until ctx is done. Its goroutines are gone when it returns.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	switch s.state {
+	case serverNew:
+		s.mu.Unlock()
+		return ErrServerNotStarted
+	case serverStopped:
+		s.mu.Unlock()
+		return ErrServerStopped
+	}
+	s.state = serverStopped
+	s.mu.Unlock()
+
+	s.cancel()
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		// past the grace period: drop the remaining connections
+		s.http.Close()
+	}
+	s.wg.Wait()
+	return err
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServerLifecycle(t *testing.T) {
+	s := NewServer(nil)
+	if err := s.Shutdown(t.Context()); !errors.Is(err, ErrServerNotStarted) {
+		t.Errorf("Shutdown before Start: %v, want ErrServerNotStarted", err)
+	}
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := s.Start("127.0.0.1:0"); !errors.Is(err, ErrServerStarted) {
+		t.Errorf("second Start: %v, want ErrServerStarted", err)
+	}
+	client := &http.Client{}
+	resp, err := client.Get("http://" + s.Addr() + "/health")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /health: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	client.CloseIdleConnections()
+
+	if err := s.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := s.Shutdown(t.Context()); !errors.Is(err, ErrServerStopped) {
+		t.Errorf("second Shutdown: %v, want ErrServerStopped", err)
+	}
+	if err := s.Start("127.0.0.1:0"); !errors.Is(err, ErrServerStopped) {
+		t.Errorf("Start after Shutdown: %v, want ErrServerStopped", err)
+	}
+}
+
+func TestServerShutdownLeavesNoGoroutines(t *testing.T) {
+	var pings atomic.Int32
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+	}))
+	defer health.Close()
+	useSettings(t, func(s *Settings) {
+		s.KeepAliveURL, s.KeepAliveInterval = health.URL, time.Millisecond
+	})
+
+	before := runtime.NumGoroutine()
+	for range 5 {
+		s := NewServer(nil)
+		if err := s.Start("127.0.0.1:0"); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		// the keep-alive is running
+		for n := pings.Load(); pings.Load() < n+2; {
+			time.Sleep(time.Millisecond)
+		}
+		if err := s.Shutdown(t.Context()); err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	}
+	n := pings.Load()
+	// connection goroutines of the health server wind down on their own
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		buf := make([]byte, 1<<16)
+		t.Errorf("%d goroutines before, %d after 5 servers:\n%s", before, after, buf[:runtime.Stack(buf, true)])
+	}
+	if pings.Load() != n {
+		t.Error("keep-alive pings continue after Shutdown")
+	}
+}
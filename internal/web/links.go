@@ -0,0 +1,102 @@
+package web
+
+import (
+	"expvar"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+// baseURL is the public site root (BASE_URL)
+func baseURL() string {
+	return strings.TrimRight(settings.BaseURL, "/")
+}
+
+// botLink is the t.me link opening the bot with /start payload
+func botLink(payload string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", settings.BotUsername, payload)
+}
+
+// accents folds the accented letters found in refuge names
+var accents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"ç", "c",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "ö", "o", "õ", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ÿ", "y",
+)
+
+// RefugeSlug returns the URL slug of a refuge name, e.g. "tete-rousse" for "Tête Rousse".
+// Letters without an ASCII form are kept (and percent-encoded in URLs).
+func RefugeSlug(name string) string {
+	s := accents.Replace(strings.ToLower(name))
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// RefugePageURL links to the refuge's page in lang, showing date (YYYY-MM-DD, optional);
+// source is recorded as utm_source when the link is followed
+func RefugePageURL(lang string, refuge string, date string, source string) string {
+	q := url.Values{}
+	if date != "" {
+		q.Set("date", date)
+	}
+	if source != "" {
+		q.Set("utm_source", source)
+	}
+	u := baseURL() + "/" + url.PathEscape(i18n.Supported(lang)) + "/refuge/" + url.PathEscape(RefugeSlug(refuge))
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// DateLink renders date as a link to the refuge page in lang, for Telegram messages sent with parse_mode HTML
+func DateLink(refuge string, date string, lang string) string {
+	return `<a href="` + html.EscapeString(RefugePageURL(lang, refuge, date, "telegram")) + `">` + html.EscapeString(date) + `</a>`
+}
+
+// linkClicks counts followed refuge page links by utm_source (exposed on /debug/vars)
+var linkClicks = expvar.NewMap("refuge_link_clicks")
+
+// handleRefugePage serves /<lang>/refuge/{slug}: the home page in lang, with the table starting at ?date
+func (s *Server) handleRefugePage(w http.ResponseWriter, r *http.Request) {
+	lang := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+	known := false
+	for _, rc := range parser.Refuges() {
+		if RefugeSlug(rc.Name) == r.PathValue("slug") {
+			known = true
+			break
+		}
+	}
+	if !known {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	if src := q.Get("utm_source"); src != "" {
+		linkClicks.Add(src, 1)
+	}
+	q.Set("lang", lang)
+	r.URL.RawQuery = q.Encode()
+	s.handleHome(w, r)
+}
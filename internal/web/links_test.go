@@ -0,0 +1,65 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+)
+
+func TestRefugeSlug(t *testing.T) {
+	for name, want := range map[string]string{
+		"Tête Rousse":           "tete-rousse",
+		"du Goûter":             "du-gouter",
+		"Refuge du Nid d'Aigle": "refuge-du-nid-d-aigle",
+		"  Cosmiques (3613m) ":  "cosmiques-3613m",
+		"Hütte Ørsted":          "hutte-ørsted",
+	} {
+		if got := RefugeSlug(name); got != want {
+			t.Errorf("RefugeSlug(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRefugePageURL(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.BaseURL = "https://example.org/" })
+	tests := []struct {
+		lang, refuge, date, source, want string
+	}{
+		{"fr", "Tête Rousse", "2025-08-12", "telegram", "https://example.org/fr/refuge/tete-rousse?date=2025-08-12&utm_source=telegram"},
+		{"de-DE", "du Goûter", "", "", "https://example.org/de/refuge/du-gouter"},
+		{"xx", "Hütte Ørsted", "2025-08-12", "a b&c", "https://example.org/en/refuge/hutte-%C3%B8rsted?date=2025-08-12&utm_source=a+b%26c"},
+	}
+	for _, tt := range tests {
+		if got := RefugePageURL(tt.lang, tt.refuge, tt.date, tt.source); got != tt.want {
+			t.Errorf("RefugePageURL(%q, %q) = %q, want %q", tt.lang, tt.refuge, got, tt.want)
+		}
+	}
+	want := `<a href="https://example.org/it/refuge/du-gouter?date=2025-08-12&amp;utm_source=telegram">2025-08-12</a>`
+	if got := DateLink("du Goûter", "2025-08-12", "it"); got != want {
+		t.Errorf("DateLink = %q, want %q", got, want)
+	}
+}
+
+func TestRefugePageRoute(t *testing.T) {
+	withSnapshot(t)
+	h := NewServer(nil).Handler()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	before := linkClicks.Get("telegram")
+	rec := get("/fr/refuge/tete-rousse?date=2025-08-12&utm_source=telegram")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), i18n.T("fr", "title")) {
+		t.Errorf("expected the French page, got %d", rec.Code)
+	}
+	if after := linkClicks.Get("telegram"); after == nil || (before != nil && after.String() == before.String()) {
+		t.Error("expected the click to be counted")
+	}
+	if rec := get("/fr/refuge/cosmiques"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown refuge, got %d", rec.Code)
+	}
+}
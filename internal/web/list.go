@@ -0,0 +1,70 @@
+package web
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// sortQueries orders queries by creation time so /list numbering is stable
+func sortQueries(qs []store.Query) {
+	sort.SliceStable(qs, func(i, j int) bool {
+		if !qs[i].CreatedAt.Equal(qs[j].CreatedAt) {
+			return qs[i].CreatedAt.Before(qs[j].CreatedAt)
+		}
+		return qs[i].ID < qs[j].ID
+	})
+}
+
+// formatQueryList renders the numbered /list reply
+func formatQueryList(qs []store.Query, lang string) string {
+	if len(qs) == 0 {
+		return i18n.T(lang, "list_empty")
+	}
+	sortQueries(qs)
+	var b strings.Builder
+	b.WriteString(i18n.T(lang, "list_title") + "\n")
+	for i, q := range qs {
+		b.WriteString(fmt.Sprintf("%d. %s\n", i+1, telegram.EscapeHTML(formatQuery(q, lang))))
+	}
+	return b.String()
+}
+
+// formatQuery renders one query as "refuge: from → to" with its filters
+func formatQuery(q store.Query, lang string) string {
+	refuge := q.Refuge
+	if refuge == "*" {
+		refuge = i18n.T(lang, "any_refuge")
+	}
+	from, to := q.DateFrom, q.DateTo
+	if from == "" {
+		from = "…"
+	}
+	if to == "" {
+		to = "…"
+	}
+	line := fmt.Sprintf("%s: %s → %s", refuge, from, to)
+	if q.MinPlaces > 0 {
+		line += fmt.Sprintf(" (≥%d %s)", q.MinPlaces, i18n.T(lang, "places"))
+	}
+	if q.Weekdays != 0 {
+		line += " (" + formatWeekdays(q.Weekdays, lang) + ")"
+	}
+	if q.Pax > 0 {
+		line += " · " + fmt.Sprintf(i18n.T(lang, "list_pax"), q.Pax)
+	}
+	if q.NotifyOnGone {
+		line += " · " + i18n.T(lang, "list_gone")
+	}
+	if q.OneShot {
+		line += " · " + i18n.T(lang, "list_oneshot")
+	}
+	if q.Completed() {
+		line += " · " + i18n.T(lang, "list_completed")
+	}
+	return line
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// rearmCallbackPrefix starts the callback data of the button re-arming a completed one-shot
+// query: rearm:<query ID>
+const rearmCallbackPrefix = "rearm:"
+
+// OneShotDone is the message telling that the one-shot query q has alerted and is now off, with
+// the button re-arming it
+func OneShotDone(q store.Query, lang string) (string, [][]telegram.InlineButton) {
+	text := fmt.Sprintf(i18n.T(lang, "oneshot_done"), telegram.EscapeHTML(formatQuery(q, lang)))
+	return text, [][]telegram.InlineButton{{{Text: i18n.T(lang, "rearm_button"), CallbackData: rearmCallbackPrefix + q.ID}}}
+}
+
+// completeOneShot marks the one-shot query q completed after its first alert and tells chatID
+func completeOneShot(ctx context.Context, st store.Store, chatID string, q store.Query, lang string) {
+	if err := st.SetQueryStatus(ctx, q.ID, store.QueryCompleted); err != nil {
+		slog.Error("failed to complete one-shot query", "chat_id", chatID, "query_id", q.ID, "error", err)
+		return
+	}
+	text, rows := OneShotDone(q, lang)
+	if err := telegram.SendMessageWithButtons(chatID, text, rows); err != nil {
+		slog.Error("failed to send one-shot completion", "chat_id", chatID, "query_id", q.ID, "error", err)
+	}
+}
+
+// rearmQuery re-arms the completed one-shot query of chatID named by a re-arm button's callback
+// data and returns the confirmation. Notified dates stay notified: the query fires again for
+// dates it wasn't alerted about, or whose places went up.
+func rearmQuery(ctx context.Context, st store.Store, chatID string, data string, lang string) (string, error) {
+	q, err := store.GetChatQuery(ctx, st, chatID, strings.TrimPrefix(data, rearmCallbackPrefix))
+	if errors.Is(err, store.ErrNotFound) {
+		return i18n.T(lang, "rearm_unknown"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// a re-armed query counts against the plan limit again
+	q.Status = store.QueryActive
+	if err := store.CheckQueryLimit(ctx, st, q); errors.Is(err, store.ErrPlanLimit) {
+		return i18n.T(lang, "rearm_limit"), nil
+	} else if err != nil {
+		return "", err
+	}
+	if err := st.SetQueryStatus(ctx, q.ID, store.QueryActive); err != nil {
+		return "", err
+	}
+	return i18n.T(lang, "rearm_done"), nil
+}
+
+// handleRearmCallback re-arms the query of a re-arm button
+func handleRearmCallback(ctx context.Context, st store.Store, cq *telegram.CallbackQuery, chatID string) {
+	reply, err := rearmQuery(ctx, st, chatID, cq.Data, i18n.Supported(cq.From.LanguageCode))
+	if err != nil {
+		slog.Error("failed to re-arm one-shot query", "chat_id", chatID, "data", cq.Data, "error", err)
+	}
+	_ = telegram.AnswerCallbackQuery(cq.ID, reply)
+}
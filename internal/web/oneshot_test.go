@@ -0,0 +1,62 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestOneShotSignupCompletesWithTheImmediateCheck(t *testing.T) {
+	withSnapshot(t)
+	l := newLanguageSteps(t)
+	UpdateState([]parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "2"}}}, time.Now())
+
+	form := url.Values{"refuge": {"Tête Rousse"}, "date_from": {"2025-07-01"}, "date_to": {"2025-07-31"}, "one_shot": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	NewServer(l.st).handleSubscribe(rec, req)
+	command := regexp.MustCompile(`/start ps_[^"]+_o\.[0-9a-f]+`).FindString(rec.Body.String())
+	if command == "" {
+		t.Fatalf("expected the one-shot flag in the deep link, got %d", rec.Code)
+	}
+	l.message(command, "en")
+
+	qs, _ := l.st.ListQueriesByChat(t.Context(), "7")
+	if len(qs) != 1 || !qs[0].OneShot || !qs[0].Completed() {
+		t.Fatalf("expected a one-shot query completed by the immediate alert, got %+v", qs)
+	}
+	if list := formatQueryList(qs, "en"); !strings.Contains(list, "Tête Rousse: 2025-07-01 → 2025-07-31 · one-time · done") {
+		t.Errorf("expected the query shown done in /list, got %q", list)
+	}
+}
+
+func TestRearmQuery(t *testing.T) {
+	st := store.NewMemory()
+	id, _ := st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31", OneShot: true, Status: store.QueryCompleted})
+	text, rows := OneShotDone(store.Query{ID: id, Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31", OneShot: true}, "en")
+	if !strings.Contains(text, "any refuge: 2025-07-01 → 2025-07-31") || len(rows) != 1 || rows[0][0].CallbackData != "rearm:"+id {
+		t.Fatalf("unexpected completion notice %q %+v", text, rows)
+	}
+
+	// someone else's query can't be re-armed
+	if reply, err := rearmQuery(t.Context(), st, "2", rows[0][0].CallbackData, "en"); err != nil || !strings.Contains(reply, "no longer exists") {
+		t.Errorf("expected another chat's query not found, got %q, %v", reply, err)
+	}
+	if q, _ := st.GetQuery(t.Context(), id); !q.Completed() {
+		t.Fatal("expected the query still completed")
+	}
+	if reply, err := rearmQuery(t.Context(), st, "1", rows[0][0].CallbackData, "en"); err != nil || !strings.Contains(reply, "Watching again") {
+		t.Errorf("unexpected re-arm reply %q, %v", reply, err)
+	}
+	if q, _ := st.GetQuery(t.Context(), id); q.Status != store.QueryActive {
+		t.Errorf("expected the query active again, got %q", q.Status)
+	}
+}
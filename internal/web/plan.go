@@ -0,0 +1,76 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// planUsage answers a malformed /plan
+const planUsage = "Usage: /plan <chat_id> [free|pro]"
+
+// planLimitReply explains a subscription refused by the plan limit of err in lang, with a line
+// about the pro plan for free subscribers; "" when err isn't a store.PlanLimitError
+func planLimitReply(err error, lang string) string {
+	var le *store.PlanLimitError
+	if !errors.As(err, &le) {
+		return ""
+	}
+	reply := fmt.Sprintf(i18n.T(lang, "plan_limit"), le.Limit, le.Plan)
+	if le.Plan == store.PlanPro {
+		return reply
+	}
+	if n := store.QueryLimit(store.PlanPro); n > 0 {
+		return reply + "\n" + fmt.Sprintf(i18n.T(lang, "plan_upsell"), n)
+	}
+	return reply + "\n" + i18n.T(lang, "plan_upsell_unlimited")
+}
+
+// formatPlan renders the plan of a chat with its active queries, e.g. "free (1 active, up to 2)"
+func formatPlan(plan string, active int) string {
+	if plan == "" {
+		plan = store.PlanFree
+	}
+	if limit := store.QueryLimit(plan); limit > 0 {
+		return fmt.Sprintf("%s (%d active, up to %d)", plan, active, limit)
+	}
+	return fmt.Sprintf("%s (%d active, unlimited)", plan, active)
+}
+
+// handlePlanCommand processes the admin "/plan <chat_id> [free|pro]": shows or sets the plan of
+// a subscriber. Downgrading keeps the queries over the limit; only new ones are refused.
+func handlePlanCommand(ctx context.Context, st store.Store, args []string) string {
+	if len(args) == 0 || len(args) > 2 {
+		return planUsage
+	}
+	sub, err := st.GetSubscriber(ctx, args[0])
+	if errors.Is(err, store.ErrNotFound) {
+		return "Subscriber not found: " + args[0]
+	}
+	if err != nil {
+		slog.Error("/plan failed to load subscriber", "chat_id", args[0], "error", err)
+		return "Error loading the subscriber"
+	}
+	active, err := st.CountQueriesByChat(ctx, sub.ChatID)
+	if err != nil {
+		slog.Error("/plan failed to count queries", "chat_id", sub.ChatID, "error", err)
+		return "Error counting the subscriptions"
+	}
+	if len(args) == 1 {
+		return "Plan of " + sub.ChatID + ": " + formatPlan(sub.Plan, active)
+	}
+	if args[1] != store.PlanFree && args[1] != store.PlanPro {
+		return planUsage
+	}
+	sub.Plan = args[1]
+	if err := st.UpsertSubscriber(ctx, sub); err != nil {
+		slog.Error("/plan failed to save subscriber", "chat_id", sub.ChatID, "error", err)
+		return "Error saving the plan"
+	}
+	slog.Info("subscriber plan changed", "chat_id", sub.ChatID, "plan", sub.Plan)
+	return "✅ Plan of " + sub.ChatID + " set: " + formatPlan(sub.Plan, active)
+}
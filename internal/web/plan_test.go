@@ -0,0 +1,130 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+func TestDeepLinkPastThePlanLimitExplainsIt(t *testing.T) {
+	replies := make(map[string][]string)
+	useSettings(t, func(s *Settings) {
+		s.DeepLinkSecret = "test"
+		s.Notifier = notify.Func(func(_ context.Context, chatID string, message string) error {
+			replies[chatID] = append(replies[chatID], message)
+			return nil
+		})
+	})
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "7", Language: "en", IsActive: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "7", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"})
+	st.AddQuery(t.Context(), store.Query{ChatID: "7", Refuge: "du Goûter", DateFrom: "2025-08-01", DateTo: "2025-08-31"})
+
+	data := "tr_20250701_20250710_en"
+	mac := hmac.New(sha256.New, []byte("test"))
+	mac.Write([]byte(data))
+	text := "/start ps_" + data + "." + hex.EncodeToString(mac.Sum(nil)[:12])
+	ProcessUpdate(t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 7}, Text: text}}, st)
+
+	if qs, _ := st.ListQueriesByChat(t.Context(), "7"); len(qs) != 2 {
+		t.Errorf("expected the query refused, got %+v", qs)
+	}
+	if got := replies["7"]; len(got) != 1 || !strings.Contains(got[0], "the most the free plan allows") || !strings.Contains(got[0], "pro plan") {
+		t.Errorf("expected the limit explained with the pro plan, got %q", got)
+	}
+
+	// upgraded by an admin, the same link subscribes
+	if got := handlePlanCommand(t.Context(), st, []string{"7", "pro"}); got != "✅ Plan of 7 set: pro (2 active, unlimited)" {
+		t.Errorf("/plan 7 pro replied %q", got)
+	}
+	ProcessUpdate(t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 7}, Text: text}}, st)
+	if qs, _ := st.ListQueriesByChat(t.Context(), "7"); len(qs) != 3 {
+		t.Errorf("expected the query added on the pro plan, got %+v", qs)
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "7"); sub.Plan != store.PlanPro {
+		t.Errorf("signing up again changed the plan to %q", sub.Plan)
+	}
+}
+
+func TestPlanLimitReplyIsTranslated(t *testing.T) {
+	if got := planLimitReply(&store.PlanLimitError{Plan: store.PlanFree, Limit: 2}, "de"); !strings.Contains(got, "2 aktive Abos") || !strings.Contains(got, "Pro-Tarif") {
+		t.Errorf("planLimitReply in German = %q", got)
+	}
+	if got := planLimitReply(&store.PlanLimitError{Plan: store.PlanPro, Limit: 10}, "fr"); strings.Contains(got, "⭐") || !strings.Contains(got, "offre pro") {
+		t.Errorf("planLimitReply of the pro plan in French = %q, want no upsell", got)
+	}
+	if got := planLimitReply(errors.New("boom"), "en"); got != "" {
+		t.Errorf("planLimitReply of another error = %q", got)
+	}
+}
+
+func TestStartKeepsExistingSubscriptions(t *testing.T) {
+	replies := make(map[string][]string)
+	useSettings(t, func(s *Settings) {
+		s.Notifier = notify.Func(func(_ context.Context, chatID string, message string) error {
+			replies[chatID] = append(replies[chatID], message)
+			return nil
+		})
+	})
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "7", Language: "en", IsActive: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "7", Refuge: "du Goûter", DateFrom: "2025-08-01", DateTo: "2025-08-31"})
+
+	ProcessUpdate(t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 7}, Text: "/start"}}, st)
+	if qs, _ := st.ListQueriesByChat(t.Context(), "7"); len(qs) != 1 {
+		t.Errorf("expected no default query next to the active one, got %+v", qs)
+	}
+	if got := replies["7"]; len(got) != 1 || got[0] != startWelcomeBack {
+		t.Errorf("expected the welcome back reply, got %q", got)
+	}
+}
+
+func TestPlanCommand(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*"})
+
+	for _, tt := range []struct {
+		args  []string
+		reply string
+		plan  string
+	}{
+		{nil, planUsage, ""},
+		{[]string{"1"}, "Plan of 1: free (1 active, up to 2)", ""},
+		{[]string{"1", "gold"}, planUsage, ""},
+		{[]string{"404", "pro"}, "Subscriber not found: 404", ""},
+		{[]string{"1", "pro"}, "✅ Plan of 1 set: pro (1 active, unlimited)", store.PlanPro},
+		{[]string{"1", "free"}, "✅ Plan of 1 set: free (1 active, up to 2)", store.PlanFree},
+	} {
+		if got := handlePlanCommand(t.Context(), st, tt.args); got != tt.reply {
+			t.Errorf("/plan %v replied %q, want %q", tt.args, got, tt.reply)
+		}
+		if sub, _ := st.GetSubscriber(t.Context(), "1"); sub.Plan != tt.plan {
+			t.Errorf("after /plan %v: plan %q, want %q", tt.args, sub.Plan, tt.plan)
+		}
+	}
+}
+
+func TestRearmPastThePlanLimit(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true})
+	id, _ := st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "*", OneShot: true})
+	st.SetQueryStatus(t.Context(), id, store.QueryCompleted)
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "Tête Rousse"})
+	st.AddQuery(t.Context(), store.Query{ChatID: "1", Refuge: "du Goûter"})
+
+	if reply, err := rearmQuery(t.Context(), st, "1", rearmCallbackPrefix+id, "en"); err != nil || !strings.Contains(reply, "limit") {
+		t.Errorf("unexpected re-arm reply %q, %v", reply, err)
+	}
+	if q, _ := st.GetQuery(t.Context(), id); !q.Completed() {
+		t.Error("query re-armed past the plan limit")
+	}
+}
@@ -0,0 +1,39 @@
+package web
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// getUpdates fetches updates from the Bot API; replaced in tests
+var getUpdates = telegram.GetUpdates
+
+// pollRetryDelay is the pause after a failed getUpdates call
+var pollRetryDelay = 5 * time.Second
+
+// RunPoller feeds updates fetched by long polling to ProcessUpdate until ctx is cancelled.
+// It replaces the webhook (TELEGRAM_MODE=polling) where no public HTTPS URL is available;
+// Telegram refuses getUpdates while a webhook is registered.
+func RunPoller(ctx context.Context, st store.Store) {
+	slog.Info("polling Telegram for updates")
+	offset := 0
+	for ctx.Err() == nil {
+		updates, err := getUpdates(offset)
+		if err != nil {
+			slog.Error("telegram poll error", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(pollRetryDelay):
+			}
+			continue
+		}
+		for _, upd := range updates {
+			ProcessUpdate(ctx, upd, st)
+			offset = upd.UpdateID + 1
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+func TestRunPollerProcessesUpdates(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var offsets []int
+	prev, prevDelay := getUpdates, pollRetryDelay
+	pollRetryDelay = 0
+	getUpdates = func(offset int) ([]telegram.Update, error) {
+		offsets = append(offsets, offset)
+		switch len(offsets) {
+		case 1:
+			return []telegram.Update{{UpdateID: 7, Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 1}, Text: "/stop"}}}, nil
+		case 2:
+			return nil, errors.New("network down")
+		default:
+			cancel()
+			return nil, nil
+		}
+	}
+	defer func() { getUpdates, pollRetryDelay = prev, prevDelay }()
+
+	RunPoller(ctx, st)
+
+	if sub, _ := st.GetSubscriber(ctx, "1"); sub.IsActive {
+		t.Error("expected /stop received by polling to deactivate the subscriber")
+	}
+	// the offset confirms processed updates and is kept across errors
+	if want := []int{0, 8, 8}; len(offsets) != len(want) || offsets[0] != want[0] || offsets[1] != want[1] || offsets[2] != want[2] {
+		t.Errorf("unexpected offsets %v, want %v", offsets, want)
+	}
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	// defaultQRSize is the width of /qr.png without ?size=, in pixels
+	defaultQRSize = 256
+	// minQRSize and maxQRSize bound ?size=
+	minQRSize = 64
+	maxQRSize = 1024
+)
+
+// qrPayloads lists the /start payloads /qr.png encodes; the signed form payloads aren't printable
+var qrPayloads = map[string]bool{"subscribe": true}
+
+// qrCache holds the rendered PNGs by link and size, both bounded, so it stays small
+var qrCache sync.Map
+
+// handleQRCode serves /qr.png?payload=: the bot deep link with that /start payload as a PNG QR
+// code, at most ?size= pixels wide (clamped to [minQRSize, maxQRSize])
+func handleQRCode(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	payload := q.Get("payload")
+	if !qrPayloads[payload] {
+		http.Error(w, "unknown payload", http.StatusBadRequest)
+		return
+	}
+	size := defaultQRSize
+	if v := q.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+		size = min(max(n, minQRSize), maxQRSize)
+	}
+	b, err := qrPNG(botLink(payload), size)
+	if err != nil {
+		slog.Error("failed to render QR code", "payload", payload, "error", err)
+		http.Error(w, "failed to render QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(b)
+}
+
+// qrPNG renders link as a PNG QR code at most size pixels wide, once per link and size. Modules
+// are a whole number of pixels, so the code stays sharp to scanners.
+func qrPNG(link string, size int) ([]byte, error) {
+	key := strconv.Itoa(size) + " " + link
+	if b, ok := qrCache.Load(key); ok {
+		return b.([]byte), nil
+	}
+	code, err := qrcode.New(link, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+	// the bitmap includes the quiet zone; a negative size is pixels per module
+	b, err := code.PNG(-max(size/len(code.Bitmap()), 1))
+	if err != nil {
+		return nil, err
+	}
+	qrCache.Store(key, b)
+	return b, nil
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+func TestQRCodeEncodesTheDeepLink(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.BotUsername = "montblanc_test_bot" })
+	h := NewServer(nil).Handler()
+	for _, c := range []struct {
+		query string
+		width int // whole pixels per module of the 41 modules wide code and its quiet zone
+	}{
+		{"payload=subscribe", 246},
+		{"payload=subscribe&size=330", 328},
+		{"payload=subscribe&size=1", 41},      // raised to minQRSize
+		{"payload=subscribe&size=99999", 984}, // lowered to maxQRSize
+	} {
+		for range 2 { // rendered, then cached
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/qr.png?"+c.query, nil))
+			if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+				t.Fatalf("%s: status %d, content type %q", c.query, rec.Code, rec.Header().Get("Content-Type"))
+			}
+			img, err := png.Decode(rec.Body)
+			if err != nil {
+				t.Fatalf("%s: invalid PNG: %v", c.query, err)
+			}
+			if w := img.Bounds().Dx(); w != c.width {
+				t.Errorf("%s: %dpx wide, want %d", c.query, w, c.width)
+			}
+			bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+			if err != nil {
+				t.Fatalf("%s: %v", c.query, err)
+			}
+			res, err := qrcode.NewQRCodeReader().Decode(bmp, nil)
+			if err != nil {
+				t.Fatalf("%s: not a readable QR code: %v", c.query, err)
+			}
+			if got, want := res.GetText(), "https://t.me/montblanc_test_bot?start=subscribe"; got != want {
+				t.Errorf("%s: encodes %q, want %q", c.query, got, want)
+			}
+		}
+	}
+}
+
+func TestQRCodeRejectsUnknownPayloads(t *testing.T) {
+	h := NewServer(nil).Handler()
+	for _, query := range []string{"", "payload=ps_abc", "payload=subscribe&size=big"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/qr.png?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestHomeShowsTheQRCode(t *testing.T) {
+	withSnapshot(t)
+	rec := httptest.NewRecorder()
+	NewServer(nil).handleHome(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `src="/qr.png?payload=subscribe&amp;size=192"`) {
+		t.Error("home page lacks the QR code")
+	}
+}
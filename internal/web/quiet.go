@@ -0,0 +1,113 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// quietUsage answers /quiet without valid quiet hours
+const quietUsage = "Usage: /quiet 22:00-07:00 [time zone, e.g. Europe/Paris] or /quiet off\nAlerts found during quiet hours are sent in one message when they end."
+
+// quietDigestHeader starts the message delivered when quiet hours end; held matches follow it
+const quietDigestHeader = "🌅 Quiet hours are over, here is what was found meanwhile.\n\n"
+
+// quietDigestID is the outbox ID of the per-chat quiet hours digest
+func quietDigestID(chatID string) string { return "quiet-" + chatID }
+
+// parseQuietHours parses "HH:MM-HH:MM [zone]" into the quiet hours of sub; the zone defaults to UTC
+func parseQuietHours(arg string, sub *store.Subscriber) error {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 || len(fields) > 2 {
+		return errors.New("expected HH:MM-HH:MM and an optional time zone")
+	}
+	from, to, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return fmt.Errorf("invalid window %q", fields[0])
+	}
+	start, err := time.Parse("15:04", from)
+	if err != nil {
+		return fmt.Errorf("invalid time %q", from)
+	}
+	end, err := time.Parse("15:04", to)
+	if err != nil {
+		return fmt.Errorf("invalid time %q", to)
+	}
+	if start.Equal(end) {
+		return errors.New("quiet hours must start and end at different times")
+	}
+	zone := "UTC"
+	if len(fields) == 2 {
+		zone = fields[1]
+	}
+	// "Local" is the server's zone, not the subscriber's
+	if _, err := time.LoadLocation(zone); err != nil || zone == "Local" || zone == "" {
+		return fmt.Errorf("unknown time zone %q", zone)
+	}
+	sub.QuietFrom, sub.QuietTo, sub.Timezone = start.Format("15:04"), end.Format("15:04"), zone
+	return nil
+}
+
+// formatQuietHours renders the quiet hours of sub, e.g. "22:00–07:00 Europe/Paris"
+func formatQuietHours(sub store.Subscriber) string {
+	zone := sub.Timezone
+	if zone == "" {
+		zone = "UTC"
+	}
+	return sub.QuietFrom + "–" + sub.QuietTo + " " + zone
+}
+
+// handleQuietCommand processes "/quiet HH:MM-HH:MM [zone]" and "/quiet off", returning the reply
+func handleQuietCommand(ctx context.Context, st store.Store, chatID string, arg string) string {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "You have no subscription yet. Send /start to subscribe."
+	}
+	if err != nil {
+		slog.Error("quiet hours failed to load subscriber", "chat_id", chatID, "error", err)
+		return "Could not update your quiet hours, please try again later."
+	}
+	switch {
+	case arg == "":
+		if sub.QuietFrom == "" {
+			return "No quiet hours set.\n" + quietUsage
+		}
+		return "🌙 Quiet hours: " + formatQuietHours(sub) + "\n" + quietUsage
+	case strings.EqualFold(arg, "off"):
+		if sub.QuietFrom == "" {
+			return "No quiet hours set."
+		}
+		// alerts already held still arrive when the window would have ended; the daily digest
+		// keeps its time zone
+		sub.QuietFrom, sub.QuietTo = "", ""
+		if sub.NotifyMode != store.NotifyDigest {
+			sub.Timezone = ""
+		}
+	default:
+		if sub.EmailOnly {
+			return emailOnlyNoDigest
+		}
+		if err := parseQuietHours(arg, &sub); err != nil {
+			return "Invalid quiet hours: " + err.Error() + ".\n" + quietUsage
+		}
+	}
+	if err := st.UpsertSubscriber(ctx, sub); err != nil {
+		slog.Error("quiet hours not saved", "chat_id", chatID, "error", err)
+		return "Could not update your quiet hours, please try again later."
+	}
+	if sub.QuietFrom == "" {
+		return "🔔 Quiet hours off, alerts are sent right away again."
+	}
+	return "🌙 Quiet hours set: " + formatQuietHours(sub) + ". Alerts found meanwhile will be sent in one message when they end."
+}
+
+// holdForQuietHours appends body to the digest delivered at until, the end of the subscriber's
+// quiet hours; alerts held the same night share one message
+func holdForQuietHours(ctx context.Context, st store.Store, chatID string, body string, until time.Time) error {
+	return st.EnqueueMessage(ctx, store.OutboxMessage{ID: quietDigestID(chatID), ChatID: chatID, Text: body, Kind: store.KindDigest, DeliverAfter: until})
+}
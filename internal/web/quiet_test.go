@@ -0,0 +1,81 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestQuietCommand(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true})
+
+	for _, tt := range []struct {
+		arg, reply     string
+		from, to, zone string
+	}{
+		{"", "No quiet hours set.", "", "", ""},
+		{"22:00-7:00 Europe/Paris", "🌙 Quiet hours set: 22:00–07:00 Europe/Paris.", "22:00", "07:00", "Europe/Paris"},
+		{"25:00-07:00", "Invalid quiet hours: invalid time \"25:00\"", "22:00", "07:00", "Europe/Paris"},
+		{"22:00-07:00 Mars/Olympus", "Invalid quiet hours: unknown time zone \"Mars/Olympus\"", "22:00", "07:00", "Europe/Paris"},
+		{"22:00-07:00 Local", "Invalid quiet hours: unknown time zone \"Local\"", "22:00", "07:00", "Europe/Paris"},
+		{"07:00-07:00", "Invalid quiet hours: quiet hours must start and end at different times", "22:00", "07:00", "Europe/Paris"},
+		{"", "🌙 Quiet hours: 22:00–07:00 Europe/Paris", "22:00", "07:00", "Europe/Paris"},
+		{"12:00-13:30", "🌙 Quiet hours set: 12:00–13:30 UTC.", "12:00", "13:30", "UTC"},
+		{"off", "🔔 Quiet hours off", "", "", ""},
+		{"off", "No quiet hours set.", "", "", ""},
+	} {
+		if got := handleQuietCommand(t.Context(), st, "1", tt.arg); !strings.HasPrefix(got, tt.reply) {
+			t.Errorf("/quiet %s replied %q, want %q...", tt.arg, got, tt.reply)
+		}
+		sub, _ := st.GetSubscriber(t.Context(), "1")
+		if sub.QuietFrom != tt.from || sub.QuietTo != tt.to || sub.Timezone != tt.zone {
+			t.Errorf("after /quiet %s: quiet hours %q-%q %q, want %q-%q %q", tt.arg, sub.QuietFrom, sub.QuietTo, sub.Timezone, tt.from, tt.to, tt.zone)
+		}
+	}
+	if got := handleQuietCommand(t.Context(), st, "404", "22:00-07:00"); !strings.Contains(got, "/start") {
+		t.Errorf("unknown chat got %q", got)
+	}
+}
+
+func TestQuietHoursHoldAlertsForOneDigest(t *testing.T) {
+	sent := captureSends(t)
+	st := store.NewMemory()
+	sub := store.Subscriber{ChatID: "1", IsActive: true, QuietFrom: "22:00", QuietTo: "07:00"}
+	st.UpsertSubscriber(t.Context(), sub)
+	night := time.Date(2025, 7, 1, 23, 0, 0, 0, time.UTC)
+
+	DeliverOrHold(t.Context(), st, sub, "header\n", "Tête Rousse 2025-07-10\n", night, sendMessageTo)
+	DeliverOrHold(t.Context(), st, sub, "header\n", "du Goûter 2025-07-11\n", night.Add(4*time.Hour), sendMessageTo)
+	FlushOutbox(t.Context(), st, night.Add(7*time.Hour+59*time.Minute))
+	if len(*sent) != 0 {
+		t.Fatalf("alerts sent during quiet hours: %q", *sent)
+	}
+
+	// one message at 07:00, past the alerts' usual 30 minutes expiry
+	FlushOutbox(t.Context(), st, night.Add(8*time.Hour))
+	if want := "1: " + quietDigestHeader + "Tête Rousse 2025-07-10\ndu Goûter 2025-07-11\n"; len(*sent) != 1 || (*sent)[0] != want {
+		t.Fatalf("digest %q, want %q", *sent, want)
+	}
+
+	// daytime alerts go out right away
+	DeliverOrHold(t.Context(), st, sub, "header\n", "body\n", night.Add(9*time.Hour), sendMessageTo)
+	if len(*sent) != 2 || (*sent)[1] != "1: header\nbody\n" {
+		t.Errorf("expected direct delivery after quiet hours, got %q", *sent)
+	}
+}
+
+func TestSnoozeTakesPrecedenceOverQuietHours(t *testing.T) {
+	captureSends(t)
+	st := store.NewMemory()
+	night := time.Date(2025, 7, 1, 23, 0, 0, 0, time.UTC)
+	sub := store.Subscriber{ChatID: "1", IsActive: true, QuietFrom: "22:00", QuietTo: "07:00", SnoozedUntil: night.Add(48 * time.Hour)}
+	st.UpsertSubscriber(t.Context(), sub)
+
+	DeliverOrHold(t.Context(), st, sub, "header\n", "held\n", night, sendMessageTo)
+	if q := queued(t, st); len(q) != 1 || q[0].ID != snoozeCatchUpID("1") {
+		t.Errorf("expected the alert in the snooze catch-up, got %+v", q)
+	}
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// remindCallbackPrefix starts the callback data of the "remind me in 30 min" buttons on alerts:
+// remind:<refuge code>:<YYYYMMDD>
+const remindCallbackPrefix = "remind:"
+
+// remindDelay is how long after the button press the reminder is delivered
+const remindDelay = 30 * time.Minute
+
+// RemindButton is the "remind me in 30 min" button for date at refuge; withDate names the date
+// on the button, for alerts listing several
+func RemindButton(refuge string, date string, lang string, withDate bool) telegram.InlineButton {
+	text := i18n.T(lang, "remind_button")
+	if withDate {
+		text = fmt.Sprintf(i18n.T(lang, "remind_button_date"), date, refuge)
+	}
+	return telegram.InlineButton{Text: text, CallbackData: remindCallbackPrefix + refugeCode(refuge) + ":" + strings.ReplaceAll(date, "-", "")}
+}
+
+// parseRemindCallback returns the refuge and date (YYYY-MM-DD) of a remind button's callback data
+func parseRemindCallback(data string) (string, string, error) {
+	code, day, ok := strings.Cut(strings.TrimPrefix(data, remindCallbackPrefix), ":")
+	refuge := refugeFromCode(code)
+	if !ok || refuge == "*" || len(day) != 8 {
+		return "", "", fmt.Errorf("invalid reminder %q", data)
+	}
+	date := day[:4] + "-" + day[4:6] + "-" + day[6:]
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", "", fmt.Errorf("invalid reminder %q", data)
+	}
+	return refuge, date, nil
+}
+
+// reminderID is the outbox ID of a reminder: pressing the button again moves it rather than
+// adding another
+func reminderID(chatID string, refuge string, date string) string {
+	return "remind-" + chatID + "-" + refugeCode(refuge) + "-" + date
+}
+
+// scheduleReminder queues the reminder about date at refuge for chatID remindDelay after now
+func scheduleReminder(ctx context.Context, st store.Store, chatID string, refuge string, date string, now time.Time) (time.Time, error) {
+	at := now.Add(remindDelay)
+	m := store.OutboxMessage{ID: reminderID(chatID, refuge, date), ChatID: chatID, Kind: store.KindReminder, Refuge: refuge, Date: date, DeliverAfter: at}
+	return at, st.EnqueueMessage(ctx, m)
+}
+
+// handleRemindCallback schedules the reminder asked for with a remind button
+func handleRemindCallback(ctx context.Context, st store.Store, cq *telegram.CallbackQuery, chatID string, now time.Time) {
+	lang := i18n.Supported(cq.From.LanguageCode)
+	refuge, date, err := parseRemindCallback(cq.Data)
+	if err != nil {
+		slog.Warn("ignoring reminder button", "chat_id", chatID, "error", err)
+		_ = telegram.AnswerCallbackQuery(cq.ID, "")
+		return
+	}
+	at, err := scheduleReminder(ctx, st, chatID, refuge, date, now)
+	if err != nil {
+		slog.Error("failed to schedule reminder", "chat_id", chatID, "refuge", refuge, "date", date, "error", err)
+		_ = telegram.AnswerCallbackQuery(cq.ID, "")
+		return
+	}
+	_ = telegram.AnswerCallbackQuery(cq.ID, fmt.Sprintf(i18n.T(lang, "remind_set"), at.UTC().Format("15:04")))
+}
+
+// reminderText is what a reminder says at delivery: the date with its booking link when it
+// still has places in the latest check, or that it's gone
+func reminderText(ctx context.Context, st store.Store, m store.OutboxMessage) string {
+	lang := "en"
+	if sub, err := st.GetSubscriber(ctx, m.ChatID); err == nil {
+		lang = i18n.Supported(sub.Language)
+	} else if !errors.Is(err, store.ErrNotFound) {
+		slog.Warn("reminder language lookup failed", "chat_id", m.ChatID, "error", err)
+	}
+	for _, rf := range currentSnapshot().Refuges {
+		if rf.Name != m.Refuge {
+			continue
+		}
+		if day, ok := rf.Day(m.Date); ok && day.Available() {
+			return fmt.Sprintf(i18n.T(lang, "remind_still"), DateLink(m.Refuge, m.Date, lang), telegram.EscapeHTML(m.Refuge), day.Places) + "\n" + BookNowLink(m.Refuge, m.Date, lang)
+		}
+	}
+	return "⏰ " + fmt.Sprintf(i18n.T(lang, "notif_gone"), telegram.EscapeHTML(m.Date), telegram.EscapeHTML(m.Refuge))
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestRemindButtonCallback(t *testing.T) {
+	b := RemindButton("Tête Rousse", "2025-08-03", "en", false)
+	if b.Text != "⏰ Remind me in 30 min" || len(b.CallbackData) > 64 {
+		t.Fatalf("unexpected button %+v", b)
+	}
+	refuge, date, err := parseRemindCallback(b.CallbackData)
+	if err != nil || refuge != "Tête Rousse" || date != "2025-08-03" {
+		t.Errorf("parseRemindCallback(%q) = %q, %q, %v", b.CallbackData, refuge, date, err)
+	}
+	if b := RemindButton("du Goûter", "2025-08-04", "en", true); !strings.Contains(b.Text, "2025-08-04 du Goûter") {
+		t.Errorf("expected the date on the button, got %q", b.Text)
+	}
+	for _, data := range []string{"remind:", "remind:tr", "remind:any:20250803", "remind:tr:2025083", "remind:tr:20251303"} {
+		if _, _, err := parseRemindCallback(data); err == nil {
+			t.Errorf("expected %q rejected", data)
+		}
+	}
+}
+
+func TestReminderRechecksAvailability(t *testing.T) {
+	withSnapshot(t)
+	sent := captureSends(t)
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "en", IsActive: true})
+	now := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	UpdateState([]parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-08-03": "2", "2025-08-04": "1"}}}, now)
+
+	for _, date := range []string{"2025-08-03", "2025-08-04"} {
+		at, err := scheduleReminder(t.Context(), st, "1", "Tête Rousse", date, now)
+		if err != nil || !at.Equal(now.Add(30*time.Minute)) {
+			t.Fatalf("scheduleReminder = %v, %v", at, err)
+		}
+	}
+	// pressing again moves the reminder rather than adding one
+	scheduleReminder(t.Context(), st, "1", "Tête Rousse", "2025-08-04", now.Add(time.Minute))
+	if q := queued(t, st); len(q) != 2 {
+		t.Fatalf("expected 2 reminders queued, got %+v", q)
+	}
+
+	FlushOutbox(t.Context(), st, now.Add(29*time.Minute))
+	if len(*sent) != 0 {
+		t.Fatalf("expected nothing before the reminders are due, got %v", *sent)
+	}
+
+	// a later check: 2025-08-03 still has places, 2025-08-04 is booked out
+	UpdateState([]parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-08-03": "3", "2025-08-04": "Full"}}}, now.Add(20*time.Minute))
+	FlushOutbox(t.Context(), st, now.Add(31*time.Minute))
+	if len(*sent) != 2 {
+		t.Fatalf("expected both reminders delivered, got %v", *sent)
+	}
+	var still, gone string
+	for _, m := range *sent {
+		if strings.Contains(m, "2025-08-04") {
+			gone = m
+		} else {
+			still = m
+		}
+	}
+	if !strings.Contains(still, "still has 3 places") || !strings.Contains(still, "centrale.ffcam.fr") {
+		t.Errorf("expected the available date resent with its booking link, got %q", still)
+	}
+	if gone != "1: ⏰ ❌ 2025-08-04 at Tête Rousse is no longer available" {
+		t.Errorf("expected the booked-out date reported gone, got %q", gone)
+	}
+	if q := queued(t, st); len(q) != 0 {
+		t.Errorf("expected the reminders removed from the outbox, got %+v", q)
+	}
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// seasonCallback is the callback data of the "notify me when booking opens" button
+const seasonCallback = "season_open"
+
+// seasonButton is the inline keyboard attached to the /start greeting
+func seasonButton(lang string) [][]telegram.InlineButton {
+	return [][]telegram.InlineButton{{{Text: i18n.T(lang, "season_button"), CallbackData: seasonCallback}}}
+}
+
+// enableSeasonOpen turns on the season-opening ping for chatID and returns the confirmation;
+// a chat we don't know yet is signed up
+func enableSeasonOpen(ctx context.Context, st store.Store, chatID string, lang string, now time.Time) (string, error) {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		reply := i18n.T(lang, "season_enabled")
+		return reply, signup(ctx, st, store.Subscriber{ChatID: chatID, Language: lang, NotifyOnSeasonOpen: true}, store.ConsentTelegram, reply, "", now)
+	}
+	if err != nil {
+		return "", err
+	}
+	sub.NotifyOnSeasonOpen = true
+	return i18n.T(sub.Language, "season_enabled"), st.UpsertSubscriber(ctx, sub)
+}
+
+// handleCallbackQuery processes inline button presses
+func handleCallbackQuery(ctx context.Context, st store.Store, cq *telegram.CallbackQuery) {
+	if cq.From == nil || (cq.Data != seasonCallback && !strings.HasPrefix(cq.Data, remindCallbackPrefix) && !strings.HasPrefix(cq.Data, rearmCallbackPrefix)) {
+		_ = telegram.AnswerCallbackQuery(cq.ID, "")
+		return
+	}
+	chatID := fmt.Sprintf("%d", cq.From.ID)
+	if cq.Message != nil && cq.Message.Chat != nil {
+		chatID = fmt.Sprintf("%d", cq.Message.Chat.ID)
+	}
+	if strings.HasPrefix(cq.Data, remindCallbackPrefix) {
+		handleRemindCallback(ctx, st, cq, chatID, time.Now())
+		return
+	}
+	if strings.HasPrefix(cq.Data, rearmCallbackPrefix) {
+		handleRearmCallback(ctx, st, cq, chatID)
+		return
+	}
+	reply, err := enableSeasonOpen(ctx, st, chatID, i18n.Supported(cq.From.LanguageCode), time.Now())
+	if err != nil {
+		slog.Error("failed to enable season-opening ping", "chat_id", chatID, "error", err)
+		_ = telegram.AnswerCallbackQuery(cq.ID, "")
+		return
+	}
+	_ = telegram.AnswerCallbackQuery(cq.ID, reply)
+}
+
+// SeasonOpenMessage is the one-off ping sent when booking opens at refuge for the season
+func SeasonOpenMessage(refuge string, year int, lang string) string {
+	return fmt.Sprintf(i18n.T(lang, "season_open"), refuge, year) + "\n" + parser.ReservationURL
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestEnableSeasonOpen(t *testing.T) {
+	st := store.NewMemory()
+	now := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "de", IsActive: true, ConsentSource: store.ConsentTelegram})
+
+	reply, err := enableSeasonOpen(t.Context(), st, "1", "en", now)
+	if err != nil {
+		t.Fatalf("enableSeasonOpen: %v", err)
+	}
+	if reply != i18n.T("de", "season_enabled") {
+		t.Errorf("expected reply in the subscriber's language, got %q", reply)
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "1"); !sub.NotifyOnSeasonOpen {
+		t.Error("expected preference to be set")
+	}
+
+	// unknown chats are signed up with the preference
+	if _, err := enableSeasonOpen(t.Context(), st, "2", "it", now); err != nil {
+		t.Fatalf("enableSeasonOpen: %v", err)
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "2"); !sub.IsActive || !sub.NotifyOnSeasonOpen || sub.Language != "it" || sub.ConsentSource != store.ConsentTelegram {
+		t.Errorf("unexpected new subscriber %+v", sub)
+	}
+}
+
+func TestSignupKeepsSeasonPreference(t *testing.T) {
+	st := store.NewMemory()
+	now := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true, NotifyOnSeasonOpen: true, SeasonNotified: map[string]int{"Tête Rousse": 2024}})
+
+	// a later /start doesn't drop the season-opening ping or what was already announced
+	if err := signup(t.Context(), st, store.Subscriber{ChatID: "1", Language: "en"}, store.ConsentTelegram, startGreeting, "", now); err != nil {
+		t.Fatalf("signup: %v", err)
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "1"); !sub.NotifyOnSeasonOpen || sub.SeasonNotified["Tête Rousse"] != 2024 {
+		t.Errorf("season preference lost on signup: %+v", sub)
+	}
+}
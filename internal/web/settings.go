@@ -0,0 +1,81 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+)
+
+// Settings is the web server configuration, taken from the startup config by main
+type Settings struct {
+	Port              string
+	BaseURL           string // public site root used in links sent by the bot
+	BotUsername       string // set from getMe at startup by UseBotUsername
+	GAMeasurementID   string
+	AdminToken        string   // enables the /admin pages; empty hides them
+	DeepLinkSecret    string   // signs the web form deep links
+	UnsubscribeSecret string   // signs the one-click unsubscribe links; empty disables them
+	WebhookSecret     string   // expected X-Telegram-Bot-Api-Secret-Token; empty accepts every update
+	AdminChatIDs      []string // TELEGRAM_CHAT_IDS
+	PublicChannel     string   // chat the season reports are published to; empty disables publishing
+	KeepAliveURL      string   // empty disables keep-alive
+	KeepAliveInterval time.Duration
+	HistoryRetention  time.Duration   // how long date snapshots are kept (SNAPSHOT_RETENTION_DAYS), 0 forever
+	CheckInterval     time.Duration   // between two checks; the site warns once its data is twice as old
+	DigestHour        int             // hour daily digests are sent at, in each subscriber's time zone
+	StateFromStore    bool            // read the availability from the store rather than UpdateState
+	ConfigReport      string          // redacted effective configuration shown on /admin/config
+	Notifier          notify.Notifier // delivers the bot's messages; nil sends through Telegram
+	// TestAlert sends a chat a test alert through the scheduler, set by UseTestAlert; nil
+	// disables /test
+	TestAlert func(ctx context.Context, chatID string) (string, error)
+}
+
+// settings is what the handlers use; the defaults match an unconfigured local run
+var settings = Settings{
+	Port:              "8080",
+	BaseURL:           "https://montblanc.onrender.com",
+	BotUsername:       defaultBotUsername,
+	DeepLinkSecret:    "dev",
+	KeepAliveInterval: defaultKeepAliveInterval,
+	DigestHour:        8,
+}
+
+// defaultBotUsername is the original bot, for runs that can't ask Telegram
+const defaultBotUsername = "montblanc_booking_bot"
+
+// Configure replaces the settings; call it once before StartServer or RunPoller
+func Configure(s Settings) { settings = s }
+
+// UseBotUsername sets the bot the deep links point to and group commands are addressed to;
+// "" falls back to the original bot
+func UseBotUsername(name string) {
+	if name == "" {
+		name = defaultBotUsername
+	}
+	settings.BotUsername = name
+}
+
+// UseTestAlert sets how /test and the "Send test alert" button deliver a test alert to a chat,
+// returning the report shown to the user
+func UseTestAlert(send func(ctx context.Context, chatID string) (string, error)) {
+	settings.TestAlert = send
+}
+
+// sendTo sends message to chatID through the configured notifier
+func sendTo(ctx context.Context, chatID string, message string) error {
+	var n notify.Notifier = notify.TelegramNotifier{}
+	if settings.Notifier != nil {
+		n = settings.Notifier
+	}
+	return n.Notify(ctx, chatID, message)
+}
+
+// handleAdminConfig shows the effective configuration the service started with
+func handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, settings.ConfigReport)
+}
@@ -0,0 +1,249 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/metrics"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// maxSnooze caps how long a chat can silence its alerts
+const maxSnooze = 30 * 24 * time.Hour
+
+// snoozeCatchUpHeader starts the message delivered when a snooze ends; held matches are appended to it
+const snoozeCatchUpHeader = "⏰ Snooze ended, alerts are back on.\n\n"
+
+// sendMessageTo is the Telegram sender used for subscriber deliveries (overridable in tests)
+var sendMessageTo = telegram.SendMessageTo
+
+// snoozeCatchUpID is the outbox ID of the per-chat catch-up message
+func snoozeCatchUpID(chatID string) string { return "snooze-" + chatID }
+
+// parseSnoozeDuration parses values like "48h", "90m" or "3d" (max 30 days)
+func parseSnoozeDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	var d time.Duration
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		d, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+	if d > maxSnooze {
+		return 0, fmt.Errorf("duration must be at most 30 days")
+	}
+	return d, nil
+}
+
+// snoozeSubscriber silences chatID for d and schedules the catch-up message for when the snooze ends
+func snoozeSubscriber(ctx context.Context, st store.Store, chatID string, d time.Duration, now time.Time) (time.Time, error) {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// extending an active snooze keeps the catch-up collected so far
+	text := ""
+	if !sub.IsSnoozed(now) {
+		text = snoozeCatchUpHeader
+	}
+	sub.SnoozedUntil = now.Add(d)
+	if err := st.UpsertSubscriber(ctx, sub); err != nil {
+		return time.Time{}, err
+	}
+	if err := st.EnqueueMessage(ctx, store.OutboxMessage{ID: snoozeCatchUpID(chatID), ChatID: chatID, Text: text, Kind: store.KindCatchUp, DeliverAfter: sub.SnoozedUntil}); err != nil {
+		return time.Time{}, err
+	}
+	return sub.SnoozedUntil, nil
+}
+
+// unsnoozeSubscriber cancels an active snooze and releases the catch-up message right away.
+// It reports whether the chat was snoozed.
+func unsnoozeSubscriber(ctx context.Context, st store.Store, chatID string, now time.Time) (bool, error) {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if err != nil {
+		return false, err
+	}
+	if !sub.IsSnoozed(now) {
+		return false, nil
+	}
+	sub.SnoozedUntil = time.Time{}
+	if err := st.UpsertSubscriber(ctx, sub); err != nil {
+		return false, err
+	}
+	if err := st.EnqueueMessage(ctx, store.OutboxMessage{ID: snoozeCatchUpID(chatID), ChatID: chatID, Kind: store.KindCatchUp, DeliverAfter: now}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeliverOrHold sends header+body to the subscriber via send, or appends body to the snooze
+// catch-up message when the subscriber is snoozed, to the daily digest in digest mode, or to the
+// quiet hours digest during them
+func DeliverOrHold(ctx context.Context, st store.Store, sub store.Subscriber, header string, body string, now time.Time, send func(chatID string, text string) error) error {
+	if sub.IsSnoozed(now) {
+		return st.EnqueueMessage(ctx, store.OutboxMessage{ID: snoozeCatchUpID(sub.ChatID), ChatID: sub.ChatID, Text: body, Kind: store.KindCatchUp, DeliverAfter: sub.SnoozedUntil})
+	}
+	if sub.NotifyMode == store.NotifyDigest {
+		return holdForDigest(ctx, st, sub, body, now)
+	}
+	if until := sub.QuietUntil(now); !until.IsZero() {
+		return holdForQuietHours(ctx, st, sub.ChatID, body, until)
+	}
+	return send(sub.ChatID, header+body)
+}
+
+// outboxExpired counts outbox messages discarded because they were too old (exposed on /debug/vars)
+var outboxExpired = expvar.NewInt("outbox_expired_total")
+
+// FlushOutbox delivers due outbox messages; failed sends stay queued for the next run.
+// Messages past their expiry are discarded and logged as expired instead.
+func FlushOutbox(ctx context.Context, st store.Store, now time.Time) {
+	msgs, err := st.ListDueMessages(ctx, now)
+	if err != nil {
+		slog.Error("failed to list outbox messages", "error", err)
+		return
+	}
+	for _, m := range msgs {
+		status := store.StatusSent
+		if m.Expired(now) {
+			status = store.StatusExpired
+			outboxExpired.Add(1)
+			slog.Info("discarding expired outbox message", "message_id", m.ID, "chat_id", m.ChatID, "expired", m.ExpiresAt.UTC().Format("2006-01-02 15:04"))
+		} else if err := sendMessageTo(m.ChatID, outboxText(ctx, st, m)); err != nil {
+			slog.Error("failed to deliver outbox message", "message_id", m.ID, "chat_id", m.ChatID, "error", err)
+			continue
+		}
+		if status == store.StatusSent {
+			metrics.NotificationsSent.WithLabelValues(m.Kind).Inc()
+		}
+		if err := st.DeleteMessage(ctx, m.ID); err != nil {
+			slog.Error("failed to delete outbox message", "message_id", m.ID, "error", err)
+		}
+		if err := st.LogNotification(ctx, store.NotificationLogEntry{ChatID: m.ChatID, MessageID: m.ID, Kind: m.Kind, Status: status, At: now}); err != nil {
+			slog.Error("failed to log outbox message", "message_id", m.ID, "error", err)
+		}
+	}
+}
+
+// outboxText is the text delivered for m; reminders are checked against the latest availability
+func outboxText(ctx context.Context, st store.Store, m store.OutboxMessage) string {
+	switch m.Kind {
+	case store.KindReminder:
+		return reminderText(ctx, st, m)
+	case store.KindDigest:
+		return quietDigestHeader + m.Text
+	case store.KindDaily:
+		return dailyDigestHeader + m.Text
+	}
+	return m.Text
+}
+
+// formatRemaining renders a duration as e.g. "1d 4h" or "35m"
+func formatRemaining(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	mins := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, mins)
+	default:
+		return fmt.Sprintf("%dm", mins)
+	}
+}
+
+// handleSnoozeCommand processes "/snooze <duration>" and "/snooze off"
+func handleSnoozeCommand(ctx context.Context, st store.Store, chatID string, arg string) {
+	now := time.Now()
+	if arg == "" {
+		_ = sendTo(ctx, chatID, "Usage: /snooze 48h, /snooze 3d (max 30 days) or /snooze off")
+		return
+	}
+	if strings.EqualFold(arg, "off") {
+		was, err := unsnoozeSubscriber(ctx, st, chatID, now)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = sendTo(ctx, chatID, "You have no subscription yet. Send /start to subscribe.")
+		case err != nil:
+			slog.Error("snooze off failed", "chat_id", chatID, "error", err)
+			_ = sendTo(ctx, chatID, "Could not cancel the snooze, please try again later.")
+		case !was:
+			_ = sendTo(ctx, chatID, "Alerts are not snoozed.")
+		default:
+			_ = sendTo(ctx, chatID, "🔔 Snooze cancelled, alerts are back on.")
+		}
+		return
+	}
+	d, err := parseSnoozeDuration(arg)
+	if err != nil {
+		_ = sendTo(ctx, chatID, "Invalid duration: use e.g. 48h or 3d (max 30 days).")
+		return
+	}
+	until, err := snoozeSubscriber(ctx, st, chatID, d, now)
+	if errors.Is(err, store.ErrNotFound) {
+		_ = sendTo(ctx, chatID, "You have no subscription yet. Send /start to subscribe.")
+		return
+	}
+	if err != nil {
+		slog.Error("snooze failed", "chat_id", chatID, "error", err)
+		_ = sendTo(ctx, chatID, "Could not snooze alerts, please try again later.")
+		return
+	}
+	_ = sendTo(ctx, chatID, fmt.Sprintf("😴 Alerts snoozed until %s UTC. Matches found meanwhile will be sent in one message when the snooze ends. Send /snooze off to resume early.", until.UTC().Format("2006-01-02 15:04")))
+}
+
+// handleStatusCommand replies with the chat's subscription status, remaining snooze and quiet hours
+func handleStatusCommand(ctx context.Context, st store.Store, chatID string) {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		_ = sendTo(ctx, chatID, "You have no subscription yet. Send /start to subscribe.")
+		return
+	}
+	if err != nil {
+		slog.Error("status failed", "chat_id", chatID, "error", err)
+		_ = sendTo(ctx, chatID, "Could not load your status, please try again later.")
+		return
+	}
+	qs, _ := st.ListQueriesByChat(ctx, chatID)
+	var b strings.Builder
+	if sub.IsActive {
+		b.WriteString("Status: active\n")
+	} else {
+		b.WriteString("Status: stopped\n")
+	}
+	b.WriteString(fmt.Sprintf("Subscriptions: %d\n", len(qs)))
+	if active, err := st.CountQueriesByChat(ctx, chatID); err == nil {
+		b.WriteString("Plan: " + formatPlan(sub.Plan, active) + "\n")
+	}
+	now := time.Now()
+	if sub.IsSnoozed(now) {
+		b.WriteString(fmt.Sprintf("Snoozed: %s left (until %s UTC)\n", formatRemaining(sub.SnoozedUntil.Sub(now)), sub.SnoozedUntil.UTC().Format("2006-01-02 15:04")))
+	}
+	if sub.QuietFrom != "" {
+		b.WriteString("Quiet hours: " + formatQuietHours(sub) + "\n")
+	}
+	if sub.NotifyMode == store.NotifyDigest {
+		b.WriteString("Daily digest: " + formatDigestHour(sub) + "\n")
+	}
+	_ = sendTo(ctx, chatID, b.String())
+}
@@ -0,0 +1,204 @@
+package web
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// captureSends replaces sendMessageTo for the duration of the test
+func captureSends(t *testing.T) *[]string {
+	t.Helper()
+	var sent []string
+	prev := sendMessageTo
+	sendMessageTo = func(chatID string, message string) error {
+		sent = append(sent, chatID+": "+message)
+		return nil
+	}
+	t.Cleanup(func() { sendMessageTo = prev })
+	return &sent
+}
+
+// queued returns the messages in the outbox of st, due or not
+func queued(t *testing.T, st store.Store) []store.OutboxMessage {
+	t.Helper()
+	ms, err := st.ListDueMessages(t.Context(), time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ListDueMessages: %v", err)
+	}
+	return ms
+}
+
+func TestParseSnoozeDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "48h", want: 48 * time.Hour},
+		{in: "3d", want: 72 * time.Hour},
+		{in: "90m", want: 90 * time.Minute},
+		{in: " 2D ", want: 48 * time.Hour},
+		{in: "30d", want: 30 * 24 * time.Hour},
+		{in: "31d", wantErr: true},
+		{in: "721h", wantErr: true},
+		{in: "0h", wantErr: true},
+		{in: "-1d", wantErr: true},
+		{in: "soon", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSnoozeDuration(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSnoozeDuration(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSnoozeDuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverOrHoldSuppressesWhileSnoozed(t *testing.T) {
+	sent := captureSends(t)
+	st := store.NewMemory()
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true})
+
+	until, err := snoozeSubscriber(t.Context(), st, "1", 48*time.Hour, now)
+	if err != nil {
+		t.Fatalf("snoozeSubscriber: %v", err)
+	}
+	if !until.Equal(now.Add(48 * time.Hour)) {
+		t.Errorf("unexpected snooze end %v", until)
+	}
+	sub, _ := st.GetSubscriber(t.Context(), "1")
+	if err := DeliverOrHold(t.Context(), st, sub, "header\n", "Tête Rousse 2025-07-10\n", now.Add(time.Hour), sendMessageTo); err != nil {
+		t.Fatalf("DeliverOrHold: %v", err)
+	}
+	if err := DeliverOrHold(t.Context(), st, sub, "header\n", "du Goûter 2025-07-11\n", now.Add(2*time.Hour), sendMessageTo); err != nil {
+		t.Fatalf("DeliverOrHold: %v", err)
+	}
+	if len(*sent) != 0 {
+		t.Fatalf("expected no sends while snoozed, got %v", *sent)
+	}
+
+	// nothing is due before the snooze ends
+	FlushOutbox(t.Context(), st, now.Add(47*time.Hour))
+	if len(*sent) != 0 {
+		t.Fatalf("expected no catch-up before snooze end, got %v", *sent)
+	}
+}
+
+func TestSnoozeCatchUpFlush(t *testing.T) {
+	sent := captureSends(t)
+	st := store.NewMemory()
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true})
+
+	if _, err := snoozeSubscriber(t.Context(), st, "1", 24*time.Hour, now); err != nil {
+		t.Fatalf("snoozeSubscriber: %v", err)
+	}
+	sub, _ := st.GetSubscriber(t.Context(), "1")
+	DeliverOrHold(t.Context(), st, sub, "header\n", "Tête Rousse 2025-07-10\n", now.Add(time.Hour), sendMessageTo)
+	DeliverOrHold(t.Context(), st, sub, "header\n", "du Goûter 2025-07-11\n", now.Add(2*time.Hour), sendMessageTo)
+
+	FlushOutbox(t.Context(), st, now.Add(25*time.Hour))
+	if len(*sent) != 1 {
+		t.Fatalf("expected one catch-up message, got %d: %v", len(*sent), *sent)
+	}
+	msg := (*sent)[0]
+	if !strings.Contains(msg, "Tête Rousse 2025-07-10") || !strings.Contains(msg, "du Goûter 2025-07-11") {
+		t.Errorf("catch-up message misses held matches: %q", msg)
+	}
+	if q := queued(t, st); len(q) != 0 {
+		t.Errorf("expected outbox to be empty after flush, got %d", len(q))
+	}
+
+	// after the snooze ends, alerts go out directly
+	sub, _ = st.GetSubscriber(t.Context(), "1")
+	DeliverOrHold(t.Context(), st, sub, "header\n", "body\n", now.Add(26*time.Hour), sendMessageTo)
+	if len(*sent) != 2 || (*sent)[1] != "1: header\nbody\n" {
+		t.Errorf("expected direct delivery after snooze, got %v", *sent)
+	}
+}
+
+func TestUnsnoozeReleasesCatchUpEarly(t *testing.T) {
+	sent := captureSends(t)
+	st := store.NewMemory()
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true})
+
+	if _, err := snoozeSubscriber(t.Context(), st, "1", 72*time.Hour, now); err != nil {
+		t.Fatalf("snoozeSubscriber: %v", err)
+	}
+	sub, _ := st.GetSubscriber(t.Context(), "1")
+	DeliverOrHold(t.Context(), st, sub, "header\n", "held\n", now.Add(time.Hour), sendMessageTo)
+
+	was, err := unsnoozeSubscriber(t.Context(), st, "1", now.Add(2*time.Hour))
+	if err != nil || !was {
+		t.Fatalf("unsnoozeSubscriber = %v, %v; want true, nil", was, err)
+	}
+	sub, _ = st.GetSubscriber(t.Context(), "1")
+	if sub.IsSnoozed(now.Add(2 * time.Hour)) {
+		t.Error("expected snooze to be cleared")
+	}
+	FlushOutbox(t.Context(), st, now.Add(2*time.Hour))
+	if len(*sent) != 1 || !strings.Contains((*sent)[0], "held") {
+		t.Errorf("expected catch-up right after cancel, got %v", *sent)
+	}
+
+	// cancelling again is a no-op
+	was, err = unsnoozeSubscriber(t.Context(), st, "1", now.Add(3*time.Hour))
+	if err != nil || was {
+		t.Errorf("second unsnoozeSubscriber = %v, %v; want false, nil", was, err)
+	}
+}
+
+func TestSnoozeUnknownSubscriber(t *testing.T) {
+	st := store.NewMemory()
+	if _, err := snoozeSubscriber(t.Context(), st, "404", time.Hour, time.Now()); err != store.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestFlushOutboxDiscardsExpiredAlerts(t *testing.T) {
+	sent := captureSends(t)
+	st := store.NewMemory()
+	clock := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	st.EnqueueMessage(t.Context(), store.OutboxMessage{ID: "alert", ChatID: "1", Text: "Tête Rousse 2025-07-10", Kind: store.KindAlert, DeliverAfter: clock, ExpiresAt: store.ExpiryFor(store.KindAlert, clock)})
+	st.EnqueueMessage(t.Context(), store.OutboxMessage{ID: "admin", ChatID: "2", Text: "session restored", Kind: store.KindAdmin, DeliverAfter: clock, ExpiresAt: store.ExpiryFor(store.KindAdmin, clock)})
+	expiredBefore := outboxExpired.Value()
+
+	// Telegram is down: both stay queued
+	prev := sendMessageTo
+	sendMessageTo = func(string, string) error { return errors.New("telegram down") }
+	clock = clock.Add(10 * time.Minute)
+	FlushOutbox(t.Context(), st, clock)
+	sendMessageTo = prev
+	if q := queued(t, st); len(q) != 2 {
+		t.Fatalf("expected both messages queued during the outage, got %d", len(q))
+	}
+
+	// back up after the alert went stale
+	clock = clock.Add(store.AlertTTL)
+	FlushOutbox(t.Context(), st, clock)
+	if len(*sent) != 1 || (*sent)[0] != "2: session restored" {
+		t.Fatalf("expected only the admin message to be delivered, got %v", *sent)
+	}
+	if q := queued(t, st); len(q) != 0 {
+		t.Errorf("expected the expired alert to be removed, got %d queued", len(q))
+	}
+	if got := outboxExpired.Value() - expiredBefore; got != 1 {
+		t.Errorf("expected expired metric to grow by 1, got %d", got)
+	}
+	if n, _ := st.CountNotifications(t.Context(), store.StatusExpired, time.Time{}); n != 1 {
+		t.Errorf("expected the alert logged as expired, got %d expired", n)
+	}
+	if stats := handleStatsCommand(t.Context(), st, clock); !strings.Contains(stats, "Outbox expired (24h): 1") || !strings.Contains(stats, "Outbox delivered (24h): 1") || !strings.Contains(stats, "Dates alerted (24h): 0") {
+		t.Errorf("unexpected stats %q", stats)
+	}
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// stateSettingKey holds the latest check in the store, for sites running apart from the checker
+const stateSettingKey = "web_state"
+
+// storedState is the stateSettingKey payload
+type storedState struct {
+	Refuges   []parser.Refuge `json:"refuges"`
+	LastCheck time.Time       `json:"last_check"`
+}
+
+// SaveState stores the refuges of the latest check, which sites with StateFromStore read instead
+// of UpdateState
+func SaveState(ctx context.Context, st store.Store, refuges []parser.Refuge, lastCheck time.Time) error {
+	raw, err := json.Marshal(storedState{Refuges: refuges, LastCheck: lastCheck})
+	if err != nil {
+		return err
+	}
+	return st.SetSetting(ctx, stateSettingKey, string(raw))
+}
+
+// snapshot returns the availability to show: the latest check in the store with StateFromStore,
+// the one handed to UpdateState otherwise. A store without a saved check, or failing, falls back
+// to the process's own.
+func (s *Server) snapshot(ctx context.Context) *snapshot {
+	if !settings.StateFromStore || s.store == nil {
+		return currentSnapshot()
+	}
+	raw, err := s.store.GetSetting(ctx, stateSettingKey)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			slog.Error("failed to read the latest check from the store", "error", err)
+		}
+		return currentSnapshot()
+	}
+	var saved storedState
+	if err := json.Unmarshal([]byte(raw), &saved); err != nil {
+		slog.Error("invalid latest check in the store", "error", err)
+		return currentSnapshot()
+	}
+	return &snapshot{Refuges: saved.Refuges, LastCheck: saved.LastCheck}
+}
+
+// stale reports whether a check at lastCheck is older than twice the check interval at now
+func stale(lastCheck time.Time, now time.Time) bool {
+	return settings.CheckInterval > 0 && !lastCheck.IsZero() && now.Sub(lastCheck) > 2*settings.CheckInterval
+}
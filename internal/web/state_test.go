@@ -0,0 +1,109 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestUpdateStateKeepsTheLastCheck(t *testing.T) {
+	withSnapshot(t)
+	first := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	UpdateState(nil, first)
+
+	// a zero check time keeps the previous one
+	refuges := []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}}}
+	UpdateState(refuges, time.Time{})
+	if s := currentSnapshot(); len(s.Refuges) != 1 || !s.LastCheck.Equal(first) {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+}
+
+// BenchmarkUpdateState shows that UpdateState doesn't slow down with the number of
+// concurrent readers (page views, API clients) of the snapshot
+func BenchmarkUpdateState(b *testing.B) {
+	prev := current.Load()
+	b.Cleanup(func() { current.Store(prev) })
+	refuges := []parser.Refuge{
+		{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3", "2025-07-11": "Full"}},
+		{Name: "du Goûter", Dates: map[string]string{"2025-07-10": "Full", "2025-07-12": "8"}},
+	}
+	for _, readers := range []int{0, 100, 1000} {
+		b.Run(fmt.Sprintf("readers=%d", readers), func(b *testing.B) {
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < readers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+							json.Marshal(currentSnapshot())
+						}
+					}
+				}()
+			}
+			now := time.Now()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				UpdateState(refuges, now)
+			}
+			b.StopTimer()
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
+
+func TestServerReadsStateFromStore(t *testing.T) {
+	withSnapshot(t)
+	now := time.Now().UTC()
+	UpdateState([]parser.Refuge{{Name: "du Goûter", Dates: map[string]string{"2025-07-10": "1"}}, {Name: "Tête Rousse"}}, now)
+	st := store.NewMemory()
+	// the checker of another process last saved a check an hour ago
+	SaveState(t.Context(), st, []parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "4"}}}, now.Add(-time.Hour))
+
+	status := func() (got struct {
+		Refuges int  `json:"refuges"`
+		Stale   bool `json:"stale"`
+	}) {
+		rec := httptest.NewRecorder()
+		NewServer(st).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("invalid status JSON %q: %v", rec.Body.String(), err)
+		}
+		return got
+	}
+	useSettings(t, func(s *Settings) { s.CheckInterval = time.Minute })
+	if got := status(); got.Refuges != 2 || got.Stale {
+		t.Errorf("expected the in-process check, fresh, got %+v", got)
+	}
+
+	useSettings(t, func(s *Settings) { s.StateFromStore = true })
+	if got := status(); got.Refuges != 1 || !got.Stale {
+		t.Errorf("expected the stored check, stale after 2 intervals, got %+v", got)
+	}
+	rec := httptest.NewRecorder()
+	NewServer(st).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?lang=en", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, i18n.T("en", "stale_data")) {
+		t.Errorf("expected the stale banner on the home page")
+	}
+
+	useSettings(t, func(s *Settings) { s.CheckInterval = 2 * time.Hour })
+	if got := status(); got.Stale {
+		t.Errorf("expected an hour-old check fresh with a 2h interval, got %+v", got)
+	}
+}
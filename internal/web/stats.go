@@ -0,0 +1,44 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// statsWindow is the period covered by the delivery counts in /stats
+const statsWindow = 24 * time.Hour
+
+// handleStatsCommand renders the admin "/stats" reply: subscribers, alerted dates and outbox
+// deliveries of the last 24h
+func handleStatsCommand(ctx context.Context, st store.Store, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("📊 Stats\n")
+	if n, err := st.CountSubscribers(ctx); err != nil {
+		slog.Error("stats: failed to count subscribers", "error", err)
+	} else {
+		b.WriteString(fmt.Sprintf("Subscribers: %d active\n", n))
+	}
+	since := now.Add(-statsWindow)
+	if n, err := st.CountRecordedNotifications(ctx, since); err != nil {
+		slog.Error("stats: failed to count alerted dates", "error", err)
+	} else {
+		b.WriteString(fmt.Sprintf("Dates alerted (24h): %d\n", n))
+	}
+	for _, c := range []struct{ label, status string }{
+		{"Outbox delivered (24h)", store.StatusSent},
+		{"Outbox expired (24h)", store.StatusExpired},
+	} {
+		n, err := st.CountNotifications(ctx, c.status, since)
+		if err != nil {
+			slog.Error("stats: failed to count notifications", "status", c.status, "error", err)
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%s: %d\n", c.label, n))
+	}
+	return b.String()
+}
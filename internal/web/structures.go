@@ -0,0 +1,219 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+const structureUsage = "Usage:\n/add_structure <BK_STRUCTURE:id> <display name>\n/remove_structure <BK_STRUCTURE:id>"
+
+// LoadStructures puts the structures added with /add_structure into the live refuge registry
+func LoadStructures(ctx context.Context, st store.Store) error {
+	ss, err := st.ListStructures(ctx)
+	if err != nil {
+		return err
+	}
+	rs := make([]parser.RefugeConfig, 0, len(ss))
+	for _, s := range ss {
+		rs = append(rs, parser.RefugeConfig{Name: s.Name, StructureID: s.ID})
+	}
+	parser.SetAddedRefuges(rs)
+	return nil
+}
+
+// addStructure validates a structure with one fetch of the current month, stores it and starts
+// monitoring it; the probed calendar is returned for the reply
+func addStructure(ctx context.Context, st store.Store, rc parser.RefugeConfig, adminChatID string, now time.Time) (parser.Refuge, error) {
+	if !parser.ValidStructureID(rc.StructureID) {
+		return parser.Refuge{}, fmt.Errorf("invalid structure ID %q, expected BK_STRUCTURE:<number>", rc.StructureID)
+	}
+	if rc.Name == "" || rc.Name == "*" {
+		return parser.Refuge{}, fmt.Errorf("invalid display name %q", rc.Name)
+	}
+	if existing, ok := parser.FindRefuge(rc); ok {
+		return parser.Refuge{}, fmt.Errorf("already monitored as %s (%s)", existing.Name, existing.StructureID)
+	}
+	refuge, err := parser.ProbeStructure(rc, now)
+	if err != nil {
+		return parser.Refuge{}, fmt.Errorf("test fetch failed: %w", err)
+	}
+	if err := st.AddStructure(ctx, store.Structure{ID: rc.StructureID, Name: rc.Name, AddedBy: adminChatID, AddedAt: now}); err != nil {
+		return parser.Refuge{}, err
+	}
+	return refuge, LoadStructures(ctx, st)
+}
+
+// removeStructure stops monitoring an added structure and removes the queries for it, telling
+// their owners. It returns the structure's name and how many queries were removed.
+func removeStructure(ctx context.Context, st store.Store, id string) (string, int, error) {
+	ss, err := st.ListStructures(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	name := ""
+	for _, s := range ss {
+		if s.ID == id {
+			name = s.Name
+		}
+	}
+	if name == "" {
+		return "", 0, fmt.Errorf("%s was not added with /add_structure (configured refuges are removed from REFUGES_FILE)", id)
+	}
+	if err := st.DeleteStructure(ctx, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return "", 0, err
+	}
+	if err := LoadStructures(ctx, st); err != nil {
+		return name, 0, err
+	}
+	removed, err := removeQueriesFor(ctx, st, name)
+	return name, removed, err
+}
+
+// removeQueriesFor deletes the queries for refuge and sends each owner one message listing theirs
+func removeQueriesFor(ctx context.Context, st store.Store, refuge string) (int, error) {
+	qs, err := st.ListAllQueries(ctx)
+	if err != nil {
+		return 0, err
+	}
+	byChat := map[string][]store.Query{}
+	removed := 0
+	for _, q := range qs {
+		if q.Refuge != refuge {
+			continue
+		}
+		if err := st.DeleteQuery(ctx, q.ID); err != nil {
+			slog.Error("failed to remove query", "query_id", q.ID, "refuge", refuge, "error", err)
+			continue
+		}
+		byChat[q.ChatID] = append(byChat[q.ChatID], q)
+		removed++
+	}
+	chats := make([]string, 0, len(byChat))
+	for chatID := range byChat {
+		chats = append(chats, chatID)
+	}
+	sort.Strings(chats)
+	for _, chatID := range chats {
+		lang := "en"
+		if sub, err := st.GetSubscriber(ctx, chatID); err == nil {
+			lang = i18n.Supported(sub.Language)
+		}
+		qs := byChat[chatID]
+		sortQueries(qs)
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf(i18n.T(lang, "structure_removed"), html.EscapeString(refuge)) + "\n")
+		for _, q := range qs {
+			b.WriteString("• " + html.EscapeString(formatQuery(q, lang)) + "\n")
+		}
+		if err := sendMessageTo(chatID, b.String()); err != nil {
+			slog.Error("failed to send removed queries notice", "chat_id", chatID, "error", err)
+		}
+	}
+	return removed, nil
+}
+
+// handleAddStructureCommand runs the admin "/add_structure <BK_STRUCTURE:id> <display name>" command
+func handleAddStructureCommand(ctx context.Context, st store.Store, chatID string, args []string, now time.Time) string {
+	if len(args) < 2 {
+		return structureUsage
+	}
+	rc := parser.RefugeConfig{StructureID: args[0], Name: strings.Join(args[1:], " ")}
+	refuge, err := addStructure(ctx, st, rc, chatID, now)
+	if err != nil {
+		slog.Error("/add_structure failed", "structure_id", rc.StructureID, "error", err)
+		return fmt.Sprintf("❌ Could not add %s: %v", rc.StructureID, err)
+	}
+	open := 0
+	for _, day := range refuge.Days() {
+		if day.Available() {
+			open++
+		}
+	}
+	slog.Info("structure added", "chat_id", chatID, "refuge", rc.Name, "structure_id", rc.StructureID)
+	return fmt.Sprintf("✅ Now monitoring %s (%s): %d dates in %s, %d with free places", rc.Name, rc.StructureID, len(refuge.Dates), now.Format("2006-01"), open)
+}
+
+// handleRemoveStructureCommand runs the admin "/remove_structure <BK_STRUCTURE:id>" command
+func handleRemoveStructureCommand(ctx context.Context, st store.Store, args []string) string {
+	if len(args) != 1 {
+		return structureUsage
+	}
+	name, removed, err := removeStructure(ctx, st, args[0])
+	if err != nil {
+		slog.Error("/remove_structure failed", "structure_id", args[0], "error", err)
+		return fmt.Sprintf("❌ Could not remove %s: %v", args[0], err)
+	}
+	slog.Info("structure removed", "refuge", name, "structure_id", args[0], "queries", removed)
+	return fmt.Sprintf("✅ Stopped monitoring %s (%s), %d subscriptions removed and their owners told", name, args[0], removed)
+}
+
+// replyStructureCommand sends the result of an admin /add_structure or /remove_structure command
+func replyStructureCommand(ctx context.Context, st store.Store, chatID string, txt string) {
+	fields := strings.Fields(txt)
+	reply := handleRemoveStructureCommand(ctx, st, fields[1:])
+	if fields[0] == "/add_structure" {
+		reply = handleAddStructureCommand(ctx, st, chatID, fields[1:], time.Now())
+	}
+	_ = sendTo(ctx, chatID, html.EscapeString(reply))
+}
+
+// refugeCode is the deep link code of a refuge: tr and dg for the built-in huts (links already
+// sent use them), s<number> for other structures and any for every refuge
+func refugeCode(refuge string) string {
+	switch refuge {
+	case "Tête Rousse":
+		return "tr"
+	case "du Goûter":
+		return "dg"
+	}
+	if rc, ok := parser.FindRefuge(parser.RefugeConfig{Name: refuge}); ok && refuge != "" {
+		return "s" + strings.TrimPrefix(rc.StructureID, "BK_STRUCTURE:")
+	}
+	return "any"
+}
+
+// refugeFromCode is the inverse of refugeCode; unknown codes mean every refuge
+func refugeFromCode(code string) string {
+	switch code {
+	case "tr":
+		return "Tête Rousse"
+	case "dg":
+		return "du Goûter"
+	}
+	if n, ok := strings.CutPrefix(code, "s"); ok && n != "" {
+		if rc, ok := parser.FindRefuge(parser.RefugeConfig{StructureID: "BK_STRUCTURE:" + n}); ok {
+			return rc.Name
+		}
+	}
+	return "*"
+}
+
+// refugeOption is an entry of the subscribe form's refuge list
+type refugeOption struct {
+	Value string
+	Label string
+}
+
+// refugeOptions lists the live registry for the subscribe form; French "du …" and "de …" names
+// read as "Refuge du …"
+func refugeOptions() []refugeOption {
+	var opts []refugeOption
+	for _, rc := range parser.Refuges() {
+		label := rc.Name
+		if strings.HasPrefix(label, "du ") || strings.HasPrefix(label, "de ") || strings.HasPrefix(label, "des ") {
+			label = "Refuge " + label
+		}
+		opts = append(opts, refugeOption{Value: rc.Name, Label: label})
+	}
+	return opts
+}
@@ -0,0 +1,134 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// fakeStructurePage is a month of BK_STRUCTURE:31 with one bookable and one full date
+const fakeStructurePage = `<!DOCTYPE html>
+<html>
+<body>
+    <div class="day dispo">
+        <a href="#"><span class="date">08/05</span><span class="place">3</span></a>
+    </div>
+    <div class="day complet">08/06</div>
+</body>
+</html>`
+
+// withFakeStructures points the parser at an FFCAM endpoint that only knows BK_STRUCTURE:31;
+// other structures get a calendar without dates
+func withFakeStructures(t *testing.T) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.FormValue("structure") == "BK_STRUCTURE:31" {
+			w.Write([]byte(fakeStructurePage))
+			return
+		}
+		w.Write([]byte("<!DOCTYPE html>\n<html>\n<body>\n    <div class=\"calendar\">\n" + strings.Repeat("    <div class=\"week\"></div>\n", 8) + "    </div>\n</body>\n</html>"))
+	}))
+	t.Cleanup(srv.Close)
+	parser.SetAvailabilityURL(srv.URL)
+	parser.UseSession(parser.NewSession("", nil, parser.Credentials{SessionID: "test"}))
+	prev := parser.FFCAMLimiter
+	parser.FFCAMLimiter = parser.NewRateLimiter(1000, 1, time.Now)
+	t.Cleanup(func() { parser.FFCAMLimiter = prev; parser.SetAddedRefuges(nil) })
+}
+
+func TestAddStructure(t *testing.T) {
+	withFakeStructures(t)
+	st := store.NewMemory()
+	now := time.Date(2025, 8, 1, 9, 0, 0, 0, time.UTC)
+
+	for args, want := range map[string]string{
+		"STRUCTURE:31 Cosmiques":      "invalid structure ID",
+		"BK_STRUCTURE:29 Tête Rousse": "already monitored as Tête Rousse",
+		"BK_STRUCTURE:99 Nowhere":     "test fetch failed: no dates found",
+		"BK_STRUCTURE:31":             structureUsage,
+	} {
+		if got := handleAddStructureCommand(t.Context(), st, "42", strings.Fields(args), now); !strings.Contains(got, want) {
+			t.Errorf("/add_structure %s: expected %q, got %q", args, want, got)
+		}
+	}
+	if structs, _ := st.ListStructures(t.Context()); len(structs) != 0 || len(parser.Refuges()) != len(parser.DefaultRefuges) {
+		t.Fatalf("expected nothing added, got %+v %+v", structs, parser.Refuges())
+	}
+
+	got := handleAddStructureCommand(t.Context(), st, "42", []string{"BK_STRUCTURE:31", "des", "Cosmiques"}, now)
+	if got != "✅ Now monitoring des Cosmiques (BK_STRUCTURE:31): 2 dates in 2025-08, 1 with free places" {
+		t.Errorf("unexpected reply %q", got)
+	}
+	if structs, _ := st.ListStructures(t.Context()); len(structs) != 1 || structs[0] != (store.Structure{ID: "BK_STRUCTURE:31", Name: "des Cosmiques", AddedBy: "42", AddedAt: now}) {
+		t.Errorf("expected the structure stored, got %+v", structs)
+	}
+	if rc, ok := parser.FindRefuge(parser.RefugeConfig{Name: "des Cosmiques"}); !ok || rc.StructureID != "BK_STRUCTURE:31" {
+		t.Errorf("expected the structure in the live registry, got %+v", parser.Refuges())
+	}
+	// the web form and deep links know it right away
+	opts := refugeOptions()
+	if last := opts[len(opts)-1]; last != (refugeOption{Value: "des Cosmiques", Label: "Refuge des Cosmiques"}) {
+		t.Errorf("unexpected form options %+v", opts)
+	}
+	if code := refugeCode("des Cosmiques"); code != "s31" || refugeFromCode(code) != "des Cosmiques" {
+		t.Errorf("unexpected deep link code %q", code)
+	}
+	if refugeCode("Tête Rousse") != "tr" || refugeFromCode("s77") != "*" || refugeCode("*") != "any" {
+		t.Error("expected the built-in and unknown codes unchanged")
+	}
+}
+
+func TestRemoveStructureRemovesDependentQueries(t *testing.T) {
+	withFakeStructures(t)
+	sent := captureSends(t)
+	st := store.NewMemory()
+	st.AddStructure(t.Context(), store.Structure{ID: "BK_STRUCTURE:31", Name: "Cosmiques", AddedBy: "42"})
+	if err := LoadStructures(t.Context(), st); err != nil {
+		t.Fatal(err)
+	}
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "fr", Plan: store.PlanPro, IsActive: true})
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "2", Language: "en", IsActive: true})
+	created := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, q := range []store.Query{
+		{ID: "a", ChatID: "1", Refuge: "Cosmiques", DateFrom: "2025-08-01", DateTo: "2025-08-10"},
+		{ID: "b", ChatID: "1", Refuge: "Cosmiques", DateFrom: "2025-09-01", DateTo: "2025-09-02", MinPlaces: 2},
+		{ID: "c", ChatID: "1", Refuge: "*"},
+		{ID: "d", ChatID: "2", Refuge: "Tête Rousse"},
+	} {
+		q.CreatedAt = created.Add(time.Duration(i) * time.Minute)
+		st.AddQuery(t.Context(), q)
+	}
+
+	if got := handleRemoveStructureCommand(t.Context(), st, []string{"BK_STRUCTURE:29"}); !strings.Contains(got, "was not added with /add_structure") {
+		t.Errorf("expected configured refuges to be refused, got %q", got)
+	}
+	got := handleRemoveStructureCommand(t.Context(), st, []string{"BK_STRUCTURE:31"})
+	if got != "✅ Stopped monitoring Cosmiques (BK_STRUCTURE:31), 2 subscriptions removed and their owners told" {
+		t.Errorf("unexpected reply %q", got)
+	}
+	structs, _ := st.ListStructures(t.Context())
+	if _, ok := parser.FindRefuge(parser.RefugeConfig{Name: "Cosmiques"}); ok || len(structs) != 0 {
+		t.Errorf("expected the structure gone, got %+v", parser.Refuges())
+	}
+	if _, err := st.GetQuery(t.Context(), "a"); err == nil {
+		t.Error("expected query a removed")
+	}
+	if _, err := st.GetQuery(t.Context(), "c"); err != nil {
+		t.Error("expected the any-refuge query kept")
+	}
+	if _, err := st.GetQuery(t.Context(), "d"); err != nil {
+		t.Error("expected the other refuge's query kept")
+	}
+	want := "1: ⚠️ Cosmiques n'est plus surveillé, ces abonnements ont donc été supprimés :\n" +
+		"• Cosmiques: 2025-08-01 → 2025-08-10\n" +
+		"• Cosmiques: 2025-09-01 → 2025-09-02 (≥2 places)\n"
+	if len(*sent) != 1 || (*sent)[0] != want {
+		t.Errorf("expected one message to the owner, got %q", *sent)
+	}
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// testAlertCooldown is the least time between two test alerts of a chat: they may be emailed to
+// an address nobody verified
+const testAlertCooldown = time.Minute
+
+// handleTestCommand sends chatID a test alert (the /test command and the button of the
+// subscription page) and returns the delivery report. Stopped subscriptions get none, and a chat
+// gets at most one per testAlertCooldown.
+func handleTestCommand(ctx context.Context, st store.Store, chatID string, now time.Time) string {
+	if settings.TestAlert == nil {
+		return "Test alerts are not available right now."
+	}
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "You have no subscription yet. Send /start to subscribe."
+	}
+	if err != nil {
+		slog.Error("test alert failed to load subscriber", "chat_id", chatID, "error", err)
+		return "Could not send the test alert, please try again later."
+	}
+	if !sub.IsActive {
+		return "Your subscription is stopped. Send /start to subscribe again."
+	}
+	key := store.TestAlertPrefix + chatID
+	if last, err := st.GetSetting(ctx, key); err == nil {
+		if at, err := time.Parse(time.RFC3339, last); err == nil && now.Sub(at) < testAlertCooldown {
+			return "A test alert was just sent, please wait a minute before the next one."
+		}
+	}
+	// recorded first, so a failing store can't be used to send test alerts without a limit
+	if err := st.SetSetting(ctx, key, now.UTC().Format(time.RFC3339)); err != nil {
+		slog.Error("test alert not recorded", "chat_id", chatID, "error", err)
+		return "Could not send the test alert, please try again later."
+	}
+	report, err := settings.TestAlert(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "You have no subscription yet. Send /start to subscribe."
+	}
+	if err != nil {
+		slog.Error("test alert failed", "chat_id", chatID, "error", err)
+		return "Could not send the test alert, please try again later."
+	}
+	slog.Info("test alert sent", "chat_id", chatID)
+	return report
+}
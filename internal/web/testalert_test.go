@@ -0,0 +1,116 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+func TestTestCommand(t *testing.T) {
+	var replies, tested []string
+	useSettings(t, func(s *Settings) {
+		s.Notifier = notify.Func(func(_ context.Context, chatID string, message string) error {
+			replies = append(replies, chatID+": "+message)
+			return nil
+		})
+	})
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "7", IsActive: true})
+	send := func(text string) {
+		ProcessUpdate(t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 7}, Text: text}}, st)
+	}
+
+	send("/test")
+	if len(replies) != 1 || replies[0] != "7: Test alerts are not available right now." {
+		t.Errorf("reply without a scheduler %q", replies)
+	}
+
+	UseTestAlert(func(_ context.Context, chatID string) (string, error) {
+		tested = append(tested, chatID)
+		if chatID != "7" {
+			return "", store.ErrNotFound
+		}
+		return "🧪 Test alert about Tête Rousse on 2025-07-02: sent to Telegram.", nil
+	})
+	send("/test")
+	if len(tested) != 1 || len(replies) != 2 || replies[1] != "7: 🧪 Test alert about Tête Rousse on 2025-07-02: sent to Telegram." {
+		t.Errorf("tested %q, replied %q", tested, replies)
+	}
+	if got := handleTestCommand(t.Context(), st, "8", time.Now()); !strings.Contains(got, "/start") || len(tested) != 1 {
+		t.Errorf("unknown chat got %q, tested %q", got, tested)
+	}
+}
+
+func TestTestAlertsAreThrottled(t *testing.T) {
+	var tested []string
+	useSettings(t, func(s *Settings) {
+		s.TestAlert = func(_ context.Context, chatID string) (string, error) {
+			tested = append(tested, chatID)
+			return "sent", nil
+		}
+	})
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", IsActive: true, Email: "someone@example.org"})
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "2", IsActive: false})
+	now := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+
+	if got := handleTestCommand(t.Context(), st, "1", now); got != "sent" {
+		t.Errorf("first test alert: %q", got)
+	}
+	if got := handleTestCommand(t.Context(), st, "1", now.Add(59*time.Second)); !strings.Contains(got, "wait a minute") {
+		t.Errorf("second test alert within a minute: %q", got)
+	}
+	if got := handleTestCommand(t.Context(), st, "1", now.Add(time.Minute)); got != "sent" {
+		t.Errorf("test alert after the cooldown: %q", got)
+	}
+	if got := handleTestCommand(t.Context(), st, "2", now); !strings.Contains(got, "stopped") {
+		t.Errorf("stopped subscription got %q", got)
+	}
+	if len(tested) != 2 || tested[0] != "1" || tested[1] != "1" {
+		t.Errorf("tested %q, want two test alerts to 1", tested)
+	}
+}
+
+func TestSubscriptionPageSendsTestAlerts(t *testing.T) {
+	var tested []string
+	useSettings(t, func(s *Settings) {
+		s.UnsubscribeSecret = "s3cret"
+		s.TestAlert = func(_ context.Context, chatID string) (string, error) {
+			tested = append(tested, chatID)
+			return "🧪 Test alert about Tête Rousse on 2025-07-02: sent to Telegram.", nil
+		}
+	})
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "42", Language: "de", IsActive: true})
+	link, _ := url.Parse(UnsubscribeURL("42", "de"))
+	form := link.Query()
+
+	rec := unsubscribeRequest(st, http.MethodGet, form)
+	if !strings.Contains(rec.Body.String(), "Testbenachrichtigung senden") || len(tested) != 0 {
+		t.Fatalf("expected the test button, got %s", rec.Body.String())
+	}
+	form.Set("action", "test")
+	rec = unsubscribeRequest(st, http.MethodPost, form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "sent to Telegram") {
+		t.Fatalf("expected the delivery report, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(tested) != 1 || tested[0] != "42" {
+		t.Errorf("tested %q", tested)
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "42"); !sub.IsActive {
+		t.Error("the test button unsubscribed")
+	}
+
+	// a forged token sends nothing
+	form.Set("chat_id", "43")
+	if rec := unsubscribeRequest(st, http.MethodPost, form); rec.Code != http.StatusForbidden || len(tested) != 1 {
+		t.Errorf("forged test request: %d, tested %q", rec.Code, tested)
+	}
+}
@@ -0,0 +1,132 @@
+package web
+
+import (
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+// trendWindow is how far back the capacity trend of a date looks
+const trendWindow = time.Hour
+
+// maxHistory caps the snapshot ring regardless of the check interval
+const maxHistory = 120
+
+// historyRecord is the free places per refuge and date seen by one check
+type historyRecord struct {
+	At     time.Time
+	Places map[string]int // historyKey(refuge, date) -> places, available dates only
+}
+
+// observation is one check's free places for a date
+type observation struct {
+	At     time.Time
+	Places int
+}
+
+type trend int
+
+const (
+	trendNone trend = iota // not enough data
+	trendDown
+	trendUp
+	trendStable
+)
+
+// Arrow is the indicator shown next to the places count
+func (t trend) Arrow() string {
+	switch t {
+	case trendDown:
+		return "↓"
+	case trendUp:
+		return "↑"
+	case trendStable:
+		return "→"
+	}
+	return ""
+}
+
+// key is the i18n key of the trend's tooltip
+func (t trend) key() string {
+	switch t {
+	case trendDown:
+		return "trend_down"
+	case trendUp:
+		return "trend_up"
+	case trendStable:
+		return "trend_stable"
+	}
+	return ""
+}
+
+func historyKey(refuge string, date string) string {
+	return refuge + "|" + date
+}
+
+// newHistoryRecord captures the available dates of refuges as seen at at
+func newHistoryRecord(refuges []parser.Refuge, at time.Time) historyRecord {
+	rec := historyRecord{At: at, Places: make(map[string]int)}
+	for _, rf := range refuges {
+		for _, day := range rf.Days() {
+			if day.Available() {
+				rec.Places[historyKey(rf.Name, day.Key())] = day.Places
+			}
+		}
+	}
+	return rec
+}
+
+// appendHistory adds rec to the ring, dropping records that fell out of the trend window.
+// The returned slice is new so snapshots sharing the old one are unaffected.
+func appendHistory(history []historyRecord, rec historyRecord) []historyRecord {
+	out := make([]historyRecord, 0, len(history)+1)
+	for _, h := range history {
+		if !h.At.Before(rec.At.Add(-trendWindow)) {
+			out = append(out, h)
+		}
+	}
+	out = append(out, rec)
+	if len(out) > maxHistory {
+		out = out[len(out)-maxHistory:]
+	}
+	return out
+}
+
+// seriesFor returns the observations of a date in time order; checks where it wasn't available are skipped
+func seriesFor(history []historyRecord, refuge string, date string) []observation {
+	var series []observation
+	key := historyKey(refuge, date)
+	for _, h := range history {
+		if places, ok := h.Places[key]; ok {
+			series = append(series, observation{At: h.At, Places: places})
+		}
+	}
+	return series
+}
+
+// placesTrend compares the latest observation with the oldest one inside the window ending at now.
+// series must be time-ordered; a single observation in the window gives trendNone, and values that
+// went up and down but ended where they started are stable.
+func placesTrend(series []observation, now time.Time, window time.Duration) trend {
+	var first, last *observation
+	for i := range series {
+		o := &series[i]
+		if o.At.Before(now.Add(-window)) || o.At.After(now) {
+			continue
+		}
+		if first == nil {
+			first = o
+		}
+		last = o
+	}
+	if first == nil || first == last {
+		return trendNone
+	}
+	switch {
+	case last.Places < first.Places:
+		return trendDown
+	case last.Places > first.Places:
+		return trendUp
+	}
+	return trendStable
+}
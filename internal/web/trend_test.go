@@ -0,0 +1,71 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+)
+
+func TestPlacesTrend(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutesAgo int, places int) observation {
+		return observation{At: now.Add(-time.Duration(minutesAgo) * time.Minute), Places: places}
+	}
+	cases := []struct {
+		name   string
+		series []observation
+		want   trend
+	}{
+		{"empty", nil, trendNone},
+		{"single observation", []observation{at(0, 2)}, trendNone},
+		{"decreasing", []observation{at(60, 6), at(30, 4), at(0, 2)}, trendDown},
+		{"increasing", []observation{at(45, 1), at(0, 5)}, trendUp},
+		{"stable", []observation{at(50, 3), at(20, 3), at(0, 3)}, trendStable},
+		{"flapping back to the start", []observation{at(50, 4), at(40, 6), at(30, 2), at(0, 4)}, trendStable},
+		// sparse: the earlier check is outside the window, leaving a single observation
+		{"sparse", []observation{at(180, 9), at(0, 2)}, trendNone},
+		{"older points ignored", []observation{at(120, 1), at(40, 6), at(0, 3)}, trendDown},
+		{"future points ignored", []observation{at(30, 2), at(0, 2), at(-10, 8)}, trendStable},
+	}
+	for _, c := range cases {
+		if got := placesTrend(c.series, now, trendWindow); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestAppendHistoryDropsOldRecords(t *testing.T) {
+	start := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	var history []historyRecord
+	for i := 0; i < 10; i++ {
+		history = appendHistory(history, historyRecord{At: start.Add(time.Duration(i) * 15 * time.Minute)})
+	}
+	// records at 1h15 .. 2h15: exactly one window back from the newest is kept
+	if len(history) != 5 || !history[0].At.Equal(start.Add(75*time.Minute)) {
+		t.Errorf("unexpected history %v", history)
+	}
+}
+
+func TestHomeShowsTrend(t *testing.T) {
+	prev := current.Load()
+	current.Store(nil)
+	defer current.Store(prev)
+
+	date := time.Now().UTC().Truncate(24 * time.Hour).Format("2006-01-02")
+	now := time.Now().UTC()
+	UpdateState([]parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{date: "6"}}}, now.Add(-40*time.Minute))
+	UpdateState([]parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{date: "2"}}}, now)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/?lang=de", nil)
+	NewServer(nil).handleHome(rec, req)
+	want := `<span title="` + i18n.T("de", "trend_down") + `">↓</span>`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("expected decreasing trend in table, want %s", want)
+	}
+}
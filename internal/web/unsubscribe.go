@@ -0,0 +1,148 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// unsubscribeToken signs chatID for the one-click unsubscribe link with UNSUBSCRIBE_SECRET;
+// ok is false when the secret isn't set, which disables the link
+func unsubscribeToken(chatID string) (token string, ok bool) {
+	secret := settings.UnsubscribeSecret
+	if secret == "" {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe:" + chatID))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), true
+}
+
+// validUnsubscribeToken reports whether token was issued for chatID
+func validUnsubscribeToken(chatID string, token string) bool {
+	expected, ok := unsubscribeToken(chatID)
+	return ok && chatIDPattern.MatchString(chatID) && hmac.Equal([]byte(token), []byte(expected))
+}
+
+// UnsubscribeURL returns the one-click unsubscribe link of chatID ("" when disabled)
+func UnsubscribeURL(chatID string, lang string) string {
+	token, ok := unsubscribeToken(chatID)
+	if !ok {
+		return ""
+	}
+	q := url.Values{"chat_id": {chatID}, "token": {token}, "lang": {i18n.Supported(lang)}}
+	return baseURL() + "/unsubscribe?" + q.Encode()
+}
+
+// withUnsubscribeLink appends the localized unsubscribe link to a confirmation message
+// sent with parse_mode HTML
+func withUnsubscribeLink(msg string, chatID string, lang string) string {
+	if link := UnsubscribeURL(chatID, lang); link != "" {
+		return msg + "\n\n" + fmt.Sprintf(i18n.T(lang, "unsub_link"), html.EscapeString(link))
+	}
+	return msg
+}
+
+var unsubscribeTmpl = template.Must(template.New("unsubscribe").Funcs(template.FuncMap{
+	"T": func(lang string, key string) string { return i18n.T(lang, key) },
+}).Parse(`<!doctype html>
+<html lang="{{.Lang}}"><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{T .Lang "unsub_title"}}</title></head>
+<body style="font-family:sans-serif; max-width:560px; margin:48px auto; text-align:center;">
+<h1>{{T .Lang "unsub_title"}}</h1>
+{{if .Invalid}}<p>{{T .Lang "unsub_invalid"}}</p>
+{{else if .Done}}<p>{{T .Lang "unsub_done"}}</p>
+{{else}}<p>{{T .Lang "unsub_confirm"}}</p>
+<form method="post">
+<input type="hidden" name="chat_id" value="{{.ChatID}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="lang" value="{{.Lang}}">
+<button type="submit">{{T .Lang "unsub_button"}}</button>
+</form>
+{{if .Testable}}<hr style="margin:32px 0;">
+<p>{{T .Lang "unsub_test_intro"}}</p>
+{{with .TestReport}}<p>{{.}}</p>{{end}}
+<form method="post">
+<input type="hidden" name="chat_id" value="{{.ChatID}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="lang" value="{{.Lang}}">
+<input type="hidden" name="action" value="test">
+<button type="submit">{{T .Lang "unsub_test_button"}}</button>
+</form>
+{{end}}
+{{end}}
+</body></html>
+`))
+
+// handleUnsubscribe serves the one-click unsubscribe link: GET asks for confirmation (so link
+// previews can't unsubscribe anyone) and POST deactivates the subscriber. The page also has a
+// "Send test alert" button, posting action=test.
+func (s *Server) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	if _, ok := unsubscribeToken(""); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	view := struct {
+		Lang, ChatID, Token     string
+		Invalid, Done, Testable bool
+		TestReport              string
+	}{Lang: i18n.Supported(r.FormValue("lang")), ChatID: r.FormValue("chat_id"), Token: r.FormValue("token"), Testable: settings.TestAlert != nil}
+	status := http.StatusOK
+	switch {
+	case !validUnsubscribeToken(view.ChatID, view.Token):
+		view.Invalid, status = true, http.StatusForbidden
+	case r.Method == http.MethodPost && r.FormValue("action") == "test":
+		if !s.storeAvailable(w) {
+			return
+		}
+		view.TestReport = handleTestCommand(r.Context(), s.store, view.ChatID, time.Now())
+	case r.Method == http.MethodPost:
+		if !s.storeAvailable(w) {
+			return
+		}
+		if err := unsubscribe(r.Context(), s.store, view.ChatID); err != nil {
+			slog.Error("web unsubscribe failed", "chat_id", view.ChatID, "error", err)
+			http.Error(w, "Could not unsubscribe, please try again later.", http.StatusInternalServerError)
+			return
+		}
+		view.Done = true
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := unsubscribeTmpl.Execute(w, view); err != nil {
+		slog.Error("unsubscribe template error", "error", err)
+	}
+}
+
+// unsubscribe deactivates chatID; an unknown or already inactive chat is not an error
+func unsubscribe(ctx context.Context, st store.Store, chatID string) error {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !sub.IsActive) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := st.DeactivateSubscriber(ctx, chatID); err != nil {
+		return err
+	}
+	notifyAdmins(ctx, fmt.Sprintf("🛑 Unsubscribed via web link: chat_id=%s @%s", chatID, telegram.EscapeHTML(sub.Username)))
+	return nil
+}
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func unsubscribeRequest(st store.Store, method string, form url.Values) *httptest.ResponseRecorder {
+	var req *http.Request
+	if method == http.MethodPost {
+		req = httptest.NewRequest(method, "/unsubscribe", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, "/unsubscribe?"+form.Encode(), nil)
+	}
+	rec := httptest.NewRecorder()
+	NewServer(st).handleUnsubscribe(rec, req)
+	return rec
+}
+
+func TestUnsubscribeLink(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.UnsubscribeSecret = "s3cret" })
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "42", Language: "fr", IsActive: true})
+
+	link, err := url.Parse(UnsubscribeURL("42", "fr"))
+	if err != nil || link.Path != "/unsubscribe" {
+		t.Fatalf("unexpected link %v: %v", link, err)
+	}
+	form := link.Query()
+
+	// opening the link (or a link preview fetching it) only asks for confirmation
+	rec := unsubscribeRequest(st, http.MethodGet, form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Se désabonner") {
+		t.Fatalf("expected a localized confirmation form, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "42"); !sub.IsActive {
+		t.Fatal("GET must not unsubscribe")
+	}
+
+	rec = unsubscribeRequest(st, http.MethodPost, form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Vous êtes désabonné") {
+		t.Fatalf("expected a localized success page, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "42"); sub.IsActive {
+		t.Fatal("expected the subscriber to be deactivated")
+	}
+
+	// the link keeps working once used
+	if rec := unsubscribeRequest(st, http.MethodPost, form); rec.Code != http.StatusOK {
+		t.Fatalf("expected a repeated click to succeed, got %d", rec.Code)
+	}
+}
+
+func TestUnsubscribeRejectsForgedTokens(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.UnsubscribeSecret = "s3cret" })
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "43", IsActive: true})
+
+	// a valid token for one chat doesn't unsubscribe the next chat ID
+	form, _ := url.Parse(UnsubscribeURL("42", "en"))
+	q := form.Query()
+	q.Set("chat_id", "43")
+	for _, f := range []url.Values{q, {"chat_id": {"43"}}, {"chat_id": {"43"}, "token": {"00"}}} {
+		if rec := unsubscribeRequest(st, http.MethodPost, f); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "invalid") {
+			t.Errorf("expected %v to be rejected, got %d", f, rec.Code)
+		}
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "43"); !sub.IsActive {
+		t.Fatal("a forged link must not unsubscribe")
+	}
+}
+
+func TestUnsubscribeDisabledWithoutSecret(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.UnsubscribeSecret = "" })
+	if link := UnsubscribeURL("42", "en"); link != "" {
+		t.Errorf("expected no link without a secret, got %q", link)
+	}
+	if msg := withUnsubscribeLink("saved", "42", "en"); msg != "saved" {
+		t.Errorf("expected the message unchanged, got %q", msg)
+	}
+	if rec := unsubscribeRequest(nil, http.MethodGet, url.Values{"chat_id": {"42"}}); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a secret, got %d", rec.Code)
+	}
+}
@@ -4,89 +4,159 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"embed"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"html/template"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/mail"
 	"os"
 	"os/signal"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/AlexYaroshenko/montblanc/internal/config"
 	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/metrics"
 	"github.com/AlexYaroshenko/montblanc/internal/parser"
 	"github.com/AlexYaroshenko/montblanc/internal/store"
 	"github.com/AlexYaroshenko/montblanc/internal/telegram"
 )
 
-var (
-	state struct {
-		Refuges   []parser.Refuge
-		LastCheck time.Time
-		mu        sync.RWMutex
+// snapshot is the availability shown by the site; it is replaced as a whole and never modified,
+// so readers need no lock and the check loop never waits for them
+type snapshot struct {
+	Refuges   []parser.Refuge
+	LastCheck time.Time
+	History   []historyRecord // recent checks, oldest first, for capacity trends
+}
+
+var current atomic.Pointer[snapshot]
+
+// currentSnapshot returns the latest snapshot (empty before the first check)
+func currentSnapshot() *snapshot {
+	if s := current.Load(); s != nil {
+		return s
 	}
-)
+	return &snapshot{}
+}
+
+// swapSnapshot replaces the snapshot with update(previous)
+func swapSnapshot(update func(prev snapshot) snapshot) snapshot {
+	for {
+		prev := current.Load()
+		base := snapshot{}
+		if prev != nil {
+			base = *prev
+		}
+		next := update(base)
+		if current.CompareAndSwap(prev, &next) {
+			return next
+		}
+	}
+}
+
+// maxMinPlaces caps the "minimum places" filter of the subscribe form
+const maxMinPlaces = 20
 
 //go:embed static/*
 var embeddedStaticFS embed.FS
 
-func StartServer() {
+// Server is the site: its routes live on a mux of its own, so several servers can run in
+// one process (as tests do) without clashing on http.DefaultServeMux
+type Server struct {
+	mux   *http.ServeMux
+	store store.Store // shared by every request; nil when the site runs without one
+
+	mu     sync.Mutex // guards the lifecycle below
+	state  serverState
+	http   *http.Server
+	addr   string             // the listener's address once started
+	cancel context.CancelFunc // stops the background goroutines
+	wg     sync.WaitGroup     // the serving and keep-alive goroutines
+}
+
+// NewServer returns a Server with all the site's routes registered, serving from st. With a nil
+// st the pages that need the store answer 503.
+func NewServer(st store.Store) *Server {
+	s := &Server{mux: http.NewServeMux(), store: st}
+	mux := s.mux
 	// static files (embedded)
 	sub, err := fs.Sub(embeddedStaticFS, "static")
 	if err == nil {
-		http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(sub))))
+		mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(sub))))
 	} else {
-		log.Printf("❌ static fs error: %v", err)
+		slog.Error("static fs error", "error", err)
 	}
-	http.HandleFunc("/", handleHome)
-	http.HandleFunc("/telegram/webhook", handleTelegramWebhook)
-	http.HandleFunc("/subscribe", handleSubscribe)
-	http.HandleFunc("/status", handleStatus)
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", s.handleHome)
+	// localized refuge pages; one pattern per language so they don't clash with /static/
+	for _, lang := range i18n.Languages() {
+		mux.HandleFunc("/"+lang+"/refuge/{slug}", s.handleRefugePage)
+	}
+	mux.HandleFunc("/telegram/webhook", s.handleTelegramWebhook)
+	mux.HandleFunc("/subscribe", s.handleSubscribe)
+	mux.HandleFunc("/unsubscribe", s.handleUnsubscribe)
+	mux.HandleFunc("/calendar/{file}", s.handleCalendar)
+	mux.HandleFunc("/qr.png", handleQRCode)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/api/v1/availability", handleAvailabilityAPI)
+	mux.HandleFunc("/api/v2/availability", handleAvailabilityAPIV2)
+	mux.HandleFunc("/api/v1/history", s.handleHistoryAPI)
+	mux.HandleFunc("/api/v1/changes", s.handleChangesAPI)
+	mux.HandleFunc("/api/v1/retention", handleRetentionAPI)
+	mux.HandleFunc("/admin/queries/import", adminRoute(s.handleQueryImport))
+	mux.HandleFunc("/admin/config", adminRoute(handleAdminConfig))
+	mux.HandleFunc("/admin/subscribers", adminRoute(s.handleAdminSubscribers))
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	return s
+}
 
-	// Initialize LastCheck time
-	state.mu.Lock()
-	state.LastCheck = time.Now()
-	state.mu.Unlock()
+// Handler returns the server's routes, e.g. for httptest.NewServer
+func (s *Server) Handler() http.Handler { return s.mux }
 
-	// Get port from environment variable or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	// Create server with timeouts
-	server := &http.Server{
-		Addr:         ":" + port,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+// storeAvailable answers 503 when the server has no store, reporting whether it has one
+func (s *Server) storeAvailable(w http.ResponseWriter) bool {
+	if s.store == nil {
+		http.Error(w, "store unavailable", http.StatusServiceUnavailable)
+		return false
 	}
+	return true
+}
 
-	// Start server in a goroutine
-	go func() {
-		log.Printf("🌐 Starting web server on port %s...", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("❌ Server error: %v", err)
-		}
-	}()
+// StartServer serves the site from st, opened once by the caller, until SIGINT or SIGTERM
+func StartServer(st store.Store) {
+	// Initialize LastCheck time
+	swapSnapshot(func(s snapshot) snapshot {
+		s.LastCheck = time.Now()
+		return s
+	})
 
-	// Start keep-alive goroutine
-	go keepAlive()
+	server := NewServer(st)
+	if err := server.Start(":" + settings.Port); err != nil {
+		slog.Error("server error", "error", err)
+		return
+	}
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 	<-sigChan
 
 	// Create shutdown context with timeout
@@ -95,39 +165,42 @@ func StartServer() {
 
 	// Attempt graceful shutdown
 	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("❌ Server forced to shutdown: %v", err)
+		slog.Error("server forced to shutdown", "error", err)
 	}
 }
 
 func UpdateState(refuges []parser.Refuge, lastCheck time.Time) {
-	state.mu.Lock()
-	defer state.mu.Unlock()
-	state.Refuges = refuges
+	next := swapSnapshot(func(s snapshot) snapshot {
+		s.Refuges = refuges
+		if !lastCheck.IsZero() {
+			s.LastCheck = lastCheck
+			s.History = appendHistory(s.History, newHistoryRecord(refuges, lastCheck))
+		}
+		return s
+	})
 	if !lastCheck.IsZero() {
-		state.LastCheck = lastCheck
-		log.Printf("Updated web state - Last check: %v, Refuges: %d", state.LastCheck, len(state.Refuges))
+		slog.Debug("updated web state", "last_check", next.LastCheck, "refuges", len(next.Refuges))
 	} else {
-		log.Printf("Warning: Attempted to update web state with zero time")
+		slog.Warn("attempted to update web state with zero time")
 	}
 }
 
-func handleHome(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 	lang := i18n.DetectLang(r)
-	// Copy state under lock into a lightweight view model (no mutex)
-	state.mu.RLock()
+	// Build a lightweight view model from the current snapshot
+	state := s.snapshot(r.Context())
 	// Build bot deep link
-	botUsername := os.Getenv("TELEGRAM_BOT_USERNAME")
-	if botUsername == "" {
-		botUsername = "montblanc_booking_bot"
-	}
-	botLink := fmt.Sprintf("https://t.me/%s?start=subscribe", botUsername)
+	startLink := botLink("subscribe")
 	// Google Analytics
-	gaID := os.Getenv("GA_MEASUREMENT_ID")
+	gaID := settings.GAMeasurementID
 
-	// Build small table model for demo: show the next 7 days (a full week)
+	// Build small table model for demo: show the next 7 days (a full week), or the week from ?date
 	weekDates := make([]string, 7)
 	tableHeaders := make([]string, 7)
 	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if d, err := time.Parse("2006-01-02", r.URL.Query().Get("date")); err == nil && d.After(today) {
+		today = d
+	}
 	for i := 0; i < 7; i++ {
 		d := today.AddDate(0, 0, i)
 		weekDates[i] = d.Format("2006-01-02")
@@ -135,60 +208,70 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 	}
 	type tableRow struct {
 		Name  string
-		Cells []string
+		Cells []tableCell
 	}
 	rows := make([]tableRow, 0, len(state.Refuges))
 	for _, rf := range state.Refuges {
-		cells := make([]string, len(weekDates))
+		cells := make([]tableCell, len(weekDates))
 		for i, d := range weekDates {
-			if s, ok := rf.Dates[d]; ok {
-				if s == "Full" {
-					cells[i] = "Full"
-				} else {
-					cells[i] = s
+			cells[i] = tableCell{Text: "—"}
+			if day, ok := rf.Day(d); ok {
+				cells[i] = tableCell{Text: dayCell(day)}
+				if day.Available() {
+					cells[i].URL = parser.BookingLinkFor(rf.Name, d)
+					if t := placesTrend(seriesFor(state.History, rf.Name, d), state.LastCheck, trendWindow); t != trendNone {
+						cells[i].Trend, cells[i].TrendTitle = t.Arrow(), i18n.T(lang, t.key())
+					}
 				}
-			} else {
-				cells[i] = "—"
 			}
 		}
 		rows = append(rows, tableRow{Name: rf.Name, Cells: cells})
 	}
 
 	view := struct {
-		Refuges      []parser.Refuge
-		LastCheck    time.Time
-		BotLink      string
-		TableHeaders []string
-		Rows         []tableRow
-		GAID         string
-		HasSample    bool
-		SampleRefuge string
-		SampleDate   string
-		SamplePlaces string
+		Refuges       []parser.Refuge
+		LastCheck     time.Time
+		Stale         bool
+		BotLink       string
+		TableHeaders  []string
+		Rows          []tableRow
+		GAID          string
+		HasSample     bool
+		SampleRefuge  string
+		SampleDate    string
+		SamplePlaces  int
+		SampleCost    string
+		Weekdays      []weekdayOption
+		RefugeOptions []refugeOption
+		Languages     []refugeOption
 	}{
-		Refuges:      state.Refuges,
-		LastCheck:    state.LastCheck,
-		BotLink:      botLink,
-		TableHeaders: tableHeaders,
-		Rows:         rows,
-		GAID:         gaID,
+		Refuges:       state.Refuges,
+		LastCheck:     state.LastCheck,
+		Stale:         stale(state.LastCheck, time.Now()),
+		BotLink:       startLink,
+		TableHeaders:  tableHeaders,
+		Rows:          rows,
+		GAID:          gaID,
+		Weekdays:      weekdayOptions(lang),
+		RefugeOptions: refugeOptions(),
+		Languages:     languageOptions(),
 	}
-	state.mu.RUnlock()
 
 	// Compute sample card data: earliest available date (prefer Tête Rousse)
 	var (
 		bestRefuge string
 		bestDate   string
-		bestPlaces string
+		bestPlaces int
 	)
 	// Build a map to check preference quickly
 	prefIndex := map[string]int{"Tête Rousse": 0, "du Goûter": 1}
 	bestScore := 999
 	for _, rf := range view.Refuges {
-		for d, s := range rf.Dates {
-			if s == "Full" {
+		for _, day := range rf.Days() {
+			if !day.Available() {
 				continue
 			}
+			d := day.Key()
 			// score by preference and date
 			dateScore := d
 			p := 10
@@ -201,7 +284,7 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 				bestScore = p
 				bestRefuge = rf.Name
 				bestDate = d
-				bestPlaces = s
+				bestPlaces = day.Places
 			}
 		}
 	}
@@ -214,6 +297,7 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 		view.SampleRefuge = bestRefuge
 		view.SampleDate = bestDate
 		view.SamplePlaces = bestPlaces
+		view.SampleCost = CostEstimate(bestRefuge, 0, 1, lang)
 	}
 
 	tmpl := `
@@ -253,6 +337,7 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
         .date.available { background: #e6ffe6; color: var(--ok); font-weight: 700; }
         .places { display: block; font-size: 12px; margin-top: 4px; color: #1b5e20; }
         .last-check { color: var(--muted); font-size: 13px; margin-top: 8px; }
+        .stale { background: #fff4e5; color: #7a4100; padding: 10px 24px; text-align: center; font-size: 14px; }
         /* Hero photos */
         .hero-photos { display: flex; gap: 12px; justify-content: center; margin-top: 18px; flex-wrap: wrap; }
         .hero-photos .photo { display: flex; flex-direction: column; align-items: center; }
@@ -273,14 +358,12 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
     {{end}}
 </head>
 <body>
+    {{if .Stale}}<div class="stale">{{T "stale_data"}}</div>{{end}}
     <div class="nav">
       <div class="brand">Mont Blanc Alerts</div>
       <div class="lang">Lang:
-        <a href="?lang=en">EN</a>
-        <a href="?lang=de">DE</a>
-        <a href="?lang=fr">FR</a>
-        <a href="?lang=es">ES</a>
-        <a href="?lang=it">IT</a>
+        {{range .Languages}}<a href="?lang={{.Value}}">{{.Label}}</a>
+        {{end}}
       </div>
     </div>
 
@@ -336,7 +419,7 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                   <tr>
                     <td style="padding:8px; border-bottom:1px solid #f0f2f5;">{{.Name}}</td>
                     {{range .Cells}}
-                      <td style="text-align:center; padding:8px; border-bottom:1px solid #f0f2f5;">{{.}}</td>
+                      <td style="text-align:center; padding:8px; border-bottom:1px solid #f0f2f5;">{{if .URL}}<a href="{{.URL}}" target="_blank" rel="noopener">{{.Text}}</a>{{else}}{{.Text}}{{end}}{{if .Trend}} <span title="{{.TrendTitle}}">{{.Trend}}</span>{{end}}</td>
                     {{end}}
                   </tr>
                 {{end}}
@@ -351,6 +434,7 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                 {{if .HasSample}}
                 <div style="opacity:.9;">{{T "sample_in"}} {{.SampleRefuge}}</div>
                 <div style="opacity:.9;">{{.SampleDate}} · {{.SamplePlaces}} {{T "places"}}</div>
+                {{if .SampleCost}}<div style="opacity:.9;">{{.SampleCost}}</div>{{end}}
                 {{else}}
                 <div style="opacity:.9;">—</div>
                 {{end}}
@@ -390,8 +474,8 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                   <label class="muted">{{T "refuge"}}</label>
                   <select name="refuge" style="width:100%;padding:10px;border-radius:8px;border:1px solid #e2e8f0;">
                     <option value="*">Any</option>
-                    <option value="Tête Rousse">Tête Rousse</option>
-                    <option value="du Goûter">Refuge du Goûter</option>
+                    {{range .RefugeOptions}}<option value="{{.Value}}">{{.Label}}</option>
+                    {{end}}
                   </select>
                 </div>
                 <div>
@@ -402,12 +486,46 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                   <label class="muted">{{T "date_to"}}</label>
                   <input type="date" name="date_to" style="width:100%;padding:10px;border-radius:8px;border:1px solid #e2e8f0;" />
                 </div>
+                <div>
+                  <label class="muted">{{T "min_places"}}</label>
+                  <input type="number" name="min_places" min="0" max="20" placeholder="0" style="width:100%;padding:10px;border-radius:8px;border:1px solid #e2e8f0;" />
+                </div>
+                <div style="grid-column:1 / -1;">
+                  <label class="muted">{{T "weekdays"}}</label>
+                  <div style="display:flex;flex-wrap:wrap;gap:12px;padding:6px 0;">
+                    {{range .Weekdays}}
+                      <label><input type="checkbox" name="weekdays" value="{{.Value}}" /> {{.Label}}</label>
+                    {{end}}
+                  </div>
+                </div>
+                <div style="grid-column:1 / -1;">
+                  <label><input type="checkbox" name="season_open" value="1" /> {{T "season_checkbox"}}</label><br/>
+                  <label><input type="checkbox" name="notify_on_gone" value="1" /> {{T "gone_checkbox"}}</label><br/>
+                  <label><input type="checkbox" name="one_shot" value="1" /> {{T "oneshot_checkbox"}}</label>
+                </div>
+                <div>
+                  <label class="muted">{{T "language_label"}}</label>
+                  <select name="language" style="width:100%;padding:10px;border-radius:8px;border:1px solid #e2e8f0;">
+                    <option value="">{{T "language_auto"}}</option>
+                    {{range .Languages}}<option value="{{.Value}}">{{.Label}}</option>
+                    {{end}}
+                  </select>
+                </div>
+                <div style="grid-column:1 / -1;">
+                  <label class="muted">{{T "email_label"}}</label>
+                  <input type="email" name="email" autocomplete="email" style="width:100%;padding:10px;border-radius:8px;border:1px solid #e2e8f0;" />
+                  <label><input type="checkbox" name="email_only" value="1" /> {{T "email_only"}}</label>
+                </div>
               </div>
               <div style="margin-top:12px">
                 <button class="btn primary" type="submit">{{T "submit"}}</button>
               </div>
             </form>
           </div>
+          <div class="card" style="text-align:center;">
+            <a href="{{.BotLink}}" target="_blank" rel="noopener"><img src="/qr.png?payload=subscribe&amp;size=192" width="192" height="192" alt="{{T "qr_scan"}}" loading="lazy" onerror="this.parentNode.parentNode.style.display='none'" /></a>
+            <div class="muted">{{T "qr_scan"}}</div>
+          </div>
         </div>
       </div>
 </section>
@@ -440,71 +558,114 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func handleStatus(w http.ResponseWriter, r *http.Request) {
-	state.mu.RLock()
-	defer state.mu.RUnlock()
+// lastError is the failure class of the latest check ("" when every refuge was fetched)
+var lastError atomic.Pointer[string]
+
+// SetLastError records the failure class of the latest check for /status
+func SetLastError(class string) {
+	lastError.Store(&class)
+}
 
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	state := s.snapshot(r.Context())
+	class := ""
+	if p := lastError.Load(); p != nil {
+		class = *p
+	}
+	subscribers := "null" // without a store, or when it fails
+	if s.store != nil {
+		if n, err := s.store.CountSubscribers(r.Context()); err != nil {
+			slog.Error("status: failed to count subscribers", "error", err)
+		} else {
+			subscribers = strconv.Itoa(n)
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"status": "ok", "refuges": ` + strconv.Itoa(len(state.Refuges)) + `, "last_check": "` + state.LastCheck.Format(time.RFC3339) + `"}`))
+	w.Write([]byte(`{"status": "ok", "refuges": ` + strconv.Itoa(len(state.Refuges)) + `, "last_check": "` + state.LastCheck.Format(time.RFC3339) + `", "last_error": ` + strconv.Quote(class) + `, "stale": ` + strconv.FormatBool(stale(state.LastCheck, time.Now())) + `, "subscribers": ` + subscribers + `}`))
 }
 
-// keepAlive periodically pings the health check endpoint to keep the instance alive
-func keepAlive() {
-	// Hardcoded base URL for RENDER deployment
-	baseURL := "https://montblanc.onrender.com"
-	log.Printf("🌐 Keep-alive using base URL: %s", baseURL)
+// defaultKeepAliveInterval stays below the idle timeout of free hosting tiers (Render sleeps after 15 minutes)
+const defaultKeepAliveInterval = 14 * time.Minute
+
+// keepAlive periodically pings the health check endpoint to keep the instance alive, until ctx
+// is done
+func keepAlive(ctx context.Context, baseURL string, interval time.Duration) {
+	slog.Info("keep-alive enabled", "url", baseURL, "interval", interval)
 
 	// Create ticker for periodic pings
-	ticker := time.NewTicker(14 * time.Minute) // Ping every 14 minutes to stay within free tier limits
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	// a client of its own, so no idle connection outlives the pings
+	client := &http.Client{Timeout: 30 * time.Second}
+	defer client.CloseIdleConnections()
 
-	for range ticker.C {
-		resp, err := http.Get(baseURL + "/health")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/health", nil)
 		if err != nil {
-			log.Printf("❌ Keep-alive ping failed: %v", err)
+			slog.Error("keep-alive ping failed", "error", err)
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("keep-alive ping failed", "error", err)
+			}
 			continue
 		}
 		resp.Body.Close()
 		if resp.StatusCode == http.StatusOK {
-			log.Printf("✅ Keep-alive ping successful")
+			slog.Debug("keep-alive ping successful")
 		} else {
-			log.Printf("❌ Keep-alive ping returned status: %d", resp.StatusCode)
+			slog.Error("keep-alive ping returned an error status", "status", resp.StatusCode)
 		}
 	}
 }
 
 // Telegram webhook: save chat and simple /start
-func handleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	if !validWebhookSecret(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 	var upd telegram.Update
 	if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if upd.Message == nil || upd.Message.Chat == nil {
+	if (upd.Message == nil || upd.Message.Chat == nil) && upd.CallbackQuery == nil {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	chatID := fmt.Sprintf("%d", upd.Message.Chat.ID)
-
-	// persist subscriber using Bolt as a local store
-	// On Render we'll swap to Postgres impl, interface stays the same
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Printf("store open error: DATABASE_URL is empty")
+	// answered with 200 all the same: Telegram would otherwise send the update again and again
+	if s.store == nil {
+		slog.Error("telegram update dropped: no store")
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	ps, err := store.OpenPostgres(context.Background(), dbURL)
-	if err != nil {
-		log.Printf("store open error: %v", err)
-		w.WriteHeader(http.StatusOK)
+	ProcessUpdate(r.Context(), upd, s.store)
+	w.WriteHeader(http.StatusOK)
+}
+
+// ProcessUpdate handles an incoming Telegram update (commands and deep links);
+// shared by the webhook and the long-polling loop
+func ProcessUpdate(ctx context.Context, upd telegram.Update, ps store.Store) {
+	if upd.CallbackQuery != nil {
+		handleCallbackQuery(ctx, ps, upd.CallbackQuery)
 		return
 	}
-	defer ps.Close()
+	if upd.Message == nil || upd.Message.Chat == nil {
+		return
+	}
+	chatID := fmt.Sprintf("%d", upd.Message.Chat.ID)
 
 	// language of user if needed later
 	// lang := "en"
@@ -512,51 +673,75 @@ func handleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
 	// don't auto-subscribe on incoming message; only via website flow
 
 	// commands
-	txt := strings.TrimSpace(upd.Message.Text)
+	txt, ok := addressedCommand(strings.TrimSpace(upd.Message.Text))
+	if !ok {
+		return
+	}
 	if txt == "/start" {
 		// Auto-subscribe for next 30 days for both refuges
 		lang2 := "en"
 		if upd.Message.From != nil && upd.Message.From.LanguageCode != "" {
 			lang2 = upd.Message.From.LanguageCode
 		}
-		sub := store.Subscriber{ChatID: chatID, Language: lang2, IsActive: true}
+		// signup also reactivates a chat that previously sent /stop
+		now := time.Now().UTC()
+		sub := store.Subscriber{ChatID: chatID, Language: lang2}
 		if upd.Message.From != nil {
 			sub.Username = upd.Message.From.Username
 			sub.FirstName = upd.Message.From.FirstName
 			sub.LastName = upd.Message.From.LastName
 		}
-		_ = ps.UpsertSubscriber(sub)
+		if err := signup(ctx, ps, sub, store.ConsentTelegram, startGreeting, "", now); err != nil {
+			slog.Error("/start failed to save subscriber", "chat_id", chatID, "error", err)
+		}
 
-		now := time.Now().UTC()
+		// a returning chat keeps its subscriptions instead of stacking another default one on them
+		existing, err := ps.ListQueriesByChat(ctx, chatID)
+		if err != nil {
+			slog.Error("/start failed to list queries", "chat_id", chatID, "error", err)
+			_ = sendTo(ctx, chatID, startSaveFailed)
+			return
+		}
+		for _, eq := range existing {
+			if !eq.Completed() {
+				_ = sendTo(ctx, chatID, startWelcomeBack)
+				return
+			}
+		}
 		dateFrom := now.Format("2006-01-02")
 		dateTo := now.AddDate(0, 0, 30).Format("2006-01-02")
-		_, _ = ps.AddQuery(store.Query{ChatID: chatID, Refuge: "*", DateFrom: dateFrom, DateTo: dateTo})
+		q := store.Query{ChatID: chatID, Refuge: "*", DateFrom: dateFrom, DateTo: dateTo}
+		if _, err := ps.AddQuery(ctx, q); errors.Is(err, store.ErrPlanLimit) {
+			_ = sendTo(ctx, chatID, planLimitReply(err, i18n.Supported(lang2)))
+			return
+		} else if err != nil {
+			slog.Error("/start failed to save query", "chat_id", chatID, "error", err)
+			_ = sendTo(ctx, chatID, startSaveFailed)
+			return
+		}
 		// Immediate check for this subscription
-		checkAndNotifySingle(chatID, "*", dateFrom, dateTo)
-		_ = telegram.SendMessageTo(chatID, fmt.Sprintf("✅ Subscribed for next 30 days (both refuges): %s → %s", dateFrom, dateTo))
-		notifyAdmins(fmt.Sprintf("✅ New default /start subscription: chat_id=%s @%s, lang=%s, refuge=*, from=%s, to=%s", chatID, sub.Username, lang2, dateFrom, dateTo))
-		w.WriteHeader(http.StatusOK)
+		checkAndNotifySingle(ctx, ps, chatID, q, i18n.Supported(lang2))
+		_ = telegram.SendMessageWithButtons(chatID, fmt.Sprintf(startGreeting, dateFrom, dateTo), seasonButton(i18n.Supported(lang2)))
+		notifyAdmins(ctx, fmt.Sprintf("✅ New default /start subscription: chat_id=%s @%s, lang=%s, refuge=*, from=%s, to=%s", chatID, telegram.EscapeHTML(sub.Username), telegram.EscapeHTML(lang2), dateFrom, dateTo))
 		return
 	}
 	if strings.HasPrefix(txt, "/start ps_") {
-		// Process deep link payload: code_from_to_lang.sighex
+		// Process deep link payload: code_from_to_lang[_minplaces[_weekdays[_flags]]].sighex
+		// (flags: s = season-opening ping, g = follow up when an alerted date is gone, e = email only,
+		// l = language picked in the form)
 		payload := strings.TrimPrefix(txt, "/start ps_")
 		// Log and notify admins about deep link visit
 		uname := ""
 		if upd.Message.From != nil {
 			uname = upd.Message.From.Username
 		}
-		log.Printf("🔗 Deep link received: chat_id=%s username=@%s payload=%s", chatID, uname, payload)
-		notifyAdmins(fmt.Sprintf("🔗 Deep link opened: chat_id=%s @%s", chatID, uname))
-		secret := os.Getenv("DEEP_LINK_SECRET")
-		if secret == "" {
-			secret = "dev"
-		}
+		slog.Info("deep link received", "chat_id", chatID, "username", uname, "payload", payload)
+		notifyAdmins(ctx, fmt.Sprintf("🔗 Deep link opened: chat_id=%s @%s", chatID, telegram.EscapeHTML(uname)))
+		secret := settings.DeepLinkSecret
 		parts := strings.SplitN(payload, ".", 2)
 		if len(parts) != 2 {
-			_ = telegram.SendMessageTo(chatID, "Invalid link. Please use the website form.")
-			notifyAdmins(fmt.Sprintf("❌ Deep link invalid format from chat_id=%s payload=%s", chatID, payload))
-			w.WriteHeader(http.StatusOK)
+			_ = sendTo(ctx, chatID, "Invalid link. Please use the website form.")
+			notifyAdmins(ctx, fmt.Sprintf("❌ Deep link invalid format from chat_id=%s payload=%s", chatID, telegram.EscapeHTML(payload)))
 			return
 		}
 		data, sigHex := parts[0], parts[1]
@@ -564,83 +749,232 @@ func handleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
 		mac.Write([]byte(data))
 		expected := hex.EncodeToString(mac.Sum(nil)[:12])
 		if sigHex != expected {
-			_ = telegram.SendMessageTo(chatID, "Invalid or expired link. Please try again from the website.")
-			notifyAdmins(fmt.Sprintf("❌ Deep link signature mismatch chat_id=%s payload=%s", chatID, payload))
-			w.WriteHeader(http.StatusOK)
+			_ = sendTo(ctx, chatID, "Invalid or expired link. Please try again from the website.")
+			notifyAdmins(ctx, fmt.Sprintf("❌ Deep link signature mismatch chat_id=%s payload=%s", chatID, telegram.EscapeHTML(payload)))
 			return
 		}
-		fields := strings.SplitN(data, "_", 4)
-		if len(fields) != 4 {
-			_ = telegram.SendMessageTo(chatID, "Invalid link format. Please try again from the website.")
-			w.WriteHeader(http.StatusOK)
+		fields := strings.Split(data, "_")
+		if len(fields) < 4 || len(fields) > 7 {
+			_ = sendTo(ctx, chatID, "Invalid link format. Please try again from the website.")
 			return
 		}
 		code, df, dt, lang2 := fields[0], fields[1], fields[2], fields[3]
+		minPlaces := 0
+		if len(fields) >= 5 {
+			minPlaces, _ = strconv.Atoi(fields[4])
+		}
+		var weekdays store.Weekdays
+		if len(fields) >= 6 {
+			if n, err := strconv.Atoi(fields[5]); err == nil {
+				weekdays = store.Weekdays(n) & store.AllWeekdays
+			}
+		}
 		if lang2 == "" {
 			lang2 = "en"
 		}
+		seasonOpen := len(fields) == 7 && strings.Contains(fields[6], "s")
+		notifyOnGone := len(fields) == 7 && strings.Contains(fields[6], "g")
+		oneShot := len(fields) == 7 && strings.Contains(fields[6], "o")
+		sub := store.Subscriber{ChatID: chatID, Language: lang2, NotifyOnSeasonOpen: seasonOpen}
+		sub.LanguageLocked = len(fields) == 7 && strings.Contains(fields[6], "l")
+		// the form stored the email address, if any, under the link signature
+		if email, _ := ps.GetSetting(ctx, signupEmailKey(sigHex)); email != "" {
+			sub.Email = email
+			sub.EmailOnly = len(fields) == 7 && strings.Contains(fields[6], "e")
+		}
+		if upd.Message.From != nil {
+			sub.Username = upd.Message.From.Username
+			sub.FirstName = upd.Message.From.FirstName
+			sub.LastName = upd.Message.From.LastName
+		}
+		// the season-opening ping alone needs no dates
+		if seasonOpen && df == "" && dt == "" {
+			ip, _ := ps.GetSetting(ctx, consentIPKey(sigHex))
+			if err := signup(ctx, ps, sub, store.ConsentWebForm, deepLinkGreeting, ip, time.Now()); err != nil {
+				slog.Error("deep link failed to save subscriber", "chat_id", chatID, "error", err)
+			}
+			_ = sendTo(ctx, chatID, withUnsubscribeLink(i18n.T(lang2, "season_enabled"), chatID, i18n.Supported(lang2)))
+			notifyAdmins(ctx, fmt.Sprintf("✅ New season-opening subscription via deep link: chat_id=%s @%s, lang=%s", chatID, telegram.EscapeHTML(uname), telegram.EscapeHTML(lang2)))
+			return
+		}
 		// require dates
 		if len(df) != 8 || len(dt) != 8 {
-			base := os.Getenv("BASE_URL")
-			if base == "" {
-				base = "https://montblanc.onrender.com"
-			}
-			_ = telegram.SendMessageTo(chatID, "Please pick dates on the website:\n"+base+"/#subscribe")
-			w.WriteHeader(http.StatusOK)
+			_ = sendTo(ctx, chatID, "Please pick dates on the website:\n"+baseURL()+"/#subscribe")
 			return
 		}
 		dateFrom := df[:4] + "-" + df[4:6] + "-" + df[6:]
 		dateTo := dt[:4] + "-" + dt[4:6] + "-" + dt[6:]
-		refuge := "*"
-		if code == "tr" {
-			refuge = "Tête Rousse"
-		} else if code == "dg" {
-			refuge = "du Goûter"
+		refuge := refugeFromCode(code)
+		q := store.Query{ChatID: chatID, Refuge: refuge, DateFrom: dateFrom, DateTo: dateTo, MinPlaces: minPlaces, Weekdays: weekdays, NotifyOnGone: notifyOnGone, OneShot: oneShot}
+		if err := q.Validate(); err != nil {
+			slog.Warn("deep link with invalid dates", "chat_id", chatID, "error", err)
+			_ = sendTo(ctx, chatID, "Please pick dates on the website:\n"+baseURL()+"/#subscribe")
+			return
 		}
 
-		// Save subscriber and query
-		sub := store.Subscriber{ChatID: chatID, Language: lang2, IsActive: true}
-		if upd.Message.From != nil {
-			sub.Username = upd.Message.From.Username
-			sub.FirstName = upd.Message.From.FirstName
-			sub.LastName = upd.Message.From.LastName
+		// Save subscriber and query; the form stored the signup IP under the link signature
+		ip, _ := ps.GetSetting(ctx, consentIPKey(sigHex))
+		if err := signup(ctx, ps, sub, store.ConsentWebForm, deepLinkGreeting, ip, time.Now()); err != nil {
+			slog.Error("deep link failed to save subscriber", "chat_id", chatID, "error", err)
+		}
+		id, err := ps.AddQuery(ctx, q)
+		if errors.Is(err, store.ErrPlanLimit) {
+			_ = sendTo(ctx, chatID, planLimitReply(err, i18n.Supported(lang2)))
+			notifyAdmins(ctx, fmt.Sprintf("⚠️ Deep link subscription refused by the plan limit: chat_id=%s @%s, %v", chatID, telegram.EscapeHTML(uname), err))
+			return
 		}
-		_ = ps.UpsertSubscriber(sub)
-		_, _ = ps.AddQuery(store.Query{ChatID: chatID, Refuge: refuge, DateFrom: dateFrom, DateTo: dateTo})
+		if err != nil {
+			slog.Error("deep link failed to save query", "chat_id", chatID, "error", err)
+		}
+		q.ID = id
 		// Immediate check for this subscription
-		checkAndNotifySingle(chatID, refuge, dateFrom, dateTo)
-		_ = telegram.SendMessageTo(chatID, "✅ Subscription saved. We'll notify you when matching dates appear.")
-		notifyAdmins(fmt.Sprintf("✅ New subscription via deep link: chat_id=%s @%s, lang=%s, refuge=%s, from=%s, to=%s", chatID, uname, lang2, refuge, dateFrom, dateTo))
-		w.WriteHeader(http.StatusOK)
+		checkAndNotifySingle(ctx, ps, chatID, q, i18n.Supported(lang2))
+		_ = sendTo(ctx, chatID, withUnsubscribeLink(deepLinkGreeting, chatID, i18n.Supported(lang2)))
+		notifyAdmins(ctx, fmt.Sprintf("✅ New subscription via deep link: chat_id=%s @%s, lang=%s, refuge=%s, from=%s, to=%s, min_places=%d, weekdays=%s", chatID, telegram.EscapeHTML(uname), telegram.EscapeHTML(lang2), telegram.EscapeHTML(refuge), dateFrom, dateTo, minPlaces, formatWeekdays(weekdays, "en")))
+		return
+	}
+	if txt == "/snooze" || strings.HasPrefix(txt, "/snooze ") {
+		handleSnoozeCommand(ctx, ps, chatID, strings.TrimSpace(strings.TrimPrefix(txt, "/snooze")))
+		return
+	}
+	if txt == "/quiet" || strings.HasPrefix(txt, "/quiet ") {
+		_ = sendTo(ctx, chatID, handleQuietCommand(ctx, ps, chatID, strings.TrimSpace(strings.TrimPrefix(txt, "/quiet"))))
+		return
+	}
+	if txt == "/digest" || strings.HasPrefix(txt, "/digest ") {
+		_ = sendTo(ctx, chatID, handleDigestCommand(ctx, ps, chatID, strings.TrimSpace(strings.TrimPrefix(txt, "/digest"))))
+		return
+	}
+	if txt == "/test" {
+		_ = sendTo(ctx, chatID, handleTestCommand(ctx, ps, chatID, time.Now()))
+		return
+	}
+	if txt == "/weekly" || strings.HasPrefix(txt, "/weekly ") {
+		_ = sendTo(ctx, chatID, handleWeeklyCommand(ctx, ps, chatID, strings.TrimSpace(strings.TrimPrefix(txt, "/weekly"))))
+		return
+	}
+	if txt == "/gone" || strings.HasPrefix(txt, "/gone ") {
+		_ = sendTo(ctx, chatID, handleGoneCommand(ctx, ps, chatID, strings.TrimSpace(strings.TrimPrefix(txt, "/gone"))))
+		return
+	}
+	if txt == "/status" {
+		handleStatusCommand(ctx, ps, chatID)
+		return
+	}
+	if txt == "/list" {
+		lang2 := "en"
+		if sub, err := ps.GetSubscriber(ctx, chatID); err == nil {
+			lang2 = sub.Language
+		} else if upd.Message.From != nil {
+			lang2 = upd.Message.From.LanguageCode
+		}
+		qs, err := ps.ListQueriesByChat(ctx, chatID)
+		if err != nil {
+			slog.Error("/list failed", "chat_id", chatID, "error", err)
+			_ = sendTo(ctx, chatID, "Could not load your subscriptions, please try again later.")
+		} else {
+			_ = sendTo(ctx, chatID, formatQueryList(qs, i18n.Supported(lang2)))
+		}
+		return
+	}
+	if txt == "/stop" {
+		lang2 := "en"
+		if upd.Message.From != nil {
+			lang2 = upd.Message.From.LanguageCode
+		}
+		_ = sendTo(ctx, chatID, stopSubscriber(ctx, ps, chatID, lang2))
+		return
+	}
+	if txt == "/language" || strings.HasPrefix(txt, "/language ") {
+		_ = sendTo(ctx, chatID, handleLanguageCommand(ctx, ps, chatID, strings.TrimSpace(strings.TrimPrefix(txt, "/language"))))
+		return
+	}
+	if txt == "/calendar" {
+		_ = sendTo(ctx, chatID, handleCalendarCommand(ctx, ps, chatID))
+		return
+	}
+	if txt == "/export" {
+		if dump, err := exportSubscriber(ctx, ps, chatID); errors.Is(err, store.ErrNotFound) {
+			_ = sendTo(ctx, chatID, "We don't store any data about this chat.")
+		} else if err != nil {
+			slog.Error("/export failed", "chat_id", chatID, "error", err)
+			_ = sendTo(ctx, chatID, "Could not export your data, please try again later.")
+		} else {
+			_ = sendTo(ctx, chatID, dump)
+		}
 		return
 	}
 	if txt == "/id" {
-		_ = telegram.SendMessageTo(chatID, "Your Chat ID: "+chatID)
-		w.WriteHeader(http.StatusOK)
+		_ = sendTo(ctx, chatID, "Your Chat ID: "+chatID)
+		return
+	}
+	if (txt == "/flag" || strings.HasPrefix(txt, "/flag ")) && isAdmin(chatID) {
+		replyFlagCommand(ctx, ps, chatID, txt)
+		return
+	}
+	if (txt == "/channel" || strings.HasPrefix(txt, "/channel ")) && isAdmin(chatID) {
+		replyChannelCommand(ctx, ps, chatID, txt)
+		return
+	}
+	if txt == "/reload" && isAdmin(chatID) {
+		if summary, err := config.Reload(); err != nil {
+			_ = sendTo(ctx, chatID, "❌ Reload failed, keeping the current configuration: "+err.Error())
+		} else {
+			slog.Info("configuration reloaded", "chat_id", chatID, "summary", summary)
+			_ = sendTo(ctx, chatID, "🔄 Configuration reloaded: "+summary)
+		}
+		return
+	}
+	if (txt == "/add_structure" || strings.HasPrefix(txt, "/add_structure ") || txt == "/remove_structure" || strings.HasPrefix(txt, "/remove_structure ")) && isAdmin(chatID) {
+		replyStructureCommand(ctx, ps, chatID, txt)
+		return
+	}
+	if (txt == "/archive_season" || strings.HasPrefix(txt, "/archive_season ")) && isAdmin(chatID) {
+		replyArchiveCommand(ctx, ps, chatID, txt)
+		return
+	}
+	if (txt == "/broadcast" || strings.HasPrefix(txt, "/broadcast ")) && isAdmin(chatID) {
+		replyBroadcastCommand(ctx, ps, chatID, strings.TrimSpace(strings.TrimPrefix(txt, "/broadcast")))
+		return
+	}
+	if txt == "/stats" && isAdmin(chatID) {
+		_ = sendTo(ctx, chatID, handleStatsCommand(ctx, ps, time.Now()))
+		return
+	}
+	if strings.HasPrefix(txt, "/subscriber ") && isAdmin(chatID) {
+		target := strings.TrimSpace(strings.TrimPrefix(txt, "/subscriber "))
+		if sub, err := ps.GetSubscriber(ctx, target); err != nil {
+			_ = sendTo(ctx, chatID, "Subscriber not found: "+target)
+		} else {
+			qs, _ := ps.ListQueriesByChat(ctx, target)
+			_ = sendTo(ctx, chatID, formatSubscriberDetail(sub, qs))
+		}
+		return
+	}
+	if (txt == "/plan" || strings.HasPrefix(txt, "/plan ")) && isAdmin(chatID) {
+		_ = sendTo(ctx, chatID, handlePlanCommand(ctx, ps, strings.Fields(txt)[1:]))
+		return
+	}
+	if strings.HasPrefix(txt, "/as ") && isAdmin(chatID) {
+		_ = sendTo(ctx, chatID, handleAsCommand(ctx, ps, txt))
 		return
 	}
 	if txt == "/subscribers" && isAdmin(chatID) {
-		subs, err := ps.ListSubscribers()
+		subs, err := ps.ListSubscribers(ctx)
 		if err != nil {
-			_ = telegram.SendMessageTo(chatID, "Error fetching subscribers")
+			_ = sendTo(ctx, chatID, "Error fetching subscribers")
 		} else {
-			sendSubscribersList(chatID, subs)
+			sendSubscribersList(ctx, chatID, subs)
 		}
-		w.WriteHeader(http.StatusOK)
 		return
 	}
 
 	// any other text → instruct to use website (no subscription here)
-	base := os.Getenv("BASE_URL")
-	if base == "" {
-		base = "https://montblanc.onrender.com"
-	}
-	_ = telegram.SendMessageTo(chatID, "Please subscribe on the website and pick dates:\n"+base+"/#subscribe")
-	w.WriteHeader(http.StatusOK)
+	_ = sendTo(ctx, chatID, "Please subscribe on the website and pick dates:\n"+baseURL()+"/#subscribe")
 }
 
 // handleSubscribe saves subscriber and a single query
-func handleSubscribe(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/#subscribe", http.StatusSeeOther)
 		return
@@ -649,24 +983,63 @@ func handleSubscribe(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	// language: take from detected UI language
+	// language: the one picked in the form locks it, otherwise the detected UI language
 	language := i18n.DetectLang(r)
+	languageChosen := r.FormValue("language") != ""
+	if languageChosen {
+		language = r.FormValue("language")
+	}
 	refuge := r.FormValue("refuge")
 	dateFrom := r.FormValue("date_from")
 	dateTo := r.FormValue("date_to")
 	// no chatID in the new flow
-	// language allowlist
-	allowedLang := map[string]bool{"en": true, "de": true, "fr": true, "es": true, "it": true}
-	if language != "" && !allowedLang[language] {
+	// language allowlist: the languages with translations
+	if language != "" && i18n.Supported(language) != language {
 		http.Error(w, "unsupported language", http.StatusBadRequest)
 		return
 	}
-	// refuge allowlist (currently only 2 supported plus any)
-	allowedRefuge := map[string]bool{"*": true, "Tête Rousse": true, "du Goûter": true}
+	// refuge allowlist: the live registry plus any
+	allowedRefuge := map[string]bool{"*": true}
+	for _, rc := range parser.Refuges() {
+		allowedRefuge[rc.Name] = true
+	}
 	if refuge != "" && !allowedRefuge[refuge] {
 		http.Error(w, "unsupported refuge", http.StatusBadRequest)
 		return
 	}
+	// minimum free places (empty or 0 = any)
+	minPlaces := 0
+	if v := strings.TrimSpace(r.FormValue("min_places")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxMinPlaces {
+			http.Error(w, fmt.Sprintf("min_places must be a number between 0 and %d", maxMinPlaces), http.StatusBadRequest)
+			return
+		}
+		minPlaces = n
+	}
+	// allowed weekdays (none or all = every day)
+	weekdays, err := parseWeekdays(r.Form["weekdays"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// season-opening ping, with or without dates
+	seasonOpen := r.FormValue("season_open") != ""
+	// follow-up when an alerted date is booked out again
+	notifyOnGone := r.FormValue("notify_on_gone") != ""
+	// one-shot: the first alert completes the query
+	oneShot := r.FormValue("one_shot") != ""
+	// optional email address alerts are also sent to, or only to
+	email := strings.TrimSpace(r.FormValue("email"))
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil {
+			http.Error(w, "invalid email address", http.StatusBadRequest)
+			return
+		}
+		email = addr.Address
+	}
+	emailOnly := email != "" && r.FormValue("email_only") != ""
 	// date range validation if both provided
 	if dateFrom != "" && dateTo != "" {
 		df, err1 := time.Parse("2006-01-02", dateFrom)
@@ -681,38 +1054,56 @@ func handleSubscribe(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		http.Error(w, "DATABASE_URL is empty", http.StatusInternalServerError)
+	if !s.storeAvailable(w) {
 		return
 	}
 	// Build deep-link payload (compact): code_f_t_l.sig (<=64 chars)
-	secret := os.Getenv("DEEP_LINK_SECRET")
-	if secret == "" {
-		secret = "dev"
-	}
+	secret := settings.DeepLinkSecret
 	// compact fields
 	f := strings.ReplaceAll(dateFrom, "-", "")
 	t := strings.ReplaceAll(dateTo, "-", "")
-	code := "any"
-	switch refuge {
-	case "Tête Rousse":
-		code = "tr"
-	case "du Goûter":
-		code = "dg"
-	case "*":
-		code = "any"
-	}
+	code := refugeCode(refuge)
 	data := fmt.Sprintf("%s_%s_%s_%s", code, f, t, language)
+	flags := ""
+	if seasonOpen {
+		flags += "s"
+	}
+	if notifyOnGone {
+		flags += "g"
+	}
+	if oneShot {
+		flags += "o"
+	}
+	if emailOnly {
+		flags += "e"
+	}
+	if languageChosen {
+		flags += "l"
+	}
+	switch {
+	case flags != "":
+		data += fmt.Sprintf("_%d_%d_%s", minPlaces, weekdays, flags)
+	case weekdays != 0:
+		data += fmt.Sprintf("_%d_%d", minPlaces, weekdays)
+	case minPlaces > 0:
+		data += fmt.Sprintf("_%d", minPlaces)
+	}
 	mac := hmac.New(sha256.New, []byte(secret))
 	mac.Write([]byte(data))
 	sigHex := hex.EncodeToString(mac.Sum(nil)[:12])
 	payload := data + "." + sigHex
-	botUsername := os.Getenv("TELEGRAM_BOT_USERNAME")
-	if botUsername == "" {
-		botUsername = "montblanc_booking_bot"
+	// remember where the signup came from until the deep link is opened
+	if err := s.store.SetSetting(r.Context(), consentIPKey(sigHex), clientIP(r)); err != nil {
+		slog.Error("failed to record signup IP", "error", err)
+	}
+	// the email address doesn't fit in the deep link
+	if email != "" {
+		if err := s.store.SetSetting(r.Context(), signupEmailKey(sigHex), email); err != nil {
+			slog.Error("failed to record signup email", "error", err)
+		}
 	}
-	deepLinkWeb := fmt.Sprintf("https://t.me/%s?start=ps_%s", botUsername, payload)
+	botUsername := settings.BotUsername
+	deepLinkWeb := botLink("ps_" + payload)
 	deepLinkApp := fmt.Sprintf("tg://resolve?domain=%s&start=ps_%s", botUsername, payload)
 
 	// Render interstitial page with Open in Telegram, copyable command, and QR fallback
@@ -744,13 +1135,23 @@ input.cmd{flex:1;padding:10px;border:1px solid #e5e7eb;border-radius:8px;font-fa
 	_, _ = w.Write([]byte(page))
 }
 
-// checkAndNotifySingle filters current state by refuge/date window and sends a one-off notification to one chat
-func checkAndNotifySingle(chatID string, refuge string, dateFrom string, dateTo string) {
-	// Read snapshot
-	state.mu.RLock()
-	refuges := make([]parser.Refuge, len(state.Refuges))
-	copy(refuges, state.Refuges)
-	state.mu.RUnlock()
+// dayCell renders a day in the weekly table: free places, Full or Closed
+func dayCell(day parser.DayAvailability) string {
+	if day.Available() {
+		return strconv.Itoa(day.Places)
+	}
+	if day.Status == parser.StatusUnknown {
+		return "—"
+	}
+	return day.Status.String()
+}
+
+// checkAndNotifySingle filters current state by the query's refuge, date window and minimum places
+// and sends a one-off notification to one chat. The dates sent are marked notified for the chat,
+// so the next check doesn't alert them again.
+func checkAndNotifySingle(ctx context.Context, st store.Store, chatID string, q store.Query, lang string) {
+	refuge, dateFrom, dateTo := q.Refuge, q.DateFrom, q.DateTo
+	refuges := currentSnapshot().Refuges
 
 	if len(refuges) == 0 {
 		return
@@ -764,20 +1165,28 @@ func checkAndNotifySingle(chatID string, refuge string, dateFrom string, dateTo
 	}
 
 	matches := make(map[string][]string)
+	var sent []store.Notification
 	for _, rf := range refuges {
 		if refuge != "*" && rf.Name != refuge {
 			continue
 		}
-		for d, s := range rf.Dates {
-			if s == "Full" {
-				continue
-			}
-			dt, err := time.Parse("2006-01-02", d)
-			if err != nil {
+		for _, day := range rf.Days() {
+			if !day.Available() || !q.HasPlaces(day.Places) || !q.OnWeekday(day.Key()) {
 				continue
 			}
+			dt := day.Date
 			if (dt.Equal(fromT) || dt.After(fromT)) && (dt.Equal(toT) || dt.Before(toT)) {
-				matches[rf.Name] = append(matches[rf.Name], fmt.Sprintf("%s: %s places", d, s))
+				if done, err := st.WasNotified(ctx, chatID, rf.Name, day.Key()); err != nil {
+					slog.Error("failed to check notification history", "chat_id", chatID, "error", err)
+				} else if done {
+					continue
+				}
+				places := fmt.Sprintf("%d %s", day.Places, i18n.T(lang, "notif_places"))
+				if cost := CostEstimate(rf.Name, q.GroupSize(parser.DefaultPax), 1, lang); cost != "" {
+					places += " · " + cost
+				}
+				matches[rf.Name] = append(matches[rf.Name], fmt.Sprintf("%s: %s · %s", DateLink(rf.Name, day.Key(), lang), places, BookNowLink(rf.Name, day.Key(), lang)))
+				sent = append(sent, store.Notification{ChatID: chatID, Refuge: rf.Name, Date: day.Key(), Places: day.Places, Channel: store.ChannelTelegram})
 			}
 		}
 	}
@@ -786,12 +1195,12 @@ func checkAndNotifySingle(chatID string, refuge string, dateFrom string, dateTo
 	}
 
 	var b strings.Builder
-	b.WriteString("🎯 Matching availability found:\n\n")
+	b.WriteString(i18n.T(lang, "notif_new") + "\n\n")
 	// order
 	order := []string{"Tête Rousse", "du Goûter"}
 	for _, name := range order {
 		if dates, ok := matches[name]; ok {
-			b.WriteString(fmt.Sprintf("🏔️ %s:\n", name))
+			b.WriteString(fmt.Sprintf("🏔️ %s:\n", telegram.EscapeHTML(name)))
 			sort.Strings(dates)
 			for _, line := range dates {
 				b.WriteString("  • " + line + "\n")
@@ -804,14 +1213,49 @@ func checkAndNotifySingle(chatID string, refuge string, dateFrom string, dateTo
 		if name == "Tête Rousse" || name == "du Goûter" {
 			continue
 		}
-		b.WriteString(fmt.Sprintf("🏔️ %s:\n", name))
+		b.WriteString(fmt.Sprintf("🏔️ %s:\n", telegram.EscapeHTML(name)))
 		sort.Strings(dates)
 		for _, line := range dates {
 			b.WriteString("  • " + line + "\n")
 		}
 		b.WriteString("\n")
 	}
-	_ = telegram.SendMessageTo(chatID, b.String())
+	if err := sendTo(ctx, chatID, b.String()); err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	for _, n := range sent {
+		n.SentAt = now
+		if err := st.RecordNotification(ctx, n); err != nil {
+			slog.Error("failed to record notification", "chat_id", chatID, "refuge", n.Refuge, "date", n.Date, "error", err)
+		}
+	}
+	if q.OneShot {
+		completeOneShot(ctx, st, chatID, q, lang)
+	}
+}
+
+// stopSubscriber deactivates chatID and returns the localized reply.
+// fallbackLang is used when the chat isn't a known subscriber.
+func stopSubscriber(ctx context.Context, st store.Store, chatID string, fallbackLang string) string {
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		return i18n.T(i18n.Supported(fallbackLang), "stop_unknown")
+	}
+	if err != nil {
+		slog.Error("/stop lookup failed", "chat_id", chatID, "error", err)
+		return "Could not unsubscribe, please try again later."
+	}
+	lang := i18n.Supported(sub.Language)
+	if !sub.IsActive {
+		return i18n.T(lang, "stop_unknown")
+	}
+	if err := st.DeactivateSubscriber(ctx, chatID); err != nil {
+		slog.Error("/stop failed", "chat_id", chatID, "error", err)
+		return "Could not unsubscribe, please try again later."
+	}
+	notifyAdmins(ctx, fmt.Sprintf("🛑 Unsubscribed via /stop: chat_id=%s @%s", chatID, telegram.EscapeHTML(sub.Username)))
+	return i18n.T(lang, "stop_confirm")
 }
 
 // digitsOnly returns true if s contains only ASCII digits
@@ -827,13 +1271,20 @@ func digitsOnly(s string) bool {
 	return true
 }
 
-// isAdmin checks if chatID present in TELEGRAM_CHAT_IDS env (admin list)
-func isAdmin(chatID string) bool {
-	ids := os.Getenv("TELEGRAM_CHAT_IDS")
-	if ids == "" {
-		return false
+// validWebhookSecret checks the secret token Telegram echoes in X-Telegram-Bot-Api-Secret-Token
+// against TELEGRAM_WEBHOOK_SECRET; without a secret every request is accepted (local testing)
+func validWebhookSecret(r *http.Request) bool {
+	secret := settings.WebhookSecret
+	if secret == "" {
+		return true
 	}
-	for _, id := range telegram.ParseChatIDs(ids) {
+	got := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(secret)) == 1
+}
+
+// isAdmin checks if chatID present in TELEGRAM_CHAT_IDS (admin list)
+func isAdmin(chatID string) bool {
+	for _, id := range settings.AdminChatIDs {
 		if id == chatID {
 			return true
 		}
@@ -842,22 +1293,18 @@ func isAdmin(chatID string) bool {
 }
 
 // notifyAdmins sends a message to all admin chat ids from TELEGRAM_CHAT_IDS
-func notifyAdmins(message string) {
-	ids := os.Getenv("TELEGRAM_CHAT_IDS")
-	if ids == "" {
-		return
-	}
-	for _, id := range telegram.ParseChatIDs(ids) {
-		_ = telegram.SendMessageTo(id, message)
+func notifyAdmins(ctx context.Context, message string) {
+	for _, id := range settings.AdminChatIDs {
+		_ = sendTo(ctx, id, message)
 	}
 }
 
 // sendSubscribersList sends the list to one chat, chunked to avoid message limits
-func sendSubscribersList(chatID string, subs []store.Subscriber) {
+func sendSubscribersList(ctx context.Context, chatID string, subs []store.Subscriber) {
 	const chunkSize = 50
 	total := len(subs)
 	if total == 0 {
-		_ = telegram.SendMessageTo(chatID, "No subscribers")
+		_ = sendTo(ctx, chatID, "No subscribers")
 		return
 	}
 	// Build lines
@@ -874,6 +1321,6 @@ func sendSubscribersList(chatID string, subs []store.Subscriber) {
 		if end > len(lines) {
 			end = len(lines)
 		}
-		_ = telegram.SendMessageTo(chatID, strings.Join(lines[i:end], "\n"))
+		_ = sendTo(ctx, chatID, strings.Join(lines[i:end], "\n"))
 	}
 }
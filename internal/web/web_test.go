@@ -0,0 +1,328 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/notify"
+	"github.com/AlexYaroshenko/montblanc/internal/parser"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+func TestStopSubscriber(t *testing.T) {
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "1", Language: "de", IsActive: true})
+
+	if got := stopSubscriber(t.Context(), st, "1", "en"); got != i18n.T("de", "stop_confirm") {
+		t.Errorf("unexpected reply %q", got)
+	}
+	if sub, _ := st.GetSubscriber(t.Context(), "1"); sub.IsActive {
+		t.Error("expected subscriber to be deactivated")
+	}
+	// stopping twice tells the user they're not subscribed
+	if got := stopSubscriber(t.Context(), st, "1", "en"); got != i18n.T("de", "stop_unknown") {
+		t.Errorf("unexpected reply for inactive subscriber %q", got)
+	}
+	// unknown chat gets a reply in its Telegram language
+	if got := stopSubscriber(t.Context(), st, "2", "fr-FR"); got != i18n.T("fr", "stop_unknown") {
+		t.Errorf("unexpected reply for unknown chat %q", got)
+	}
+}
+
+func TestFormatQueryList(t *testing.T) {
+	if got := formatQueryList(nil, "it"); got != i18n.T("it", "list_empty") {
+		t.Errorf("unexpected empty reply %q", got)
+	}
+	now := time.Now()
+	qs := []store.Query{
+		{ID: "b", Refuge: "du Goûter", DateFrom: "2025-08-01", DateTo: "2025-08-05", MinPlaces: 4, CreatedAt: now},
+		{ID: "a", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31", Weekdays: store.WeekdaysOf(time.Saturday, time.Sunday), CreatedAt: now.Add(-time.Hour)},
+	}
+	want := "Your subscriptions:\n1. any refuge: 2025-07-01 → 2025-07-31 (Sat, Sun)\n2. du Goûter: 2025-08-01 → 2025-08-05 (≥4 places)\n"
+	if got := formatQueryList(qs, "en"); got != want {
+		t.Errorf("formatQueryList = %q, want %q", got, want)
+	}
+}
+
+func TestHandleSubscribeFilters(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.DeepLinkSecret = "test" })
+	srv := NewServer(store.NewMemory())
+	post := func(minPlaces string) *httptest.ResponseRecorder {
+		form := url.Values{"refuge": {"*"}, "date_from": {"2025-07-01"}, "date_to": {"2025-07-31"}, "min_places": {minPlaces}}
+		req := httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.handleSubscribe(rec, req)
+		return rec
+	}
+	for _, bad := range []string{"-1", "abc", "21"} {
+		if rec := post(bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("min_places=%q: expected 400, got %d", bad, rec.Code)
+		}
+	}
+	if rec := post("4"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "_en_4.") {
+		t.Errorf("expected min places in the deep link, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post(""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "_en.") {
+		t.Errorf("expected unchanged deep link without min places, got %d", rec.Code)
+	}
+
+	form := url.Values{"refuge": {"*"}, "date_from": {"2025-07-01"}, "date_to": {"2025-07-31"}, "weekdays": {"6", "0"}}
+	req := httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.handleSubscribe(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "_en_0_65.") {
+		t.Errorf("expected weekdays in the deep link, got %d", rec.Code)
+	}
+}
+
+func TestQueryHasPlaces(t *testing.T) {
+	q := store.Query{MinPlaces: 4}
+	for places, want := range map[int]bool{1: false, 3: false, 4: true, 12: true} {
+		if got := q.HasPlaces(places); got != want {
+			t.Errorf("HasPlaces(%d) = %v, want %v", places, got, want)
+		}
+	}
+	if !(store.Query{}).HasPlaces(1) {
+		t.Error("MinPlaces 0 should match any availability")
+	}
+}
+
+func TestQueryWeekdays(t *testing.T) {
+	weekend := store.Query{Refuge: "*", Weekdays: store.WeekdaysOf(time.Saturday, time.Sunday)}
+	// 2025-07-12 is a Saturday, 2025-07-15 a Tuesday
+	if !weekend.Matches("Tête Rousse", "2025-07-12") {
+		t.Error("expected Saturday to match a weekend filter")
+	}
+	if weekend.Matches("Tête Rousse", "2025-07-15") {
+		t.Error("expected Tuesday not to match a weekend filter")
+	}
+	if !(store.Query{Refuge: "*"}).Matches("Tête Rousse", "2025-07-15") {
+		t.Error("an empty weekday filter should match every day")
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	if w, err := parseWeekdays([]string{"6", "0"}); err != nil || w != store.WeekdaysOf(time.Saturday, time.Sunday) {
+		t.Errorf("expected weekend, got %v, %v", w, err)
+	}
+	if w, err := parseWeekdays([]string{"0", "1", "2", "3", "4", "5", "6"}); err != nil || w != 0 {
+		t.Errorf("every day should mean no filter, got %v, %v", w, err)
+	}
+	if w, err := parseWeekdays(nil); err != nil || w != 0 {
+		t.Errorf("no days should mean no filter, got %v, %v", w, err)
+	}
+	for _, bad := range []string{"7", "-1", "sat"} {
+		if _, err := parseWeekdays([]string{bad}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+	if got := formatWeekdays(store.WeekdaysOf(time.Sunday, time.Monday), "de"); got != "Mo, So" {
+		t.Errorf("formatWeekdays = %q", got)
+	}
+}
+
+func TestBookNowLink(t *testing.T) {
+	got := BookNowLink("du Goûter", "2025-08-22", "de")
+	want := `<a href="https://centrale.ffcam.fr/index.php?_lang=GB&amp;date=2025-08-22&amp;mode=FORM_PREBOOK&amp;pax=1&amp;structure=BK_STRUCTURE%3A30">Jetzt buchen</a>`
+	if got != want {
+		t.Errorf("BookNowLink = %q, want %q", got, want)
+	}
+}
+
+func TestServerWithoutStore(t *testing.T) {
+	useSettings(t, func(s *Settings) { s.DeepLinkSecret, s.WebhookSecret = "test", "" })
+	h := NewServer(nil).Handler()
+	post := func(path string, form url.Values) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post("/subscribe", url.Values{"refuge": {"*"}, "date_from": {"2025-07-01"}, "date_to": {"2025-07-31"}}); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for a signup without a store, got %d", code)
+	}
+	// a form error is still reported as such
+	if code := post("/subscribe", url.Values{"refuge": {"nowhere"}}); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown refuge, got %d", code)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/history", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for the history without a store, got %d", rec.Code)
+	}
+	// Telegram is answered all the same, so it doesn't send the update again
+	req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(`{"message":{"chat":{"id":7},"text":"/list"}}`))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for an update without a store, got %d", rec.Code)
+	}
+}
+
+func TestWebhookSecretToken(t *testing.T) {
+	post := func(body, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		NewServer(nil).handleTelegramWebhook(rec, req)
+		return rec.Code
+	}
+
+	// without a configured secret any update is accepted
+	useSettings(t, func(s *Settings) { s.WebhookSecret = "" })
+	if code := post("{}", ""); code != http.StatusOK {
+		t.Errorf("expected 200 without secret, got %d", code)
+	}
+
+	settings.WebhookSecret = "s3cret"
+	if code := post("{}", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for missing token, got %d", code)
+	}
+	// rejected before the body is decoded
+	if code := post("not json", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for wrong token, got %d", code)
+	}
+	if code := post("{}", "s3cret"); code != http.StatusOK {
+		t.Errorf("expected 200 for matching token, got %d", code)
+	}
+}
+
+func TestProcessUpdateRepliesThroughNotifier(t *testing.T) {
+	type updateKey struct{}
+	var got []string
+	prev := settings
+	t.Cleanup(func() { settings = prev })
+	settings.Notifier = notify.Func(func(ctx context.Context, chatID string, message string) error {
+		// the reply is sent under the update's context, so its deadline applies
+		if ctx.Value(updateKey{}) == nil {
+			t.Error("reply sent without the update's context")
+		}
+		got = append(got, chatID+": "+message)
+		return nil
+	})
+	st := store.NewMemory()
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "7", Language: "en", IsActive: true})
+
+	ctx := context.WithValue(t.Context(), updateKey{}, true)
+	ProcessUpdate(ctx, telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 7}, Text: "/list"}}, st)
+	if len(got) != 1 || got[0] != "7: "+i18n.T("en", "list_empty") {
+		t.Errorf("expected the /list reply sent to chat 7, got %q", got)
+	}
+}
+
+func TestServersRunSideBySide(t *testing.T) {
+	// building a second server must not panic on routes already registered
+	servers := []*httptest.Server{httptest.NewServer(NewServer(nil).Handler()), httptest.NewServer(NewServer(nil).Handler())}
+	for _, srv := range servers {
+		defer srv.Close()
+	}
+	errs := make(chan error, len(servers)*3)
+	for _, srv := range servers {
+		for _, path := range []string{"/health", "/status", "/static/test.html"} {
+			go func() {
+				resp, err := srv.Client().Get(srv.URL + path)
+				if err == nil {
+					resp.Body.Close()
+					if resp.StatusCode != http.StatusOK {
+						err = fmt.Errorf("GET %s: status %d", path, resp.StatusCode)
+					}
+				}
+				errs <- err
+			}()
+		}
+	}
+	for range cap(errs) {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDeepLinkWithInvalidDatesAddsNoQuery(t *testing.T) {
+	replies := make(map[string][]string)
+	useSettings(t, func(s *Settings) {
+		s.DeepLinkSecret = "test"
+		s.Notifier = notify.Func(func(_ context.Context, chatID string, message string) error {
+			replies[chatID] = append(replies[chatID], message)
+			return nil
+		})
+	})
+	st := store.NewMemory()
+	// correctly signed, but not a date
+	data := "tr_20250701_2025ab01_en"
+	mac := hmac.New(sha256.New, []byte("test"))
+	mac.Write([]byte(data))
+	text := "/start ps_" + data + "." + hex.EncodeToString(mac.Sum(nil)[:12])
+	ProcessUpdate(t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 7}, Text: text}}, st)
+
+	if qs, _ := st.ListQueriesByChat(t.Context(), "7"); len(qs) != 0 {
+		t.Errorf("expected no query, got %+v", qs)
+	}
+	if _, err := st.GetSubscriber(t.Context(), "7"); err != store.ErrNotFound {
+		t.Errorf("expected no subscriber, got %v", err)
+	}
+	if got := replies["7"]; len(got) != 1 || !strings.HasPrefix(got[0], "Please pick dates on the website") {
+		t.Errorf("unexpected replies %q", got)
+	}
+}
+
+func TestDeepLinkAdminReportsEscapeUserText(t *testing.T) {
+	replies := make(map[string][]string)
+	useSettings(t, func(s *Settings) {
+		s.DeepLinkSecret, s.AdminChatIDs = "test", []string{"admin"}
+		s.Notifier = notify.Func(func(_ context.Context, chatID string, message string) error {
+			replies[chatID] = append(replies[chatID], message)
+			return nil
+		})
+	})
+	st := store.NewMemory()
+	from := &telegram.UserIn{ID: 7, Username: "<b>"}
+	for _, text := range []string{"/start ps_<x>&y", "/start ps_<x>&y.0123"} {
+		ProcessUpdate(t.Context(), telegram.Update{Message: &telegram.MessageIn{Chat: &telegram.Chat{ID: 7}, From: from, Text: text}}, st)
+	}
+	got := strings.Join(replies["admin"], "\n")
+	if strings.Contains(got, "<") || strings.Contains(got, "&y") {
+		t.Errorf("unescaped user text in the admin reports: %q", got)
+	}
+	if !strings.Contains(got, "payload=&lt;x&gt;&amp;y.0123") || !strings.Contains(got, "@&lt;b&gt;") {
+		t.Errorf("expected the payload and username escaped, got %q", got)
+	}
+}
+
+func TestImmediateCheckIsTranslated(t *testing.T) {
+	withSnapshot(t)
+	var got []string
+	useSettings(t, func(s *Settings) {
+		s.Notifier = notify.Func(func(_ context.Context, chatID string, message string) error {
+			got = append(got, message)
+			return nil
+		})
+	})
+	UpdateState([]parser.Refuge{{Name: "Tête Rousse", Dates: map[string]string{"2025-07-10": "3"}}}, time.Now())
+	q := store.Query{ChatID: "7", Refuge: "*", DateFrom: "2025-07-01", DateTo: "2025-07-31"}
+	checkAndNotifySingle(t.Context(), store.NewMemory(), "7", q, "de")
+
+	if len(got) != 1 || !strings.HasPrefix(got[0], i18n.T("de", "notif_new")) || !strings.Contains(got[0], "3 Plätze") {
+		t.Fatalf("expected the alert in German, got %q", got)
+	}
+	if strings.Contains(got[0], "places") || strings.Contains(got[0], "Matching") {
+		t.Errorf("English left in the German alert: %q", got[0])
+	}
+}
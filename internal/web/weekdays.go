@@ -0,0 +1,62 @@
+package web
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/i18n"
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// weekdayOption is a day checkbox of the subscribe form
+type weekdayOption struct {
+	Value int // time.Weekday
+	Label string
+}
+
+// weekdayLabel returns the localized short name of d
+func weekdayLabel(d time.Weekday, lang string) string {
+	names := strings.Split(i18n.T(lang, "weekday_names"), ",") // Monday first
+	if i := (int(d) + 6) % 7; len(names) == 7 {
+		return names[i]
+	}
+	return d.String()[:3]
+}
+
+// weekdayOptions returns the form checkboxes, Monday first
+func weekdayOptions(lang string) []weekdayOption {
+	opts := make([]weekdayOption, 0, 7)
+	for _, d := range store.AllWeekdays.Days() {
+		opts = append(opts, weekdayOption{Value: int(d), Label: weekdayLabel(d, lang)})
+	}
+	return opts
+}
+
+// parseWeekdays validates the checked days ("0" = Sunday … "6" = Saturday).
+// No days or every day both mean no filter.
+func parseWeekdays(values []string) (store.Weekdays, error) {
+	var days []time.Weekday
+	for _, v := range values {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 6 {
+			return 0, fmt.Errorf("invalid weekday %q", v)
+		}
+		days = append(days, time.Weekday(n))
+	}
+	w := store.WeekdaysOf(days...)
+	if w == store.AllWeekdays {
+		return 0, nil
+	}
+	return w, nil
+}
+
+// formatWeekdays renders a weekday filter as e.g. "Sat, Sun"
+func formatWeekdays(w store.Weekdays, lang string) string {
+	labels := make([]string, 0, 7)
+	for _, d := range w.Days() {
+		labels = append(labels, weekdayLabel(d, lang))
+	}
+	return strings.Join(labels, ", ")
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+// handleWeeklyCommand processes "/weekly on|off" and returns the reply
+func handleWeeklyCommand(ctx context.Context, st store.Store, chatID string, arg string) string {
+	if arg != "on" && arg != "off" {
+		return "Usage: /weekly off to stop the weekly summary, /weekly on to get it again"
+	}
+	sub, err := st.GetSubscriber(ctx, chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "You have no subscription yet. Send /start to subscribe."
+	}
+	if err != nil {
+		slog.Error("weekly lookup failed", "chat_id", chatID, "error", err)
+		return "Could not update your settings, please try again later."
+	}
+	sub.WeeklyOptOut = arg == "off"
+	if err := st.UpsertSubscriber(ctx, sub); err != nil {
+		slog.Error("weekly update failed", "chat_id", chatID, "error", err)
+		return "Could not update your settings, please try again later."
+	}
+	if sub.WeeklyOptOut {
+		return "📭 Weekly summaries turned off. Alerts for new spots continue as usual."
+	}
+	return "📬 Weekly summaries turned on."
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+	"github.com/AlexYaroshenko/montblanc/internal/telegram"
+)
+
+// asUsage is the reply to a malformed "/as" command
+const asUsage = "Usage: /as <chat_id> why <YYYY-MM-DD>"
+
+// missReasons explains the store.Miss* reasons to admins
+var missReasons = map[string]string{
+	store.MissGroupSize:       "checked for another group size than the query's",
+	store.MissWindow:          "outside the query's dates",
+	store.MissWeekday:         "not on the query's weekdays",
+	store.MissMinPlaces:       "fewer places than the query's minimum",
+	store.MissAlreadyNotified: "already alerted, the places didn't go up",
+	store.MissSnoozed:         "snoozed, the alert was held until the snooze ends",
+	store.MissQuietHours:      "quiet hours, the alert was held for the digest sent when they end",
+	store.MissDigest:          "daily digest mode, the alert was held for the day's digest",
+}
+
+// handleAsCommand renders the admin "/as <chat_id> why <date>" reply: the alerts the chat got
+// about date and the near misses recorded by the checks, i.e. why it wasn't alerted
+func handleAsCommand(ctx context.Context, st store.Store, txt string) string {
+	fields := strings.Fields(txt)
+	if len(fields) != 4 || fields[2] != "why" {
+		return asUsage
+	}
+	chatID, date := fields[1], fields[3]
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return asUsage
+	}
+	if _, err := st.GetSubscriber(ctx, chatID); errors.Is(err, store.ErrNotFound) {
+		return "Subscriber not found: " + chatID
+	} else if err != nil {
+		slog.Error("why: subscriber lookup failed", "chat_id", chatID, "error", err)
+		return "Error fetching the subscriber"
+	}
+	notified, err := st.ListNotifiedDates(ctx, chatID)
+	if err != nil {
+		slog.Error("why: failed to list notified dates", "chat_id", chatID, "error", err)
+		return "Error fetching the alert history"
+	}
+	decisions, err := st.ListMatchDecisions(ctx, chatID, date)
+	if err != nil {
+		slog.Error("why: failed to list near misses", "chat_id", chatID, "error", err)
+		return "Error fetching the near misses"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔎 %s, %s\n", chatID, date)
+	for _, n := range notified {
+		if n.Date == date {
+			fmt.Fprintf(&b, "✅ %s: alerted with %d places via %s at %s\n", telegram.EscapeHTML(n.Refuge), n.Places, n.Channel, n.SentAt.UTC().Format("2006-01-02 15:04 UTC"))
+		}
+	}
+	for _, d := range decisions {
+		reason := missReasons[d.Reason]
+		if reason == "" {
+			reason = d.Reason
+		}
+		if d.QueryID != "" {
+			reason += " (query " + telegram.EscapeHTML(d.QueryID) + ")"
+		}
+		fmt.Fprintf(&b, "• %s %s, %d places: %s\n", d.CheckedAt.UTC().Format("2006-01-02 15:04 UTC"), telegram.EscapeHTML(d.Refuge), d.Places, reason)
+	}
+	if len(decisions) == 0 {
+		b.WriteString("No near miss recorded lately: no query of the chat watches a refuge where the date was available\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexYaroshenko/montblanc/internal/store"
+)
+
+func TestAsWhyCommand(t *testing.T) {
+	st := store.NewMemory()
+	at := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	st.UpsertSubscriber(t.Context(), store.Subscriber{ChatID: "7", IsActive: true})
+	st.RecordNotification(t.Context(), store.Notification{ChatID: "7", Refuge: "Tête Rousse", Date: "2025-08-12", Places: 2, SentAt: at, Channel: store.ChannelTelegram})
+	st.RecordMatchDecisions(t.Context(), []store.MatchDecision{
+		{ChatID: "7", Refuge: "du Goûter", Date: "2025-08-12", QueryID: "q1", Reason: store.MissMinPlaces, Places: 1, CheckedAt: at},
+		{ChatID: "7", Refuge: "du Goûter", Date: "2025-08-13", QueryID: "q1", Reason: store.MissWindow, Places: 4, CheckedAt: at},
+	})
+
+	reply := handleAsCommand(t.Context(), st, "/as 7 why 2025-08-12")
+	for _, want := range []string{"✅ Tête Rousse: alerted with 2 places via telegram", "du Goûter, 1 places: fewer places than the query's minimum (query q1)"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("expected %q in %q", want, reply)
+		}
+	}
+	if strings.Contains(reply, "query's dates") {
+		t.Errorf("expected only the decisions about 2025-08-12, got %q", reply)
+	}
+	if reply := handleAsCommand(t.Context(), st, "/as 7 why 2025-08-14"); !strings.Contains(reply, "No near miss") {
+		t.Errorf("expected no near miss, got %q", reply)
+	}
+	for txt, want := range map[string]string{
+		"/as 8 why 2025-08-12":  "Subscriber not found",
+		"/as 7 why tomorrow":    asUsage,
+		"/as 7 stop":            asUsage,
+		"/as 7 what 2025-08-12": asUsage,
+	} {
+		if reply := handleAsCommand(t.Context(), st, txt); !strings.Contains(reply, want) {
+			t.Errorf("%s: expected %q, got %q", txt, want, reply)
+		}
+	}
+}